@@ -0,0 +1,149 @@
+//go:build !noexec && !js && !wasip1
+
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// runArchive implements -input with a zip or tar archive: it unpacks the
+// documents in it that the batch filters take into a temporary directory
+// and extracts them as a batch run, each into outputDir/PATH, PATH being
+// its path in the archive without the extension.
+func runArchive(file, outputDir string, batch batchInputs, jobs int, args []string) {
+	if outputDir == "" && !batch.sanitize {
+		outputDir = docName(filepath.Base(file))
+	} else if outputDir == "" {
+		outputDir = sanitizedName()
+	}
+	if batch.vectorDocument == "" {
+		batch.vectorDocument = filepath.Base(file)
+	}
+	tmp, err := os.MkdirTemp(tempDir, "pdfripper-archive-")
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	defer os.RemoveAll(tmp)
+
+	unpack := func(name string, r io.Reader) error {
+		rel, ok := archivePath(name)
+		if !ok || (batch.maxDepth > 0 && strings.Count(rel, "/")+1 > batch.maxDepth) || !batch.takes(rel) {
+			return nil
+		}
+		p := filepath.Join(tmp, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			return err
+		}
+		f, err := os.Create(p)
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(f, r); err != nil {
+			f.Close()
+			return fmt.Errorf("unpacking %s: %w", name, err)
+		}
+		if err := f.Close(); err != nil {
+			return err
+		}
+		batch.files = append(batch.files, batchFile{path: p, name: docName(rel), document: rel})
+		return nil
+	}
+	if archiveExt(file) == ".zip" {
+		err = walkZip(file, unpack)
+	} else {
+		err = walkTar(file, unpack)
+	}
+	if err != nil {
+		log.Fatalf("Error reading %s: %v", file, err)
+	}
+	if len(batch.files) == 0 {
+		fmt.Printf("No documents in %s\n", file)
+		return
+	}
+	fmt.Printf("Found %d documents in %s\n", len(batch.files), file)
+	err = runBatch(batch, outputDir, jobs, args)
+	os.RemoveAll(tmp)
+	batch.notify.done(file, redactURL(outputDir), err)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+}
+
+// archivePath cleans the path of an archive member, reporting false for
+// those that would land outside the directory it is unpacked into.
+func archivePath(name string) (string, bool) {
+	rel := path.Clean(strings.ReplaceAll(name, `\`, "/"))
+	if rel == "." || path.IsAbs(rel) || rel == ".." || strings.HasPrefix(rel, "../") || filepath.VolumeName(rel) != "" {
+		return "", false
+	}
+	return rel, true
+}
+
+// walkZip calls fn with each regular file in a zip archive.
+func walkZip(file string, fn func(name string, r io.Reader) error) error {
+	z, err := zip.OpenReader(file)
+	if err != nil {
+		return err
+	}
+	defer z.Close()
+	for _, f := range z.File {
+		if !f.Mode().IsRegular() {
+			continue
+		}
+		r, err := f.Open()
+		if err != nil {
+			return fmt.Errorf("opening %s: %w", f.Name, err)
+		}
+		err = fn(f.Name, r)
+		r.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// walkTar calls fn with each regular file in a tar archive, which may be
+// compressed with gzip.
+func walkTar(file string, fn func(name string, r io.Reader) error) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	var r io.Reader = f
+	if ext := archiveExt(file); ext == ".tar.gz" || ext == ".tgz" {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		r = gz
+	}
+	tr := tar.NewReader(r)
+	for {
+		h, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if h.Typeflag != tar.TypeReg {
+			continue
+		}
+		if err := fn(h.Name, tr); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+
+	"github.com/thnkr-one/pdfripper/pdfripper"
+)
+
+// artifactsDir is the directory of a job's directory its artifacts are
+// staged in, with -results, until they are uploaded.
+const artifactsDir = "artifacts"
+
+// jobArtifacts are the pre-signed URLs of a job's files in the -results
+// bucket, for clients to fetch them from the bucket directly.
+type jobArtifacts struct {
+	Manifest  string         `json:"manifest"` // manifest.json, listing every page.
+	Combined  string         `json:"combined"` // combined.txt, every page ending with a form feed.
+	Pages     []pageArtifact `json:"pages"`
+	ExpiresAt time.Time      `json:"expires_at"` // When the URLs stop working.
+}
+
+type pageArtifact struct {
+	Page int    `json:"page"`
+	URL  string `json:"url"`
+}
+
+// artifactWriter writes a job's artifacts as its pages come, in page
+// order: a page_N.txt file per page, combined.txt and, once the pages are
+// done, manifest.json.
+type artifactWriter struct {
+	dir      string
+	backend  string
+	combined *os.File
+	w        *bufio.Writer
+	entries  []pdfripper.ManifestEntry
+}
+
+func newArtifactWriter(dir, backend string) (*artifactWriter, error) {
+	if err := os.RemoveAll(dir); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	f, err := os.Create(filepath.Join(dir, "combined.txt"))
+	if err != nil {
+		return nil, err
+	}
+	return &artifactWriter{dir: dir, backend: backend, combined: f, w: bufio.NewWriter(f)}, nil
+}
+
+func (a *artifactWriter) page(r *pdfripper.PageResult) error {
+	name := fmt.Sprintf("page_%d.txt", r.Page)
+	if err := os.WriteFile(filepath.Join(a.dir, name), []byte(r.Text), 0644); err != nil {
+		return err
+	}
+	entry := pdfripper.NewManifestEntry(r, a.backend)
+	entry.File = name
+	a.entries = append(a.entries, entry)
+	if _, err := a.w.WriteString(r.Text); err != nil {
+		return err
+	}
+	return a.w.WriteByte('\f')
+}
+
+func (a *artifactWriter) close() error {
+	err := a.w.Flush()
+	if cerr := a.combined.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(pdfripper.Manifest{SchemaVersion: pdfripper.ManifestSchemaVersion, Pages: append([]pdfripper.ManifestEntry{}, a.entries...)}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(a.dir, "manifest.json"), append(data, '\n'), 0644)
+}
+
+// deliverArtifacts uploads the artifacts of job id, of the given pages, to
+// the job's directory in the -results bucket and returns their URLs.
+func (s *server) deliverArtifacts(id string, pages []pdfripper.PageRecord) (*jobArtifacts, error) {
+	dest := *s.results
+	dest.prefix = path.Join(dest.prefix, id)
+	up := newUploader(&dest, filepath.Join(s.store.jobDir(id), artifactsDir))
+	if err := up.finish(nil); err != nil {
+		return nil, fmt.Errorf("uploading results: %w", err)
+	}
+	a := &jobArtifacts{
+		Manifest:  dest.presign("manifest.json", s.resultsExpiry),
+		Combined:  dest.presign("combined.txt", s.resultsExpiry),
+		Pages:     []pageArtifact{},
+		ExpiresAt: time.Now().Add(min(s.resultsExpiry, s3MaxExpiry)).UTC(),
+	}
+	for _, p := range pages {
+		a.Pages = append(a.Pages, pageArtifact{Page: p.Page, URL: dest.presign(fmt.Sprintf("page_%d.txt", p.Page), s.resultsExpiry)})
+	}
+	return a, nil
+}
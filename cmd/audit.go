@@ -0,0 +1,33 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/thnkr-one/pdfripper/pdfripper"
+)
+
+// auditLogFlag registers -audit-log on fs, whose log parseFlags opens.
+func auditLogFlag(fs *flag.FlagSet) {
+	fs.String("audit-log", "", "Append a JSON line for every external command run to this file, with its arguments, duration, exit code and the SHA-256 digest of its standard error; the documents of a batch share it")
+}
+
+// openAuditLog sets the audit log named with -audit-log on fs, if fs has
+// the flag and it is set.
+func openAuditLog(fs *flag.FlagSet) error {
+	f := fs.Lookup("audit-log")
+	if f == nil || f.Value.String() == "" {
+		return nil
+	}
+	if dirs := confineDirs(fs); dirs != nil {
+		if err := pdfripper.Confined(f.Value.String(), dirs...); err != nil {
+			return fmt.Errorf("-audit-log with -confine-writes: %w", err)
+		}
+	}
+	l, err := pdfripper.OpenAuditLog(f.Value.String())
+	if err != nil {
+		return fmt.Errorf("-audit-log: %w", err)
+	}
+	pdfripper.SetAuditLog(l)
+	return nil
+}
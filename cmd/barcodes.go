@@ -0,0 +1,66 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"runtime"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/thnkr-one/pdfripper/pdfripper"
+)
+
+// runBarcodes implements "pdfripper barcodes": it renders every page and
+// lists the barcodes and QR codes found on it, with their position in points
+// from the top-left corner of the page.
+func runBarcodes(args []string) {
+	fs := flag.NewFlagSet("barcodes", flag.ExitOnError)
+	inputFile := fs.String("input", "", "Input PDF file path (required)")
+	passwordFlag(fs)
+	procCount := fs.Int("processes", 0, "Number of pages decoded concurrently (default: number of CPU cores)")
+	backendName := fs.String("backend", pdfripper.DefaultBackend, "Backend used to render pages ("+strings.Join(pdfripper.Backends(), ", ")+")")
+	dpi := fs.Int("dpi", pdfripper.DefaultBarcodeDPI, "Resolution pages are rendered at")
+	applySandbox := sandboxFlags(fs)
+	if !parseFlags(fs, args) {
+		return
+	}
+	if *inputFile == "" {
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	backend, err := pdfripper.LookupBackend(*backendName)
+	if err == nil {
+		backend, err = applySandbox(backend)
+	}
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	decoder, err := newBarcodeDecoder()
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	e := &pdfripper.Extractor{
+		PDFFile:        *inputFile,
+		ProcessCount:   *procCount,
+		Backend:        backend,
+		BarcodeDecoder: decoder,
+		BarcodeDPI:     *dpi,
+	}
+	if e.ProcessCount < 1 {
+		e.ProcessCount = runtime.NumCPU()
+	}
+
+	codes, err := e.ExtractBarcodes()
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "PAGE\tSYMBOLOGY\tX\tY\tWIDTH\tHEIGHT\tVALUE")
+	for _, c := range codes {
+		fmt.Fprintf(tw, "%d\t%s\t%.1f\t%.1f\t%.1f\t%.1f\t%q\n", c.Page, c.Symbology, c.X, c.Y, c.Width, c.Height, c.Value)
+	}
+	tw.Flush()
+	if err != nil {
+		log.Fatalf("Error extracting barcodes: %v", err)
+	}
+}
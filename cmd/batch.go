@@ -0,0 +1,157 @@
+package main
+
+import (
+	"log"
+	"path"
+	"strings"
+
+	"github.com/thnkr-one/pdfripper/pdfripper"
+)
+
+// archiveExtensions are those of the archives -input takes, whose PDFs
+// and emails are extracted as a batch.
+var archiveExtensions = []string{".zip", ".tar", ".tar.gz", ".tgz"}
+
+// quarantineModes are the values accepted by -quarantine.
+var quarantineModes = []string{"copy", "move"}
+
+// batchInputs are the flags that pick the documents of a batch run: a
+// list of them, or a directory to search, and the filters of either. The
+// batch of an email or archive has the documents in it as files instead.
+type batchInputs struct {
+	files    []batchFile
+	list     string // -input-list: a file, or "-" for stdin.
+	dir      string // -input-dir.
+	include  globList
+	exclude  globList
+	maxDepth int // Of files under dir; 1 is only its own (0: no limit).
+
+	linkDuplicates bool        // Extract files listed more than once only once.
+	quarantine     string      // "copy" or "move" documents that fail to the quarantine directory, or "".
+	office         string      // -soffice: if set, office documents are taken too.
+	sharedWorkers  int         // Backend calls made at once across the batch, shared fairly (0: each run has its own workers).
+	cache          string      // -cache: URL inputs are kept there too.
+	sanitize       bool        // -sanitize: outputs are named at random instead of after the documents.
+	vectors        bool        // -vector-store is set, so each run is given a -vector-document of its own.
+	vectorDocument string      // -vector-document: the name of the email or archive, which those of its documents start with.
+	password       string      // -password: handed to each run in its environment rather than on its command line.
+	notify         *notifyFlag // -notify: told when the batch ends; its documents are not.
+}
+
+// takes reports whether the filters of a batch take the file at rel, a
+// slash-separated path, leaving -max-depth aside. Without -include, the
+// documents isDocument names are taken, and office documents with
+// -soffice.
+func (b *batchInputs) takes(rel string) bool {
+	switch {
+	case b.exclude.match(rel):
+		return false
+	case len(b.include) > 0:
+		return b.include.match(rel)
+	}
+	return isDocument(rel) || (b.office != "" && pdfripper.IsOfficeFile(rel))
+}
+
+// isDocument reports whether a batch takes a file by default, as a PDF,
+// an email or an archive, by its extension.
+func isDocument(name string) bool {
+	return strings.EqualFold(path.Ext(name), ".pdf") || pdfripper.IsEmailFile(name) || isArchive(name)
+}
+
+// isBatchInput reports whether -input names a file extracted as a batch
+// of the documents in it: an email or an archive.
+func isBatchInput(name string) bool {
+	return pdfripper.IsEmailFile(name) || isArchive(name)
+}
+
+func isArchive(name string) bool {
+	return archiveExt(name) != ""
+}
+
+// archiveExt returns the extension of an archive, or "" if name is not
+// one.
+func archiveExt(name string) string {
+	lower := strings.ToLower(name)
+	for _, ext := range archiveExtensions {
+		if strings.HasSuffix(lower, ext) {
+			return ext
+		}
+	}
+	return ""
+}
+
+// docName returns a file name without its extension, taking .tar.gz as
+// one.
+func docName(name string) string {
+	if ext := archiveExt(name); ext != "" {
+		return name[:len(name)-len(ext)]
+	}
+	return strings.TrimSuffix(name, path.Ext(name))
+}
+
+// sanitizedName returns a random name for the output of a document of a
+// -sanitize run, which must not give away the document's own.
+func sanitizedName() string {
+	id, err := newJobID()
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	return "doc-" + id[:12]
+}
+
+// batchFile is a document of a batch given as it is.
+type batchFile struct {
+	path     string
+	name     string // Of its output, unique in the batch.
+	document string // Its -vector-document, also unique in the batch, before the batch's own.
+}
+
+// globList collects -include and -exclude patterns, which may be
+// repeated. Patterns are matched against slash-separated paths, segment by
+// segment as path.Match does, and a ** segment matches any number of
+// directories, none included: **/*.pdf matches a.pdf and x/y/a.pdf.
+type globList []string
+
+func (g *globList) String() string { return strings.Join(*g, " ") }
+
+func (g *globList) Set(s string) error {
+	for _, seg := range strings.Split(s, "/") {
+		if _, err := path.Match(seg, ""); err != nil {
+			return err
+		}
+	}
+	*g = append(*g, s)
+	return nil
+}
+
+// match reports whether name matches any of the patterns.
+func (g globList) match(name string) bool {
+	for _, pattern := range g {
+		if matchGlob(strings.Split(pattern, "/"), strings.Split(name, "/")) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchGlob matches the segments of a path against those of a pattern.
+func matchGlob(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				if matchGlob(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
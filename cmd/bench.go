@@ -0,0 +1,174 @@
+//go:build !noexec && !js && !wasip1
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/thnkr-one/pdfripper/pdfripper"
+)
+
+// benchResult is the outcome of one benchmarked configuration.
+type benchResult struct {
+	backend  string
+	workers  int
+	pages    int
+	elapsed  time.Duration
+	peakRSS  int64 // bytes, or -1 when the platform does not report it
+	failed   bool
+	errorMsg string
+}
+
+// runBench implements "pdfripper bench". Every configuration is run as a
+// separate child process so that peak RSS (including the extraction
+// subprocesses it spawns) is measured per configuration rather than
+// accumulated over the whole benchmark.
+func runBench(args []string) {
+	fs := flag.NewFlagSet("bench", flag.ExitOnError)
+	inputFile := fs.String("input", "", "Input PDF file path (required)")
+	passwordFlag(fs)
+	workerList := fs.String("processes", defaultWorkerList(), "Comma-separated worker counts to try")
+	backendList := fs.String("backends", strings.Join(pdfripper.Backends(), ","), "Comma-separated backends to try")
+	if !parseFlags(fs, args) {
+		return
+	}
+
+	if *inputFile == "" {
+		fs.Usage()
+		log.Fatal("Error: input PDF file is required (use -input)")
+	}
+
+	workers, err := parseIntList(*workerList)
+	if err != nil {
+		log.Fatalf("Error: invalid -processes: %v", err)
+	}
+
+	self, err := os.Executable()
+	if err != nil {
+		log.Fatalf("Error locating pdfripper binary: %v", err)
+	}
+
+	var results []benchResult
+	for _, name := range strings.Split(*backendList, ",") {
+		name = strings.TrimSpace(name)
+		backend, err := pdfripper.LookupBackend(name)
+		if err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+		pages, err := backend.PageCount(*inputFile)
+		if err != nil {
+			log.Fatalf("Error counting pages with %s: %v", name, err)
+		}
+		for _, w := range workers {
+			fmt.Fprintf(os.Stderr, "Running %s with %d workers...\n", name, w)
+			r := benchOnce(self, *inputFile, name, w)
+			r.pages = pages
+			results = append(results, r)
+		}
+	}
+
+	printBenchResults(results)
+}
+
+// benchOnce extracts the input into a scratch directory with one
+// configuration and reports how long it took.
+func benchOnce(self, inputFile, backend string, workers int) benchResult {
+	r := benchResult{backend: backend, workers: workers, peakRSS: -1}
+
+	tmpDir, err := os.MkdirTemp("", "pdfripper-bench-")
+	if err != nil {
+		r.failed, r.errorMsg = true, err.Error()
+		return r
+	}
+	defer os.RemoveAll(tmpDir)
+
+	cmd := exec.Command(self,
+		"-input", inputFile,
+		"-output", tmpDir,
+		"-processes", strconv.Itoa(workers),
+		"-backend", backend,
+	)
+	start := time.Now()
+	out, err := cmd.CombinedOutput()
+	r.elapsed = time.Since(start)
+	if err != nil {
+		r.failed = true
+		r.errorMsg = lastLine(string(out))
+	}
+	if cmd.ProcessState != nil {
+		r.peakRSS = peakRSS(cmd.ProcessState)
+	}
+	return r
+}
+
+func printBenchResults(results []benchResult) {
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "BACKEND\tWORKERS\tPAGES\tSECONDS\tPAGES/SEC\tPEAK RSS")
+	for _, r := range results {
+		if r.failed {
+			fmt.Fprintf(tw, "%s\t%d\t%d\t-\t-\tFAILED: %s\n", r.backend, r.workers, r.pages, r.errorMsg)
+			continue
+		}
+		secs := r.elapsed.Seconds()
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%.2f\t%.1f\t%s\n",
+			r.backend, r.workers, r.pages, secs, float64(r.pages)/secs, formatBytes(r.peakRSS))
+	}
+	tw.Flush()
+}
+
+// defaultWorkerList returns powers of two up to the number of CPU cores,
+// always including the core count itself.
+func defaultWorkerList() string {
+	var counts []string
+	n := runtime.NumCPU()
+	for w := 1; w < n; w *= 2 {
+		counts = append(counts, strconv.Itoa(w))
+	}
+	counts = append(counts, strconv.Itoa(n))
+	return strings.Join(counts, ",")
+}
+
+func parseIntList(s string) ([]int, error) {
+	var list []int
+	for _, field := range strings.Split(s, ",") {
+		n, err := strconv.Atoi(strings.TrimSpace(field))
+		if err != nil {
+			return nil, err
+		}
+		if n < 1 {
+			return nil, fmt.Errorf("worker count %d must be at least 1", n)
+		}
+		list = append(list, n)
+	}
+	return list, nil
+}
+
+func formatBytes(n int64) string {
+	if n < 0 {
+		return "n/a"
+	}
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+func lastLine(s string) string {
+	lines := strings.Split(strings.TrimSpace(s), "\n")
+	return lines[len(lines)-1]
+}
@@ -0,0 +1,16 @@
+//go:build noexec || js || wasip1
+
+package main
+
+import (
+	"flag"
+	"log"
+)
+
+// runBench needs to start child processes, which this build leaves out.
+func runBench(args []string) {
+	if !parseFlags(flag.NewFlagSet("bench", flag.ExitOnError), args) {
+		return
+	}
+	log.Fatal("Error: bench is not available in builds without subprocess support")
+}
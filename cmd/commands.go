@@ -0,0 +1,111 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/thnkr-one/pdfripper/pdfripper"
+)
+
+// command is a subcommand of pdfripper, as in "pdfripper fonts -input
+// a.pdf".
+type command struct {
+	name     string
+	synopsis string   // Arguments after the name, for usage lines and the man page.
+	summary  string   // One sentence saying what the command does.
+	words    []string // Fixed first arguments, offered by shell completion.
+	run      func(args []string)
+}
+
+// commands returns the subcommands of pdfripper, in the order the man page
+// lists them. Plain "pdfripper" with no subcommand extracts text.
+func commands() []command {
+	return []command{
+		{name: "run", synopsis: "[-dry-run] RECIPE [flags]", summary: "Run the extraction pipeline a YAML recipe describes, its stages from repair to sink.", run: runRecipe},
+		{name: "bench", synopsis: "-input FILE [flags]", summary: "Measure the time and peak memory of extraction with each backend and worker count.", run: runBench},
+		{name: "serve", synopsis: "[flags]", summary: "Serve extraction over HTTP, with API keys, quotas and a job queue.", run: runServe},
+		{name: "info", synopsis: "-input FILE [-json]", summary: "Report the PDF version, linearization, encryption, object and stream counts and incremental updates of a document.", run: runInfo},
+		{name: "revisions", synopsis: "-input FILE [-json]", summary: "List the revisions of an incrementally updated document, with the pages each save changed.", run: runRevisions},
+		{name: "fonts", synopsis: "-input FILE", summary: "List the fonts of every page and warn about fonts whose text cannot be extracted.", run: runFonts},
+		{name: "links", synopsis: "-input FILE [-format json|graphml] [-output FILE]", summary: "Export the internal links of a document, between pages and through named destinations, as a JSON or GraphML graph.", run: runLinks},
+		{name: "metadata", synopsis: "-input FILE [-metadata-map FILE]", summary: "List the Info entries and XMP properties of a document and the manifest fields they give.", run: runMetadata},
+		{name: "barcodes", synopsis: "-input FILE [flags]", summary: "List the barcodes and QR codes on every page, with their positions.", run: runBarcodes},
+		{name: "merge", synopsis: "[-tool native|pdfunite] OUT.pdf A.pdf B.pdf...", summary: "Write the pages of the inputs, in order, to one document.", run: runMerge},
+		{name: "rescans", synopsis: "[flags] DIR_OR_MANIFEST...", summary: "Report documents whose page images match those of another run, such as a batch scanned again.", run: runRescans},
+		{name: "compare-backends", synopsis: "-input FILE [flags]", summary: "Extract a document with two backends and report how alike their text is, page by page, and how long each took.", run: runCompareBackends},
+		{name: "evaluate", synopsis: "-corpus DIR -golden DIR [flags]", summary: "Extract a corpus and compare it with golden outputs, reporting the pages that regressed.", run: runEvaluate},
+		{name: "selftest", synopsis: "[-backends LIST] [-keep]", summary: "Extract a built-in set of synthetic PDFs with every backend and check their text, as a smoke test of a deployment.", run: runSelftest},
+		{name: "schema", synopsis: "manifest|pages|events", summary: "Print the JSON Schema of manifest.json, of server responses or of progress events.", words: pdfripper.Schemas, run: runSchema},
+		{name: "completion", synopsis: "bash|zsh|fish", summary: "Print a shell completion script.", words: []string{"bash", "zsh", "fish"}, run: runCompletion},
+		{name: "man", synopsis: "", summary: "Print the man page, in roff.", run: runMan},
+	}
+}
+
+// collecting, when set, is handed the flags of a command in place of
+// running it, by parseFlags.
+var collecting func(fs *flag.FlagSet)
+
+// parseFlags sets the flags of fs from the config file, then from the
+// environment and then from args, and reports whether the command should
+// go on. While the flags of commands are being collected, see flagsOf, it
+// hands fs over instead and returns false, so commands must call it
+// before doing anything else. It also opens the audit log, if fs has
+// -audit-log, and sets the password of encrypted inputs, if fs has
+// -password.
+func parseFlags(fs *flag.FlagSet, args []string) bool {
+	if collecting != nil {
+		collecting(fs)
+		return false
+	}
+	if err := applyConfig(fs); err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	if err := applyEnv(fs); err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	fs.Parse(args)
+	if err := openAuditLog(fs); err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	setPassword(fs)
+	return true
+}
+
+// envPrefix starts the names of the environment variables flags can be
+// set with.
+const envPrefix = "PDFRIPPER_"
+
+// envName returns the environment variable for a flag: PDFRIPPER_OCR_DPI
+// for -ocr-dpi.
+func envName(flag string) string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(flag, "-", "_"))
+}
+
+// applyEnv sets the flags of fs whose environment variables are set and
+// not empty. It runs before the command line is parsed, so flags given
+// there take precedence, and values from the environment do not count as
+// given for checkFlags.
+func applyEnv(fs *flag.FlagSet) error {
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		name := envName(f.Name)
+		if v := os.Getenv(name); v != "" && err == nil {
+			if serr := f.Value.Set(v); serr != nil {
+				err = fmt.Errorf("$%s: invalid value %q: %v", name, v, serr)
+			}
+		}
+	})
+	return err
+}
+
+// flagsOf returns the flags run defines, or nil if it has none.
+func flagsOf(run func(args []string)) *flag.FlagSet {
+	var got *flag.FlagSet
+	collecting = func(fs *flag.FlagSet) { got = fs }
+	defer func() { collecting = nil }()
+	run(nil)
+	return got
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"runtime"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/thnkr-one/pdfripper/pdfripper"
+)
+
+// compareContext is the number of words of each text shown around the
+// first difference of a diverging page.
+const compareContext = 6
+
+// pageComparison is how two backends did on one page.
+type pageComparison struct {
+	texts      [2]string
+	elapsed    [2]time.Duration
+	errs       [2]error
+	similarity float64
+}
+
+// runCompareBackends implements "pdfripper compare-backends": it extracts
+// every page of a document with two backends and reports how similar
+// their text is page by page, how long each took and where they diverge,
+// for judging how far a backend can be trusted on a corpus. It exits with
+// status 2 if any page diverges or fails, so scripts can collect those
+// documents.
+func runCompareBackends(args []string) {
+	fs := flag.NewFlagSet("compare-backends", flag.ExitOnError)
+	inputFile := fs.String("input", "", "Input PDF file path (required)")
+	passwordFlag(fs)
+	nameA := fs.String("a", pdfripper.DefaultBackend, "First backend ("+strings.Join(pdfripper.Backends(), ", ")+")")
+	nameB := fs.String("b", "", "Second backend (default: the first available other than -a)")
+	threshold := fs.Float64("threshold", 0.9, "Similarity from 0 to 1 below which a page's two texts diverge")
+	procCount := fs.Int("processes", 0, "Number of pages compared concurrently (default: number of CPU cores)")
+	all := fs.Bool("all", false, "List every page, not just those that diverge or fail")
+	applySandbox := sandboxFlags(fs)
+	if !parseFlags(fs, args) {
+		return
+	}
+	if *inputFile == "" {
+		fs.Usage()
+		os.Exit(1)
+	}
+	if *nameB == "" {
+		for _, name := range pdfripper.Backends() {
+			if name != *nameA {
+				*nameB = name
+				break
+			}
+		}
+		if *nameB == "" {
+			log.Fatalf("Error: no backend other than %s is available to compare with", *nameA)
+		}
+	}
+	names := [2]string{*nameA, *nameB}
+	var backends [2]pdfripper.Backend
+	for i, name := range names {
+		b, err := pdfripper.LookupBackend(name)
+		if err == nil {
+			b, err = applySandbox(b)
+		}
+		if err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+		backends[i] = b
+	}
+	if *procCount < 1 {
+		*procCount = runtime.NumCPU()
+	}
+
+	var counts [2]int
+	for i, b := range backends {
+		n, err := b.PageCount(*inputFile)
+		if err != nil {
+			log.Fatalf("Error counting pages with %s: %v", names[i], err)
+		}
+		counts[i] = n
+	}
+	if counts[0] != counts[1] {
+		log.Printf("Warning: %s counts %d pages and %s %d", names[0], counts[0], names[1], counts[1])
+	}
+	pages := make([]pageComparison, max(counts[0], counts[1]))
+	work := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < *procCount; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range work {
+				c := &pages[i]
+				for k, b := range backends {
+					if i >= counts[k] {
+						c.errs[k] = fmt.Errorf("no page %d", i+1)
+						continue
+					}
+					start := time.Now()
+					c.texts[k], c.errs[k] = b.ExtractPage(*inputFile, i+1)
+					c.elapsed[k] = time.Since(start)
+				}
+				c.similarity = pdfripper.TextSimilarity(c.texts[0], c.texts[1])
+			}
+		}()
+	}
+	for i := range pages {
+		work <- i
+	}
+	close(work)
+	wg.Wait()
+
+	fmt.Printf("Comparing %s and %s on %d pages of %s\n", names[0], names[1], len(pages), *inputFile)
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "PAGE\tSIMILARITY\t%[1]s MS\t%[2]s MS\t%[1]s WORDS\t%[2]s WORDS\tDIFFERENCE\n", strings.ToUpper(names[0]), strings.ToUpper(names[1]))
+	var diverging []string
+	var total [2]time.Duration
+	sum := 0.0
+	for i, c := range pages {
+		total[0] += c.elapsed[0]
+		total[1] += c.elapsed[1]
+		sum += c.similarity
+		var difference string
+		switch {
+		case c.errs[0] != nil || c.errs[1] != nil:
+			difference = "FAILED: " + joinErrs(names, c.errs)
+		case c.similarity < *threshold:
+			difference = firstDifference(c.texts[0], c.texts[1])
+		case !*all:
+			continue
+		}
+		if difference != "" {
+			diverging = append(diverging, fmt.Sprint(i+1))
+		}
+		fmt.Fprintf(tw, "%d\t%.3f\t%d\t%d\t%d\t%d\t%s\n", i+1, c.similarity,
+			c.elapsed[0].Milliseconds(), c.elapsed[1].Milliseconds(),
+			len(strings.Fields(c.texts[0])), len(strings.Fields(c.texts[1])), difference)
+	}
+	tw.Flush()
+
+	if len(pages) > 0 {
+		fmt.Printf("Mean similarity %.3f; %d of %d pages diverge (below %.2f) or fail", sum/float64(len(pages)), len(diverging), len(pages), *threshold)
+		if len(diverging) > 0 {
+			fmt.Printf(": %s", strings.Join(diverging, ", "))
+		}
+		fmt.Println()
+	}
+	fmt.Printf("%s took %s in total, %s %s\n", names[0], total[0].Round(time.Millisecond), names[1], total[1].Round(time.Millisecond))
+	if len(diverging) > 0 {
+		os.Exit(2)
+	}
+}
+
+// joinErrs describes the failures of a page, naming the backends.
+func joinErrs(names [2]string, errs [2]error) string {
+	var parts []string
+	for i, err := range errs {
+		if err != nil {
+			parts = append(parts, names[i]+": "+err.Error())
+		}
+	}
+	return strings.Join(parts, "; ")
+}
+
+// firstDifference shows the words of a and b from a little before the
+// first word where they part.
+func firstDifference(a, b string) string {
+	wa, wb := strings.Fields(a), strings.Fields(b)
+	i := 0
+	for i < len(wa) && i < len(wb) && wa[i] == wb[i] {
+		i++
+	}
+	excerpt := func(words []string) string {
+		from := max(i-compareContext/2, 0)
+		to := min(i+compareContext, len(words))
+		if from >= to {
+			return "(end)"
+		}
+		return fmt.Sprintf("%q", strings.Join(words[from:to], " "))
+	}
+	return fmt.Sprintf("at word %d: %s / %s", i+1, excerpt(wa), excerpt(wb))
+}
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+)
+
+// runCompletion implements "pdfripper completion SHELL": it prints a
+// script completing pdfripper's subcommands and flags in bash, zsh or
+// fish, generated from their definitions.
+func runCompletion(args []string) {
+	fs := flag.NewFlagSet("completion", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: pdfripper completion bash|zsh|fish")
+		fmt.Fprintln(fs.Output(), "For example, in ~/.bashrc: source <(pdfripper completion bash)")
+	}
+	if !parseFlags(fs, args) {
+		return
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(1)
+	}
+	switch fs.Arg(0) {
+	case "bash":
+		fmt.Print(bashCompletion())
+	case "zsh":
+		fmt.Print(zshCompletion())
+	case "fish":
+		fmt.Print(fishCompletion())
+	default:
+		log.Fatalf("Error: unknown shell %q (available: bash, zsh, fish)", fs.Arg(0))
+	}
+}
+
+// cliFlag is a flag as completions and the man page describe it.
+type cliFlag struct {
+	name    string
+	value   string // Name of the flag's value, "" for boolean flags.
+	usage   string
+	def     string // Default worth mentioning, if the usage does not already.
+	boolean bool
+}
+
+// listFlags returns the flags of fs, sorted by name; fs may be nil.
+func listFlags(fs *flag.FlagSet) []cliFlag {
+	if fs == nil {
+		return nil
+	}
+	var flags []cliFlag
+	fs.VisitAll(func(f *flag.Flag) {
+		value, usage := flag.UnquoteUsage(f)
+		c := cliFlag{name: f.Name, value: value, usage: usage}
+		if b, ok := f.Value.(interface{ IsBoolFlag() bool }); ok && b.IsBoolFlag() {
+			c.boolean, c.value = true, ""
+		}
+		// Usages that give their default, such as one read from the
+		// environment, keep its value out of generated files.
+		switch f.DefValue {
+		case "", "0", "false", "0s", "[]":
+		default:
+			if !strings.Contains(usage, "default:") {
+				c.def = f.DefValue
+			}
+		}
+		flags = append(flags, c)
+	})
+	return flags
+}
+
+func flagNames(flags []cliFlag) string {
+	names := make([]string, len(flags))
+	for i, f := range flags {
+		names[i] = "-" + f.name
+	}
+	return strings.Join(names, " ")
+}
+
+func bashCompletion() string {
+	var b strings.Builder
+	extract := listFlags(flagsOf(runExtract))
+	var names []string
+	for _, c := range commands() {
+		names = append(names, c.name)
+	}
+	b.WriteString("# bash completion for pdfripper, generated by \"pdfripper completion bash\".\n")
+	b.WriteString("_pdfripper() {\n\tlocal cur=${COMP_WORDS[COMP_CWORD]} words\n")
+	fmt.Fprintf(&b, "\tif [[ $COMP_CWORD -eq 1 ]]; then\n\t\twords=%q\n\telse\n\t\tcase ${COMP_WORDS[1]} in\n", strings.Join(names, " ")+" "+flagNames(extract))
+	for _, c := range commands() {
+		words := strings.TrimSpace(strings.Join(c.words, " ") + " " + flagNames(listFlags(flagsOf(c.run))))
+		fmt.Fprintf(&b, "\t\t%s) words=%q ;;\n", c.name, words)
+	}
+	fmt.Fprintf(&b, "\t\t*) words=%q ;;\n", flagNames(extract))
+	b.WriteString("\t\tesac\n\tfi\n\tCOMPREPLY=($(compgen -W \"$words\" -- \"$cur\"))\n}\n")
+	b.WriteString("complete -o default -F _pdfripper pdfripper\n")
+	return b.String()
+}
+
+// zshQuote escapes s for a description in an _arguments spec, inside
+// single quotes.
+func zshQuote(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "[", `\[`, "]", `\]`, ":", `\:`, "'", `'\''`).Replace(s)
+}
+
+func zshSpecs(b *strings.Builder, flags []cliFlag, indent string) {
+	for _, f := range flags {
+		fmt.Fprintf(b, " \\\n%s'-%s[%s]", indent, f.name, zshQuote(f.usage))
+		if !f.boolean {
+			fmt.Fprintf(b, ":%s:_files", zshQuote(f.value))
+		}
+		b.WriteString("'")
+	}
+}
+
+func zshCompletion() string {
+	var b strings.Builder
+	b.WriteString("#compdef pdfripper\n# zsh completion for pdfripper, generated by \"pdfripper completion zsh\".\n")
+	b.WriteString("_pdfripper() {\n\tlocal -a commands\n\tcommands=(\n")
+	for _, c := range commands() {
+		fmt.Fprintf(&b, "\t\t'%s:%s'\n", c.name, zshQuote(c.summary))
+	}
+	b.WriteString("\t)\n\tif (( CURRENT == 2 )) && [[ $PREFIX != -* ]]; then\n\t\t_describe command commands\n\t\treturn\n\tfi\n")
+	b.WriteString("\tcase $words[2] in\n")
+	for _, c := range commands() {
+		fmt.Fprintf(&b, "\t%s)\n\t\tshift words\n\t\t(( CURRENT-- ))\n\t\t_arguments", c.name)
+		zshSpecs(&b, listFlags(flagsOf(c.run)), "\t\t\t")
+		if len(c.words) > 0 {
+			fmt.Fprintf(&b, " \\\n\t\t\t'1:argument:(%s)'", strings.Join(c.words, " "))
+		} else {
+			b.WriteString(" \\\n\t\t\t'*:file:_files'")
+		}
+		b.WriteString(" ;;\n")
+	}
+	b.WriteString("\t*)\n\t\t_arguments")
+	zshSpecs(&b, listFlags(flagsOf(runExtract)), "\t\t\t")
+	b.WriteString(" ;;\n\tesac\n}\n")
+	b.WriteString("if [[ $zsh_eval_context[-1] == loadautofunc ]]; then\n\t_pdfripper \"$@\"\nelse\n\tcompdef _pdfripper pdfripper\nfi\n")
+	return b.String()
+}
+
+// fishQuote quotes s for fish.
+func fishQuote(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, "'", `\'`).Replace(s) + "'"
+}
+
+func fishFlags(b *strings.Builder, condition string, flags []cliFlag) {
+	for _, f := range flags {
+		fmt.Fprintf(b, "complete -c pdfripper -n %s -o %s -d %s", fishQuote(condition), f.name, fishQuote(f.usage))
+		if !f.boolean {
+			b.WriteString(" -r")
+		}
+		b.WriteString("\n")
+	}
+}
+
+func fishCompletion() string {
+	var b strings.Builder
+	var names []string
+	for _, c := range commands() {
+		names = append(names, c.name)
+	}
+	b.WriteString("# fish completion for pdfripper, generated by \"pdfripper completion fish\".\n")
+	for _, c := range commands() {
+		fmt.Fprintf(&b, "complete -c pdfripper -n __fish_use_subcommand -f -a %s -d %s\n", c.name, fishQuote(c.summary))
+	}
+	fishFlags(&b, "not __fish_seen_subcommand_from "+strings.Join(names, " "), listFlags(flagsOf(runExtract)))
+	for _, c := range commands() {
+		condition := "__fish_seen_subcommand_from " + c.name
+		if len(c.words) > 0 {
+			fmt.Fprintf(&b, "complete -c pdfripper -n %s -f -a %s\n", fishQuote(condition), fishQuote(strings.Join(c.words, " ")))
+		}
+		fishFlags(&b, condition, listFlags(flagsOf(c.run)))
+	}
+	return b.String()
+}
+
+// runMan implements "pdfripper man": it prints pdfripper's man page in
+// roff, generated from the definitions of its subcommands and flags, as
+// in "pdfripper man > /usr/local/share/man/man1/pdfripper.1".
+func runMan(args []string) {
+	fs := flag.NewFlagSet("man", flag.ExitOnError)
+	if !parseFlags(fs, args) {
+		return
+	}
+	fmt.Print(manPage())
+}
+
+// roffEscape escapes text for roff, which takes backslashes as escapes
+// and a line starting with a dot or quote as a request.
+func roffEscape(s string) string {
+	s = strings.NewReplacer(`\`, `\e`, "-", `\-`).Replace(s)
+	if strings.HasPrefix(s, ".") || strings.HasPrefix(s, "'") {
+		s = `\&` + s
+	}
+	return s
+}
+
+func manFlags(b *strings.Builder, flags []cliFlag) {
+	for _, f := range flags {
+		if f.value != "" {
+			fmt.Fprintf(b, ".TP\n.BI \\-%s \" %s\"", roffEscape(f.name), roffEscape(f.value))
+		} else {
+			fmt.Fprintf(b, ".TP\n.B \\-%s", roffEscape(f.name))
+		}
+		b.WriteString("\n" + roffEscape(f.usage))
+		if f.def != "" {
+			fmt.Fprintf(b, " (default: %s)", roffEscape(f.def))
+		}
+		b.WriteString("\n")
+	}
+}
+
+func manPage() string {
+	var b strings.Builder
+	b.WriteString(".TH PDFRIPPER 1\n")
+	b.WriteString(".SH NAME\npdfripper \\- extract the text of PDF documents page by page\n")
+	b.WriteString(".SH SYNOPSIS\n.B pdfripper\n\\-input \\fIFILE\\fR [\\fIflags\\fR]\n")
+	for _, c := range commands() {
+		fmt.Fprintf(&b, ".br\n.B pdfripper %s\n%s\n", c.name, roffEscape(c.synopsis))
+	}
+	b.WriteString(".SH DESCRIPTION\n")
+	b.WriteString("pdfripper extracts the text of every page of a PDF document with a choice of backends, writing one file per page to the output directory, " +
+		"running OCR on pages whose text looks like garbage if asked to. The subcommands below do related work.\n")
+	b.WriteString(".SH OPTIONS\n")
+	manFlags(&b, listFlags(flagsOf(runExtract)))
+	b.WriteString(".SH COMMANDS\n")
+	for _, c := range commands() {
+		fmt.Fprintf(&b, ".SS %s\n%s\n", c.name, roffEscape(c.summary))
+		manFlags(&b, listFlags(flagsOf(c.run)))
+	}
+	b.WriteString(".SH ENVIRONMENT\n")
+	b.WriteString("Every flag, of every command, can also be set with an environment variable named after it: " +
+		envPrefix + "OCR_DPI for \\-ocr\\-dpi, " + envPrefix + "BACKEND for \\-backend and so on. " +
+		"Flags given on the command line take precedence over the environment, which takes precedence over the config file, and that over the defaults. " +
+		"Empty variables are ignored. Secrets such as the OCR API key and " + envPrefix + "PASSWORD, the user password of encrypted inputs, " +
+		"are best set this way, where other users cannot see them.\n")
+	b.WriteString(".TP\n.B " + configEnv + "\nThe config file, which must exist, in place of the default one.\n")
+	b.WriteString(".TP\n.B " + envPrefix + "DAV_PASSWORD\nPassword for WebDAV output URLs that do not give one.\n")
+	b.WriteString(".SH FILES\n.TP\n.I ~/.config/pdfripper/config.yaml\n")
+	b.WriteString("The config file, read if it exists and " + configEnv + " is not set; it is under $XDG_CONFIG_HOME instead, if that is set. " +
+		"It is a YAML mapping of flag names, without the dash, to their values, which every command that has the flag takes, " +
+		"and of command names to mappings of the flags of that command alone, which take precedence:\n" +
+		".PP\n.nf\nprocesses: 8\nmanifest\\-format: [json, csv]\nserve:\n  addr: \":9090\"\n.fi\n.PP\n" +
+		"Lists give flags that may be repeated, such as \\-include, once for each item, and others their items separated by commas. " +
+		"Names that no command has are errors.\n")
+	return b.String()
+}
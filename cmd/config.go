@@ -0,0 +1,146 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+)
+
+// configEnv names the environment variable that gives the config file.
+// No flag is named -config, so it sets none.
+const configEnv = envPrefix + "CONFIG"
+
+// config is a config file: the flag values of every command that has the
+// flags, and those of one command only, by its name.
+type config struct {
+	file     string
+	flags    map[string]any
+	commands map[string]map[string]any
+}
+
+// configPath returns the config file flags default to: $PDFRIPPER_CONFIG,
+// which must then exist, or else pdfripper/config.yaml in the directory
+// os.UserConfigDir gives, if it exists.
+func configPath() (file string, required bool) {
+	if file := os.Getenv(configEnv); file != "" {
+		return file, true
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", false
+	}
+	return filepath.Join(dir, "pdfripper", "config.yaml"), false
+}
+
+// applyConfig sets the flags of fs the config file gives. It runs before
+// applyEnv, so the environment and then the command line take precedence,
+// and values from it do not count as given for checkFlags either.
+func applyConfig(fs *flag.FlagSet) error {
+	file, required := configPath()
+	if file == "" {
+		return nil
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		if !required && errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return fmt.Errorf("config file: %w", err)
+	}
+	c, err := parseConfig(file, data)
+	if err != nil {
+		return err
+	}
+	return c.apply(fs)
+}
+
+// parseConfig parses a config file: a YAML mapping of flag names, without
+// the dash, to their values, which every command that has the flag takes,
+// and of command names to mappings of the flags of that command alone,
+// which take precedence:
+//
+//	processes: 8
+//	manifest-format: [json, csv]
+//	serve:
+//	  addr: ":9090"
+//
+// Lists give flags that may be repeated once for each item, and others
+// their items separated by commas. Names that no command has are errors.
+func parseConfig(file string, data []byte) (*config, error) {
+	doc, err := parseYAML(file, data)
+	if err != nil {
+		return nil, err
+	}
+	top, ok := doc.(map[string]any)
+	if !ok && doc != nil {
+		return nil, fmt.Errorf("%s: not a mapping of flags to their values", file)
+	}
+
+	known := map[string]map[string]bool{}
+	all := map[string]bool{}
+	add := func(command string, fs *flag.FlagSet) {
+		known[command] = map[string]bool{}
+		if fs != nil {
+			fs.VisitAll(func(f *flag.Flag) {
+				known[command][f.Name] = true
+				all[f.Name] = true
+			})
+		}
+	}
+	add("", flagsOf(runExtract))
+	for _, cmd := range commands() {
+		add(cmd.name, flagsOf(cmd.run))
+	}
+
+	c := &config{file: file, flags: map[string]any{}, commands: map[string]map[string]any{}}
+	for name, v := range top {
+		section, isSection := v.(map[string]any)
+		switch {
+		case isSection && name != "" && known[name] != nil:
+			for flagName := range section {
+				if !known[name][flagName] {
+					return nil, fmt.Errorf("%s: %s: pdfripper %s has no flag -%s", file, name, name, flagName)
+				}
+			}
+			c.commands[name] = section
+		case all[name]:
+			c.flags[name] = v
+		default:
+			return nil, fmt.Errorf("%s: no command has a flag -%s", file, name)
+		}
+	}
+	return c, nil
+}
+
+// apply sets the flags of fs to the values the config gives them.
+func (c *config) apply(fs *flag.FlagSet) error {
+	values := maps.Clone(c.flags)
+	maps.Copy(values, c.commands[fs.Name()])
+	for _, name := range sortedKeys(values) {
+		f := fs.Lookup(name)
+		if f == nil {
+			continue
+		}
+		items := []any{values[name]}
+		// The flags that may be repeated have types of their own, which
+		// are not flag.Getters, as those of the flag package are.
+		if list, ok := values[name].([]any); ok {
+			if _, ok := f.Value.(flag.Getter); !ok {
+				items = list
+			}
+		}
+		for _, item := range items {
+			v, err := recipeValue(item)
+			if err != nil {
+				return fmt.Errorf("%s: %s: %v", c.file, name, err)
+			}
+			if err := f.Value.Set(v); err != nil {
+				return fmt.Errorf("%s: %s: invalid value %q: %v", c.file, name, v, err)
+			}
+		}
+	}
+	return nil
+}
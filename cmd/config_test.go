@@ -0,0 +1,76 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestConfigPrecedence(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(file, []byte(`
+processes: 8
+backend: native
+manifest-format: [json, csv]
+include: ["**/*.pdf", "*.eml"]
+serve:
+  addr: ":9090"
+  processes: 2
+`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv(configEnv, file)
+	t.Setenv("PDFRIPPER_BACKEND", "poppler")
+
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	addr := fs.String("addr", ":8080", "")
+	processes := fs.Int("processes", 0, "")
+	backend := fs.String("backend", "", "")
+	formats := fs.String("manifest-format", "", "")
+	var include globList
+	fs.Var(&include, "include", "")
+	if !parseFlags(fs, []string{"-addr", ":7070"}) {
+		t.Fatal("parseFlags returned false")
+	}
+	// The command line over the environment, over the command's section,
+	// over the flags of every command.
+	if *addr != ":7070" || *processes != 2 || *backend != "poppler" || *formats != "json,csv" || include.String() != "**/*.pdf *.eml" {
+		t.Errorf("got -addr %s -processes %d -backend %s -manifest-format %s -include %s", *addr, *processes, *backend, *formats, include.String())
+	}
+	// Values from the file are defaults, not flags given.
+	n := 0
+	fs.Visit(func(*flag.Flag) { n++ })
+	if n != 1 {
+		t.Errorf("%d flags count as given, want only -addr", n)
+	}
+}
+
+func TestConfigErrors(t *testing.T) {
+	for _, tt := range []struct {
+		name, config, err string
+	}{
+		{"not a mapping", "- processes\n", "config.yaml: not a mapping of flags to their values"},
+		{"unknown flag", "proceses: 8\n", "config.yaml: no command has a flag -proceses"},
+		{"flag of another command", "serve:\n  input-list: docs.txt\n", "config.yaml: serve: pdfripper serve has no flag -input-list"},
+		{"bad value", "processes: [1, 2]\nserve:\n  processes: many\n", `config.yaml: processes: invalid value "many"`},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := parseConfig("config.yaml", []byte(tt.config))
+			if err == nil {
+				fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+				fs.Int("processes", 0, "")
+				err = c.apply(fs)
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("got error %v, want %q", err, tt.err)
+			}
+		})
+	}
+
+	t.Setenv(configEnv, filepath.Join(t.TempDir(), "missing.yaml"))
+	if err := applyConfig(flag.NewFlagSet("serve", flag.ContinueOnError)); err == nil {
+		t.Error("a missing $PDFRIPPER_CONFIG is not an error")
+	}
+}
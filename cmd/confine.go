@@ -0,0 +1,46 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+)
+
+// tempDir is -temp-dir, the directory temporary files and directories are
+// made in ("": os.TempDir).
+var tempDir string
+
+// batchOutputEnv passes the -output of a batch to the runs of its
+// documents, which may write anywhere in it with -confine-writes.
+const batchOutputEnv = "PDFRIPPER_BATCH_OUTPUT"
+
+// confineDirs returns the directories a run with -confine-writes on fs
+// may write in: its local -output, that of the batch it is part of, if
+// any, and -temp-dir. It returns nil without -confine-writes.
+func confineDirs(fs *flag.FlagSet) []string {
+	if f := fs.Lookup("confine-writes"); f == nil || f.Value.String() != "true" {
+		return nil
+	}
+	var dirs []string
+	if out := fs.Lookup("output").Value.String(); out != "" && !isRemoteOutput(out) {
+		dirs = append(dirs, out)
+	}
+	if batch := os.Getenv(batchOutputEnv); batch != "" {
+		dirs = append(dirs, batch)
+	}
+	if t := fs.Lookup("temp-dir").Value.String(); t != "" {
+		dirs = append(dirs, t)
+	}
+	return dirs
+}
+
+// setBatchOutput records outputDir as the batch's output for the runs of
+// its documents, unless the batch is itself part of one.
+func setBatchOutput(outputDir string) {
+	if outputDir == "" || isRemoteOutput(outputDir) || os.Getenv(batchOutputEnv) != "" {
+		return
+	}
+	if abs, err := filepath.Abs(outputDir); err == nil {
+		os.Setenv(batchOutputEnv, abs)
+	}
+}
@@ -0,0 +1,124 @@
+//go:build !noexec && !js && !wasip1
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/thnkr-one/pdfripper/pdfripper"
+)
+
+// emailRecord is the email.json an email's output starts with.
+type emailRecord struct {
+	Source      string            `json:"source"`
+	Subject     string            `json:"subject"`
+	From        string            `json:"from"`
+	Date        *time.Time        `json:"date,omitempty"`
+	Attachments []emailAttachment `json:"attachments"`
+}
+
+type emailAttachment struct {
+	Name   string `json:"name"`   // As the email gives it.
+	Output string `json:"output"` // Subdirectory of the output its text is in.
+}
+
+// runEmail implements -input with an email: it extracts every PDF
+// attached to it, as a batch run of its own, into a subdirectory of
+// outputDir named after the attachment, and writes email.json, listing
+// the email's subject, sender, date and attachments, and which
+// subdirectory each went to. Since email.json gives the email away, it
+// refuses -sanitize, whether the email is the -input or one of the
+// documents of a batch or archive.
+func runEmail(file, outputDir string, batch batchInputs, jobs int, args []string) {
+	if batch.sanitize {
+		log.Fatalf("Error: -sanitize cannot be used with email %s, whose email.json would record its sender and subject", file)
+	}
+	m, err := pdfripper.ReadEmail(file)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	if outputDir == "" {
+		base := filepath.Base(file)
+		outputDir = strings.TrimSuffix(base, filepath.Ext(base))
+	}
+	if batch.vectorDocument == "" {
+		batch.vectorDocument = filepath.Base(file)
+	}
+	tmp, err := os.MkdirTemp(tempDir, "pdfripper-email-")
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	defer os.RemoveAll(tmp)
+
+	rec := emailRecord{Source: file, Subject: m.Subject, From: m.From, Attachments: []emailAttachment{}}
+	if !m.Date.IsZero() {
+		rec.Date = &m.Date
+	}
+	used := map[string]bool{}
+	for i, a := range m.Attachments {
+		base := strings.TrimSuffix(a.Name, filepath.Ext(a.Name))
+		name := base
+		for n := 2; used[name] || name == ""; n++ {
+			name = fmt.Sprintf("%s_%d", base, n)
+		}
+		used[name] = true
+		p := filepath.Join(tmp, fmt.Sprint(i), a.Name)
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err == nil {
+			err = os.WriteFile(p, a.Data, 0644)
+		}
+		if err != nil {
+			log.Fatalf("Error saving attachment %s: %v", a.Name, err)
+		}
+		batch.files = append(batch.files, batchFile{path: p, name: name, document: name + filepath.Ext(a.Name)})
+		rec.Attachments = append(rec.Attachments, emailAttachment{Name: a.Name, Output: name})
+	}
+	if err := writeEmailRecord(rec, outputDir, tmp); err != nil {
+		log.Fatalf("Error writing email.json: %v", err)
+	}
+	if len(m.Attachments) == 0 {
+		fmt.Printf("No PDF attachments in %s\n", file)
+		return
+	}
+	fmt.Printf("Found %d PDF attachments in %s\n", len(m.Attachments), file)
+	err = runBatch(batch, outputDir, jobs, args)
+	os.RemoveAll(tmp)
+	batch.notify.done(file, redactURL(outputDir), err)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+}
+
+// writeEmailRecord writes email.json to outputDir, a directory or remote
+// URL, staging it in tmp for the latter.
+func writeEmailRecord(rec emailRecord, outputDir, tmp string) error {
+	data, err := json.MarshalIndent(rec, "", "  ")
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	if !isRemoteOutput(outputDir) {
+		if err := os.MkdirAll(outputDir, 0755); err != nil {
+			return err
+		}
+		return os.WriteFile(filepath.Join(outputDir, "email.json"), data, 0644)
+	}
+	local := filepath.Join(tmp, "email.json")
+	if err := os.WriteFile(local, data, 0644); err != nil {
+		return err
+	}
+	dest, err := openRemote(outputDir, tmp)
+	if err != nil {
+		return err
+	}
+	err = dest.put(local, "email.json")
+	if cerr := dest.close(); err == nil {
+		err = cerr
+	}
+	return err
+}
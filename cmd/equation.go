@@ -0,0 +1,14 @@
+//go:build !noexec && !js && !wasip1
+
+package main
+
+import (
+	"strings"
+
+	"github.com/thnkr-one/pdfripper/pdfripper"
+)
+
+// newEquationOCR returns the equation reader for -equation-cmd.
+func newEquationOCR(command string) (pdfripper.EquationOCR, error) {
+	return &pdfripper.EquationCommand{Args: strings.Fields(command)}, nil
+}
@@ -0,0 +1,14 @@
+//go:build noexec || js || wasip1
+
+package main
+
+import (
+	"errors"
+
+	"github.com/thnkr-one/pdfripper/pdfripper"
+)
+
+// newEquationOCR would start an equation OCR process, which this build leaves out.
+func newEquationOCR(command string) (pdfripper.EquationOCR, error) {
+	return nil, errors.New("equation OCR commands are not available in builds without subprocess support")
+}
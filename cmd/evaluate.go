@@ -0,0 +1,252 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/thnkr-one/pdfripper/pdfripper"
+)
+
+// evalReport is the outcome of "pdfripper evaluate", as written by
+// -report.
+type evalReport struct {
+	Backend     string    `json:"backend"`
+	Threshold   float64   `json:"threshold"`
+	Documents   []evalDoc `json:"documents"`
+	Regressions int       `json:"regressions"` // Pages, or whole documents that could not be compared, that regressed.
+}
+
+// evalDoc is how one document of the corpus compares with its golden
+// output.
+type evalDoc struct {
+	Name        string     `json:"name"` // Path in the corpus, without .pdf.
+	Pages       int        `json:"pages"`
+	Similarity  float64    `json:"similarity"` // Mean over the pages.
+	Error       string     `json:"error,omitempty"`
+	Regressions []evalPage `json:"regressions,omitempty"`
+}
+
+type evalPage struct {
+	Page       int      `json:"page"`
+	Similarity *float64 `json:"similarity,omitempty"` // Unset for pages that failed, were added or are missing.
+	Difference string   `json:"difference"`           // Where the text first parts from the golden text, or what is wrong with the page.
+}
+
+// runEvaluate implements "pdfripper evaluate": it extracts every PDF
+// under a corpus directory and compares each page's text with the golden
+// output in GOLDEN/NAME/page_N.txt, where NAME is the PDF's path in the
+// corpus without .pdf, as a normal run with -output GOLDEN/NAME writes
+// it. Pages less alike than -threshold, pages that fail and pages added or
+// missing are regressions, and it exits with status 2 if there are any,
+// for catching changes such as a new poppler version in CI. -update
+// writes the golden output instead.
+func runEvaluate(args []string) {
+	fs := flag.NewFlagSet("evaluate", flag.ExitOnError)
+	corpus := fs.String("corpus", "", "Directory of PDFs to extract, searched recursively (required)")
+	golden := fs.String("golden", "", "Directory of golden outputs, one subdirectory per PDF (required)")
+	backendName := fs.String("backend", pdfripper.DefaultBackend, "Text extraction backend ("+strings.Join(pdfripper.Backends(), ", ")+")")
+	threshold := fs.Float64("threshold", 0.98, "Similarity from 0 to 1 to the golden text below which a page has regressed")
+	procCount := fs.Int("processes", 0, "Number of concurrent workers per document (default: number of CPU cores)")
+	reportFile := fs.String("report", "", "Also write the report as JSON to this file")
+	update := fs.Bool("update", false, "Write the golden outputs from this extraction instead of comparing")
+	applySandbox := sandboxFlags(fs)
+	if !parseFlags(fs, args) {
+		return
+	}
+	if *corpus == "" || *golden == "" {
+		fs.Usage()
+		os.Exit(1)
+	}
+	backend, err := pdfripper.LookupBackend(*backendName)
+	if err == nil {
+		backend, err = applySandbox(backend)
+	}
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	if *procCount < 1 {
+		*procCount = runtime.NumCPU()
+	}
+	names, err := corpusDocs(*corpus)
+	if err != nil {
+		log.Fatalf("Error reading corpus: %v", err)
+	}
+	if len(names) == 0 {
+		log.Fatalf("Error: no PDFs found in %s", *corpus)
+	}
+
+	if *update {
+		for _, name := range names {
+			if err := updateGolden(filepath.Join(*corpus, name+".pdf"), filepath.Join(*golden, name), backend, *procCount); err != nil {
+				log.Fatalf("Error writing golden output of %s: %v", name, err)
+			}
+		}
+		fmt.Printf("Wrote golden outputs of %d documents to %s\n", len(names), *golden)
+		return
+	}
+
+	report := evalReport{Backend: backend.Name(), Threshold: *threshold}
+	for _, name := range names {
+		doc := evaluateDoc(filepath.Join(*corpus, name+".pdf"), filepath.Join(*golden, name), backend, *procCount, *threshold)
+		doc.Name = name
+		report.Documents = append(report.Documents, doc)
+		report.Regressions += len(doc.Regressions)
+		if doc.Error != "" {
+			report.Regressions++
+		}
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "DOCUMENT\tPAGES\tSIMILARITY\tREGRESSIONS")
+	for _, d := range report.Documents {
+		switch {
+		case d.Error != "":
+			fmt.Fprintf(tw, "%s\t%d\t-\tFAILED: %s\n", d.Name, d.Pages, d.Error)
+		case len(d.Regressions) > 0:
+			fmt.Fprintf(tw, "%s\t%d\t%.3f\t%d\n", d.Name, d.Pages, d.Similarity, len(d.Regressions))
+		default:
+			fmt.Fprintf(tw, "%s\t%d\t%.3f\t-\n", d.Name, d.Pages, d.Similarity)
+		}
+	}
+	tw.Flush()
+	for _, d := range report.Documents {
+		for _, p := range d.Regressions {
+			if p.Similarity != nil {
+				fmt.Printf("%s page %d: similarity %.3f, %s\n", d.Name, p.Page, *p.Similarity, p.Difference)
+			} else {
+				fmt.Printf("%s page %d: %s\n", d.Name, p.Page, p.Difference)
+			}
+		}
+	}
+	fmt.Printf("%d regressions in %d documents (threshold %.2f, backend %s)\n", report.Regressions, len(report.Documents), *threshold, report.Backend)
+
+	if *reportFile != "" {
+		data, err := json.MarshalIndent(report, "", "  ")
+		if err == nil {
+			err = os.WriteFile(*reportFile, append(data, '\n'), 0644)
+		}
+		if err != nil {
+			log.Fatalf("Error writing report: %v", err)
+		}
+	}
+	if report.Regressions > 0 {
+		os.Exit(2)
+	}
+}
+
+// corpusDocs returns the paths, without .pdf, of the PDFs under dir,
+// sorted.
+func corpusDocs(dir string) ([]string, error) {
+	var names []string
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || !strings.EqualFold(filepath.Ext(p), ".pdf") {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		names = append(names, strings.TrimSuffix(rel, filepath.Ext(rel)))
+		return nil
+	})
+	sort.Strings(names)
+	return names, err
+}
+
+// evalSink compares pages with their golden text as they are extracted.
+type evalSink struct {
+	dir       string
+	threshold float64
+	doc       *evalDoc
+	seen      map[int]bool
+	sum       float64
+}
+
+func (s *evalSink) WritePage(r *pdfripper.PageResult) error {
+	s.seen[r.Page] = true
+	want, err := os.ReadFile(filepath.Join(s.dir, fmt.Sprintf("page_%d.txt", r.Page)))
+	if errors.Is(err, fs.ErrNotExist) {
+		s.doc.Regressions = append(s.doc.Regressions, evalPage{Page: r.Page, Difference: "page added: no golden text"})
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	similarity := pdfripper.TextSimilarity(string(want), r.Text)
+	s.sum += similarity
+	if similarity < s.threshold {
+		s.doc.Regressions = append(s.doc.Regressions, evalPage{Page: r.Page, Similarity: &similarity, Difference: firstDifference(string(want), r.Text)})
+	}
+	return nil
+}
+
+func (s *evalSink) Close() error { return nil }
+
+// evaluateDoc extracts pdfFile and compares it with the golden output in
+// dir.
+func evaluateDoc(pdfFile, dir string, backend pdfripper.Backend, workers int, threshold float64) evalDoc {
+	var doc evalDoc
+	if _, err := os.Stat(dir); err != nil {
+		doc.Error = "no golden output (make it with -update)"
+		return doc
+	}
+	sink := &evalSink{dir: dir, threshold: threshold, doc: &doc, seen: map[int]bool{}}
+	e := &pdfripper.Extractor{PDFFile: pdfFile, ProcessCount: workers, PostProcessCount: workers, Backend: backend}
+	e.PageDone = func(r *pdfripper.PageResult) {
+		doc.Pages++
+		if r.Err != nil {
+			sink.seen[r.Page] = true
+			doc.Regressions = append(doc.Regressions, evalPage{Page: r.Page, Difference: "failed: " + r.Err.Error()})
+		}
+	}
+	if err := e.ExtractTo(sink); err != nil && doc.Pages == 0 {
+		doc.Error = err.Error()
+		return doc
+	}
+	if doc.Pages > 0 {
+		doc.Similarity = sink.sum / float64(doc.Pages)
+	}
+	// Golden pages the extraction no longer has.
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		doc.Error = err.Error()
+		return doc
+	}
+	for _, entry := range entries {
+		var page int
+		if _, err := fmt.Sscanf(entry.Name(), "page_%d.txt", &page); err == nil && !sink.seen[page] {
+			doc.Regressions = append(doc.Regressions, evalPage{Page: page, Difference: "page missing from the extraction"})
+		}
+	}
+	sort.Slice(doc.Regressions, func(i, j int) bool { return doc.Regressions[i].Page < doc.Regressions[j].Page })
+	return doc
+}
+
+// updateGolden replaces the golden output in dir with an extraction of
+// pdfFile.
+func updateGolden(pdfFile, dir string, backend pdfripper.Backend, workers int) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	old, err := filepath.Glob(filepath.Join(dir, "page_*.txt"))
+	if err != nil {
+		return err
+	}
+	for _, p := range old {
+		if err := os.Remove(p); err != nil {
+			return err
+		}
+	}
+	e := &pdfripper.Extractor{PDFFile: pdfFile, OutputDir: dir, ProcessCount: workers, PostProcessCount: workers, Backend: backend}
+	return e.ExtractPages()
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/thnkr-one/pdfripper/pdfripper"
+)
+
+// eventFormats are the values accepted by -events.
+var eventFormats = []string{"ndjson"}
+
+// eventLog writes the lifecycle events of a run, one JSON object per line,
+// for workflow engines that track progress:
+//
+//	{"event":"run_started","schema_version":1,"time":"...","input":"in.pdf","output_dir":"in","backend":"poppler"}
+//	{"event":"page_done","schema_version":1,"time":"...","page":1,"file":"in/page_1.txt","chars":1834,...}
+//	{"event":"page_failed","schema_version":1,"time":"...","page":2,"error":"..."}
+//	{"event":"heartbeat","schema_version":1,"time":"...","done":1,"total":3,"eta_ms":5604,"in_flight":[{"page":3,"stage":"ocr","elapsed_ms":1520,"slow":false}]}
+//	{"event":"run_finished","schema_version":1,"time":"...","ok":false,"pages":1,"failed":1,...,"error":"..."}
+//
+// The events are the pdfripper.RunStartedEvent and other published
+// structs, versioned as pdfripper.EventSchemaVersion says. page_done
+// carries the page's manifest entry. heartbeat comes every -heartbeat
+// interval while pages are in flight. A run answered from an earlier one
+// with the same -idempotency-key only reports run_finished, with
+// "reused": true.
+type eventLog struct {
+	mu      sync.Mutex // Heartbeats come from a goroutine of their own.
+	enc     *json.Encoder
+	backend string
+	start   time.Time
+	stats   pdfripper.RunStats
+}
+
+// newEventLog returns an eventLog writing format to w, or nil if format is
+// empty.
+func newEventLog(format string, w io.Writer) (*eventLog, error) {
+	switch format {
+	case "":
+		return nil, nil
+	case "ndjson":
+		return &eventLog{enc: json.NewEncoder(w)}, nil
+	}
+	return nil, fmt.Errorf("unknown -events format %q (available: %s)", format, strings.Join(eventFormats, ", "))
+}
+
+func (l *eventLog) emit(v any) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.enc.Encode(v)
+}
+
+// started reports the start of a run of e writing to outputDir, a
+// directory or remote URL.
+func (l *eventLog) started(e *pdfripper.Extractor, outputDir string) {
+	l.start = time.Now()
+	l.backend = e.Backend.Name()
+	l.emit(pdfripper.RunStartedEvent{
+		EventHeader: pdfripper.NewEventHeader(pdfripper.EventRunStarted),
+		Input:       e.PDFFile,
+		OutputDir:   outputDir,
+		Backend:     l.backend,
+	})
+}
+
+// page reports a finished page.
+func (l *eventLog) page(r *pdfripper.PageResult) {
+	if r.Err != nil {
+		l.stats.Failed++
+		l.emit(pdfripper.PageFailedEvent{
+			EventHeader: pdfripper.NewEventHeader(pdfripper.EventPageFailed),
+			Page:        r.Page,
+			Error:       r.Err.Error(),
+		})
+		return
+	}
+	if r.Dropped {
+		return
+	}
+	entry := pdfripper.NewManifestEntry(r, l.backend)
+	l.stats.Pages++
+	l.stats.Chars += entry.Chars
+	l.stats.Words += entry.Words
+	if r.OCRUsed {
+		l.stats.OCRPages++
+	}
+	l.emit(pdfripper.PageDoneEvent{EventHeader: pdfripper.NewEventHeader(pdfripper.EventPageDone), ManifestEntry: entry})
+}
+
+// heartbeat reports the pages in flight.
+func (l *eventLog) heartbeat(h pdfripper.Heartbeat) {
+	pages := []pdfripper.HeartbeatPage{}
+	for _, p := range h.InFlight {
+		pages = append(pages, pdfripper.HeartbeatPage{Page: p.Page, Stage: p.Stage, ElapsedMS: float64(p.Elapsed.Microseconds()) / 1000, Slow: p.Slow})
+	}
+	l.emit(pdfripper.HeartbeatEvent{
+		EventHeader: pdfripper.NewEventHeader(pdfripper.EventHeartbeat),
+		Done:        h.Done,
+		Total:       h.Total,
+		InFlight:    pages,
+		ETAMS:       float64(h.ETA.Microseconds()) / 1000,
+	})
+}
+
+// finished reports the end of the run, which failed if err is not nil.
+func (l *eventLog) finished(err error) {
+	l.stats.DurationMS = float64(time.Since(l.start).Microseconds()) / 1000
+	msg := ""
+	if err != nil {
+		msg = err.Error()
+	}
+	l.emit(pdfripper.RunFinishedEvent{
+		EventHeader: pdfripper.NewEventHeader(pdfripper.EventRunFinished),
+		OK:          err == nil,
+		RunStats:    &l.stats,
+		Error:       msg,
+	})
+}
+
+// reused reports a run answered from the output of an earlier one with the
+// same idempotency key.
+func (l *eventLog) reused(outputDir string) {
+	l.emit(pdfripper.RunFinishedEvent{
+		EventHeader: pdfripper.NewEventHeader(pdfripper.EventRunFinished),
+		OK:          true,
+		Reused:      true,
+		OutputDir:   outputDir,
+	})
+}
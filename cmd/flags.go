@@ -0,0 +1,278 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/thnkr-one/pdfripper/pdfripper"
+)
+
+// checkFlags reports flag values and combinations that cannot work,
+// naming the flags involved, so that they fail before any output is
+// written rather than part way through a run. Every problem is reported,
+// not just the first.
+func checkFlags(fs *flag.FlagSet) error {
+	set := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	value := func(name string) string { return fs.Lookup(name).Value.String() }
+	number := func(name string) float64 {
+		n, _ := strconv.ParseFloat(value(name), 64)
+		return n
+	}
+	var errs []error
+	bad := func(format string, args ...any) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+
+	for _, name := range []string{"processes", "min-processes", "max-processes", "gomaxprocs", "post-processes", "max-in-flight", "ocr-workers", "max-file-size", "max-pages", "revision", "max-depth", "page-retries", "shared-workers", "chunk-size", "chunk-overlap", "enrich-rate", "enrich-retries"} {
+		if number(name) < 0 {
+			bad("-%s %s is negative", name, value(name))
+		}
+	}
+	for _, name := range []string{"batch-size", "ocr-dpi", "input-jobs", "enrich-concurrency", "vector-batch", "summary-chars"} {
+		if number(name) < 1 {
+			bad("-%s %s must be at least 1", name, value(name))
+		}
+	}
+	if v := value("processes"); v == "auto" {
+		if lo, hi := number("min-processes"), number("max-processes"); hi > 0 && lo > hi {
+			bad("-min-processes %v is over -max-processes %v", lo, hi)
+		}
+	} else {
+		if _, err := strconv.Atoi(v); err != nil && v != "" {
+			bad("-processes %s is neither a number nor auto", v)
+		}
+		for _, name := range []string{"min-processes", "max-processes"} {
+			if set[name] {
+				bad("-%s requires -processes auto", name)
+			}
+		}
+	}
+	for _, name := range []string{"heartbeat", "slow-page"} {
+		if d, _ := time.ParseDuration(value(name)); d < 0 {
+			bad("-%s %s is negative", name, value(name))
+		}
+	}
+	for _, name := range []string{"ocr-threshold", "review-threshold", "agreement-threshold"} {
+		if n := number(name); n < 0 || n > 1 {
+			bad("-%s %s is outside 0 to 1", name, value(name))
+		}
+	}
+	if value("ocr") == "" {
+		for _, name := range []string{"ocr-lang", "ocr-threshold", "ocr-dpi", "ocr-url", "ocr-key", "ocr-layout", "review-threshold", "ocr-merge", "ocr-workers"} {
+			if set[name] {
+				bad("-%s requires -ocr", name)
+			}
+		}
+	}
+	if value("agreement") == "" {
+		for _, name := range []string{"agreement-pages", "agreement-threshold"} {
+			if set[name] {
+				bad("-%s requires -agreement", name)
+			}
+		}
+	} else if number("agreement-pages") < 1 {
+		bad("-agreement-pages %s must be at least 1", value("agreement-pages"))
+	}
+	if value("enrich-url") == "" {
+		for _, name := range []string{"enrich-token", "enrich-concurrency", "enrich-rate", "enrich-retries"} {
+			if set[name] {
+				bad("-%s requires -enrich-url", name)
+			}
+		}
+	} else if err := validateCallbackURL(value("enrich-url")); err != nil {
+		bad("-enrich-url must be an absolute http or https URL")
+	}
+	if value("summary-url") == "" {
+		for _, name := range []string{"summary-model", "summary-token", "summary-prompt", "summary-chars"} {
+			if set[name] {
+				bad("-%s requires -summary-url", name)
+			}
+		}
+	} else if err := validateCallbackURL(value("summary-url")); err != nil {
+		bad("-summary-url must be an absolute http or https URL")
+	}
+	if value("vector-store") == "" {
+		for _, name := range []string{"embed-url", "embed-model", "embed-token", "vector-store-key", "vector-batch", "vector-document"} {
+			if set[name] {
+				bad("-%s requires -vector-store", name)
+			}
+		}
+	} else {
+		if _, err := openVectorStore(value("vector-store"), ""); err != nil {
+			bad("-vector-store: %v", err)
+		}
+		if validateCallbackURL(value("embed-url")) != nil {
+			bad("-vector-store requires -embed-url, an absolute http or https URL")
+		}
+		if number("chunk-size") == 0 {
+			bad("-vector-store requires -chunk-size")
+		}
+	}
+	if value("sanitize") == "true" {
+		if _, err := pdfripper.NewSanitizer(strings.Split(value("sanitize-entities"), ",")...); err != nil {
+			bad("-sanitize-entities: %v", err)
+		}
+		for _, name := range []string{"metadata", "metadata-map", "equations", "equation-cmd", "figures", "ocr-layout", "review-threshold", "diagnostics", "invoices", "toc"} {
+			if set[name] && !slices.Contains([]string{"", "false", "0"}, value(name)) {
+				bad("-sanitize cannot be used with -%s, which saves what it cannot sanitize", name)
+			}
+		}
+		if value("quarantine") != "" {
+			bad("-sanitize cannot be used with -quarantine, which puts failed documents and their paths in the output")
+		}
+	} else {
+		for _, name := range []string{"sanitize-entities", "sanitize-key"} {
+			if set[name] {
+				bad("-%s requires -sanitize", name)
+			}
+		}
+	}
+	if set["normalize"] && value("invoices") != "true" {
+		bad("-normalize requires -invoices")
+	}
+	if (value("metadata") == "true" || set["metadata-map"]) && !slices.Contains(strings.Split(value("manifest-format"), ","), "json") {
+		bad("-metadata and -metadata-map require -manifest-format json")
+	}
+
+	for _, format := range strings.FieldsFunc(value("manifest-format"), func(r rune) bool { return r == ',' }) {
+		if !slices.Contains(pdfripper.ManifestFormats, format) {
+			bad("-manifest-format %s is not one of %s", format, strings.Join(pdfripper.ManifestFormats, ", "))
+		}
+	}
+	switch v := value("filter-orientation"); v {
+	case "", pdfripper.Portrait, pdfripper.Landscape, pdfripper.Square:
+	default:
+		bad("-filter-orientation %s is not one of %s, %s, %s", v, pdfripper.Portrait, pdfripper.Landscape, pdfripper.Square)
+	}
+	switch v := value("line-numbers"); v {
+	case "", pdfripper.LineNumbersStrip, pdfripper.LineNumbersMap:
+	default:
+		bad("-line-numbers %s is not one of %s, %s", v, pdfripper.LineNumbersStrip, pdfripper.LineNumbersMap)
+	}
+	for _, name := range strings.FieldsFunc(value("split"), func(r rune) bool { return r == ',' }) {
+		if _, ok := pdfripper.Splitters[name]; !ok {
+			bad("-split rule %s is unknown", name)
+		}
+	}
+	if v := value("segment"); v != "" && !slices.Contains(pdfripper.Segmentations, v) {
+		bad("-segment %s is not one of %s", v, strings.Join(pdfripper.Segmentations, ", "))
+	}
+	if v := value("tokenizer"); v != "" && v != pdfripper.TokenizerHeuristic && !strings.HasPrefix(v, "bpe:") {
+		bad("-tokenizer %s is not %s or bpe:PATH", v, pdfripper.TokenizerHeuristic)
+	}
+	if v := value("split-by"); v != "" {
+		if _, err := pdfripper.ParseSectionMarker(v); err != nil {
+			bad("-split-by: %v", err)
+		}
+	}
+	switch v := value("order"); {
+	case !slices.Contains(pdfripper.PageOrders, v):
+		bad("-order %s is not one of %s", v, strings.Join(pdfripper.PageOrders, ", "))
+	case v == pdfripper.OrderCustom && value("priority-pages") == "":
+		bad("-order %s requires -priority-pages", v)
+	case v != pdfripper.OrderCustom && set["priority-pages"]:
+		bad("-priority-pages requires -order %s", pdfripper.OrderCustom)
+	case v != pdfripper.OrderFirstLast && (value("combined") != "" || value("split") != "" || value("split-by") != "" || number("chunk-size") > 0 || value("segment") != "" || value("summary-url") != ""):
+		bad("-order %s cannot be used with -combined, -split, -split-by, -chunk-size, -segment or -summary-url, which need the pages in page order", v)
+	}
+	if v := value("priority-pages"); v != "" {
+		if _, err := pdfripper.ParsePageSpec(v, 1); err != nil {
+			bad("-priority-pages %s: %v", v, err)
+		}
+	}
+	if _, _, err := parseSample(value("sample")); err != nil {
+		errs = append(errs, err)
+	}
+	if v := value("reorder"); v != "" {
+		if _, err := pdfripper.ParsePageList(v); err != nil {
+			bad("-reorder %s: %v", v, err)
+		}
+	}
+
+	if number("chunk-overlap") > 0 && number("chunk-overlap") >= number("chunk-size") {
+		bad("-chunk-overlap must be less than -chunk-size")
+	}
+	if value("toc-in-combined") == "true" && (value("toc") != "true" || value("combined") == "") {
+		bad("-toc-in-combined requires -toc and -combined")
+	}
+	if value("page-files") == "false" {
+		if value("bates-filenames") == "true" {
+			bad("-bates-filenames names page files, which -page-files=false turns off")
+		}
+		if value("label-filenames") == "true" {
+			bad("-label-filenames names page files, which -page-files=false turns off")
+		}
+		if value("combined") == "" && value("split") == "" && value("split-by") == "" && number("chunk-size") == 0 && value("segment") == "" && value("summary-url") == "" {
+			bad("-page-files=false leaves no output; set -combined, -split, -split-by, -chunk-size, -segment or -summary-url too")
+		}
+	}
+	inputs := 0
+	for _, name := range []string{"input", "input-list", "input-dir"} {
+		if value(name) != "" {
+			inputs++
+		}
+	}
+	if inputs > 1 {
+		bad("only one of -input, -input-list and -input-dir can be set")
+	}
+	if value("input-list") != "" || value("input-dir") != "" || isBatchInput(value("input")) {
+		for _, name := range []string{"combined", "revision"} {
+			if set[name] {
+				bad("-%s applies to a single document and cannot be used with -input-list, -input-dir or an email or archive -input", name)
+			}
+		}
+	}
+	if set["shared-workers"] && value("input-list") == "" && value("input-dir") == "" && !isBatchInput(value("input")) {
+		bad("-shared-workers requires -input-list, -input-dir or an email or archive -input")
+	}
+	switch v := value("quarantine"); {
+	case v != "" && !slices.Contains(quarantineModes, v):
+		bad("-quarantine %s is not one of %s", v, strings.Join(quarantineModes, ", "))
+	case v != "" && value("input-list") == "" && value("input-dir") == "" && !isArchive(value("input")):
+		bad("-quarantine requires -input-list, -input-dir or an archive -input")
+	case v != "" && isRemoteOutput(value("output")):
+		bad("-quarantine requires a local -output directory, not a URL")
+	}
+	if value("idempotency-key") != "" && isRemoteOutput(value("output")) {
+		bad("-idempotency-key requires a local -output directory, not a URL")
+	}
+	if value("confine-writes") == "true" {
+		if value("output") == "" || value("temp-dir") == "" {
+			bad("-confine-writes requires -output and -temp-dir, the only directories it writes in")
+		}
+		for _, name := range []string{"cache", "combined"} {
+			if v := value(name); v != "" {
+				if err := pdfripper.Confined(v, confineDirs(fs)...); err != nil {
+					bad("-%s with -confine-writes: %v", name, err)
+				}
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// parseSample parses -sample: a page count, or a percentage such as 5%,
+// returned as a fraction. An empty value samples nothing.
+func parseSample(v string) (size int, fraction float64, err error) {
+	switch {
+	case v == "":
+		return 0, 0, nil
+	case strings.HasSuffix(v, "%"):
+		p, err := strconv.ParseFloat(strings.TrimSuffix(v, "%"), 64)
+		if err != nil || p <= 0 || p > 100 {
+			return 0, 0, fmt.Errorf("-sample %s must be a percentage above 0 and at most 100%%", v)
+		}
+		return 0, p / 100, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 1 {
+		return 0, 0, fmt.Errorf("-sample %s must be a page count of at least 1 or a percentage such as 5%%", v)
+	}
+	return n, 0, nil
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+
+	"github.com/thnkr-one/pdfripper/pdfripper"
+)
+
+// runFonts implements "pdfripper fonts": it lists the fonts of every page
+// and warns about fonts whose text cannot be extracted. It exits with
+// status 2 if there are any, so scripts can route such documents to OCR.
+func runFonts(args []string) {
+	fs := flag.NewFlagSet("fonts", flag.ExitOnError)
+	inputFile := fs.String("input", "", "Input PDF file path (required)")
+	passwordFlag(fs)
+	if !parseFlags(fs, args) {
+		return
+	}
+	if *inputFile == "" {
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	pages, err := pdfripper.Fonts(*inputFile)
+	if err != nil {
+		log.Fatalf("Error reading fonts: %v", err)
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "PAGE\tFONT\tTYPE\tENCODING\tEMBEDDED\tTOUNICODE\tEXTRACTABLE")
+	var unextractable []string
+	for _, p := range pages {
+		for _, f := range p.Fonts {
+			fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\t%s\t%s\n", p.Page, f.Name, f.Subtype, f.Encoding,
+				yesNo(f.Embedded), yesNo(f.ToUnicode), yesNo(f.Extractable))
+			if !f.Extractable {
+				unextractable = append(unextractable, fmt.Sprintf("page %d: font %s has no Unicode mapping", p.Page, f.Name))
+			}
+		}
+	}
+	tw.Flush()
+
+	for _, msg := range unextractable {
+		log.Printf("Warning: %s; its text cannot be extracted and needs OCR", msg)
+	}
+	if len(unextractable) > 0 {
+		os.Exit(2)
+	}
+}
+
+func yesNo(b bool) string {
+	if b {
+		return "yes"
+	}
+	return "no"
+}
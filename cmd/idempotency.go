@@ -0,0 +1,98 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+)
+
+// completionFile is written to a namespaced output directory once its run
+// has succeeded.
+const completionFile = "idempotency.json"
+
+var idempotencyKeyRe = regexp.MustCompile(`^[A-Za-z0-9_.-]{1,128}$`)
+
+// completion records a finished run, so that a job delivered again with
+// the same idempotency key can be answered from its output.
+type completion struct {
+	Key         string    `json:"key"`
+	Input       string    `json:"input"`
+	InputSHA256 string    `json:"input_sha256"`
+	OutputDir   string    `json:"output_dir"`
+	Completed   time.Time `json:"completed"`
+}
+
+// idempotentRun is a run namespaced under an idempotency key: its output
+// goes to a directory named after the key.
+type idempotentRun struct {
+	key, input, inputHash string
+	dir                   string
+	done                  completion // Set by completed and complete.
+}
+
+// newIdempotentRun checks key and returns the run of inputFile namespaced
+// under it in outputDir.
+func newIdempotentRun(key, inputFile, outputDir string) (*idempotentRun, error) {
+	if !idempotencyKeyRe.MatchString(key) || key == "." || key == ".." {
+		return nil, fmt.Errorf("idempotency key %q must be 1 to 128 letters, digits, '.', '_' or '-'", key)
+	}
+	hash, err := hashInput(inputFile)
+	if err != nil {
+		return nil, err
+	}
+	return &idempotentRun{key: key, input: inputFile, inputHash: hash, dir: filepath.Join(outputDir, key)}, nil
+}
+
+// completed reports whether a run under the key has finished already. It
+// is an error for the key to have been used with a different input.
+func (r *idempotentRun) completed() (bool, error) {
+	data, err := os.ReadFile(filepath.Join(r.dir, completionFile))
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if err := json.Unmarshal(data, &r.done); err != nil {
+		return false, fmt.Errorf("reading %s: %w", completionFile, err)
+	}
+	if r.done.InputSHA256 != r.inputHash {
+		return false, fmt.Errorf("idempotency key %q was used for a different input (%s)", r.key, r.done.Input)
+	}
+	return true, nil
+}
+
+// complete records that the run has succeeded.
+func (r *idempotentRun) complete() error {
+	r.done = completion{Key: r.key, Input: r.input, InputSHA256: r.inputHash, OutputDir: r.dir, Completed: time.Now().UTC()}
+	data, err := json.MarshalIndent(r.done, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := filepath.Join(r.dir, completionFile+".tmp")
+	if err := os.WriteFile(tmp, append(data, '\n'), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(r.dir, completionFile))
+}
+
+func hashInput(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+
+	"github.com/thnkr-one/pdfripper/pdfripper"
+)
+
+// runInfo implements "pdfripper info": it reports the PDF version and how
+// the file is built, for finding out why a document extracts slowly or
+// fails.
+func runInfo(args []string) {
+	fs := flag.NewFlagSet("info", flag.ExitOnError)
+	inputFile := fs.String("input", "", "Input PDF file path (required)")
+	passwordFlag(fs)
+	asJSON := fs.Bool("json", false, "Print the report as JSON")
+	if !parseFlags(fs, args) {
+		return
+	}
+	if *inputFile == "" {
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	r, err := pdfripper.Inspect(*inputFile)
+	if err != nil {
+		log.Fatalf("Error inspecting %s: %v", *inputFile, err)
+	}
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(r)
+		return
+	}
+
+	encryption := "no"
+	if r.Encrypted {
+		encryption = r.Encryption
+		if r.NeedsPassword {
+			encryption += ", needs a password"
+		}
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	for _, row := range [][2]any{
+		{"Version", r.Version},
+		{"Size", fmt.Sprintf("%d bytes", r.Size)},
+		{"Pages", r.Pages},
+		{"Linearized", yesNo(r.Linearized)},
+		{"Encrypted", encryption},
+		{"Objects", r.Objects},
+		{"Streams", r.Streams},
+		{"Object streams", fmt.Sprintf("%d, holding %d objects", r.ObjectStreams, r.CompressedObjects)},
+		{"Xref streams", yesNo(r.XrefStreams)},
+		{"Incremental updates", r.IncrementalUpdates},
+		{"Repaired", yesNo(r.Repaired)},
+	} {
+		fmt.Fprintf(tw, "%s:\t%v\n", row[0], row[1])
+	}
+	tw.Flush()
+	if r.HeaderVersion != r.Version {
+		fmt.Printf("The header says version %q; the catalog raises it.\n", r.HeaderVersion)
+	}
+}
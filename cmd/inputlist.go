@@ -0,0 +1,462 @@
+//go:build !noexec && !js && !wasip1
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/thnkr-one/pdfripper/pdfripper"
+)
+
+// inputTimeout bounds the download of each http or https input.
+const inputTimeout = 10 * time.Minute
+
+// listedInput is one document of an -input-list or -input-dir run.
+type listedInput struct {
+	source string // Path or http(s) URL, as listed.
+	name   string // Slash-separated name of its output.
+	output string // The -output of its run.
+	// The -vector-document of its run: a name that tells it apart from the
+	// other documents in the vector store, as its output name may not.
+	document string
+}
+
+// runBatch implements -input-list and -input-dir. With -input-list it
+// reads paths and http(s) URLs, one per line, from the list file, or from
+// stdin if it is "-", as they come, so a list piped from find starts right
+// away, and extracts each into a subdirectory of outputDir named after
+// it. With -input-dir it extracts the PDFs under the directory into
+// outputDir/PATH, where PATH is a file's path in the directory without the
+// extension, as evaluate lays out golden outputs. Either way, jobs
+// documents are extracted at a time, each by a run of pdfripper of its own
+// with args less the flags of the batch, so that one bad document fails
+// only itself. With batch.linkDuplicates, a local file listed again, by
+// a link or as a copy, is extracted once, and the outputs of the others
+// are symbolic links to its output. With batch.quarantine, documents that
+// fail are also copied or moved to quarantineDir in outputDir. With
+// batch.cache, URLs are kept in its urlCacheDir, and downloaded and
+// extracted again only when changed, as urlCache describes. With
+// batch.sharedWorkers, the runs take turns at that many workers, each
+// run using up to all of them, instead of having workers of their own.
+// With batch.password, the runs are given it as $PDFRIPPER_PASSWORD. It
+// returns an error if any document failed.
+func runBatch(batch batchInputs, outputDir string, jobs int, args []string) error {
+	self, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("locating pdfripper binary: %w", err)
+	}
+	setBatchOutput(outputDir)
+	args = stripFlags(args, "input", "input-list", "input-dir", "input-jobs", "include", "exclude", "max-depth", "link-duplicates", "quarantine", "shared-workers", "output", "notify", "vector-document", "password")
+	if batch.password != "" {
+		// Other users can see the command lines of the runs, but not
+		// their environment.
+		if err := os.Setenv(envName("password"), batch.password); err != nil {
+			return err
+		}
+	}
+	var pool *pdfripper.FairPool
+	if batch.sharedWorkers > 0 {
+		pool = pdfripper.NewFairPool(batch.sharedWorkers)
+		// A -processes of the command line, after these, takes precedence.
+		args = append([]string{"-processes", strconv.Itoa(batch.sharedWorkers)}, args...)
+	}
+
+	var urls *urlCache
+	if batch.cache != "" {
+		urls = &urlCache{dir: batch.cache}
+	}
+
+	var q *quarantine
+	if batch.quarantine != "" {
+		q = &quarantine{dir: filepath.Join(outputDir, quarantineDir), move: batch.quarantine == "move"}
+	}
+	fail := func(in listedInput, local string, err error) {
+		log.Printf("Error: %s: %v", in.source, err)
+		if q != nil {
+			if err := q.keep(in, local, err); err != nil {
+				log.Printf("Error quarantining %s: %v", in.source, err)
+			}
+		}
+	}
+
+	inputs := make(chan listedInput)
+	var (
+		mu     sync.Mutex
+		failed = map[string]bool{}
+		wg     sync.WaitGroup
+	)
+	for i := 0; i < max(jobs, 1); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for in := range inputs {
+				unchanged, err := runListedInput(self, in, args, pool, urls, fail)
+				switch {
+				case err != nil:
+					mu.Lock()
+					failed[in.source] = true
+					mu.Unlock()
+				case unchanged:
+					fmt.Printf("Unchanged since last extracted: %s in %s\n", in.source, redactURL(in.output))
+				default:
+					fmt.Printf("Extracted %s to %s\n", in.source, redactURL(in.output))
+				}
+			}
+		}()
+	}
+
+	n := 0
+	names := map[string]int{}
+	index := inputIndex{}
+	var duplicates [][2]listedInput // The duplicate and the input it duplicates.
+	send := func(source, name, document string) {
+		n++
+		if batch.sanitize {
+			name = sanitizedName()
+		}
+		name = listedName(name, names)
+		if batch.vectorDocument != "" {
+			document = batch.vectorDocument + "/" + document
+		}
+		if !batch.vectors {
+			document = ""
+		}
+		in := listedInput{source: source, name: name, output: listedOutput(outputDir, name), document: document}
+		if batch.linkDuplicates && !isRemoteOutput(outputDir) && !isInputURL(source) {
+			if first, ok := index.add(in); ok {
+				duplicates = append(duplicates, [2]listedInput{in, first})
+				return
+			}
+		}
+		inputs <- in
+	}
+	switch {
+	case batch.dir != "":
+		err = walkInputDir(batch, send)
+	case batch.list != "":
+		err = readInputList(batch, send)
+	default:
+		for _, f := range batch.files {
+			send(f.path, f.name, f.document)
+		}
+	}
+	close(inputs)
+	wg.Wait()
+	for _, d := range duplicates {
+		in, first := d[0], d[1]
+		if failed[first.source] {
+			fail(in, in.source, fmt.Errorf("same file as %s, which failed", first.source))
+			failed[in.source] = true
+			continue
+		}
+		if err := linkOutput(in.output, first.output); err != nil {
+			fail(in, "", err)
+			failed[in.source] = true
+			continue
+		}
+		fmt.Printf("Linked %s to %s: %s is the same file as %s\n", in.output, first.output, in.source, first.source)
+	}
+	if err != nil {
+		return err
+	}
+	if len(failed) > 0 {
+		sources := make([]string, 0, len(failed))
+		for source := range failed {
+			sources = append(sources, source)
+		}
+		sort.Strings(sources)
+		return fmt.Errorf("%d of %d documents failed: %s", len(failed), n, strings.Join(sources, ", "))
+	}
+	fmt.Printf("Extraction complete: %d documents.\n", n)
+	return nil
+}
+
+// inputIndex finds listed files that are the same as one listed before:
+// the same file, reached by a symbolic or hard link, or a copy of it.
+// Files are only hashed once another of the same size is listed.
+type inputIndex map[int64][]*indexedInput
+
+type indexedInput struct {
+	listedInput
+	info os.FileInfo
+	hash string // SHA-256, once it is needed.
+}
+
+// add returns the input listed before that in is the same as, if there
+// is one, and otherwise remembers in. Files that cannot be read are left
+// to the run of their own to report.
+func (x inputIndex) add(in listedInput) (listedInput, bool) {
+	info, err := os.Stat(in.source)
+	if err != nil || !info.Mode().IsRegular() {
+		return listedInput{}, false
+	}
+	entry := &indexedInput{listedInput: in, info: info}
+	for _, other := range x[info.Size()] {
+		if os.SameFile(info, other.info) {
+			return other.listedInput, true
+		}
+	}
+	for _, other := range x[info.Size()] {
+		if other.hash == "" {
+			other.hash, _ = hashInput(other.source)
+		}
+		if entry.hash == "" {
+			if entry.hash, err = hashInput(in.source); err != nil {
+				break
+			}
+		}
+		if other.hash != "" && other.hash == entry.hash {
+			return other.listedInput, true
+		}
+	}
+	x[info.Size()] = append(x[info.Size()], entry)
+	return listedInput{}, false
+}
+
+// linkOutput makes the output directory of a duplicate a symbolic link to
+// target, the output of the input it duplicates, replacing a link left
+// by an earlier run.
+func linkOutput(output, target string) error {
+	if info, err := os.Lstat(output); err == nil {
+		if info.Mode()&os.ModeSymlink == 0 {
+			return fmt.Errorf("cannot link the output to %s: %s exists", target, output)
+		}
+		if err := os.Remove(output); err != nil {
+			return err
+		}
+	}
+	rel, err := filepath.Rel(filepath.Dir(output), target)
+	if err != nil {
+		rel, err = filepath.Abs(target)
+		if err != nil {
+			return err
+		}
+	}
+	if err := os.MkdirAll(filepath.Dir(output), 0755); err != nil {
+		return err
+	}
+	return os.Symlink(rel, output)
+}
+
+// readInputList calls send with each input of the list that the filters
+// take, matching them against the input as listed, and the name of its
+// output.
+func readInputList(in batchInputs, send func(source, name, document string)) error {
+	r := os.Stdin
+	if in.list != "-" {
+		f, err := os.Open(in.list)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		source := strings.TrimSpace(sc.Text())
+		if source == "" || (len(in.include) > 0 && !in.include.match(source)) || in.exclude.match(source) {
+			continue
+		}
+		send(source, inputName(source), source)
+	}
+	if err := sc.Err(); err != nil {
+		return fmt.Errorf("reading -input-list: %w", err)
+	}
+	return nil
+}
+
+// walkInputDir calls send with each file under the input directory that
+// the filters take, matching them against its slash-separated path in the
+// directory, and the name of its output. Directories an -exclude pattern
+// matches are not searched.
+func walkInputDir(in batchInputs, send func(source, name, document string)) error {
+	return filepath.WalkDir(in.dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(in.dir, p)
+		if err != nil || rel == "." {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		depth := strings.Count(rel, "/") + 1
+		if d.IsDir() {
+			if in.exclude.match(rel) || (in.maxDepth > 0 && depth >= in.maxDepth) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.Type()&fs.ModeSymlink != 0 {
+			// Links to files are taken; links to directories are not
+			// followed.
+			if info, err := os.Stat(p); err != nil || !info.Mode().IsRegular() {
+				return nil
+			}
+		} else if !d.Type().IsRegular() {
+			return nil
+		}
+		if (in.maxDepth > 0 && depth > in.maxDepth) || !in.takes(rel) {
+			return nil
+		}
+		send(p, docName(rel), rel)
+		return nil
+	})
+}
+
+// runListedInput extracts one listed document, downloading it first if it
+// is a URL, as a user of pool if that is not nil. With urls, a URL is
+// downloaded into it, and skipped, with unchanged true, if its copy there
+// is current and was extracted to the same output with the same args
+// before. If that fails, it calls fail with the document's file, if there
+// is one yet, before returning the error.
+func runListedInput(self string, in listedInput, args []string, pool *pdfripper.FairPool, urls *urlCache, fail func(in listedInput, local string, err error)) (unchanged bool, err error) {
+	input := in.source
+	defer func() {
+		if err != nil {
+			fail(in, input, err)
+		}
+	}()
+	var entry urlEntry
+	switch {
+	case isInputURL(input) && urls != nil:
+		var current bool
+		if entry, input, current, err = urls.fetch(in.source); err != nil {
+			input = ""
+			return false, err
+		}
+		if current && entry.current(in.output, args) {
+			return true, nil
+		}
+	case isInputURL(input):
+		dir, err := os.MkdirTemp(tempDir, "pdfripper-input-")
+		if err != nil {
+			input = ""
+			return false, err
+		}
+		defer os.RemoveAll(dir)
+		if input, err = fetchInput(in.source, dir); err != nil {
+			input = ""
+			return false, err
+		}
+	}
+	var stderr tailWriter
+	runArgs := []string{"-input-list=", "-input-dir=", "-input", input, "-output", in.output}
+	if in.document != "" {
+		runArgs = append(runArgs, "-vector-document", in.document)
+	}
+	cmd := exec.Command(self, append(runArgs, args...)...)
+	cmd.Stdout, cmd.Stderr = os.Stdout, io.MultiWriter(os.Stderr, &stderr)
+	run := cmd.Run
+	if pool != nil {
+		run = func() error {
+			wait, err := sharePool(cmd, pool.Document())
+			if err != nil {
+				return err
+			}
+			return wait()
+		}
+	}
+	audit := pdfripper.StartAudit(cmd.Path, cmd.Args)
+	cmd.Stderr = audit.Stderr(cmd.Stderr)
+	err = run()
+	if aerr := audit.Finish(err); aerr != nil && err == nil {
+		return false, fmt.Errorf("recording %s in the audit log: %w", input, aerr)
+	}
+	if err != nil {
+		return false, stderr.err(err)
+	}
+	if entry.URL != "" {
+		if err := urls.extracted(entry, in.output, args); err != nil {
+			log.Printf("Warning: caching %s: %v", in.source, err)
+		}
+	}
+	return false, nil
+}
+
+// isInputURL reports whether a listed input is an http or https URL.
+func isInputURL(s string) bool {
+	return strings.HasPrefix(s, "http://") || strings.HasPrefix(s, "https://")
+}
+
+// fetchInput downloads an input URL into dir and returns the file's path.
+func fetchInput(rawURL, dir string) (string, error) {
+	p := filepath.Join(dir, inputName(rawURL)+".pdf")
+	_, _, err := download(rawURL, p, nil)
+	return p, err
+}
+
+// inputName names the output of a listed input: its file name without the
+// extension, as a single input's default output is named.
+func inputName(source string) string {
+	base := filepath.Base(source)
+	if isInputURL(source) {
+		base = "document"
+		if u, err := url.Parse(source); err == nil && path.Base(u.Path) != "/" && path.Base(u.Path) != "." {
+			base = path.Base(u.Path)
+		}
+	}
+	if name := docName(base); name != "" {
+		return name
+	}
+	return base
+}
+
+// listedName returns the name of the output of an input named name,
+// which gets a suffix, as in report_2, if an input listed before had the
+// same name, as counted in seen.
+func listedName(name string, seen map[string]int) string {
+	seen[name]++
+	if n := seen[name]; n > 1 {
+		return fmt.Sprintf("%s_%d", name, n)
+	}
+	return name
+}
+
+// listedOutput returns the -output of the input named name, a
+// slash-separated path: a subdirectory of outputDir, or of the current
+// directory if it is empty, or a path under it if it is a URL.
+func listedOutput(outputDir, name string) string {
+	if isRemoteOutput(outputDir) {
+		if u, err := url.Parse(outputDir); err == nil {
+			u.Path = path.Join(u.Path, name)
+			return u.String()
+		}
+	}
+	return filepath.Join(outputDir, filepath.FromSlash(name))
+}
+
+// stripFlags returns args without the named flags and their values, in
+// any of the forms the flag package accepts.
+func stripFlags(args []string, names ...string) []string {
+	var kept []string
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			return append(kept, args[i:]...)
+		}
+		name, _, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		if strings.HasPrefix(arg, "-") && slices.Contains(names, name) {
+			if !hasValue {
+				i++
+			}
+			continue
+		}
+		kept = append(kept, arg)
+	}
+	return kept
+}
@@ -0,0 +1,32 @@
+//go:build noexec || js || wasip1
+
+package main
+
+import (
+	"errors"
+	"log"
+
+	"github.com/thnkr-one/pdfripper/pdfripper"
+)
+
+// runBatch needs to start child processes, which this build leaves out.
+func runBatch(batch batchInputs, outputDir string, jobs int, args []string) error {
+	return errors.New("-input-list and -input-dir are not available in builds without subprocess support")
+}
+
+// runEmail extracts attachments as a batch, which this build leaves out.
+func runEmail(file, outputDir string, batch batchInputs, jobs int, args []string) {
+	log.Fatal("Error: email inputs are not available in builds without subprocess support")
+}
+
+// runArchive extracts the documents in an archive as a batch, which this
+// build leaves out.
+func runArchive(file, outputDir string, batch batchInputs, jobs int, args []string) {
+	log.Fatal("Error: archive inputs are not available in builds without subprocess support")
+}
+
+// sharedPool returns nil: without child processes there are no batches
+// to share workers across.
+func sharedPool() pdfripper.WorkPool {
+	return nil
+}
@@ -0,0 +1,578 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/thnkr-one/pdfripper/pdfripper"
+)
+
+type jobStatus string
+
+const (
+	jobQueued    jobStatus = "queued"
+	jobRunning   jobStatus = "running"
+	jobCompleted jobStatus = "completed"
+	jobFailed    jobStatus = "failed"
+	jobCanceled  jobStatus = "canceled"
+)
+
+// job is an asynchronous extraction. Its exported fields are what the API
+// returns and what is persisted in the job's job.json.
+type job struct {
+	ID          string        `json:"id"`
+	Tenant      string        `json:"tenant"`
+	Status      jobStatus     `json:"status"`
+	CallbackURL string        `json:"callback_url,omitempty"`
+	Priority    string        `json:"priority,omitempty"` // One of priorities; empty is normal.
+	CreatedAt   time.Time     `json:"created_at"`
+	StartedAt   *time.Time    `json:"started_at,omitempty"`
+	FinishedAt  *time.Time    `json:"finished_at,omitempty"`
+	PageCount   int           `json:"page_count"`
+	PagesDone   int           `json:"pages_done"`
+	Failures    int           `json:"failures"` // pages that could not be extracted
+	Error       string        `json:"error,omitempty"`
+	Output      string        `json:"output,omitempty"`    // path of the JSON result on the server
+	Artifacts   *jobArtifacts `json:"artifacts,omitempty"` // with -results, where to fetch the result's files from
+
+	cancel context.CancelFunc
+}
+
+func (j *job) finished() bool {
+	return j.Status == jobCompleted || j.Status == jobFailed || j.Status == jobCanceled
+}
+
+// jobStore keeps jobs on disk so they survive restarts. Each job has its own
+// directory holding job.json, the uploaded input.pdf until the job finishes,
+// and result.json once it completes.
+type jobStore struct {
+	dir  string
+	mu   sync.Mutex
+	jobs map[string]*job
+}
+
+func openJobStore(dir string) (*jobStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	st := &jobStore{dir: dir, jobs: make(map[string]*job)}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name(), "job.json"))
+		if errors.Is(err, os.ErrNotExist) {
+			// An upload that never completed.
+			os.RemoveAll(filepath.Join(dir, entry.Name()))
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		j := &job{}
+		if err := json.Unmarshal(data, j); err != nil {
+			return nil, fmt.Errorf("reading job %s: %w", entry.Name(), err)
+		}
+		st.jobs[j.ID] = j
+	}
+	return st, nil
+}
+
+func (st *jobStore) jobDir(id string) string     { return filepath.Join(st.dir, id) }
+func (st *jobStore) inputPath(id string) string  { return filepath.Join(st.dir, id, "input.pdf") }
+func (st *jobStore) resultPath(id string) string { return filepath.Join(st.dir, id, "result.json") }
+
+// add registers a job whose input has been saved to inputPath(j.ID).
+func (st *jobStore) add(j *job) error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if err := st.save(j); err != nil {
+		return err
+	}
+	st.jobs[j.ID] = j
+	return nil
+}
+
+// update applies fn to the job and persists the result.
+func (st *jobStore) update(j *job, fn func(j *job)) error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	fn(j)
+	return st.save(j)
+}
+
+// save writes job.json atomically. st.mu must be held.
+func (st *jobStore) save(j *job) error {
+	data, err := json.MarshalIndent(j, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(st.jobDir(j.ID), "job.json")
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("saving job %s: %w", j.ID, err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("saving job %s: %w", j.ID, err)
+	}
+	return nil
+}
+
+// started marks a job as running.
+func (st *jobStore) started(j *job, pageCount int) error {
+	return st.update(j, func(j *job) {
+		now := time.Now()
+		j.Status, j.StartedAt, j.PageCount, j.PagesDone, j.Failures = jobRunning, &now, pageCount, 0, 0
+	})
+}
+
+// progress records pages done. It is kept in memory only; a job resumed
+// after a restart starts again from the first page.
+func (st *jobStore) progress(j *job, done int) {
+	st.mu.Lock()
+	j.PagesDone = done
+	st.mu.Unlock()
+}
+
+// pageFailed counts a page that could not be extracted. Like progress, it
+// is saved only with the job's next update.
+func (st *jobStore) pageFailed(j *job) {
+	st.mu.Lock()
+	j.Failures++
+	st.mu.Unlock()
+}
+
+// get returns a snapshot of the job if it belongs to tenant.
+func (st *jobStore) get(id, tenant string) (job, bool) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	j, ok := st.jobs[id]
+	if !ok || j.Tenant != tenant {
+		return job{}, false
+	}
+	return *j, true
+}
+
+// list returns snapshots of tenant's jobs, newest first.
+func (st *jobStore) list(tenant string) []job {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	jobs := []job{}
+	for _, j := range st.jobs {
+		if j.Tenant == tenant {
+			jobs = append(jobs, *j)
+		}
+	}
+	sort.Slice(jobs, func(a, b int) bool { return jobs[a].CreatedAt.After(jobs[b].CreatedAt) })
+	return jobs
+}
+
+// cancel marks a queued or running job as canceled and stops it. It reports
+// false if the job had already finished.
+func (st *jobStore) cancel(id, tenant string) (job, bool, error) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	j, ok := st.jobs[id]
+	if !ok || j.Tenant != tenant {
+		return job{}, false, nil
+	}
+	if j.finished() {
+		return *j, false, nil
+	}
+	now := time.Now()
+	j.Status, j.FinishedAt = jobCanceled, &now
+	if j.cancel != nil {
+		j.cancel()
+	}
+	return *j, true, st.save(j)
+}
+
+// submitJob saves the uploaded PDF as a new job and starts it.
+func (s *server) submitJob(w http.ResponseWriter, r *http.Request, t *tenant, callbackURL string) {
+	id, err := newJobID()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if err := os.MkdirAll(s.store.jobDir(id), 0755); err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !s.receive(w, r, t, s.store.inputPath(id)) {
+		os.RemoveAll(s.store.jobDir(id))
+		return
+	}
+
+	j := &job{ID: id, Tenant: t.Name, Status: jobQueued, CallbackURL: callbackURL, Priority: r.URL.Query().Get("priority"), CreatedAt: time.Now()}
+	if err := s.store.add(j); err != nil {
+		os.RemoveAll(s.store.jobDir(id))
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	s.startJob(t, j)
+	snapshot, _ := s.store.get(id, t.Name)
+	w.Header().Set("Location", "/jobs/"+id)
+	writeJSON(w, http.StatusAccepted, snapshot)
+}
+
+// resumeJobs restarts the jobs that were queued or running when the server
+// last stopped.
+func (s *server) resumeJobs() {
+	for _, j := range s.store.jobs {
+		if j.finished() {
+			continue
+		}
+		t := s.tenantNamed(j.Tenant)
+		if t == nil {
+			s.store.update(j, func(j *job) {
+				now := time.Now()
+				j.Status, j.FinishedAt, j.Error = jobFailed, &now, "API key no longer configured"
+			})
+			continue
+		}
+		log.Printf("Resuming job %s", j.ID)
+		s.store.update(j, func(j *job) { j.Status, j.StartedAt, j.PagesDone = jobQueued, nil, 0 })
+		s.startJob(t, j)
+	}
+}
+
+// startJob runs j in the background. Jobs count against the tenant's
+// concurrency limit while they run, and wait their turn rather than being
+// rejected.
+func (s *server) startJob(t *tenant, j *job) {
+	ctx, cancel := context.WithCancel(s.ctx)
+	s.store.mu.Lock()
+	j.cancel = cancel
+	s.store.mu.Unlock()
+
+	s.pending.Add(1)
+	go func() {
+		defer s.pending.Done()
+		defer cancel()
+
+		if t.slots != nil {
+			select {
+			case t.slots <- struct{}{}:
+				defer func() { <-t.slots }()
+			case <-ctx.Done():
+			}
+		}
+		var pages []pdfripper.PageRecord
+		err := ctx.Err()
+		if err == nil {
+			pages, err = s.run(ctx, t, s.store.inputPath(j.ID), s.store.jobDir(j.ID), j.Priority, j)
+		}
+		if err != nil && s.ctx.Err() != nil {
+			// Shutting down: leave the job queued for the next start.
+			s.store.update(j, func(j *job) {
+				if !j.finished() {
+					j.Status, j.StartedAt, j.PagesDone = jobQueued, nil, 0
+				}
+			})
+			return
+		}
+		if err == nil {
+			err = s.saveResult(j.ID, pages)
+		}
+		var artifacts *jobArtifacts
+		if err == nil && s.results != nil {
+			artifacts, err = s.deliverArtifacts(j.ID, pages)
+		}
+		s.store.update(j, func(j *job) {
+			if j.finished() {
+				return // canceled
+			}
+			now := time.Now()
+			j.FinishedAt = &now
+			if err != nil {
+				j.Status, j.Error = jobFailed, err.Error()
+				return
+			}
+			j.Status, j.Output, j.Artifacts = jobCompleted, s.store.resultPath(j.ID), artifacts
+		})
+		os.Remove(s.store.inputPath(j.ID))
+		os.RemoveAll(filepath.Join(s.store.jobDir(j.ID), artifactsDir))
+
+		snapshot, _ := s.store.get(j.ID, j.Tenant)
+		if snapshot.CallbackURL != "" {
+			if err := s.callbacks.post(snapshot.CallbackURL, t.CallbackSecret, snapshot); err != nil {
+				log.Printf("Warning: job %s: %v", j.ID, err)
+			}
+		}
+	}()
+}
+
+// saveResult writes a job's pages to its result.json, in the same shape as
+// a synchronous response, in page order.
+func (s *server) saveResult(id string, pages []pdfripper.PageRecord) error {
+	sort.Slice(pages, func(a, b int) bool { return pages[a].Page < pages[b].Page })
+	data, err := json.Marshal(newPagesResponse(pages))
+	if err != nil {
+		return err
+	}
+	path := s.store.resultPath(id)
+	if err := os.WriteFile(path+".tmp", data, 0644); err != nil {
+		return fmt.Errorf("saving job result: %w", err)
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		return fmt.Errorf("saving job result: %w", err)
+	}
+	return nil
+}
+
+// handleSubmitJob implements POST /jobs: the PDF is the request body, an
+// optional callback_url query parameter is notified on completion and an
+// optional priority one ranks the job against others.
+func (s *server) handleSubmitJob(w http.ResponseWriter, r *http.Request) {
+	t, callbackURL, ok := s.admit(w, r)
+	if !ok {
+		return
+	}
+	s.submitJob(w, r, t, callbackURL)
+}
+
+// handleListJobs implements GET /jobs.
+func (s *server) handleListJobs(w http.ResponseWriter, r *http.Request) {
+	t := s.authenticate(r)
+	if t == nil {
+		writeError(w, http.StatusUnauthorized, "missing or unknown API key")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"jobs": s.store.list(t.Name)})
+}
+
+// handleGetJob implements GET /jobs/{id}: status and progress.
+func (s *server) handleGetJob(w http.ResponseWriter, r *http.Request) {
+	t := s.authenticate(r)
+	if t == nil {
+		writeError(w, http.StatusUnauthorized, "missing or unknown API key")
+		return
+	}
+	j, ok := s.store.get(r.PathValue("id"), t.Name)
+	if !ok {
+		writeError(w, http.StatusNotFound, "no such job")
+		return
+	}
+	writeJSON(w, http.StatusOK, j)
+}
+
+// handleJobResult implements GET /jobs/{id}/result.
+func (s *server) handleJobResult(w http.ResponseWriter, r *http.Request) {
+	j, ok := s.completedJob(w, r)
+	if !ok {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	http.ServeFile(w, r, s.store.resultPath(j.ID))
+}
+
+// handleJobPages implements GET /jobs/{id}/pages: the pages of a completed
+// job from the from query parameter to the to one, both optional and
+// inclusive, shaped like its result but with page_count still the number
+// of pages of the whole document, so that a client can page through a
+// large result.
+func (s *server) handleJobPages(w http.ResponseWriter, r *http.Request) {
+	j, ok := s.completedJob(w, r)
+	if !ok {
+		return
+	}
+	from, to, ok := pageRange(w, r)
+	if !ok {
+		return
+	}
+	pages := []pdfripper.PageRecord{}
+	count, err := readResultPages(s.store.resultPath(j.ID), func(p pdfripper.PageRecord) error {
+		if p.Page >= from && p.Page <= to {
+			pages = append(pages, p)
+		}
+		return nil
+	})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, pdfripper.PagesResponse{SchemaVersion: pdfripper.PageSchemaVersion, PageCount: count, Pages: pages})
+}
+
+// handleJobText implements GET /jobs/{id}/text: the text of a completed
+// job as plain text, each page ending with a form feed as in a -combined
+// file, optionally limited to pages from and to as for /pages. It is
+// streamed from the stored result a page at a time.
+func (s *server) handleJobText(w http.ResponseWriter, r *http.Request) {
+	j, ok := s.completedJob(w, r)
+	if !ok {
+		return
+	}
+	from, to, ok := pageRange(w, r)
+	if !ok {
+		return
+	}
+	wrote := false
+	_, err := readResultPages(s.store.resultPath(j.ID), func(p pdfripper.PageRecord) error {
+		if p.Page < from || p.Page > to {
+			return nil
+		}
+		if !wrote {
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			wrote = true
+		}
+		if _, err := io.WriteString(w, p.Text); err != nil {
+			return err
+		}
+		_, err := io.WriteString(w, "\f")
+		return err
+	})
+	switch {
+	case err != nil && !wrote:
+		writeError(w, http.StatusInternalServerError, err.Error())
+	case err != nil:
+		// The status line is gone; all that is left is to cut the
+		// response short.
+		log.Printf("Warning: streaming text of job %s: %v", j.ID, err)
+		panic(http.ErrAbortHandler)
+	case !wrote:
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	}
+}
+
+// completedJob returns the job a request for a result names, or reports
+// why there is none: the key is unknown, the job is not the key's or it
+// has not completed.
+func (s *server) completedJob(w http.ResponseWriter, r *http.Request) (job, bool) {
+	t := s.authenticate(r)
+	if t == nil {
+		writeError(w, http.StatusUnauthorized, "missing or unknown API key")
+		return job{}, false
+	}
+	j, ok := s.store.get(r.PathValue("id"), t.Name)
+	if !ok {
+		writeError(w, http.StatusNotFound, "no such job")
+		return job{}, false
+	}
+	if j.Status != jobCompleted {
+		writeError(w, http.StatusConflict, fmt.Sprintf("job is %s", j.Status))
+		return job{}, false
+	}
+	return j, true
+}
+
+// pageRange parses the from and to query parameters, which default to
+// the first and the last page.
+func pageRange(w http.ResponseWriter, r *http.Request) (from, to int, ok bool) {
+	from, to = 1, math.MaxInt
+	for _, p := range []struct {
+		name string
+		v    *int
+	}{{"from", &from}, {"to", &to}} {
+		v := r.URL.Query().Get(p.name)
+		if v == "" {
+			continue
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("%s must be a page number, not %q", p.name, v))
+			return 0, 0, false
+		}
+		*p.v = n
+	}
+	if from > to {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("from %d is after to %d", from, to))
+		return 0, 0, false
+	}
+	return from, to, true
+}
+
+// readResultPages calls fn with each page of a result.json in turn,
+// decoding one page at a time rather than the whole file, and returns
+// the result's page_count.
+func readResultPages(path string, fn func(pdfripper.PageRecord) error) (pageCount int, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	dec := json.NewDecoder(bufio.NewReader(f))
+	if err := expectDelim(dec, '{'); err != nil {
+		return 0, err
+	}
+	for dec.More() {
+		key, err := dec.Token()
+		if err != nil {
+			return 0, err
+		}
+		switch key {
+		case "page_count":
+			err = dec.Decode(&pageCount)
+		case "pages":
+			if err = expectDelim(dec, '['); err != nil {
+				break
+			}
+			for err == nil && dec.More() {
+				var p pdfripper.PageRecord
+				if err = dec.Decode(&p); err == nil {
+					err = fn(p)
+				}
+			}
+			if err == nil {
+				err = expectDelim(dec, ']')
+			}
+		default:
+			var skip json.RawMessage
+			err = dec.Decode(&skip)
+		}
+		if err != nil {
+			return 0, fmt.Errorf("reading %s: %w", filepath.Base(path), err)
+		}
+	}
+	return pageCount, nil
+}
+
+// expectDelim reads the next token of dec, which must be delim.
+func expectDelim(dec *json.Decoder, delim json.Delim) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if tok != delim {
+		return fmt.Errorf("expected %v, found %v", delim, tok)
+	}
+	return nil
+}
+
+// handleCancelJob implements POST /jobs/{id}/cancel.
+func (s *server) handleCancelJob(w http.ResponseWriter, r *http.Request) {
+	t := s.authenticate(r)
+	if t == nil {
+		writeError(w, http.StatusUnauthorized, "missing or unknown API key")
+		return
+	}
+	j, canceled, err := s.store.cancel(r.PathValue("id"), t.Name)
+	switch {
+	case j.ID == "":
+		writeError(w, http.StatusNotFound, "no such job")
+	case err != nil:
+		writeError(w, http.StatusInternalServerError, err.Error())
+	case !canceled:
+		writeError(w, http.StatusConflict, fmt.Sprintf("job already %s", j.Status))
+	default:
+		writeJSON(w, http.StatusOK, j)
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"github.com/thnkr-one/pdfripper/pdfripper"
+)
+
+// runLinks implements "pdfripper links": it exports the internal links of
+// a document, page to page and through its named destinations, as JSON
+// or GraphML, for analysing how a large manual is navigated.
+func runLinks(args []string) {
+	fs := flag.NewFlagSet("links", flag.ExitOnError)
+	inputFile := fs.String("input", "", "Input PDF file path (required)")
+	passwordFlag(fs)
+	format := fs.String("format", "json", "Output format: json or graphml")
+	output := fs.String("output", "", "Write the graph to this file (default: standard output)")
+	if !parseFlags(fs, args) {
+		return
+	}
+	if *inputFile == "" {
+		fs.Usage()
+		os.Exit(1)
+	}
+	if *format != "json" && *format != "graphml" {
+		log.Fatalf("Error: -format %s is neither json nor graphml", *format)
+	}
+
+	graph, err := pdfripper.Links(*inputFile)
+	if err != nil {
+		log.Fatalf("Error reading links: %v", err)
+	}
+	var w io.Writer = os.Stdout
+	if *output != "" {
+		f, err := os.Create(*output)
+		if err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+		defer f.Close()
+		w = f
+	}
+	if *format == "graphml" {
+		err = graph.WriteGraphML(w)
+	} else {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(graph)
+	}
+	if err != nil {
+		log.Fatalf("Error writing the graph: %v", err)
+	}
+	if *output != "" {
+		fmt.Printf("Wrote %d links and %d named destinations to %s\n", len(graph.Links), len(graph.Dests), *output)
+	}
+}
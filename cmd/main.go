@@ -1,37 +1,663 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
+	"os"
+	"path/filepath"
 	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/thnkr-one/pdfripper/pdfripper"
 )
 
 func main() {
-	inputFile := flag.String("input", "", "Input PDF file path (required)")
-	outputDir := flag.String("output", "", "Output directory (default: PDF basename)")
-	procCount := flag.Int("processes", 0, "Number of concurrent workers (default: number of CPU cores)")
-	flag.Parse()
+	if len(os.Args) > 1 {
+		for _, c := range commands() {
+			if c.name == os.Args[1] {
+				c.run(os.Args[2:])
+				return
+			}
+		}
+	}
+	runExtract(os.Args[1:])
+}
 
-	if *inputFile == "" {
-		flag.Usage()
-		log.Fatal("Error: input PDF file is required (use -input)")
+// runExtract implements plain "pdfripper -input FILE", extracting the text
+// of every page.
+func runExtract(args []string) {
+	fs := flag.NewFlagSet("pdfripper", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: pdfripper -input FILE [flags]")
+		fmt.Fprintln(fs.Output(), "       pdfripper COMMAND [flags] [args]")
+		fmt.Fprintln(fs.Output(), "\nCommands:")
+		for _, c := range commands() {
+			fmt.Fprintf(fs.Output(), "  %-11s%s\n", c.name, c.summary)
+		}
+		fmt.Fprintln(fs.Output(), "\nFlags:")
+		fs.PrintDefaults()
+		fmt.Fprintln(fs.Output(), "\nEvery flag can also be set in the environment, as PDFRIPPER_OCR_DPI=600 sets -ocr-dpi, or in")
+		fmt.Fprintln(fs.Output(), "the YAML config file $PDFRIPPER_CONFIG, or else pdfripper/config.yaml in the user's")
+		fmt.Fprintln(fs.Output(), "configuration directory, as processes: 8 sets -processes; see the man page. Flags on the")
+		fmt.Fprintln(fs.Output(), "command line take precedence over the environment, which takes precedence over the file.")
+	}
+	inputFile := fs.String("input", "", "Input PDF file path, an email ("+strings.Join(pdfripper.EmailExtensions, ", ")+") whose PDF attachments are each extracted into a subdirectory of -output, or an archive ("+strings.Join(archiveExtensions, ", ")+") whose PDFs and emails are, each into -output/PATH, PATH being its path in the archive without the extension, or with -soffice an office document (required, unless -input-list or -input-dir is set)")
+	password := passwordFlag(fs)
+	inputList := fs.String("input-list", "", "File listing input PDF paths or http(s) URLs, one per line, or - to read them from stdin, as from find; each is extracted into a subdirectory of -output named after it")
+	var batch batchInputs
+	fs.StringVar(&batch.dir, "input-dir", "", "Directory of input PDFs, emails and archives, searched recursively; each is extracted into -output/PATH, PATH being its path in the directory without the extension")
+	fs.Var(&batch.include, "include", "With -input-list, -input-dir or an archive -input, extract only files matching this glob, such as **/*.pdf, where ** matches any number of directories; may be repeated (default with -input-dir or an archive: PDFs, emails and archives, by extension)")
+	fs.Var(&batch.exclude, "exclude", "With -input-list, -input-dir or an archive -input, skip files matching this glob, such as **/drafts/**; may be repeated")
+	fs.IntVar(&batch.maxDepth, "max-depth", 0, "With -input-dir or an archive -input, search at most this many directories deep; 1 takes only the top directory's own files (default: no limit)")
+	fs.BoolVar(&batch.linkDuplicates, "link-duplicates", true, "With -input-list or -input-dir, extract a file listed more than once, through symbolic or hard links or as a copy, only once, and make the outputs of the others symbolic links to its output (not for -output URLs)")
+	fs.StringVar(&batch.quarantine, "quarantine", "", "With -input-list or -input-dir, copy or move documents that fail to failed/NAME in the output directory, with an error.json saying why ("+strings.Join(quarantineModes, ", ")+"; default: leave them)")
+	inputJobs := fs.Int("input-jobs", 1, "With -input-list or -input-dir, the number of documents extracted at once")
+	fs.IntVar(&batch.sharedWorkers, "shared-workers", 0, "With -input-list or -input-dir, extract at most this many pages at once across the documents, which take turns at them so that small documents do not wait behind a large one; use with -input-jobs above 1 (default: each document has -processes workers of its own)")
+	fs.BoolVar(&batch.sanitize, "sanitize", false, "Prepare the output for sharing: redact -sanitize-entities in the text and fields, pseudonymize Bates numbers, leave metadata, watermarks and image hashes out of the manifest, name outputs at random instead of after their documents, and keep the documents -revision, -repair, -rotate, -reorder and -split-spreads rewrite out of the output")
+	batch.notify = &notifyFlag{}
+	fs.Var(batch.notify, "notify", "When the run ends, or fails, tell cmd:COMMAND, run with the message as its last argument and the details in $PDFRIPPER_NOTIFY_STATUS, _INPUT, _OUTPUT, _SECONDS and _ERROR; slack:WEBHOOK_URL, a Slack incoming webhook; or desktop, with a desktop notification; may be repeated")
+	fs.StringVar(&batch.office, "soffice", "", "Convert office documents ("+strings.Join(pdfripper.OfficeExtensions, ", ")+") to PDF with this LibreOffice command, such as soffice, and extract them, as -input or in a batch (default: leave them)")
+	outputDir := fs.String("output", "", "Output directory, or a "+remoteSchemes+" URL to upload the output to (default: PDF basename)")
+	procCount := fs.String("processes", "", "Number of concurrent workers, or auto to raise and lower it as the run goes by how busy the CPUs are and how fast pages come, from the number of CPU cores (default: number of CPU cores)")
+	minWorkers := fs.Int("min-processes", 0, "With -processes auto, the fewest workers (default: 1)")
+	maxWorkers := fs.Int("max-processes", 0, "With -processes auto, the most workers (default: twice the number of CPU cores)")
+	maxProcs := fs.Int("gomaxprocs", 0, "Number of OS threads running Go code at once, which bounds the CPUs in-process work such as the native backend uses (default: GOMAXPROCS from the environment, or number of CPU cores)")
+	postCount := fs.Int("post-processes", 0, "Number of concurrent post-processing workers (default: same as -processes)")
+	backendName := fs.String("backend", pdfripper.DefaultBackend, "Text extraction backend ("+strings.Join(pdfripper.Backends(), ", ")+")")
+	agreementName := fs.String("agreement", "", "Also extract a sample of pages with this second backend, record how well its text agrees with -backend's in the manifest, and warn if they disagree enough that the document needs review")
+	agreementPages := fs.Int("agreement-pages", pdfripper.DefaultAgreementPages, "With -agreement, the number of pages compared, spread evenly over the document")
+	agreementThreshold := fs.Float64("agreement-threshold", pdfripper.DefaultAgreementThreshold, "With -agreement, the mean agreement, from 0 to 1, below which the document needs review")
+	maxInFlight := fs.Int("max-in-flight", 0, "Maximum pages held in memory at once (default: 2 × total workers)")
+	combinedFile := fs.String("combined", "", "Also stream all pages, in order, into this file")
+	toc := fs.Bool("toc", false, "Write the table of contents to "+pdfripper.TOCFile+" in the output directory: the document's bookmarks, or where it has none, the headings found by their font sizes")
+	tocInCombined := fs.Bool("toc-in-combined", false, "With -toc, also start the -combined file with the table of contents, as a page of its own")
+	batchSize := fs.Int("batch-size", 1, "Pages extracted per backend call")
+	pageRetries := fs.Int("page-retries", 0, "Extract a page that fails up to this many more times before giving up on it")
+	diagnostics := fs.Bool("diagnostics", false, "Save pages that still fail to "+pdfripper.DiagnosticsDir+"/ in the output directory, as page_N.png where the backend can render them and page_N.json with their errors, the backend's error output and the file offsets of their objects")
+	cacheDir := fs.String("cache", "", "Directory for caching extracted text between runs, and with -input-list the documents of URLs, which are then downloaded and extracted again only if their ETag or Last-Modified changed")
+	pageFiles := fs.Bool("page-files", true, "Write one text file per page to the output directory")
+	minFree := fs.Uint64("min-free-space", 0, "Bytes that must stay free in the output and temporary directories: fail before starting if the estimated output would leave less, and stop if free space drops below (default: only warn when the estimate exceeds free space)")
+	maxFileSize := fs.Int64("max-file-size", 0, "Refuse input files larger than this many bytes (default: no limit)")
+	maxPages := fs.Int("max-pages", 0, "Refuse documents with more pages than this (default: no limit)")
+	acceptNonPDF := fs.Bool("accept-nonpdf", false, "Extract the text of HTML and plain-text inputs, told apart by their contents, HTML with its markup removed, instead of refusing inputs that are not PDFs")
+	rejectActive := fs.Bool("reject-active-content", false, "Refuse documents containing JavaScript, launch actions, embedded executables or obfuscated streams")
+	ocrEngine := fs.String("ocr", "", "OCR engine for pages whose text looks like garbage ("+ocrEngines+"; default: no OCR)")
+	ocrLang := fs.String("ocr-lang", "", "OCR language, e.g. eng or deu+eng (default: the engine's own)")
+	ocrThreshold := fs.Float64("ocr-threshold", pdfripper.DefaultOCRThreshold, "Quality score from 0 to 1 below which a page is OCRed")
+	ocrDPI := fs.Int("ocr-dpi", pdfripper.DefaultOCRDPI, "Resolution pages are rendered at for OCR")
+	ocrURL := fs.String("ocr-url", "", "Endpoint of the http or azure-read OCR engine, or an alternative google-vision base URL")
+	ocrKey := fs.String("ocr-key", "", "API key or bearer token for remote OCR engines; best set as $PDFRIPPER_OCR_KEY, which other users cannot see")
+	ocrLayout := fs.String("ocr-layout", "", "Also save word positions of OCRed pages next to their page files ("+strings.Join(pdfripper.OCRLayoutFormats, ", ")+"; tesseract only)")
+	ocrMerge := fs.Bool("ocr-merge", false, "Keep extracted text that scores well and add the OCR lines of regions it lacks, such as scanned inserts (tesseract only)")
+	reviewThreshold := fs.Float64("review-threshold", 0, "Copy OCRed pages whose mean word confidence (0 to 1) is below this to needs_review/ in the output directory (tesseract only)")
+	ocrWorkers := fs.Int("ocr-workers", 0, "Number of pages OCRed concurrently (default: same as -processes)")
+	manifestFormats := fs.String("manifest-format", "", "Write a per-page manifest to the output directory in these comma-separated formats ("+strings.Join(pdfripper.ManifestFormats, ", ")+")")
+	watermarks := fs.Bool("watermarks", false, "Detect watermarks and stamps and record them in manifest.json")
+	metadata := fs.Bool("metadata", false, "Record the document's title, author, dates and other metadata, from its Info dictionary and XMP, in manifest.json")
+	metadataMap := fs.String("metadata-map", "", "File mapping document properties to manifest fields, one per line: an XMP property such as acme:MatterID or an Info key, and the field name (implies -metadata)")
+	removeWatermarks := fs.Bool("remove-watermarks", false, "Detect watermarks and stamps and drop their text from the output")
+	orientation := fs.String("filter-orientation", "", "Extract only pages with this orientation (portrait, landscape, square)")
+	stripHeaders := fs.Bool("strip-headers", false, "Drop page numbers and running headers and footers from the top and bottom of every page, leaving the rest of the text as it is")
+	speech := fs.Bool("speech", false, "Write text for screen readers and text-to-speech: no headers, footers or page numbers, rejoined hyphenation, tables read out")
+	normalizeArabic := fs.Bool("normalize-arabic", false, "Replace Arabic presentation forms (shaped glyphs) with plain letters")
+	reorderRTL := fs.Bool("reorder-rtl", false, "Put Hebrew and Arabic lines into reading order, for PDFs whose text comes out reversed")
+	cjkSpaces := fs.Bool("collapse-cjk-spaces", false, "Remove spurious spaces between Chinese and Japanese characters")
+	verticalText := fs.String("vertical-text", pdfripper.VerticalAuto, "How to read vertically typeset text such as Japanese tategaki ("+strings.Join(pdfripper.VerticalTextModes, ", ")+"; only auto for backends other than native)")
+	equations := fs.Bool("equations", false, "Replace display equations with "+pdfripper.EquationPlaceholder+" and save their images as page_N_eq_K.png")
+	equationCmd := fs.String("equation-cmd", "", "Command that reads an equation image, whose path is appended, and prints LaTeX, e.g. pix2tex (implies -equations)")
+	figures := fs.Bool("figures", false, "Save figures as page_N_fig_K.png and list them with their captions in manifest.json")
+	chunkSize := fs.Int("chunk-size", 0, "Also cut the text into chunks of at most this many characters, ending at spaces where they can, and write them with their pages to "+pdfripper.ChunksFile+" in the output directory")
+	summaryURL := fs.String("summary-url", "", "Also write an abstract of the document to "+pdfripper.SummaryFile+" in the output directory, made by the language model of this OpenAI-compatible chat completions endpoint, such as http://localhost:11434/v1/chat/completions, from its text, or for long documents from the summaries of its parts")
+	summaryModel := fs.String("summary-model", "", "With -summary-url, the model to ask for, such as gpt-4o-mini")
+	summaryToken := fs.String("summary-token", "", "Bearer token for -summary-url; best set as $PDFRIPPER_SUMMARY_TOKEN, which other users cannot see")
+	summaryPrompt := fs.String("summary-prompt", "", "With -summary-url, file of the instructions for the summary, instead of asking for a paragraph and the key points as a bulleted list")
+	summaryChars := fs.Int("summary-chars", pdfripper.DefaultSummaryChars, "With -summary-url, the most characters of text sent at once; longer documents are summarized in parts of this size")
+	embedURL := fs.String("embed-url", "", "With -chunk-size and -vector-store, embed every chunk with this OpenAI-compatible embeddings endpoint, such as http://localhost:11434/v1/embeddings")
+	embedModel := fs.String("embed-model", "", "With -embed-url, the embedding model to ask for, such as text-embedding-3-small")
+	embedToken := fs.String("embed-token", "", "Bearer token for -embed-url; best set as $PDFRIPPER_EMBED_TOKEN, which other users cannot see")
+	vectorStore := fs.String("vector-store", "", "With -chunk-size and -embed-url, upsert every chunk, its embedding, document, pages and metadata into this vector database, replacing the document's chunks of earlier runs: qdrant://HOST:PORT/COLLECTION, weaviate://HOST:PORT/CLASS (qdrants, weaviates: over https) or pgvector://USER@HOST:PORT/DB?table=TABLE, over psql")
+	vectorStoreKey := fs.String("vector-store-key", "", "API key for a Qdrant or Weaviate -vector-store; best set as $PDFRIPPER_VECTOR_STORE_KEY, which other users cannot see")
+	vectorBatch := fs.Int("vector-batch", pdfripper.DefaultVectorBatch, "With -vector-store, chunks embedded and upserted at a time")
+	fs.StringVar(&batch.vectorDocument, "vector-document", "", "With -vector-store, the document name its chunks are recorded, and those of earlier runs replaced, under (default: the input's file name; in a batch, each document's path in the -input-dir, email or archive, or its -input-list line, after the email's or archive's own name)")
+	tokenizer := fs.String("tokenizer", "", "Count the tokens of every page and chunk, for budgeting language models, in the manifest and "+pdfripper.ChunksFile+": "+pdfripper.TokenizerHeuristic+", an estimate, or bpe:PATH, exactly, with the tiktoken encoding at PATH, such as cl100k_base.tiktoken")
+	segment := fs.String("segment", "", "Also write the text's "+strings.Join(pdfripper.Segmentations, " or ")+", with the pages and character offsets they start and end at, to "+pdfripper.SegmentsFile+" in the output directory")
+	chunkOverlap := fs.Int("chunk-overlap", 0, "With -chunk-size, characters each chunk repeats from the end of the one before")
+	splitBy := fs.String("split-by", "", "Also split the text into a file per section in "+pdfripper.SectionsDir+"/ in the output directory, named after the section's first line, at lines matching regex:PATTERN, such as 'regex:^ARTICLE \\d+'")
+	split := fs.String("split", "", "Split the output into logical documents at boundaries found by these comma-separated rules (blank, page-numbers)")
+	replacements := fs.String("replacements", "", "File of replacement rules applied to every page: one per line, a regular expression, a tab and its replacement")
+	script := fs.String("script", "", "Starlark script whose transform(page) function is called with every page, to change page.text, add page.fields to the manifest, or drop the page by returning False")
+	enrichURL := fs.String("enrich-url", "", "POST every page's text and fields as JSON to this endpoint and merge the JSON object it answers with into the page's fields in the manifest")
+	enrichToken := fs.String("enrich-token", "", "Bearer token for -enrich-url; best set as $PDFRIPPER_ENRICH_TOKEN, which other users cannot see")
+	enrichConcurrency := fs.Int("enrich-concurrency", 4, "With -enrich-url, requests in flight at once at most (raises -post-processes to match)")
+	enrichRate := fs.Float64("enrich-rate", 0, "With -enrich-url, requests started per second at most, retries included (0: no limit)")
+	enrichRetries := fs.Int("enrich-retries", 3, "With -enrich-url, times a request failing with a network error, 429 or 5xx is retried, backing off from one second")
+	sanitizeEntities := fs.String("sanitize-entities", strings.Join(pdfripper.Entities, ","), "With -sanitize, the comma-separated entity types to redact ("+strings.Join(pdfripper.Entities, ", ")+")")
+	sanitizeKey := fs.String("sanitize-key", "", "With -sanitize, key of the Bates number pseudonyms, so that runs with the same key give the same ones (default: drawn at random for each document); best set as $PDFRIPPER_SANITIZE_KEY")
+	eventsFormat := fs.String("events", "", "Write machine-readable progress events (run_started, page_done, page_failed, heartbeat, run_finished) to stderr in this format ("+strings.Join(eventFormats, ", ")+")")
+	idempotencyKey := fs.String("idempotency-key", "", "Write the output to a subdirectory of the output directory named after this key, and if a run with the key has completed there, report it instead of extracting again")
+	var rotate rotateFlag
+	fs.Var(&rotate, "rotate", "Turn pages clockwise before extraction: DEGREES, a multiple of 90, or DEGREES:pages=LIST such as 180:pages=2,5-7; may be repeated")
+	sample := fs.String("sample", "", "Extract only a sample of the pages, for judging a corpus before extracting all of it: N pages, or P% of them, one drawn at random from each of as many equal stretches of the document")
+	sampleSeed := fs.Int64("sample-seed", 0, "Seed of the random draw of -sample pages; the same seed draws the same pages")
+	order := fs.String("order", pdfripper.OrderFirstLast, "Order to extract and write the pages in, so that the important ones come out first ("+strings.Join(pdfripper.PageOrders, ", ")+"); not with -combined or -split")
+	priorityPages := fs.String("priority-pages", "", "With -order custom, the pages to extract first, e.g. 1-10,r5-z for the first ten and the last five (z is the last page, rN the Nth from the end)")
+	repair := fs.Bool("repair", false, "Rewrite the input, its cross-reference table rebuilt, to repaired.pdf in the output directory and extract that, for damaged files the backend rejects; outlines, forms and document metadata are dropped")
+	revision := fs.Int("revision", 0, "Extract this earlier revision of an incrementally updated document, as the revisions command numbers them, writing it to revision_N.pdf in the output directory (default: the latest)")
+	reorder := fs.String("reorder", "", "Put the pages in this order before extraction, e.g. 2,1,3-10 or 10-1; pages left out are dropped (-rotate uses the original numbers)")
+	splitSpreads := fs.Bool("split-spreads", false, "Cut landscape pages holding two pages side by side, such as book scans and 2-up printouts, into single pages before extraction")
+	booklet := fs.Bool("booklet", false, "Treat the pages as the sheets of a folded booklet: cut every page in two and put the halves in reading order (implies -split-spreads)")
+	bates := fs.Bool("bates", false, "Find each page's Bates number, such as ABC000123, in its corners and record it in the manifest")
+	batesNames := fs.Bool("bates-filenames", false, "Name page files after their Bates numbers, such as ABC000123.txt, instead of page_N.txt (implies -bates)")
+	pageLabels := fs.Bool("page-labels", false, "Read each page's logical label, such as iv or A-3, from the document and record it in the manifest and JSON pages")
+	labelNames := fs.Bool("label-filenames", false, "Name page files after their labels, such as iv.txt, instead of page_N.txt (implies -page-labels)")
+	pageOffset := fs.Int("page-offset", 0, "Label pages with their number plus this instead of the document's labels, so that with -4 the fifth page is 1 (implies -page-labels)")
+	lineNumbers := fs.String("line-numbers", "", "On pleading paper, with numbered lines down the left margin: strip the numbers, or map them, also writing each numbered line's text to page_N.lines.json ("+pdfripper.LineNumbersStrip+", "+pdfripper.LineNumbersMap+"; default: leave them)")
+	invoices := fs.Bool("invoices", false, "Find the invoice number, date, total, VAT amount, VAT ID and IBAN of an invoice and write them to invoice.json")
+	normalize := fs.Bool("normalize", false, "In invoice.json, also give dates in ISO 8601 form and amounts with a decimal point and their currency code, keeping the values as printed")
+	heartbeat := fs.Duration("heartbeat", 0, "Every this often, such as 1m, report the pages in flight, how long each has taken and an estimate of the time left (0: never)")
+	slowPage := fs.Duration("slow-page", 0, "Warn about pages in flight for longer than this, such as 10m, and mark them slow in heartbeats (0: never)")
+	keepTemp := fs.Bool("keep-temp", false, "Keep the run's temporary workspace (rendered images, command working directories) and print its path, for debugging")
+	fs.StringVar(&tempDir, "temp-dir", "", "Directory temporary files are made in: the run's workspace, downloaded and unpacked inputs, converted office documents and staged remote output (default: $TMPDIR, or /tmp)")
+	waitForLock := fs.Bool("wait-for-lock", false, "If another run is writing to the same -output, wait for it to finish instead of failing")
+	fs.Bool("confine-writes", false, "Write nowhere but -output and -temp-dir, which must both be set: refuse -cache, -combined and -audit-log paths elsewhere, and check where every page file resolves to, through symbolic links; for read-only root filesystems")
+	applySandbox := sandboxFlags(fs)
+	if !parseFlags(fs, args) {
+		return
 	}
 
-	if *procCount < 1 {
-		*procCount = runtime.NumCPU()
+	if *inputFile == "" && *inputList == "" && batch.dir == "" {
+		fs.Usage()
+		log.Fatal("Error: input PDF file is required (use -input, -input-list or -input-dir)")
+	}
+	if err := checkFlags(fs); err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	batch.vectors, batch.password = *vectorStore != "", *password
+	if *inputList != "" || batch.dir != "" {
+		batch.list, batch.cache = *inputList, *cacheDir
+		err := runBatch(batch, *outputDir, *inputJobs, args)
+		source := *inputList
+		if source == "" {
+			source = batch.dir
+		}
+		batch.notify.done(source, redactURL(*outputDir), err)
+		if err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+		return
+	}
+	if pdfripper.IsEmailFile(*inputFile) {
+		runEmail(*inputFile, *outputDir, batch, *inputJobs, args)
+		return
+	}
+	if isArchive(*inputFile) {
+		runArchive(*inputFile, *outputDir, batch, *inputJobs, args)
+		return
+	}
+	if pdfripper.IsOfficeFile(*inputFile) {
+		if batch.office == "" {
+			log.Fatalf("Error: %s is an office document; set -soffice to convert it to PDF", *inputFile)
+		}
+		converted, cleanup, err := convertOffice(*inputFile, batch.office)
+		if err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+		defer cleanup()
+		fmt.Printf("Converted %s to PDF\n", *inputFile)
+		if *outputDir == "" {
+			*outputDir = docName(filepath.Base(*inputFile))
+		}
+		*inputFile = converted
 	}
 
-	extractor, err := pdfripper.NewExtractor(*inputFile, *outputDir, *procCount)
+	if batch.sanitize && *outputDir == "" {
+		*outputDir = sanitizedName()
+	}
+	if *maxProcs > 0 {
+		runtime.GOMAXPROCS(*maxProcs)
+	}
+	workers, _ := strconv.Atoi(*procCount)
+	if workers < 1 {
+		workers = runtime.NumCPU()
+	}
+
+	remote := isRemoteOutput(*outputDir)
+	localDir := *outputDir
+	if remote {
+		// The output is staged in a directory of its own, made right
+		// before extraction.
+		localDir = tempDir
+		if localDir == "" {
+			localDir = os.TempDir()
+		}
+	}
+	extractor, err := pdfripper.NewExtractor(*inputFile, localDir, workers)
 	if err != nil {
 		log.Fatalf("Error initializing extractor: %v", err)
 	}
+	if *postCount > 0 {
+		extractor.PostProcessCount = *postCount
+	}
+	if *procCount == "auto" {
+		extractor.Autoscale = &pdfripper.Autoscaler{Min: *minWorkers, Max: *maxWorkers}
+	}
+	if extractor.Backend, err = pdfripper.LookupBackend(*backendName); err == nil {
+		extractor.Backend, err = applySandbox(extractor.Backend)
+	}
+	if err == nil {
+		extractor.Backend, err = withVerticalText(extractor.Backend, *verticalText)
+	}
+	if err == nil && *agreementName != "" {
+		var second pdfripper.Backend
+		if second, err = pdfripper.LookupBackend(*agreementName); err == nil {
+			second, err = applySandbox(second)
+		}
+		extractor.Agreement = &pdfripper.Agreement{Backend: second, Pages: *agreementPages, Threshold: *agreementThreshold}
+	}
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	extractor.MaxInFlight = *maxInFlight
+	extractor.CombinedFile = *combinedFile
+	extractor.TOC = *toc
+	extractor.TOCInCombined = *tocInCombined
+	extractor.SkipPageFiles = !*pageFiles
+	extractor.BatchSize = *batchSize
+	extractor.PageRetries = *pageRetries
+	extractor.Diagnostics = *diagnostics
+	extractor.Pool = sharedPool()
+	extractor.MaxFileSizeBytes = *maxFileSize
+	extractor.MaxPages = *maxPages
+	extractor.MinFreeSpace = *minFree
+	if extractor.SampleSize, extractor.SampleFraction, err = parseSample(*sample); err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	extractor.SampleSeed = *sampleSeed
+	extractor.PageOrder = *order
+	extractor.PriorityPages = *priorityPages
+	extractor.RejectActiveContent = *rejectActive
+	extractor.AcceptNonPDF = *acceptNonPDF
+	extractor.DetectWatermarks = *watermarks
+	extractor.RemoveWatermarks = *removeWatermarks
+	extractor.Metadata = *metadata
+	extractor.FilterOrientation = *orientation
+	extractor.Speech = *speech
+	extractor.StripHeaders = *stripHeaders
+	extractor.ChunkSize = *chunkSize
+	extractor.ChunkOverlap = *chunkOverlap
+	extractor.Segment = *segment
+	extractor.NormalizeArabic = *normalizeArabic
+	extractor.ReorderRTL = *reorderRTL
+	extractor.CollapseCJKSpaces = *cjkSpaces
+	extractor.Equations = *equations
+	extractor.Figures = *figures
+	extractor.Bates = *bates
+	extractor.BatesFileNames = *batesNames
+	extractor.PageLabels = *pageLabels
+	extractor.LabelFileNames = *labelNames
+	extractor.PageOffset = *pageOffset
+	extractor.LineNumbers = *lineNumbers
+	extractor.KeepTemp = *keepTemp
+	extractor.TempDir = tempDir
+	extractor.ConfineTo = confineDirs(fs)
+	extractor.SlowPage = *slowPage
+	if *replacements != "" {
+		if extractor.Replacements, err = pdfripper.LoadReplacements(*replacements); err != nil {
+			log.Fatalf("Error loading replacements: %v", err)
+		}
+	}
+	if *script != "" {
+		s, err := pdfripper.LoadScript(*script)
+		if err != nil {
+			log.Fatalf("Error loading script: %v", err)
+		}
+		extractor.PostProcessors = append(extractor.PostProcessors, s.PostProcess)
+	}
+	if batch.sanitize {
+		if extractor.Sanitize, err = pdfripper.NewSanitizer(strings.Split(*sanitizeEntities, ",")...); err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+		extractor.Sanitize.Key = []byte(*sanitizeKey)
+	}
+	if *enrichURL != "" {
+		extractor.Stages = append(extractor.Stages, &pdfripper.Enricher{
+			URL:         *enrichURL,
+			File:        filepath.Base(extractor.PDFFile),
+			Token:       *enrichToken,
+			Concurrency: *enrichConcurrency,
+			Rate:        *enrichRate,
+			Retries:     *enrichRetries,
+		})
+		extractor.PostProcessCount = max(extractor.PostProcessCount, *enrichConcurrency)
+	}
+	if *metadataMap != "" {
+		if extractor.MetadataMap, err = pdfripper.LoadMetadataMap(*metadataMap); err != nil {
+			log.Fatalf("Error loading metadata map: %v", err)
+		}
+	}
+	if *equationCmd != "" {
+		if extractor.EquationOCR, err = newEquationOCR(*equationCmd); err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+	}
+	for _, name := range strings.FieldsFunc(*split, func(r rune) bool { return r == ',' }) {
+		extractor.Splitters = append(extractor.Splitters, pdfripper.Splitters[name])
+	}
+	if *splitBy != "" {
+		if extractor.SectionMarker, err = pdfripper.ParseSectionMarker(*splitBy); err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+	}
+	if *summaryURL != "" {
+		extractor.Summarize = &pdfripper.Summarizer{
+			Model:    &pdfripper.ChatCompletions{URL: *summaryURL, Model: *summaryModel, Token: *summaryToken, Retries: serviceRetries},
+			MaxChars: *summaryChars,
+		}
+		if *summaryPrompt != "" {
+			prompt, err := os.ReadFile(*summaryPrompt)
+			if err != nil {
+				log.Fatalf("Error loading summary prompt: %v", err)
+			}
+			extractor.Summarize.Prompt = strings.TrimSpace(string(prompt))
+		}
+	}
+	if *vectorStore != "" {
+		if batch.vectorDocument == "" {
+			batch.vectorDocument = filepath.Base(extractor.PDFFile)
+		}
+		store, err := openVectorStore(*vectorStore, *vectorStoreKey)
+		if err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+		extractor.Vectors = &pdfripper.VectorSink{
+			Embedder:  &pdfripper.HTTPEmbedder{URL: *embedURL, Model: *embedModel, Token: *embedToken, Retries: serviceRetries},
+			Store:     store,
+			Document:  batch.vectorDocument,
+			BatchSize: *vectorBatch,
+		}
+	}
+	if *tokenizer != "" {
+		if extractor.Tokenizer, err = pdfripper.ParseTokenizer(*tokenizer); err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+	}
+	if *manifestFormats != "" {
+		extractor.ManifestFormats = strings.Split(*manifestFormats, ",")
+	}
+	if *ocrEngine != "" {
+		var affinity *pdfripper.CPUAffinity
+		if affinity, err = cpuAffinity(fs); err == nil {
+			extractor.OCR, err = newOCREngine(*ocrEngine, *ocrLang, *ocrURL, *ocrKey, affinity)
+		}
+		if err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+		extractor.OCRThreshold = *ocrThreshold
+		extractor.OCRDPI = *ocrDPI
+		extractor.OCRWorkers = *ocrWorkers
+		extractor.OCRLayout = *ocrLayout
+		extractor.ReviewThreshold = *reviewThreshold
+		extractor.OCRMerge = *ocrMerge
+	}
+	if *cacheDir != "" {
+		if extractor.Cache, err = pdfripper.NewDirCache(*cacheDir); err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+	}
+
+	if err := extractor.Validate(); err != nil {
+		log.Fatalf("Error: %v", err)
+	}
 
-	if err := extractor.ExtractPages(); err != nil {
+	events, err := newEventLog(*eventsFormat, os.Stderr)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	var idem *idempotentRun
+	if *idempotencyKey != "" {
+		if idem, err = newIdempotentRun(*idempotencyKey, extractor.PDFFile, extractor.OutputDir); err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+		if err := os.MkdirAll(idem.dir, 0755); err != nil {
+			log.Fatalf("Error creating output directory: %v", err)
+		}
+		extractor.OutputDir = idem.dir
+	}
+	if !remote {
+		// Held until the run's last write, after extraction; a run
+		// with the same idempotency key that waits for it then finds it
+		// completed.
+		unlock, err := pdfripper.LockDir(context.Background(), extractor.OutputDir, *waitForLock)
+		var locked *pdfripper.LockedError
+		if errors.As(err, &locked) {
+			log.Fatalf("Error: %v (use -wait-for-lock to wait for it)", err)
+		} else if err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+		defer unlock()
+		extractor.SkipOutputLock = true
+	}
+	if idem != nil {
+		done, err := idem.completed()
+		if err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+		if done {
+			fmt.Printf("Idempotency key %q completed at %s; output is in %s\n", idem.key, idem.done.Completed.Format(time.RFC3339), idem.dir)
+			if events != nil {
+				events.reused(idem.dir)
+			}
+			return
+		}
+	}
+	var up *uploader
+	if remote {
+		staging, err := os.MkdirTemp(tempDir, "pdfripper-output-")
+		if err != nil {
+			log.Fatalf("Error creating staging directory: %v", err)
+		}
+		dest, err := openRemote(*outputDir, staging)
+		if err != nil {
+			os.RemoveAll(staging)
+			log.Fatalf("Error: %v", err)
+		}
+		extractor.OutputDir = staging
+		up = newUploader(dest, staging)
+	}
+	// The documents rewritten before extraction are written to the output,
+	// except with -sanitize: each is a whole copy of the document, its text,
+	// metadata and identity untouched.
+	rewritten := extractor.OutputDir
+	if batch.sanitize && (*revision > 0 || *repair || len(rotate.specs) > 0 || *reorder != "" || *splitSpreads || *booklet) {
+		if rewritten, err = os.MkdirTemp(tempDir, "pdfripper-rewritten-"); err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+		defer os.RemoveAll(rewritten)
+	}
+	if *revision > 0 {
+		earlier := filepath.Join(rewritten, fmt.Sprintf("revision_%d.pdf", *revision))
+		if err := pdfripper.WriteRevision(extractor.PDFFile, earlier, *revision); err != nil {
+			if up != nil {
+				up.finish(err)
+			}
+			log.Fatalf("Error: %v", err)
+		}
+		fmt.Printf("Wrote revision %d of the document to %s\n", *revision, earlier)
+		extractor.PDFFile = earlier
+	}
+	if *repair {
+		repaired := filepath.Join(rewritten, "repaired.pdf")
+		damaged, err := pdfripper.RepairPDF(extractor.PDFFile, repaired)
+		if err != nil {
+			if up != nil {
+				up.finish(err)
+			}
+			log.Fatalf("Error repairing the document: %v", err)
+		}
+		if damaged {
+			fmt.Printf("Rebuilt the damaged cross-reference table into %s\n", repaired)
+		} else {
+			fmt.Printf("Rewrote the document, whose cross-reference table was intact, to %s\n", repaired)
+		}
+		extractor.PDFFile = repaired
+	}
+	if len(rotate.specs) > 0 || *reorder != "" {
+		t := rotate.t
+		if *reorder != "" {
+			if t.Order, err = pdfripper.ParsePageList(*reorder); err != nil {
+				log.Fatalf("Error: -reorder: %v", err)
+			}
+		}
+		corrected := filepath.Join(rewritten, "corrected.pdf")
+		if err := pdfripper.TransformPDF(extractor.PDFFile, corrected, t); err != nil {
+			if up != nil {
+				up.finish(err)
+			}
+			log.Fatalf("Error transforming pages: %v", err)
+		}
+		fmt.Printf("Wrote the reordered and rotated document to %s\n", corrected)
+		extractor.PDFFile = corrected
+	}
+	if *splitSpreads || *booklet {
+		renderer, _ := extractor.Backend.(pdfripper.Renderer)
+		spreads, err := pdfripper.DetectSpreads(extractor.PDFFile, renderer)
+		corrected := filepath.Join(rewritten, "corrected.pdf")
+		switch {
+		case err == nil && len(spreads) == 0 && !*booklet:
+			fmt.Println("No two-up pages found")
+		case err == nil:
+			err = pdfripper.SplitSpreads(extractor.PDFFile, corrected, spreads, *booklet)
+		}
+		if err != nil {
+			if up != nil {
+				up.finish(err)
+			}
+			log.Fatalf("Error splitting two-up pages: %v", err)
+		}
+		switch {
+		case *booklet:
+			fmt.Printf("Cut the booklet's sheets into pages in reading order in %s\n", corrected)
+		case len(spreads) > 0:
+			fmt.Printf("Split %d two-up pages into %s\n", len(spreads), corrected)
+		}
+		if len(spreads) > 0 || *booklet {
+			extractor.PDFFile = corrected
+		}
+	}
+	var invoice *pdfripper.Invoices
+	if *invoices {
+		invoice = pdfripper.NewInvoices(extractor.PDFFile)
+		invoice.Normalize = *normalize
+		extractor.PostProcessors = append(extractor.PostProcessors, invoice.PostProcess)
+	}
+	if events != nil {
+		where := extractor.OutputDir
+		if remote {
+			where = redactURL(*outputDir)
+		}
+		events.started(extractor, where)
+	}
+	if *heartbeat > 0 {
+		extractor.HeartbeatInterval = *heartbeat
+		extractor.Heartbeat = func(h pdfripper.Heartbeat) {
+			printHeartbeat(h)
+			if events != nil {
+				events.heartbeat(h)
+			}
+		}
+	}
+	extractor.PageDone = func(r *pdfripper.PageResult) {
+		if events != nil {
+			events.page(r)
+		}
+		if up != nil {
+			up.page(r)
+		}
+	}
+	err = extractor.ExtractPages()
+	if err == nil && invoice != nil {
+		if err = invoice.WriteFile(filepath.Join(extractor.OutputDir, "invoice.json")); err != nil {
+			err = fmt.Errorf("writing invoice fields: %w", err)
+		}
+	}
+	if up != nil {
+		if uerr := up.finish(err); err == nil && uerr != nil {
+			err = fmt.Errorf("delivering output: %w", uerr)
+		}
+	}
+	if err == nil && idem != nil {
+		if err = idem.complete(); err != nil {
+			err = fmt.Errorf("recording completion: %w", err)
+		}
+	}
+	if events != nil {
+		events.finished(err)
+	}
+	where := extractor.OutputDir
+	if remote {
+		where = redactURL(*outputDir)
+	}
+	batch.notify.done(*inputFile, where, err)
+	if err != nil {
+		var active *pdfripper.ActiveContentError
+		if errors.As(err, &active) {
+			for _, f := range active.Report.Findings {
+				log.Printf("Found %s", f)
+			}
+		}
+		var notPDF *pdfripper.NotPDFError
+		if errors.As(err, &notPDF) && (notPDF.Type == pdfripper.MediaHTML || notPDF.Type == pdfripper.MediaText) {
+			log.Printf("Set -accept-nonpdf to extract its text")
+		}
 		log.Fatalf("Error extracting pages: %v", err)
 	}
 
+	if remote {
+		fmt.Printf("Uploaded output to %s\n", redactURL(*outputDir))
+	}
 	fmt.Println("Extraction complete.")
 }
+
+// withVerticalText configures b's handling of vertical text. Backends that
+// cannot be configured accept only the default mode, which leaves vertical
+// text to them.
+func withVerticalText(b pdfripper.Backend, mode string) (pdfripper.Backend, error) {
+	if !slices.Contains(pdfripper.VerticalTextModes, mode) {
+		return nil, fmt.Errorf("unknown vertical text mode %q (available: %s)", mode, strings.Join(pdfripper.VerticalTextModes, ", "))
+	}
+	v, ok := b.(pdfripper.VerticalTexter)
+	if !ok {
+		if mode != pdfripper.VerticalAuto {
+			return nil, fmt.Errorf("backend %s does not support -vertical-text %s", b.Name(), mode)
+		}
+		return b, nil
+	}
+	return v.WithVerticalText(mode), nil
+}
+
+// printHeartbeat prints a heartbeat as one progress line, such as
+// "Heartbeat: 120/3000 pages done, about 1h12m left; in flight: 121 ocr
+// 2m10s (slow), 122 extract 4s".
+func printHeartbeat(h pdfripper.Heartbeat) {
+	pages := make([]string, len(h.InFlight))
+	for i, p := range h.InFlight {
+		pages[i] = fmt.Sprintf("%d %s %s", p.Page, p.Stage, p.Elapsed.Round(time.Second))
+		if p.Slow {
+			pages[i] += " (slow)"
+		}
+	}
+	if len(pages) == 0 {
+		pages = []string{"none"}
+	}
+	eta := ""
+	if h.ETA > 0 {
+		eta = fmt.Sprintf(", about %s left", h.ETA.Round(time.Second))
+	}
+	fmt.Printf("Heartbeat: %d/%d pages done%s; in flight: %s\n", h.Done, h.Total, eta, strings.Join(pages, ", "))
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/thnkr-one/pdfripper/pdfripper"
+)
+
+// runMerge implements "pdfripper merge out.pdf a.pdf b.pdf...": it writes
+// the pages of the inputs, in order, to out.pdf, natively or with
+// poppler's pdfunite.
+func runMerge(args []string) {
+	fs := flag.NewFlagSet("merge", flag.ExitOnError)
+	tool := fs.String("tool", "native", "How to merge: native, or pdfunite from poppler, which also keeps outlines")
+	auditLogFlag(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: pdfripper merge [-tool native|pdfunite] [-audit-log FILE] out.pdf a.pdf b.pdf...")
+		fs.PrintDefaults()
+	}
+	if !parseFlags(fs, args) {
+		return
+	}
+	if fs.NArg() < 2 {
+		fs.Usage()
+		os.Exit(1)
+	}
+	out, inputs := fs.Arg(0), fs.Args()[1:]
+	for _, in := range inputs {
+		if same, _ := sameFile(out, in); same {
+			log.Fatalf("Error: output %s is also an input", out)
+		}
+	}
+
+	var err error
+	switch *tool {
+	case "native":
+		err = pdfripper.MergePDFs(out, inputs...)
+	case "pdfunite":
+		err = pdfunite(out, inputs)
+	default:
+		log.Fatalf("Error: unknown -tool %q (available: native, pdfunite)", *tool)
+	}
+	if err != nil {
+		log.Fatalf("Error merging: %v", err)
+	}
+	fmt.Printf("Merged %d documents into %s\n", len(inputs), out)
+}
+
+// sameFile reports whether a and b name the same existing file.
+func sameFile(a, b string) (bool, error) {
+	ai, err := os.Stat(a)
+	if err != nil {
+		return false, err
+	}
+	bi, err := os.Stat(b)
+	if err != nil {
+		return false, err
+	}
+	return os.SameFile(ai, bi), nil
+}
+
+// absPaths makes paths absolute, as the commands pdfripper runs need.
+func absPaths(paths ...string) ([]string, error) {
+	abs := make([]string, len(paths))
+	for i, p := range paths {
+		var err error
+		if abs[i], err = filepath.Abs(p); err != nil {
+			return nil, err
+		}
+	}
+	return abs, nil
+}
@@ -0,0 +1,15 @@
+//go:build !noexec && !js && !wasip1
+
+package main
+
+import "github.com/thnkr-one/pdfripper/pdfripper"
+
+// pdfunite merges inputs into out with poppler's pdfunite.
+func pdfunite(out string, inputs []string) error {
+	args, err := absPaths(append(inputs, out)...)
+	if err != nil {
+		return err
+	}
+	_, err = pdfripper.ExecRunner{}.Run(pdfripper.Sandbox{}, nil, "pdfunite", args...)
+	return err
+}
@@ -0,0 +1,10 @@
+//go:build noexec || js || wasip1
+
+package main
+
+import "errors"
+
+// pdfunite would start a pdfunite process, which this build leaves out.
+func pdfunite(out string, inputs []string) error {
+	return errors.New("pdfunite is not available in builds without subprocess support")
+}
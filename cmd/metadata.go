@@ -0,0 +1,62 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/thnkr-one/pdfripper/pdfripper"
+)
+
+// runMetadata implements "pdfripper metadata": it lists the Info entries
+// and XMP properties of a document and the manifest fields they give,
+// for writing a -metadata-map.
+func runMetadata(args []string) {
+	fs := flag.NewFlagSet("metadata", flag.ExitOnError)
+	inputFile := fs.String("input", "", "Input PDF file path (required)")
+	passwordFlag(fs)
+	metadataMap := fs.String("metadata-map", "", "File mapping document properties to manifest fields, as the extraction flag takes it")
+	if !parseFlags(fs, args) {
+		return
+	}
+	if *inputFile == "" {
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	var mapping pdfripper.MetadataMapping
+	if *metadataMap != "" {
+		var err error
+		if mapping, err = pdfripper.LoadMetadataMap(*metadataMap); err != nil {
+			log.Fatalf("Error loading metadata map: %v", err)
+		}
+	}
+	m, err := pdfripper.Metadata(*inputFile)
+	if err != nil {
+		log.Fatalf("Error reading metadata: %v", err)
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "SOURCE\tPROPERTY\tVALUE")
+	for _, source := range []struct {
+		name  string
+		props map[string]string
+	}{{"info", m.Info}, {"xmp", m.XMP}, {"manifest", m.Fields(mapping)}} {
+		for _, key := range sortedKeys(source.props) {
+			fmt.Fprintf(tw, "%s\t%s\t%q\n", source.name, key, source.props[key])
+		}
+	}
+	tw.Flush()
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
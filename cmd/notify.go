@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// notification is what a notifier tells of a finished run.
+type notification struct {
+	input   string // The document or batch, as given.
+	output  string
+	elapsed time.Duration
+	err     error
+}
+
+// message returns the one line notifiers show.
+func (n notification) message() string {
+	elapsed := n.elapsed.Round(time.Second)
+	if n.err != nil {
+		return fmt.Sprintf("pdfripper failed on %s after %s: %v", n.input, elapsed, n.err)
+	}
+	return fmt.Sprintf("pdfripper finished %s in %s; output is in %s", n.input, elapsed, n.output)
+}
+
+type notifier interface {
+	notify(n notification) error
+}
+
+// notifyFlag collects -notify targets, which may be repeated: cmd:COMMAND,
+// slack:WEBHOOK_URL or desktop.
+type notifyFlag struct {
+	specs     []string
+	notifiers []notifier
+	start     time.Time
+}
+
+func (f *notifyFlag) String() string { return strings.Join(f.specs, " ") }
+
+func (f *notifyFlag) Set(s string) error {
+	var n notifier
+	switch kind, arg, _ := strings.Cut(s, ":"); {
+	case s == "desktop":
+		n = desktopNotifier{}
+	case kind == "cmd":
+		args := strings.Fields(arg)
+		if len(args) == 0 {
+			return errors.New("cmd: needs a command, such as cmd:notify.sh")
+		}
+		n = commandNotifier{args: args}
+	case kind == "slack":
+		if err := validateCallbackURL(arg); err != nil {
+			return errors.New("slack: needs the absolute https URL of an incoming webhook")
+		}
+		n = slackNotifier{url: arg}
+	default:
+		return fmt.Errorf("%q is not cmd:COMMAND, slack:WEBHOOK_URL or desktop", s)
+	}
+	if err := checkNotifier(n); err != nil {
+		return err
+	}
+	f.specs = append(f.specs, s)
+	f.notifiers = append(f.notifiers, n)
+	f.start = time.Now()
+	return nil
+}
+
+// done notifies every target that the run over input, writing to output,
+// ended with err. Failures to notify are only logged.
+func (f *notifyFlag) done(input, output string, err error) {
+	n := notification{input: input, output: output, elapsed: time.Since(f.start), err: err}
+	for i, t := range f.notifiers {
+		if nerr := t.notify(n); nerr != nil {
+			// Only the kind, as a webhook's URL is its secret.
+			kind, _, _ := strings.Cut(f.specs[i], ":")
+			log.Printf("Warning: -notify %s: %v", kind, nerr)
+		}
+	}
+}
+
+// slackNotifier posts to a Slack incoming webhook.
+type slackNotifier struct {
+	url string
+}
+
+func (s slackNotifier) notify(n notification) error {
+	body, err := json.Marshal(map[string]string{"text": n.message()})
+	if err != nil {
+		return err
+	}
+	err = sendCallback(webhookClient, s.url, "", body)
+	var uerr *url.Error
+	if errors.As(err, &uerr) {
+		// Without the URL, which is the webhook's secret.
+		return uerr.Err
+	}
+	return err
+}
@@ -0,0 +1,89 @@
+//go:build !noexec && !js && !wasip1
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"time"
+)
+
+// notifyTimeout bounds a notification command.
+const notifyTimeout = 30 * time.Second
+
+// checkNotifier reports notifiers this build cannot use.
+func checkNotifier(n notifier) error {
+	return nil
+}
+
+// commandNotifier runs a command with the message as its last argument and
+// the details in PDFRIPPER_NOTIFY_* variables of its environment.
+type commandNotifier struct {
+	args []string
+}
+
+func (c commandNotifier) notify(n notification) error {
+	status, errText := "done", ""
+	if n.err != nil {
+		status, errText = "failed", n.err.Error()
+	}
+	env := []string{
+		"PDFRIPPER_NOTIFY_STATUS=" + status,
+		"PDFRIPPER_NOTIFY_INPUT=" + n.input,
+		"PDFRIPPER_NOTIFY_OUTPUT=" + n.output,
+		"PDFRIPPER_NOTIFY_SECONDS=" + strconv.FormatFloat(n.elapsed.Seconds(), 'f', 0, 64),
+		"PDFRIPPER_NOTIFY_ERROR=" + errText,
+		"PDFRIPPER_NOTIFY_MESSAGE=" + n.message(),
+	}
+	return runNotifyCommand(env, c.args[0], append(c.args[1:], n.message())...)
+}
+
+// desktopNotifier shows a notification on the desktop: with notify-send
+// on Linux and other Unix systems, osascript on macOS and PowerShell on
+// Windows.
+type desktopNotifier struct{}
+
+// windowsBalloon shows $env:PDFRIPPER_NOTIFY_MESSAGE as a balloon of the
+// notification area, which stays up while the script runs.
+const windowsBalloon = `Add-Type -AssemblyName System.Windows.Forms, System.Drawing
+$n = New-Object System.Windows.Forms.NotifyIcon
+$n.Icon = [System.Drawing.SystemIcons]::Information
+$n.Visible = $true
+$n.ShowBalloonTip(10000, 'pdfripper', $env:PDFRIPPER_NOTIFY_MESSAGE, 'Info')
+Start-Sleep -Seconds 10
+$n.Dispose()`
+
+func (desktopNotifier) notify(n notification) error {
+	msg := n.message()
+	env := []string{"PDFRIPPER_NOTIFY_MESSAGE=" + msg}
+	switch runtime.GOOS {
+	case "darwin":
+		return runNotifyCommand(env, "osascript", "-e", "on run argv", "-e", `display notification (item 1 of argv) with title "pdfripper"`, "-e", "end run", msg)
+	case "windows":
+		return runNotifyCommand(env, "powershell", "-NoProfile", "-NonInteractive", "-Command", windowsBalloon)
+	}
+	urgency := "normal"
+	if n.err != nil {
+		urgency = "critical"
+	}
+	return runNotifyCommand(env, "notify-send", "--urgency="+urgency, "pdfripper", msg)
+}
+
+// runNotifyCommand runs name with args and env added to the environment,
+// giving up after notifyTimeout.
+func runNotifyCommand(env []string, name string, args ...string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), notifyTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Env = append(os.Environ(), env...)
+	cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+	err := runAudited(cmd, cmd.Run)
+	if ctx.Err() != nil {
+		return fmt.Errorf("%s timed out after %s", name, notifyTimeout)
+	}
+	return err
+}
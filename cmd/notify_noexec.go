@@ -0,0 +1,25 @@
+//go:build noexec || js || wasip1
+
+package main
+
+import "errors"
+
+// checkNotifier reports notifiers this build cannot use: those running
+// other programs.
+func checkNotifier(n notifier) error {
+	switch n.(type) {
+	case commandNotifier, desktopNotifier:
+		return errors.New("cmd: and desktop run other programs, which this build leaves out")
+	}
+	return nil
+}
+
+type commandNotifier struct {
+	args []string
+}
+
+func (commandNotifier) notify(n notification) error { return nil }
+
+type desktopNotifier struct{}
+
+func (desktopNotifier) notify(n notification) error { return nil }
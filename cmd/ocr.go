@@ -0,0 +1,37 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/thnkr-one/pdfripper/pdfripper"
+)
+
+// ocrEngines are the values accepted by -ocr.
+const ocrEngines = "tesseract, http, google-vision, azure-read"
+
+// newOCREngine returns the OCR engine selected with -ocr. url and key are
+// the endpoint and credentials of the remote engines, and affinity, if not
+// nil, pins tesseract processes to CPUs.
+func newOCREngine(name, lang, url, key string, affinity *pdfripper.CPUAffinity) (pdfripper.OCREngine, error) {
+	switch name {
+	case "tesseract":
+		return newTesseract(lang, affinity)
+	case "http":
+		if url == "" {
+			return nil, errors.New("-ocr http needs -ocr-url")
+		}
+		return &pdfripper.HTTPOCR{URL: url, Language: lang, Token: key}, nil
+	case "google-vision":
+		if key == "" {
+			return nil, errors.New("-ocr google-vision needs an API key (-ocr-key or PDFRIPPER_OCR_KEY)")
+		}
+		return &pdfripper.GoogleVision{APIKey: key, Language: lang, Endpoint: url}, nil
+	case "azure-read":
+		if url == "" || key == "" {
+			return nil, errors.New("-ocr azure-read needs -ocr-url (the resource endpoint) and a key (-ocr-key or PDFRIPPER_OCR_KEY)")
+		}
+		return &pdfripper.AzureRead{Endpoint: url, Key: key, Language: lang}, nil
+	}
+	return nil, fmt.Errorf("unknown OCR engine %q (available: %s)", name, ocrEngines)
+}
@@ -0,0 +1,31 @@
+//go:build !noexec && !js && !wasip1
+
+package main
+
+import (
+	"os"
+	"time"
+
+	"github.com/thnkr-one/pdfripper/pdfripper"
+)
+
+// officeTimeout bounds the conversion of an office document, as soffice
+// can hang on documents it cannot open.
+const officeTimeout = 10 * time.Minute
+
+// convertOffice converts an office document to a PDF in a temporary
+// directory with the LibreOffice command soffice. The returned function
+// removes the directory.
+func convertOffice(file, soffice string) (string, func(), error) {
+	dir, err := os.MkdirTemp(tempDir, "pdfripper-office-")
+	if err != nil {
+		return "", nil, err
+	}
+	conv := &pdfripper.LibreOffice{Command: soffice, Sandbox: pdfripper.Sandbox{Timeout: officeTimeout, TempDir: tempDir}}
+	pdf, err := conv.ConvertToPDF(file, dir)
+	if err != nil {
+		os.RemoveAll(dir)
+		return "", nil, err
+	}
+	return pdf, func() { os.RemoveAll(dir) }, nil
+}
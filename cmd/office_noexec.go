@@ -0,0 +1,10 @@
+//go:build noexec || js || wasip1
+
+package main
+
+import "errors"
+
+// convertOffice would start a soffice process, which this build leaves out.
+func convertOffice(file, soffice string) (string, func(), error) {
+	return "", nil, errors.New("office documents are not available in builds without subprocess support")
+}
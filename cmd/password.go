@@ -0,0 +1,21 @@
+package main
+
+import (
+	"flag"
+
+	"github.com/thnkr-one/pdfripper/pdfripper"
+)
+
+// passwordFlag registers -password on fs, which parseFlags hands to
+// pdfripper.SetPassword.
+func passwordFlag(fs *flag.FlagSet) *string {
+	return fs.String("password", "", "User password of an encrypted input, which it opens with; best set as $"+envName("password")+", which other users cannot see (default: only inputs whose user password is empty open)")
+}
+
+// setPassword sets the password of encrypted inputs given with -password
+// on fs, if fs has the flag.
+func setPassword(fs *flag.FlagSet) {
+	if f := fs.Lookup("password"); f != nil {
+		pdfripper.SetPassword(f.Value.String())
+	}
+}
@@ -0,0 +1,123 @@
+//go:build !noexec && !js && !wasip1
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/thnkr-one/pdfripper/pdfripper"
+)
+
+// pgvectorStore upserts chunks into a PostgreSQL table with a pgvector
+// column by running psql, so that the connection's password, certificates
+// and services come from libpq's configuration, as sftp's come from ssh's.
+// The table is created, with the extension, if it does not exist:
+//
+//	id uuid PRIMARY KEY, document text, chunk integer, first_page integer,
+//	last_page integer, tokens integer, text text, metadata jsonb,
+//	embedding vector(N)
+type pgvectorStore struct {
+	conn  string // libpq connection URI, without a password.
+	table string // Quoted, with its schema if it has one.
+
+	mu      sync.Mutex
+	created bool
+}
+
+func newPgvectorStore(conn, table string) (pdfripper.VectorStore, error) {
+	var parts []string
+	for _, p := range strings.Split(table, ".") {
+		if p == "" {
+			return nil, fmt.Errorf("pgvector table %q has an empty name", table)
+		}
+		parts = append(parts, `"`+strings.ReplaceAll(p, `"`, `""`)+`"`)
+	}
+	return &pgvectorStore{conn: conn, table: strings.Join(parts, ".")}, nil
+}
+
+// psql runs SQL, and psql commands, stopping at the first error.
+func (s *pgvectorStore) psql(ctx context.Context, sql string) error {
+	cmd := exec.CommandContext(ctx, "psql", "-X", "-q", "-v", "ON_ERROR_STOP=1", "-f", "-", "-d", s.conn)
+	cmd.Stdin = strings.NewReader("SET standard_conforming_strings = on;\n" + sql)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := runAudited(cmd, cmd.Run); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return fmt.Errorf("psql: %w: %s", err, msg)
+		}
+		return fmt.Errorf("psql: %w", err)
+	}
+	return nil
+}
+
+func (s *pgvectorStore) DeleteDocument(ctx context.Context, document string) error {
+	return s.psql(ctx, fmt.Sprintf("SELECT to_regclass(%s) IS NOT NULL AS table_exists \\gset\n\\if :table_exists\nDELETE FROM %s WHERE document = %s;\n\\endif\n",
+		sqlString(s.table), s.table, sqlString(document)))
+}
+
+func (s *pgvectorStore) Upsert(ctx context.Context, chunks []pdfripper.VectorChunk) error {
+	if len(chunks) == 0 {
+		return nil
+	}
+	var b strings.Builder
+	// Until an upsert has created the table, the others wait for it, and
+	// one that fails leaves the next to try again.
+	s.mu.Lock()
+	create := !s.created
+	if create {
+		defer s.mu.Unlock()
+		fmt.Fprintf(&b, "CREATE EXTENSION IF NOT EXISTS vector;\n"+
+			"CREATE TABLE IF NOT EXISTS %s (id uuid PRIMARY KEY, document text NOT NULL, chunk integer NOT NULL, "+
+			"first_page integer NOT NULL, last_page integer NOT NULL, tokens integer, text text NOT NULL, metadata jsonb, "+
+			"embedding vector(%d) NOT NULL);\n", s.table, len(chunks[0].Vector))
+	} else {
+		s.mu.Unlock()
+	}
+	fmt.Fprintf(&b, "INSERT INTO %s (id, document, chunk, first_page, last_page, tokens, text, metadata, embedding) VALUES\n", s.table)
+	for i, c := range chunks {
+		tokens, metadata := "NULL", "NULL"
+		if c.Tokens > 0 {
+			tokens = strconv.Itoa(c.Tokens)
+		}
+		if len(c.Metadata) > 0 {
+			data, err := json.Marshal(c.Metadata)
+			if err != nil {
+				return err
+			}
+			metadata = sqlString(string(data)) + "::jsonb"
+		}
+		vector := make([]string, len(c.Vector))
+		for k, x := range c.Vector {
+			vector[k] = strconv.FormatFloat(float64(x), 'g', -1, 32)
+		}
+		sep := ","
+		if i == len(chunks)-1 {
+			sep = ""
+		}
+		fmt.Fprintf(&b, "(%s, %s, %d, %d, %d, %s, %s, %s, '[%s]')%s\n", sqlString(c.ID), sqlString(c.Document), c.Chunk.Chunk,
+			c.FirstPage, c.LastPage, tokens, sqlString(c.Text), metadata, strings.Join(vector, ","), sep)
+	}
+	b.WriteString("ON CONFLICT (id) DO UPDATE SET document = EXCLUDED.document, chunk = EXCLUDED.chunk, " +
+		"first_page = EXCLUDED.first_page, last_page = EXCLUDED.last_page, tokens = EXCLUDED.tokens, " +
+		"text = EXCLUDED.text, metadata = EXCLUDED.metadata, embedding = EXCLUDED.embedding;\n")
+	if err := s.psql(ctx, b.String()); err != nil {
+		return err
+	}
+	if create {
+		s.created = true
+	}
+	return nil
+}
+
+// sqlString quotes s as an SQL string literal, dropping NUL characters,
+// which PostgreSQL text cannot hold.
+func sqlString(s string) string {
+	return "'" + strings.ReplaceAll(strings.ReplaceAll(s, "\x00", ""), "'", "''") + "'"
+}
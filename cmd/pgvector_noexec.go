@@ -0,0 +1,14 @@
+//go:build noexec || js || wasip1
+
+package main
+
+import (
+	"errors"
+
+	"github.com/thnkr-one/pdfripper/pdfripper"
+)
+
+// newPgvectorStore would run psql, which this build leaves out.
+func newPgvectorStore(conn, table string) (pdfripper.VectorStore, error) {
+	return nil, errors.New("pgvector stores are not available in builds without subprocess support")
+}
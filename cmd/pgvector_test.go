@@ -0,0 +1,66 @@
+//go:build !noexec && !js && !wasip1
+
+package main
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/thnkr-one/pdfripper/pdfripper"
+)
+
+// fakePsql puts a psql command on $PATH that appends the SQL it is given
+// to the returned log, and fails while the file fail exists.
+func fakePsql(t *testing.T) (log, fail string) {
+	t.Helper()
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh is not installed")
+	}
+	dir := t.TempDir()
+	log, fail = filepath.Join(dir, "log"), filepath.Join(dir, "fail")
+	script := `#!/bin/sh
+cat >>"$LOG"
+[ -e "$FAIL" ] && { echo 'ERROR:  extension "vector" is not available' >&2; exit 3; }
+exit 0
+`
+	if err := os.WriteFile(filepath.Join(dir, "psql"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	t.Setenv("LOG", log)
+	t.Setenv("FAIL", fail)
+	return log, fail
+}
+
+func TestPgvectorStoreCreatesTable(t *testing.T) {
+	log, fail := fakePsql(t)
+	s, err := newPgvectorStore("postgres://db/rag", "docs.chunks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	chunks := []pdfripper.VectorChunk{{ID: "6f1c2d4e-0000-5000-8000-000000000001", Document: "a.pdf", Vector: []float32{0.5, 1}}}
+	ctx := context.Background()
+
+	// A table that could not be created is tried again by the next upsert.
+	os.WriteFile(fail, nil, 0644)
+	if err := s.Upsert(ctx, chunks); err == nil || !strings.Contains(err.Error(), `extension "vector" is not available`) {
+		t.Errorf("got error %v, want psql's", err)
+	}
+	os.Remove(fail)
+	for i := 0; i < 2; i++ {
+		if err := s.Upsert(ctx, chunks); err != nil {
+			t.Fatal(err)
+		}
+	}
+	sql := readLog(t, log)
+	if n := strings.Count(sql, `CREATE TABLE IF NOT EXISTS "docs"."chunks"`); n != 2 {
+		t.Errorf("created the table %d times, want 2:\n%s", n, sql)
+	}
+	if n := strings.Count(sql, `INSERT INTO "docs"."chunks"`); n != 3 {
+		t.Errorf("inserted %d times, want 3", n)
+	}
+}
@@ -0,0 +1,148 @@
+//go:build !noexec && !js && !wasip1
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+
+	"github.com/thnkr-one/pdfripper/pdfripper"
+)
+
+// poolEnv tells the run of a document of a batch with -shared-workers
+// that its slots of the batch's pool are requested and granted over the
+// pipes on file descriptors 3 and 4.
+const poolEnv = "PDFRIPPER_SHARED_POOL"
+
+// Bytes of the pool protocol: a run writes poolAcquire and reads a
+// poolGrant for each slot it takes, and writes poolRelease to give it back.
+const (
+	poolAcquire = 'a'
+	poolGrant   = 'g'
+	poolRelease = 'r'
+)
+
+// sharePool starts cmd, a run of a document, as a user of pool: it serves
+// the run's requests for slots of pool until the run exits, and gives back
+// any slots it still holds then. The pipes are closed once cmd has started.
+func sharePool(cmd *exec.Cmd, pool pdfripper.WorkPool) (wait func() error, err error) {
+	reqR, reqW, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	grantR, grantW, err := os.Pipe()
+	if err != nil {
+		reqR.Close()
+		reqW.Close()
+		return nil, err
+	}
+	cmd.ExtraFiles = []*os.File{reqW, grantR}
+	cmd.Env = append(withoutEnv(os.Environ(), poolEnv), poolEnv+"=1")
+	err = cmd.Start()
+	reqW.Close()
+	grantR.Close()
+	if err != nil {
+		reqR.Close()
+		grantW.Close()
+		return nil, err
+	}
+
+	var (
+		mu     sync.Mutex
+		held   int
+		done   bool
+		served = make(chan struct{})
+	)
+	go func() {
+		defer close(served)
+		buf := make([]byte, 64)
+		for {
+			n, err := reqR.Read(buf)
+			for _, b := range buf[:n] {
+				switch b {
+				case poolAcquire:
+					go func() {
+						pool.Acquire()
+						mu.Lock()
+						defer mu.Unlock()
+						if done {
+							pool.Release()
+							return
+						}
+						held++
+						grantW.Write([]byte{poolGrant})
+					}()
+				case poolRelease:
+					mu.Lock()
+					if held > 0 {
+						held--
+						pool.Release()
+					}
+					mu.Unlock()
+				}
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+	return func() error {
+		err := cmd.Wait()
+		<-served
+		reqR.Close()
+		mu.Lock()
+		done = true
+		for ; held > 0; held-- {
+			pool.Release()
+		}
+		grantW.Close()
+		mu.Unlock()
+		return err
+	}, nil
+}
+
+// withoutEnv returns env less the variable name.
+func withoutEnv(env []string, name string) []string {
+	out := make([]string, 0, len(env))
+	for _, kv := range env {
+		if !strings.HasPrefix(kv, name+"=") {
+			out = append(out, kv)
+		}
+	}
+	return out
+}
+
+// sharedPool returns the pool of the batch the run is a document of, if
+// it was started by sharePool, and nil otherwise.
+func sharedPool() pdfripper.WorkPool {
+	if os.Getenv(poolEnv) == "" {
+		return nil
+	}
+	os.Unsetenv(poolEnv)
+	return &pipePool{req: os.NewFile(3, "pool-requests"), grant: os.NewFile(4, "pool-grants")}
+}
+
+// pipePool is the WorkPool of a run started by sharePool. If the pipes
+// break, the run goes on without the pool.
+type pipePool struct {
+	req, grant *os.File
+	lost       sync.Once
+}
+
+func (p *pipePool) Acquire() {
+	if _, err := p.req.Write([]byte{poolAcquire}); err != nil {
+		return
+	}
+	var b [1]byte
+	if _, err := io.ReadFull(p.grant, b[:]); err != nil {
+		p.lost.Do(func() { fmt.Fprintf(os.Stderr, "Warning: lost the batch's shared workers: %v\n", err) })
+	}
+}
+
+func (p *pipePool) Release() {
+	p.req.Write([]byte{poolRelease})
+}
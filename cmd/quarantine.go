@@ -0,0 +1,124 @@
+//go:build !noexec && !js && !wasip1
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// quarantineDir is the directory inside -output that documents of a batch
+// run that fail are put in, with what went wrong.
+const quarantineDir = "failed"
+
+// quarantineRecord is the error.json next to a quarantined document.
+type quarantineRecord struct {
+	Source string    `json:"source"`         // The document as listed.
+	File   string    `json:"file,omitempty"` // Its file name in the quarantine directory; empty if it could not be downloaded.
+	Error  string    `json:"error"`
+	Output string    `json:"output"` // Where it was being extracted to, which may hold part of its output.
+	Time   time.Time `json:"time"`
+}
+
+// quarantine copies or moves the documents of a batch run that fail into
+// quarantineDir/NAME, NAME being the name of their output, each with an
+// error.json saying why.
+type quarantine struct {
+	dir  string
+	move bool
+}
+
+// keep quarantines the listed document in, whose file is at local, or
+// nowhere if local is empty, after its run failed with err.
+func (q *quarantine) keep(in listedInput, local string, err error) error {
+	dir := filepath.Join(q.dir, filepath.FromSlash(in.name))
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	rec := quarantineRecord{Source: in.source, Error: err.Error(), Output: redactURL(in.output), Time: time.Now().UTC()}
+	if local != "" {
+		rec.File = filepath.Base(local)
+		dest := filepath.Join(dir, rec.File)
+		var err error
+		if q.move {
+			err = moveFile(local, dest)
+		} else {
+			err = copyFile(local, dest)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	data, err := json.MarshalIndent(rec, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, "error.json"), append(data, '\n'), 0644)
+}
+
+// moveFile renames src to dest, or copies it and removes src if they are
+// on different filesystems.
+func moveFile(src, dest string) error {
+	err := os.Rename(src, dest)
+	if !errors.Is(err, syscall.EXDEV) {
+		return err
+	}
+	if err := copyFile(src, dest); err != nil {
+		return err
+	}
+	return os.Remove(src)
+}
+
+func copyFile(src, dest string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(dest)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// logPrefixRe matches the date and time the log package starts lines with.
+var logPrefixRe = regexp.MustCompile(`^\d{4}/\d\d/\d\d \d\d:\d\d:\d\d `)
+
+// tailWriter keeps the last bytes written to it, to report the error a
+// run of pdfripper ended with: the last line of its standard error.
+type tailWriter struct {
+	buf []byte
+}
+
+const tailSize = 4096
+
+func (w *tailWriter) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+	if len(w.buf) > tailSize {
+		w.buf = w.buf[len(w.buf)-tailSize:]
+	}
+	return len(p), nil
+}
+
+// err returns the error of a run that failed with err, from the last line
+// it wrote.
+func (w *tailWriter) err(err error) error {
+	line := strings.TrimPrefix(logPrefixRe.ReplaceAllString(lastLine(string(w.buf)), ""), "Error: ")
+	if line != "" {
+		return fmt.Errorf("%s (%w)", line, err)
+	}
+	return err
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// recipe is a pipeline file for "pdfripper run": the input and the stages
+// of extraction, in the order they run, such as
+//
+//	input: scans/
+//	stages:
+//	  - repair
+//	  - extract: {backend: pdftotext, processes: 4}
+//	  - ocr-fallback: {engine: tesseract, threshold: 0.6}
+//	  - strip-headers
+//	  - chunk: {size: 2000, overlap: 200, tokenizer: heuristic}
+//	  - sink: {output: out/, manifest: [json]}
+type recipe struct {
+	Input  string `json:"input"`
+	Stages []any  `json:"stages"` // Names, or single-key mappings of names to their options.
+}
+
+// recipeStage is a stage recipes may have, with the extraction flags its
+// options set.
+type recipeStage struct {
+	name    string
+	flag    string            // Set to true when the stage is there, if not empty.
+	options map[string]string // Option names to flags.
+	implied map[string]string // Flags set unless an option sets them.
+}
+
+// recipeStages returns the stages of a recipe, in the order they run.
+func recipeStages() []recipeStage {
+	return []recipeStage{
+		{name: "repair", flag: "repair"},
+		{name: "split", options: map[string]string{"rules": "split"}, implied: map[string]string{"split": "blank,page-numbers"}},
+		{name: "extract", options: map[string]string{
+			"backend": "backend", "processes": "processes", "batch-size": "batch-size", "page-retries": "page-retries",
+			"diagnostics": "diagnostics", "cache": "cache", "vertical-text": "vertical-text", "max-pages": "max-pages",
+			"accept-nonpdf": "accept-nonpdf", "reject-active-content": "reject-active-content",
+		}},
+		{name: "ocr-fallback", options: map[string]string{
+			"engine": "ocr", "threshold": "ocr-threshold", "lang": "ocr-lang", "dpi": "ocr-dpi",
+			"workers": "ocr-workers", "url": "ocr-url", "merge": "ocr-merge",
+		}, implied: map[string]string{"ocr": "tesseract"}},
+		{name: "strip-headers", flag: "strip-headers"},
+		{name: "chunk", options: map[string]string{"size": "chunk-size", "overlap": "chunk-overlap", "tokenizer": "tokenizer"}, implied: map[string]string{"chunk-size": "2000"}},
+		{name: "embed", options: map[string]string{"url": "embed-url", "model": "embed-model", "store": "vector-store", "batch": "vector-batch"}},
+		{name: "summarize", options: map[string]string{"url": "summary-url", "model": "summary-model", "prompt": "summary-prompt", "chars": "summary-chars"}},
+		{name: "sink", options: map[string]string{
+			"output": "output", "combined": "combined", "manifest": "manifest-format", "page-files": "page-files", "events": "events",
+		}},
+	}
+}
+
+// runRecipe implements "pdfripper run pipeline.yaml": it runs the
+// extraction the recipe describes, as plain pdfripper with the flags its
+// stages set. Flags after the recipe are added to those, and take
+// precedence.
+func runRecipe(args []string) {
+	fs := flag.NewFlagSet("run", flag.ExitOnError)
+	dryRun := fs.Bool("dry-run", false, "Print the pdfripper command the recipe runs instead of running it")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: pdfripper run [-dry-run] RECIPE.yaml [extraction flags]")
+		fmt.Fprintln(fs.Output(), "\nA recipe lists an input and stages, in this order, each once at most:")
+		for _, st := range recipeStages() {
+			fmt.Fprintln(fs.Output(), strings.TrimRight(fmt.Sprintf("  %-14s%s", st.name, strings.Join(sortedKeys(st.options), ", ")), " "))
+		}
+		fmt.Fprintln(fs.Output(), "\nFlags:")
+		fs.PrintDefaults()
+	}
+	if !parseFlags(fs, args) {
+		return
+	}
+	if fs.NArg() < 1 {
+		fs.Usage()
+		os.Exit(1)
+	}
+	data, err := os.ReadFile(fs.Arg(0))
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	extract, err := recipeArgs(fs.Arg(0), data)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	extract = append(extract, fs.Args()[1:]...)
+	if *dryRun {
+		quoted := []string{"pdfripper"}
+		for _, a := range extract {
+			quoted = append(quoted, shellQuote(a))
+		}
+		fmt.Println(strings.Join(quoted, " "))
+		return
+	}
+	runExtract(extract)
+}
+
+// recipeArgs returns the extraction flags of the recipe in data, read from
+// file.
+func recipeArgs(file string, data []byte) ([]string, error) {
+	doc, err := parseYAML(file, data)
+	if err != nil {
+		return nil, err
+	}
+	// Going through JSON checks the recipe's shape and catches misspelt
+	// keys.
+	js, err := json.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+	var r recipe
+	dec := json.NewDecoder(bytes.NewReader(js))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&r); err != nil {
+		return nil, fmt.Errorf("%s: %v", file, err)
+	}
+	if len(r.Stages) == 0 {
+		return nil, fmt.Errorf("%s: no stages", file)
+	}
+
+	var args []string
+	if r.Input != "" {
+		args = append(args, "-input", r.Input)
+	}
+	stages := recipeStages()
+	next := 0
+	for _, s := range r.Stages {
+		name, options, err := stageOptions(s)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", file, err)
+		}
+		i := 0
+		for i < len(stages) && stages[i].name != name {
+			i++
+		}
+		switch {
+		case i == len(stages):
+			var names []string
+			for _, st := range stages {
+				names = append(names, st.name)
+			}
+			return nil, fmt.Errorf("%s: unknown stage %q (available: %s)", file, name, strings.Join(names, ", "))
+		case i == next-1:
+			return nil, fmt.Errorf("%s: stage %s appears twice", file, name)
+		case i < next:
+			return nil, fmt.Errorf("%s: stage %s must come before %s", file, name, stages[next-1].name)
+		}
+		next = i + 1
+		st := stages[i]
+		if st.flag != "" {
+			args = append(args, "-"+st.flag)
+		}
+		set := map[string]bool{}
+		for _, opt := range sortedKeys(options) {
+			f, ok := st.options[opt]
+			if !ok {
+				return nil, fmt.Errorf("%s: stage %s has no option %q (available: %s)", file, name, opt, strings.Join(sortedKeys(st.options), ", "))
+			}
+			v, err := recipeValue(options[opt])
+			if err != nil {
+				return nil, fmt.Errorf("%s: %s %s: %v", file, name, opt, err)
+			}
+			args = append(args, "-"+f+"="+v)
+			set[f] = true
+		}
+		for _, f := range sortedKeys(st.implied) {
+			if !set[f] {
+				args = append(args, "-"+f+"="+st.implied[f])
+			}
+		}
+	}
+	return args, nil
+}
+
+// stageOptions returns the name and options of a stage of a recipe, which
+// is a name or a mapping of its name to its options.
+func stageOptions(s any) (string, map[string]any, error) {
+	switch s := s.(type) {
+	case string:
+		return s, nil, nil
+	case map[string]any:
+		if len(s) != 1 {
+			return "", nil, fmt.Errorf("a stage must be a name, or a name with options, not %d names", len(s))
+		}
+		for name, v := range s {
+			switch v := v.(type) {
+			case nil:
+				return name, nil, nil
+			case map[string]any:
+				return name, v, nil
+			}
+			return "", nil, fmt.Errorf("options of stage %s must be a mapping", name)
+		}
+	}
+	return "", nil, fmt.Errorf("a stage must be a name, or a name with options, not %v", s)
+}
+
+// recipeValue formats an option of a recipe as a flag value, lists as
+// comma-separated ones.
+func recipeValue(v any) (string, error) {
+	switch v := v.(type) {
+	case string:
+		return v, nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case []any:
+		var parts []string
+		for _, item := range v {
+			s, err := recipeValue(item)
+			if err != nil {
+				return "", err
+			}
+			parts = append(parts, s)
+		}
+		return strings.Join(parts, ","), nil
+	}
+	return "", fmt.Errorf("%v is not a string, number, boolean or list", v)
+}
+
+// shellQuote quotes s for a POSIX shell, if it needs quoting.
+func shellQuote(s string) string {
+	if s != "" && strings.Trim(s, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_=.,/:+@%") == "" {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRecipeArgs(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		recipe string
+		want   string
+	}{
+		{"every stage", `
+input: scans/
+stages:
+  - repair
+  - split
+  - extract: {backend: pdftotext, processes: 4}
+  - ocr-fallback: {threshold: 0.6}
+  - strip-headers
+  - chunk: {size: 1000, overlap: 100}
+  - sink:
+      output: out/
+      manifest: [json, csv]
+      page-files: false
+`, "-input scans/ -repair -split=blank,page-numbers -backend=pdftotext -processes=4 -ocr-threshold=0.6 -ocr=tesseract -strip-headers -chunk-overlap=100 -chunk-size=1000 -manifest-format=json,csv -output=out/ -page-files=false"},
+		{"options override what stages imply", `
+stages:
+  - split: {rules: [blank]}
+  - ocr-fallback: {engine: remote, url: "http://ocr:8080/"}
+  - chunk:
+`, "-split=blank -ocr=remote -ocr-url=http://ocr:8080/ -chunk-size=2000"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			args, err := recipeArgs("recipe.yaml", []byte(tt.recipe))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := strings.Join(args, " "); got != tt.want {
+				t.Errorf("got  %s\nwant %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRecipeArgsErrors(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		recipe string
+		err    string
+	}{
+		{"not YAML", "stages: [repair\n", "recipe.yaml:1: missing ']'"},
+		{"no stages", "input: a.pdf\n", "recipe.yaml: no stages"},
+		{"misspelt key", "input: a.pdf\nstage: [repair]\n", `recipe.yaml: json: unknown field "stage"`},
+		{"unknown stage", "stages: [ocr]\n", `recipe.yaml: unknown stage "ocr" (available: repair, split, extract, ocr-fallback, strip-headers, chunk, embed, summarize, sink)`},
+		{"out of order", "stages: [extract, repair]\n", "recipe.yaml: stage repair must come before extract"},
+		{"twice", "stages: [extract, extract]\n", "recipe.yaml: stage extract appears twice"},
+		{"unknown option", "stages: [{chunk: {length: 10}}]\n", `recipe.yaml: stage chunk has no option "length" (available: overlap, size, tokenizer)`},
+		{"two names", "stages: [{chunk: {size: 10}, sink: {}}]\n", "recipe.yaml: a stage must be a name, or a name with options, not 2 names"},
+		{"options not a mapping", "stages: [{chunk: [10]}]\n", "recipe.yaml: options of stage chunk must be a mapping"},
+		{"stage not a name", "stages: [[repair]]\n", "recipe.yaml: a stage must be a name, or a name with options, not [repair]"},
+		{"bad value", "stages: [{sink: {output: {dir: out}}}]\n", "recipe.yaml: sink output: map[dir:out] is not a string, number, boolean or list"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if args, err := recipeArgs("recipe.yaml", []byte(tt.recipe)); err == nil || err.Error() != tt.err {
+				t.Errorf("got %q, error %v; want error %q", args, err, tt.err)
+			}
+		})
+	}
+}
+
+func TestShellQuote(t *testing.T) {
+	for in, want := range map[string]string{
+		"-output=out/": "-output=out/",
+		"":             "''",
+		"two words":    "'two words'",
+		"it's":         `'it'\''s'`,
+		"$HOME":        "'$HOME'",
+	} {
+		if got := shellQuote(in); got != want {
+			t.Errorf("shellQuote(%q) = %s, want %s", in, got, want)
+		}
+	}
+}
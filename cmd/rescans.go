@@ -0,0 +1,139 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/thnkr-one/pdfripper/pdfripper"
+)
+
+// runRescans implements "pdfripper rescans DIR...": it reads the JSON
+// manifests of earlier runs under the given directories and reports the
+// documents whose page images match, such as a batch re-scanned after a
+// jam. Only pages that were rendered, for OCR, equations or figures, have
+// image hashes to compare.
+func runRescans(args []string) {
+	fs := flag.NewFlagSet("rescans", flag.ExitOnError)
+	maxDistance := fs.Int("max-distance", pdfripper.RescanMaxDistance, "Bits in which the image hashes of two scans of the same page may differ, out of 256")
+	minShare := fs.Float64("min-share", 0.5, "Share of the hashed pages of the shorter document that must match for two documents to be reported")
+	pages := fs.Bool("pages", false, "Also list the pages that match")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: pdfripper rescans [flags] DIR_OR_MANIFEST...")
+		fs.PrintDefaults()
+	}
+	if !parseFlags(fs, args) {
+		return
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	var docs []hashedDoc
+	for _, arg := range fs.Args() {
+		found, err := findManifests(arg)
+		if err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+		for _, path := range found {
+			doc, err := readHashes(path)
+			if err != nil {
+				log.Fatalf("Error reading %s: %v", path, err)
+			}
+			docs = append(docs, doc)
+		}
+	}
+
+	matched := 0
+	for i := range docs {
+		for j := i + 1; j < len(docs); j++ {
+			a, b := docs[i], docs[j]
+			hashed := min(a.hashed(), b.hashed())
+			if hashed == 0 {
+				continue
+			}
+			matches := pdfripper.MatchPages(a.hashes, b.hashes, *maxDistance)
+			if float64(len(matches)) < *minShare*float64(hashed) {
+				continue
+			}
+			matched++
+			fmt.Printf("%s and %s: %d of %d pages match\n", a.path, b.path, len(matches), hashed)
+			if *pages {
+				for _, m := range matches {
+					fmt.Printf("  page %d = page %d (distance %d)\n", m.Page, m.Other, m.Distance)
+				}
+			}
+		}
+	}
+	if matched == 0 {
+		fmt.Printf("No re-scans found among %d documents\n", len(docs))
+	}
+}
+
+// hashedDoc holds the page image hashes from one manifest; pages without
+// a hash have zero.
+type hashedDoc struct {
+	path   string
+	hashes []pdfripper.ImageHash
+}
+
+func (d hashedDoc) hashed() int {
+	n := 0
+	for _, h := range d.hashes {
+		if h != (pdfripper.ImageHash{}) {
+			n++
+		}
+	}
+	return n
+}
+
+// findManifests returns path if it is a file, or else the manifest.json
+// files anywhere below it.
+func findManifests(path string) ([]string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return []string{path}, nil
+	}
+	var found []string
+	err = filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+		if err == nil && !d.IsDir() && d.Name() == "manifest.json" {
+			found = append(found, p)
+		}
+		return err
+	})
+	return found, err
+}
+
+func readHashes(path string) (hashedDoc, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return hashedDoc{}, err
+	}
+	var manifest pdfripper.Manifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return hashedDoc{}, err
+	}
+	doc := hashedDoc{path: path}
+	for _, p := range manifest.Pages {
+		if p.ImageHash == "" || p.Page < 1 {
+			continue
+		}
+		h, err := pdfripper.ParseImageHash(p.ImageHash)
+		if err != nil {
+			return hashedDoc{}, fmt.Errorf("page %d: %w", p.Page, err)
+		}
+		for len(doc.hashes) < p.Page {
+			doc.hashes = append(doc.hashes, pdfripper.ImageHash{})
+		}
+		doc.hashes[p.Page-1] = h
+	}
+	return doc, nil
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/thnkr-one/pdfripper/pdfripper"
+)
+
+// runRevisions implements "pdfripper revisions": it lists the revisions
+// of an incrementally updated document, any of which can be extracted
+// with -revision.
+func runRevisions(args []string) {
+	fs := flag.NewFlagSet("revisions", flag.ExitOnError)
+	inputFile := fs.String("input", "", "Input PDF file path (required)")
+	passwordFlag(fs)
+	asJSON := fs.Bool("json", false, "Print the revisions as JSON")
+	if !parseFlags(fs, args) {
+		return
+	}
+	if *inputFile == "" {
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	revisions, err := pdfripper.Revisions(*inputFile)
+	if err != nil {
+		log.Fatalf("Error reading revisions: %v", err)
+	}
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(revisions)
+		return
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "REVISION\tSIZE\tPAGES\tOBJECTS\tMODIFIED\tCHANGED PAGES")
+	for _, r := range revisions {
+		changed := make([]string, len(r.ChangedPages))
+		for i, p := range r.ChangedPages {
+			changed[i] = strconv.Itoa(p)
+		}
+		fmt.Fprintf(tw, "%d\t%d\t%d\t%d\t%s\t%s\n", r.Number, r.Size, r.Pages, r.Objects, r.Modified, strings.Join(changed, ","))
+	}
+	tw.Flush()
+}
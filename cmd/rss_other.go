@@ -0,0 +1,10 @@
+//go:build !unix
+
+package main
+
+import "os"
+
+// peakRSS is not available on this platform.
+func peakRSS(ps *os.ProcessState) int64 {
+	return -1
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// s3MaxExpiry is the longest a pre-signed S3 URL may be valid for.
+const s3MaxExpiry = 7 * 24 * time.Hour
+
+// s3Dest uploads files as objects of an S3 bucket, or of a store with the
+// S3 API such as MinIO, signing requests with AWS Signature Version 4.
+type s3Dest struct {
+	endpoint  *url.URL // Scheme and host requests go to; the bucket is in the path unless virtualHost.
+	bucket    string
+	prefix    string // Key prefix, without slashes at either end.
+	region    string
+	accessKey string
+	secretKey string
+	token     string // Session token of temporary credentials, if any.
+	client    *http.Client
+
+	virtualHost bool // The bucket is in the host, as AWS itself prefers.
+	now         func() time.Time
+}
+
+// newS3Dest returns the destination of an s3://bucket/prefix URL. The
+// credentials are those of the AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and
+// AWS_SESSION_TOKEN environment variables, the region that of AWS_REGION
+// or AWS_DEFAULT_REGION (default us-east-1), and AWS_ENDPOINT_URL_S3 or
+// AWS_ENDPOINT_URL names another store with the S3 API, addressed with the
+// bucket in the path.
+func newS3Dest(u *url.URL) (*s3Dest, error) {
+	d := &s3Dest{
+		bucket:    u.Host,
+		prefix:    strings.Trim(u.Path, "/"),
+		region:    firstEnv("AWS_REGION", "AWS_DEFAULT_REGION"),
+		accessKey: os.Getenv("AWS_ACCESS_KEY_ID"),
+		secretKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		token:     os.Getenv("AWS_SESSION_TOKEN"),
+		client:    &http.Client{Timeout: remoteTimeout, Transport: &http.Transport{MaxIdleConnsPerHost: uploadWorkers}},
+		now:       time.Now,
+	}
+	if d.accessKey == "" || d.secretKey == "" {
+		return nil, errors.New("s3 output needs AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY")
+	}
+	if d.region == "" {
+		d.region = "us-east-1"
+	}
+	if endpoint := firstEnv("AWS_ENDPOINT_URL_S3", "AWS_ENDPOINT_URL"); endpoint != "" {
+		e, err := url.Parse(endpoint)
+		if err != nil || e.Host == "" {
+			return nil, fmt.Errorf("S3 endpoint %q is not a URL", endpoint)
+		}
+		d.endpoint = &url.URL{Scheme: e.Scheme, Host: e.Host}
+	} else {
+		d.endpoint = &url.URL{Scheme: "https", Host: fmt.Sprintf("%s.s3.%s.amazonaws.com", d.bucket, d.region)}
+		d.virtualHost = true
+	}
+	return d, nil
+}
+
+func firstEnv(names ...string) string {
+	for _, name := range names {
+		if v := os.Getenv(name); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// objectURL returns the URL of the object name, which is relative to the
+// prefix.
+func (d *s3Dest) objectURL(name string) *url.URL {
+	key := strings.TrimPrefix(d.prefix+"/"+name, "/")
+	u := *d.endpoint
+	if d.virtualHost {
+		u.Path = "/" + key
+	} else {
+		u.Path = "/" + d.bucket + "/" + key
+	}
+	u.RawPath = s3Escape(u.Path, false)
+	return &u
+}
+
+func (d *s3Dest) put(local, name string) error {
+	f, err := os.Open(local)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	h := sha256.New()
+	size, err := io.Copy(h, f)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPut, d.objectURL(name).String(), f)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+	if size == 0 {
+		// S3 needs a Content-Length, which Go leaves out for an empty body
+		// unless it is NoBody.
+		req.Body = http.NoBody
+	}
+	d.sign(req, hex.EncodeToString(h.Sum(nil)))
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("PUT %s: %s %s", name, resp.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+func (d *s3Dest) close() error {
+	d.client.CloseIdleConnections()
+	return nil
+}
+
+// presign returns a URL that lets anyone holding it GET the object name
+// until expiry, at most s3MaxExpiry, has passed.
+func (d *s3Dest) presign(name string, expiry time.Duration) string {
+	u := d.objectURL(name)
+	t := d.now().UTC()
+	q := url.Values{
+		"X-Amz-Algorithm":     {"AWS4-HMAC-SHA256"},
+		"X-Amz-Credential":    {d.accessKey + "/" + d.scope(t)},
+		"X-Amz-Date":          {t.Format("20060102T150405Z")},
+		"X-Amz-Expires":       {strconv.Itoa(int(min(expiry, s3MaxExpiry).Seconds()))},
+		"X-Amz-SignedHeaders": {"host"},
+	}
+	if d.token != "" {
+		q.Set("X-Amz-Security-Token", d.token)
+	}
+	u.RawQuery = s3Query(q)
+	signature := d.signature(t, http.MethodGet, u, http.Header{"Host": {u.Host}}, "UNSIGNED-PAYLOAD")
+	u.RawQuery += "&X-Amz-Signature=" + signature
+	return u.String()
+}
+
+// sign adds the date, payload hash and Authorization headers to req.
+func (d *s3Dest) sign(req *http.Request, payloadHash string) {
+	t := d.now().UTC()
+	req.Header.Set("X-Amz-Date", t.Format("20060102T150405Z"))
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if d.token != "" {
+		req.Header.Set("X-Amz-Security-Token", d.token)
+	}
+	headers := req.Header.Clone()
+	headers.Set("Host", req.URL.Host)
+	signature := d.signature(t, req.Method, req.URL, headers, payloadHash)
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s,SignedHeaders=%s,Signature=%s",
+		d.accessKey, d.scope(t), strings.Join(signedHeaders(headers), ";"), signature))
+}
+
+func (d *s3Dest) scope(t time.Time) string {
+	return t.Format("20060102") + "/" + d.region + "/s3/aws4_request"
+}
+
+// signature returns the Signature Version 4 signature of a request with
+// headers, all of which are signed.
+func (d *s3Dest) signature(t time.Time, method string, u *url.URL, headers http.Header, payloadHash string) string {
+	names := signedHeaders(headers)
+	var canonical strings.Builder
+	fmt.Fprintf(&canonical, "%s\n%s\n%s\n", method, u.EscapedPath(), u.RawQuery)
+	for _, name := range names {
+		fmt.Fprintf(&canonical, "%s:%s\n", name, strings.TrimSpace(headers.Get(name)))
+	}
+	fmt.Fprintf(&canonical, "\n%s\n%s", strings.Join(names, ";"), payloadHash)
+	sum := sha256.Sum256([]byte(canonical.String()))
+	toSign := "AWS4-HMAC-SHA256\n" + t.Format("20060102T150405Z") + "\n" + d.scope(t) + "\n" + hex.EncodeToString(sum[:])
+
+	key := []byte("AWS4" + d.secretKey)
+	for _, part := range []string{t.Format("20060102"), d.region, "s3", "aws4_request", toSign} {
+		mac := hmac.New(sha256.New, key)
+		mac.Write([]byte(part))
+		key = mac.Sum(nil)
+	}
+	return hex.EncodeToString(key)
+}
+
+// signedHeaders returns the lower-case names of headers, sorted.
+func signedHeaders(headers http.Header) []string {
+	var names []string
+	for name := range headers {
+		names = append(names, strings.ToLower(name))
+	}
+	sort.Strings(names)
+	return names
+}
+
+// s3Query encodes q as the canonical query string of Signature Version 4:
+// sorted by name, with everything but unreserved characters escaped.
+func s3Query(q url.Values) string {
+	var parts []string
+	for name, values := range q {
+		for _, v := range values {
+			parts = append(parts, s3Escape(name, true)+"="+s3Escape(v, true))
+		}
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, "&")
+}
+
+// s3Escape percent-encodes s as Signature Version 4 requires, leaving
+// unreserved characters, and slashes unless escapeSlash is set, alone.
+func s3Escape(s string, escapeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9', c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && !escapeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
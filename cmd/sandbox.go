@@ -0,0 +1,69 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/thnkr-one/pdfripper/pdfripper"
+)
+
+// sandboxFlags registers the subprocess limit flags on fs, and
+// -audit-log. The returned
+// function applies them to a backend once the flags are parsed, and
+// probes the tools it runs.
+func sandboxFlags(fs *flag.FlagSet) func(pdfripper.Backend) (pdfripper.Backend, error) {
+	cpu := fs.Uint64("sandbox-cpu", 0, "CPU seconds allowed per backend subprocess (Linux only; default: no limit)")
+	mem := fs.Uint64("sandbox-memory", 0, "Address space in bytes allowed per backend subprocess (Linux only; default: no limit)")
+	timeout := fs.Duration("sandbox-timeout", 0, "Wall-clock time allowed per backend subprocess (default: no limit)")
+	auditLogFlag(fs)
+	fs.String("cpu-affinity", "", "Pin each subprocess to the next of these CPU sets in turn: "+pdfripper.AffinityCPU+" (one CPU each), "+pdfripper.AffinityNode+" (one NUMA node each) or lists such as 0-15;16-31 (Linux only; default: no pinning)")
+
+	return func(b pdfripper.Backend) (pdfripper.Backend, error) {
+		affinity, err := cpuAffinity(fs)
+		if err != nil {
+			return nil, err
+		}
+		sb := pdfripper.Sandbox{CPUSeconds: *cpu, MemoryBytes: *mem, Timeout: *timeout, Affinity: affinity}
+		if sb != (pdfripper.Sandbox{}) {
+			s, ok := b.(pdfripper.Sandboxer)
+			if !ok {
+				return nil, fmt.Errorf("backend %s does not run subprocesses, so -sandbox-* and -cpu-affinity do not apply", b.Name())
+			}
+			b = s.WithSandbox(sb)
+		}
+		return probeBackend(b)
+	}
+}
+
+// probeBackend returns b as probing the tools it runs adapts it, printing
+// what it does without.
+func probeBackend(b pdfripper.Backend) (pdfripper.Backend, error) {
+	p, ok := b.(pdfripper.Prober)
+	if !ok {
+		return b, nil
+	}
+	b, warnings, err := p.Probe()
+	if err != nil {
+		return nil, err
+	}
+	for _, w := range warnings {
+		log.Printf("Warning: %s", w)
+	}
+	return b, nil
+}
+
+// cpuAffinity returns the CPU affinity set with -cpu-affinity on fs, or
+// nil if it is not set.
+func cpuAffinity(fs *flag.FlagSet) (*pdfripper.CPUAffinity, error) {
+	spec := strings.TrimSpace(fs.Lookup("cpu-affinity").Value.String())
+	if spec == "" {
+		return nil, nil
+	}
+	a, err := pdfripper.ParseCPUAffinity(spec)
+	if err != nil {
+		return nil, fmt.Errorf("-cpu-affinity %s: %w", spec, err)
+	}
+	return a, nil
+}
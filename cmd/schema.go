@@ -0,0 +1,33 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/thnkr-one/pdfripper/pdfripper"
+)
+
+// runSchema implements "pdfripper schema": it prints the JSON Schema of
+// manifest.json, of the pages the server returns or of -events lines, for
+// consumers that validate what they read.
+func runSchema(args []string) {
+	fs := flag.NewFlagSet("schema", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: pdfripper schema %s\n", strings.Join(pdfripper.Schemas, "|"))
+	}
+	if !parseFlags(fs, args) {
+		return
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(1)
+	}
+	data, err := pdfripper.JSONSchema(fs.Arg(0))
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	fmt.Println(string(data))
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/thnkr-one/pdfripper/pdfripper"
+	"github.com/thnkr-one/pdfripper/pdfripper/paptest"
+)
+
+// selftestCorpus are the documents selftest extracts, built in memory so
+// that a deployment needs no fixtures to check itself.
+var selftestCorpus = []struct {
+	name string
+	doc  *paptest.Document
+}{
+	{"text", &paptest.Document{Title: "Self-test", Pages: paptest.TextPages(
+		"Hello, world!\nSecond line",
+		"Page two",
+	)}},
+	{"latin1", &paptest.Document{Pages: paptest.TextPages(
+		"Café – “quoted” (parens) \\backslash\nPrice: 12,50 €",
+	)}},
+	{"orientation", &paptest.Document{Pages: []paptest.Page{
+		{Lines: []string{"Landscape letter"}, Size: [2]float64{792, 612}},
+		{Lines: []string{"Portrait A4 rotated to landscape"}, Size: paptest.A4, Rotate: 90},
+	}}},
+	{"blank", &paptest.Document{Pages: []paptest.Page{{}, {Lines: []string{"After a blank page"}}}}},
+}
+
+// runSelftest implements "pdfripper selftest": it writes the documents of
+// selftestCorpus to a temporary directory, extracts each with every
+// backend into a directory of its own, page files and manifest as a run
+// writes them, and checks the text of every page against what was drawn,
+// ignoring whitespace. It is a smoke test for new deployments, and exits
+// with status 1 if any backend cannot run or gets any text wrong.
+func runSelftest(args []string) {
+	fs := flag.NewFlagSet("selftest", flag.ExitOnError)
+	backendList := fs.String("backends", "", "Comma-separated backends to test (default: all of "+strings.Join(pdfripper.Backends(), ", ")+")")
+	keep := fs.Bool("keep", false, "Keep the sample PDFs and their outputs, and print where they are")
+	applySandbox := sandboxFlags(fs)
+	if !parseFlags(fs, args) {
+		return
+	}
+	names := pdfripper.Backends()
+	if *backendList != "" {
+		names = strings.Split(*backendList, ",")
+	}
+
+	dir, err := os.MkdirTemp("", "pdfripper-selftest-")
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	for _, s := range selftestCorpus {
+		if err := s.doc.WriteFile(filepath.Join(dir, s.name+".pdf")); err != nil {
+			log.Fatalf("Error writing sample %s: %v", s.name, err)
+		}
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "BACKEND\tSAMPLE\tRESULT")
+	checks, failed := 0, 0
+	for _, name := range names {
+		b, err := pdfripper.LookupBackend(strings.TrimSpace(name))
+		if err == nil {
+			b, err = applySandbox(b)
+		}
+		if err != nil {
+			checks++
+			failed++
+			fmt.Fprintf(tw, "%s\t-\tFAIL: %v\n", name, err)
+			continue
+		}
+		for _, s := range selftestCorpus {
+			out := filepath.Join(dir, b.Name(), s.name)
+			err := pdfripper.ExtractToDir(context.Background(), filepath.Join(dir, s.name+".pdf"), out,
+				pdfripper.WithBackend(b),
+				func(e *pdfripper.Extractor) { e.ManifestFormats = []string{"json"} })
+			if err == nil {
+				err = checkSelftest(out, s.doc)
+			}
+			checks++
+			result := "ok"
+			if err != nil {
+				failed++
+				result = "FAIL: " + err.Error()
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\n", b.Name(), s.name, result)
+		}
+	}
+	tw.Flush()
+	if *keep {
+		fmt.Printf("Kept the samples and outputs in %s\n", dir)
+	} else {
+		os.RemoveAll(dir)
+	}
+	if failed > 0 {
+		fmt.Printf("Self-test failed: %d of %d checks\n", failed, checks)
+		os.Exit(1)
+	}
+	fmt.Printf("Self-test passed: %d backends, %d samples\n", len(names), len(selftestCorpus))
+}
+
+// checkSelftest compares the output in dir with the pages of doc.
+func checkSelftest(dir string, doc *paptest.Document) error {
+	data, err := os.ReadFile(filepath.Join(dir, "manifest.json"))
+	if err != nil {
+		return err
+	}
+	var m pdfripper.Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return fmt.Errorf("reading manifest.json: %w", err)
+	}
+	if len(m.Pages) != len(doc.Pages) {
+		return fmt.Errorf("manifest.json lists %d pages, not %d", len(m.Pages), len(doc.Pages))
+	}
+	for _, entry := range m.Pages {
+		if entry.Page < 1 || entry.Page > len(doc.Pages) {
+			return fmt.Errorf("manifest.json lists a page %d", entry.Page)
+		}
+		text, err := os.ReadFile(entry.File)
+		if err != nil {
+			return err
+		}
+		got := strings.Join(strings.Fields(string(text)), " ")
+		want := strings.Join(strings.Fields(strings.Join(doc.Pages[entry.Page-1].Lines, "\n")), " ")
+		if got != want {
+			return fmt.Errorf("page %d reads %q, not %q", entry.Page, got, want)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,521 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/thnkr-one/pdfripper/pdfripper"
+)
+
+// server is the HTTP front end of "pdfripper serve".
+type server struct {
+	backend       pdfripper.Backend
+	workers       int
+	rejectActive  bool
+	results       *s3Dest             // -results: where job artifacts are uploaded, if anywhere
+	resultsExpiry time.Duration       // how long their pre-signed URLs are valid for
+	extractions   *pdfripper.FairPool // server-wide limit on concurrent extractions, admitted by priority
+	pages         *pdfripper.FairPool // server-wide limit on pages extracted at once, by priority
+	tenants       map[string]*tenant
+	open          *tenant         // used for every request when no keys file is configured
+	callbacks     *callbackSender // delivers job callbacks to the addresses -callback-allow permits
+	store         *jobStore
+	ctx           context.Context // canceled when the server shuts down
+	pending       sync.WaitGroup  // running job goroutines
+}
+
+// runServe implements "pdfripper serve".
+func runServe(args []string) {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	addr := fs.String("addr", ":8080", "Address to listen on")
+	keysFile := fs.String("keys", "", "JSON file of API keys and their quotas (default: no authentication)")
+	procCount := fs.Int("processes", 0, "Number of concurrent workers per extraction (default: number of CPU cores)")
+	maxProcs := fs.Int("gomaxprocs", 0, "Number of OS threads running Go code at once (default: GOMAXPROCS from the environment, or number of CPU cores)")
+	maxJobs := fs.Int("max-jobs", 0, "Maximum extractions running at once across all keys, admitted by priority; high priority ones are not counted (default: number of CPU cores)")
+	pageWorkers := fs.Int("page-workers", 0, "Maximum pages extracted at once across all extractions, given to those of the highest priority waiting first (default: number of CPU cores)")
+	jobsDir := fs.String("jobs", "pdfripper-jobs", "Directory where jobs, their uploads and results are stored")
+	backendName := fs.String("backend", pdfripper.DefaultBackend, "Text extraction backend ("+strings.Join(pdfripper.Backends(), ", ")+")")
+	rejectActive := fs.Bool("reject-active-content", false, "Refuse documents containing JavaScript, launch actions, embedded executables or obfuscated streams")
+	results := fs.String("results", "", "s3://bucket/prefix URL to upload each completed job's page files, combined.txt and manifest.json to, under the job's ID, listing pre-signed URLs of them in the job (credentials and region from the AWS_* environment variables)")
+	resultsExpiry := fs.Duration("results-expiry", 24*time.Hour, "How long the pre-signed URLs of -results stay valid, at most 168h")
+	callbackAllow := fs.String("callback-allow", "", "Comma-separated IP addresses and CIDR prefixes that job callbacks may reach although they are loopback or link-local (default: none)")
+	applySandbox := sandboxFlags(fs)
+	if !parseFlags(fs, args) {
+		return
+	}
+	if *maxProcs > 0 {
+		runtime.GOMAXPROCS(*maxProcs)
+	}
+
+	backend, err := pdfripper.LookupBackend(*backendName)
+	if err == nil {
+		backend, err = applySandbox(backend)
+	}
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	allow, err := parseCallbackAllow(*callbackAllow)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	if *procCount < 1 {
+		*procCount = runtime.NumCPU()
+	}
+	if *maxJobs < 1 {
+		*maxJobs = runtime.NumCPU()
+	}
+	if *pageWorkers < 1 {
+		*pageWorkers = runtime.NumCPU()
+	}
+
+	store, err := openJobStore(*jobsDir)
+	if err != nil {
+		log.Fatalf("Error opening job store: %v", err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	s := &server{backend: backend, workers: *procCount, extractions: pdfripper.NewFairPool(*maxJobs), pages: pdfripper.NewFairPool(*pageWorkers), store: store, ctx: ctx, rejectActive: *rejectActive, callbacks: newCallbackSender(allow)}
+	if *results != "" {
+		u, err := url.Parse(*results)
+		if err != nil || u.Scheme != "s3" || u.Host == "" {
+			log.Fatalf("Error: -results %q is not an s3://bucket/prefix URL", *results)
+		}
+		if s.results, err = newS3Dest(u); err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+		if *resultsExpiry <= 0 || *resultsExpiry > s3MaxExpiry {
+			log.Fatalf("Error: -results-expiry %s is not between 0 and %s", *resultsExpiry, s3MaxExpiry)
+		}
+		s.resultsExpiry = *resultsExpiry
+	}
+	if *keysFile != "" {
+		if s.tenants, err = loadTenants(*keysFile); err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+	} else {
+		log.Print("Warning: no -keys file given; serving without authentication or quotas")
+		s.open = newTenant(tenantConfig{Name: "anonymous"})
+	}
+
+	s.resumeJobs()
+
+	srv := &http.Server{Addr: *addr, Handler: s.routes()}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		srv.Shutdown(shutdownCtx)
+	}()
+
+	log.Printf("Listening on %s", *addr)
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Fatalf("Error: %v", err)
+	}
+	// Running jobs see s.ctx canceled and go back to the queue, to be
+	// resumed when the server next starts.
+	s.pending.Wait()
+}
+
+// routes returns the handler of the server's API.
+func (s *server) routes() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/extract", s.handleExtract)
+	mux.HandleFunc("POST /jobs", s.handleSubmitJob)
+	mux.HandleFunc("GET /jobs", s.handleListJobs)
+	mux.HandleFunc("GET /jobs/{id}", s.handleGetJob)
+	mux.HandleFunc("GET /jobs/{id}/result", s.handleJobResult)
+	mux.HandleFunc("GET /jobs/{id}/pages", s.handleJobPages)
+	mux.HandleFunc("GET /jobs/{id}/text", s.handleJobText)
+	mux.HandleFunc("POST /jobs/{id}/cancel", s.handleCancelJob)
+	mux.HandleFunc("/metrics", s.handleMetrics)
+	return mux
+}
+
+// authenticate maps the request's API key, sent as "Authorization: Bearer
+// <key>" or "X-API-Key: <key>", to its tenant.
+func (s *server) authenticate(r *http.Request) *tenant {
+	if s.open != nil {
+		return s.open
+	}
+	key := r.Header.Get("X-API-Key")
+	if auth := r.Header.Get("Authorization"); key == "" && strings.HasPrefix(auth, "Bearer ") {
+		key = strings.TrimPrefix(auth, "Bearer ")
+	}
+	return s.tenants[key]
+}
+
+// tenantNamed finds a tenant by name, for jobs resumed after a restart.
+func (s *server) tenantNamed(name string) *tenant {
+	if s.open != nil {
+		return s.open
+	}
+	for _, t := range s.tenants {
+		if t.Name == name {
+			return t
+		}
+	}
+	return nil
+}
+
+// collectSink keeps extracted pages in memory for the response.
+type collectSink struct {
+	pages     []pdfripper.PageRecord
+	progress  func(done int)  // optional; called after every page
+	artifacts *artifactWriter // optional; also given every page
+}
+
+func (c *collectSink) WritePage(r *pdfripper.PageResult) error {
+	if c.artifacts != nil {
+		if err := c.artifacts.page(r); err != nil {
+			return fmt.Errorf("saving page %d for -results: %w", r.Page, err)
+		}
+	}
+	c.pages = append(c.pages, pdfripper.NewPageRecord(r))
+	if c.progress != nil {
+		c.progress(len(c.pages))
+	}
+	return nil
+}
+
+func (c *collectSink) Close() error {
+	if c.artifacts != nil {
+		return c.artifacts.close()
+	}
+	return nil
+}
+
+// priorities are the values of the optional priority query parameter, by
+// their levels in the server's pools: extractions of a higher priority
+// are admitted, and have their pages extracted, before those of a lower
+// one, so that interactive requests do not wait behind bulk jobs. High
+// priority extractions do not wait for -max-jobs at all, only for pages,
+// so only keys whose max_priority is high may ask for them.
+var priorities = map[string]int{"high": 1, "normal": 0, "low": -1}
+
+// admit authenticates a request, validates its optional callback_url,
+// which must not name a loopback or link-local address -callback-allow
+// does not permit, and its priority, which must not be above the tenant's
+// maximum, and applies the tenant's rate limit. If the request is rejected
+// it writes the response and returns ok == false.
+func (s *server) admit(w http.ResponseWriter, r *http.Request) (t *tenant, callbackURL string, ok bool) {
+	t = s.authenticate(r)
+	if t == nil {
+		writeError(w, http.StatusUnauthorized, "missing or unknown API key")
+		return nil, "", false
+	}
+	t.metrics.requests.Add(1)
+
+	callbackURL = r.URL.Query().Get("callback_url")
+	if callbackURL != "" {
+		if err := s.callbacks.validate(callbackURL); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return nil, "", false
+		}
+	}
+
+	if p := r.URL.Query().Get("priority"); p != "" {
+		level, ok := priorities[p]
+		if !ok {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("priority %q is not one of high, normal, low", p))
+			return nil, "", false
+		}
+		if level > t.maxPriority {
+			writeError(w, http.StatusForbidden, fmt.Sprintf("priority %q is above the maximum for this key", p))
+			return nil, "", false
+		}
+	}
+
+	if t.limiter != nil {
+		if ok, wait := t.limiter.allow(); !ok {
+			t.metrics.rateLimited.Add(1)
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			writeError(w, http.StatusTooManyRequests, "rate limit exceeded")
+			return nil, "", false
+		}
+	}
+	return t, callbackURL, true
+}
+
+// receive saves the request body to path, enforcing the tenant's file size
+// limit. If that fails it writes the response and returns false.
+func (s *server) receive(w http.ResponseWriter, r *http.Request, t *tenant, path string) bool {
+	body := r.Body
+	if t.MaxFileSizeBytes > 0 {
+		body = http.MaxBytesReader(w, r.Body, t.MaxFileSizeBytes)
+	}
+	n, err := saveBody(path, body)
+	t.metrics.bytesReceived.Add(n)
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			t.metrics.quotaRejected.Add(1)
+			writeError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("file exceeds the %d byte limit for this key", t.MaxFileSizeBytes))
+			return false
+		}
+		t.metrics.failures.Add(1)
+		writeError(w, http.StatusBadRequest, "reading request body: "+err.Error())
+		return false
+	}
+	return true
+}
+
+// handleExtract extracts the PDF sent as the request body and responds
+// with the text of every page. With a callback_url query parameter the
+// request is submitted as a job instead, exactly as with POST /jobs.
+func (s *server) handleExtract(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "use POST with the PDF as the request body")
+		return
+	}
+	t, callbackURL, ok := s.admit(w, r)
+	if !ok {
+		return
+	}
+	if callbackURL != "" {
+		s.submitJob(w, r, t, callbackURL)
+		return
+	}
+
+	release, ok := t.acquire()
+	if !ok {
+		t.metrics.rateLimited.Add(1)
+		writeError(w, http.StatusTooManyRequests, "too many concurrent requests for this key")
+		return
+	}
+	defer release()
+
+	tmpDir, err := os.MkdirTemp("", "pdfripper-serve-")
+	if err != nil {
+		t.metrics.failures.Add(1)
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer os.RemoveAll(tmpDir)
+
+	pdfPath := filepath.Join(tmpDir, "input.pdf")
+	if !s.receive(w, r, t, pdfPath) {
+		return
+	}
+	pages, err := s.run(r.Context(), t, pdfPath, tmpDir, r.URL.Query().Get("priority"), nil)
+	if err != nil {
+		var herr *httpError
+		switch {
+		case errors.As(err, &herr):
+			writeError(w, herr.status, herr.msg)
+		case r.Context().Err() != nil:
+			// The client has gone, so this is only for logs and proxies.
+			writeError(w, statusClientClosedRequest, "request canceled")
+		default:
+			t.metrics.failures.Add(1)
+			writeError(w, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+	writeJSON(w, http.StatusOK, newPagesResponse(pages))
+}
+
+// newPagesResponse returns the body of a successful synchronous
+// extraction, which is also the contents of a finished job's result file.
+func newPagesResponse(pages []pdfripper.PageRecord) pdfripper.PagesResponse {
+	return pdfripper.PagesResponse{SchemaVersion: pdfripper.PageSchemaVersion, PageCount: len(pages), Pages: pages}
+}
+
+// statusClientClosedRequest is nginx's status for a request the client
+// gave up on before it was answered.
+const statusClientClosedRequest = 499
+
+// httpError is a failure to report to the client with a specific status.
+type httpError struct {
+	status int
+	msg    string
+}
+
+func (e *httpError) Error() string { return e.msg }
+
+// run extracts pdfPath for t once a server-wide extraction slot is free,
+// scratch files going to workDir, at the given priority, one of
+// priorities or "" for normal. When j is set its state and progress are
+// kept up to date in the job store, and pages that fail are counted in
+// its Failures and left out of the pages returned rather than failing the
+// whole job. Failures to report to the client are returned as *httpError;
+// giving up because ctx is done returns ctx.Err().
+func (s *server) run(ctx context.Context, t *tenant, pdfPath, workDir, priority string, j *job) ([]pdfripper.PageRecord, error) {
+	level := priorities[priority]
+	if level < priorities["high"] {
+		slot := s.extractions.DocumentAt(level)
+		if err := slot.AcquireContext(ctx); err != nil {
+			return nil, err
+		}
+		defer slot.Release()
+	}
+
+	t.metrics.inFlight.Add(1)
+	defer t.metrics.inFlight.Add(-1)
+	start := time.Now()
+	defer func() { t.metrics.extractionNanos.Add(int64(time.Since(start))) }()
+
+	var notPDF *pdfripper.NotPDFError
+	if err := pdfripper.CheckPDF(pdfPath); errors.As(err, &notPDF) {
+		t.metrics.failures.Add(1)
+		notPDF.File = "request body"
+		status := http.StatusUnsupportedMediaType
+		if notPDF.Truncated {
+			status = http.StatusUnprocessableEntity
+		}
+		return nil, &httpError{status, notPDF.Error()}
+	}
+	total := 0
+	if j != nil {
+		var err error
+		if total, err = s.backend.PageCount(pdfPath); err != nil {
+			t.metrics.failures.Add(1)
+			return nil, &httpError{http.StatusUnprocessableEntity, "reading PDF: " + err.Error()}
+		}
+	}
+
+	extractor, err := pdfripper.NewExtractor(pdfPath, workDir, s.workers)
+	if err != nil {
+		t.metrics.failures.Add(1)
+		return nil, &httpError{http.StatusInternalServerError, err.Error()}
+	}
+	extractor.Backend = s.backend
+	extractor.Pool = s.pages.DocumentAt(level)
+	extractor.MaxPages = t.MaxPages
+	extractor.RejectActiveContent = s.rejectActive
+	extractor.PageGeometry = true
+	extractor.Classify = true
+	sink := &collectSink{}
+	var failed []error // of the pages of a job that failed
+	if j != nil {
+		if err := s.store.started(j, total); err != nil {
+			return nil, err
+		}
+		sink.progress = func(done int) { s.store.progress(j, done) }
+		extractor.PageDone = func(r *pdfripper.PageResult) {
+			if r.Err != nil {
+				failed = append(failed, r.Err)
+				s.store.pageFailed(j)
+			}
+		}
+		if s.results != nil {
+			if sink.artifacts, err = newArtifactWriter(filepath.Join(workDir, artifactsDir), s.backend.Name()); err != nil {
+				return nil, err
+			}
+		}
+	}
+	err = extractor.ExtractToContext(ctx, sink)
+	if slices.ContainsFunc(failed, func(f error) bool { return errors.Is(err, f) }) {
+		// The pipeline went on past the pages that failed, and reports the
+		// first of them; the job has the others.
+		err = nil
+	}
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		var limit *pdfripper.LimitError
+		if errors.As(err, &limit) {
+			t.metrics.quotaRejected.Add(1)
+			return nil, &httpError{http.StatusRequestEntityTooLarge, limit.Error() + " for this key"}
+		}
+		var active *pdfripper.ActiveContentError
+		if errors.As(err, &active) {
+			t.metrics.failures.Add(1)
+			return nil, &httpError{http.StatusUnprocessableEntity, active.Error()}
+		}
+		t.metrics.failures.Add(1)
+		return nil, &httpError{http.StatusUnprocessableEntity, err.Error()}
+	}
+	t.metrics.pagesExtracted.Add(int64(len(sink.pages)))
+	return sink.pages, nil
+}
+
+// saveBody copies a request body to path and returns the bytes written.
+func saveBody(path string, body io.Reader) (int64, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return 0, err
+	}
+	n, err := io.Copy(f, body)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return n, err
+}
+
+// handleMetrics reports per-key counters in the Prometheus text format.
+// Keys are labelled by their configured name, never by the secret. Like
+// the rest of the API it needs a key, and it reports only that key's
+// counters unless the key has all_metrics set, so that one tenant cannot
+// learn which others the server has or how much they use it.
+func (s *server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	caller := s.authenticate(r)
+	if caller == nil {
+		writeError(w, http.StatusUnauthorized, "missing or unknown API key")
+		return
+	}
+	tenants := []*tenant{caller}
+	if caller.AllMetrics {
+		tenants = tenants[:0]
+		for _, t := range s.tenants {
+			tenants = append(tenants, t)
+		}
+	}
+	sort.Slice(tenants, func(i, j int) bool { return tenants[i].Name < tenants[j].Name })
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	metric := func(name, kind, help string, value func(m *tenantMetrics) float64) {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+		for _, t := range tenants {
+			fmt.Fprintf(w, "%s{key=%q} %g\n", name, t.Name, value(&t.metrics))
+		}
+	}
+	metric("pdfripper_requests_total", "counter", "Extraction requests received.",
+		func(m *tenantMetrics) float64 { return float64(m.requests.Load()) })
+	metric("pdfripper_rate_limited_total", "counter", "Requests rejected by rate or concurrency limits.",
+		func(m *tenantMetrics) float64 { return float64(m.rateLimited.Load()) })
+	metric("pdfripper_quota_rejected_total", "counter", "Requests rejected by file size or page quotas.",
+		func(m *tenantMetrics) float64 { return float64(m.quotaRejected.Load()) })
+	metric("pdfripper_failures_total", "counter", "Requests that failed during extraction.",
+		func(m *tenantMetrics) float64 { return float64(m.failures.Load()) })
+	metric("pdfripper_pages_extracted_total", "counter", "Pages extracted.",
+		func(m *tenantMetrics) float64 { return float64(m.pagesExtracted.Load()) })
+	metric("pdfripper_bytes_received_total", "counter", "PDF bytes uploaded.",
+		func(m *tenantMetrics) float64 { return float64(m.bytesReceived.Load()) })
+	metric("pdfripper_extraction_seconds_total", "counter", "Time spent extracting.",
+		func(m *tenantMetrics) float64 { return time.Duration(m.extractionNanos.Load()).Seconds() })
+	metric("pdfripper_requests_in_flight", "gauge", "Requests currently being handled.",
+		func(m *tenantMetrics) float64 { return float64(m.inFlight.Load()) })
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, map[string]string{"error": msg})
+}
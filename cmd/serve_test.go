@@ -0,0 +1,516 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/thnkr-one/pdfripper/pdfripper"
+	"github.com/thnkr-one/pdfripper/pdfripper/paptest"
+)
+
+// loopback lets tests' callbacks reach httptest servers.
+var loopback = []netip.Prefix{netip.MustParsePrefix("127.0.0.0/8"), netip.MustParsePrefix("::1/128")}
+
+// failingBackend fails to read any document.
+type failingBackend struct{}
+
+func (failingBackend) Name() string { return "failing" }
+func (failingBackend) PageCount(string) (int, error) {
+	return 0, errors.New("pdfinfo: exit status 1: Syntax Error")
+}
+func (failingBackend) ExtractPage(string, int) (string, error) {
+	return "", errors.New("not reached")
+}
+
+// secondPageFails extracts with another backend, except for page 2.
+type secondPageFails struct{ pdfripper.Backend }
+
+func (b secondPageFails) ExtractPage(path string, page int) (string, error) {
+	if page == 2 {
+		return "", errors.New("page 2 is unreadable")
+	}
+	return b.Backend.ExtractPage(path, page)
+}
+
+// newTestServer returns a server extracting with the native backend,
+// whose keys are the names of tenants, or one without authentication if
+// none are given. Its jobs are waited for when the test ends.
+func newTestServer(t *testing.T, tenants ...tenantConfig) *server {
+	t.Helper()
+	native, err := pdfripper.LookupBackend("native")
+	if err != nil {
+		t.Fatal(err)
+	}
+	store, err := openJobStore(filepath.Join(t.TempDir(), "jobs"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &server{backend: native, workers: 2, extractions: pdfripper.NewFairPool(2), pages: pdfripper.NewFairPool(2), store: store, ctx: ctx, callbacks: newCallbackSender(loopback)}
+	t.Cleanup(func() {
+		cancel()
+		s.pending.Wait()
+	})
+	if len(tenants) == 0 {
+		s.open = newTenant(tenantConfig{Name: "anonymous"})
+		return s
+	}
+	s.tenants = map[string]*tenant{}
+	for _, cfg := range tenants {
+		cfg.Key = cfg.Name
+		s.tenants[cfg.Key] = newTenant(cfg)
+	}
+	return s
+}
+
+// serve sends a request with the API key key, if not empty, to s.
+func serve(s *server, method, target, key string, body []byte) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, target, bytes.NewReader(body))
+	if key != "" {
+		r.Header.Set("Authorization", "Bearer "+key)
+	}
+	w := httptest.NewRecorder()
+	s.routes().ServeHTTP(w, r)
+	return w
+}
+
+// decode parses the JSON body of a response into v.
+func decode(t *testing.T, w *httptest.ResponseRecorder, v any) {
+	t.Helper()
+	if err := json.Unmarshal(w.Body.Bytes(), v); err != nil {
+		t.Fatalf("%s: %v", w.Body, err)
+	}
+}
+
+func TestServeExtract(t *testing.T) {
+	s := newTestServer(t, tenantConfig{Name: "interactive", MaxPriority: "high"})
+	w := serve(s, http.MethodPost, "/extract?priority=high", "interactive", paptest.TextPDF("One", "Two"))
+	if w.Code != http.StatusOK {
+		t.Fatalf("got status %d: %s", w.Code, w.Body)
+	}
+	var resp pdfripper.PagesResponse
+	decode(t, w, &resp)
+	if resp.SchemaVersion != pdfripper.PageSchemaVersion || resp.PageCount != 2 || len(resp.Pages) != 2 {
+		t.Fatalf("got %+v", resp)
+	}
+	for i, want := range []string{"One\n", "Two\n"} {
+		if p := resp.Pages[i]; p.Page != i+1 || p.Text != want || p.Width != 612 || p.Height != 792 {
+			t.Errorf("page %d: got %+v, want %q on a letter page", i+1, p, want)
+		}
+	}
+
+	// A client that gives up waiting for an extraction slot is still
+	// answered.
+	slot := s.extractions.DocumentAt(priorities["normal"])
+	for i := 0; i < 2; i++ {
+		slot.AcquireContext(context.Background())
+		defer slot.Release()
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	r := httptest.NewRequest(http.MethodPost, "/extract", bytes.NewReader(paptest.TextPDF("One"))).WithContext(ctx)
+	r.Header.Set("Authorization", "Bearer interactive")
+	w = httptest.NewRecorder()
+	s.routes().ServeHTTP(w, r)
+	if w.Code != statusClientClosedRequest {
+		t.Errorf("canceled: got status %d, want %d", w.Code, statusClientClosedRequest)
+	}
+}
+
+func TestServeExtractErrors(t *testing.T) {
+	s := newTestServer(t,
+		tenantConfig{Name: "search"},
+		tenantConfig{Name: "small", MaxFileSizeBytes: 100},
+		tenantConfig{Name: "short", MaxPages: 1},
+	)
+	failing := newTestServer(t)
+	failing.backend = failingBackend{}
+	good := paptest.TextPDF("One", "Two")
+	for _, tt := range []struct {
+		name   string
+		s      *server
+		method string
+		target string
+		key    string
+		body   []byte
+		status int
+		err    string
+	}{
+		{"GET", s, http.MethodGet, "/extract", "search", nil, http.StatusMethodNotAllowed, "use POST with the PDF as the request body"},
+		{"no key", s, http.MethodPost, "/extract", "", good, http.StatusUnauthorized, "missing or unknown API key"},
+		{"unknown key", s, http.MethodPost, "/extract", "nobody", good, http.StatusUnauthorized, "missing or unknown API key"},
+		{"bad priority", s, http.MethodPost, "/extract?priority=urgent", "search", good, http.StatusBadRequest, `priority "urgent" is not one of high, normal, low`},
+		{"priority above the maximum", s, http.MethodPost, "/extract?priority=high", "search", good, http.StatusForbidden, `priority "high" is above the maximum for this key`},
+		{"priority above the maximum for a job", s, http.MethodPost, "/jobs?priority=high", "search", good, http.StatusForbidden, `priority "high" is above the maximum for this key`},
+		{"bad callback", s, http.MethodPost, "/extract?callback_url=ftp://example.com/", "search", good, http.StatusBadRequest, "callback_url must be an absolute http or https URL"},
+		{"link-local callback", s, http.MethodPost, "/jobs?callback_url=http://169.254.169.254/latest", "search", good, http.StatusBadRequest, "callback host 169.254.169.254 is a loopback or link-local address"},
+		{"not a PDF", s, http.MethodPost, "/extract", "search", []byte("\x00\x01binary"), http.StatusUnsupportedMediaType, "request body"},
+		{"truncated", s, http.MethodPost, "/extract", "search", good[:len(good)/2], http.StatusUnprocessableEntity, "request body"},
+		{"too large", s, http.MethodPost, "/extract", "small", good, http.StatusRequestEntityTooLarge, "file exceeds the 100 byte limit for this key"},
+		{"too many pages", s, http.MethodPost, "/extract", "short", good, http.StatusRequestEntityTooLarge, "document has 2 pages, more than the limit of 1 for this key"},
+		{"backend fails", failing, http.MethodPost, "/extract", "", good, http.StatusUnprocessableEntity, "Syntax Error"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(tt.s, tt.method, tt.target, tt.key, tt.body)
+			var resp struct{ Error string }
+			decode(t, w, &resp)
+			if w.Code != tt.status || !strings.Contains(resp.Error, tt.err) {
+				t.Errorf("got status %d, %q; want %d, %q", w.Code, resp.Error, tt.status, tt.err)
+			}
+		})
+	}
+	if n := s.tenants["small"].metrics.quotaRejected.Load(); n != 1 {
+		t.Errorf("small: %d quota rejections, want 1", n)
+	}
+}
+
+func TestServeRateLimit(t *testing.T) {
+	s := newTestServer(t, tenantConfig{Name: "search", RatePerMinute: 60, Burst: 1})
+	pdf := paptest.TextPDF("One")
+	if w := serve(s, http.MethodPost, "/extract", "search", pdf); w.Code != http.StatusOK {
+		t.Fatalf("first request: got status %d: %s", w.Code, w.Body)
+	}
+	w := serve(s, http.MethodPost, "/extract", "search", pdf)
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") != "1" {
+		t.Errorf("second request: got status %d, Retry-After %q; want 429 after 1 second", w.Code, w.Header().Get("Retry-After"))
+	}
+}
+
+// callbackReceiver records the bodies POSTed to it and their signatures,
+// answering with the statuses given in turn and then with 200.
+type callbackReceiver struct {
+	mu         sync.Mutex
+	statuses   []int
+	bodies     [][]byte
+	signatures []string
+	got        chan struct{}
+}
+
+func newCallbackReceiver(t *testing.T, statuses ...int) (*callbackReceiver, string) {
+	c := &callbackReceiver{statuses: statuses, got: make(chan struct{}, 10)}
+	srv := httptest.NewServer(c)
+	t.Cleanup(srv.Close)
+	return c, srv.URL + "/done"
+}
+
+func (c *callbackReceiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	c.mu.Lock()
+	c.bodies = append(c.bodies, body)
+	c.signatures = append(c.signatures, r.Header.Get(signatureHeader))
+	status := http.StatusOK
+	if len(c.statuses) > 0 {
+		status, c.statuses = c.statuses[0], c.statuses[1:]
+	}
+	c.mu.Unlock()
+	w.WriteHeader(status)
+	c.got <- struct{}{}
+}
+
+// wait returns the next body POSTed.
+func (c *callbackReceiver) wait(t *testing.T) []byte {
+	t.Helper()
+	select {
+	case <-c.got:
+	case <-time.After(10 * time.Second):
+		t.Fatal("no callback received")
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.bodies[len(c.bodies)-1]
+}
+
+func TestServeJobs(t *testing.T) {
+	s := newTestServer(t, tenantConfig{Name: "search", CallbackSecret: "wh-s3cr3t"}, tenantConfig{Name: "other"})
+	receiver, callback := newCallbackReceiver(t)
+	w := serve(s, http.MethodPost, "/extract?priority=low&callback_url="+callback, "search", paptest.TextPDF("One", "Two", "Three"))
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("got status %d: %s", w.Code, w.Body)
+	}
+	var submitted job
+	decode(t, w, &submitted)
+	if w.Header().Get("Location") != "/jobs/"+submitted.ID || submitted.Tenant != "search" || submitted.Priority != "low" {
+		t.Errorf("got %+v at %s", submitted, w.Header().Get("Location"))
+	}
+
+	var done job
+	if err := json.Unmarshal(receiver.wait(t), &done); err != nil {
+		t.Fatal(err)
+	}
+	if done.ID != submitted.ID || done.Status != jobCompleted || done.PageCount != 3 || done.PagesDone != 3 || done.Failures != 0 || done.FinishedAt == nil {
+		t.Errorf("got callback %+v", done)
+	}
+	if !strings.HasPrefix(receiver.signatures[0], "sha256=") {
+		t.Errorf("got signature %q, want the key's", receiver.signatures[0])
+	}
+	if _, err := os.Stat(s.store.inputPath(done.ID)); !os.IsNotExist(err) {
+		t.Error("the uploaded PDF was kept after the job finished")
+	}
+
+	var got job
+	decode(t, serve(s, http.MethodGet, "/jobs/"+done.ID, "search", nil), &got)
+	if got.Status != jobCompleted {
+		t.Errorf("got job %+v", got)
+	}
+	var list struct{ Jobs []job }
+	decode(t, serve(s, http.MethodGet, "/jobs", "search", nil), &list)
+	if len(list.Jobs) != 1 || list.Jobs[0].ID != done.ID {
+		t.Errorf("got jobs %+v", list.Jobs)
+	}
+
+	var result pdfripper.PagesResponse
+	decode(t, serve(s, http.MethodGet, "/jobs/"+done.ID+"/result", "search", nil), &result)
+	if result.PageCount != 3 || len(result.Pages) != 3 || result.Pages[2].Text != "Three\n" {
+		t.Errorf("got result %+v", result)
+	}
+	var pages pdfripper.PagesResponse
+	decode(t, serve(s, http.MethodGet, "/jobs/"+done.ID+"/pages?from=2&to=2", "search", nil), &pages)
+	if pages.PageCount != 3 || len(pages.Pages) != 1 || pages.Pages[0].Page != 2 {
+		t.Errorf("got pages %+v", pages)
+	}
+	if w := serve(s, http.MethodGet, "/jobs/"+done.ID+"/text?from=2", "search", nil); w.Body.String() != "Two\n\fThree\n\f" || !strings.HasPrefix(w.Header().Get("Content-Type"), "text/plain") {
+		t.Errorf("got text %q", w.Body)
+	}
+
+	for _, tt := range []struct {
+		method, target, key string
+		status              int
+	}{
+		{http.MethodGet, "/jobs/" + done.ID, "other", http.StatusNotFound},
+		{http.MethodGet, "/jobs/" + done.ID + "/result", "other", http.StatusNotFound},
+		{http.MethodGet, "/jobs/" + done.ID, "", http.StatusUnauthorized},
+		{http.MethodGet, "/jobs/missing", "search", http.StatusNotFound},
+		{http.MethodGet, "/jobs/" + done.ID + "/pages?from=0", "search", http.StatusBadRequest},
+		{http.MethodGet, "/jobs/" + done.ID + "/text?from=3&to=2", "search", http.StatusBadRequest},
+		{http.MethodPost, "/jobs/" + done.ID + "/cancel", "search", http.StatusConflict},
+		{http.MethodPost, "/jobs/" + done.ID + "/cancel", "other", http.StatusNotFound},
+	} {
+		if w := serve(s, tt.method, tt.target, tt.key, nil); w.Code != tt.status {
+			t.Errorf("%s %s as %q: got status %d, want %d: %s", tt.method, tt.target, tt.key, w.Code, tt.status, w.Body)
+		}
+	}
+	var others struct{ Jobs []job }
+	decode(t, serve(s, http.MethodGet, "/jobs", "other", nil), &others)
+	if len(others.Jobs) != 0 {
+		t.Errorf("another key lists %+v", others.Jobs)
+	}
+}
+
+func TestServeJobFails(t *testing.T) {
+	s := newTestServer(t)
+	s.backend = failingBackend{}
+	receiver, callback := newCallbackReceiver(t)
+	w := serve(s, http.MethodPost, "/jobs?callback_url="+callback, "", paptest.TextPDF("One"))
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("got status %d: %s", w.Code, w.Body)
+	}
+	var done job
+	if err := json.Unmarshal(receiver.wait(t), &done); err != nil {
+		t.Fatal(err)
+	}
+	if done.Status != jobFailed || !strings.Contains(done.Error, "Syntax Error") {
+		t.Errorf("got callback %+v", done)
+	}
+	if w := serve(s, http.MethodGet, "/jobs/"+done.ID+"/result", "", nil); w.Code != http.StatusConflict {
+		t.Errorf("result of a failed job: got status %d", w.Code)
+	}
+}
+
+func TestServeJobPageFails(t *testing.T) {
+	s := newTestServer(t)
+	s.backend = secondPageFails{s.backend}
+	receiver, callback := newCallbackReceiver(t)
+	if w := serve(s, http.MethodPost, "/jobs?callback_url="+callback, "", paptest.TextPDF("One", "Two", "Three")); w.Code != http.StatusAccepted {
+		t.Fatalf("got status %d: %s", w.Code, w.Body)
+	}
+	// The job completes without the page that failed, which it counts.
+	var done job
+	if err := json.Unmarshal(receiver.wait(t), &done); err != nil {
+		t.Fatal(err)
+	}
+	if done.Status != jobCompleted || done.Failures != 1 || done.PageCount != 3 || done.PagesDone != 2 || done.Output == "" || done.Error != "" {
+		t.Errorf("got callback %+v", done)
+	}
+	var result pdfripper.PagesResponse
+	decode(t, serve(s, http.MethodGet, "/jobs/"+done.ID+"/result", "", nil), &result)
+	if len(result.Pages) != 2 || result.Pages[0].Page != 1 || result.Pages[1].Page != 3 {
+		t.Errorf("got result %+v", result)
+	}
+}
+
+func TestJobStoreResume(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "jobs")
+	store, err := openJobStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, j := range []*job{
+		{ID: "queued", Tenant: "search", Status: jobQueued, CreatedAt: time.Now()},
+		{ID: "running", Tenant: "search", Status: jobRunning, CreatedAt: time.Now(), PagesDone: 1},
+		{ID: "orphan", Tenant: "removed", Status: jobQueued, CreatedAt: time.Now()},
+		{ID: "done", Tenant: "search", Status: jobCompleted, CreatedAt: time.Now()},
+	} {
+		os.MkdirAll(store.jobDir(j.ID), 0755)
+		if err := os.WriteFile(store.inputPath(j.ID), paptest.TextPDF("Resumed"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.add(j); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// An upload cut short by the restart has no job.json.
+	os.MkdirAll(store.jobDir("partial"), 0755)
+
+	s := newTestServer(t, tenantConfig{Name: "search"})
+	if s.store, err = openJobStore(dir); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(s.store.jobDir("partial")); !os.IsNotExist(err) {
+		t.Error("the partial upload was kept")
+	}
+	s.resumeJobs()
+	s.pending.Wait()
+	for id, want := range map[string]jobStatus{"queued": jobCompleted, "running": jobCompleted, "orphan": jobFailed, "done": jobCompleted} {
+		var tenant = "search"
+		if id == "orphan" {
+			tenant = "removed"
+		}
+		j, ok := s.store.get(id, tenant)
+		if !ok || j.Status != want {
+			t.Errorf("job %s: got %+v, want it %s", id, j, want)
+		}
+	}
+	if j, _ := s.store.get("orphan", "removed"); j.Error != "API key no longer configured" {
+		t.Errorf("orphan: got error %q", j.Error)
+	}
+}
+
+func TestCallbackSenderPost(t *testing.T) {
+	defer func(d time.Duration) { callbackDelay = d }(callbackDelay)
+	callbackDelay = time.Millisecond
+	c := newCallbackSender(loopback)
+
+	// Server errors are retried, up to callbackAttempts times.
+	receiver, callback := newCallbackReceiver(t, http.StatusBadGateway, http.StatusServiceUnavailable)
+	if err := c.post(callback, "", job{ID: "retried"}); err != nil {
+		t.Fatal(err)
+	}
+	if len(receiver.bodies) != 3 {
+		t.Errorf("got %d attempts, want 3", len(receiver.bodies))
+	}
+	receiver, callback = newCallbackReceiver(t, 500, 500, 500, 500, 500, 500)
+	if err := c.post(callback, "", job{ID: "failed"}); err == nil || !strings.HasSuffix(err.Error(), ": callback returned status 500") {
+		t.Errorf("got error %v, want status 500", err)
+	}
+	if len(receiver.bodies) != callbackAttempts {
+		t.Errorf("got %d attempts, want %d", len(receiver.bodies), callbackAttempts)
+	}
+
+	// Client errors are not.
+	receiver, callback = newCallbackReceiver(t, http.StatusGone)
+	var perm *permanentError
+	if err := c.post(callback, "", job{ID: "gone"}); !errors.As(err, &perm) || perm.status != http.StatusGone {
+		t.Errorf("got error %v, want status 410", err)
+	}
+	if len(receiver.bodies) != 1 {
+		t.Errorf("got %d attempts, want 1", len(receiver.bodies))
+	}
+
+	// Bodies are signed with the secret, if there is one.
+	receiver, callback = newCallbackReceiver(t)
+	if err := c.post(callback, "wh-s3cr3t", job{ID: "signed"}); err != nil {
+		t.Fatal(err)
+	}
+	mac := hmac.New(sha256.New, []byte("wh-s3cr3t"))
+	mac.Write(receiver.bodies[0])
+	if want := "sha256=" + hex.EncodeToString(mac.Sum(nil)); receiver.signatures[0] != want {
+		t.Errorf("got signature %q, want %q", receiver.signatures[0], want)
+	}
+}
+
+func TestCallbackSenderRefuses(t *testing.T) {
+	c := newCallbackSender(nil)
+	for raw, refused := range map[string]bool{
+		"http://127.0.0.1:8080/done":     true,
+		"http://localhost/done":          true,
+		"http://[::1]/done":              true,
+		"http://[::ffff:127.0.0.1]/done": true,
+		"http://0.0.0.0/done":            true,
+		"http://169.254.169.254/latest":  true,
+		"http://[fe80::1%25eth0]/done":   true,
+		"https://hooks.example.com/done": false,
+		"http://10.0.0.1/done":           false,
+		"http://[2001:db8::1]:8443/done": false,
+	} {
+		var blocked *blockedError
+		if err := c.validate(raw); errors.As(err, &blocked) != refused {
+			t.Errorf("%s: got error %v, want refused %v", raw, err, refused)
+		}
+	}
+	allowed := newCallbackSender([]netip.Prefix{netip.MustParsePrefix("169.254.0.0/16")})
+	if err := allowed.validate("http://169.254.169.254/latest"); err != nil {
+		t.Errorf("allowed: got error %v", err)
+	}
+
+	// Host names are refused once they resolve, without retrying.
+	receiver, callback := newCallbackReceiver(t)
+	var blocked *blockedError
+	if err := c.post(strings.Replace(callback, "127.0.0.1", "localhost", 1), "", job{ID: "refused"}); !errors.As(err, &blocked) {
+		t.Errorf("got error %v, want the address refused", err)
+	}
+	if len(receiver.bodies) != 0 {
+		t.Errorf("got %d callbacks, want none", len(receiver.bodies))
+	}
+}
+
+func TestParseCallbackAllow(t *testing.T) {
+	allow, err := parseCallbackAllow("127.0.0.1, fe80::/10,")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(allow) != 2 || allow[0].String() != "127.0.0.1/32" || allow[1].String() != "fe80::/10" {
+		t.Errorf("got %v", allow)
+	}
+	if _, err := parseCallbackAllow("localhost"); err == nil || err.Error() != `-callback-allow: "localhost" is not an IP address or CIDR prefix` {
+		t.Errorf("got error %v", err)
+	}
+}
+
+func TestServeMetrics(t *testing.T) {
+	s := newTestServer(t, tenantConfig{Name: "search"}, tenantConfig{Name: "batch"}, tenantConfig{Name: "prometheus", AllMetrics: true})
+	serve(s, http.MethodPost, "/extract", "search", paptest.TextPDF("One", "Two"))
+	w := serve(s, http.MethodGet, "/metrics", "prometheus", nil)
+	for _, want := range []string{
+		"# TYPE pdfripper_requests_total counter\npdfripper_requests_total{key=\"batch\"} 0\npdfripper_requests_total{key=\"prometheus\"} 0\npdfripper_requests_total{key=\"search\"} 1\n",
+		"pdfripper_pages_extracted_total{key=\"search\"} 2\n",
+		"pdfripper_requests_in_flight{key=\"search\"} 0\n",
+	} {
+		if !strings.Contains(w.Body.String(), want) {
+			t.Errorf("metrics do not contain %q:\n%s", want, w.Body)
+		}
+	}
+
+	// Other keys see only their own counters.
+	w = serve(s, http.MethodGet, "/metrics", "batch", nil)
+	if body := w.Body.String(); !strings.Contains(body, "pdfripper_requests_total{key=\"batch\"} 0\n") || strings.Contains(body, "search") {
+		t.Errorf("metrics for batch:\n%s", body)
+	}
+	if w := serve(s, http.MethodGet, "/metrics", "", nil); w.Code != http.StatusUnauthorized {
+		t.Errorf("without a key: got status %d", w.Code)
+	}
+}
@@ -0,0 +1,137 @@
+//go:build !noexec && !js && !wasip1
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/url"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/thnkr-one/pdfripper/pdfripper"
+)
+
+// sftpDest uploads files with OpenSSH's sftp command, so that hosts, keys
+// and known hosts come from the user's ssh configuration. All the sftp
+// processes of a run share one SSH connection, through a control master
+// that stays up until close.
+type sftpDest struct {
+	target  string   // [user@]host
+	dir     string   // Remote directory the output goes to.
+	options []string // ssh options, passed to both sftp and ssh.
+
+	mu      sync.Mutex
+	created map[string]bool // Remote directories made or found to exist.
+}
+
+func newSFTPDest(u *url.URL, workDir string) (remoteDest, error) {
+	if _, set := u.User.Password(); set {
+		return nil, errors.New("sftp output URLs cannot hold a password; use an SSH key or agent")
+	}
+	d := &sftpDest{target: u.Hostname(), dir: u.Path, created: map[string]bool{}}
+	if u.User != nil {
+		d.target = u.User.Username() + "@" + d.target
+	}
+	if d.dir == "" {
+		d.dir = "."
+	} else if strings.HasPrefix(d.dir, "/~/") {
+		d.dir = d.dir[3:] // relative to the remote home directory
+	}
+	d.options = []string{
+		"-o", "BatchMode=yes",
+		"-o", "ControlMaster=auto",
+		"-o", "ControlPath=" + filepath.Join(workDir, "ssh-%C"),
+		"-o", "ControlPersist=yes",
+	}
+	if port := u.Port(); port != "" {
+		d.options = append(d.options, "-o", "Port="+port)
+	}
+	if err := d.mkdirs(d.dir); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// batch runs sftp commands; a leading "-" makes sftp ignore their failure.
+func (d *sftpDest) batch(commands ...string) error {
+	args := append([]string{"-q", "-b", "-"}, d.options...)
+	cmd := exec.Command("sftp", append(args, d.target)...)
+	cmd.Stdin = strings.NewReader(strings.Join(commands, "\n") + "\n")
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := runAudited(cmd, cmd.Run); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return fmt.Errorf("sftp: %w: %s", err, msg)
+		}
+		return fmt.Errorf("sftp: %w", err)
+	}
+	return nil
+}
+
+// mkdirs creates dir and the directories above it that are missing. They
+// count as made only once sftp has run, so that other uploads into them
+// make them too rather than go ahead first; a "-mkdir" of one that exists
+// does no harm.
+func (d *sftpDest) mkdirs(dir string) error {
+	var missing []string
+	d.mu.Lock()
+	for p := dir; p != "." && p != "/" && !d.created[p]; p = path.Dir(p) {
+		missing = append([]string{p}, missing...)
+	}
+	d.mu.Unlock()
+	if len(missing) == 0 {
+		return nil
+	}
+	commands := make([]string, len(missing))
+	for i, p := range missing {
+		commands[i] = "-mkdir " + sftpQuote(p)
+	}
+	if err := d.batch(commands...); err != nil {
+		return err
+	}
+	d.mu.Lock()
+	for _, p := range missing {
+		d.created[p] = true
+	}
+	d.mu.Unlock()
+	return nil
+}
+
+func (d *sftpDest) put(local, name string) error {
+	remote := path.Join(d.dir, name)
+	if err := d.mkdirs(path.Dir(remote)); err != nil {
+		return err
+	}
+	return d.batch("put " + sftpQuote(local) + " " + sftpQuote(remote))
+}
+
+// close stops the control master.
+func (d *sftpDest) close() error {
+	args := append([]string{"-O", "exit"}, d.options...)
+	// This fails harmlessly when no master is running.
+	cmd := exec.Command("ssh", append(args, d.target)...)
+	runAudited(cmd, cmd.Run)
+	return nil
+}
+
+// runAudited runs cmd with run, recording it in the audit log, if one is
+// set. A failure to record it is the error if the command succeeded.
+func runAudited(cmd *exec.Cmd, run func() error) error {
+	audit := pdfripper.StartAudit(cmd.Path, cmd.Args)
+	cmd.Stderr = audit.Stderr(cmd.Stderr)
+	err := run()
+	if aerr := audit.Finish(err); aerr != nil && err == nil {
+		return fmt.Errorf("recording %s in the audit log: %w", filepath.Base(cmd.Path), aerr)
+	}
+	return err
+}
+
+// sftpQuote quotes an argument of an sftp batch command.
+func sftpQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
@@ -0,0 +1,13 @@
+//go:build noexec || js || wasip1
+
+package main
+
+import (
+	"errors"
+	"net/url"
+)
+
+// newSFTPDest would start sftp processes, which this build leaves out.
+func newSFTPDest(u *url.URL, workDir string) (remoteDest, error) {
+	return nil, errors.New("sftp output is not available in builds without subprocess support")
+}
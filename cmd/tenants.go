@@ -0,0 +1,153 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// tenantConfig describes one API key in the keys file:
+//
+//	{"keys": [{"key": "s3cr3t", "name": "search", "rate_per_minute": 60,
+//	           "burst": 10, "max_concurrent": 2,
+//	           "max_file_size_bytes": 52428800, "max_pages": 2000,
+//	           "max_priority": "high", "callback_secret": "wh-s3cr3t"},
+//	          {"key": "m3tr1cs", "name": "prometheus", "all_metrics": true}]}
+//
+// Zero limits mean unlimited. The priority a key's requests may ask for is
+// at most normal unless max_priority says otherwise, since high priority
+// extractions are not held back by -max-jobs. The job callbacks of a key
+// with a callback_secret carry its signature of the body, for receivers
+// to check that they come from this server; see signatureHeader. Only keys
+// with all_metrics, such as a Prometheus scraper's, read the counters of
+// every key from /metrics; the others see only their own.
+type tenantConfig struct {
+	Key              string  `json:"key"`
+	Name             string  `json:"name"`
+	RatePerMinute    float64 `json:"rate_per_minute"`
+	Burst            int     `json:"burst"`
+	MaxConcurrent    int     `json:"max_concurrent"`
+	MaxFileSizeBytes int64   `json:"max_file_size_bytes"`
+	MaxPages         int     `json:"max_pages"`
+	MaxPriority      string  `json:"max_priority"` // One of priorities; empty is normal.
+	CallbackSecret   string  `json:"callback_secret"`
+	AllMetrics       bool    `json:"all_metrics"` // Lets the key read every key's /metrics, not only its own.
+}
+
+// tenant is an API key's limits together with its live state.
+type tenant struct {
+	tenantConfig
+	limiter     *tokenBucket
+	slots       chan struct{} // nil when concurrency is unlimited
+	maxPriority int           // The highest level in priorities its requests may ask for.
+	metrics     tenantMetrics
+}
+
+// tenantMetrics are cumulative per-key counters.
+type tenantMetrics struct {
+	requests        atomic.Int64
+	rateLimited     atomic.Int64
+	quotaRejected   atomic.Int64
+	failures        atomic.Int64
+	pagesExtracted  atomic.Int64
+	bytesReceived   atomic.Int64
+	extractionNanos atomic.Int64
+	inFlight        atomic.Int64
+}
+
+// loadTenants reads the keys file. Every key needs a unique name, which is
+// what metrics and logs show instead of the secret.
+func loadTenants(path string) (map[string]*tenant, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading keys file: %w", err)
+	}
+	var file struct {
+		Keys []tenantConfig `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("parsing keys file: %w", err)
+	}
+
+	tenants := make(map[string]*tenant, len(file.Keys))
+	names := make(map[string]bool, len(file.Keys))
+	for i, cfg := range file.Keys {
+		if cfg.Key == "" || cfg.Name == "" {
+			return nil, fmt.Errorf("keys file entry %d: key and name are required", i+1)
+		}
+		if _, dup := tenants[cfg.Key]; dup || names[cfg.Name] {
+			return nil, fmt.Errorf("keys file entry %d: duplicate key or name %q", i+1, cfg.Name)
+		}
+		if _, ok := priorities[cfg.MaxPriority]; cfg.MaxPriority != "" && !ok {
+			return nil, fmt.Errorf("keys file entry %d: max_priority %q is not one of high, normal, low", i+1, cfg.MaxPriority)
+		}
+		names[cfg.Name] = true
+		tenants[cfg.Key] = newTenant(cfg)
+	}
+	return tenants, nil
+}
+
+func newTenant(cfg tenantConfig) *tenant {
+	t := &tenant{tenantConfig: cfg, maxPriority: priorities["normal"]}
+	if level, ok := priorities[cfg.MaxPriority]; ok {
+		t.maxPriority = level
+	}
+	if cfg.RatePerMinute > 0 {
+		burst := cfg.Burst
+		if burst < 1 {
+			burst = max(int(cfg.RatePerMinute/60), 1)
+		}
+		t.limiter = newTokenBucket(cfg.RatePerMinute/60, burst)
+	}
+	if cfg.MaxConcurrent > 0 {
+		t.slots = make(chan struct{}, cfg.MaxConcurrent)
+	}
+	return t
+}
+
+// acquire reserves one of the tenant's concurrent request slots without
+// blocking. The returned function releases it.
+func (t *tenant) acquire() (release func(), ok bool) {
+	if t.slots == nil {
+		return func() {}, true
+	}
+	select {
+	case t.slots <- struct{}{}:
+		return func() { <-t.slots }, true
+	default:
+		return nil, false
+	}
+}
+
+// tokenBucket is a rate limiter refilling at rate tokens per second up to
+// burst tokens.
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate float64, burst int) *tokenBucket {
+	return &tokenBucket{rate: rate, burst: float64(burst), tokens: float64(burst), last: time.Now()}
+}
+
+// allow takes a token if one is available. Otherwise it reports how long
+// until the next token arrives.
+func (b *tokenBucket) allow() (bool, time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := time.Now()
+	b.tokens = min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	wait := time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+	return false, wait
+}
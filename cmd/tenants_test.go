@@ -0,0 +1,55 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadTenants(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.json")
+	if err := os.WriteFile(path, []byte(`{"keys": [
+		{"key": "k1", "name": "search", "rate_per_minute": 120, "max_concurrent": 2, "max_priority": "high", "callback_secret": "wh-s3cr3t"},
+		{"key": "k2", "name": "batch", "max_priority": "low", "all_metrics": true},
+		{"key": "k3", "name": "other"}
+	]}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	tenants, err := loadTenants(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	search, batch, other := tenants["k1"], tenants["k2"], tenants["k3"]
+	if search.Name != "search" || search.limiter == nil || cap(search.slots) != 2 || search.maxPriority != priorities["high"] || search.CallbackSecret != "wh-s3cr3t" {
+		t.Errorf("search: got %+v", search)
+	}
+	if batch.maxPriority != priorities["low"] || batch.limiter != nil || batch.slots != nil || !batch.AllMetrics {
+		t.Errorf("batch: got %+v", batch)
+	}
+	if other.maxPriority != priorities["normal"] {
+		t.Errorf("other: max priority %d, want normal", other.maxPriority)
+	}
+}
+
+func TestLoadTenantsErrors(t *testing.T) {
+	for _, tt := range []struct {
+		name, keys, err string
+	}{
+		{"not JSON", `{"keys": [`, "parsing keys file"},
+		{"no name", `{"keys": [{"key": "k1"}]}`, "keys file entry 1: key and name are required"},
+		{"duplicate key", `{"keys": [{"key": "k1", "name": "a"}, {"key": "k1", "name": "b"}]}`, `keys file entry 2: duplicate key or name "b"`},
+		{"duplicate name", `{"keys": [{"key": "k1", "name": "a"}, {"key": "k2", "name": "a"}]}`, `keys file entry 2: duplicate key or name "a"`},
+		{"bad priority", `{"keys": [{"key": "k1", "name": "a", "max_priority": "urgent"}]}`, `keys file entry 1: max_priority "urgent" is not one of high, normal, low`},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "keys.json")
+			if err := os.WriteFile(path, []byte(tt.keys), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := loadTenants(path); err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("got error %v, want one containing %q", err, tt.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,10 @@
+//go:build !noexec && !js && !wasip1
+
+package main
+
+import "github.com/thnkr-one/pdfripper/pdfripper"
+
+// newTesseract returns the tesseract engine for -ocr tesseract.
+func newTesseract(lang string, affinity *pdfripper.CPUAffinity) (pdfripper.OCREngine, error) {
+	return &pdfripper.Tesseract{Language: lang, Sandbox: pdfripper.Sandbox{Affinity: affinity}}, nil
+}
@@ -0,0 +1,14 @@
+//go:build noexec || js || wasip1
+
+package main
+
+import (
+	"errors"
+
+	"github.com/thnkr-one/pdfripper/pdfripper"
+)
+
+// newTesseract would start a tesseract process, which this build leaves out.
+func newTesseract(lang string, affinity *pdfripper.CPUAffinity) (pdfripper.OCREngine, error) {
+	return nil, errors.New("tesseract is not available in builds without subprocess support; use a remote OCR engine")
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/thnkr-one/pdfripper/pdfripper"
+)
+
+// rotateFlag collects -rotate DEGREES[:pages=LIST] flags, which may be
+// repeated. Without a page list, every page is turned.
+type rotateFlag struct {
+	specs []string
+	t     pdfripper.PageTransform
+}
+
+func (f *rotateFlag) String() string { return strings.Join(f.specs, " ") }
+
+func (f *rotateFlag) Set(s string) error {
+	angle, pages, hasPages := strings.Cut(s, ":")
+	degrees, err := strconv.Atoi(angle)
+	if err != nil || degrees%90 != 0 {
+		return fmt.Errorf("angle %q is not a multiple of 90", angle)
+	}
+	if !hasPages {
+		f.t.RotateAll += degrees
+	} else {
+		list, ok := strings.CutPrefix(pages, "pages=")
+		if !ok {
+			return fmt.Errorf("expected pages=LIST after %q", angle+":")
+		}
+		nums, err := pdfripper.ParsePageList(list)
+		if err != nil {
+			return err
+		}
+		if f.t.Rotate == nil {
+			f.t.Rotate = map[int]int{}
+		}
+		for _, p := range nums {
+			f.t.Rotate[p] += degrees
+		}
+	}
+	f.specs = append(f.specs, s)
+	return nil
+}
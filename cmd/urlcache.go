@@ -0,0 +1,161 @@
+//go:build !noexec && !js && !wasip1
+
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+)
+
+// urlCacheDir is the directory inside a -cache directory that URL inputs
+// of a batch are kept in, one subdirectory per URL.
+const urlCacheDir = "urls"
+
+// urlEntry is the entry.json of a cached URL input: the validators the
+// server sent with the copy kept next to it, and the last extraction of
+// that copy, to skip it while the document has not changed.
+type urlEntry struct {
+	URL          string    `json:"url"`
+	File         string    `json:"file"` // Name of the copy in the entry's directory.
+	ETag         string    `json:"etag,omitempty"`
+	LastModified string    `json:"last_modified,omitempty"`
+	Fetched      time.Time `json:"fetched"`
+	Output       string    `json:"output,omitempty"` // The -output the copy was last extracted to, and with which other flags.
+	Args         []string  `json:"args,omitempty"`
+}
+
+// urlCache keeps the URL inputs of a batch under a -cache directory, so
+// that a run listing them again downloads only those whose ETag or
+// Last-Modified changed, and extracts again only those, or those going to
+// a different output or with different flags.
+type urlCache struct {
+	dir string
+}
+
+func (c *urlCache) entryDir(rawURL string) string {
+	sum := sha256.Sum256([]byte(rawURL))
+	return filepath.Join(c.dir, urlCacheDir, hex.EncodeToString(sum[:]))
+}
+
+// fetch returns the entry of rawURL and the path of its copy, downloading
+// it unless the server reports that the copy is current, in which case
+// unchanged is true. A new download replaces the copy, and forgets its
+// last extraction.
+func (c *urlCache) fetch(rawURL string) (e urlEntry, file string, unchanged bool, err error) {
+	dir := c.entryDir(rawURL)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return e, "", false, err
+	}
+	var cached *urlEntry
+	if data, err := os.ReadFile(filepath.Join(dir, "entry.json")); err == nil && json.Unmarshal(data, &e) == nil && e.URL == rawURL {
+		if _, err := os.Stat(filepath.Join(dir, e.File)); err == nil {
+			cached = &e
+		}
+	}
+	tmp, err := os.CreateTemp(dir, "download-*")
+	if err != nil {
+		return e, "", false, err
+	}
+	defer os.Remove(tmp.Name())
+	tmp.Close()
+	fresh, notModified, err := download(rawURL, tmp.Name(), cached)
+	if err != nil {
+		return e, "", false, err
+	}
+	if notModified {
+		return e, filepath.Join(dir, e.File), true, nil
+	}
+	e = fresh
+	e.File = inputName(rawURL) + ".pdf"
+	file = filepath.Join(dir, e.File)
+	if err := os.Rename(tmp.Name(), file); err != nil {
+		return e, "", false, err
+	}
+	return e, file, false, c.save(e)
+}
+
+// extracted records that the copy of e was extracted to output with args,
+// if the server gave validators to check that it is still current.
+func (c *urlCache) extracted(e urlEntry, output string, args []string) error {
+	if e.ETag == "" && e.LastModified == "" {
+		return nil
+	}
+	e.Output, e.Args = output, args
+	return c.save(e)
+}
+
+// current reports whether the copy of e was last extracted to output with
+// args, and that output is still there.
+func (e urlEntry) current(output string, args []string) bool {
+	if e.Output != output || !slices.Equal(e.Args, args) {
+		return false
+	}
+	if isRemoteOutput(output) {
+		return true
+	}
+	_, err := os.Stat(output)
+	return err == nil
+}
+
+func (c *urlCache) save(e urlEntry) error {
+	data, err := json.MarshalIndent(e, "", "  ")
+	if err != nil {
+		return err
+	}
+	p := filepath.Join(c.entryDir(e.URL), "entry.json")
+	if err := os.WriteFile(p+".tmp", append(data, '\n'), 0644); err != nil {
+		return err
+	}
+	return os.Rename(p+".tmp", p)
+}
+
+// download GETs rawURL into path. If cached is set, the request is
+// conditional on its validators, and notModified reports that the server
+// answered 304 Not Modified, leaving path empty. It returns the
+// validators of the response.
+func download(rawURL, path string, cached *urlEntry) (e urlEntry, notModified bool, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), inputTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return e, false, err
+	}
+	if cached != nil {
+		if cached.ETag != "" {
+			req.Header.Set("If-None-Match", cached.ETag)
+		}
+		if cached.LastModified != "" {
+			req.Header.Set("If-Modified-Since", cached.LastModified)
+		}
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return e, false, fmt.Errorf("downloading: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotModified && cached != nil {
+		return *cached, true, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return e, false, fmt.Errorf("downloading: %s", resp.Status)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return e, false, err
+	}
+	if _, err := io.Copy(f, resp.Body); err != nil {
+		f.Close()
+		return e, false, fmt.Errorf("downloading: %w", err)
+	}
+	e = urlEntry{URL: rawURL, ETag: resp.Header.Get("ETag"), LastModified: resp.Header.Get("Last-Modified"), Fetched: time.Now().UTC()}
+	return e, false, f.Close()
+}
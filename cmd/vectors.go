@@ -0,0 +1,74 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/thnkr-one/pdfripper/pdfripper"
+)
+
+// vectorSchemes are the URL schemes -vector-store accepts.
+const vectorSchemes = "qdrant, qdrants, weaviate, weaviates, pgvector"
+
+// serviceRetries is how many times a failing request to an embedding,
+// chat completions or vector store endpoint is retried.
+const serviceRetries = 3
+
+// defaultVectorTable is the table pgvector store URLs without a table
+// parameter fill.
+const defaultVectorTable = "pdfripper_chunks"
+
+// openVectorStore returns the vector store a -vector-store URL names:
+//
+//	qdrant://host:port/collection       Qdrant over http (qdrants: https)
+//	weaviate://host:port/Class          Weaviate over http (weaviates: https)
+//	pgvector://user@host:port/db?table=chunks&sslmode=require
+//	                                    PostgreSQL with pgvector, over psql
+//
+// key is sent to Qdrant and Weaviate as their API key. psql takes the
+// password, like the rest of the connection, from libpq's own sources,
+// such as ~/.pgpass and $PGPASSWORD, so pgvector URLs cannot hold one.
+func openVectorStore(raw, key string) (pdfripper.VectorStore, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("parsing vector store URL: %w", err)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("vector store URL %s has no host", u.Redacted())
+	}
+	name := strings.Trim(u.Path, "/")
+	base := func(tls bool) string {
+		if tls {
+			return "https://" + u.Host
+		}
+		return "http://" + u.Host
+	}
+	switch u.Scheme {
+	case "qdrant", "qdrants":
+		if name == "" {
+			return nil, errors.New("qdrant vector store URL has no collection, as in qdrant://localhost:6333/docs")
+		}
+		return &pdfripper.QdrantStore{URL: base(u.Scheme == "qdrants"), Collection: name, APIKey: key, Retries: serviceRetries}, nil
+	case "weaviate", "weaviates":
+		if name == "" {
+			return nil, errors.New("weaviate vector store URL has no class, as in weaviate://localhost:8080/Document")
+		}
+		return &pdfripper.WeaviateStore{URL: base(u.Scheme == "weaviates"), Class: name, APIKey: key, Retries: serviceRetries}, nil
+	case "pgvector":
+		if _, set := u.User.Password(); set {
+			return nil, errors.New("pgvector URLs cannot hold a password; use ~/.pgpass or $PGPASSWORD")
+		}
+		q := u.Query()
+		table := q.Get("table")
+		if table == "" {
+			table = defaultVectorTable
+		}
+		q.Del("table")
+		conn := *u
+		conn.Scheme, conn.RawQuery = "postgresql", q.Encode()
+		return newPgvectorStore(conn.String(), table)
+	}
+	return nil, fmt.Errorf("unknown vector store URL scheme %q (available: %s)", u.Scheme, vectorSchemes)
+}
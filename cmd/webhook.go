@@ -0,0 +1,201 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	callbackAttempts = 5
+	callbackTimeout  = 10 * time.Second
+)
+
+// webhookClient posts to webhooks the operator configured, such as
+// -notify slack:, which need none of callbackSender's checks.
+var webhookClient = &http.Client{Timeout: callbackTimeout}
+
+// signatureHeader is set on the callbacks of keys with a callback_secret
+// to "sha256=" and the hex HMAC-SHA256 of the body, keyed with the secret.
+const signatureHeader = "X-Pdfripper-Signature"
+
+// callbackDelay is how long callbackSender.post waits before its first
+// retry; each retry after that waits twice as long as the one before.
+var callbackDelay = time.Second
+
+func newJobID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("generating job ID: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func validateCallbackURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("callback_url must be an absolute http or https URL")
+	}
+	return nil
+}
+
+// callbackSender delivers job callbacks. Since anyone with a key chooses
+// where they go, it does not connect to loopback, link-local or
+// unspecified addresses, which would let a callback_url reach services
+// listening only on the server itself or a cloud metadata endpoint, unless
+// allow holds them.
+type callbackSender struct {
+	allow  []netip.Prefix
+	client *http.Client
+}
+
+func newCallbackSender(allow []netip.Prefix) *callbackSender {
+	c := &callbackSender{allow: allow}
+	// Addresses are checked as they are dialed, once host names have
+	// resolved, and through redirects. There is no proxy, so that it is the
+	// callback's own address that is dialed.
+	dialer := &net.Dialer{Timeout: callbackTimeout, Control: func(network, address string, _ syscall.RawConn) error {
+		ap, err := netip.ParseAddrPort(address)
+		if err != nil {
+			return err
+		}
+		return c.check(ap.Addr().String(), ap.Addr())
+	}}
+	transport := &http.Transport{DialContext: dialer.DialContext, TLSHandshakeTimeout: callbackTimeout, ForceAttemptHTTP2: true}
+	c.client = &http.Client{Timeout: callbackTimeout, Transport: transport}
+	return c
+}
+
+// parseCallbackAllow parses -callback-allow, a comma-separated list of IP
+// addresses and CIDR prefixes.
+func parseCallbackAllow(s string) ([]netip.Prefix, error) {
+	var allow []netip.Prefix
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		p, err := netip.ParsePrefix(item)
+		if err != nil {
+			ip, ierr := netip.ParseAddr(item)
+			if ierr != nil {
+				return nil, fmt.Errorf("-callback-allow: %q is not an IP address or CIDR prefix", item)
+			}
+			p = netip.PrefixFrom(ip, ip.BitLen())
+		}
+		allow = append(allow, p.Masked())
+	}
+	return allow, nil
+}
+
+// blockedError is a callback to an address callbackSender refuses.
+type blockedError struct{ host string }
+
+func (e *blockedError) Error() string {
+	return fmt.Sprintf("callback host %s is a loopback or link-local address, which -callback-allow does not permit", e.host)
+}
+
+// check returns a *blockedError if ip, the address of host, is one that
+// callbacks may not reach.
+func (c *callbackSender) check(host string, ip netip.Addr) error {
+	ip = ip.Unmap().WithZone("")
+	if !ip.IsLoopback() && !ip.IsLinkLocalUnicast() && !ip.IsLinkLocalMulticast() && !ip.IsUnspecified() {
+		return nil
+	}
+	for _, p := range c.allow {
+		if p.Contains(ip) {
+			return nil
+		}
+	}
+	return &blockedError{host}
+}
+
+// validate checks a callback_url given with a request, so that one naming
+// a refused address is rejected up front rather than failing once the job
+// is done. Other host names are checked when they are dialed.
+func (c *callbackSender) validate(raw string) error {
+	if err := validateCallbackURL(raw); err != nil {
+		return err
+	}
+	u, _ := url.Parse(raw)
+	host := u.Hostname()
+	if strings.EqualFold(strings.TrimSuffix(host, "."), "localhost") {
+		return c.check(host, netip.AddrFrom4([4]byte{127, 0, 0, 1}))
+	}
+	if ip, err := netip.ParseAddr(host); err == nil {
+		return c.check(host, ip)
+	}
+	return nil
+}
+
+// post POSTs the finished job to callbackURL, retrying with exponential
+// backoff on network errors and 5xx responses. The body is signed with
+// secret, if it is set.
+func (c *callbackSender) post(callbackURL, secret string, j job) error {
+	body, err := json.Marshal(j)
+	if err != nil {
+		return err
+	}
+	delay := callbackDelay
+	for attempt := 1; ; attempt++ {
+		err = sendCallback(c.client, callbackURL, secret, body)
+		var perm *permanentError
+		var blocked *blockedError
+		if err == nil || errors.As(err, &perm) || errors.As(err, &blocked) || attempt == callbackAttempts {
+			break
+		}
+		time.Sleep(delay)
+		delay *= 2
+	}
+	if err != nil {
+		return fmt.Errorf("delivering callback to %s: %w", callbackURL, err)
+	}
+	return nil
+}
+
+// permanentError marks a callback failure that retrying will not fix.
+type permanentError struct{ status int }
+
+func (e *permanentError) Error() string { return fmt.Sprintf("callback returned status %d", e.status) }
+
+// sendCallback POSTs body to callbackURL with client, signed with secret if
+// it is set.
+func sendCallback(client *http.Client, callbackURL, secret string, body []byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), callbackTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, callbackURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if secret != "" {
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write(body)
+		req.Header.Set(signatureHeader, "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	switch {
+	case resp.StatusCode >= 500:
+		return fmt.Errorf("callback returned status %d", resp.StatusCode)
+	case resp.StatusCode >= 300:
+		return &permanentError{resp.StatusCode}
+	}
+	return nil
+}
@@ -0,0 +1,388 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// parseYAML parses the subset of YAML that recipes need, and returns the
+// document as map[string]any, []any, string, int64, float64, bool and nil
+// values, with errors naming the line, of file, they are on. The subset is:
+//
+//   - block mappings and sequences, nested by indenting with spaces; a
+//     sequence under a key may be indented as far as the key itself;
+//   - flow sequences and mappings such as [a, b] and {size: 2000}, nested
+//     in each other, each on one line;
+//   - plain, 'single-quoted' and "double-quoted" scalars, each on one
+//     line; plain ones are null (null, ~ or nothing), true, false,
+//     integers and decimal numbers as in YAML 1.2, and strings otherwise;
+//   - comments, and a "---" before the document.
+//
+// Anything else is an error: anchors and aliases (&a, *a), tags (!!str),
+// block scalars (| and >), scalars and flow collections that go on over
+// several lines, complex keys (? key), a second document, tabs in
+// indentation and keys that appear twice in a mapping.
+func parseYAML(file string, data []byte) (any, error) {
+	p := &yamlParser{file: file}
+	for i, raw := range strings.Split(string(data), "\n") {
+		text := strings.TrimRight(stripYAMLComment(raw), " \t\r")
+		trimmed := strings.TrimLeft(text, " ")
+		if trimmed == "" || (i == 0 || len(p.lines) == 0) && trimmed == "---" {
+			continue
+		}
+		if strings.HasPrefix(trimmed, "\t") {
+			return nil, fmt.Errorf("%s:%d: indent with spaces, not tabs", file, i+1)
+		}
+		p.lines = append(p.lines, yamlLine{num: i + 1, indent: len(text) - len(trimmed), text: trimmed})
+	}
+	if len(p.lines) == 0 {
+		return nil, nil
+	}
+	v, err := p.block(p.lines[0].indent)
+	if err == nil && p.pos < len(p.lines) {
+		err = p.errorf(p.lines[p.pos], "unexpected indentation")
+	}
+	return v, err
+}
+
+type yamlLine struct {
+	num    int
+	indent int
+	text   string
+}
+
+type yamlParser struct {
+	file  string
+	lines []yamlLine
+	pos   int
+}
+
+func (p *yamlParser) errorf(l yamlLine, format string, args ...any) error {
+	return fmt.Errorf("%s:%d: %s", p.file, l.num, fmt.Sprintf(format, args...))
+}
+
+// block parses the sequence, mapping or scalar whose lines start at
+// indent.
+func (p *yamlParser) block(indent int) (any, error) {
+	l := p.lines[p.pos]
+	switch {
+	case l.text == "-" || strings.HasPrefix(l.text, "- "):
+		return p.sequence(indent)
+	case yamlKeyEnd(l.text) >= 0:
+		return p.mapping(indent)
+	}
+	p.pos++
+	return p.inline(l, l.text)
+}
+
+func (p *yamlParser) sequence(indent int) (any, error) {
+	items := []any{}
+	for p.pos < len(p.lines) {
+		l := p.lines[p.pos]
+		if l.indent != indent || !(l.text == "-" || strings.HasPrefix(l.text, "- ")) {
+			break
+		}
+		rest := strings.TrimLeft(strings.TrimPrefix(l.text, "-"), " ")
+		var item any
+		var err error
+		switch {
+		case rest == "":
+			p.pos++
+			item, err = p.nested(indent, false)
+		default:
+			// The item starts on the dash's line: parse it as if it
+			// started a line of its own, indented to where it starts.
+			p.lines[p.pos] = yamlLine{num: l.num, indent: indent + len(l.text) - len(rest), text: rest}
+			item, err = p.block(p.lines[p.pos].indent)
+		}
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+func (p *yamlParser) mapping(indent int) (any, error) {
+	m := map[string]any{}
+	for p.pos < len(p.lines) {
+		l := p.lines[p.pos]
+		if l.indent != indent {
+			break
+		}
+		end := yamlKeyEnd(l.text)
+		if end < 0 {
+			return nil, p.errorf(l, "expected a key: value pair, found %q", l.text)
+		}
+		name, err := yamlKey(strings.TrimSpace(l.text[:end]))
+		if err != nil {
+			return nil, p.errorf(l, "%v", err)
+		}
+		if _, dup := m[name]; dup {
+			return nil, p.errorf(l, "key %q appears twice", name)
+		}
+		rest := strings.TrimSpace(l.text[end+1:])
+		p.pos++
+		var v any
+		if rest == "" {
+			v, err = p.nested(indent, true)
+		} else {
+			v, err = p.inline(l, rest)
+		}
+		if err != nil {
+			return nil, err
+		}
+		m[name] = v
+	}
+	return m, nil
+}
+
+// nested parses the block under a key or dash at indent, or returns nil if
+// there is none. A sequence may sit at the indent of the key it belongs
+// to.
+func (p *yamlParser) nested(indent int, key bool) (any, error) {
+	if p.pos == len(p.lines) {
+		return nil, nil
+	}
+	l := p.lines[p.pos]
+	if l.indent > indent || key && l.indent == indent && (l.text == "-" || strings.HasPrefix(l.text, "- ")) {
+		return p.block(l.indent)
+	}
+	return nil, nil
+}
+
+// inline parses a value that is on one line.
+func (p *yamlParser) inline(l yamlLine, s string) (any, error) {
+	f := &yamlFlow{s: s}
+	v, err := f.value()
+	if err == nil && strings.TrimSpace(f.s[f.pos:]) != "" {
+		err = fmt.Errorf("unexpected %q", strings.TrimSpace(f.s[f.pos:]))
+	}
+	if err != nil {
+		return nil, p.errorf(l, "%v", err)
+	}
+	return v, nil
+}
+
+// yamlFlow parses flow collections and scalars.
+type yamlFlow struct {
+	s   string
+	pos int
+}
+
+func (f *yamlFlow) skipSpace() {
+	for f.pos < len(f.s) && f.s[f.pos] == ' ' {
+		f.pos++
+	}
+}
+
+func (f *yamlFlow) value() (any, error) {
+	f.skipSpace()
+	if f.pos == len(f.s) {
+		return nil, nil
+	}
+	switch f.s[f.pos] {
+	case '[':
+		f.pos++
+		items := []any{}
+		for {
+			f.skipSpace()
+			if f.pos < len(f.s) && f.s[f.pos] == ']' {
+				f.pos++
+				return items, nil
+			}
+			v, err := f.value()
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, v)
+			if err := f.separator(']'); err != nil {
+				return nil, err
+			}
+		}
+	case '{':
+		f.pos++
+		m := map[string]any{}
+		for {
+			f.skipSpace()
+			if f.pos < len(f.s) && f.s[f.pos] == '}' {
+				f.pos++
+				return m, nil
+			}
+			start := f.pos
+			if _, err := f.scalar(":"); err != nil {
+				return nil, err
+			}
+			name, err := yamlKey(strings.TrimSpace(f.s[start:f.pos]))
+			if err != nil {
+				return nil, err
+			}
+			if f.pos == len(f.s) || f.s[f.pos] != ':' {
+				return nil, fmt.Errorf("expected ':' after %v", name)
+			}
+			f.pos++
+			v, err := f.value()
+			if err != nil {
+				return nil, err
+			}
+			if _, dup := m[name]; dup {
+				return nil, fmt.Errorf("key %q appears twice", name)
+			}
+			m[name] = v
+			if err := f.separator('}'); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return f.scalar(",]}")
+}
+
+// separator consumes the comma after an item, leaving a closing bracket.
+func (f *yamlFlow) separator(closing byte) error {
+	f.skipSpace()
+	switch {
+	case f.pos == len(f.s):
+		return fmt.Errorf("missing %q", closing)
+	case f.s[f.pos] == ',':
+		f.pos++
+	case f.s[f.pos] != closing:
+		return fmt.Errorf("expected ',' or %q, found %q", closing, f.s[f.pos])
+	}
+	return nil
+}
+
+// scalar parses a quoted scalar, or a plain one ending at any of stop
+// inside a flow collection.
+func (f *yamlFlow) scalar(stop string) (any, error) {
+	f.skipSpace()
+	start := f.pos
+	if f.pos < len(f.s) && (f.s[f.pos] == '"' || f.s[f.pos] == '\'') {
+		end := quotedEnd(f.s, f.pos)
+		if end < 0 {
+			return nil, fmt.Errorf("unterminated string %s", f.s[start:])
+		}
+		f.pos = end + 1
+		return yamlScalar(f.s[start:f.pos])
+	}
+	if f.s[0] != '[' && f.s[0] != '{' {
+		// Outside flow collections, a plain scalar runs to the end.
+		f.pos = len(f.s)
+		return yamlScalar(strings.TrimSpace(f.s[start:]))
+	}
+	for f.pos < len(f.s) && !strings.ContainsRune(stop, rune(f.s[f.pos])) {
+		f.pos++
+	}
+	return yamlScalar(strings.TrimSpace(f.s[start:f.pos]))
+}
+
+// yamlScalar returns the value of a scalar: a quoted string, or a plain
+// one that is null, a boolean, a number or else a string.
+func yamlScalar(s string) (any, error) {
+	if s == "" {
+		return nil, nil
+	}
+	switch s[0] {
+	case '"':
+		v, err := strconv.Unquote(s)
+		if err != nil {
+			return nil, fmt.Errorf("bad string %s", s)
+		}
+		return v, nil
+	case '\'':
+		return strings.ReplaceAll(s[1:len(s)-1], "''", "'"), nil
+	case '&', '*', '!', '|', '>', '%', '@', '`':
+		return nil, fmt.Errorf("%q: anchors, tags and multi-line scalars are not supported", s)
+	}
+	if s == "?" || strings.HasPrefix(s, "? ") {
+		return nil, fmt.Errorf("%q: complex keys are not supported", s)
+	}
+	switch s {
+	case "null", "Null", "NULL", "~":
+		return nil, nil
+	case "true", "True", "TRUE":
+		return true, nil
+	case "false", "False", "FALSE":
+		return false, nil
+	}
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return n, nil
+	}
+	if n, err := strconv.ParseFloat(s, 64); err == nil && strings.ContainsAny(s, "0123456789") && !strings.ContainsAny(s, "_xX") {
+		return n, nil
+	}
+	return s, nil
+}
+
+// yamlKey returns the key a scalar names: a quoted one's string, or a
+// plain one as it is written, so that keys such as null and 1 are strings.
+func yamlKey(s string) (string, error) {
+	v, err := yamlScalar(s)
+	if err != nil {
+		return "", err
+	}
+	if v, ok := v.(string); ok && s != "" && (s[0] == '"' || s[0] == '\'') {
+		return v, nil
+	}
+	return s, nil
+}
+
+// yamlKeyEnd returns the index of the colon ending the key of a "key:
+// value" line, or -1 if it is not one.
+func yamlKeyEnd(s string) int {
+	i := 0
+	if s != "" && (s[0] == '"' || s[0] == '\'') {
+		if i = quotedEnd(s, 0); i < 0 {
+			return -1
+		}
+	} else if s != "" && (s[0] == '[' || s[0] == '{') {
+		return -1
+	}
+	for ; i < len(s); i++ {
+		if s[i] == ':' && (i+1 == len(s) || s[i+1] == ' ') {
+			return i
+		}
+	}
+	return -1
+}
+
+// quotedEnd returns the index of the quote closing the string starting at
+// s[start], or -1.
+func quotedEnd(s string, start int) int {
+	q := s[start]
+	for i := start + 1; i < len(s); i++ {
+		switch {
+		case q == '"' && s[i] == '\\':
+			i++
+		case s[i] == q && q == '\'' && i+1 < len(s) && s[i+1] == '\'':
+			i++
+		case s[i] == q:
+			return i
+		}
+	}
+	return -1
+}
+
+// stripYAMLComment removes a comment, which starts with a # at the start
+// of the line or after a space, outside quotes.
+func stripYAMLComment(line string) string {
+	var q byte
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case q != 0:
+			if c == '\\' && q == '"' || c == '\'' && q == '\'' && i+1 < len(line) && line[i+1] == '\'' {
+				i++
+			} else if c == q {
+				q = 0
+			}
+		case c == '"' || c == '\'':
+			if i == 0 || strings.ContainsRune(" :-[{,", rune(line[i-1])) {
+				q = c
+			}
+		case c == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+			return line[:i]
+		}
+	}
+	return line
+}
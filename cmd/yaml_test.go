@@ -0,0 +1,122 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseYAML(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		yaml string
+		want any
+	}{
+		{"empty", "", nil},
+		{"comments only", "# nothing\n\n  # here\n", nil},
+		{"document start", "---\na: 1\n", map[string]any{"a": int64(1)}},
+		{"scalars", `
+null: null
+tilde: ~
+empty:
+yes: true
+no: FALSE
+int: -42
+float: 0.5
+exp: 1e3
+string: hello world
+not a bool: yes
+not a number: 1_000
+hex: 0x10
+hex float: 0x1p3
+infinity: inf
+1: plain keys are strings
+double: "tab\there \"quoted\" # not a comment"
+single: 'it''s # not a comment either'
+colon: a: b
+url: http://example.com/a#b
+hash: a#b # comment
+`, map[string]any{
+			"null": nil, "tilde": nil, "empty": nil, "yes": true, "no": false,
+			"int": int64(-42), "float": 0.5, "exp": 1000.0, "string": "hello world",
+			"not a bool": "yes", "not a number": "1_000", "hex": "0x10", "hex float": "0x1p3", "infinity": "inf", "1": "plain keys are strings",
+			"double": "tab\there \"quoted\" # not a comment", "single": "it's # not a comment either",
+			"colon": "a: b", "url": "http://example.com/a#b", "hash": "a#b",
+		}},
+		{"quoted keys", `"a: b": 1` + "\n'c''d': 2\nflow: {\"x, y\": 3, null: 4}\n", map[string]any{"a: b": int64(1), "c'd": int64(2), "flow": map[string]any{"x, y": int64(3), "null": int64(4)}}},
+		{"nested", `
+input: scans/
+stages:
+  - repair
+  - extract:
+      backend: pdftotext
+      processes: 4
+  -
+    chunk: {size: 2000, overlap: 200}
+  - - nested
+    - list
+`, map[string]any{
+			"input": "scans/",
+			"stages": []any{
+				"repair",
+				map[string]any{"extract": map[string]any{"backend": "pdftotext", "processes": int64(4)}},
+				map[string]any{"chunk": map[string]any{"size": int64(2000), "overlap": int64(200)}},
+				[]any{"nested", "list"},
+			},
+		}},
+		{"sequence at the key's indentation", "stages:\n- repair\n- split\nnext: 1\n", map[string]any{"stages": []any{"repair", "split"}, "next": int64(1)}},
+		{"empty item", "- \n- a\n", []any{nil, "a"}},
+		{"flow", `a: [1, "two, three", [], [x, {k: v, "q k": [y]}], {}]`, map[string]any{
+			"a": []any{int64(1), "two, three", []any{}, []any{"x", map[string]any{"k": "v", "q k": []any{"y"}}}, map[string]any{}},
+		}},
+		{"flow with a comment", "a: [b, c] # d, e]\n", map[string]any{"a": []any{"b", "c"}}},
+		{"top-level scalar", "just text\n", "just text"},
+		{"CRLF", "a: 1\r\nb:\r\n  - c\r\n", map[string]any{"a": int64(1), "b": []any{"c"}}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseYAML("test.yaml", []byte(tt.yaml))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %#v\nwant %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseYAMLErrors(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		yaml string
+		err  string
+	}{
+		{"tab", "a:\n\tb: 1\n", "test.yaml:2: indent with spaces, not tabs"},
+		{"duplicate key", "a: 1\nb: 2\na: 3\n", `test.yaml:3: key "a" appears twice`},
+		{"duplicate flow key", "a: {b: 1, b: 2}\n", `test.yaml:1: key "b" appears twice`},
+		{"anchor", "a: &x 1\nb: *x\n", "test.yaml:1: \"&x 1\": anchors, tags and multi-line scalars are not supported"},
+		{"alias", "b: *x\n", "test.yaml:1: \"*x\": anchors"},
+		{"tag", "a: !!str 1\n", "test.yaml:1: \"!!str 1\": anchors"},
+		{"literal block scalar", "a: |\n  line one\n  line two\n", "test.yaml:1: \"|\": anchors, tags and multi-line scalars"},
+		{"folded block scalar", "a: >\n  folded\n", "test.yaml:1: \">\": anchors"},
+		{"multi-line plain scalar", "a: first\n  continued\n", "test.yaml:2: unexpected indentation"},
+		{"multi-line quoted scalar", "a: \"first\n  continued\"\n", "test.yaml:1: unterminated string \"first"},
+		{"multi-line flow", "a: [b,\n  c]\n", `test.yaml:1: missing ']'`},
+		{"unclosed flow", "a: {b: 1\n", `test.yaml:1: missing '}'`},
+		{"flow key without value", "a: {b}\n", "test.yaml:1: expected ':' after b}"},
+		{"after flow", "a: [b] c\n", `test.yaml:1: unexpected "c"`},
+		{"after quotes", `a: "b" c`, `test.yaml:1: unexpected "c"`},
+		{"complex key", "? a\n: b\n", `test.yaml:1: "? a": complex keys are not supported`},
+		{"second document", "a: 1\n---\nb: 2\n", `test.yaml:2: expected a key: value pair, found "---"`},
+		{"item in a mapping", "a: 1\n- b\n", `test.yaml:2: expected a key: value pair, found "- b"`},
+		{"bad escape", `a: "\q"`, `test.yaml:1: bad string "\q"`},
+		{"dedent", "a:\n    b: 1\n  c: 2\n", "test.yaml:3: unexpected indentation"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			v, err := parseYAML("test.yaml", []byte(tt.yaml))
+			if err == nil || !strings.HasPrefix(err.Error(), tt.err) {
+				t.Errorf("got %#v, error %v; want an error starting %q", v, err, tt.err)
+			}
+		})
+	}
+}
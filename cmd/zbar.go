@@ -0,0 +1,10 @@
+//go:build !noexec && !js && !wasip1
+
+package main
+
+import "github.com/thnkr-one/pdfripper/pdfripper"
+
+// newBarcodeDecoder returns the decoder used by "pdfripper barcodes".
+func newBarcodeDecoder() (pdfripper.BarcodeDecoder, error) {
+	return &pdfripper.ZBar{}, nil
+}
@@ -0,0 +1,14 @@
+//go:build noexec || js || wasip1
+
+package main
+
+import (
+	"errors"
+
+	"github.com/thnkr-one/pdfripper/pdfripper"
+)
+
+// newBarcodeDecoder would start a zbarimg process, which this build leaves out.
+func newBarcodeDecoder() (pdfripper.BarcodeDecoder, error) {
+	return nil, errors.New("barcode decoding is not available in builds without subprocess support")
+}
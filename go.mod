@@ -1,3 +1,3 @@
-module pdfripper
+module github.com/thnkr-one/pdfripper
 
 go 1.22.3
@@ -0,0 +1,128 @@
+package pdfripper
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// CPU affinity modes accepted by ParseCPUAffinity, besides explicit CPU
+// lists.
+const (
+	AffinityCPU  = "cpu"  // Pin each command to one CPU, taking the CPUs in turn.
+	AffinityNode = "node" // Pin each command to the CPUs of one NUMA node, taking the nodes in turn.
+)
+
+// CPUAffinity spreads commands over sets of CPUs, pinning each command to
+// the next set in turn, as taskset would. On machines with several NUMA
+// nodes, pinning to a node's CPUs keeps a command's memory on that node
+// instead of letting the scheduler move it across. A CPUAffinity is safe
+// for concurrent use and shared by the copies of a Sandbox.
+type CPUAffinity struct {
+	sets [][]int
+	next atomic.Uint64
+}
+
+// NewCPUAffinity returns a CPUAffinity taking the given sets of CPU
+// numbers in turn.
+func NewCPUAffinity(sets [][]int) (*CPUAffinity, error) {
+	if len(sets) == 0 {
+		return nil, errors.New("no CPU sets given")
+	}
+	for _, set := range sets {
+		if len(set) == 0 {
+			return nil, errors.New("empty CPU set")
+		}
+		for _, cpu := range set {
+			if cpu < 0 {
+				return nil, fmt.Errorf("CPU %d is negative", cpu)
+			}
+		}
+	}
+	return &CPUAffinity{sets: sets}, nil
+}
+
+// ParseCPUAffinity returns the CPUAffinity described by spec: AffinityCPU
+// or AffinityNode, which use the CPUs this process may run on, or
+// semicolon-separated CPU lists such as "0-15;16-31" that are taken in
+// turn. CPU lists have the form of taskset -c and Linux's cpulist files,
+// "0-3,8,10-11".
+func ParseCPUAffinity(spec string) (*CPUAffinity, error) {
+	switch spec {
+	case AffinityCPU:
+		allowed, err := allowedCPUs()
+		if err != nil {
+			return nil, err
+		}
+		var sets [][]int
+		for _, cpu := range allowed {
+			sets = append(sets, []int{cpu})
+		}
+		return NewCPUAffinity(sets)
+	case AffinityNode:
+		nodes, err := numaNodes()
+		if err != nil {
+			return nil, err
+		}
+		allowed, err := allowedCPUs()
+		if err != nil {
+			return nil, err
+		}
+		// Leave out the CPUs a cpuset or taskset keeps this process off.
+		var sets [][]int
+		for _, node := range nodes {
+			var set []int
+			for _, cpu := range node {
+				if slices.Contains(allowed, cpu) {
+					set = append(set, cpu)
+				}
+			}
+			if len(set) > 0 {
+				sets = append(sets, set)
+			}
+		}
+		return NewCPUAffinity(sets)
+	}
+	var sets [][]int
+	for _, list := range strings.Split(spec, ";") {
+		set, err := ParseCPUList(list)
+		if err != nil {
+			return nil, err
+		}
+		sets = append(sets, set)
+	}
+	return NewCPUAffinity(sets)
+}
+
+// ParseCPUList parses a CPU list such as "0-3,8,10-11".
+func ParseCPUList(list string) ([]int, error) {
+	var cpus []int
+	for _, part := range strings.Split(strings.TrimSpace(list), ",") {
+		from, to, isRange := strings.Cut(part, "-")
+		first, err := strconv.Atoi(from)
+		last := first
+		if err == nil && isRange {
+			last, err = strconv.Atoi(to)
+		}
+		if err != nil || first < 0 || last < first {
+			return nil, fmt.Errorf("bad CPU list %q", list)
+		}
+		for cpu := first; cpu <= last; cpu++ {
+			cpus = append(cpus, cpu)
+		}
+	}
+	return cpus, nil
+}
+
+// Sets returns the CPU sets commands are pinned to in turn.
+func (a *CPUAffinity) Sets() [][]int {
+	return a.sets
+}
+
+// nextSet returns the CPU set for the next command.
+func (a *CPUAffinity) nextSet() []int {
+	return a.sets[(a.next.Add(1)-1)%uint64(len(a.sets))]
+}
@@ -0,0 +1,129 @@
+package pdfripper
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Defaults of an Agreement.
+const (
+	DefaultAgreementPages     = 10
+	DefaultAgreementThreshold = 0.9
+)
+
+// Agreement measures how far the text of a run can be trusted by
+// extracting a sample of its pages with a second backend as well, set as
+// Extractor.Agreement. Each sampled page gets the TextSimilarity of its
+// text, as extracted or OCRed and before post-processing, to the second
+// backend's; a page the second backend fails on scores 0. A document
+// whose pages agree less than Threshold on average needs review.
+type Agreement struct {
+	Backend   Backend // The second backend, which should not be the run's own.
+	Pages     int     // Pages compared, spread evenly over those extracted (default: DefaultAgreementPages).
+	Threshold float64 // Mean agreement below which the document needs review (default: DefaultAgreementThreshold).
+}
+
+// AgreementReport is the outcome of an Agreement for a document, which
+// manifest.json records.
+type AgreementReport struct {
+	Backend     string  `json:"backend"` // The second backend.
+	Pages       int     `json:"pages"`   // Pages compared.
+	Mean        float64 `json:"mean"`
+	Min         float64 `json:"min"`
+	NeedsReview bool    `json:"needs_review"` // Mean is below the Agreement's Threshold.
+}
+
+// agreementCheck compares the pages of one run.
+type agreementCheck struct {
+	backend   Backend
+	threshold float64
+	pages     []bool // By page number, those to compare.
+
+	mu       sync.Mutex
+	n        int
+	sum, min float64
+}
+
+// startAgreement sets e.agreement for a run of totalPages, if Agreement
+// is set.
+func (e *Extractor) startAgreement(totalPages int) {
+	e.agreement = nil
+	a := e.Agreement
+	if a == nil {
+		return
+	}
+	c := &agreementCheck{backend: a.Backend, threshold: a.Threshold, pages: make([]bool, totalPages+1), min: 1}
+	if c.threshold <= 0 {
+		c.threshold = DefaultAgreementThreshold
+	}
+	k := a.Pages
+	if k <= 0 {
+		k = DefaultAgreementPages
+	}
+	// The page in the middle of each of k equal stretches of the pages
+	// extracted, in page order.
+	var extracted []int
+	for p := 1; p <= totalPages; p++ {
+		if e.included(p) {
+			extracted = append(extracted, p)
+		}
+	}
+	k = min(k, len(extracted))
+	if k == 0 {
+		return
+	}
+	for i := 0; i < k; i++ {
+		c.pages[extracted[(2*i+1)*len(extracted)/(2*k)]] = true
+	}
+	e.agreement = c
+}
+
+// compare extracts r's page with the second backend, if it is one to
+// compare, and records how alike the texts are. The usage of the second
+// backend's commands is added to r's.
+func (c *agreementCheck) compare(pdfFile string, r *PageResult) {
+	if c == nil || r.Err != nil || !c.pages[r.Page] {
+		return
+	}
+	score := 0.0
+	m := &usageMeter{}
+	text, err := metering(c.backend, m).ExtractPage(pdfFile, r.Page)
+	r.Usage.add(m.total())
+	if err == nil {
+		score = TextSimilarity(r.Text, text)
+	} else {
+		fmt.Printf("Page %d: %s failed on it for the agreement check: %v\n", r.Page, c.backend.Name(), err)
+	}
+	r.Agreement = &score
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.n++
+	c.sum += score
+	c.min = min(c.min, score)
+}
+
+// report returns the outcome, or nil if no page was compared.
+func (c *agreementCheck) report() *AgreementReport {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.n == 0 {
+		return nil
+	}
+	mean := c.sum / float64(c.n)
+	return &AgreementReport{Backend: c.backend.Name(), Pages: c.n, Mean: mean, Min: c.min, NeedsReview: mean < c.threshold}
+}
+
+// reportAgreement prints the outcome of the run's agreement check.
+func (e *Extractor) reportAgreement() {
+	r := e.agreement.report()
+	switch {
+	case r == nil:
+	case r.NeedsReview:
+		fmt.Printf("Warning: %s and %s agree only %.0f%% on %d sampled pages (the worst %.0f%%); the document needs review\n", e.Backend.Name(), r.Backend, 100*r.Mean, r.Pages, 100*r.Min)
+	default:
+		fmt.Printf("%s and %s agree %.0f%% on %d sampled pages\n", e.Backend.Name(), r.Backend, 100*r.Mean, r.Pages)
+	}
+}
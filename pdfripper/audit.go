@@ -0,0 +1,168 @@
+package pdfripper
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"hash"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// AuditEntry is the record of one external command in an AuditLog, one
+// JSON object per line.
+type AuditEntry struct {
+	Time         time.Time `json:"time"` // When it was started.
+	Path         string    `json:"path"` // The executable run, as found in $PATH.
+	Argv         []string  `json:"argv"`
+	DurationMS   float64   `json:"duration_ms"`
+	ExitCode     int       `json:"exit_code"` // -1 if it did not start, or was killed by a signal.
+	StderrBytes  int64     `json:"stderr_bytes"`
+	StderrSHA256 string    `json:"stderr_sha256"` // Of all it wrote to standard error, which is not recorded itself.
+	Error        string    `json:"error,omitempty"`
+	PID          int       `json:"pid"` // Of the process that ran it.
+}
+
+// AuditLog records every external command run, for security reviews
+// that must account for them. Entries are appended to its file in single
+// writes, so the processes of a batch can share one.
+type AuditLog struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// OpenAuditLog opens path for appending entries, creating it readable by
+// its owner only if it does not exist.
+func OpenAuditLog(path string) (*AuditLog, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	return NewAuditLog(f), nil
+}
+
+// NewAuditLog returns an AuditLog writing its entries to w.
+func NewAuditLog(w io.Writer) *AuditLog {
+	return &AuditLog{w: w}
+}
+
+// Record appends e to the log.
+func (l *AuditLog) Record(e AuditEntry) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, err = l.w.Write(append(data, '\n'))
+	return err
+}
+
+// Close closes the log's file, if it has one.
+func (l *AuditLog) Close() error {
+	if c, ok := l.w.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+var auditLog atomic.Pointer[AuditLog]
+
+// SetAuditLog makes l record every command ExecRunner runs, and those
+// reported with StartAudit; nil stops the recording. Commands of other
+// Runners are recorded only if they report them.
+func SetAuditLog(l *AuditLog) {
+	auditLog.Store(l)
+}
+
+// CommandAudit records a command in the AuditLog once it has finished.
+// The methods of a nil CommandAudit do nothing, so that callers need not
+// check whether a log is set.
+type CommandAudit struct {
+	log    *AuditLog
+	entry  AuditEntry
+	start  time.Time
+	stderr hash.Hash
+}
+
+// StartAudit starts the record of a command run from path with argv, as
+// in exec.Cmd, returning nil if no AuditLog is set. Passwords in argv are
+// recorded as xxxxx, as url.URL.Redacted records them.
+func StartAudit(path string, argv []string) *CommandAudit {
+	l := auditLog.Load()
+	if l == nil {
+		return nil
+	}
+	start := time.Now()
+	return &CommandAudit{
+		log:    l,
+		entry:  AuditEntry{Time: start.UTC(), Path: path, Argv: redactArgv(argv), PID: os.Getpid()},
+		start:  start,
+		stderr: sha256.New(),
+	}
+}
+
+// Stderr returns a writer for the command's standard error that passes it
+// on to w, or discards it if w is nil, digesting it.
+func (a *CommandAudit) Stderr(w io.Writer) io.Writer {
+	if a == nil {
+		return w
+	}
+	if w == nil {
+		return a
+	}
+	return io.MultiWriter(w, a)
+}
+
+func (a *CommandAudit) Write(p []byte) (int, error) {
+	a.entry.StderrBytes += int64(len(p))
+	return a.stderr.Write(p)
+}
+
+// Finish records the command as having ended with err, the error of
+// starting or waiting for it.
+func (a *CommandAudit) Finish(err error) error {
+	if a == nil {
+		return nil
+	}
+	e := a.entry
+	e.DurationMS = float64(time.Since(a.start).Microseconds()) / 1000
+	e.StderrSHA256 = hex.EncodeToString(a.stderr.Sum(nil))
+	if err != nil {
+		e.ExitCode = -1
+		var exit exitCoder
+		if errors.As(err, &exit) {
+			e.ExitCode = exit.ExitCode()
+		}
+		e.Error = err.Error()
+	}
+	return a.log.Record(e)
+}
+
+// passwordFlags are the flags whose values redactArgv hides: the user and
+// owner passwords of the poppler tools, and pdfripper's -password.
+var passwordFlags = []string{"-upw", "-opw", "-password", "--password"}
+
+// redactArgv returns a copy of argv with the values of passwordFlags, as
+// separate arguments or after "=", replaced by xxxxx.
+func redactArgv(argv []string) []string {
+	out := slices.Clone(argv)
+	for i := 1; i < len(out); i++ {
+		name, _, hasValue := strings.Cut(out[i], "=")
+		switch {
+		case !slices.Contains(passwordFlags, name):
+		case hasValue:
+			out[i] = name + "=xxxxx"
+		case i+1 < len(out):
+			i++
+			out[i] = "xxxxx"
+		}
+	}
+	return out
+}
@@ -0,0 +1,187 @@
+package pdfripper
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// DefaultAutoscaleInterval is how often an Autoscaler reconsiders the
+// worker count by default.
+const DefaultAutoscaleInterval = 2 * time.Second
+
+// Thresholds of an Autoscaler's steps.
+const (
+	cpuSaturated  = 0.9  // Share of the CPUs' time busy above which they have no room for more workers.
+	stepGain      = 1.05 // Factor by which calls a second must change for a step to have made a difference.
+	autoscaleHold = 5    // Intervals without a step after one was taken back.
+)
+
+// Autoscaler raises and lowers the number of backend and OCR calls a run
+// makes at once, set as Extractor.Autoscale, since the best number differs
+// widely between documents: text-only pages keep the CPUs busy with a
+// worker or so each, while OCR engines that wait on other processes or
+// remote services need many more. The run starts with ProcessCount
+// workers; then every Interval the count takes a step:
+//
+//   - up, while the CPUs have room and the last step up raised the calls
+//     finished a second;
+//   - back down, if the last step up did not, and back up if the last step
+//     down cost calls a second, holding there for a while after either;
+//   - down, while the CPUs are saturated and calls take longer than they
+//     did, as they do when workers only compete for them.
+//
+// The CPUs' use is that of the process and the commands it ran; where it
+// cannot be measured, they are taken to have room. An interval in which
+// no call finished, as with pages that take longer than it, is skipped.
+type Autoscaler struct {
+	Min      int           // Fewest workers (default: 1).
+	Max      int           // Most workers (default: twice the number of CPUs).
+	Interval time.Duration // How often the count is reconsidered (default: DefaultAutoscaleInterval).
+}
+
+// bounds returns Min and Max with their defaults.
+func (a *Autoscaler) bounds() (lo, hi int) {
+	lo, hi = max(a.Min, 1), a.Max
+	if hi <= 0 {
+		hi = 2 * runtime.NumCPU()
+	}
+	return lo, max(hi, lo)
+}
+
+// scaler is the gate of a run's calls an Autoscaler moves.
+type scaler struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	limit  int
+	active int
+	done   int           // Calls finished since the last step.
+	busy   time.Duration // Time spent in them, summed over the calls in flight.
+	since  time.Time     // Of the last change of active.
+}
+
+func (s *scaler) acquire() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for s.active >= s.limit {
+		s.cond.Wait()
+	}
+	s.account()
+	s.active++
+}
+
+func (s *scaler) release() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.account()
+	s.active--
+	s.done++
+	s.cond.Signal()
+}
+
+// account adds the time since the last change to busy. s.mu must be held.
+func (s *scaler) account() {
+	now := time.Now()
+	s.busy += time.Duration(s.active) * now.Sub(s.since)
+	s.since = now
+}
+
+// take returns the calls finished, and the time spent in them, since the
+// last take.
+func (s *scaler) take() (done int, busy time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.account()
+	done, busy = s.done, s.busy
+	s.done, s.busy = 0, 0
+	return done, busy
+}
+
+// setLimit lets n calls be made at once.
+func (s *scaler) setLimit(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.limit = n
+	s.cond.Broadcast()
+}
+
+// startAutoscale sets e.scaler for a run if Autoscale is set, returning a
+// function that stops it.
+func (e *Extractor) startAutoscale() func() {
+	if e.Autoscale == nil {
+		return func() {}
+	}
+	lo, hi := e.Autoscale.bounds()
+	interval := e.Autoscale.Interval
+	if interval <= 0 {
+		interval = DefaultAutoscaleInterval
+	}
+	s := &scaler{limit: min(max(e.ProcessCount, lo), hi), since: time.Now()}
+	s.cond = sync.NewCond(&s.mu)
+	e.scaler = s
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		limit := s.limit
+		last, hold := 0, 0 // The last step taken, and intervals left without one.
+		var rate float64
+		var latency time.Duration
+		lastTick := time.Now()
+		lastCPU, cpuKnown := cpuTime()
+		for {
+			select {
+			case <-done:
+				return
+			case now := <-ticker.C:
+				elapsed := now.Sub(lastTick)
+				lastTick = now
+				cpu, ok := cpuTime()
+				busyCPUs := float64(cpu-lastCPU) / float64(elapsed) / float64(runtime.NumCPU())
+				lastCPU, cpuKnown = cpu, ok && cpuKnown
+				saturated := cpuKnown && busyCPUs >= cpuSaturated
+				n, busy := s.take()
+				if n == 0 {
+					continue
+				}
+				r := float64(n) / elapsed.Seconds()
+				l := busy / time.Duration(n)
+				step := 0
+				switch {
+				case last > 0 && r < rate*stepGain:
+					step, hold = -1, autoscaleHold
+				case last < 0 && r*stepGain < rate:
+					step, hold = 1, autoscaleHold
+				case hold > 0:
+					hold--
+				case saturated && latency > 0 && l > latency*6/5:
+					step = -1
+				case !saturated:
+					step = 1
+				}
+				next := min(max(limit+step, lo), hi)
+				if next == limit {
+					step = 0
+				}
+				last, rate, latency = step, r, l
+				if step != 0 {
+					limit = next
+					s.setLimit(limit)
+					use := ""
+					if cpuKnown {
+						use = fmt.Sprintf("CPUs %.0f%% busy, ", 100*busyCPUs)
+					}
+					fmt.Printf("Autoscaling to %d workers (%s%.1f calls a second, %s each)\n", limit, use, r, l.Round(time.Millisecond))
+				}
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-stopped
+		e.scaler = nil
+	}
+}
@@ -0,0 +1,11 @@
+//go:build !linux && !darwin
+
+package pdfripper
+
+import "time"
+
+// cpuTime cannot measure CPU time on this platform, so an Autoscaler takes
+// the CPUs to have room.
+func cpuTime() (time.Duration, bool) {
+	return 0, false
+}
@@ -0,0 +1,22 @@
+//go:build linux || darwin
+
+package pdfripper
+
+import (
+	"syscall"
+	"time"
+)
+
+// cpuTime returns the CPU time used by the process and the commands it
+// has waited for.
+func cpuTime() (time.Duration, bool) {
+	var total time.Duration
+	for _, who := range []int{syscall.RUSAGE_SELF, syscall.RUSAGE_CHILDREN} {
+		var ru syscall.Rusage
+		if err := syscall.Getrusage(who, &ru); err != nil {
+			return 0, false
+		}
+		total += time.Duration(ru.Utime.Nano() + ru.Stime.Nano())
+	}
+	return total, true
+}
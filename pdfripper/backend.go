@@ -0,0 +1,111 @@
+package pdfripper
+
+import (
+	"fmt"
+	"image"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Backend turns the pages of a PDF file into text.
+// Implementations must be safe for concurrent use by multiple workers.
+type Backend interface {
+	// Name is the identifier used to select the backend (e.g. with -backend).
+	Name() string
+	// PageCount reports the number of pages in pdfFile.
+	PageCount(pdfFile string) (int, error)
+	// ExtractPage returns the text of a single 1-indexed page.
+	ExtractPage(pdfFile string, page int) (string, error)
+}
+
+// RangeExtractor is implemented by backends that can extract several
+// consecutive pages in one call, which is much cheaper than one call per
+// page when every call spawns a subprocess.
+type RangeExtractor interface {
+	// ExtractRange returns the text of pages first..last (inclusive, 1-indexed),
+	// one element per page.
+	ExtractRange(pdfFile string, first, last int) ([]string, error)
+}
+
+// Renderer is implemented by backends that can rasterize pages, for
+// example to feed an OCR engine.
+type Renderer interface {
+	// RenderPage renders a 1-indexed page at the given resolution in dots per inch.
+	RenderPage(pdfFile string, page, dpi int) (image.Image, error)
+}
+
+// Sandboxer is implemented by backends that run external commands on the
+// input, which can be confined further when processing untrusted files.
+type Sandboxer interface {
+	// WithSandbox returns a copy of the backend that runs its commands
+	// under sb.
+	WithSandbox(sb Sandbox) Backend
+}
+
+// Commander is implemented by backends that run external commands, whose
+// Runner can be replaced, for example by a fake in tests.
+type Commander interface {
+	// WithRunner returns a copy of the backend that runs its commands
+	// with r.
+	WithRunner(r Runner) Backend
+}
+
+// Prober is implemented by backends that run external tools whose options
+// differ between the versions installed.
+type Prober interface {
+	// Probe finds what the installed tools support, returning a copy of
+	// the backend that uses only that, with warnings for what it does
+	// without; an error if it cannot work with them at all.
+	Probe() (Backend, []string, error)
+}
+
+// VerticalTexter is implemented by backends whose handling of vertically
+// typeset text, such as Japanese tategaki, can be chosen.
+type VerticalTexter interface {
+	// WithVerticalText returns a copy of the backend that handles
+	// vertical text according to mode, one of VerticalTextModes.
+	WithVerticalText(mode string) Backend
+	// VerticalText reports the mode in use.
+	VerticalText() string
+}
+
+var (
+	backendsMu sync.RWMutex
+	backends   = map[string]Backend{}
+)
+
+// RegisterBackend makes a backend available by name. Registering a second
+// backend under the same name replaces the first.
+func RegisterBackend(b Backend) {
+	backendsMu.Lock()
+	defer backendsMu.Unlock()
+	backends[b.Name()] = b
+}
+
+// LookupBackend returns the registered backend with the given name.
+func LookupBackend(name string) (Backend, error) {
+	backendsMu.RLock()
+	defer backendsMu.RUnlock()
+	b, ok := backends[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown backend %q (available: %s)", name, strings.Join(backendNames(), ", "))
+	}
+	return b, nil
+}
+
+// Backends returns the names of all registered backends, sorted.
+func Backends() []string {
+	backendsMu.RLock()
+	defer backendsMu.RUnlock()
+	return backendNames()
+}
+
+func backendNames() []string {
+	names := make([]string, 0, len(backends))
+	for name := range backends {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
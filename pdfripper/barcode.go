@@ -0,0 +1,108 @@
+package pdfripper
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"sort"
+	"sync"
+)
+
+// Barcode is one barcode or QR code found on a page.
+type Barcode struct {
+	Page      int     `json:"page"`
+	Symbology string  `json:"symbology"` // As named by the decoder, e.g. "QR-Code", "EAN-13", "CODE-128".
+	Value     string  `json:"value"`
+	X         float64 `json:"x"` // Bounding box in points from the top-left corner of the rendered page.
+	Y         float64 `json:"y"`
+	Width     float64 `json:"width"`
+	Height    float64 `json:"height"`
+}
+
+// BarcodeDecoder finds barcodes in a rendered page. Positions are returned
+// in pixels; ExtractBarcodes converts them to points and sets Page.
+type BarcodeDecoder interface {
+	DecodeBarcodes(img image.Image) ([]Barcode, error)
+}
+
+// DefaultBarcodeDPI is the resolution pages are rendered at for barcode
+// decoding when BarcodeDPI is not set.
+const DefaultBarcodeDPI = 300
+
+// ExtractBarcodes renders every page with the backend and decodes the
+// barcodes on it with BarcodeDecoder, using ProcessCount workers. Results
+// are ordered by page. A page that fails stops nothing; the first error is
+// returned along with everything that was found.
+func (e *Extractor) ExtractBarcodes() ([]Barcode, error) {
+	if e.BarcodeDecoder == nil {
+		return nil, errors.New("no barcode decoder configured")
+	}
+	done, err := e.enterWorkspace()
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+	renderer, ok := e.Backend.(Renderer)
+	if !ok {
+		return nil, fmt.Errorf("barcode decoding needs a backend that can render pages; %s cannot", e.Backend.Name())
+	}
+	totalPages, err := e.prepare()
+	if err != nil {
+		return nil, err
+	}
+	dpi := e.BarcodeDPI
+	if dpi <= 0 {
+		dpi = DefaultBarcodeDPI
+	}
+	scale := 72 / float64(dpi)
+
+	pages := make(chan int)
+	go func() {
+		for p := 1; p <= totalPages; p++ {
+			pages <- p
+		}
+		close(pages)
+	}()
+
+	var (
+		mu    sync.Mutex
+		found []Barcode
+		errs  firstError
+		wg    sync.WaitGroup
+	)
+	for i := 0; i < min(max(e.ProcessCount, 1), totalPages); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for page := range pages {
+				img, err := renderer.RenderPage(e.PDFFile, page, dpi)
+				if err != nil {
+					errs.set(fmt.Errorf("rendering page %d: %w", page, err))
+					continue
+				}
+				codes, err := e.BarcodeDecoder.DecodeBarcodes(img)
+				if err != nil {
+					errs.set(fmt.Errorf("decoding barcodes on page %d: %w", page, err))
+					continue
+				}
+				for i := range codes {
+					c := &codes[i]
+					c.Page = page
+					c.X, c.Y, c.Width, c.Height = c.X*scale, c.Y*scale, c.Width*scale, c.Height*scale
+				}
+				mu.Lock()
+				found = append(found, codes...)
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	sort.SliceStable(found, func(i, j int) bool {
+		if found[i].Page != found[j].Page {
+			return found[i].Page < found[j].Page
+		}
+		return found[i].Y < found[j].Y
+	})
+	return found, errs.err
+}
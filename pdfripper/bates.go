@@ -0,0 +1,153 @@
+package pdfripper
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Limits used when looking for Bates numbers.
+const (
+	batesBand  = 0.07 // Share of the page height, at the top and bottom, searched for Bates numbers.
+	batesLines = 3    // Lines at the start and end of a page's text searched when positions are unknown.
+)
+
+// batesRe matches a Bates number: an upper-case prefix, such as a party's
+// initials, and a zero-padded number of at least six digits, as in
+// "ABC0001234", "SMITH-DEP 000123" or "DOJ_00042117".
+var batesRe = regexp.MustCompile(`\b[A-Z]{1,12}(?:[-_][A-Z]{1,12})*[-_ ]?\d{6,10}\b`)
+
+// BatesNumbers finds the Bates number stamped on every page of a
+// document, in order, with "" for pages that have none. Bates numbers are
+// looked for near the bottom and top edges of each page as displayed,
+// bottom first, and the one closest to a corner is taken. Pages whose
+// content cannot be parsed have none.
+func BatesNumbers(pdfFile string) ([]string, error) {
+	d, err := openPDFFile(pdfFile)
+	if err != nil {
+		return nil, err
+	}
+	numbers := make([]string, len(d.pages))
+	for i := range d.pages {
+		numbers[i], _, _ = d.pageBates(i)
+	}
+	return numbers, nil
+}
+
+// pageBates finds the Bates number of page index. hasText reports whether
+// the page draws any visible text, without which a stamp can only be in
+// the page's image.
+func (d *pdfDoc) pageBates(index int) (number string, hasText bool, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			number, hasText, err = "", false, fmt.Errorf("parsing page %d: %v", index+1, r)
+		}
+	}()
+	frags, err := d.pageFragments(index)
+	if err != nil {
+		return "", false, err
+	}
+	p := d.pages[index]
+	type candidate struct {
+		number string
+		// Distance from the nearest corner, as shares of the page, with
+		// the bottom preferred.
+		rank float64
+	}
+	var found []candidate
+	lines := visibleLines(frags)
+	for _, line := range lines {
+		x0, y0, x1, y1 := textBounds(line)
+		top := math.Min(displayedY(p, x0, y0), displayedY(p, x1, y1))
+		bottom := math.Max(displayedY(p, x0, y0), displayedY(p, x1, y1))
+		left := math.Min(displayedX(p, x0, y0), displayedX(p, x1, y1))
+		right := math.Max(displayedX(p, x0, y0), displayedX(p, x1, y1))
+		var rank float64
+		switch {
+		case bottom >= 1-batesBand:
+			rank = 1 - bottom
+		case top <= batesBand:
+			rank = 1 + top
+		default:
+			continue
+		}
+		number := batesRe.FindString(layoutLines(line))
+		if number == "" {
+			continue
+		}
+		found = append(found, candidate{number, rank + math.Min(left, 1-right)})
+	}
+	if len(found) == 0 {
+		return "", len(lines) > 0, nil
+	}
+	sort.SliceStable(found, func(i, j int) bool { return found[i].rank < found[j].rank })
+	return found[0].number, true, nil
+}
+
+// displayedY returns where a point of page p falls down the page as
+// displayed, as a fraction of its height from the top edge.
+func displayedY(p pdfPage, x, y float64) float64 {
+	box := p.mediaBox
+	switch ((p.rotate % 360) + 360) % 360 {
+	case 90:
+		return (x - box[0]) / (box[2] - box[0])
+	case 180:
+		return (y - box[1]) / (box[3] - box[1])
+	case 270:
+		return (box[2] - x) / (box[2] - box[0])
+	}
+	return (box[3] - y) / (box[3] - box[1])
+}
+
+// textBates finds a Bates number among the last and first few lines of a
+// page's text, for pages whose layout is unknown, last lines first.
+func textBates(text string) string {
+	var lines []string
+	for _, l := range strings.Split(text, "\n") {
+		if strings.TrimSpace(l) != "" {
+			lines = append(lines, l)
+		}
+	}
+	for k := len(lines) - 1; k >= 0 && k >= len(lines)-batesLines; k-- {
+		if number := batesRe.FindString(lines[k]); number != "" {
+			return number
+		}
+	}
+	for k := 0; k < len(lines) && k < batesLines; k++ {
+		if number := batesRe.FindString(lines[k]); number != "" {
+			return number
+		}
+	}
+	return ""
+}
+
+// bates reports whether this run looks for Bates numbers.
+func (e *Extractor) bates() bool {
+	return e.Bates || e.BatesFileNames
+}
+
+// findBates sets the page's Bates number, from the positions of its text
+// when the input was parsed by openDoc, and from the first and last lines
+// of the text otherwise or when the page draws no text, as scans given to
+// OCR do not.
+func (e *Extractor) findBates(r *PageResult) {
+	if e.doc != nil {
+		number, hasText, err := e.doc.pageBates(r.Page - 1)
+		if err != nil {
+			fmt.Printf("Page %d: could not look for a Bates number: %v\n", r.Page, err)
+		}
+		if hasText {
+			r.Bates = number
+			return
+		}
+	}
+	r.Bates = textBates(r.Text)
+}
+
+// batesFileName returns the base name of the files of a page named after
+// its Bates number, with spaces replaced, or "" if it has none.
+func batesFileName(r *PageResult) string {
+	return strings.ReplaceAll(r.Bates, " ", "_")
+}
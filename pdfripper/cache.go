@@ -0,0 +1,117 @@
+package pdfripper
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// Cache stores extracted text between runs, so repeated extractions of the
+// same document with the same options skip the backend entirely.
+// Implementations must be safe for concurrent use.
+type Cache interface {
+	Get(key string) (string, bool)
+	Put(key, value string) error
+}
+
+// DirCache is a Cache that keeps one file per entry under a directory,
+// sharded by the first two characters of the key.
+type DirCache struct {
+	Dir string
+}
+
+// NewDirCache creates the cache directory if needed.
+func NewDirCache(dir string) (*DirCache, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("creating cache directory: %w", err)
+	}
+	return &DirCache{Dir: dir}, nil
+}
+
+func (c *DirCache) path(key string) string {
+	return filepath.Join(c.Dir, key[:2], key)
+}
+
+func (c *DirCache) Get(key string) (string, bool) {
+	data, err := os.ReadFile(c.path(key))
+	if err != nil {
+		return "", false
+	}
+	return string(data), true
+}
+
+// Put writes the entry to a temporary file and renames it into place, so
+// concurrent readers never see a partial entry.
+func (c *DirCache) Put(key, value string) error {
+	p := c.path(key)
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(p), key+".tmp*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.WriteString(value); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), p)
+}
+
+// hashFile returns the hex SHA-256 of a file's contents.
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// cacheOptions describes every setting that changes extracted text. Entries
+// made under different options never collide.
+func (e *Extractor) cacheOptions() string {
+	if v, ok := e.Backend.(VerticalTexter); ok && v.VerticalText() != VerticalAuto {
+		return e.Backend.Name() + "\x00vertical=" + v.VerticalText()
+	}
+	return e.Backend.Name()
+}
+
+// cacheKey derives the cache key for one item (a page number or "pages"
+// for the page count) of the current document.
+func (e *Extractor) cacheKey(item string) string {
+	sum := sha256.Sum256([]byte(e.fileHash + "\x00" + e.cacheOptions() + "\x00" + item))
+	return hex.EncodeToString(sum[:])
+}
+
+// cachedPage returns the cached text of a page, if any.
+func (e *Extractor) cachedPage(page int) (string, bool) {
+	if e.Cache == nil {
+		return "", false
+	}
+	return e.Cache.Get(e.cacheKey(strconv.Itoa(page)))
+}
+
+// cachePut stores an entry, reporting but otherwise ignoring failures: a
+// broken cache must not fail the extraction.
+func (e *Extractor) cachePut(item, value string) {
+	if e.Cache == nil {
+		return
+	}
+	if err := e.Cache.Put(e.cacheKey(item), value); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: caching %s: %v\n", item, err)
+	}
+}
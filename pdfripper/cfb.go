@@ -0,0 +1,223 @@
+package pdfripper
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"unicode/utf16"
+)
+
+// cfbSignature starts every compound file, the container of Outlook .msg
+// files and other OLE documents.
+var cfbSignature = []byte{0xD0, 0xCF, 0x11, 0xE0, 0xA1, 0xB1, 0x1A, 0xE1}
+
+const (
+	cfbEndOfChain = 0xFFFFFFFE
+	cfbNoStream   = 0xFFFFFFFF
+	cfbStorage    = 1
+	cfbStream     = 2
+	cfbRoot       = 5
+)
+
+// cfbFile is a compound file read into memory: a little filesystem of
+// storages, which are directories, and streams.
+type cfbFile struct {
+	data       []byte
+	sectorSize int
+	fat        []uint32
+	miniFAT    []uint32
+	miniStream []byte
+	entries    []cfbEntry
+}
+
+// cfbEntry is an entry of a compound file's directory.
+type cfbEntry struct {
+	name               string
+	kind               byte
+	left, right, child uint32
+	start              uint32
+	size               uint64
+}
+
+// cfbNode is a storage or stream as storageAt finds it.
+type cfbNode struct {
+	f *cfbFile
+	e cfbEntry
+}
+
+// openCFB parses the structure of a compound file.
+func openCFB(data []byte) (*cfbFile, error) {
+	if len(data) < 512 || !bytes.Equal(data[:8], cfbSignature) {
+		return nil, errors.New("not a compound file")
+	}
+	le := binary.LittleEndian
+	shift := le.Uint16(data[0x1E:])
+	if shift != 9 && shift != 12 {
+		return nil, fmt.Errorf("compound file has bad sector shift %d", shift)
+	}
+	f := &cfbFile{data: data, sectorSize: 1 << shift}
+
+	// The sectors of the FAT are listed in the header and then in a
+	// chain of DIFAT sectors.
+	var fatSectors []uint32
+	for i := 0; i < 109; i++ {
+		fatSectors = append(fatSectors, le.Uint32(data[0x4C+4*i:]))
+	}
+	perSector := f.sectorSize / 4
+	next := le.Uint32(data[0x44:])
+	for n := le.Uint32(data[0x48:]); n > 0 && next < cfbEndOfChain; n-- {
+		sec, err := f.sector(next)
+		if err != nil {
+			return nil, err
+		}
+		for i := 0; i < perSector-1; i++ {
+			fatSectors = append(fatSectors, le.Uint32(sec[4*i:]))
+		}
+		next = le.Uint32(sec[4*(perSector-1):])
+	}
+	for _, s := range fatSectors[:min(int(le.Uint32(data[0x2C:])), len(fatSectors))] {
+		sec, err := f.sector(s)
+		if err != nil {
+			return nil, err
+		}
+		for i := 0; i < perSector; i++ {
+			f.fat = append(f.fat, le.Uint32(sec[4*i:]))
+		}
+	}
+
+	dir, err := f.chain(le.Uint32(data[0x30:]), -1)
+	if err != nil {
+		return nil, fmt.Errorf("reading directory: %w", err)
+	}
+	for off := 0; off+128 <= len(dir); off += 128 {
+		e := dir[off : off+128]
+		nameLen := min(int(le.Uint16(e[64:])), 64)
+		units := make([]uint16, 0, 32)
+		for i := 0; i+1 < nameLen-1; i += 2 {
+			units = append(units, le.Uint16(e[i:]))
+		}
+		f.entries = append(f.entries, cfbEntry{
+			name:  string(utf16.Decode(units)),
+			kind:  e[66],
+			left:  le.Uint32(e[68:]),
+			right: le.Uint32(e[72:]),
+			child: le.Uint32(e[76:]),
+			start: le.Uint32(e[116:]),
+			size:  le.Uint64(e[120:]),
+		})
+	}
+	if len(f.entries) == 0 || f.entries[0].kind != cfbRoot {
+		return nil, errors.New("compound file has no root storage")
+	}
+	if shift == 9 {
+		// Version 3 files leave the high half of sizes undefined.
+		for i := range f.entries {
+			f.entries[i].size &= 0xFFFFFFFF
+		}
+	}
+
+	miniFAT, err := f.chain(le.Uint32(data[0x3C:]), -1)
+	if err != nil {
+		return nil, fmt.Errorf("reading mini FAT: %w", err)
+	}
+	for i := 0; i+4 <= len(miniFAT); i += 4 {
+		f.miniFAT = append(f.miniFAT, le.Uint32(miniFAT[i:]))
+	}
+	root := f.entries[0]
+	if f.miniStream, err = f.chain(root.start, int64(root.size)); err != nil {
+		return nil, fmt.Errorf("reading mini stream: %w", err)
+	}
+	return f, nil
+}
+
+func (f *cfbFile) sector(n uint32) ([]byte, error) {
+	off := (int64(n) + 1) * int64(f.sectorSize)
+	if off+int64(f.sectorSize) > int64(len(f.data)) {
+		return nil, fmt.Errorf("sector %d is past the end of the file", n)
+	}
+	return f.data[off : off+int64(f.sectorSize)], nil
+}
+
+// chain reads the sectors of a chain starting at start, up to size bytes
+// if size is not negative.
+func (f *cfbFile) chain(start uint32, size int64) ([]byte, error) {
+	var out []byte
+	for n := start; n < cfbEndOfChain && (size < 0 || int64(len(out)) < size); n = f.fat[n] {
+		if int(n) >= len(f.fat) || len(out) > len(f.data) {
+			return nil, fmt.Errorf("broken sector chain at %d", n)
+		}
+		sec, err := f.sector(n)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, sec...)
+	}
+	if size >= 0 {
+		if int64(len(out)) < size {
+			return nil, errors.New("stream is shorter than its size")
+		}
+		out = out[:size]
+	}
+	return out, nil
+}
+
+// miniChain reads a stream kept in the mini stream.
+func (f *cfbFile) miniChain(start uint32, size int64) ([]byte, error) {
+	const miniSize = 64
+	var out []byte
+	for n := start; n < cfbEndOfChain && int64(len(out)) < size; n = f.miniFAT[n] {
+		off := int64(n) * miniSize
+		if int(n) >= len(f.miniFAT) || off+miniSize > int64(len(f.miniStream)) || len(out) > len(f.data) {
+			return nil, fmt.Errorf("broken mini sector chain at %d", n)
+		}
+		out = append(out, f.miniStream[off:off+miniSize]...)
+	}
+	if int64(len(out)) < size {
+		return nil, errors.New("stream is shorter than its size")
+	}
+	return out[:size], nil
+}
+
+// root returns the root storage.
+func (f *cfbFile) root() cfbNode { return cfbNode{f, f.entries[0]} }
+
+// children returns the entries of a storage, in directory order.
+func (n cfbNode) children() []cfbNode {
+	var out []cfbNode
+	seen := map[uint32]bool{}
+	var walk func(id uint32)
+	walk = func(id uint32) {
+		if id == cfbNoStream || int(id) >= len(n.f.entries) || seen[id] {
+			return
+		}
+		seen[id] = true
+		e := n.f.entries[id]
+		walk(e.left)
+		out = append(out, cfbNode{n.f, e})
+		walk(e.right)
+	}
+	walk(n.e.child)
+	return out
+}
+
+// child returns the entry of a storage named name.
+func (n cfbNode) child(name string) (cfbNode, bool) {
+	for _, c := range n.children() {
+		if c.e.name == name {
+			return c, true
+		}
+	}
+	return cfbNode{}, false
+}
+
+// read returns the contents of a stream.
+func (n cfbNode) read() ([]byte, error) {
+	if n.e.kind != cfbStream {
+		return nil, fmt.Errorf("%s is not a stream", n.e.name)
+	}
+	if n.e.size < 4096 {
+		return n.f.miniChain(n.e.start, int64(n.e.size))
+	}
+	return n.f.chain(n.e.start, int64(n.e.size))
+}
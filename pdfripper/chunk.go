@@ -0,0 +1,151 @@
+package pdfripper
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"strings"
+	"unicode"
+)
+
+// ChunksFile is the file in OutputDir that ChunkSize has the text cut into.
+const ChunksFile = "chunks.jsonl"
+
+// Chunk is one line of ChunksFile: a stretch of the document's text of
+// about ChunkSize characters, for search indexes and language models that
+// take text in pieces of a bounded size.
+type Chunk struct {
+	Chunk     int    `json:"chunk"` // From 1, in document order.
+	FirstPage int    `json:"first_page"`
+	LastPage  int    `json:"last_page"`
+	Text      string `json:"text"`
+	Tokens    int    `json:"tokens,omitempty"` // Counted by Extractor.Tokenizer, if it is set.
+}
+
+// chunkSink cuts the pages, in page order, into chunks of at most size
+// characters, each starting overlap characters before the previous one
+// ended. Chunks end at a space where one falls in the second half of the
+// chunk, so that words are not split, and start at one likewise.
+type chunkSink struct {
+	f       *os.File
+	w       *bufio.Writer
+	size    int
+	overlap int
+	n       int
+	buf     []rune
+	spans   []chunkSpan   // Where each page's text starts in buf, in order.
+	tokens  Tokenizer     // If set, counts each chunk's tokens.
+	vectors *vectorIngest // If set, gets each chunk.
+}
+
+type chunkSpan struct {
+	start, page int
+}
+
+func newChunkSink(path string, size, overlap int, tokens Tokenizer, vectors *vectorIngest) (*chunkSink, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	return &chunkSink{f: f, w: bufio.NewWriter(f), size: size, overlap: overlap, tokens: tokens, vectors: vectors}, nil
+}
+
+func (s *chunkSink) WritePage(r *PageResult) error {
+	text := []rune(strings.TrimSpace(r.Text))
+	if len(text) == 0 {
+		return nil
+	}
+	if len(s.buf) > 0 {
+		s.buf = append(s.buf, '\n')
+	}
+	s.spans = append(s.spans, chunkSpan{start: len(s.buf), page: r.Page})
+	s.buf = append(s.buf, text...)
+	for len(s.buf) > s.size {
+		if err := s.emit(s.cut()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// cut returns where the chunk at the start of buf ends.
+func (s *chunkSink) cut() int {
+	for i := s.size; i > s.size/2; i-- {
+		if unicode.IsSpace(s.buf[i]) {
+			return i
+		}
+	}
+	return s.size
+}
+
+// emit writes buf[:end] as a chunk and keeps the overlap that the next
+// chunk starts with.
+func (s *chunkSink) emit(end int) error {
+	s.n++
+	c := Chunk{Chunk: s.n, FirstPage: s.pageAt(0), LastPage: s.pageAt(end - 1), Text: strings.TrimSpace(string(s.buf[:end]))}
+	if s.tokens != nil {
+		c.Tokens = s.tokens.CountTokens(c.Text)
+	}
+	data, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	if _, err := s.w.Write(append(data, '\n')); err != nil {
+		return err
+	}
+	if s.vectors != nil {
+		if err := s.vectors.add(c); err != nil {
+			return err
+		}
+	}
+
+	next := end
+	if s.overlap > 0 {
+		next = max(end-s.overlap, 1)
+		for i := next; i < end; i++ {
+			if unicode.IsSpace(s.buf[i-1]) {
+				next = i
+				break
+			}
+		}
+	}
+	for next < len(s.buf) && unicode.IsSpace(s.buf[next]) {
+		next++
+	}
+	s.buf = append(s.buf[:0], s.buf[next:]...)
+	var kept []chunkSpan
+	for i, sp := range s.spans {
+		if i+1 < len(s.spans) && s.spans[i+1].start <= next {
+			continue // The page ends before the next chunk starts.
+		}
+		kept = append(kept, chunkSpan{start: max(sp.start-next, 0), page: sp.page})
+	}
+	s.spans = kept
+	return nil
+}
+
+// pageAt returns the page the character at offset i of buf is on.
+func (s *chunkSink) pageAt(i int) int {
+	page := s.spans[0].page
+	for _, sp := range s.spans {
+		if sp.start > i {
+			break
+		}
+		page = sp.page
+	}
+	return page
+}
+
+func (s *chunkSink) Close() error {
+	var err error
+	if strings.TrimSpace(string(s.buf)) != "" {
+		err = s.emit(len(s.buf))
+	}
+	if s.vectors != nil && err == nil {
+		err = s.vectors.close()
+	}
+	if cerr := closeBuffered(s.f, s.w); err == nil {
+		err = cerr
+	}
+	return err
+}
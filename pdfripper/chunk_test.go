@@ -0,0 +1,152 @@
+package pdfripper
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/thnkr-one/pdfripper/pdfripper/paptest"
+)
+
+// readChunks reads a ChunksFile.
+func readChunks(t *testing.T, path string) []Chunk {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var chunks []Chunk
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		var c Chunk
+		if err := json.Unmarshal(sc.Bytes(), &c); err != nil {
+			t.Fatalf("%q: %v", sc.Text(), err)
+		}
+		chunks = append(chunks, c)
+	}
+	return chunks
+}
+
+func TestChunkSink(t *testing.T) {
+	pages := []string{"one two three four five six\n", "  \n", "seven eight nine\n", "tenelevental"}
+	for _, tt := range []struct {
+		name          string
+		size, overlap int
+		tokens        Tokenizer
+		want          []Chunk
+	}{
+		{"whole document", 1000, 0, nil, []Chunk{
+			{Chunk: 1, FirstPage: 1, LastPage: 4, Text: "one two three four five six\nseven eight nine\ntenelevental"},
+		}},
+		// Chunks end at spaces, newlines between pages included, and go
+		// on across pages; pages without text are skipped.
+		{"no overlap", 16, 0, nil, []Chunk{
+			{Chunk: 1, FirstPage: 1, LastPage: 1, Text: "one two three"},
+			{Chunk: 2, FirstPage: 1, LastPage: 1, Text: "four five six"},
+			{Chunk: 3, FirstPage: 3, LastPage: 3, Text: "seven eight nine"},
+			{Chunk: 4, FirstPage: 4, LastPage: 4, Text: "tenelevental"},
+		}},
+		{"across pages", 20, 0, nil, []Chunk{
+			{Chunk: 1, FirstPage: 1, LastPage: 1, Text: "one two three four"},
+			{Chunk: 2, FirstPage: 1, LastPage: 3, Text: "five six\nseven eight"},
+			{Chunk: 3, FirstPage: 3, LastPage: 4, Text: "nine\ntenelevental"},
+		}},
+		// Each chunk starts at the first word among the last overlap
+		// characters of the one before.
+		{"overlap", 16, 6, nil, []Chunk{
+			{Chunk: 1, FirstPage: 1, LastPage: 1, Text: "one two three"},
+			{Chunk: 2, FirstPage: 1, LastPage: 1, Text: "three four five"},
+			{Chunk: 3, FirstPage: 1, LastPage: 3, Text: "five six\nseven"},
+			{Chunk: 4, FirstPage: 3, LastPage: 3, Text: "seven eight nine"},
+			{Chunk: 5, FirstPage: 3, LastPage: 4, Text: "nine\nteneleventa"},
+			{Chunk: 6, FirstPage: 4, LastPage: 4, Text: "evental"},
+		}},
+		// Without a space in the second half of a chunk, it is cut at size.
+		{"long words", 8, 0, nil, []Chunk{
+			{Chunk: 1, FirstPage: 1, LastPage: 1, Text: "one two"},
+			{Chunk: 2, FirstPage: 1, LastPage: 1, Text: "three"},
+			{Chunk: 3, FirstPage: 1, LastPage: 1, Text: "four fiv"},
+			{Chunk: 4, FirstPage: 1, LastPage: 1, Text: "e six"},
+			{Chunk: 5, FirstPage: 3, LastPage: 3, Text: "seven"},
+			{Chunk: 6, FirstPage: 3, LastPage: 3, Text: "eight"},
+			{Chunk: 7, FirstPage: 3, LastPage: 4, Text: "nine\nten"},
+			{Chunk: 8, FirstPage: 4, LastPage: 4, Text: "eleventa"},
+			{Chunk: 9, FirstPage: 4, LastPage: 4, Text: "l"},
+		}},
+		{"tokens", 1000, 0, HeuristicTokenizer{}, []Chunk{
+			{Chunk: 1, FirstPage: 1, LastPage: 4, Text: "one two three four five six\nseven eight nine\ntenelevental", Tokens: 20},
+		}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), ChunksFile)
+			s, err := newChunkSink(path, tt.size, tt.overlap, tt.tokens, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i, text := range pages {
+				if err := s.WritePage(&PageResult{Page: i + 1, Text: text}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := s.Close(); err != nil {
+				t.Fatal(err)
+			}
+			got := readChunks(t, path)
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d chunks %+v, want %d", len(got), got, len(tt.want))
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("chunk %d: got %+v, want %+v", i+1, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestExtractChunks(t *testing.T) {
+	path := paptest.TempPDF(t, "First page of text", "Second page of text")
+	dir := t.TempDir()
+	e, err := NewExtractor(path, dir, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.Backend, _ = LookupBackend("native")
+	e.ChunkSize = 30
+	if err := e.ExtractPages(); err != nil {
+		t.Fatal(err)
+	}
+	chunks := readChunks(t, filepath.Join(dir, ChunksFile))
+	if len(chunks) != 2 || chunks[0].Text != "First page of text\nSecond page" || chunks[1].Text != "of text" || chunks[1].FirstPage != 2 {
+		t.Errorf("got chunks %+v", chunks)
+	}
+}
+
+func TestChunkSizeChecks(t *testing.T) {
+	e := &Extractor{ChunkSize: 100, ChunkOverlap: 100}
+	if err := e.Validate(); err == nil || !strings.Contains(err.Error(), "ChunkOverlap 100 is not less than ChunkSize 100") {
+		t.Errorf("got error %v, want the overlap rejected", err)
+	}
+	e = &Extractor{ChunkOverlap: -1}
+	if err := e.Validate(); err == nil || !strings.Contains(err.Error(), "ChunkOverlap -1 is negative") {
+		t.Errorf("got error %v, want the overlap rejected", err)
+	}
+
+	// Chunks follow the text from page to page.
+	e = &Extractor{ChunkSize: 100, PageOrder: OrderLastFirst}
+	if err := e.checkPageOrder(); err == nil || !strings.Contains(err.Error(), "need the pages in page order") {
+		t.Errorf("got error %v, want PageOrder rejected", err)
+	}
+
+	// And take as much space again as the page files.
+	e = &Extractor{}
+	plain, _ := e.spaceEstimate(10)
+	e.ChunkSize = 100
+	if chunked, _ := e.spaceEstimate(10); chunked != 2*plain {
+		t.Errorf("estimated %d bytes of output with chunks, want %d", chunked, 2*plain)
+	}
+}
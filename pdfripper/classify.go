@@ -0,0 +1,115 @@
+package pdfripper
+
+import (
+	"fmt"
+	"math"
+	"unicode"
+)
+
+// PageClass says how a page's content was produced.
+type PageClass string
+
+const (
+	BornDigital PageClass = "born-digital" // Text drawn with fonts, with few or no images.
+	Scanned     PageClass = "scanned"      // A page-sized image with little visible text, possibly under an invisible OCR layer.
+	Hybrid      PageClass = "hybrid"       // Visible text alongside images that cover a good part of the page.
+)
+
+// Thresholds used by ClassifyPages.
+const (
+	scannedCoverage = 0.5 // Image coverage from which a page with little visible text is Scanned.
+	hybridCoverage  = 0.1 // Image coverage from which a page with text is Hybrid.
+	scannedMaxChars = 50  // Visible characters a Scanned page may have, for stamps and Bates numbers.
+)
+
+// PageClassification is the evidence behind a page's class.
+type PageClassification struct {
+	Class          PageClass
+	VisibleChars   int     // Non-space characters drawn visibly.
+	InvisibleChars int     // Non-space characters drawn invisibly, as OCR text layers are.
+	ImageCoverage  float64 // Fraction of the page covered by images, from 0 to 1.
+}
+
+// ClassifyPages classifies every page by the text and images its content
+// draws. A page whose content cannot be parsed has an empty Class.
+func ClassifyPages(pdfFile string) ([]PageClassification, error) {
+	d, err := openPDFFile(pdfFile)
+	if err != nil {
+		return nil, err
+	}
+	pages := make([]PageClassification, len(d.pages))
+	for i := range d.pages {
+		pages[i], _ = d.classifyPage(i)
+	}
+	return pages, nil
+}
+
+func (d *pdfDoc) classifyPage(index int) (c PageClassification, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			c, err = PageClassification{}, fmt.Errorf("parsing page %d: %v", index+1, r)
+		}
+	}()
+	ci, err := d.interpretPage(index)
+	if err != nil {
+		return PageClassification{}, err
+	}
+	for _, f := range ci.fragments {
+		n := 0
+		for _, r := range f.text {
+			if !unicode.IsSpace(r) {
+				n++
+			}
+		}
+		if f.invisible {
+			c.InvisibleChars += n
+		} else {
+			c.VisibleChars += n
+		}
+	}
+
+	box := d.pages[index].mediaBox
+	if area := (box[2] - box[0]) * (box[3] - box[1]); area > 0 {
+		covered := 0.0
+		for _, img := range ci.images {
+			w := math.Min(img[2], box[2]) - math.Max(img[0], box[0])
+			h := math.Min(img[3], box[3]) - math.Max(img[1], box[1])
+			if w > 0 && h > 0 {
+				covered += w * h
+			}
+		}
+		// Overlapping images are counted twice; that is rare enough to
+		// ignore next to the cost of computing their union.
+		c.ImageCoverage = math.Min(covered/area, 1)
+	}
+
+	switch {
+	case c.ImageCoverage >= scannedCoverage && c.VisibleChars <= scannedMaxChars:
+		c.Class = Scanned
+	case c.ImageCoverage >= hybridCoverage:
+		c.Class = Hybrid
+	default:
+		c.Class = BornDigital
+	}
+	return c, nil
+}
+
+// classifying reports whether this run classifies pages.
+func (e *Extractor) classifying() bool {
+	return e.Classify || e.OCR != nil || len(e.ManifestFormats) > 0
+}
+
+// classify sets r.Class and returns the classification, or nil when the
+// input was not parsed for classification or the page could not be.
+func (e *Extractor) classify(r *PageResult) *PageClassification {
+	if e.doc == nil || !e.classifying() {
+		return nil
+	}
+	c, err := e.doc.classifyPage(r.Page - 1)
+	if err != nil {
+		fmt.Printf("Page %d: could not classify: %v\n", r.Page, err)
+		return nil
+	}
+	r.Class = c.Class
+	return &c
+}
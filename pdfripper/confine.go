@@ -0,0 +1,98 @@
+package pdfripper
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// checkConfined reports settings of a run with ConfineTo that would write
+// outside its directories. OutputDir and TempDir must be set, as their
+// defaults are not chosen by the caller.
+func (e *Extractor) checkConfined() error {
+	if len(e.ConfineTo) == 0 {
+		return nil
+	}
+	if e.OutputDir == "" || e.TempDir == "" {
+		return errors.New("ConfineTo needs OutputDir and TempDir to be set")
+	}
+	for _, p := range []struct{ name, path string }{
+		{"OutputDir", e.OutputDir},
+		{"TempDir", e.TempDir},
+		{"CombinedFile", e.CombinedFile},
+		{"Cache", cacheDir(e.Cache)},
+	} {
+		if p.path == "" {
+			continue
+		}
+		if err := Confined(p.path, e.ConfineTo...); err != nil {
+			return fmt.Errorf("%s: %w", p.name, err)
+		}
+	}
+	return nil
+}
+
+// cacheDir returns the directory of c if it is a DirCache.
+func cacheDir(c Cache) string {
+	if d, ok := c.(*DirCache); ok {
+		return d.Dir
+	}
+	return ""
+}
+
+// Confined returns an error unless path, with symbolic links resolved as
+// far as it exists, lies in one of dirs, resolved the same way, so that
+// neither a link nor ".." can lead a write out of them.
+func Confined(path string, dirs ...string) error {
+	p, err := resolvePath(path)
+	if err != nil {
+		return err
+	}
+	for _, dir := range dirs {
+		d, err := resolvePath(dir)
+		if err != nil {
+			return err
+		}
+		if rel, err := filepath.Rel(d, p); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%s is outside %s, the only directories written in", path, strings.Join(dirs, " and "))
+}
+
+// resolvePath returns path made absolute, with the symbolic links of the
+// longest part of it that exists resolved, those that lead nowhere too.
+func resolvePath(path string) (string, error) {
+	return resolveLinks(path, 0)
+}
+
+func resolveLinks(path string, depth int) (string, error) {
+	if depth > 40 {
+		return "", fmt.Errorf("%s: too many links", path)
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	rest := ""
+	for dir := abs; ; dir = filepath.Dir(dir) {
+		real, err := filepath.EvalSymlinks(dir)
+		if err == nil {
+			return filepath.Join(real, rest), nil
+		}
+		if !errors.Is(err, os.ErrNotExist) || dir == filepath.Dir(dir) {
+			return "", err
+		}
+		if target, err := os.Readlink(dir); err == nil {
+			// A link to something that does not exist, which writing
+			// would create.
+			if !filepath.IsAbs(target) {
+				target = filepath.Join(filepath.Dir(dir), target)
+			}
+			return resolveLinks(filepath.Join(target, rest), depth+1)
+		}
+		rest = filepath.Join(filepath.Base(dir), rest)
+	}
+}
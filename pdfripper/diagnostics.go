@@ -0,0 +1,171 @@
+package pdfripper
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// DiagnosticsDir is the directory inside OutputDir that pages which still
+// fail after PageRetries are saved to when Diagnostics is set.
+const DiagnosticsDir = "diagnostics"
+
+// diagnosticsDPI is the resolution failed pages are rendered at.
+const diagnosticsDPI = 150
+
+// PageDiagnostic is the page_N.json DiagnosticsDir holds for a page that
+// failed, to look into or to attach to a bug report for the backend.
+type PageDiagnostic struct {
+	Page        int              `json:"page"`
+	Backend     string           `json:"backend"`
+	Attempts    int              `json:"attempts"`
+	Errors      []string         `json:"errors"`           // Of each attempt, in order.
+	Stderr      string           `json:"stderr,omitempty"` // What the backend's command wrote to standard error on the last attempt.
+	Object      *ObjectLocation  `json:"object,omitempty"` // The page object, if the package's parser can read the file.
+	Contents    []ObjectLocation `json:"contents,omitempty"`
+	ParseError  string           `json:"parse_error,omitempty"`  // Why the parser could not read the page or its content streams.
+	Image       string           `json:"image,omitempty"`        // page_N.png, if the page could be rendered.
+	RenderError string           `json:"render_error,omitempty"` // Why it could not.
+	Time        time.Time        `json:"time"`
+}
+
+// ObjectLocation is where an object is in a PDF file.
+type ObjectLocation struct {
+	Number     int `json:"number"`
+	Generation int `json:"generation"`
+	Offset     int `json:"offset"`           // Byte offset of "N G obj" in the file, or -1 if it is in an object stream or missing.
+	Stream     int `json:"stream,omitempty"` // The object stream holding it, if Offset is -1.
+}
+
+// diagnosis holds the input as parsed for diagnostics, opened the first
+// time a page needs it.
+type diagnosis struct {
+	once sync.Once
+	doc  *pdfDoc
+	err  error
+}
+
+// extractPageRetrying extracts a page, trying again up to PageRetries
+// times while it fails, and saves a page that still fails to
+// DiagnosticsDir if Diagnostics is set.
+func (e *Extractor) extractPageRetrying(page int) *PageResult {
+	var errs []error
+	var spent time.Duration
+	var used ResourceUsage
+	for {
+		r := e.extractPage(page)
+		spent += r.Duration
+		used.add(r.Usage)
+		r.Duration, r.Usage = spent, used
+		if r.Err == nil {
+			return r
+		}
+		errs = append(errs, r.Err)
+		if len(errs) > e.PageRetries {
+			if e.Diagnostics {
+				if err := e.diagnose(page, errs); err != nil {
+					fmt.Printf("Warning: saving diagnostics of page %d: %v\n", page, err)
+				}
+			}
+			return r
+		}
+	}
+}
+
+// diagnose writes page_N.json, and page_N.png if the backend can render
+// the page, to DiagnosticsDir for a page whose extraction failed with
+// errs.
+func (e *Extractor) diagnose(page int, errs []error) error {
+	dir := filepath.Join(e.OutputDir, DiagnosticsDir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	base := filepath.Join(dir, fmt.Sprintf("page_%d", page))
+	d := PageDiagnostic{Page: page, Backend: e.Backend.Name(), Attempts: len(errs), Time: time.Now().UTC()}
+	for _, err := range errs {
+		d.Errors = append(d.Errors, err.Error())
+	}
+	var cmdErr *CommandError
+	if errors.As(errs[len(errs)-1], &cmdErr) {
+		d.Stderr = cmdErr.Stderr
+	}
+	if err := e.locatePage(&d); err != nil {
+		d.ParseError = err.Error()
+	}
+	if renderer, ok := e.Backend.(Renderer); !ok {
+		d.RenderError = fmt.Sprintf("backend %s cannot render pages", e.Backend.Name())
+	} else if img, err := renderer.RenderPage(e.PDFFile, page, diagnosticsDPI); err != nil {
+		d.RenderError = err.Error()
+	} else if err := savePNG(base+".png", img); err != nil {
+		return err
+	} else {
+		d.Image = filepath.Base(base + ".png")
+	}
+
+	data, err := json.MarshalIndent(d, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(base+".json", append(data, '\n'), 0644); err != nil {
+		return err
+	}
+	fmt.Printf("Page %d failed %d times; saved diagnostics to %s\n", page, len(errs), dir)
+	return nil
+}
+
+// locatePage fills in where the page object and its content streams are in
+// the file, and checks that the content streams decode.
+func (e *Extractor) locatePage(d *PageDiagnostic) (err error) {
+	doc := e.doc
+	if doc == nil {
+		e.diag.once.Do(func() { e.diag.doc, e.diag.err = openPDFFile(e.PDFFile) })
+		if doc, err = e.diag.doc, e.diag.err; err != nil {
+			return err
+		}
+	}
+	if d.Page > len(doc.pages) {
+		return fmt.Errorf("the parser finds %d pages", len(doc.pages))
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("parsing page %d: %v", d.Page, r)
+		}
+	}()
+	p := doc.pages[d.Page-1]
+	if p.ref != (pdfRef{}) {
+		loc := doc.locate(p.ref)
+		d.Object = &loc
+	}
+	contents := p.dict["Contents"]
+	if ref, ok := contents.(pdfRef); ok {
+		d.Contents = append(d.Contents, doc.locate(ref))
+	}
+	if arr, ok := doc.resolve(contents).(pdfArray); ok {
+		for _, item := range arr {
+			if ref, ok := item.(pdfRef); ok {
+				d.Contents = append(d.Contents, doc.locate(ref))
+			}
+		}
+	}
+	if _, err := doc.pageContents(p); err != nil {
+		return fmt.Errorf("decoding content streams: %w", err)
+	}
+	return nil
+}
+
+// locate returns where the object ref is in the file.
+func (d *pdfDoc) locate(ref pdfRef) ObjectLocation {
+	loc := ObjectLocation{Number: ref.num, Generation: ref.gen, Offset: -1}
+	if x, ok := d.xref[ref.num]; ok {
+		if x.compressed {
+			loc.Stream = x.stream
+		} else {
+			loc.Offset = x.offset
+		}
+	}
+	return loc
+}
@@ -0,0 +1,11 @@
+//go:build !linux && !darwin
+
+package pdfripper
+
+import "errors"
+
+// diskFree cannot read free space on this platform, so the disk space
+// checks are skipped.
+func diskFree(dir string) (free, dev uint64, err error) {
+	return 0, 0, errors.New("free disk space is not available on this platform")
+}
@@ -0,0 +1,27 @@
+//go:build linux || darwin
+
+package pdfripper
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// diskFree returns the bytes available to unprivileged users on the
+// filesystem of dir, and the device number of the filesystem.
+func diskFree(dir string) (free, dev uint64, err error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(dir, &st); err != nil {
+		return 0, 0, err
+	}
+	info, err := os.Stat(dir)
+	if err != nil {
+		return 0, 0, err
+	}
+	sys, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, 0, errors.New("no device number for " + dir)
+	}
+	return uint64(st.Bavail) * uint64(st.Bsize), uint64(sys.Dev), nil
+}
@@ -0,0 +1,186 @@
+package pdfripper
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Rough sizes of what a run writes, for the disk space check.
+const (
+	textPageBytes   = 8 << 10   // A page's text file, its manifest entries and its share of a combined file.
+	layoutPageBytes = 96 << 10  // The hOCR or ALTO of an OCRed page.
+	defaultPageArea = 612 * 792 // US Letter in square points, for documents whose page sizes are not loaded.
+)
+
+// diskCheckInterval is how often free space is checked during a run with
+// MinFreeSpace set.
+const diskCheckInterval = time.Second
+
+// DiskSpaceError reports that a filesystem the run writes to has too
+// little free space. Before the run starts, Needed is the space the run is
+// estimated to take there; once it is running, Needed is 0.
+type DiskSpaceError struct {
+	Dir     string // A directory on the filesystem.
+	Free    uint64 // Bytes free.
+	Needed  uint64 // Bytes the run is estimated to write there.
+	Minimum uint64 // Extractor.MinFreeSpace.
+}
+
+func (e *DiskSpaceError) Error() string {
+	if e.Needed == 0 {
+		return fmt.Sprintf("only %s free in %s, below the minimum of %s", byteSize(e.Free), e.Dir, byteSize(e.Minimum))
+	}
+	return fmt.Sprintf("only %s free in %s, but the run needs about %s there and %s must stay free", byteSize(e.Free), e.Dir, byteSize(e.Needed), byteSize(e.Minimum))
+}
+
+// spaceEstimate returns rough upper bounds of the bytes a run extracting
+// pages writes to the output directory, and to the temporary
+// workspace at any one time. Page text is small; the page images rendered
+// for OCR, equations and figures are not, and every page in flight can
+// hold one. Pages copied for review are not counted.
+func (e *Extractor) spaceEstimate(pages int) (output, temp uint64) {
+	output = uint64(pages) * textPageBytes
+	if e.OCR != nil && e.OCRLayout != "" {
+		output += uint64(pages) * layoutPageBytes
+	}
+	if e.ChunkSize > 0 {
+		// The text again, in chunks.
+		output += uint64(pages) * textPageBytes
+	}
+	if e.Segment != "" {
+		// And in segments.
+		output += uint64(pages) * textPageBytes
+	}
+
+	mean, largest := float64(defaultPageArea), float64(defaultPageArea)
+	if len(e.geometry) > 0 {
+		sum := 0.0
+		for _, g := range e.geometry {
+			sum += g.Width * g.Height
+			largest = max(largest, g.Width*g.Height)
+		}
+		mean = sum / float64(len(e.geometry))
+	}
+	// One byte per pixel: the gray and color PNGs of text pages come out
+	// smaller than that.
+	raster := func(area float64, dpi int) uint64 {
+		return uint64(area / (72 * 72) * float64(dpi) * float64(dpi))
+	}
+
+	dpi := 0
+	if e.OCR != nil {
+		dpi = e.ocrDPI()
+	}
+	if e.equations() {
+		dpi = max(dpi, e.equationDPI())
+	}
+	if e.Figures {
+		dpi = max(dpi, e.figureDPI())
+		// Figure crops, taking them to cover a quarter of every page.
+		output += uint64(pages) * raster(mean, e.figureDPI()) / 4
+	}
+	if dpi > 0 {
+		temp = uint64(max(e.maxInFlight(), e.BatchSize)) * raster(largest, dpi)
+	}
+	return output, temp
+}
+
+// spaceNeed is what a run needs on one filesystem.
+type spaceNeed struct {
+	dir    string
+	free   uint64
+	needed uint64
+}
+
+// checkDiskSpace compares the space a run extracting pages is estimated
+// to need on the filesystems of OutputDir, CombinedFile and the temporary
+// workspace with what they have free. If MinFreeSpace is set, it fails
+// when less than that would be left, and records the filesystems for the
+// checks during the run; otherwise it warns when the estimate is more than
+// is free. Filesystems whose free space cannot be read are skipped.
+func (e *Extractor) checkDiskSpace(pages int) error {
+	output, temp := e.spaceEstimate(pages)
+	var needs []*spaceNeed
+	add := func(dir string, bytes uint64) {
+		dir = existingDir(dir)
+		free, dev, err := diskFree(dir)
+		if err != nil {
+			return
+		}
+		for _, n := range needs {
+			if _, d, _ := diskFree(n.dir); d == dev {
+				n.needed += bytes
+				return
+			}
+		}
+		needs = append(needs, &spaceNeed{dir: dir, free: free, needed: bytes})
+	}
+	if e.OutputDir != "" {
+		add(e.OutputDir, output)
+	}
+	if e.CombinedFile != "" {
+		add(filepath.Dir(e.CombinedFile), uint64(pages)*textPageBytes)
+	}
+	tempDir := e.TempDir
+	if tempDir == "" {
+		tempDir = os.TempDir()
+	}
+	add(tempDir, temp)
+
+	e.spaceDirs = nil
+	for _, n := range needs {
+		switch {
+		case e.MinFreeSpace > 0 && n.free < n.needed+e.MinFreeSpace:
+			return &DiskSpaceError{Dir: n.dir, Free: n.free, Needed: n.needed, Minimum: e.MinFreeSpace}
+		case n.free < n.needed:
+			fmt.Printf("Warning: the run may need about %s in %s, which has %s free\n", byteSize(n.needed), n.dir, byteSize(n.free))
+		}
+		if e.MinFreeSpace > 0 {
+			e.spaceDirs = append(e.spaceDirs, n.dir)
+		}
+	}
+	return nil
+}
+
+// lowSpace returns a DiskSpaceError if a filesystem the run writes to has
+// less than MinFreeSpace free.
+func (e *Extractor) lowSpace() error {
+	for _, dir := range e.spaceDirs {
+		if free, _, err := diskFree(dir); err == nil && free < e.MinFreeSpace {
+			return &DiskSpaceError{Dir: dir, Free: free, Minimum: e.MinFreeSpace}
+		}
+	}
+	return nil
+}
+
+// existingDir returns dir, or its closest parent that exists, since the
+// output directory may not have been made yet.
+func existingDir(dir string) string {
+	dir = filepath.Clean(dir)
+	for {
+		if _, err := os.Stat(dir); err == nil {
+			return dir
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return dir
+		}
+		dir = parent
+	}
+}
+
+// byteSize formats n with a binary unit, such as "1.5 GiB".
+func byteSize(n uint64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := uint64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,276 @@
+package pdfripper
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+// EmailExtensions are the file extensions ReadEmail reads.
+var EmailExtensions = []string{".eml", ".msg"}
+
+// Email is a message and the PDFs attached to it.
+type Email struct {
+	Subject     string
+	From        string
+	Date        time.Time // Zero if the message has none.
+	Attachments []Attachment
+}
+
+// Attachment is a PDF attached to an email, directly or inside a
+// forwarded message.
+type Attachment struct {
+	Name string // File name, as the message gives it, or attachment_N.pdf.
+	Data []byte
+}
+
+// IsEmailFile reports whether ReadEmail reads name, by its extension.
+func IsEmailFile(name string) bool {
+	ext := strings.ToLower(filepath.Ext(name))
+	for _, e := range EmailExtensions {
+		if ext == e {
+			return true
+		}
+	}
+	return false
+}
+
+// ReadEmail reads an email saved as a MIME message (.eml) or an Outlook
+// message (.msg), told apart by their contents, and returns it with its
+// PDF attachments. An attachment is taken as a PDF if its name ends in
+// .pdf, its type is application/pdf or its data starts like a PDF, and
+// the attachments of messages attached to it are included.
+func ReadEmail(file string) (*Email, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var m *Email
+	if bytes.HasPrefix(data, cfbSignature) {
+		m, err = parseMSG(data)
+	} else {
+		m, err = parseEML(bytes.NewReader(data))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", file, err)
+	}
+	for i := range m.Attachments {
+		if name := m.Attachments[i].Name; name == "" || name == "." || name == ".." || name == "/" {
+			m.Attachments[i].Name = fmt.Sprintf("attachment_%d.pdf", i+1)
+		}
+	}
+	return m, nil
+}
+
+// isPDFAttachment reports whether an attachment is a PDF.
+func isPDFAttachment(name, mediaType string, data []byte) bool {
+	return strings.EqualFold(path.Ext(name), ".pdf") || strings.EqualFold(mediaType, "application/pdf") ||
+		bytes.HasPrefix(bytes.TrimLeft(data[:min(len(data), 1024)], " \t\r\n"), []byte("%PDF-"))
+}
+
+var wordDecoder = &mime.WordDecoder{CharsetReader: func(charset string, r io.Reader) (io.Reader, error) {
+	// Leave text in charsets Go does not know as it is.
+	return r, nil
+}}
+
+// parseEML reads a MIME message.
+func parseEML(r io.Reader) (*Email, error) {
+	msg, err := mail.ReadMessage(r)
+	if err != nil {
+		return nil, err
+	}
+	m := &Email{From: decodeHeader(msg.Header.Get("From")), Subject: decodeHeader(msg.Header.Get("Subject"))}
+	m.Date, _ = msg.Header.Date()
+	err = m.walkPart(msg.Header.Get("Content-Type"), msg.Header.Get("Content-Disposition"), msg.Header.Get("Content-Transfer-Encoding"), msg.Body)
+	return m, err
+}
+
+func decodeHeader(v string) string {
+	if s, err := wordDecoder.DecodeHeader(v); err == nil {
+		return s
+	}
+	return v
+}
+
+// walkPart adds the PDFs in a part of a MIME message, and in the parts
+// it holds, to m.
+func (m *Email) walkPart(contentType, disposition, encoding string, body io.Reader) error {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType, params = "text/plain", nil
+	}
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "base64":
+		body = base64.NewDecoder(base64.StdEncoding, body)
+	case "quoted-printable":
+		body = quotedprintable.NewReader(body)
+	}
+	if strings.HasPrefix(mediaType, "multipart/") {
+		mr := multipart.NewReader(body, params["boundary"])
+		for {
+			p, err := mr.NextRawPart()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			err = m.walkPart(p.Header.Get("Content-Type"), p.Header.Get("Content-Disposition"), p.Header.Get("Content-Transfer-Encoding"), p)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	if mediaType == "message/rfc822" {
+		inner, err := parseEML(body)
+		if err != nil {
+			return err
+		}
+		m.Attachments = append(m.Attachments, inner.Attachments...)
+		return nil
+	}
+	name := params["name"]
+	if _, dparams, err := mime.ParseMediaType(disposition); err == nil && dparams["filename"] != "" {
+		name = dparams["filename"]
+	}
+	name = decodeHeader(name)
+	if !strings.HasPrefix(mediaType, "text/") || name != "" {
+		data, err := io.ReadAll(body)
+		if err != nil {
+			return err
+		}
+		if isPDFAttachment(name, mediaType, data) {
+			m.Attachments = append(m.Attachments, Attachment{Name: path.Base(filepath.ToSlash(name)), Data: data})
+		}
+	}
+	return nil
+}
+
+// Streams and properties of an Outlook message, as MS-OXMSG names them.
+const (
+	msgAttachPrefix  = "__attach_version1.0_#"
+	msgProperties    = "__properties_version1.0"
+	msgSubject       = 0x0037
+	msgSubmitTime    = 0x0039
+	msgSenderName    = 0x0C1A
+	msgSenderAddress = 0x0C1F
+	msgDeliveryTime  = 0x0E06
+	msgAttachData    = 0x3701
+	msgAttachName    = 0x3704
+	msgAttachLong    = 0x3707
+	msgAttachMime    = 0x370E
+)
+
+// parseMSG reads an Outlook message.
+func parseMSG(data []byte) (*Email, error) {
+	f, err := openCFB(data)
+	if err != nil {
+		return nil, err
+	}
+	return readMSG(f.root(), 32)
+}
+
+// readMSG reads the message held by a storage, the root of the file or
+// an attachment, whose property stream has a header of headerSize bytes.
+func readMSG(s cfbNode, headerSize int) (*Email, error) {
+	m := &Email{Subject: msgString(s, msgSubject)}
+	m.From = msgString(s, msgSenderName)
+	if addr := msgString(s, msgSenderAddress); addr != "" && addr != m.From {
+		m.From = strings.TrimSpace(m.From + " <" + addr + ">")
+	}
+	for _, id := range []uint16{msgSubmitTime, msgDeliveryTime} {
+		if t, ok := msgTime(s, headerSize, id); ok {
+			m.Date = t
+			break
+		}
+	}
+	for _, c := range s.children() {
+		if c.e.kind != cfbStorage || !strings.HasPrefix(c.e.name, msgAttachPrefix) {
+			continue
+		}
+		if inner, ok := c.child(msgStreamName(msgAttachData, 0x000D)); ok {
+			// A message attached as itself, rather than as a file.
+			embedded, err := readMSG(inner, 24)
+			if err != nil {
+				return nil, err
+			}
+			m.Attachments = append(m.Attachments, embedded.Attachments...)
+			continue
+		}
+		stream, ok := c.child(msgStreamName(msgAttachData, 0x0102))
+		if !ok {
+			continue
+		}
+		data, err := stream.read()
+		if err != nil {
+			return nil, fmt.Errorf("reading attachment: %w", err)
+		}
+		name := msgString(c, msgAttachLong)
+		if name == "" {
+			name = msgString(c, msgAttachName)
+		}
+		if isPDFAttachment(name, msgString(c, msgAttachMime), data) {
+			m.Attachments = append(m.Attachments, Attachment{Name: path.Base(filepath.ToSlash(name)), Data: data})
+		}
+	}
+	return m, nil
+}
+
+// msgStreamName names the stream of a property of the given type.
+func msgStreamName(id, typ uint16) string {
+	return fmt.Sprintf("__substg1.0_%04X%04X", id, typ)
+}
+
+// msgString returns a string property of a storage, stored as UTF-16 or
+// in the message's 8-bit code page.
+func msgString(s cfbNode, id uint16) string {
+	if c, ok := s.child(msgStreamName(id, 0x001F)); ok {
+		if data, err := c.read(); err == nil {
+			units := make([]uint16, len(data)/2)
+			for i := range units {
+				units[i] = binary.LittleEndian.Uint16(data[2*i:])
+			}
+			return strings.TrimRight(string(utf16.Decode(units)), "\x00")
+		}
+	}
+	if c, ok := s.child(msgStreamName(id, 0x001E)); ok {
+		if data, err := c.read(); err == nil {
+			return strings.TrimRight(string(data), "\x00")
+		}
+	}
+	return ""
+}
+
+// msgTime returns a time property, which the property stream holds.
+func msgTime(s cfbNode, headerSize int, id uint16) (time.Time, bool) {
+	c, ok := s.child(msgProperties)
+	if !ok {
+		return time.Time{}, false
+	}
+	data, err := c.read()
+	if err != nil {
+		return time.Time{}, false
+	}
+	for off := headerSize; off+16 <= len(data); off += 16 {
+		tag := binary.LittleEndian.Uint32(data[off:])
+		if tag == uint32(id)<<16|0x0040 {
+			// A FILETIME: 100-nanosecond intervals since 1601.
+			ft := int64(binary.LittleEndian.Uint64(data[off+8:]))
+			const epochDiff = 116444736000000000
+			return time.Unix(0, (ft-epochDiff)*100).UTC(), true
+		}
+	}
+	return time.Time{}, false
+}
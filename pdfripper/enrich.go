@@ -0,0 +1,186 @@
+package pdfripper
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// enrichTimeout bounds each request of an Enricher that has no Client of
+// its own.
+const enrichTimeout = time.Minute
+
+var enrichClient = &http.Client{Timeout: enrichTimeout}
+
+// Enricher is a Stage that sends every page to an HTTP enrichment
+// service, such as a classifier or entity extractor, and merges the
+// fields it answers with into the page's Fields, replacing those of the
+// same names. The page is POSTed to URL as a JSON object
+//
+//	{"file": "in.pdf", "page": 3, "text": "...", "fields": {...}}
+//
+// with the Fields the page already has, if any, and the service answers
+// 200 with a JSON object. Network errors, 429 and 5xx responses are
+// retried, after Backoff and twice as long each time after that, or after
+// the time a Retry-After header gives; any other status fails the page.
+type Enricher struct {
+	URL         string        // Endpoint to POST pages to.
+	File        string        // Sent with every page as "file", if set, such as the name of the document.
+	Token       string        // If set, sent as a bearer token.
+	Concurrency int           // Requests in flight at once at most (default: 4); PostProcessCount bounds it too.
+	Rate        float64       // Requests started per second at most, retries included (0: no limit).
+	Retries     int           // Times a request is retried before the page fails.
+	Backoff     time.Duration // Delay before the first retry (default: one second).
+	Client      *http.Client  // Client to use (default: one with a one-minute timeout).
+
+	once  sync.Once
+	slots chan struct{}
+	mu    sync.Mutex
+	next  time.Time // When the next request may start, with Rate.
+}
+
+func (e *Enricher) Name() string { return "enrich" }
+
+// enrichRequest is the body an Enricher POSTs.
+type enrichRequest struct {
+	File   string         `json:"file,omitempty"`
+	Page   int            `json:"page"`
+	Text   string         `json:"text"`
+	Fields map[string]any `json:"fields,omitempty"`
+}
+
+func (e *Enricher) Process(ctx context.Context, r *PageResult) error {
+	e.once.Do(func() {
+		n := e.Concurrency
+		if n <= 0 {
+			n = 4
+		}
+		e.slots = make(chan struct{}, n)
+	})
+	body, err := json.Marshal(enrichRequest{File: e.File, Page: r.Page, Text: r.Text, Fields: r.Fields})
+	if err != nil {
+		return err
+	}
+	delay := e.Backoff
+	if delay <= 0 {
+		delay = time.Second
+	}
+	var fields map[string]any
+	for attempt := 0; ; attempt++ {
+		var retryAfter time.Duration
+		fields, retryAfter, err = e.send(ctx, body)
+		var perm *permanentEnrichError
+		if err == nil || errors.As(err, &perm) || attempt == e.Retries || ctx.Err() != nil {
+			break
+		}
+		if err := sleepContext(ctx, max(delay, retryAfter)); err != nil {
+			return err
+		}
+		delay *= 2
+	}
+	if err != nil {
+		return fmt.Errorf("enriching: %w", err)
+	}
+	if len(fields) > 0 && r.Fields == nil {
+		r.Fields = make(map[string]any, len(fields))
+	}
+	for k, v := range fields {
+		r.Fields[k] = v
+	}
+	return nil
+}
+
+// permanentEnrichError is the error of a response retrying will not fix.
+type permanentEnrichError struct{ err error }
+
+func (e *permanentEnrichError) Error() string { return e.err.Error() }
+func (e *permanentEnrichError) Unwrap() error { return e.err }
+
+// send makes one request, once a slot and the rate limit allow, and
+// returns the fields of the response, or how long it asked to be given
+// before a retry.
+func (e *Enricher) send(ctx context.Context, body []byte) (map[string]any, time.Duration, error) {
+	select {
+	case e.slots <- struct{}{}:
+	case <-ctx.Done():
+		return nil, 0, ctx.Err()
+	}
+	defer func() { <-e.slots }()
+	if err := e.wait(ctx); err != nil {
+		return nil, 0, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.URL, bytes.NewReader(body))
+	if err != nil {
+		return nil, 0, &permanentEnrichError{err}
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if e.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+e.Token)
+	}
+	client := e.Client
+	if client == nil {
+		client = enrichClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		err := fmt.Errorf("%s returned status %d: %s", req.URL.Host, resp.StatusCode, strings.TrimSpace(string(msg)))
+		if resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode < 500 {
+			return nil, 0, &permanentEnrichError{err}
+		}
+		var wait time.Duration
+		if s, perr := strconv.Atoi(strings.TrimSpace(resp.Header.Get("Retry-After"))); perr == nil && s > 0 {
+			wait = time.Duration(s) * time.Second
+		}
+		return nil, wait, err
+	}
+	var fields map[string]any
+	if err := json.NewDecoder(resp.Body).Decode(&fields); err != nil {
+		return nil, 0, &permanentEnrichError{fmt.Errorf("decoding response from %s: %w", req.URL.Host, err)}
+	}
+	return fields, 0, nil
+}
+
+// wait holds a request back until Rate allows it to start.
+func (e *Enricher) wait(ctx context.Context) error {
+	if e.Rate <= 0 {
+		return nil
+	}
+	e.mu.Lock()
+	now := time.Now()
+	start := e.next
+	if start.Before(now) {
+		start = now
+	}
+	e.next = start.Add(time.Duration(float64(time.Second) / e.Rate))
+	e.mu.Unlock()
+	return sleepContext(ctx, time.Until(start))
+}
+
+// sleepContext sleeps for d, or until ctx is done.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
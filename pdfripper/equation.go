@@ -0,0 +1,327 @@
+package pdfripper
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+	"image/png"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+)
+
+// EquationPlaceholder stands in for an equation in the text when there is
+// no LaTeX for it.
+const EquationPlaceholder = "[EQUATION]"
+
+// DefaultEquationDPI is the resolution equation images are cropped at.
+const DefaultEquationDPI = 300
+
+// Thresholds used by DetectEquations.
+const (
+	equationMathShare = 0.5 // Share of a line's characters that must be math for the line to be an equation.
+	equationMinChars  = 2   // Non-space characters a line needs to start an equation.
+)
+
+// Equation is a region of a page typeset as a display equation. Positions
+// are in points from the top-left corner of the page.
+type Equation struct {
+	Page   int     `json:"page"`
+	X      float64 `json:"x"`
+	Y      float64 `json:"y"`
+	Width  float64 `json:"width"`
+	Height float64 `json:"height"`
+	Text   string  `json:"text"`            // The text the region draws, which is usually garbled.
+	LaTeX  string  `json:"latex,omitempty"` // From the EquationOCR, if one is set.
+	Image  string  `json:"image,omitempty"` // Path the region's image was saved to.
+}
+
+// EquationOCR turns the image of an equation into LaTeX, as
+// LaTeX-OCR (pix2tex) does.
+type EquationOCR interface {
+	RecognizeEquation(img image.Image) (string, error)
+}
+
+// DetectEquations finds the equations on every page: runs of lines at
+// least half of whose characters are drawn in math fonts (Computer Modern
+// math, AMS, Symbol, STIX and Cambria Math, among others) or are math
+// symbols or Greek letters. Inline math inside prose is left alone. Pages
+// whose content cannot be parsed are skipped.
+func DetectEquations(pdfFile string) ([]Equation, error) {
+	d, err := openPDFFile(pdfFile)
+	if err != nil {
+		return nil, err
+	}
+	var eqs []Equation
+	for i := range d.pages {
+		page, _ := d.pageEquations(i)
+		eqs = append(eqs, page...)
+	}
+	return eqs, nil
+}
+
+// mathFontPrefixes are the starts of the names of math fonts, upper-cased.
+var mathFontPrefixes = []string{
+	"CMMI", "CMSY", "CMEX", "CMBSY", "MSAM", "MSBM", "EUFM", "EUSM", "EUEX", "RSFS", "ESINT", "WASY",
+	"TXMI", "TXSY", "TXEX", "PXMI", "PXSY", "PXEX", "MTMI", "MTSY", "MTEX", "MT-EXTRA", "MTEXTRA",
+	"SYMBOL", "EUCLID",
+}
+
+// isMathFont reports whether a font's BaseFont names a math font.
+func isMathFont(baseFont string) bool {
+	if i := strings.IndexByte(baseFont, '+'); i == 6 {
+		baseFont = baseFont[i+1:]
+	}
+	name := strings.ToUpper(baseFont)
+	if strings.Contains(name, "MATH") {
+		return true
+	}
+	for _, p := range mathFontPrefixes {
+		if strings.HasPrefix(name, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// isMathRune reports whether r is a math symbol, a Greek letter, a math
+// alphanumeric, or a superscript or subscript.
+func isMathRune(r rune) bool {
+	return unicode.In(r, unicode.Sm, unicode.Greek) ||
+		r >= 0x1d400 && r <= 0x1d7ff ||
+		r >= 0x2070 && r <= 0x209f
+}
+
+func (d *pdfDoc) pageEquations(index int) (eqs []Equation, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			eqs, err = nil, fmt.Errorf("parsing page %d: %v", index+1, r)
+		}
+	}()
+	frags, err := d.pageFragments(index)
+	if err != nil {
+		return nil, err
+	}
+
+	// Merge consecutive equation lines, such as the numerator and
+	// denominator of a fraction, into regions.
+	box := d.pages[index].mediaBox
+	var region []textFragment
+	flush := func() {
+		if len(region) > 0 {
+			eqs = append(eqs, newEquation(index+1, box, region))
+			region = nil
+		}
+	}
+	for _, line := range visibleLines(frags) {
+		chars, mathChars := 0, 0
+		for _, f := range line {
+			for _, r := range f.text {
+				if unicode.IsSpace(r) {
+					continue
+				}
+				chars++
+				if f.math || isMathRune(r) {
+					mathChars++
+				}
+			}
+		}
+		mathy := float64(mathChars) >= equationMathShare*float64(chars)
+		switch {
+		case mathy && len(region) > 0 && near(region, line):
+			// Short lines, like a lone denominator, only continue an equation.
+			region = append(region, line...)
+		case mathy && chars >= equationMinChars:
+			flush()
+			region = append(region, line...)
+		default:
+			flush()
+		}
+	}
+	flush()
+	return eqs, nil
+}
+
+// near reports whether the line frags starts within two font sizes below
+// the bottom of region.
+func near(region, frags []textFragment) bool {
+	bottom, size := math.Inf(1), 1.0
+	for _, f := range region {
+		bottom = math.Min(bottom, math.Min(f.y0, f.y1))
+		size = math.Max(size, f.size)
+	}
+	top := math.Inf(-1)
+	for _, f := range frags {
+		top = math.Max(top, math.Max(f.y0, f.y1))
+	}
+	return bottom-top < 2*size
+}
+
+// newEquation returns the equation drawn by frags, a region of the page
+// with the given MediaBox.
+func newEquation(page int, box [4]float64, frags []textFragment) Equation {
+	x0, y0, x1, y1 := textBounds(frags)
+	return Equation{
+		Page:   page,
+		X:      x0 - box[0],
+		Y:      box[3] - y1,
+		Width:  x1 - x0,
+		Height: y1 - y0,
+		Text:   strings.TrimSpace(layoutLines(frags)),
+	}
+}
+
+// equations reports whether this run looks for equations.
+func (e *Extractor) equations() bool {
+	return e.Equations || e.EquationOCR != nil
+}
+
+// checkCrops reports whether the equation and figure settings can be
+// used with the backend, which has to render the pages their images are
+// cropped from.
+func (e *Extractor) checkCrops() error {
+	if !e.equations() && !e.Figures {
+		return nil
+	}
+	if _, ok := e.Backend.(Renderer); !ok {
+		if e.EquationOCR != nil {
+			return fmt.Errorf("recognizing equations needs their images, and backend %s cannot render pages", e.Backend.Name())
+		}
+		fmt.Printf("Warning: backend %s cannot render pages, so equation and figure images are not saved\n", e.Backend.Name())
+	}
+	return nil
+}
+
+// markEquations finds the equations on a page, saves their images to
+// OutputDir as page_N_eq_K.png, runs the EquationOCR on them if
+// one is set, and replaces them in the text. It needs the input parsed by
+// openDoc.
+func (e *Extractor) markEquations(r *PageResult) error {
+	if e.doc == nil {
+		return nil
+	}
+	eqs, err := e.doc.pageEquations(r.Page - 1)
+	if err != nil {
+		fmt.Printf("Page %d: could not look for equations: %v\n", r.Page, err)
+		return nil
+	}
+	if len(eqs) == 0 {
+		return nil
+	}
+
+	dpi := e.equationDPI()
+	if renderer, ok := e.Backend.(Renderer); ok {
+		img, err := renderer.RenderPage(e.PDFFile, r.Page, dpi)
+		if err != nil {
+			return fmt.Errorf("rendering page %d: %w", r.Page, err)
+		}
+		hashRender(r, img)
+		for i := range eqs {
+			crop := cropPoints(img, eqs[i].X, eqs[i].Y, eqs[i].Width, eqs[i].Height, dpi)
+			if crop.Bounds().Empty() {
+				continue // outside the rendered page
+			}
+			path := filepath.Join(e.OutputDir, fmt.Sprintf("page_%d_eq_%d.png", r.Page, i+1))
+			if err := savePNG(path, crop); err != nil {
+				return err
+			}
+			eqs[i].Image = path
+			if e.EquationOCR == nil {
+				continue
+			}
+			latex, err := e.EquationOCR.RecognizeEquation(crop)
+			if err != nil {
+				fmt.Printf("Page %d: could not recognize equation %d: %v\n", r.Page, i+1, err)
+				continue
+			}
+			eqs[i].LaTeX = strings.TrimSpace(latex)
+		}
+	}
+	r.Text = replaceEquations(r.Text, eqs)
+	r.Equations = eqs
+	return nil
+}
+
+// cropPoints copies a region, given in points from the top-left corner
+// and widened by a small margin, out of a page rendered at dpi.
+func cropPoints(img image.Image, x, y, width, height float64, dpi int) image.Image {
+	const margin = 2 // points
+	s := float64(dpi) / 72
+	origin := img.Bounds().Min
+	rect := image.Rect(
+		int((x-margin)*s), int((y-margin)*s),
+		int(math.Ceil((x+width+margin)*s)), int(math.Ceil((y+height+margin)*s)),
+	).Add(origin).Intersect(img.Bounds())
+	dst := image.NewRGBA(image.Rect(0, 0, rect.Dx(), rect.Dy()))
+	draw.Draw(dst, dst.Bounds(), img, rect.Min, draw.Src)
+	return dst
+}
+
+func savePNG(path string, img image.Image) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	err = png.Encode(f, img)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// replaceEquations replaces the lines of text that hold an equation with
+// its LaTeX, between $$ delimiters, or with EquationPlaceholder. Lines are
+// compared with spaces removed, since backends space equations
+// differently; equations whose lines the backend laid out differently are
+// left in the text.
+func replaceEquations(text string, eqs []Equation) string {
+	owner := map[string]int{}
+	for i, eq := range eqs {
+		for _, l := range strings.Split(eq.Text, "\n") {
+			if key := equationKey(l); key != "" {
+				if _, ok := owner[key]; !ok {
+					owner[key] = i
+				}
+			}
+		}
+	}
+	lines := strings.Split(text, "\n")
+	out := lines[:0]
+	last := -1 // the equation the previous output line stands for
+	for _, l := range lines {
+		i, ok := owner[equationKey(l)]
+		if !ok {
+			out = append(out, l)
+			last = -1
+			continue
+		}
+		if i == last {
+			continue
+		}
+		if eqs[i].LaTeX != "" {
+			out = append(out, "$$"+eqs[i].LaTeX+"$$")
+		} else {
+			out = append(out, EquationPlaceholder)
+		}
+		last = i
+	}
+	return strings.Join(out, "\n")
+}
+
+func equationKey(line string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) {
+			return -1
+		}
+		return r
+	}, line)
+}
+
+func (e *Extractor) equationDPI() int {
+	if e.EquationDPI > 0 {
+		return e.EquationDPI
+	}
+	return DefaultEquationDPI
+}
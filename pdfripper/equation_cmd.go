@@ -0,0 +1,51 @@
+//go:build !noexec && !js && !wasip1
+
+package pdfripper
+
+import (
+	"errors"
+	"image"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// EquationCommand reads equations with an external command, such as
+// pix2tex from LaTeX-OCR. The path of a PNG image of the equation is
+// appended to Args, and the command prints the LaTeX on standard output;
+// a leading "<path>: ", which pix2tex prints, is removed. Like the other
+// commands pdfripper runs, it gets an empty environment.
+type EquationCommand struct {
+	Args    []string // The command and its arguments.
+	Sandbox Sandbox  // Limits for each process.
+	Runner  Runner   // Runs the command (default: ExecRunner).
+}
+
+func (c *EquationCommand) inWorkspace(dir string) any {
+	cp := *c
+	cp.Sandbox = cp.Sandbox.withTempDir(dir)
+	return &cp
+}
+
+func (c *EquationCommand) RecognizeEquation(img image.Image) (string, error) {
+	if len(c.Args) == 0 {
+		return "", errors.New("no equation OCR command")
+	}
+	dir, err := os.MkdirTemp(c.Sandbox.TempDir, "pdfripper-equation-")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "equation.png")
+	if err := savePNG(path, img); err != nil {
+		return "", err
+	}
+
+	args := append(append([]string{}, c.Args[1:]...), path)
+	out, err := runWith(c.Runner, c.Sandbox, nil, c.Args[0], args...)
+	if err != nil {
+		return "", err
+	}
+	latex := strings.TrimSpace(string(out))
+	return strings.TrimSpace(strings.TrimPrefix(latex, path+":")), nil
+}
@@ -0,0 +1,173 @@
+//go:build !noexec && !js && !wasip1
+
+package pdfripper
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// ExecRunner is the default Runner. It runs commands with os/exec, giving
+// each an empty environment and its own empty working directory, and
+// enforces the limits of the Sandbox passed to it. Commands are recorded in
+// the AuditLog set with SetAuditLog, if any, and their resource usage in the
+// PageResult of the page they are run for.
+type ExecRunner struct{}
+
+func (ExecRunner) Run(sb Sandbox, stdin []byte, name string, args ...string) ([]byte, error) {
+	return runCommand(sb, stdin, name, args...)
+}
+
+// runWith runs a command with r, or with ExecRunner if r is nil.
+func runWith(r Runner, sb Sandbox, stdin []byte, name string, args ...string) ([]byte, error) {
+	if r == nil {
+		r = ExecRunner{}
+	}
+	return r.Run(sb, stdin, name, args...)
+}
+
+// waitDelay is how long a command that timed out is waited for once it
+// has been killed.
+const waitDelay = 2 * time.Second
+
+// runCommand runs an external command, feeding it stdin if that is not nil,
+// and returns its standard output. The command gets an empty environment and
+// its own empty working directory, plus whatever limits sb sets, so file
+// arguments must be absolute.
+func runCommand(sb Sandbox, stdin []byte, name string, args ...string) ([]byte, error) {
+	dir, err := os.MkdirTemp(sb.TempDir, "pdfripper-"+filepath.Base(name)+"-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	ctx := context.Background()
+	if sb.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, sb.Timeout)
+		defer cancel()
+	}
+	cmd := exec.CommandContext(ctx, name, args...)
+	if stdin != nil {
+		cmd.Stdin = bytes.NewReader(stdin)
+	}
+	cmd.Env = []string{}
+	cmd.Dir = dir
+	// Killing the command when it times out leaves any children it started
+	// holding its output open; stop waiting for them soon after.
+	cmd.WaitDelay = waitDelay
+	var stdout, stderr bytes.Buffer
+	audit := StartAudit(cmd.Path, cmd.Args)
+	cmd.Stdout, cmd.Stderr = &stdout, audit.Stderr(&stderr)
+
+	err = startLimited(cmd, sb, name)
+	started := err == nil
+	if started {
+		err = cmd.Wait()
+		sb.meter.record(cmd.ProcessState)
+	}
+	if aerr := audit.Finish(err); aerr != nil && err == nil {
+		return nil, fmt.Errorf("recording %s in the audit log: %w", name, aerr)
+	}
+	switch {
+	case !started:
+		return nil, err
+	case err == nil:
+		return stdout.Bytes(), nil
+	case ctx.Err() != nil:
+		return nil, fmt.Errorf("%s timed out after %s", name, sb.Timeout)
+	}
+	msg := stderr.Bytes()
+	msg = msg[max(len(msg)-stderrLimit, 0):]
+	return nil, &CommandError{Name: name, Err: err, Stderr: strings.TrimSpace(string(msg))}
+}
+
+// sandboxArg0 is the argv[0] a program using this package is run with,
+// by startLimited, to limit itself and then exec a command.
+const sandboxArg0 = "pdfripper-sandbox"
+
+func init() {
+	if len(os.Args) > 0 && os.Args[0] == sandboxArg0 {
+		execLimited(os.Args[1:])
+	}
+}
+
+// startLimited starts cmd within the limits of sb. os/exec cannot set
+// resource limits or CPU affinity between fork and exec, so for a sandbox
+// with any, it starts the running program again, as sandboxArg0, which
+// the init function of this package takes before main runs: execLimited
+// sets the limits on its own process, which the command then execs into,
+// so that the command never runs without them.
+func startLimited(cmd *exec.Cmd, sb Sandbox, name string) error {
+	if cmd.Err != nil || !sb.hasRlimits() && sb.Affinity == nil {
+		return cmd.Start()
+	}
+	self, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("limiting %s: %w", name, err)
+	}
+	cpus := "-"
+	if sb.Affinity != nil {
+		var list []string
+		for _, cpu := range sb.Affinity.nextSet() {
+			list = append(list, strconv.Itoa(cpu))
+		}
+		cpus = strings.Join(list, ",")
+	}
+	limits := []string{sandboxArg0, strconv.FormatUint(sb.CPUSeconds, 10), strconv.FormatUint(sb.MemoryBytes, 10), cpus, cmd.Path}
+	cmd.Path, cmd.Args = self, append(limits, cmd.Args...)
+	return cmd.Start()
+}
+
+// execLimited is the process startLimited starts, given the CPU seconds,
+// address space in bytes (0 for no limit) and CPU list ("-" for any CPU)
+// of a sandbox, then the path and argv of a command. It sets those limits
+// on itself and execs the command, with its own environment, or exits
+// with status 126 if it cannot.
+func execLimited(args []string) {
+	fail := func(err error) {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", sandboxArg0, err)
+		os.Exit(126)
+	}
+	if len(args) < 5 {
+		fail(errors.New("want CPU seconds, memory bytes, CPUs and a command"))
+	}
+	var sb Sandbox
+	var err error
+	if sb.CPUSeconds, err = strconv.ParseUint(args[0], 10, 64); err != nil {
+		fail(err)
+	}
+	if sb.MemoryBytes, err = strconv.ParseUint(args[1], 10, 64); err != nil {
+		fail(err)
+	}
+	path, name := args[3], args[4]
+	if sb.hasRlimits() {
+		if err := setRlimits(0, sb); err != nil {
+			fail(fmt.Errorf("limiting %s: %w", name, err))
+		}
+	}
+	if args[2] != "-" {
+		cpus, err := ParseCPUList(args[2])
+		if err != nil {
+			fail(err)
+		}
+		// Affinity is that of a thread, which execve passes on only from
+		// the thread that calls it.
+		runtime.LockOSThread()
+		if err := setAffinity(0, cpus); err != nil {
+			fail(fmt.Errorf("pinning %s to CPUs: %w", name, err))
+		}
+	}
+	err = syscall.Exec(path, args[4:], os.Environ())
+	fail(fmt.Errorf("running %s: %w", name, err))
+}
@@ -0,0 +1,154 @@
+//go:build !noexec && !js && !wasip1
+
+package pdfripper
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func needShell(t *testing.T) {
+	t.Helper()
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh is not installed")
+	}
+}
+
+func TestRunCommand(t *testing.T) {
+	needShell(t)
+	sb := Sandbox{TempDir: t.TempDir()}
+
+	// Commands get an empty environment and their own empty working
+	// directory, which is removed afterwards.
+	out, err := runCommand(sb, []byte("input"), "sh", "-c", `echo "home=$HOME"; pwd; ls -A | wc -l; cat`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(string(out), "\n")
+	if len(lines) != 4 || lines[0] != "home=" || filepath.Dir(lines[1]) != sb.TempDir || strings.TrimSpace(lines[2]) != "0" || lines[3] != "input" {
+		t.Fatalf("got %q, want no $HOME, an empty directory in %s and the input", out, sb.TempDir)
+	}
+	if _, err := os.Stat(lines[1]); !os.IsNotExist(err) {
+		t.Errorf("the working directory %s was left behind", lines[1])
+	}
+
+	// A command that fails gives a CommandError with its exit code and
+	// the end of its standard error.
+	_, err = runCommand(sb, nil, "sh", "-c", "echo first >&2; echo 'last line' >&2; exit 3")
+	var cmdErr *CommandError
+	if !errors.As(err, &cmdErr) || cmdErr.Stderr != "first\nlast line" || err.Error() != "exit status 3: last line" {
+		t.Errorf("got error %v, want a CommandError of exit status 3", err)
+	}
+	var exit exitCoder
+	if !errors.As(err, &exit) || exit.ExitCode() != 3 {
+		t.Errorf("got error %v, want exit code 3", err)
+	}
+
+	// One that cannot be found or started is not a CommandError.
+	_, err = runCommand(sb, nil, "pdfripper-no-such-command")
+	if err == nil || errors.As(err, &cmdErr) {
+		t.Errorf("missing command: got error %v", err)
+	}
+
+	start := time.Now()
+	_, err = runCommand(Sandbox{TempDir: sb.TempDir, Timeout: 100 * time.Millisecond}, nil, "sh", "-c", "sleep 10")
+	if err == nil || err.Error() != "sh timed out after 100ms" || time.Since(start) > 5*time.Second {
+		t.Errorf("got error %v after %s, want a timeout", err, time.Since(start))
+	}
+}
+
+func TestRunCommandLimits(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("resource limits are applied on Linux only")
+	}
+	needShell(t)
+	// The limits apply from the command's first instruction, so the shell
+	// reads them right away.
+	cpus, err := allowedCPUs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	affinity, err := NewCPUAffinity([][]int{cpus[:1]})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sb := Sandbox{TempDir: t.TempDir(), CPUSeconds: 7, MemoryBytes: 64 << 20, Affinity: affinity}
+	out, err := runCommand(sb, nil, "sh", "-c", "ulimit -t; ulimit -v; grep Cpus_allowed_list /proc/self/status; echo \"[$PDFRIPPER_TEST]\"")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := fmt.Sprintf("7 65536 Cpus_allowed_list: %d []", cpus[0])
+	if got := strings.Join(strings.Fields(string(out)), " "); got != want {
+		t.Errorf("got %q, want limits of 7 seconds and 65536 KiB, CPU %d and an empty environment", got, cpus[0])
+	}
+
+	// It is started as a copy of this program that limits itself before
+	// it execs the command, not limited once it has started.
+	cmd := exec.Command("true")
+	if err := startLimited(cmd, sb, "true"); err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Wait(); err != nil || cmd.Args[0] != sandboxArg0 {
+		t.Errorf("ran %q: %v, want it started as %s", cmd.Args, err, sandboxArg0)
+	}
+
+	// A command that cannot be limited does not run.
+	_, err = runCommand(Sandbox{TempDir: sb.TempDir, CPUSeconds: 7, Affinity: &CPUAffinity{sets: [][]int{{cpuMaskWords * 64}}}}, nil, "sh", "-c", "echo ran")
+	if err == nil || !strings.Contains(err.Error(), "pinning sh to CPUs: CPU 4096 is out of range") {
+		t.Errorf("got error %v, want the sandbox's", err)
+	}
+}
+
+func TestAuditLog(t *testing.T) {
+	needShell(t)
+	var buf bytes.Buffer
+	SetAuditLog(NewAuditLog(&buf))
+	defer SetAuditLog(nil)
+	sb := Sandbox{TempDir: t.TempDir()}
+	runCommand(sb, nil, "sh", "-c", "echo ok")
+	runCommand(sb, nil, "sh", "-c", "printf oops >&2; exit 2")
+	runCommand(sb, nil, "pdfripper-no-such-command", "arg")
+	runCommand(sb, nil, "sh", "-c", "true", "sh", "-upw", "s3cret", "-password=s3cret")
+
+	var entries []AuditEntry
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var e AuditEntry
+		if err := json.Unmarshal([]byte(line), &e); err != nil {
+			t.Fatalf("%q: %v", line, err)
+		}
+		entries = append(entries, e)
+	}
+	if len(entries) != 4 {
+		t.Fatalf("got %d entries, want 4", len(entries))
+	}
+	ok, failed, missing, secret := entries[0], entries[1], entries[2], entries[3]
+	if ok.ExitCode != 0 || ok.Error != "" || !strings.HasSuffix(ok.Path, "/sh") || strings.Join(ok.Argv, " ") != "sh -c echo ok" || ok.PID != os.Getpid() {
+		t.Errorf("got %+v for the command that succeeded", ok)
+	}
+	// The digest of what it wrote to standard error, "oops".
+	if failed.ExitCode != 2 || failed.StderrBytes != 4 || failed.StderrSHA256 != "d13f2eadd4ed5b027fa773a29520cc0d65ce374365d641112de786f8a029c2fe" {
+		t.Errorf("got %+v for the command that failed", failed)
+	}
+	if missing.ExitCode != -1 || missing.Error == "" {
+		t.Errorf("got %+v for the command that could not start", missing)
+	}
+	if got := strings.Join(secret.Argv, " "); got != "sh -c true sh -upw xxxxx -password=xxxxx" {
+		t.Errorf("recorded %q for the command given passwords", got)
+	}
+
+	SetAuditLog(nil)
+	buf.Reset()
+	runCommand(sb, nil, "sh", "-c", "true")
+	if buf.Len() != 0 {
+		t.Errorf("recorded %q with no audit log set", buf.String())
+	}
+}
@@ -1,36 +1,139 @@
 package pdfripper
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"os"
-	"os/exec"
 	"path/filepath"
+	"regexp"
 	"runtime"
 	"strconv"
-	"strings"
-	"sync"
+	"time"
 )
 
-// Extractor holds configuration for PDF extraction.
+// Extractor holds configuration for PDF extraction. An Extractor with only
+// PDFFile set is ready to use: zero fields take their defaults for each
+// run, and New and the With options set the common ones.
+//
+// Memory use is bounded by MaxInFlight pages, independent of the page count:
+// at most MaxInFlight page texts are held at once, whether queued between
+// stages or waiting to be written in order to CombinedFile. Peak RSS is
+// therefore roughly a fixed baseline plus MaxInFlight times the largest
+// page's text, so a 100k-page document needs no more memory than a
+// 100-page one with the same settings.
 type Extractor struct {
-	PDFFile      string // Path to the input PDF file.
-	OutputDir    string // Directory to store extracted pages.
-	ProcessCount int    // Number of concurrent workers to use.
+	PDFFile             string          // Path to the input PDF file.
+	OutputDir           string          // Directory to store extracted pages (default: named after PDFFile, without its extension).
+	ProcessCount        int             // Number of concurrent extraction workers to use (default: the number of CPUs).
+	PostProcessCount    int             // Number of concurrent post-processing workers to use (default: ProcessCount).
+	PostProcessors      []PostProcessor // Transforms applied to each page, in order, before it is saved.
+	Stages              []Stage         // Custom steps run on each page, in order, after PostProcessors.
+	Hooks               []Hook          // Observers of each run's start, pages and end, called in order.
+	Sanitize            *Sanitizer      // If set, redact entities and pseudonymize identifiers in everything written, for sharing the output.
+	Backend             Backend         // Text extraction backend (default: DefaultBackend).
+	MaxInFlight         int             // Maximum pages held in memory at once (default: 2 × total workers).
+	CombinedFile        string          // If set, all pages are streamed in order into this file.
+	TOC                 bool            // Write the table of contents to TOCFile in OutputDir: the document's outline, or where it has none, the headings found by their font sizes.
+	TOCInCombined       bool            // With TOC, also start CombinedFile with the table of contents, as a page of its own.
+	SkipPageFiles       bool            // Don't write per-page files to OutputDir.
+	BatchSize           int             // Pages extracted per backend call (default: 1).
+	PageRetries         int             // Extract a page that fails up to this many more times before giving up on it.
+	Pool                WorkPool        // If set, every backend call and OCR of the run takes a slot of it first, shared with the other runs using it.
+	Agreement           *Agreement      // If set, a sample of pages is extracted with a second backend too, and how well the texts agree is recorded in the manifest.
+	Autoscale           *Autoscaler     // If set, the backend calls and OCRs made at once are raised and lowered as the run goes, from ProcessCount, instead of staying at ProcessCount and OCRWorkers.
+	Diagnostics         bool            // Save pages that still fail to DiagnosticsDir, rendered to PNG where the backend can, with a report of their errors and objects.
+	Cache               Cache           // Optional cache of extracted text, keyed by file hash, page, and options.
+	MaxFileSizeBytes    int64           // Refuse inputs larger than this many bytes (0: no limit).
+	MaxPages            int             // Refuse documents with more pages than this (0: no limit).
+	RejectActiveContent bool            // Scan the input first and refuse it if Scan reports active content.
+	AcceptNonPDF        bool            // Extract HTML and plain-text inputs, HTML with its markup removed, instead of refusing them with a NotPDFError.
+	OCR                 OCREngine       // If set, pages whose text scores below OCRThreshold are rendered and OCRed.
+	OCRThreshold        float64         // Quality score below which OCR is tried (default: DefaultOCRThreshold).
+	OCRDPI              int             // Resolution pages are rendered at for OCR (default: DefaultOCRDPI).
+	OCRWorkers          int             // Number of pages OCRed concurrently (default: ProcessCount); raise it for remote engines.
+	OCRLayout           string          // If "hocr" or "alto", save the word positions of OCRed pages next to their page files (needs a LayoutRecognizer engine).
+	OCRMerge            bool            // Keep text that meets OCRThreshold and add the OCR lines of regions without any, such as scanned inserts; Hybrid pages are OCRed too (needs a LayoutRecognizer engine).
+	ReviewThreshold     float64         // OCRed pages with a lower mean word confidence (0 to 1) are copied to ReviewDir with their image (needs a LayoutRecognizer engine).
+	ManifestFormats     []string        // Write a per-page manifest to OutputDir as manifest.<format> for each of these ("json", "csv").
+	Splitters           []Splitter      // If set, also write each logical document they find to OutputDir as doc_NNN.txt.
+	SectionMarker       *regexp.Regexp  // If set, also split the text into a file per section in SectionsDir in OutputDir, each starting at a line it matches; see ParseSectionMarker.
+	ChunkSize           int             // If set, also cut the text into chunks of at most this many characters, written to ChunksFile in OutputDir.
+	ChunkOverlap        int             // Characters each chunk repeats from the end of the one before, less than ChunkSize.
+	Segment             string          // If set, SegmentSentences or SegmentParagraphs: also write the text's sentences or paragraphs, with their pages and offsets, to SegmentsFile in OutputDir.
+	Summarize           *Summarizer     // If set, also write an abstract of the document, made with a language model, to SummaryFile in OutputDir.
+	Vectors             *VectorSink     // If set, with ChunkSize, also embed every chunk and upsert it into a vector database.
+	Tokenizer           Tokenizer       // If set, count the tokens of every page and chunk with it, in the manifest and ChunksFile, to budget for language models.
+	BarcodeDecoder      BarcodeDecoder  // Decoder used by ExtractBarcodes.
+	BarcodeDPI          int             // Resolution pages are rendered at for ExtractBarcodes (default: DefaultBarcodeDPI).
+	DetectWatermarks    bool            // Run DetectWatermarks first and record the result in manifest.json.
+	Metadata            bool            // Record the document's metadata in manifest.json, as DocumentMetadata.Fields reports it.
+	MetadataMap         MetadataMapping // Document properties to record with Metadata, and the fields to record them as (see ParseMetadataMap; implies Metadata).
+	RemoveWatermarks    bool            // Drop watermark and stamp lines from every page's text (implies DetectWatermarks).
+	PageGeometry        bool            // Set each PageResult's Geometry (implied by ManifestFormats and FilterOrientation).
+	Classify            bool            // Set each PageResult's Class (implied by OCR and ManifestFormats).
+	FilterOrientation   string          // If set, extract only pages with this orientation (Portrait, Landscape or Square).
+	Speech              bool            // Rewrite every page with SpeechText for screen readers and text-to-speech, dropping running headers and footers.
+	StripHeaders        bool            // Drop page numbers and running headers and footers from every page, as Speech does, leaving the rest of the text as it is.
+	NormalizeArabic     bool            // Replace Arabic presentation forms with letters (NormalizeArabic).
+	ReorderRTL          bool            // Put right-to-left lines into reading order (ReorderRTL), for backends that give them in visual order.
+	CollapseCJKSpaces   bool            // Remove spaces between Chinese and Japanese characters (CollapseCJKSpaces).
+	Equations           bool            // Replace display equations with EquationPlaceholder and save their images as page_N_eq_K.png.
+	EquationOCR         EquationOCR     // If set, equations are replaced with the LaTeX it reads from their images (implies Equations).
+	EquationDPI         int             // Resolution equation images are cropped at (default: DefaultEquationDPI).
+	Figures             bool            // Save figures as page_N_fig_K.png and list them with their captions in each PageResult and manifest.json.
+	FigureDPI           int             // Resolution figure images are cropped at (default: DefaultFigureDPI).
+	PageDone            PageHook        // If set, called with every page once it is saved, dropped or has failed.
+	Replacements        []Replacement   // Rules applied to every page's text, in order, before PostProcessors (see ParseReplacements).
+	TempDir             string          // Directory each run's temporary workspace is made in (default: os.TempDir).
+	KeepTemp            bool            // Leave the workspace in place when the run ends, for debugging.
+	WaitForLock         bool            // If another run holds OutputDir's lock, wait for it to be released instead of failing with a LockedError.
+	SkipOutputLock      bool            // Do not lock OutputDir, as when the caller holds its lock already (see LockDir).
+	ConfineTo           []string        // If set, the only directories the run may write in, for read-only filesystems; OutputDir and TempDir must be set and lie in them (see Confined).
+	Bates               bool            // Find each page's Bates number in its corners and record it in PageResult and the manifest.
+	BatesFileNames      bool            // Name page files after their Bates numbers, such as ABC000123.txt, where pages have them (implies Bates).
+	PageLabels          bool            // Read each page's logical label, such as "iv" or "A-3", from the document's /PageLabels and record it in PageResult and the manifest.
+	LabelFileNames      bool            // Name page files after their labels, such as iv.txt, where pages have them (implies PageLabels).
+	PageOffset          int             // If set, label each page with its number plus PageOffset instead, so that with -4 the fifth is "1"; pages that would be numbered below 1 get no label (implies PageLabels).
+	LineNumbers         string          // On pleading paper, LineNumbersStrip or LineNumbersMap; by default line numbers are left in the text.
+	Heartbeat           HeartbeatHook   // If set, called every HeartbeatInterval with the pages in flight and how long each has taken.
+	HeartbeatInterval   time.Duration   // How often Heartbeat is called (default: DefaultHeartbeatInterval).
+	SlowPage            time.Duration   // If set, warn once about each page in flight for longer than this and mark it Slow in heartbeats.
+	SampleSize          int             // If set, extract only this many pages, one drawn at random from each of as many equal stretches of the document, for triage.
+	SampleFraction      float64         // If set instead of SampleSize, sample this fraction of the pages, from 0 to 1 (at least one page).
+	SampleSeed          int64           // Seed of the random draw of sample pages; the same seed draws the same pages.
+	PageOrder           string          // Order pages are extracted and delivered in, one of PageOrders (default: OrderFirstLast); page files of the pages put first are written first.
+	PriorityPages       string          // With OrderCustom, the pages extracted first, as in "1-10,r5-z": "z" is the last page and "rN" the Nth from the end.
+	MinFreeSpace        uint64          // If set, bytes that must stay free where the run writes: it fails before starting if its estimated output would leave less, and stops releasing pages if free space drops below. Otherwise a low estimate only warns.
+
+	fileHash   string            // SHA-256 of PDFFile, computed per run when Cache is set.
+	watermarks *WatermarkReport  // Set per run when watermarks are detected.
+	metadata   map[string]string // Set per run when metadata is recorded.
+	geometry   []PageGeometry    // Set per run when page geometry is needed.
+	doc        *pdfDoc           // The input as parsed by this package, when geometry or classes are needed.
+	running    map[string]bool   // Running header and footer lines, by runningKey, for Speech and StripHeaders.
+	sample     []bool            // The pages drawn, by page number, when sampling.
+	toc        *TableOfContents  // Set per run when TOC is set and the input could be parsed.
+	labels     []string          // Page labels, by page index, when labelling pages.
+	spaceDirs  []string          // Directories on the filesystems the run writes to, checked during it when MinFreeSpace is set.
+	diag       *diagnosis        // Set per run, for Diagnostics.
+	scaler     *scaler           // Set per run when Autoscale is set.
+	agreement  *agreementCheck   // Set per run when Agreement is set.
 }
 
 // NewExtractor creates a new Extractor instance.
 // If outputDir is empty, it defaults to a directory named after the PDF file (without extension).
 // If processCount is less than 1, it defaults to the number of available CPU cores.
+// PostProcessCount starts out equal to the extraction worker count, and the
+// default backend is selected. Unlike New, it creates outputDir and fails
+// if the default backend is not available.
 func NewExtractor(pdfFile, outputDir string, processCount int) (*Extractor, error) {
 	if pdfFile == "" {
 		return nil, errors.New("input PDF file must be specified")
 	}
 
 	if outputDir == "" {
-		base := filepath.Base(pdfFile)
-		ext := filepath.Ext(base)
-		outputDir = base[:len(base)-len(ext)]
+		outputDir = defaultOutputDir(pdfFile)
 	}
 
 	if err := os.MkdirAll(outputDir, 0755); err != nil {
@@ -41,85 +144,372 @@ func NewExtractor(pdfFile, outputDir string, processCount int) (*Extractor, erro
 		processCount = runtime.NumCPU()
 	}
 
-	return &Extractor{
-		PDFFile:      pdfFile,
-		OutputDir:    outputDir,
-		ProcessCount: processCount,
-	}, nil
+	backend, err := LookupBackend(DefaultBackend)
+	if err != nil {
+		return nil, err
+	}
+
+	return New(pdfFile, WithOutputDir(outputDir), WithWorkers(processCount), WithBackend(backend)), nil
+}
+
+// defaultOutputDir returns the output directory of pdfFile when none is
+// set: its base name without the extension.
+func defaultOutputDir(pdfFile string) string {
+	base := filepath.Base(pdfFile)
+	return base[:len(base)-len(filepath.Ext(base))]
+}
+
+// setDefaults fills in the zero fields that have a default, for a run.
+func (e *Extractor) setDefaults() error {
+	if e.Backend == nil {
+		backend, err := LookupBackend(DefaultBackend)
+		if err != nil {
+			return err
+		}
+		e.Backend = backend
+	}
+	if e.ProcessCount == 0 {
+		e.ProcessCount = runtime.NumCPU()
+	}
+	if e.PostProcessCount == 0 {
+		e.PostProcessCount = e.ProcessCount
+	}
+	if e.OutputDir == "" && e.PDFFile != "" {
+		e.OutputDir = defaultOutputDir(e.PDFFile)
+	}
+	return nil
 }
 
-// getTotalPages uses the system-installed pdfinfo command to determine the number of pages.
+// getTotalPages asks the backend for the number of pages in the PDF.
 func (e *Extractor) getTotalPages() (int, error) {
-	cmd := exec.Command("pdfinfo", e.PDFFile)
-	out, err := cmd.Output()
+	if e.Cache != nil {
+		if v, ok := e.Cache.Get(e.cacheKey("pages")); ok {
+			if n, err := strconv.Atoi(v); err == nil {
+				return n, nil
+			}
+		}
+	}
+	n, err := e.Backend.PageCount(e.PDFFile)
 	if err != nil {
-		return 0, fmt.Errorf("running pdfinfo: %w", err)
-	}
-
-	lines := strings.Split(string(out), "\n")
-	for _, line := range lines {
-		if strings.HasPrefix(line, "Pages:") {
-			parts := strings.Fields(line)
-			if len(parts) >= 2 {
-				pages, err := strconv.Atoi(parts[1])
-				if err != nil {
-					return 0, fmt.Errorf("parsing pages count: %w", err)
-				}
-				return pages, nil
+		return 0, err
+	}
+	e.cachePut("pages", strconv.Itoa(n))
+	return n, nil
+}
+
+// extractPage asks the backend for the text of a single page.
+func (e *Extractor) extractPage(page int) *PageResult {
+	start := time.Now()
+	r := &PageResult{Page: page}
+	m := &usageMeter{}
+	defer func() { r.Duration, r.Usage = time.Since(start), m.total() }()
+	if text, ok := e.cachedPage(page); ok {
+		r.Text = text
+		return r
+	}
+	text, err := metering(e.Backend, m).ExtractPage(e.PDFFile, page)
+	if err != nil {
+		r.Err = fmt.Errorf("extracting page %d: %w", page, err)
+		return r
+	}
+	e.cachePut(strconv.Itoa(page), text)
+	r.Text = text
+	return r
+}
+
+// extractRange extracts pages first..last. With a batch of more than one
+// page and a backend that supports it, the whole range is extracted in one
+// call; if that call fails or returns the wrong number of pages, each page is
+// retried on its own so that one bad page doesn't fail its whole batch,
+// and again up to PageRetries times if it fails on its own. Batches that
+// are entirely cached skip the backend.
+func (e *Extractor) extractRange(first, last int) []*PageResult {
+	results := make([]*PageResult, 0, last-first+1)
+	if re, ok := e.Backend.(RangeExtractor); ok && last > first && !e.rangeCached(first, last) {
+		start := time.Now()
+		m := &usageMeter{}
+		if texts, err := metering(re, m).ExtractRange(e.PDFFile, first, last); err == nil && len(texts) == last-first+1 {
+			// The batch is timed and measured as a whole; share it out
+			// evenly, each page having the peak of the whole.
+			perPage := time.Since(start) / time.Duration(len(texts))
+			usage := m.total()
+			usage.CPU /= time.Duration(len(texts))
+			for i, text := range texts {
+				e.cachePut(strconv.Itoa(first+i), text)
+				results = append(results, &PageResult{Page: first + i, Text: text, Duration: perPage, Usage: usage})
 			}
+			return results
 		}
 	}
-	return 0, errors.New("could not determine number of pages from pdfinfo output")
+	for page := first; page <= last; page++ {
+		results = append(results, e.extractPageRetrying(page))
+	}
+	return results
 }
 
-// ExtractPages extracts text from each page using pdftotext and saves each page to a separate file.
+// rangeCached reports whether every page of first..last is in the cache.
+func (e *Extractor) rangeCached(first, last int) bool {
+	if e.Cache == nil {
+		return false
+	}
+	for page := first; page <= last; page++ {
+		if _, ok := e.cachedPage(page); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// ExtractPages extracts text from each page using the backend and saves each page to a separate file.
 func (e *Extractor) ExtractPages() error {
+	return e.ExtractPagesContext(context.Background())
+}
+
+// ExtractPagesContext is like ExtractPages but stops early when ctx is
+// done, as ExtractToContext does. It creates OutputDir if need be, and
+// locks it for the run, unless SkipOutputLock is set.
+func (e *Extractor) ExtractPagesContext(ctx context.Context) error {
+	done, err := e.enterWorkspace()
+	if err != nil {
+		return err
+	}
+	defer done()
+	if err := os.MkdirAll(e.OutputDir, 0755); err != nil {
+		return fmt.Errorf("creating output directory: %w", err)
+	}
+	if !e.SkipOutputLock {
+		unlock, err := LockDir(ctx, e.OutputDir, e.WaitForLock)
+		if err != nil {
+			return err
+		}
+		defer unlock()
+	}
+	totalPages, err := e.prepare()
+	if err != nil {
+		return err
+	}
+
+	var sinks multiSink
+	if !e.SkipPageFiles {
+		sinks = append(sinks, &dirSink{dir: e.OutputDir, layoutFormat: e.OCRLayout, batesNames: e.BatesFileNames, labelNames: e.LabelFileNames, confine: e.ConfineTo})
+	}
+	if err := e.writeTOC(); err != nil {
+		return fmt.Errorf("writing table of contents: %w", err)
+	}
+	if e.CombinedFile != "" {
+		combined, err := newCombinedSink(e.CombinedFile)
+		if err != nil {
+			return fmt.Errorf("creating combined output: %w", err)
+		}
+		if e.TOCInCombined && e.toc != nil {
+			combined.w.WriteString(e.tocText() + "\f")
+		}
+		sinks = append(sinks, combined)
+	}
+	if len(e.Splitters) > 0 {
+		sinks = append(sinks, &splitSink{dir: e.OutputDir, splitters: e.Splitters})
+	}
+	if e.SectionMarker != nil {
+		sinks = append(sinks, &sectionSink{dir: filepath.Join(e.OutputDir, SectionsDir), marker: e.SectionMarker, confine: e.ConfineTo})
+	}
+	if e.ChunkSize > 0 {
+		chunks, err := newChunkSink(filepath.Join(e.OutputDir, ChunksFile), e.ChunkSize, e.ChunkOverlap, e.Tokenizer, e.startVectors(ctx))
+		if err != nil {
+			sinks.Close()
+			return fmt.Errorf("creating chunks: %w", err)
+		}
+		sinks = append(sinks, chunks)
+	}
+	if e.Segment != "" {
+		segments, err := newSegmentSink(filepath.Join(e.OutputDir, SegmentsFile), e.Segment)
+		if err != nil {
+			sinks.Close()
+			return fmt.Errorf("creating segments: %w", err)
+		}
+		sinks = append(sinks, segments)
+	}
+	if e.Summarize != nil {
+		sinks = append(sinks, newSummarySink(ctx, e.Summarize, filepath.Join(e.OutputDir, SummaryFile), e.ConfineTo))
+	}
+	if len(sinks) == 0 {
+		return errors.New("no output selected: page files are disabled and no combined file is set")
+	}
+	// Manifest sinks come last so they see each page's OutputFile.
+	watermarks := e.watermarks
+	if e.Sanitize != nil {
+		// Their text is the document's own, such as a company name.
+		watermarks = nil
+	}
+	manifests, err := newManifestSinks(e.OutputDir, e.ManifestFormats, e.Backend.Name(), watermarks, e.metadata, e.agreement)
+	if err != nil {
+		sinks.Close()
+		return fmt.Errorf("creating manifest: %w", err)
+	}
+	sinks = append(sinks, manifests...)
+
+	ordered := e.CombinedFile != "" || len(manifests) > 0 || len(e.Splitters) > 0 || e.SectionMarker != nil || e.ChunkSize > 0 || e.Segment != "" || e.Summarize != nil
+	return e.runHooked(ctx, totalPages, sinks, ordered)
+}
+
+// ExtractTo extracts every page into sink instead of the output directory.
+// Pages are delivered in the order they are extracted in, page order
+// unless PageOrder says otherwise. The sink is closed when extraction ends.
+func (e *Extractor) ExtractTo(sink Sink) error {
+	return e.ExtractToContext(context.Background(), sink)
+}
+
+// ExtractToContext is like ExtractTo but stops early when ctx is done. Pages
+// already in flight are still delivered; ctx.Err() is returned.
+func (e *Extractor) ExtractToContext(ctx context.Context, sink Sink) error {
+	done, err := e.enterWorkspace()
+	if err != nil {
+		sink.Close()
+		return err
+	}
+	defer done()
+	totalPages, err := e.prepare()
+	if err != nil {
+		sink.Close()
+		return err
+	}
+	return e.runHooked(ctx, totalPages, sink, true)
+}
+
+// prepare does the work that comes before any page is extracted: Validate,
+// checking the input is a whole PDF, the size and page limits, the active content scan, watermark detection,
+// reading the metadata, hashing the input when a cache is configured,
+// parsing it for page geometry and classification, drawing the sample
+// and the disk space check. It returns the page count.
+func (e *Extractor) prepare() (int, error) {
+	if err := e.Validate(); err != nil {
+		return 0, err
+	}
+	pdf, err := e.checkType()
+	if err != nil {
+		return 0, err
+	}
+	e.diag = &diagnosis{}
+	if e.MaxFileSizeBytes > 0 {
+		info, err := os.Stat(e.PDFFile)
+		if err != nil {
+			return 0, fmt.Errorf("checking input size: %w", err)
+		}
+		if info.Size() > e.MaxFileSizeBytes {
+			return 0, &LimitError{Limit: "MaxFileSizeBytes", Value: info.Size(), Max: e.MaxFileSizeBytes}
+		}
+	}
+
+	if e.RejectActiveContent && pdf {
+		report, err := Scan(e.PDFFile)
+		if err != nil {
+			return 0, fmt.Errorf("scanning for active content: %w", err)
+		}
+		if report.ActiveContent() {
+			return 0, &ActiveContentError{Report: report}
+		}
+	}
+
+	e.watermarks = nil
+	if (e.DetectWatermarks || e.RemoveWatermarks) && pdf {
+		report, err := DetectWatermarks(e.PDFFile)
+		if err != nil {
+			return 0, fmt.Errorf("detecting watermarks: %w", err)
+		}
+		for _, w := range report.Watermarks {
+			kind := "watermark"
+			if w.Stamp {
+				kind = "stamp"
+			}
+			fmt.Printf("Found %s %q on %d page(s)\n", kind, w.Text, len(w.Pages))
+		}
+		e.watermarks = report
+	}
+
+	e.metadata = nil
+	if (e.Metadata || len(e.MetadataMap) > 0) && pdf {
+		m, err := Metadata(e.PDFFile)
+		if err != nil {
+			// The backend may read files the package's parser cannot.
+			fmt.Printf("Warning: document metadata unavailable: %v\n", err)
+			m = &DocumentMetadata{}
+		}
+		e.metadata = m.Fields(e.MetadataMap)
+	}
+
+	if e.Cache != nil {
+		hash, err := hashFile(e.PDFFile)
+		if err != nil {
+			return 0, fmt.Errorf("hashing input for cache: %w", err)
+		}
+		e.fileHash = hash
+	}
+
 	totalPages, err := e.getTotalPages()
 	if err != nil {
-		return fmt.Errorf("getting total pages: %w", err)
+		return 0, fmt.Errorf("getting total pages: %w", err)
+	}
+	if e.MaxPages > 0 && totalPages > e.MaxPages {
+		return 0, &LimitError{Limit: "MaxPages", Value: int64(totalPages), Max: int64(e.MaxPages)}
 	}
 	fmt.Printf("Total pages: %d\n", totalPages)
 
-	// Create a channel to distribute page numbers (1-indexed) to workers.
-	pagesChan := make(chan int, totalPages)
-	var wg sync.WaitGroup
-	var mu sync.Mutex
-	var firstErr error
-
-	workerCount := e.ProcessCount
-	if workerCount > totalPages {
-		workerCount = totalPages
-	}
-
-	// Launch worker goroutines.
-	for i := 0; i < workerCount; i++ {
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-			for page := range pagesChan {
-				outputFile := filepath.Join(e.OutputDir, fmt.Sprintf("page_%d.txt", page))
-				// Use pdftotext to extract one page:
-				// -f <page> sets the first page and -l <page> sets the last page.
-				cmd := exec.Command("pdftotext", "-f", strconv.Itoa(page), "-l", strconv.Itoa(page), e.PDFFile, outputFile)
-				if err := cmd.Run(); err != nil {
-					mu.Lock()
-					if firstErr == nil {
-						firstErr = fmt.Errorf("extracting page %d: %w", page, err)
-					}
-					mu.Unlock()
-					continue
-				}
-				fmt.Printf("Saved page %d to %s\n", page, outputFile)
-			}
-		}()
+	e.doc, e.geometry = nil, nil
+	if pdf || e.FilterOrientation != "" {
+		if err := e.openDoc(totalPages); err != nil {
+			return 0, err
+		}
+	}
+	if err := e.checkCrops(); err != nil {
+		return 0, err
+	}
+	e.running = nil
+	if (e.Speech || e.StripHeaders) && e.doc != nil {
+		e.running = e.doc.runningLines(e.localize)
+	}
+	if e.FilterOrientation != "" {
+		fmt.Printf("Selected %d %s pages\n", e.includedPages(totalPages), e.FilterOrientation)
 	}
+	e.loadLabels(totalPages)
+	e.loadTOC()
+	e.chooseSample(totalPages)
+	e.startAgreement(totalPages)
+	if err := e.checkDiskSpace(e.includedPages(totalPages)); err != nil {
+		return 0, err
+	}
+	return totalPages, nil
+}
 
-	// Enqueue page numbers.
-	for i := 1; i <= totalPages; i++ {
-		pagesChan <- i
+// checkType checks that the input is a whole PDF with CheckPDF, or an
+// HTML or text file with AcceptNonPDF, which it points the run at a
+// backend for, and reports whether it is a PDF.
+func (e *Extractor) checkType() (bool, error) {
+	err := CheckPDF(e.PDFFile)
+	var notPDF *NotPDFError
+	switch {
+	case err == nil:
+		return true, nil
+	case !errors.As(err, &notPDF):
+		return false, fmt.Errorf("reading input: %w", err)
+	case e.AcceptNonPDF && (notPDF.Type == MediaHTML || notPDF.Type == MediaText):
+		// There are no pages to render, so no OCR.
+		fmt.Printf("Extracting %s as %s\n", e.PDFFile, notPDF.Type)
+		e.Backend, e.OCR = textBackend{html: notPDF.Type == MediaHTML}, nil
+		return false, nil
 	}
-	close(pagesChan)
+	return false, err
+}
 
-	wg.Wait()
-	return firstErr
+// LimitError reports that the input exceeds MaxFileSizeBytes or MaxPages.
+// It is returned before any page is extracted.
+type LimitError struct {
+	Limit string // "MaxFileSizeBytes" or "MaxPages"
+	Value int64  // The file size in bytes, or the page count.
+	Max   int64  // The configured limit.
+}
+
+func (e *LimitError) Error() string {
+	if e.Limit == "MaxPages" {
+		return fmt.Sprintf("document has %d pages, more than the limit of %d", e.Value, e.Max)
+	}
+	return fmt.Sprintf("file is %d bytes, more than the limit of %d", e.Value, e.Max)
 }
@@ -0,0 +1,54 @@
+package pdfripper
+
+import (
+	"fmt"
+	"testing"
+)
+
+// rangeBackend extracts "page N" for page N, and ranges of extra more (or,
+// if negative, fewer) texts than pages asked for.
+type rangeBackend struct {
+	extra int
+}
+
+func (b *rangeBackend) Name() string                          { return "range" }
+func (b *rangeBackend) PageCount(pdfFile string) (int, error) { return 10, nil }
+
+func (b *rangeBackend) ExtractPage(pdfFile string, page int) (string, error) {
+	return fmt.Sprintf("page %d", page), nil
+}
+
+func (b *rangeBackend) ExtractRange(pdfFile string, first, last int) ([]string, error) {
+	var texts []string
+	for page := first; page <= last+b.extra; page++ {
+		texts = append(texts, fmt.Sprintf("batched page %d", page))
+	}
+	return texts, nil
+}
+
+func TestExtractRange(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		extra  int
+		prefix string
+	}{
+		{"exact", 0, "batched "},
+		{"short", -1, ""},
+		{"empty", -3, ""},
+		{"long", 2, ""},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			e := &Extractor{Backend: &rangeBackend{extra: tt.extra}}
+			results := e.extractRange(3, 5)
+			if len(results) != 3 {
+				t.Fatalf("got %d results, want 3", len(results))
+			}
+			for i, r := range results {
+				want := fmt.Sprintf("%spage %d", tt.prefix, 3+i)
+				if r.Err != nil || r.Page != 3+i || r.Text != want {
+					t.Errorf("result %d = page %d %q (%v), want page %d %q", i, r.Page, r.Text, r.Err, 3+i, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,182 @@
+package pdfripper
+
+import (
+	"fmt"
+	"math"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// DefaultFigureDPI is the resolution figure images are cropped at.
+const DefaultFigureDPI = 150
+
+// Limits used by DetectFigures.
+const (
+	figureMinArea     = 72 * 72 // Square points an image needs to be a figure, one square inch.
+	figureMaxCoverage = 0.9     // Fraction of the page from which an image is a background or a scan, not a figure.
+	captionMaxGap     = 36      // Points between a figure and its caption, above or below it.
+	captionMaxLines   = 6       // Lines a caption may run to.
+)
+
+// captionRe matches the start of a caption, such as "Figure 3:",
+// "Fig. 2.1" or "Abbildung 4".
+var captionRe = regexp.MustCompile(`(?i)^(?:fig(?:ure)?\.?|chart|diagram|illustration|plate|exhibit|photo|abb(?:ildung|\.)|figura)\s*\d+[a-z]?(?:\.\d+)*\b`)
+
+// Figure is an image on a page with the caption that goes with it.
+// Positions are in points from the top-left corner of the page.
+type Figure struct {
+	Page    int     `json:"page"`
+	X       float64 `json:"x"`
+	Y       float64 `json:"y"`
+	Width   float64 `json:"width"`
+	Height  float64 `json:"height"`
+	Caption string  `json:"caption"`         // Empty if none was found.
+	Image   string  `json:"image,omitempty"` // Path the figure's image was saved to.
+}
+
+// DetectFigures finds the figures on every page: images of at least a
+// square inch that do not cover most of the page. Each gets the caption
+// starting with "Figure N", "Fig. N" or the like that is closest above or
+// below it and overlaps it horizontally. Pages whose content cannot be
+// parsed are skipped.
+func DetectFigures(pdfFile string) ([]Figure, error) {
+	d, err := openPDFFile(pdfFile)
+	if err != nil {
+		return nil, err
+	}
+	var figs []Figure
+	for i := range d.pages {
+		page, _ := d.pageFigures(i)
+		figs = append(figs, page...)
+	}
+	return figs, nil
+}
+
+// caption is a caption found on a page, in device space.
+type caption struct {
+	text           string
+	x0, y0, x1, y1 float64
+	used           bool
+}
+
+func (d *pdfDoc) pageFigures(index int) (figs []Figure, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			figs, err = nil, fmt.Errorf("parsing page %d: %v", index+1, r)
+		}
+	}()
+	ci, err := d.interpretPage(index)
+	if err != nil {
+		return nil, err
+	}
+	box := d.pages[index].mediaBox
+	pageArea := (box[2] - box[0]) * (box[3] - box[1])
+
+	captions := findCaptions(visibleLines(ci.fragments))
+	for _, img := range ci.images {
+		x0, y0 := math.Max(img[0], box[0]), math.Max(img[1], box[1])
+		x1, y1 := math.Min(img[2], box[2]), math.Min(img[3], box[3])
+		area := (x1 - x0) * (y1 - y0)
+		if x1 <= x0 || y1 <= y0 || area < figureMinArea || area > figureMaxCoverage*pageArea {
+			continue
+		}
+		fig := Figure{Page: index + 1, X: x0 - box[0], Y: box[3] - y1, Width: x1 - x0, Height: y1 - y0}
+
+		var best *caption
+		bestGap := math.Inf(1)
+		for i := range captions {
+			c := &captions[i]
+			if c.used || c.x1 <= x0 || c.x0 >= x1 {
+				continue
+			}
+			// Below the figure, then above it; a caption a little inside
+			// the image's box still counts.
+			gap := y0 - c.y1
+			if c.y1 > y0 {
+				gap = c.y0 - y1
+			}
+			if gap >= -captionMaxGap/2 && gap <= captionMaxGap && gap < bestGap {
+				best, bestGap = c, gap
+			}
+		}
+		if best != nil {
+			best.used = true
+			fig.Caption = best.text
+		}
+		figs = append(figs, fig)
+	}
+	return figs, nil
+}
+
+// findCaptions returns the captions among lines: a line starting like a
+// caption, with the lines right below it that continue it.
+func findCaptions(lines [][]textFragment) []caption {
+	var captions []caption
+	for i := 0; i < len(lines); i++ {
+		text := strings.TrimSpace(layoutLines(lines[i]))
+		if !captionRe.MatchString(text) {
+			continue
+		}
+		parts := []string{text}
+		x0, y0, x1, y1 := textBounds(lines[i])
+		height := y1 - y0
+		for j := i + 1; j < len(lines) && len(parts) < captionMaxLines; j++ {
+			next := strings.TrimSpace(layoutLines(lines[j]))
+			nx0, ny0, nx1, ny1 := textBounds(lines[j])
+			if captionRe.MatchString(next) || y0-ny1 > 0.5*height || ny1 > y1 {
+				break
+			}
+			parts = append(parts, next)
+			x0, y0, x1 = math.Min(x0, nx0), math.Min(y0, ny0), math.Max(x1, nx1)
+			i = j
+		}
+		captions = append(captions, caption{text: strings.Join(parts, " "), x0: x0, y0: y0, x1: x1, y1: y1})
+	}
+	return captions
+}
+
+// saveFigures finds the figures on a page and, if the backend can render
+// pages, saves their images to OutputDir as page_N_fig_K.png. It needs the
+// input parsed by openDoc.
+func (e *Extractor) saveFigures(r *PageResult) error {
+	if e.doc == nil {
+		return nil
+	}
+	figs, err := e.doc.pageFigures(r.Page - 1)
+	if err != nil {
+		fmt.Printf("Page %d: could not look for figures: %v\n", r.Page, err)
+		return nil
+	}
+	if len(figs) == 0 {
+		return nil
+	}
+	if renderer, ok := e.Backend.(Renderer); ok {
+		dpi := e.figureDPI()
+		img, err := renderer.RenderPage(e.PDFFile, r.Page, dpi)
+		if err != nil {
+			return fmt.Errorf("rendering page %d: %w", r.Page, err)
+		}
+		hashRender(r, img)
+		for i := range figs {
+			crop := cropPoints(img, figs[i].X, figs[i].Y, figs[i].Width, figs[i].Height, dpi)
+			if crop.Bounds().Empty() {
+				continue
+			}
+			path := filepath.Join(e.OutputDir, fmt.Sprintf("page_%d_fig_%d.png", r.Page, i+1))
+			if err := savePNG(path, crop); err != nil {
+				return err
+			}
+			figs[i].Image = path
+		}
+	}
+	r.Figures = figs
+	return nil
+}
+
+func (e *Extractor) figureDPI() int {
+	if e.FigureDPI > 0 {
+		return e.FigureDPI
+	}
+	return DefaultFigureDPI
+}
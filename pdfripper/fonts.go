@@ -0,0 +1,173 @@
+package pdfripper
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// FontInfo describes a font used by a page.
+type FontInfo struct {
+	Name        string // BaseFont, including any subset tag.
+	Subtype     string // Type1, TrueType, Type0, Type3, ...
+	Encoding    string // Encoding name, "custom" for an embedded CMap or a Differences array, or "" for the font's built-in encoding.
+	Embedded    bool   // The font program is included in the file.
+	ToUnicode   bool   // The font has a ToUnicode CMap.
+	Extractable bool   // Text shown in the font can be mapped to Unicode.
+}
+
+// PageFonts lists the fonts a page's content can use, including those of
+// the form XObjects it draws.
+type PageFonts struct {
+	Page  int // 1-indexed
+	Fonts []FontInfo
+}
+
+// Fonts reports the fonts of every page. A font that is not Extractable
+// has no usable Unicode mapping, so its text comes out as garbage or not
+// at all whichever backend is used; such pages need OCR instead.
+func Fonts(pdfFile string) (pages []PageFonts, err error) {
+	d, err := openPDFFile(pdfFile)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			pages, err = nil, fmt.Errorf("reading fonts of %s: %v", pdfFile, r)
+		}
+	}()
+
+	info := map[pdfRef]FontInfo{}
+	for i, p := range d.pages {
+		pf := PageFonts{Page: i + 1}
+		seen := map[pdfRef]bool{}
+		d.collectFonts(p.resources, seen, func(obj pdfObject) {
+			ref, isRef := obj.(pdfRef)
+			if isRef {
+				if fi, ok := info[ref]; ok {
+					pf.Fonts = append(pf.Fonts, fi)
+					return
+				}
+			}
+			fi := d.fontInfo(d.resolveDict(obj))
+			if isRef {
+				info[ref] = fi
+			}
+			pf.Fonts = append(pf.Fonts, fi)
+		})
+		pages = append(pages, pf)
+	}
+	return pages, nil
+}
+
+// collectFonts calls add for each font in resources and, recursively, in
+// the resources of their form XObjects. seen guards against fonts and forms
+// referenced more than once.
+func (d *pdfDoc) collectFonts(resources pdfDict, seen map[pdfRef]bool, add func(pdfObject)) {
+	fonts := d.resolveDict(resources["Font"])
+	for _, name := range sortedKeys(fonts) {
+		obj := fonts[name]
+		if ref, ok := obj.(pdfRef); ok {
+			if seen[ref] {
+				continue
+			}
+			seen[ref] = true
+		}
+		add(obj)
+	}
+	xobjects := d.resolveDict(resources["XObject"])
+	for _, name := range sortedKeys(xobjects) {
+		obj := xobjects[name]
+		ref, ok := obj.(pdfRef)
+		if !ok || seen[ref] {
+			continue
+		}
+		seen[ref] = true
+		if s := d.resolveStream(obj); s != nil && d.resolveName(s.dict["Subtype"]) == "Form" {
+			d.collectFonts(d.resolveDict(s.dict["Resources"]), seen, add)
+		}
+	}
+}
+
+// cidOrderings are the character collections whose CIDs consumers can map
+// to Unicode with Adobe's published CMaps.
+var cidOrderings = map[string]bool{"GB1": true, "CNS1": true, "Japan1": true, "Korea1": true, "KR": true}
+
+func (d *pdfDoc) fontInfo(dict pdfDict) FontInfo {
+	fi := FontInfo{
+		Name:    string(d.resolveName(dict["BaseFont"])),
+		Subtype: string(d.resolveName(dict["Subtype"])),
+	}
+	_, fi.ToUnicode = dict["ToUnicode"]
+	if fi.ToUnicode && d.resolveStream(dict["ToUnicode"]) == nil {
+		fi.ToUnicode = false // e.g. /ToUnicode /Identity-H, which is not a real map
+	}
+	descFont := dict
+	var differences pdfArray
+	switch enc := d.resolve(dict["Encoding"]).(type) {
+	case pdfName:
+		fi.Encoding = string(enc)
+	case pdfDict:
+		fi.Encoding = "custom"
+		differences = d.resolveArray(enc["Differences"])
+	case *pdfStream:
+		fi.Encoding = "custom"
+	}
+	if fi.Subtype == "Type0" {
+		if desc := d.resolveArray(dict["DescendantFonts"]); len(desc) > 0 {
+			descFont = d.resolveDict(desc[0])
+		}
+	}
+	desc := d.resolveDict(descFont["FontDescriptor"])
+	for _, key := range []pdfName{"FontFile", "FontFile2", "FontFile3"} {
+		if _, ok := desc[key]; ok {
+			fi.Embedded = true
+		}
+	}
+
+	switch {
+	case fi.ToUnicode:
+		fi.Extractable = true
+	case fi.Subtype == "Type0":
+		info := d.resolveDict(descFont["CIDSystemInfo"])
+		registry, _ := d.resolve(info["Registry"]).(pdfString)
+		ordering, _ := d.resolve(info["Ordering"]).(pdfString)
+		fi.Extractable = strings.Contains(fi.Encoding, "UCS2") || strings.Contains(fi.Encoding, "UTF16") ||
+			(string(registry) == "Adobe" && cidOrderings[string(ordering)])
+	case fi.Subtype == "Type3":
+		fi.Extractable = len(differences) > 0 && glyphNamesKnown(differences)
+	default:
+		flags, _ := pdfInt(d.resolve(desc["Flags"]))
+		symbolic := flags&4 != 0 && flags&32 == 0
+		fi.Extractable = glyphNamesKnown(differences) && (!symbolic || !fi.Embedded || fi.Encoding != "")
+	}
+	if fi.Subtype == "Type3" {
+		fi.Embedded = true // the glyphs are content streams in the file
+	}
+	return fi
+}
+
+// glyphNamesKnown reports whether most glyph names in a Differences array
+// map to Unicode. Subsetting tools often rename glyphs to g12 or cid37,
+// which leaves nothing to map.
+func glyphNamesKnown(differences pdfArray) bool {
+	known, total := 0, 0
+	for _, item := range differences {
+		if name, ok := item.(pdfName); ok {
+			total++
+			if glyphRune(string(name)) != "" {
+				known++
+			}
+		}
+	}
+	return total == 0 || known*2 >= total
+}
+
+func sortedKeys(dict pdfDict) []pdfName {
+	keys := make([]pdfName, 0, len(dict))
+	for k := range dict {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+	return keys
+}
@@ -0,0 +1,126 @@
+package pdfripper
+
+import "fmt"
+
+// Page orientations, as reported by PageGeometry.Orientation and accepted
+// in Extractor.FilterOrientation.
+const (
+	Portrait  = "portrait"
+	Landscape = "landscape"
+	Square    = "square"
+)
+
+// PageGeometry is the size and rotation of a page.
+type PageGeometry struct {
+	Width    float64 // MediaBox width in points, before rotation.
+	Height   float64 // MediaBox height in points, before rotation.
+	Rotation int     // The page's /Rotate, normalized to 0, 90, 180 or 270.
+}
+
+// Orientation reports how the page is displayed, taking Rotation into
+// account: Portrait, Landscape or Square, or "" if the page has no size.
+func (g PageGeometry) Orientation() string {
+	w, h := g.Width, g.Height
+	if g.Rotation == 90 || g.Rotation == 270 {
+		w, h = h, w
+	}
+	switch {
+	case w <= 0 || h <= 0:
+		return ""
+	case w > h:
+		return Landscape
+	case h > w:
+		return Portrait
+	}
+	return Square
+}
+
+// PageGeometries reads the MediaBox and rotation of every page, with
+// inherited values applied, using the package's own PDF parser.
+func PageGeometries(pdfFile string) ([]PageGeometry, error) {
+	d, err := openPDFFile(pdfFile)
+	if err != nil {
+		return nil, err
+	}
+	return d.pageGeometries(), nil
+}
+
+func (d *pdfDoc) pageGeometries() []PageGeometry {
+	pages := make([]PageGeometry, len(d.pages))
+	for i, p := range d.pages {
+		rot := p.rotate % 360
+		if rot < 0 {
+			rot += 360
+		}
+		pages[i] = PageGeometry{
+			Width:    p.mediaBox[2] - p.mediaBox[0],
+			Height:   p.mediaBox[3] - p.mediaBox[1],
+			Rotation: rot / 90 * 90,
+		}
+	}
+	return pages
+}
+
+// openDoc parses the input with the package's own parser when page
+// geometry, classification, running headers, equations, figures, the
+// positions of Bates numbers or numbered lines, page labels, the outline
+// or the table of contents are needed
+// for this run, and reads the geometry. The parse is required for
+// FilterOrientation; for everything else it is best effort, since the
+// backend may read files this parser cannot, and a failure only leaves
+// Geometry, Class and Figures unset, running headers and equations in
+// place and the pages in page order.
+func (e *Extractor) openDoc(totalPages int) error {
+	e.doc, e.geometry = nil, nil
+	needGeometry := e.FilterOrientation != "" || e.PageGeometry || len(e.ManifestFormats) > 0
+	if !needGeometry && !e.classifying() && !e.Speech && !e.StripHeaders && !e.equations() && !e.Figures && !e.bates() && !e.pageLabels() && !e.TOC && e.LineNumbers != LineNumbersMap && e.PageOrder != OrderOutline {
+		return nil
+	}
+	d, err := openPDFFile(e.PDFFile)
+	if err == nil && len(d.pages) != totalPages {
+		err = fmt.Errorf("found %d pages, but the backend reports %d", len(d.pages), totalPages)
+	}
+	if err != nil {
+		if e.FilterOrientation != "" {
+			return fmt.Errorf("reading page geometry: %w", err)
+		}
+		fmt.Printf("Warning: page geometry, classification, running headers, equations, figures, page labels, the outline and the table of contents unavailable: %v\n", err)
+		return nil
+	}
+	e.doc = d
+	if needGeometry {
+		e.geometry = d.pageGeometries()
+	}
+	return nil
+}
+
+// included reports whether page passes FilterOrientation and, once it is
+// drawn, is in the sample.
+func (e *Extractor) included(page int) bool {
+	if e.sample != nil && !e.sample[page] {
+		return false
+	}
+	if e.FilterOrientation == "" {
+		return true
+	}
+	return e.geometry[page-1].Orientation() == e.FilterOrientation
+}
+
+// includedPages returns how many of totalPages are included.
+func (e *Extractor) includedPages(totalPages int) int {
+	n := 0
+	for p := 1; p <= totalPages; p++ {
+		if e.included(p) {
+			n++
+		}
+	}
+	return n
+}
+
+// pageGeometry returns the geometry of page, or nil if it was not loaded.
+func (e *Extractor) pageGeometry(page int) *PageGeometry {
+	if e.geometry == nil {
+		return nil
+	}
+	return &e.geometry[page-1]
+}
@@ -0,0 +1,172 @@
+package pdfripper
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DefaultHeartbeatInterval is how often Extractor.Heartbeat is called by
+// default.
+const DefaultHeartbeatInterval = 30 * time.Second
+
+// Stages of a page, as reported in InFlightPage.Stage: the last stage of
+// the pipeline that took it up. A page waits in its stage until the next
+// one has a worker free, and in StageSink until the pages before it are
+// written.
+const (
+	StageExtract     = "extract"
+	StageOCR         = "ocr"
+	StagePostProcess = "post-process"
+	StageSink        = "sink"
+)
+
+// etaWindow is how many of the latest pages the estimate of the time a
+// run has left is drawn from.
+const etaWindow = 20
+
+// Heartbeat is a progress report of a run, given to a HeartbeatHook.
+type Heartbeat struct {
+	Done     int            // Pages written or failed so far.
+	Total    int            // Pages in the document.
+	InFlight []InFlightPage // Pages being worked on, in page order.
+	ETA      time.Duration  // Estimated time left, at the pace of the latest pages; 0 until one is done.
+}
+
+// InFlightPage is a page being worked on.
+type InFlightPage struct {
+	Page    int
+	Stage   string        // One of StageExtract, StageOCR, StagePostProcess and StageSink, or the Name of one of Extractor.Stages.
+	Elapsed time.Duration // Since the page's extraction started.
+	Slow    bool          // Elapsed is over Extractor.SlowPage.
+}
+
+// HeartbeatHook receives the heartbeats of a run. It is called from a
+// goroutine of its own, since a stuck page holds up the others.
+type HeartbeatHook func(h Heartbeat)
+
+// pageTracker records the pages in flight in a run. Its methods do
+// nothing on a nil tracker, which runs without heartbeats use.
+type pageTracker struct {
+	mu     sync.Mutex
+	total  int
+	done   int
+	pages  map[int]*trackedPage
+	warned map[int]bool
+	marks  []time.Time // When the run started, then when each of the latest etaWindow pages left.
+}
+
+type trackedPage struct {
+	start time.Time
+	stage string
+}
+
+// enter records that page has reached stage, starting its clock if it is
+// new.
+func (t *pageTracker) enter(page int, stage string) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if p, ok := t.pages[page]; ok {
+		p.stage = stage
+		return
+	}
+	t.pages[page] = &trackedPage{start: time.Now(), stage: stage}
+}
+
+// leave records that page is written or has failed.
+func (t *pageTracker) leave(page int) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.pages, page)
+	t.done++
+	if t.marks = append(t.marks, time.Now()); len(t.marks) > etaWindow+1 {
+		t.marks = t.marks[1:]
+	}
+}
+
+// eta estimates the time left from the pages finished in the window of
+// marks: pages take times too different for the pace of the whole run so
+// far to say much, and those finished together by parallel workers count
+// as the throughput they are.
+func (t *pageTracker) eta() time.Duration {
+	n := len(t.marks) - 1
+	if n < 1 || t.done >= t.total {
+		return 0
+	}
+	perPage := t.marks[n].Sub(t.marks[0]) / time.Duration(n)
+	return perPage * time.Duration(t.total-t.done)
+}
+
+// heartbeat returns the state of the run, marking pages in flight for
+// longer than slow, if set.
+func (t *pageTracker) heartbeat(slow time.Duration) Heartbeat {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	h := Heartbeat{Done: t.done, Total: t.total, ETA: t.eta()}
+	now := time.Now()
+	for page, p := range t.pages {
+		elapsed := now.Sub(p.start)
+		h.InFlight = append(h.InFlight, InFlightPage{Page: page, Stage: p.stage, Elapsed: elapsed, Slow: slow > 0 && elapsed > slow})
+	}
+	sort.Slice(h.InFlight, func(i, j int) bool { return h.InFlight[i].Page < h.InFlight[j].Page })
+	return h
+}
+
+// startWatchdog returns the tracker of a run of totalPages, and a function
+// that stops it, if Heartbeat or SlowPage is set; otherwise a nil tracker.
+// While the run goes on, Heartbeat is called every HeartbeatInterval and a
+// warning is printed the first time each page is in flight for longer
+// than SlowPage.
+func (e *Extractor) startWatchdog(totalPages int) (*pageTracker, func()) {
+	if e.Heartbeat == nil && e.SlowPage <= 0 {
+		return nil, func() {}
+	}
+	t := &pageTracker{total: totalPages, pages: map[int]*trackedPage{}, warned: map[int]bool{}, marks: []time.Time{time.Now()}}
+	interval := e.HeartbeatInterval
+	if interval <= 0 {
+		interval = DefaultHeartbeatInterval
+	}
+	// Slow pages are looked for more often than heartbeats are due, so a
+	// short SlowPage is not reported late.
+	check := interval
+	if e.SlowPage > 0 {
+		check = min(check, max(e.SlowPage/2, time.Second))
+	}
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(check)
+		defer ticker.Stop()
+		last := time.Now()
+		for {
+			select {
+			case <-done:
+				return
+			case now := <-ticker.C:
+				h := t.heartbeat(e.SlowPage)
+				for _, p := range h.InFlight {
+					if p.Slow && !t.warned[p.Page] {
+						t.warned[p.Page] = true
+						fmt.Printf("Warning: page %d has been in flight for %s, now in %s\n", p.Page, p.Elapsed.Round(time.Second), p.Stage)
+					}
+				}
+				if e.Heartbeat != nil && now.Sub(last) >= interval-check/2 {
+					last = now
+					e.Heartbeat(h)
+				}
+			}
+		}
+	}()
+	return t, func() {
+		close(done)
+		<-stopped
+	}
+}
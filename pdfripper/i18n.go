@@ -0,0 +1,173 @@
+package pdfripper
+
+import (
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// isRTL reports whether r is a strong right-to-left character: Hebrew,
+// Arabic, Syriac, Thaana or NKo, or one of their presentation forms.
+func isRTL(r rune) bool {
+	return r >= 0x0590 && r <= 0x08ff || r >= 0xfb1d && r <= 0xfdff || r >= 0xfe70 && r <= 0xfeff
+}
+
+// isLTR reports whether r keeps left-to-right order inside a right-to-left
+// line: a letter of another script, or a digit.
+func isLTR(r rune) bool {
+	return !isRTL(r) && (unicode.IsLetter(r) || unicode.IsDigit(r))
+}
+
+// mirrored maps the paired punctuation that right-to-left text displays
+// mirrored.
+var mirrored = map[rune]rune{
+	'(': ')', ')': '(', '[': ']', ']': '[', '{': '}', '}': '{', '<': '>', '>': '<',
+	'«': '»', '»': '«', '‹': '›', '›': '‹',
+}
+
+// ReorderRTL converts lines holding right-to-left text from visual order,
+// the order the glyphs are drawn in and in which many PDFs and backends
+// give Hebrew and Arabic, to logical (reading) order. Each such line is
+// reversed, except for runs of left-to-right words and numbers inside it,
+// and paired punctuation between right-to-left words is mirrored. Lines
+// without right-to-left characters are left alone.
+func ReorderRTL(text string) string {
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		if strings.IndexFunc(line, isRTL) >= 0 {
+			lines[i] = reorderLine(line)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func reorderLine(line string) string {
+	rs := []rune(line)
+	slices.Reverse(rs)
+	for i := 0; i < len(rs); {
+		if !isLTR(rs[i]) {
+			if m, ok := mirrored[rs[i]]; ok {
+				rs[i] = m
+			}
+			i++
+			continue
+		}
+		// A left-to-right run extends over neutrals up to its last
+		// left-to-right character before the next right-to-left one.
+		end := i + 1
+		for j := i + 1; j < len(rs) && !isRTL(rs[j]); j++ {
+			if isLTR(rs[j]) {
+				end = j + 1
+			}
+		}
+		slices.Reverse(rs[i:end])
+		i = end
+	}
+	return string(rs)
+}
+
+// arabicForms lists, in code point order from U+FE80, the base letters of
+// the Arabic Presentation Forms-B block and how many contextual forms
+// (isolated, final, initial, medial) each has there.
+var arabicForms = []struct {
+	base  string
+	forms int
+}{
+	{"ء", 1}, {"آ", 2}, {"أ", 2}, {"ؤ", 2}, {"إ", 2},
+	{"ئ", 4}, {"ا", 2}, {"ب", 4}, {"ة", 2}, {"ت", 4},
+	{"ث", 4}, {"ج", 4}, {"ح", 4}, {"خ", 4}, {"د", 2},
+	{"ذ", 2}, {"ر", 2}, {"ز", 2}, {"س", 4}, {"ش", 4},
+	{"ص", 4}, {"ض", 4}, {"ط", 4}, {"ظ", 4}, {"ع", 4},
+	{"غ", 4}, {"ف", 4}, {"ق", 4}, {"ك", 4}, {"ل", 4},
+	{"م", 4}, {"ن", 4}, {"ه", 4}, {"و", 2}, {"ى", 2},
+	{"ي", 4},
+	{"لآ", 2}, {"لأ", 2}, {"لإ", 2}, {"لا", 2},
+}
+
+// arabicReplacer maps Arabic presentation forms to the letters they shape.
+var arabicReplacer = func() *strings.Replacer {
+	var pairs []string
+	add := func(first rune, base string, forms int) {
+		for k := 0; k < forms; k++ {
+			pairs = append(pairs, string(first+rune(k)), base)
+		}
+	}
+	r := rune(0xfe80)
+	for _, f := range arabicForms {
+		add(r, f.base, f.forms)
+		r += rune(f.forms)
+	}
+	// Isolated and medial forms of the harakat, U+FE70 to U+FE7F.
+	for k, h := range []string{"ً", "ـً", "ٌ", "", "ٍ", "", "َ", "ـَ", "ُ", "ـُ", "ِ", "ـِ", "ّ", "ـّ", "ْ", "ـْ"} {
+		if h != "" {
+			pairs = append(pairs, string(rune(0xfe70+k)), h)
+		}
+	}
+	// The Persian and Urdu letters of Presentation Forms-A.
+	add(0xfb56, "پ", 4) // peh
+	add(0xfb7a, "چ", 4) // tcheh
+	add(0xfb8a, "ژ", 2) // jeh
+	add(0xfb8e, "ک", 4) // keheh
+	add(0xfb92, "گ", 4) // gaf
+	add(0xfbfc, "ی", 4) // farsi yeh
+	// The ligature for Allah.
+	pairs = append(pairs, "ﷲ", "الله")
+	return strings.NewReplacer(pairs...)
+}()
+
+// NormalizeArabic replaces Arabic presentation forms, the contextual
+// glyph shapes that PDFs often carry instead of letters, with the letters
+// themselves (lam-alef ligatures become two letters), so that the text
+// can be searched and read. It covers Presentation Forms-B and the
+// Persian letters of Presentation Forms-A.
+func NormalizeArabic(text string) string {
+	return arabicReplacer.Replace(text)
+}
+
+// isCJK reports whether r is a Chinese or Japanese character, or CJK
+// punctuation, all of which are written without spaces between them.
+// Hangul is not included, since Korean separates words with spaces.
+func isCJK(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana) ||
+		r >= 0x3000 && r <= 0x303f || // CJK symbols and punctuation
+		r >= 0xff01 && r <= 0xff60 || // fullwidth forms
+		r == 0x30fc // prolonged sound mark
+}
+
+// CollapseCJKSpaces removes the spaces that backends put between Chinese
+// and Japanese characters when they are drawn one by one. Spaces next to
+// other scripts, ideographic spaces and line breaks are kept.
+func CollapseCJKSpaces(text string) string {
+	rs := []rune(text)
+	var b strings.Builder
+	b.Grow(len(text))
+	for i := 0; i < len(rs); i++ {
+		if rs[i] == ' ' || rs[i] == '\t' {
+			j := i
+			for j < len(rs) && (rs[j] == ' ' || rs[j] == '\t') {
+				j++
+			}
+			if i > 0 && j < len(rs) && isCJK(rs[i-1]) && isCJK(rs[j]) {
+				i = j - 1
+				continue
+			}
+		}
+		b.WriteRune(rs[i])
+	}
+	return b.String()
+}
+
+// localize applies NormalizeArabic, ReorderRTL and CollapseCJKSpaces to
+// text, as configured.
+func (e *Extractor) localize(text string) string {
+	if e.NormalizeArabic {
+		text = NormalizeArabic(text)
+	}
+	if e.ReorderRTL {
+		text = ReorderRTL(text)
+	}
+	if e.CollapseCJKSpaces {
+		text = CollapseCJKSpaces(text)
+	}
+	return text
+}
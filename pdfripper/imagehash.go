@@ -0,0 +1,210 @@
+package pdfripper
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math/bits"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// RescanMaxDistance is the Distance up to which MatchPages takes two page
+// images for scans of the same page, by default.
+const RescanMaxDistance = 32
+
+// Parameters of HashImage.
+const (
+	hashGrid   = 16   // Cells across and down the image, one bit each.
+	hashMargin = 0.05 // Share of the range of a band's cells by which a cell must be darker than the median to set its bit.
+	hashSpeck  = 1000 // A row or column needs more than its length over this in dark pixels to count as printed on.
+)
+
+// ImageHash is a perceptual hash of a page image, a 256-bit block mean
+// hash, which changes little when a page is scanned again at another
+// resolution, compressed differently or made lighter or darker. The zero
+// value stands for no hash; blank pages hash to it too.
+type ImageHash [hashGrid * hashGrid / 64]uint64
+
+// HashImage returns the ImageHash of img. It crops the image to what is
+// printed on it, so that a page scanned with other margins or offset on
+// the glass hashes alike, shrinks that to a grid of 16 by 16 grey cells and
+// sets a bit for each cell darker than the median of its quarter of the
+// grid's rows, so that uneven lighting down the page does not shift every
+// bit the same way.
+func HashImage(img image.Image) ImageHash {
+	var h ImageHash
+	b := inkBounds(img)
+	if b.Empty() {
+		return h
+	}
+	// Every pixel is averaged in: sampling would alias with the regular
+	// spacing of lines of text.
+	var sums, counts [hashGrid][hashGrid]float64
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		row := (y - b.Min.Y) * hashGrid / b.Dy()
+		for x := b.Min.X; x < b.Max.X; x++ {
+			col := (x - b.Min.X) * hashGrid / b.Dx()
+			sums[row][col] += grayAt(img, x, y)
+			counts[row][col]++
+		}
+	}
+	var cells [hashGrid][hashGrid]float64
+	for row := range cells {
+		for col := range cells[row] {
+			if counts[row][col] > 0 {
+				cells[row][col] = sums[row][col] / counts[row][col]
+			}
+		}
+	}
+	const bandRows = hashGrid / 4
+	for band := 0; band < hashGrid; band += bandRows {
+		var values []float64
+		for row := band; row < band+bandRows; row++ {
+			values = append(values, cells[row][:]...)
+		}
+		sort.Float64s(values)
+		median := (values[len(values)/2-1] + values[len(values)/2]) / 2
+		// Cells of blank paper are often the median; the margin keeps
+		// scanner noise from setting their bits.
+		threshold := median - hashMargin*(values[len(values)-1]-values[0])
+		for row := band; row < band+bandRows; row++ {
+			for col, v := range cells[row] {
+				if v < threshold {
+					bit := row*hashGrid + col
+					h[bit/64] |= 1 << (63 - bit%64)
+				}
+			}
+		}
+	}
+	return h
+}
+
+// String returns the hash as 64 hexadecimal digits.
+func (h ImageHash) String() string {
+	var b strings.Builder
+	for _, w := range h {
+		fmt.Fprintf(&b, "%016x", w)
+	}
+	return b.String()
+}
+
+// ParseImageHash parses a hash written by ImageHash.String.
+func ParseImageHash(s string) (ImageHash, error) {
+	var h ImageHash
+	if len(s) != 16*len(h) {
+		return h, fmt.Errorf("invalid image hash %q", s)
+	}
+	for i := range h {
+		w, err := strconv.ParseUint(s[16*i:16*(i+1)], 16, 64)
+		if err != nil {
+			return ImageHash{}, fmt.Errorf("invalid image hash %q", s)
+		}
+		h[i] = w
+	}
+	return h, nil
+}
+
+// Distance returns the number of bits in which h and o differ, from 0 for
+// images that look the same to 256.
+func (h ImageHash) Distance(o ImageHash) int {
+	n := 0
+	for i := range h {
+		n += bits.OnesCount64(h[i] ^ o[i])
+	}
+	return n
+}
+
+// inkBounds returns the smallest rectangle holding the rows and columns
+// of img with more than a few dark pixels, which leaves out the margins
+// and specks of dust on them.
+func inkBounds(img image.Image) image.Rectangle {
+	b := img.Bounds()
+	rows, cols := make([]int, b.Dy()), make([]int, b.Dx())
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if grayAt(img, x, y) < 128 {
+				rows[y-b.Min.Y]++
+				cols[x-b.Min.X]++
+			}
+		}
+	}
+	span := func(counts []int, length int) (int, int) {
+		least := max(1, length/hashSpeck)
+		first, last := 0, len(counts)
+		for first < last && counts[first] <= least {
+			first++
+		}
+		for last > first && counts[last-1] <= least {
+			last--
+		}
+		return first, last
+	}
+	x0, x1 := span(cols, b.Dy())
+	y0, y1 := span(rows, b.Dx())
+	return image.Rect(x0, y0, x1, y1).Add(b.Min)
+}
+
+// grayAt returns the luminance of a pixel, reading the pixel formats
+// renderers produce directly, since going through color.Color for every
+// pixel of a 300 dpi page is slow.
+func grayAt(img image.Image, x, y int) float64 {
+	switch m := img.(type) {
+	case *image.Gray:
+		return float64(m.Pix[m.PixOffset(x, y)])
+	case *image.RGBA:
+		i := m.PixOffset(x, y)
+		return 0.299*float64(m.Pix[i]) + 0.587*float64(m.Pix[i+1]) + 0.114*float64(m.Pix[i+2])
+	case *image.NRGBA:
+		i := m.PixOffset(x, y)
+		return 0.299*float64(m.Pix[i]) + 0.587*float64(m.Pix[i+1]) + 0.114*float64(m.Pix[i+2])
+	}
+	return float64(color.GrayModel.Convert(img.At(x, y)).(color.Gray).Y)
+}
+
+// PageMatch pairs a page of one document with the page of another that
+// looks the same.
+type PageMatch struct {
+	Page     int // 1-indexed, in the first document.
+	Other    int // 1-indexed, in the other document.
+	Distance int
+}
+
+// MatchPages pairs the pages of two documents, given as the ImageHashes of
+// their pages in order, whose hashes are at most maxDistance apart. Each
+// page is paired at most once, closest pairs first, so a document scanned
+// again in another order still matches. Pages without a hash are left
+// out.
+func MatchPages(a, b []ImageHash, maxDistance int) []PageMatch {
+	var candidates []PageMatch
+	for i, ha := range a {
+		for j, hb := range b {
+			if ha == (ImageHash{}) || hb == (ImageHash{}) {
+				continue
+			}
+			if d := ha.Distance(hb); d <= maxDistance {
+				candidates = append(candidates, PageMatch{Page: i + 1, Other: j + 1, Distance: d})
+			}
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].Distance < candidates[j].Distance })
+	usedA, usedB := map[int]bool{}, map[int]bool{}
+	var matches []PageMatch
+	for _, m := range candidates {
+		if !usedA[m.Page] && !usedB[m.Other] {
+			usedA[m.Page], usedB[m.Other] = true, true
+			matches = append(matches, m)
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool { return matches[i].Page < matches[j].Page })
+	return matches
+}
+
+// hashRender records the hash of a page's rendered image, the first time
+// the page is rendered.
+func hashRender(r *PageResult, img image.Image) {
+	if r.ImageHash == (ImageHash{}) {
+		r.ImageHash = HashImage(img)
+	}
+}
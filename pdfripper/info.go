@@ -0,0 +1,150 @@
+package pdfripper
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+)
+
+// FileReport describes how a PDF file is built, for diagnosing files that
+// extract slowly or fail: a file with many incremental updates, or one
+// whose cross-reference data had to be rebuilt, takes longer to parse,
+// and a document that needs a password cannot be extracted at all.
+type FileReport struct {
+	Version            string `json:"version"`              // The catalog's /Version if it is later than the header's, as "1.7".
+	HeaderVersion      string `json:"header_version"`       // From the %PDF- header; empty if there is none.
+	Size               int64  `json:"size"`                 // In bytes.
+	Pages              int    `json:"pages"`                // 0 if the document needs a password.
+	Linearized         bool   `json:"linearized"`           // Has a linearization dictionary that matches the file; an update since leaves it stale.
+	Encrypted          bool   `json:"encrypted"`            // The file has an encryption dictionary.
+	Encryption         string `json:"encryption,omitempty"` // Such as "AES-256" or "RC4 40-bit", if Encrypted.
+	NeedsPassword      bool   `json:"needs_password"`       // Encrypted with a user password, so the text cannot be extracted.
+	Objects            int    `json:"objects"`              // Objects in use in the cross-reference data.
+	Streams            int    `json:"streams"`              // Stream objects, such as page contents and images.
+	CompressedObjects  int    `json:"compressed_objects"`   // Objects kept in object streams.
+	ObjectStreams      int    `json:"object_streams"`       // Streams holding other objects compressed, as PDF 1.5 allows.
+	XrefStreams        bool   `json:"xref_streams"`         // Some cross-reference data is in streams rather than tables.
+	IncrementalUpdates int    `json:"incremental_updates"`  // Updates appended to the original file.
+	Repaired           bool   `json:"repaired"`             // The cross-reference data is damaged and was rebuilt by scanning the file.
+}
+
+var pdfHeaderRe = regexp.MustCompile(`%PDF-(\d\.\d)`)
+
+// Inspect reports how a PDF file is built, using the package's own
+// parser. Unlike extraction, it works on documents that need a password,
+// though it cannot count their pages.
+func Inspect(pdfFile string) (report *FileReport, err error) {
+	data, err := os.ReadFile(pdfFile)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			report, err = nil, fmt.Errorf("parsing %s: %v", pdfFile, r)
+		}
+	}()
+	d, err := readPDFXref(data)
+	if err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", pdfFile, err)
+	}
+	return d.inspect(), nil
+}
+
+func (d *pdfDoc) inspect() *FileReport {
+	r := &FileReport{Size: int64(len(d.data)), Repaired: d.repaired, XrefStreams: d.xrefStreams}
+	if m := pdfHeaderRe.FindSubmatch(d.data[:min(len(d.data), 1024)]); m != nil {
+		r.HeaderVersion = string(m[1])
+	}
+	r.Version = r.HeaderVersion
+	root := d.resolveDict(d.trailer["Root"])
+	if v := string(d.resolveName(root["Version"])); v > r.Version {
+		r.Version = v
+	}
+
+	for _, e := range d.xref {
+		switch {
+		case e.compressed:
+			r.Objects++
+			r.CompressedObjects++
+		case e.offset >= 0:
+			r.Objects++
+			obj, _, err := d.parseIndirectAt(e.offset)
+			if s, ok := obj.(*pdfStream); ok && err == nil {
+				r.Streams++
+				switch d.resolveName(s.dict["Type"]) {
+				case "ObjStm":
+					r.ObjectStreams++
+				case "XRef":
+					r.XrefStreams = true
+				}
+			}
+		}
+	}
+
+	// The linearization dictionary is the first object in the file.
+	linearized := false
+	if m := objHeaderRe.FindSubmatchIndex(d.data[:min(len(d.data), 1024)]); m != nil {
+		obj, _, _ := d.parseIndirectAt(m[2])
+		if lin, ok := obj.(pdfDict); ok && lin["Linearized"] != nil {
+			linearized = true
+			length, _ := pdfInt(d.resolve(lin["L"]))
+			r.Linearized = length == len(d.data)
+		}
+	}
+	// A linearized file starts with a cross-reference section of its own
+	// for the first page, and repaired files have no chain to count.
+	if d.repaired {
+		r.IncrementalUpdates = bytes.Count(d.data, []byte("%%EOF")) - 1
+	} else {
+		r.IncrementalUpdates = d.xrefSections - 1
+	}
+	if linearized {
+		r.IncrementalUpdates--
+	}
+	r.IncrementalUpdates = max(r.IncrementalUpdates, 0)
+
+	if enc := d.resolveDict(d.trailer["Encrypt"]); enc != nil {
+		r.Encrypted = true
+		r.Encryption = encryptionName(d, enc)
+		c, err := newPDFCrypt(d, enc)
+		if err != nil {
+			r.NeedsPassword = errors.Is(err, errPDFEncrypted)
+			return r
+		}
+		d.crypt = c
+		d.objects = map[int]pdfObject{}
+		d.objStms = map[int]*objStm{}
+	}
+	if d.loadPages() == nil {
+		r.Pages = len(d.pages)
+	}
+	return r
+}
+
+// encryptionName describes the algorithm of an encryption dictionary.
+func encryptionName(d *pdfDoc, enc pdfDict) string {
+	if filter := d.resolveName(enc["Filter"]); filter != "Standard" {
+		return fmt.Sprintf("%s security handler", filter)
+	}
+	v, _ := pdfInt(d.resolve(enc["V"]))
+	bits := 40
+	if n, ok := pdfInt(d.resolve(enc["Length"])); ok && v > 1 {
+		bits = n
+	}
+	switch {
+	case v >= 5:
+		return "AES-256"
+	case v == 4:
+		cf := d.resolveDict(enc["CF"])
+		switch d.resolveName(d.resolveDict(cf[d.resolveName(enc["StmF"])])["CFM"]) {
+		case "AESV2":
+			return "AES-128"
+		case "None", "":
+			return "none"
+		}
+		return "RC4 128-bit"
+	}
+	return fmt.Sprintf("RC4 %d-bit", bits)
+}
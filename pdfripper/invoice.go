@@ -0,0 +1,360 @@
+package pdfripper
+
+import (
+	"encoding/json"
+	"math"
+	"math/big"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Invoice holds the fields Invoices found in a document. Values are as
+// printed, except that identifiers have their spaces removed.
+type Invoice struct {
+	Number *InvoiceField `json:"number,omitempty"`
+	Date   *InvoiceField `json:"date,omitempty"`
+	Total  *InvoiceField `json:"total,omitempty"` // The amount due, with its currency if printed next to it.
+	VAT    *InvoiceField `json:"vat,omitempty"`   // The VAT or sales tax amount.
+	VATID  *InvoiceField `json:"vat_id,omitempty"`
+	IBAN   *InvoiceField `json:"iban,omitempty"` // Only IBANs whose check digits are right.
+}
+
+// InvoiceField is a value found on a page.
+type InvoiceField struct {
+	Value      string `json:"value"`
+	Normalized string `json:"normalized,omitempty"` // With Invoices.Normalize, the date in ISO 8601 form or the amount with a decimal point.
+	Currency   string `json:"currency,omitempty"`   // With Invoices.Normalize, the ISO 4217 code of an amount's currency.
+	Page       int    `json:"page"`
+}
+
+// Patterns used by Invoices. Labels cover English, German, French,
+// Spanish, Italian and Dutch invoices.
+var (
+	invoiceNumberLabel = regexp.MustCompile(`(?i)\b(?:(?:invoice|inv|bill|rechnungs?|facture|factura|fattura|factuur)\s*[-.]?\s*(?:no\b\.?|number|num\b\.?|nr\b\.?|nummer|#|n[°º]\.?|id\b)|rechnungsnummer|factuurnummer)\s*:?`)
+	invoiceNumberValue = regexp.MustCompile(`^\s*([A-Z0-9][A-Z0-9\-/._]*\d[A-Z0-9\-/._]*)`)
+	invoiceDateLabel   = regexp.MustCompile(`(?i)\b(?:invoice\s+date|date\s+of\s+issue|issue\s+date|rechnungsdatum|date\s+de\s+facture|fecha(?:\s+de\s+factura)?|data\s+fattura|factuurdatum|datum|date|data)\s*:?`)
+	invoiceDateValue   = regexp.MustCompile(`\b(?:\d{4}-\d{2}-\d{2}|\d{1,2}[./-]\d{1,2}[./-]\d{2,4}|\d{1,2}\.?\s+\pL{3,9}\.?\s+\d{4}|\pL{3,9}\.?\s+\d{1,2},?\s+\d{4})\b`)
+	invoiceAmount      = regexp.MustCompile(`(?:(?:[€$£]|EUR|USD|GBP|CHF)\s?)?-?\d{1,3}(?:[.,' ]\d{3})*[.,]\d{2}\b(?:\s?(?:[€$£]|EUR|USD|GBP|CHF))?`)
+	invoiceVATIDLabel  = regexp.MustCompile(`(?i)\b(?:vat\s*(?:id|no\b\.?|number|reg(?:istration)?\.?(?:\s*no\b\.?)?)|ust-?id(?:-?nr)?\.?|ust\.?-?idnr\.?|tva\s+intracom\w*|n[°º]\s*tva|btw-?(?:nummer|nr\.?)|partita\s+iva|p\.?\s?iva|nif|cif)\s*:?`)
+	invoiceVATIDValue  = regexp.MustCompile(`^\s*([A-Z]{2}[ ]?[0-9A-Z][0-9A-Z ]{6,14}[0-9A-Z])`)
+	invoiceIBAN        = regexp.MustCompile(`\b[A-Z]{2}\d{2}(?: ?[A-Z0-9]{4}){2,7}(?: ?[A-Z0-9]{1,3})?\b`)
+	invoiceVATLabel    = regexp.MustCompile(`(?i)\b(?:vat|mwst|ust|tva|iva|btw|gst|sales\s+tax|tax)\b`)
+	invoiceNotVAT      = regexp.MustCompile(`(?i)\b(?:total|incl|including|inkl|excl|excluding|exkl|id|no|number|reg|rate)\b`)
+)
+
+// invoiceTotalLabels are the labels of the amount due, most specific
+// first. A plain "total" on a line that also mentions tax or the net
+// amount is a subtotal.
+var invoiceTotalLabels = []*regexp.Regexp{
+	regexp.MustCompile(`(?i)\b(?:total|amount|balance)\s+(?:amount\s+)?due\b|\bgrand\s+total\b|\b(?:zu\s+zahlen(?:der\s+betrag)?|zahlbetrag|net\s+[àa]\s+payer|a\s+pagar|totale\s+da\s+pagare|te\s+betalen)\b`),
+	regexp.MustCompile(`(?i)\b(?:total\s+(?:incl(?:uding|\.)?|with)\s+(?:vat|tax|mwst)|gesamtbetrag|rechnungsbetrag|endbetrag|bruttobetrag|total\s+ttc|importe\s+total|totale\s+fattura|totaal(?:bedrag)?|invoice\s+total)\b`),
+	regexp.MustCompile(`(?i)\b(?:total|summe|gesamt|totale)\b`),
+}
+
+var invoiceSubtotal = regexp.MustCompile(`(?i)\b(?:vat|tax|mwst|ust|tva|iva|net|netto|excl|exkl|ht)\b`)
+
+// Invoices is a post-processor that finds the common fields of an
+// invoice, wherever in the document they are: the invoice number and
+// date, the total and VAT amounts, the seller's VAT ID and the IBAN to pay
+// to. Fields are found by their labels, with the value after the label on
+// its line or, where the input parses and the text is not from OCR, drawn
+// beside or right below it, as in boxed layouts; elsewhere the next line
+// of text is tried.
+// Use PostProcess as an Extractor's PostProcessor, then Invoice or
+// WriteFile once the run is done.
+type Invoices struct {
+	PDFFile   string // The document, for the positions of its text; without it only the text is used.
+	Normalize bool   // Also give dates and amounts in canonical form (see NormalizeDate and NormalizeNumber), keeping the text as printed in Value.
+
+	open sync.Once
+	doc  *pdfDoc
+
+	mu     sync.Mutex
+	finds  []invoiceFind
+	totals []invoiceFind // Candidates, with their label's rank in level.
+	vats   []invoiceFind
+}
+
+type invoiceFind struct {
+	field string
+	value string
+	page  int
+	level int
+}
+
+// NewInvoices returns an Invoices post-processor for pdfFile.
+func NewInvoices(pdfFile string) *Invoices {
+	return &Invoices{PDFFile: pdfFile}
+}
+
+// invoiceLine is a line of a page, with its position in device space if
+// known.
+type invoiceLine struct {
+	text           string
+	x0, y0, x1, y1 float64
+	placed         bool
+}
+
+// PostProcess looks for invoice fields on a page. It leaves the page as it
+// is.
+func (v *Invoices) PostProcess(r *PageResult) error {
+	lines := v.pageLines(r)
+	var found, totals, vats []invoiceFind
+	add := func(field string, value string) {
+		if value != "" {
+			found = append(found, invoiceFind{field: field, value: value, page: r.Page})
+		}
+	}
+	add("number", labeled(lines, invoiceNumberLabel, func(s string) string { return submatch(invoiceNumberValue, s) }))
+	add("date", labeled(lines, invoiceDateLabel, invoiceDateValue.FindString))
+	add("vat_id", strings.ReplaceAll(labeled(lines, invoiceVATIDLabel, func(s string) string { return submatch(invoiceVATIDValue, s) }), " ", ""))
+	for _, l := range lines {
+		for _, m := range invoiceIBAN.FindAllString(l.text, -1) {
+			if iban := strings.ReplaceAll(m, " ", ""); validIBAN(iban) {
+				add("iban", iban)
+			}
+		}
+	}
+	for level, label := range invoiceTotalLabels {
+		for i, l := range lines {
+			if loc := label.FindStringIndex(l.text); loc != nil {
+				if level == len(invoiceTotalLabels)-1 && invoiceSubtotal.MatchString(l.text) {
+					continue
+				}
+				if amount := valueAfter(lines, i, loc, invoiceAmount.FindString); amount != "" {
+					totals = append(totals, invoiceFind{field: "total", value: amount, page: r.Page, level: level})
+				}
+			}
+		}
+	}
+	for i, l := range lines {
+		if loc := invoiceVATLabel.FindStringIndex(l.text); loc != nil && !invoiceNotVAT.MatchString(l.text) {
+			if amount := valueAfter(lines, i, loc, lastAmount); amount != "" {
+				vats = append(vats, invoiceFind{field: "vat", value: amount, page: r.Page})
+			}
+		}
+	}
+
+	v.mu.Lock()
+	v.finds = append(v.finds, found...)
+	v.totals = append(v.totals, totals...)
+	v.vats = append(v.vats, vats...)
+	v.mu.Unlock()
+	return nil
+}
+
+// pageLines returns the lines of a page, placed if the document parses.
+func (v *Invoices) pageLines(r *PageResult) []invoiceLine {
+	v.open.Do(func() {
+		if v.PDFFile != "" {
+			v.doc, _ = openPDFFile(v.PDFFile)
+		}
+	})
+	if v.doc != nil && !r.OCRUsed && r.Page <= len(v.doc.pages) {
+		if lines := v.doc.placedLines(r.Page - 1); len(lines) > 0 {
+			return lines
+		}
+	}
+	var lines []invoiceLine
+	for _, l := range strings.Split(r.Text, "\n") {
+		if strings.TrimSpace(l) != "" {
+			lines = append(lines, invoiceLine{text: l})
+		}
+	}
+	return lines
+}
+
+// placedLines returns the visible lines of page index with their bounds,
+// or nil if the page cannot be parsed.
+func (d *pdfDoc) placedLines(index int) (lines []invoiceLine) {
+	defer func() {
+		if r := recover(); r != nil {
+			lines = nil
+		}
+	}()
+	frags, err := d.pageFragments(index)
+	if err != nil {
+		return nil
+	}
+	for _, line := range visibleLines(frags) {
+		x0, y0, x1, y1 := textBounds(line)
+		lines = append(lines, invoiceLine{text: layoutLines(line), x0: x0, y0: y0, x1: x1, y1: y1, placed: true})
+	}
+	return lines
+}
+
+// labeled returns the value found by value after the first match of
+// label, on any line.
+func labeled(lines []invoiceLine, label *regexp.Regexp, value func(string) string) string {
+	for i, l := range lines {
+		if loc := label.FindStringIndex(l.text); loc != nil {
+			if v := valueAfter(lines, i, loc, value); v != "" {
+				return v
+			}
+		}
+	}
+	return ""
+}
+
+// valueAfter returns the value found by value after loc, the location of
+// a label in lines[i]: further along the line, in text drawn beside it,
+// or in the line below the label.
+func valueAfter(lines []invoiceLine, i int, loc []int, value func(string) string) string {
+	l := lines[i]
+	if v := value(l.text[loc[1]:]); v != "" {
+		return v
+	}
+	if !l.placed {
+		if i+1 < len(lines) {
+			return value(lines[i+1].text)
+		}
+		return ""
+	}
+	// The label's extent across the line, by its share of the characters.
+	n := float64(len(l.text))
+	lx0 := l.x0 + (l.x1-l.x0)*float64(loc[0])/n
+	lx1 := l.x0 + (l.x1-l.x0)*float64(loc[1])/n
+	height := l.y1 - l.y0
+	beside, below := -1, -1
+	besideGap, belowGap := math.Inf(1), math.Inf(1)
+	for k, c := range lines {
+		if k == i {
+			continue
+		}
+		if math.Abs(c.y0-l.y0) < height/4 && c.x0 >= l.x1-height/4 {
+			if gap := c.x0 - l.x1; gap < besideGap {
+				beside, besideGap = k, gap
+			}
+			continue
+		}
+		gap := l.y0 - c.y1
+		if gap < -height/2 || gap > 2*height || c.x1 <= lx0 || c.x0 >= lx1+height {
+			continue
+		}
+		if gap < belowGap {
+			below, belowGap = k, gap
+		}
+	}
+	for _, k := range []int{beside, below} {
+		if k >= 0 {
+			if v := value(lines[k].text); v != "" {
+				return v
+			}
+		}
+	}
+	return ""
+}
+
+func submatch(re *regexp.Regexp, s string) string {
+	if m := re.FindStringSubmatch(s); m != nil {
+		return m[1]
+	}
+	return ""
+}
+
+// lastAmount returns the last amount in s, which after a VAT label is the
+// tax rather than the rate or the net amount it applies to.
+func lastAmount(s string) string {
+	all := invoiceAmount.FindAllString(s, -1)
+	if len(all) == 0 {
+		return ""
+	}
+	return all[len(all)-1]
+}
+
+// validIBAN checks the length and check digits of an IBAN without spaces.
+func validIBAN(iban string) bool {
+	if len(iban) < 15 || len(iban) > 34 {
+		return false
+	}
+	var digits strings.Builder
+	for _, c := range iban[4:] + iban[:4] {
+		switch {
+		case c >= '0' && c <= '9':
+			digits.WriteRune(c)
+		case c >= 'A' && c <= 'Z':
+			digits.WriteString(strconv.Itoa(int(c - 'A' + 10)))
+		default:
+			return false
+		}
+	}
+	n, ok := new(big.Int).SetString(digits.String(), 10)
+	return ok && new(big.Int).Mod(n, big.NewInt(97)).Int64() == 1
+}
+
+// Invoice returns the fields found so far: of each identifier and the
+// date, the first found; of the totals, the one with the most specific
+// label, the last of those if it is on several pages; and of the VAT
+// amounts, the last.
+func (v *Invoices) Invoice() Invoice {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	var inv Invoice
+	first := func(field string) *InvoiceField {
+		var best *invoiceFind
+		for i := range v.finds {
+			f := &v.finds[i]
+			if f.field == field && (best == nil || f.page < best.page) {
+				best = f
+			}
+		}
+		if best == nil {
+			return nil
+		}
+		return &InvoiceField{Value: best.value, Page: best.page}
+	}
+	inv.Number, inv.Date, inv.VATID, inv.IBAN = first("number"), first("date"), first("vat_id"), first("iban")
+	var total *invoiceFind
+	for i := range v.totals {
+		t := &v.totals[i]
+		if total == nil || t.level < total.level || t.level == total.level && t.page >= total.page {
+			total = t
+		}
+	}
+	if total != nil {
+		inv.Total = &InvoiceField{Value: total.value, Page: total.page}
+	}
+	var vat *invoiceFind
+	for i := range v.vats {
+		if vat == nil || v.vats[i].page >= vat.page {
+			vat = &v.vats[i]
+		}
+	}
+	if vat != nil {
+		inv.VAT = &InvoiceField{Value: vat.value, Page: vat.page}
+	}
+	if v.Normalize {
+		normalizeInvoice(&inv)
+	}
+	return inv
+}
+
+// normalizeInvoice fills in the canonical forms of the date and amounts
+// of inv. A date whose numbers could be read either way is read day first
+// when it is written with dots or the amounts have a decimal comma.
+func normalizeInvoice(inv *Invoice) {
+	dayFirst := false
+	for _, f := range []*InvoiceField{inv.Total, inv.VAT} {
+		if f != nil {
+			number, currency, _ := NormalizeNumber(f.Value)
+			f.Normalized, f.Currency = number, currency
+			dayFirst = dayFirst || decimalComma(f.Value)
+		}
+	}
+	if inv.Date != nil {
+		dayFirst = dayFirst || strings.Contains(inv.Date.Value, ".")
+		inv.Date.Normalized, _ = NormalizeDate(inv.Date.Value, dayFirst)
+	}
+}
+
+// WriteFile saves the fields found as JSON to path.
+func (v *Invoices) WriteFile(path string) error {
+	data, err := json.MarshalIndent(v.Invoice(), "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
@@ -0,0 +1,175 @@
+package pdfripper
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// PageLabels reads the logical page labels of a PDF, such as "iv" or
+// "A-3", by page, using the package's own parser. A document without a
+// /PageLabels tree has none, and a page before its first range has an
+// empty label.
+func PageLabels(pdfFile string) ([]string, error) {
+	d, err := openPDFFile(pdfFile)
+	if err != nil {
+		return nil, err
+	}
+	return d.pageLabels(), nil
+}
+
+// pageLabelRange is an entry of the /PageLabels number tree: the pages
+// from start, 0-indexed, up to the next range are labelled prefix
+// followed by first, first+1, ... in style.
+type pageLabelRange struct {
+	start  int
+	style  pdfName // D, R, r, A or a; empty for the prefix alone.
+	prefix string
+	first  int
+}
+
+func (d *pdfDoc) pageLabels() []string {
+	root := d.resolveDict(d.trailer["Root"])
+	var ranges []pageLabelRange
+	d.collectLabelRanges(root["PageLabels"], 0, map[pdfRef]bool{}, &ranges)
+	if len(ranges) == 0 {
+		return nil
+	}
+	sort.SliceStable(ranges, func(i, j int) bool { return ranges[i].start < ranges[j].start })
+	labels := make([]string, len(d.pages))
+	for i, r := range ranges {
+		end := len(d.pages)
+		if i+1 < len(ranges) {
+			end = min(end, ranges[i+1].start)
+		}
+		for p := max(r.start, 0); p < end; p++ {
+			labels[p] = r.prefix + labelNumber(r.style, r.first+p-r.start)
+		}
+	}
+	return labels
+}
+
+// collectLabelRanges appends the ranges of the number tree at node.
+func (d *pdfDoc) collectLabelRanges(node pdfObject, depth int, seen map[pdfRef]bool, ranges *[]pageLabelRange) {
+	if ref, ok := node.(pdfRef); ok {
+		if seen[ref] {
+			return
+		}
+		seen[ref] = true
+	}
+	n := d.resolveDict(node)
+	if n == nil || depth > maxNameTreeDepth {
+		return
+	}
+	nums := d.resolveArray(n["Nums"])
+	for i := 0; i+1 < len(nums); i += 2 {
+		start, ok := pdfInt(d.resolve(nums[i]))
+		label := d.resolveDict(nums[i+1])
+		if !ok || label == nil {
+			continue
+		}
+		prefix, _ := d.resolve(label["P"]).(pdfString)
+		first, ok := pdfInt(d.resolve(label["St"]))
+		if !ok || first < 1 {
+			first = 1
+		}
+		*ranges = append(*ranges, pageLabelRange{start: start, style: d.resolveName(label["S"]), prefix: textString(prefix), first: first})
+	}
+	for _, kid := range d.resolveArray(n["Kids"]) {
+		d.collectLabelRanges(kid, depth+1, seen, ranges)
+	}
+}
+
+// labelNumber formats n in a page label style: decimal, upper or lower
+// roman numerals, or upper or lower letters, which run A to Z, then AA to
+// ZZ and so on.
+func labelNumber(style pdfName, n int) string {
+	switch style {
+	case "D":
+		return strconv.Itoa(n)
+	case "R":
+		return romanNumeral(n)
+	case "r":
+		return strings.ToLower(romanNumeral(n))
+	case "A":
+		return letterNumber(n)
+	case "a":
+		return strings.ToLower(letterNumber(n))
+	}
+	return ""
+}
+
+var romanDigits = []struct {
+	value  int
+	digits string
+}{
+	{1000, "M"}, {900, "CM"}, {500, "D"}, {400, "CD"}, {100, "C"}, {90, "XC"},
+	{50, "L"}, {40, "XL"}, {10, "X"}, {9, "IX"}, {5, "V"}, {4, "IV"}, {1, "I"},
+}
+
+// romanNumeral returns n in upper-case roman numerals, or in decimal if it
+// is too large or small for them to be of use.
+func romanNumeral(n int) string {
+	if n < 1 || n >= 5000 {
+		return strconv.Itoa(n)
+	}
+	var b strings.Builder
+	for _, d := range romanDigits {
+		for ; n >= d.value; n -= d.value {
+			b.WriteString(d.digits)
+		}
+	}
+	return b.String()
+}
+
+// letterNumber returns n as letters, A to Z for 1 to 26, AA to ZZ for 27
+// to 52, and so on.
+func letterNumber(n int) string {
+	if n < 1 || n > 26*100 {
+		return strconv.Itoa(n)
+	}
+	return strings.Repeat(string(rune('A'+(n-1)%26)), (n-1)/26+1)
+}
+
+// loadLabels sets the run's labels: numbers counted from PageOffset if it
+// is set, or otherwise the document's own labels.
+func (e *Extractor) loadLabels(totalPages int) {
+	e.labels = nil
+	switch {
+	case !e.pageLabels():
+	case e.PageOffset != 0:
+		e.labels = make([]string, totalPages)
+		for i := range e.labels {
+			if n := i + 1 + e.PageOffset; n >= 1 {
+				e.labels[i] = strconv.Itoa(n)
+			}
+		}
+	case e.doc != nil:
+		e.labels = e.doc.pageLabels()
+	}
+}
+
+// pageLabels reports whether this run labels its pages.
+func (e *Extractor) pageLabels() bool {
+	return e.PageLabels || e.LabelFileNames || e.PageOffset != 0
+}
+
+// pageLabel returns the label of page, or "" if it has none.
+func (e *Extractor) pageLabel(page int) string {
+	if page > len(e.labels) {
+		return ""
+	}
+	return e.labels[page-1]
+}
+
+// labelFileName returns the page file name, without extension, of a page
+// labelled label: the label, with the characters that are not safe in
+// file names replaced.
+func labelFileName(label string) string {
+	return strings.Map(func(r rune) rune {
+		if r < ' ' || strings.ContainsRune(`/\:*?"<>| `, r) {
+			return '_'
+		}
+		return r
+	}, label)
+}
@@ -0,0 +1,182 @@
+package pdfripper
+
+import (
+	"bufio"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// Link is an internal link of a document: a link annotation on a page and
+// the page it goes to.
+type Link struct {
+	From int    `json:"from"`           // Page the link is on.
+	To   int    `json:"to"`             // Page it goes to, or 0 if to none of the document's pages.
+	Dest string `json:"dest,omitempty"` // The named destination it goes to, if it goes to one.
+}
+
+// NamedDest is a named destination of a document, which links and other
+// documents can point to by name.
+type NamedDest struct {
+	Name string `json:"name"`
+	Page int    `json:"page"` // 0 if it points to none of the document's pages.
+}
+
+// LinkGraph is the internal link structure of a document, for navigation
+// analysis: its pages, the links between them in page order, and its
+// named destinations by name. Links to other documents and to URLs are
+// left out.
+type LinkGraph struct {
+	Pages int         `json:"pages"`
+	Links []Link      `json:"links"`
+	Dests []NamedDest `json:"named_destinations"`
+}
+
+// Links reads the internal links of a PDF using the package's own parser.
+func Links(pdfFile string) (graph *LinkGraph, err error) {
+	d, err := openPDFFile(pdfFile)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			graph, err = nil, fmt.Errorf("parsing %s: %v", pdfFile, r)
+		}
+	}()
+	return d.links(), nil
+}
+
+func (d *pdfDoc) links() *LinkGraph {
+	root := d.resolveDict(d.trailer["Root"])
+	pages := map[pdfRef]int{}
+	for i, p := range d.pages {
+		if p.ref != (pdfRef{}) {
+			pages[p.ref] = i + 1
+		}
+	}
+	g := &LinkGraph{Pages: len(d.pages), Links: []Link{}, Dests: []NamedDest{}}
+	for i, p := range d.pages {
+		for _, a := range d.resolveArray(p.dict["Annots"]) {
+			annot := d.resolveDict(a)
+			if annot == nil || d.resolveName(annot["Subtype"]) != "Link" {
+				continue
+			}
+			dest := annot["Dest"]
+			if dest == nil {
+				action := d.resolveDict(annot["A"])
+				if action == nil || d.resolveName(action["S"]) != "GoTo" {
+					continue
+				}
+				dest = action["D"]
+			}
+			g.Links = append(g.Links, Link{From: i + 1, To: d.destPage(root, dest, pages), Dest: destName(d.resolve(dest))})
+		}
+	}
+	seen := map[string]bool{}
+	add := func(name string, dest pdfObject) {
+		if !seen[name] {
+			seen[name] = true
+			g.Dests = append(g.Dests, NamedDest{Name: name, Page: d.destPage(root, dest, pages)})
+		}
+	}
+	dests := d.resolveDict(root["Dests"])
+	names := make([]string, 0, len(dests))
+	for name := range dests {
+		names = append(names, string(name))
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		add(name, dests[pdfName(name)])
+	}
+	if n := d.resolveDict(root["Names"]); n != nil {
+		d.nameTreeEach(n["Dests"], 0, map[pdfRef]bool{}, func(name string, dest pdfObject) { add(textString(pdfString(name)), dest) })
+	}
+	sort.SliceStable(g.Dests, func(i, j int) bool { return g.Dests[i].Name < g.Dests[j].Name })
+	return g
+}
+
+// destName returns the name of a named destination, or "" if dest is an
+// explicit one.
+func destName(dest pdfObject) string {
+	switch v := dest.(type) {
+	case pdfName:
+		return string(v)
+	case pdfString:
+		return textString(v)
+	}
+	return ""
+}
+
+// nameTreeEach calls fn with each key and value of the name tree rooted
+// at node, in tree order.
+func (d *pdfDoc) nameTreeEach(node pdfObject, depth int, seen map[pdfRef]bool, fn func(key string, value pdfObject)) {
+	if ref, ok := node.(pdfRef); ok {
+		if seen[ref] {
+			return
+		}
+		seen[ref] = true
+	}
+	n := d.resolveDict(node)
+	if n == nil || depth > maxNameTreeDepth {
+		return
+	}
+	names := d.resolveArray(n["Names"])
+	for i := 0; i+1 < len(names); i += 2 {
+		if k, ok := d.resolve(names[i]).(pdfString); ok {
+			fn(string(k), names[i+1])
+		}
+	}
+	for _, kid := range d.resolveArray(n["Kids"]) {
+		d.nameTreeEach(kid, depth+1, seen, fn)
+	}
+}
+
+// WriteGraphML writes g as a GraphML graph: a node per page, p1 to pN,
+// and per named destination, with an edge per link from its page to
+// the page it goes to, or to its named destination, and from each named
+// destination to its page. Nodes and edges have a kind: page or dest,
+// link or target.
+func (g *LinkGraph) WriteGraphML(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	esc := func(s string) string {
+		var b strings.Builder
+		xml.EscapeText(&b, []byte(s))
+		return b.String()
+	}
+	destID := func(name string) string { return "d:" + esc(name) }
+	fmt.Fprint(bw, xml.Header)
+	fmt.Fprint(bw, `<graphml xmlns="http://graphml.graphdrawing.org/xmlns">
+  <key id="kind" for="all" attr.name="kind" attr.type="string"/>
+  <key id="name" for="node" attr.name="name" attr.type="string"/>
+  <graph id="links" edgedefault="directed">
+`)
+	for p := 1; p <= g.Pages; p++ {
+		fmt.Fprintf(bw, "    <node id=\"p%d\"><data key=\"kind\">page</data></node>\n", p)
+	}
+	for _, dest := range g.Dests {
+		fmt.Fprintf(bw, "    <node id=\"%s\"><data key=\"kind\">dest</data><data key=\"name\">%s</data></node>\n", destID(dest.Name), esc(dest.Name))
+	}
+	known := map[string]bool{}
+	for _, dest := range g.Dests {
+		known[dest.Name] = true
+		if dest.Page > 0 {
+			fmt.Fprintf(bw, "    <edge source=\"%s\" target=\"p%d\"><data key=\"kind\">target</data></edge>\n", destID(dest.Name), dest.Page)
+		}
+	}
+	for _, l := range g.Links {
+		target := ""
+		switch {
+		case l.Dest != "" && known[l.Dest]:
+			target = destID(l.Dest)
+		case l.To > 0:
+			target = fmt.Sprintf("p%d", l.To)
+		default:
+			continue
+		}
+		fmt.Fprintf(bw, "    <edge source=\"p%d\" target=\"%s\"><data key=\"kind\">link</data></edge>\n", l.From, target)
+	}
+	fmt.Fprint(bw, "  </graph>\n</graphml>\n")
+	return bw.Flush()
+}
@@ -0,0 +1,55 @@
+package pdfripper
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+)
+
+// lockPoll is how often a run waiting for a directory's lock tries again.
+const lockPoll = 250 * time.Millisecond
+
+// LockedError reports that another run holds the lock of the directory a
+// run writes to.
+type LockedError struct {
+	Dir string
+}
+
+func (e *LockedError) Error() string {
+	return fmt.Sprintf("another run is writing to %s", e.Dir)
+}
+
+// LockDir takes an exclusive advisory lock on dir, which must exist, so
+// that two runs never write to it at once; only runs that lock it too are
+// kept out. If another run holds the lock, it fails with a *LockedError,
+// or with wait, waits until the lock is released or ctx is done. The
+// returned function releases the lock, as the process exiting does. On
+// platforms without flock, nothing is locked.
+func LockDir(ctx context.Context, dir string, wait bool) (unlock func(), err error) {
+	f, err := os.Open(dir)
+	if err != nil {
+		return nil, fmt.Errorf("locking %s: %w", dir, err)
+	}
+	for waited := false; ; waited = true {
+		ok, err := tryLock(f)
+		if err != nil {
+			f.Close()
+			return nil, fmt.Errorf("locking %s: %w", dir, err)
+		}
+		if ok {
+			return func() { f.Close() }, nil
+		}
+		if !wait {
+			f.Close()
+			return nil, &LockedError{Dir: dir}
+		}
+		if !waited {
+			fmt.Printf("Waiting for the other run writing to %s to finish\n", dir)
+		}
+		if err := sleepContext(ctx, lockPoll); err != nil {
+			f.Close()
+			return nil, err
+		}
+	}
+}
@@ -0,0 +1,265 @@
+package pdfripper
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// ManifestFormats are the values accepted in Extractor.ManifestFormats.
+var ManifestFormats = []string{"json", "csv"}
+
+// ManifestEntry is one page's row in the manifest.
+type ManifestEntry struct {
+	Page          int            `json:"page"`
+	File          string         `json:"file,omitempty"`
+	Chars         int            `json:"chars"`
+	Words         int            `json:"words"`
+	DurationMS    float64        `json:"duration_ms"`
+	Backend       string         `json:"backend"`
+	OCRUsed       bool           `json:"ocr_used"`
+	Quality       float64        `json:"quality"`
+	Watermarked   bool           `json:"watermarked"`
+	Width         float64        `json:"width"` // MediaBox size in points; zero if the geometry could not be read.
+	Height        float64        `json:"height"`
+	Rotation      int            `json:"rotation"`
+	Orientation   string         `json:"orientation"`
+	Class         string         `json:"class"`
+	OCRConfidence float64        `json:"ocr_confidence"`
+	NeedsReview   bool           `json:"needs_review"`
+	Equations     int            `json:"equations"`
+	Figures       []Figure       `json:"figures,omitempty"`    // In the CSV manifest, only their number.
+	ImageHash     string         `json:"image_hash,omitempty"` // ImageHash of the rendered page, if it was rendered.
+	Bates         string         `json:"bates,omitempty"`
+	Label         string         `json:"label,omitempty"`          // The page's logical label, if pages were labelled.
+	NumberedLines int            `json:"numbered_lines,omitempty"` // Details are in the page's .lines.json file.
+	OCRLines      int            `json:"ocr_lines,omitempty"`
+	Fields        map[string]any `json:"fields,omitempty"`        // Added by post-processors such as a Script; in the CSV manifest, as a JSON object.
+	CPUMS         float64        `json:"cpu_ms,omitempty"`        // CPU time of the commands run for the page, if any were.
+	MaxRSSBytes   int64          `json:"max_rss_bytes,omitempty"` // Peak resident set size of the largest of them.
+	Commands      int            `json:"commands,omitempty"`
+	Agreement     *float64       `json:"agreement,omitempty"` // Present if the page was compared with a second backend.
+	Tokens        int            `json:"tokens,omitempty"`    // Counted by Extractor.Tokenizer, if it is set.
+}
+
+var manifestColumns = []string{"page", "file", "chars", "words", "duration_ms", "backend", "ocr_used", "quality", "watermarked",
+	"width", "height", "rotation", "orientation", "class",
+	"ocr_confidence", "needs_review", "equations", "figures", "image_hash", "bates", "numbered_lines", "ocr_lines", "fields",
+	"cpu_ms", "max_rss_bytes", "commands", "agreement", "label", "tokens"}
+
+// NewManifestEntry returns the manifest row of a finished page extracted
+// with the named backend.
+func NewManifestEntry(r *PageResult, backend string) ManifestEntry {
+	e := ManifestEntry{
+		Page:          r.Page,
+		File:          r.OutputFile,
+		Chars:         utf8.RuneCountInString(r.Text),
+		Words:         len(strings.Fields(r.Text)),
+		DurationMS:    float64(r.Duration.Microseconds()) / 1000,
+		Backend:       backend,
+		OCRUsed:       r.OCRUsed,
+		Quality:       r.Quality,
+		Watermarked:   r.Watermarked,
+		Class:         string(r.Class),
+		OCRConfidence: r.OCRConfidence,
+		NeedsReview:   r.NeedsReview,
+		Equations:     len(r.Equations),
+		Figures:       r.Figures,
+		Bates:         r.Bates,
+		Label:         r.Label,
+		NumberedLines: len(r.NumberedLines),
+		OCRLines:      r.OCRLines,
+		Fields:        r.Fields,
+		CPUMS:         float64(r.Usage.CPU.Microseconds()) / 1000,
+		MaxRSSBytes:   r.Usage.MaxRSS,
+		Commands:      r.Usage.Commands,
+		Agreement:     r.Agreement,
+		Tokens:        r.Tokens,
+	}
+	if r.ImageHash != (ImageHash{}) {
+		e.ImageHash = r.ImageHash.String()
+	}
+	if g := r.Geometry; g != nil {
+		e.Width, e.Height, e.Rotation, e.Orientation = g.Width, g.Height, g.Rotation, g.Orientation()
+	}
+	return e
+}
+
+// newManifestSinks opens manifest.<format> in dir for each format. If
+// watermarks, metadata or agreement are not nil, the JSON manifest records
+// them for the document.
+func newManifestSinks(dir string, formats []string, backend string, watermarks *WatermarkReport, metadata map[string]string, agreement *agreementCheck) ([]Sink, error) {
+	var sinks []Sink
+	fail := func(err error) ([]Sink, error) {
+		for _, s := range sinks {
+			s.Close()
+		}
+		return nil, err
+	}
+	for _, format := range formats {
+		f, err := os.Create(filepath.Join(dir, "manifest."+format))
+		if err != nil {
+			return fail(err)
+		}
+		w := bufio.NewWriter(f)
+		switch format {
+		case "json":
+			s := &jsonManifestSink{f: f, w: w, backend: backend, agreement: agreement, open: fmt.Sprintf("{\"schema_version\": %d, ", ManifestSchemaVersion)}
+			if watermarks != nil {
+				marks, err := json.Marshal(append([]Watermark{}, watermarks.Watermarks...))
+				if err != nil {
+					f.Close()
+					return fail(err)
+				}
+				s.open += fmt.Sprintf("\"watermarked\": %t, \"watermarks\": %s,\n", watermarks.Watermarked(), marks)
+			}
+			if metadata != nil {
+				fields, err := json.Marshal(metadata)
+				if err != nil {
+					f.Close()
+					return fail(err)
+				}
+				s.open += fmt.Sprintf("\"metadata\": %s,\n", fields)
+			}
+			s.open += "\"pages\": ["
+			sinks = append(sinks, s)
+		case "csv":
+			s := &csvManifestSink{f: f, w: w, csv: csv.NewWriter(w), backend: backend}
+			s.csv.Write(manifestColumns)
+			sinks = append(sinks, s)
+		default:
+			f.Close()
+			os.Remove(f.Name())
+			return fail(fmt.Errorf("unknown manifest format %q (available: %s)", format, strings.Join(ManifestFormats, ", ")))
+		}
+	}
+	return sinks, nil
+}
+
+// jsonManifestSink streams a Manifest, {"schema_version": 1, "pages": [...]},
+// with one entry per line, so the manifest of a huge document is never held
+// in memory. Document-level fields come first, in open, but for the
+// agreement and the token total, which are only known once every page is
+// in.
+type jsonManifestSink struct {
+	f         *os.File
+	w         *bufio.Writer
+	backend   string
+	open      string
+	agreement *agreementCheck
+	n         int
+	tokens    int
+}
+
+func (s *jsonManifestSink) WritePage(r *PageResult) error {
+	entry := NewManifestEntry(r, s.backend)
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	s.tokens += entry.Tokens
+	sep := ",\n"
+	if s.n == 0 {
+		sep = s.open + "\n"
+	}
+	s.n++
+	s.w.WriteString(sep)
+	_, err = s.w.Write(data)
+	return err
+}
+
+func (s *jsonManifestSink) Close() error {
+	if s.n == 0 {
+		s.w.WriteString(s.open)
+	}
+	s.w.WriteString("\n]")
+	if r := s.agreement.report(); r != nil {
+		data, err := json.Marshal(r)
+		if err != nil {
+			s.f.Close()
+			return err
+		}
+		fmt.Fprintf(s.w, ",\n\"agreement\": %s", data)
+	}
+	if s.tokens > 0 {
+		fmt.Fprintf(s.w, ",\n\"tokens\": %d", s.tokens)
+	}
+	s.w.WriteString("}\n")
+	return closeBuffered(s.f, s.w)
+}
+
+type csvManifestSink struct {
+	f       *os.File
+	w       *bufio.Writer
+	csv     *csv.Writer
+	backend string
+}
+
+func (s *csvManifestSink) WritePage(r *PageResult) error {
+	e := NewManifestEntry(r, s.backend)
+	var fields []byte
+	if len(e.Fields) > 0 {
+		var err error
+		if fields, err = json.Marshal(e.Fields); err != nil {
+			return err
+		}
+	}
+	agreement := ""
+	if e.Agreement != nil {
+		agreement = strconv.FormatFloat(*e.Agreement, 'f', 3, 64)
+	}
+	return s.csv.Write([]string{
+		strconv.Itoa(e.Page),
+		e.File,
+		strconv.Itoa(e.Chars),
+		strconv.Itoa(e.Words),
+		strconv.FormatFloat(e.DurationMS, 'f', 3, 64),
+		e.Backend,
+		strconv.FormatBool(e.OCRUsed),
+		strconv.FormatFloat(e.Quality, 'f', 3, 64),
+		strconv.FormatBool(e.Watermarked),
+		strconv.FormatFloat(e.Width, 'f', -1, 64),
+		strconv.FormatFloat(e.Height, 'f', -1, 64),
+		strconv.Itoa(e.Rotation),
+		e.Orientation,
+		e.Class,
+		strconv.FormatFloat(e.OCRConfidence, 'f', 3, 64),
+		strconv.FormatBool(e.NeedsReview),
+		strconv.Itoa(e.Equations),
+		strconv.Itoa(len(e.Figures)),
+		e.ImageHash,
+		e.Bates,
+		strconv.Itoa(e.NumberedLines),
+		strconv.Itoa(e.OCRLines),
+		string(fields),
+		strconv.FormatFloat(e.CPUMS, 'f', 3, 64),
+		strconv.FormatInt(e.MaxRSSBytes, 10),
+		strconv.Itoa(e.Commands),
+		agreement,
+		e.Label,
+		strconv.Itoa(e.Tokens),
+	})
+}
+
+func (s *csvManifestSink) Close() error {
+	s.csv.Flush()
+	if err := s.csv.Error(); err != nil {
+		s.f.Close()
+		return err
+	}
+	return closeBuffered(s.f, s.w)
+}
+
+func closeBuffered(f *os.File, w *bufio.Writer) error {
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,261 @@
+package pdfripper
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+)
+
+// MergePDFs writes the pages of the inputs, in order, to outFile as a
+// single document. Each page keeps its content, resources and annotations;
+// what belongs to the input documents as a whole, such as outlines, named
+// destinations, form definitions and metadata, is dropped. Encrypted
+// inputs that open without a password are written unencrypted.
+func MergePDFs(outFile string, inputs ...string) error {
+	if len(inputs) == 0 {
+		return errors.New("no documents to merge")
+	}
+	w := &pdfWriter{}
+	catalog, pages := w.reserve(), w.reserve()
+	var kids pdfArray
+	for _, in := range inputs {
+		d, err := openPDFFile(in)
+		if err != nil {
+			return err
+		}
+		if len(d.pages) == 0 {
+			return fmt.Errorf("%s has no pages", in)
+		}
+		kids = append(kids, w.copyDocument(d, pages)...)
+	}
+	return w.writeFile(outFile, catalog, pages, kids)
+}
+
+// RepairPDF writes inFile to outFile as MergePDFs writes a single document,
+// with every object renumbered and a new cross-reference table, for
+// backends that reject damaged files. The package's parser rebuilds a
+// damaged table by scanning the file for objects, and RepairPDF reports
+// whether it had to.
+func RepairPDF(inFile, outFile string) (damaged bool, err error) {
+	d, err := openPDFFile(inFile)
+	if err != nil {
+		return false, err
+	}
+	if len(d.pages) == 0 {
+		return d.repaired, fmt.Errorf("%s has no pages", inFile)
+	}
+	w := &pdfWriter{}
+	catalog, pages := w.reserve(), w.reserve()
+	return d.repaired, w.writeFile(outFile, catalog, pages, w.copyDocument(d, pages))
+}
+
+// copyDocument copies the pages of d, keeping their rotation, under the
+// page tree node pages and returns them.
+func (w *pdfWriter) copyDocument(d *pdfDoc, pages int) pdfArray {
+	rotate := make([]int, len(d.pages))
+	for i, p := range d.pages {
+		rotate[i] = p.rotate
+	}
+	c := &pdfCopier{d: d, w: w, nums: map[int]int{}}
+	return c.copyPages(pdfRef{num: pages}, d.pages, rotate)
+}
+
+// pdfWriter collects the objects of a PDF being written. Object n is
+// objs[n-1].
+type pdfWriter struct {
+	objs []pdfObject
+}
+
+// reserve allocates an object number, to be filled in later.
+func (w *pdfWriter) reserve() int {
+	w.objs = append(w.objs, nil)
+	return len(w.objs)
+}
+
+// writeFile fills in the catalog and the page tree, a single node whose
+// kids are the pages, and writes the document to path.
+func (w *pdfWriter) writeFile(path string, catalog, pages int, kids pdfArray) error {
+	w.objs[pages-1] = pdfDict{"Type": pdfName("Pages"), "Kids": kids, "Count": len(kids)}
+	w.objs[catalog-1] = pdfDict{"Type": pdfName("Catalog"), "Pages": pdfRef{num: pages}}
+	return os.WriteFile(path, w.bytes(catalog), 0644)
+}
+
+// bytes serializes the document with a classic cross-reference table.
+func (w *pdfWriter) bytes(root int) []byte {
+	var b bytes.Buffer
+	b.WriteString("%PDF-1.7\n%\xe2\xe3\xcf\xd3\n")
+	offsets := make([]int, len(w.objs))
+	for i, obj := range w.objs {
+		offsets[i] = b.Len()
+		fmt.Fprintf(&b, "%d 0 obj\n", i+1)
+		if s, ok := obj.(*pdfStream); ok {
+			dict := pdfDict{}
+			for k, v := range s.dict {
+				dict[k] = v
+			}
+			dict["Length"] = len(s.raw)
+			writePDFObject(&b, dict)
+			b.WriteString("\nstream\n")
+			b.Write(s.raw)
+			b.WriteString("\nendstream")
+		} else {
+			writePDFObject(&b, obj)
+		}
+		b.WriteString("\nendobj\n")
+	}
+	xref := b.Len()
+	fmt.Fprintf(&b, "xref\n0 %d\n0000000000 65535 f \n", len(w.objs)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&b, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&b, "trailer\n<< /Size %d /Root %d 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(w.objs)+1, root, xref)
+	return b.Bytes()
+}
+
+// writePDFObject serializes a direct object. Strings are written in hex,
+// which needs no escaping.
+func writePDFObject(b *bytes.Buffer, obj pdfObject) {
+	switch o := obj.(type) {
+	case nil:
+		b.WriteString("null")
+	case bool:
+		b.WriteString(strconv.FormatBool(o))
+	case int:
+		b.WriteString(strconv.Itoa(o))
+	case float64:
+		b.WriteString(strconv.FormatFloat(o, 'f', -1, 64))
+	case pdfName:
+		b.WriteByte('/')
+		for i := 0; i < len(o); i++ {
+			c := o[i]
+			if c < 0x21 || c > 0x7e || c == '#' || isPDFDelim(c) {
+				fmt.Fprintf(b, "#%02x", c)
+			} else {
+				b.WriteByte(c)
+			}
+		}
+	case pdfString:
+		fmt.Fprintf(b, "<%x>", string(o))
+	case pdfRef:
+		fmt.Fprintf(b, "%d 0 R", o.num)
+	case pdfArray:
+		b.WriteByte('[')
+		for i, v := range o {
+			if i > 0 {
+				b.WriteByte(' ')
+			}
+			writePDFObject(b, v)
+		}
+		b.WriteByte(']')
+	case pdfDict:
+		b.WriteString("<<")
+		for k, v := range o {
+			writePDFObject(b, k)
+			b.WriteByte(' ')
+			writePDFObject(b, v)
+		}
+		b.WriteString(">>")
+	default:
+		// Keywords cannot appear in objects; anything else is dropped.
+		b.WriteString("null")
+	}
+}
+
+// pdfCopier copies objects of one document into a pdfWriter, numbering
+// them afresh.
+type pdfCopier struct {
+	d    *pdfDoc
+	w    *pdfWriter
+	nums map[int]int // Object numbers in d to those in w.
+}
+
+// copyPages copies pages of the document, with parent as their /Parent
+// and rotate[i] as the /Rotate of pages[i], and returns references to the
+// copies. The numbers of all pages are taken first, so that links and
+// annotations pointing at other pages of the document point at the
+// copies; a page copied twice is pointed at by its first copy.
+func (c *pdfCopier) copyPages(parent pdfRef, pages []pdfPage, rotate []int) pdfArray {
+	refs := make(pdfArray, len(pages))
+	for i, p := range pages {
+		n := c.w.reserve()
+		refs[i] = pdfRef{num: n}
+		if _, seen := c.nums[p.ref.num]; p.ref.num > 0 && !seen {
+			c.nums[p.ref.num] = n
+		}
+	}
+	for i, p := range pages {
+		dict := pdfDict{}
+		for k, v := range p.dict {
+			if k != "Parent" {
+				dict[k] = v
+			}
+		}
+		// Attributes inherited from the page tree, which is not copied.
+		if dict["Resources"] == nil {
+			dict["Resources"] = p.resources
+		}
+		if dict["MediaBox"] == nil {
+			box := p.mediaBox
+			dict["MediaBox"] = pdfArray{box[0], box[1], box[2], box[3]}
+		}
+		dict["Rotate"] = rotate[i]
+		copied := c.copy(dict).(pdfDict)
+		copied["Parent"] = parent
+		c.w.objs[refs[i].(pdfRef).num-1] = copied
+	}
+	return refs
+}
+
+func (c *pdfCopier) copy(obj pdfObject) pdfObject {
+	switch o := obj.(type) {
+	case pdfRef:
+		return c.ref(o)
+	case pdfArray:
+		out := make(pdfArray, len(o))
+		for i, v := range o {
+			out[i] = c.copy(v)
+		}
+		return out
+	case pdfDict:
+		out := make(pdfDict, len(o))
+		for k, v := range o {
+			out[k] = c.copy(v)
+		}
+		return out
+	case *pdfStream:
+		raw := o.raw
+		if c.d.crypt != nil {
+			if data, err := c.d.crypt.decryptStream(o); err == nil {
+				raw = data
+			}
+		}
+		dict := c.copy(o.dict).(pdfDict)
+		delete(dict, "Length")
+		return &pdfStream{dict: dict, raw: raw}
+	}
+	return obj
+}
+
+// ref copies the object r refers to, once, and returns a reference to the
+// copy. Page tree nodes are not copied, since the merged document has a
+// tree of its own; references to them, only found in document-level
+// structures, become null.
+func (c *pdfCopier) ref(r pdfRef) pdfObject {
+	if n, ok := c.nums[r.num]; ok {
+		if n == 0 {
+			return nil
+		}
+		return pdfRef{num: n}
+	}
+	obj := c.d.object(r.num)
+	if dict, ok := obj.(pdfDict); ok && c.d.resolveName(dict["Type"]) == "Pages" {
+		c.nums[r.num] = 0
+		return nil
+	}
+	n := c.w.reserve()
+	c.nums[r.num] = n
+	c.w.objs[n-1] = c.copy(obj)
+	return pdfRef{num: n}
+}
@@ -0,0 +1,101 @@
+package pdfripper
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/thnkr-one/pdfripper/pdfripper/paptest"
+)
+
+// rotatedPDF has a page rotated by 90 degrees between two upright ones.
+var rotatedPDF = (&paptest.Document{Pages: []paptest.Page{
+	{Lines: []string{"Upright"}},
+	{Lines: []string{"Turned"}, Size: paptest.A4, Rotate: 90},
+	{Lines: []string{"Upright again"}},
+}}).Bytes()
+
+// checkPages parses the PDF at path and checks the text and rotation of
+// its pages, and that its cross-reference table is sound.
+func checkPages(t *testing.T, path string, texts []string, rotate []int) {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, d := pdfTexts(t, data)
+	if d.repaired {
+		t.Error("the cross-reference table written is damaged")
+	}
+	if strings.Join(got, "\f") != strings.Join(texts, "\f") {
+		t.Errorf("got pages %q, want %q", got, texts)
+	}
+	for i, p := range d.pages {
+		if i < len(rotate) && p.rotate != rotate[i] {
+			t.Errorf("page %d: rotated %d, want %d", i+1, p.rotate, rotate[i])
+		}
+	}
+}
+
+func TestRepairPDF(t *testing.T) {
+	dir := t.TempDir()
+	good := filepath.Join(dir, "good.pdf")
+	if err := os.WriteFile(good, rotatedPDF, 0644); err != nil {
+		t.Fatal(err)
+	}
+	damaged := filepath.Join(dir, "damaged.pdf")
+	cut := rotatedPDF[:bytes.Index(rotatedPDF, []byte("\nxref\n"))+1]
+	if err := os.WriteFile(damaged, cut, 0644); err != nil {
+		t.Fatal(err)
+	}
+	texts := []string{"Upright\n", "Turned\n", "Upright again\n"}
+	for _, tt := range []struct {
+		in      string
+		damaged bool
+	}{{good, false}, {damaged, true}} {
+		out := filepath.Join(dir, "repaired-"+filepath.Base(tt.in))
+		wasDamaged, err := RepairPDF(tt.in, out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if wasDamaged != tt.damaged {
+			t.Errorf("%s: damaged = %v, want %v", filepath.Base(tt.in), wasDamaged, tt.damaged)
+		}
+		checkPages(t, out, texts, []int{0, 90, 0})
+	}
+
+	// A page tree without kids, padded so that the offsets stay right.
+	empty := filepath.Join(dir, "empty.pdf")
+	noPages := bytes.Replace(paptest.TextPDF(""), []byte("/Kids [4 0 R] /Count 1"), []byte("/Kids [] /Count 0     "), 1)
+	if err := os.WriteFile(empty, noPages, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := RepairPDF(empty, filepath.Join(dir, "out.pdf")); err == nil || !strings.HasSuffix(err.Error(), "empty.pdf has no pages") {
+		t.Errorf("got error %v, want no pages", err)
+	}
+	if _, err := RepairPDF(filepath.Join(dir, "missing.pdf"), filepath.Join(dir, "out.pdf")); !os.IsNotExist(err) {
+		t.Errorf("got error %v, want the file not to exist", err)
+	}
+}
+
+func TestMergePDFs(t *testing.T) {
+	dir := t.TempDir()
+	first := filepath.Join(dir, "first.pdf")
+	if err := os.WriteFile(first, rotatedPDF, 0644); err != nil {
+		t.Fatal(err)
+	}
+	second := paptest.TempPDF(t, "Second document")
+	out := filepath.Join(dir, "merged.pdf")
+	if err := MergePDFs(out, first, second, first); err != nil {
+		t.Fatal(err)
+	}
+	checkPages(t, out,
+		[]string{"Upright\n", "Turned\n", "Upright again\n", "Second document\n", "Upright\n", "Turned\n", "Upright again\n"},
+		[]int{0, 90, 0, 0, 0, 90, 0})
+
+	if err := MergePDFs(out); err == nil || err.Error() != "no documents to merge" {
+		t.Errorf("got error %v, want no documents", err)
+	}
+}
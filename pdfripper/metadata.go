@@ -0,0 +1,340 @@
+package pdfripper
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// Canonical metadata fields, as DocumentMetadata.Fields reports them and
+// manifest.json records them.
+const (
+	FieldTitle    = "title"
+	FieldAuthor   = "author"
+	FieldSubject  = "subject"
+	FieldKeywords = "keywords"
+	FieldCreator  = "creator"  // The application the document was made in.
+	FieldProducer = "producer" // The application that wrote the PDF.
+	FieldCreated  = "created"  // RFC 3339.
+	FieldModified = "modified" // RFC 3339.
+)
+
+// defaultFields are the properties the canonical fields come from, XMP
+// first, since writers that update a document keep its XMP current more
+// often than its Info dictionary.
+var defaultFields = []struct {
+	field  string
+	source []string
+}{
+	{FieldTitle, []string{"dc:title", "Title"}},
+	{FieldAuthor, []string{"dc:creator", "Author"}},
+	{FieldSubject, []string{"dc:description", "Subject"}},
+	{FieldKeywords, []string{"pdf:Keywords", "Keywords"}},
+	{FieldCreator, []string{"xmp:CreatorTool", "Creator"}},
+	{FieldProducer, []string{"pdf:Producer", "Producer"}},
+	{FieldCreated, []string{"xmp:CreateDate", "CreationDate"}},
+	{FieldModified, []string{"xmp:ModifyDate", "ModDate"}},
+}
+
+// XMP namespaces that properties are named with their usual prefix,
+// whatever prefix the packet declares for them.
+var xmpPrefixes = map[string]string{
+	"http://purl.org/dc/elements/1.1/":               "dc",
+	"http://ns.adobe.com/xap/1.0/":                   "xmp",
+	"http://ns.adobe.com/xap/1.0/mm/":                "xmpMM",
+	"http://ns.adobe.com/xap/1.0/rights/":            "xmpRights",
+	"http://ns.adobe.com/pdf/1.3/":                   "pdf",
+	"http://ns.adobe.com/pdfx/1.3/":                  "pdfx",
+	"http://www.aiim.org/pdfa/ns/id/":                "pdfaid",
+	"http://ns.adobe.com/photoshop/1.0/":             "photoshop",
+	"http://prismstandard.org/namespaces/basic/2.0/": "prism",
+}
+
+const (
+	rdfNS = "http://www.w3.org/1999/02/22-rdf-syntax-ns#"
+	xmlNS = "http://www.w3.org/XML/1998/namespace"
+)
+
+// DocumentMetadata is what a document says about itself, in its Info
+// dictionary and its XMP packet.
+type DocumentMetadata struct {
+	// Info holds the entries of the Info dictionary by key, such as
+	// "Title", as text; dates are left as the PDF writes them.
+	Info map[string]string
+	// XMP holds the properties of the XMP packet by prefixed name, such as
+	// "dc:title" or a company schema's "acme:MatterID". Standard schemas
+	// use their usual prefixes, others the prefix the packet declares.
+	// Language alternatives give the default language's text, lists their
+	// items joined with "; ", and the fields of a structure are named
+	// after it, as in "xmpMM:DerivedFrom/stRef:documentID".
+	XMP map[string]string
+}
+
+// Metadata reads the Info dictionary and XMP packet of a PDF, using the
+// package's own parser. A document without either has empty maps.
+func Metadata(pdfFile string) (*DocumentMetadata, error) {
+	d, err := openPDFFile(pdfFile)
+	if err != nil {
+		return nil, err
+	}
+	return d.metadata()
+}
+
+func (d *pdfDoc) metadata() (*DocumentMetadata, error) {
+	m := &DocumentMetadata{Info: map[string]string{}, XMP: map[string]string{}}
+	for key, v := range d.resolveDict(d.trailer["Info"]) {
+		switch v := d.resolve(v).(type) {
+		case pdfString:
+			m.Info[string(key)] = textString(v)
+		case pdfName:
+			m.Info[string(key)] = string(v)
+		case int, float64:
+			m.Info[string(key)] = fmt.Sprint(v)
+		}
+	}
+	root := d.resolveDict(d.trailer["Root"])
+	s := d.resolveStream(root["Metadata"])
+	if s == nil {
+		return m, nil
+	}
+	data, err := d.decodeStream(s)
+	if err != nil {
+		return nil, fmt.Errorf("decoding XMP: %w", err)
+	}
+	if err := parseXMP(data, m.XMP); err != nil {
+		return nil, fmt.Errorf("parsing XMP: %w", err)
+	}
+	return m, nil
+}
+
+// xmpNode is an element of an XMP packet.
+type xmpNode struct {
+	name  xml.Name
+	attrs []xml.Attr
+	text  string
+	kids  []*xmpNode
+}
+
+func (n *xmpNode) attr(space, local string) (string, bool) {
+	for _, a := range n.attrs {
+		if a.Name.Space == space && a.Name.Local == local {
+			return a.Value, true
+		}
+	}
+	return "", false
+}
+
+// parseXMP adds the properties of an XMP packet to props.
+func parseXMP(data []byte, props map[string]string) error {
+	d := xml.NewDecoder(bytes.NewReader(data))
+	// Packets say they are UTF-8 or leave it to a byte order mark.
+	d.CharsetReader = func(_ string, r io.Reader) (io.Reader, error) { return r, nil }
+	prefixes := map[string]string{}
+	root := &xmpNode{}
+	stack := []*xmpNode{root}
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		top := stack[len(stack)-1]
+		switch t := tok.(type) {
+		case xml.StartElement:
+			n := &xmpNode{name: t.Name, attrs: t.Attr}
+			for _, a := range t.Attr {
+				if a.Name.Space == "xmlns" {
+					prefixes[a.Value] = a.Name.Local
+				}
+			}
+			top.kids = append(top.kids, n)
+			stack = append(stack, n)
+		case xml.EndElement:
+			top.text = strings.TrimSpace(top.text)
+			stack = stack[:len(stack)-1]
+		case xml.CharData:
+			top.text += string(t)
+		}
+	}
+
+	name := func(n xml.Name) string {
+		prefix, ok := xmpPrefixes[n.Space]
+		if !ok {
+			prefix = prefixes[n.Space]
+		}
+		if prefix == "" {
+			return n.Local
+		}
+		return prefix + ":" + n.Local
+	}
+	// property records n, the element of a property named key; fields
+	// holds the properties of a structure.
+	var property func(n *xmpNode, key string)
+	var fields func(n *xmpNode, base string)
+	fields = func(n *xmpNode, base string) {
+		for _, a := range n.attrs {
+			if a.Name.Space != rdfNS && a.Name.Space != xmlNS && a.Name.Space != "xmlns" && a.Name.Space != "" {
+				props[base+name(a.Name)] = a.Value
+			}
+		}
+		for _, kid := range n.kids {
+			property(kid, base+name(kid.name))
+		}
+	}
+	property = func(n *xmpNode, key string) {
+		if v, ok := n.attr(rdfNS, "resource"); ok {
+			props[key] = v
+			return
+		}
+		if len(n.kids) == 0 {
+			if pt, _ := n.attr(rdfNS, "parseType"); pt != "Resource" {
+				props[key] = n.text
+			}
+			return
+		}
+		kid := n.kids[0]
+		if kid.name.Space != rdfNS {
+			// rdf:parseType="Resource"
+			fields(n, key+"/")
+			return
+		}
+		switch kid.name.Local {
+		case "Alt":
+			value := ""
+			for i, li := range kid.kids {
+				if lang, _ := li.attr(xmlNS, "lang"); i == 0 || lang == "x-default" {
+					value = li.text
+				}
+			}
+			props[key] = value
+		case "Seq", "Bag":
+			var items []string
+			for _, li := range kid.kids {
+				if li.text != "" {
+					items = append(items, li.text)
+				}
+			}
+			props[key] = strings.Join(items, "; ")
+		case "Description":
+			fields(kid, key+"/")
+		}
+	}
+	var walk func(n *xmpNode)
+	walk = func(n *xmpNode) {
+		for _, kid := range n.kids {
+			if kid.name.Space == rdfNS && kid.name.Local == "Description" {
+				fields(kid, "")
+			} else {
+				walk(kid)
+			}
+		}
+	}
+	walk(root)
+	return nil
+}
+
+// Property returns a property by name: an XMP property if the name has a
+// prefix, as in "dc:title", and otherwise an Info entry, as in "Title".
+func (m *DocumentMetadata) Property(name string) (string, bool) {
+	props := m.Info
+	if strings.Contains(name, ":") {
+		props = m.XMP
+	}
+	v, ok := props[name]
+	return v, ok
+}
+
+// Fields returns the canonical fields of the document that it has a
+// value for, and the fields mapping adds, which may be canonical ones or
+// new. A mapped property that is set takes the place of the default
+// sources of its field. Dates from the Info dictionary are converted to
+// RFC 3339.
+func (m *DocumentMetadata) Fields(mapping MetadataMapping) map[string]string {
+	fields := map[string]string{}
+	for _, f := range defaultFields {
+		for _, src := range f.source {
+			if v, ok := m.Property(src); ok && strings.TrimSpace(v) != "" {
+				fields[f.field] = infoDate(src, v)
+				break
+			}
+		}
+	}
+	for src, field := range mapping {
+		if v, ok := m.Property(src); ok {
+			fields[field] = infoDate(src, v)
+		}
+	}
+	return fields
+}
+
+// infoDate converts the value of the Info dictionary's CreationDate and
+// ModDate, such as "D:20240131093000+01'00'", to RFC 3339, and returns
+// other values and dates it cannot read unchanged.
+func infoDate(key, v string) string {
+	if key != "CreationDate" && key != "ModDate" {
+		return v
+	}
+	s := strings.TrimPrefix(strings.TrimSpace(v), "D:")
+	s = strings.ReplaceAll(strings.TrimSuffix(s, "'"), "'", "")
+	for _, layout := range []string{"20060102150405Z0700", "20060102150405", "200601021504", "20060102"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t.Format(time.RFC3339)
+		}
+	}
+	return v
+}
+
+// MetadataMapping maps document properties, named as
+// DocumentMetadata.Property takes them, to manifest fields.
+type MetadataMapping map[string]string
+
+// ParseMetadataMap reads a mapping of document properties to manifest
+// fields, one per line: a property name as DocumentMetadata.Property
+// takes it and, after white space, the field it is recorded as. Blank
+// lines and lines starting with # are skipped. For example:
+//
+//	# the matter number of our document management system
+//	acme:MatterID	matter
+//	# prefer the Info title, which our scanners set
+//	Title	title
+func ParseMetadataMap(r io.Reader) (MetadataMapping, error) {
+	mapping := MetadataMapping{}
+	sc := bufio.NewScanner(r)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		f := strings.Fields(line)
+		if len(f) != 2 {
+			return nil, fmt.Errorf("line %d: want a property and a field name, got %q", n, line)
+		}
+		mapping[f[0]] = f[1]
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return mapping, nil
+}
+
+// LoadMetadataMap reads a mapping of document properties to manifest
+// fields from a file, as ParseMetadataMap does.
+func LoadMetadataMap(path string) (MetadataMapping, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	mapping, err := ParseMetadataMap(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return mapping, nil
+}
@@ -0,0 +1,87 @@
+package pdfripper
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+func init() {
+	RegisterBackend(&nativeBackend{})
+}
+
+// nativeBackend extracts text with the package's own pure-Go PDF parser.
+// It needs no external tools or cgo, so it is the one backend available
+// when building for js/wasm, wasip1, or with the noexec tag. The whole file
+// is read into memory, and the most recently used document stays parsed
+// between calls.
+type nativeBackend struct {
+	mu      sync.Mutex
+	path    string
+	modTime time.Time
+	size    int64
+	doc     *pdfDoc
+
+	vertical string // one of VerticalTextModes; "" means VerticalAuto
+}
+
+func (b *nativeBackend) Name() string { return "native" }
+
+func (b *nativeBackend) WithVerticalText(mode string) Backend {
+	return &nativeBackend{vertical: mode}
+}
+
+func (b *nativeBackend) VerticalText() string {
+	if b.vertical == "" {
+		return VerticalAuto
+	}
+	return b.vertical
+}
+
+func (b *nativeBackend) PageCount(pdfFile string) (int, error) {
+	doc, err := b.open(pdfFile)
+	if err != nil {
+		return 0, err
+	}
+	return len(doc.pages), nil
+}
+
+func (b *nativeBackend) ExtractPage(pdfFile string, page int) (text string, err error) {
+	doc, err := b.open(pdfFile)
+	if err != nil {
+		return "", err
+	}
+	if page < 1 || page > len(doc.pages) {
+		return "", fmt.Errorf("page %d out of range (document has %d pages)", page, len(doc.pages))
+	}
+	// Malformed content must fail the page, not the process.
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("parsing page %d: %v", page, r)
+		}
+	}()
+	return doc.pageText(page-1, b.vertical)
+}
+
+// open returns the parsed document, reparsing only when a different file
+// is requested or the file has changed on disk.
+func (b *nativeBackend) open(pdfFile string) (doc *pdfDoc, err error) {
+	fi, err := os.Stat(pdfFile)
+	if err != nil {
+		return nil, err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.doc != nil && b.path == pdfFile && b.modTime.Equal(fi.ModTime()) && b.size == fi.Size() {
+		return b.doc, nil
+	}
+
+	doc, err = openPDFFile(pdfFile)
+	if err != nil {
+		return nil, err
+	}
+	b.path, b.modTime, b.size, b.doc = pdfFile, fi.ModTime(), fi.Size(), doc
+	return doc, nil
+}
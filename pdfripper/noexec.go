@@ -0,0 +1,7 @@
+//go:build noexec || js || wasip1
+
+package pdfripper
+
+// DefaultBackend is the name of the backend used when none is selected.
+// Builds without subprocess support default to the native backend.
+const DefaultBackend = "native"
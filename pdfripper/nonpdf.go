@@ -0,0 +1,162 @@
+package pdfripper
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// Media types SniffType reports for the inputs an Extractor handles.
+const (
+	MediaPDF  = "application/pdf"
+	MediaHTML = "text/html"
+	MediaText = "text/plain"
+)
+
+// SniffType returns the media type of a file, such as MediaPDF, MediaHTML
+// or image/png, from its first bytes rather than its name. A file is a
+// PDF if its %PDF- header is within its first 1024 bytes, as readers
+// allow; other types are those of http.DetectContentType.
+func SniffType(file string) (string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	head := make([]byte, 1024)
+	n, err := io.ReadFull(f, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return "", err
+	}
+	head = head[:n]
+	if bytes.Contains(head, []byte("%PDF-")) {
+		return MediaPDF, nil
+	}
+	mediaType, _, _ := strings.Cut(http.DetectContentType(head), ";")
+	return mediaType, nil
+}
+
+// ErrNotPDF is matched by the errors CheckPDF returns, with errors.Is.
+var ErrNotPDF = errors.New("not a PDF")
+
+// CheckPDF checks that a file is a whole PDF, cheaply, before anything
+// else reads it: that it has a %PDF- header within its first 1024 bytes
+// and a %%EOF marker within its last 1024, as readers allow. Otherwise it
+// returns a *NotPDFError, which matches ErrNotPDF.
+func CheckPDF(file string) error {
+	mediaType, err := SniffType(file)
+	if err != nil {
+		return err
+	}
+	if mediaType != MediaPDF {
+		return &NotPDFError{File: file, Type: mediaType}
+	}
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	tail := make([]byte, min(info.Size(), 1024))
+	if _, err := f.ReadAt(tail, info.Size()-int64(len(tail))); err != nil && err != io.EOF {
+		return err
+	}
+	if !bytes.Contains(tail, []byte("%%EOF")) {
+		return &NotPDFError{File: file, Type: MediaPDF, Truncated: true}
+	}
+	return nil
+}
+
+// NotPDFError is returned by extraction when the input is not a PDF, and
+// is not an HTML or text file AcceptNonPDF lets through, or is a PDF cut
+// short. It is returned before any page is extracted.
+type NotPDFError struct {
+	File      string
+	Type      string // As SniffType reports it.
+	Truncated bool   // The file starts like a PDF but does not end with %%EOF, as when a download was cut short.
+}
+
+func (e *NotPDFError) Error() string {
+	if e.Truncated {
+		return fmt.Sprintf("%s is not a whole PDF: it has no %%%%EOF marker at its end, so it may be truncated", e.File)
+	}
+	return fmt.Sprintf("%s is not a PDF: its contents are %s", e.File, e.Type)
+}
+
+func (e *NotPDFError) Is(target error) bool { return target == ErrNotPDF }
+
+// textBackend reads HTML and plain-text inputs accepted with AcceptNonPDF.
+// Form feeds divide the text into pages; without any it is one page.
+type textBackend struct {
+	html bool // Remove the markup with HTMLToText.
+}
+
+func (b textBackend) Name() string {
+	if b.html {
+		return "html"
+	}
+	return "text"
+}
+
+func (b textBackend) PageCount(file string) (int, error) {
+	pages, err := b.pages(file)
+	return len(pages), err
+}
+
+func (b textBackend) ExtractPage(file string, page int) (string, error) {
+	pages, err := b.pages(file)
+	if err != nil {
+		return "", err
+	}
+	if page < 1 || page > len(pages) {
+		return "", fmt.Errorf("page %d is out of range 1 to %d", page, len(pages))
+	}
+	return pages[page-1], nil
+}
+
+func (b textBackend) pages(file string) ([]string, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	text := strings.TrimPrefix(string(data), "\ufeff")
+	if b.html {
+		text = HTMLToText(text)
+	}
+	return strings.Split(strings.TrimSuffix(text, "\f"), "\f"), nil
+}
+
+var (
+	htmlHiddenRe = regexp.MustCompile(`(?is)<!--.*?-->|<script\b.*?</script\s*>|<style\b.*?</style\s*>|<noscript\b.*?</noscript\s*>|<template\b.*?</template\s*>`)
+	htmlBlockRe  = regexp.MustCompile(`(?i)</?(address|article|aside|blockquote|br|caption|dd|div|dl|dt|figcaption|figure|footer|h[1-6]|header|hr|li|main|nav|ol|p|pre|section|table|title|tr|ul)\b[^>]*>`)
+	htmlCellRe   = regexp.MustCompile(`(?i)<t[dh]\b[^>]*>`)
+	htmlTagRe    = regexp.MustCompile(`(?s)<[^>]*>`)
+	spaceRunRe   = regexp.MustCompile(`[ \t\r\x{a0}]+`)
+	blankRunRe   = regexp.MustCompile(`\n{3,}`)
+)
+
+// HTMLToText returns the text of an HTML document: scripts, styles and
+// comments are dropped, block elements such as paragraphs, headings and
+// table rows start new lines, runs of spaces are collapsed and character
+// references are decoded.
+func HTMLToText(s string) string {
+	s = htmlHiddenRe.ReplaceAllString(s, "")
+	s = htmlBlockRe.ReplaceAllString(s, "\n")
+	s = htmlCellRe.ReplaceAllString(s, " ")
+	s = html.UnescapeString(htmlTagRe.ReplaceAllString(s, ""))
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimSpace(spaceRunRe.ReplaceAllString(line, " "))
+	}
+	s = blankRunRe.ReplaceAllString(strings.Join(lines, "\n"), "\n\n")
+	return strings.TrimSpace(s) + "\n"
+}
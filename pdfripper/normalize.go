@@ -0,0 +1,144 @@
+package pdfripper
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// currencies maps the currency symbols invoices print to ISO 4217 codes.
+var currencies = map[string]string{"€": "EUR", "$": "USD", "£": "GBP"}
+
+var (
+	numberRe   = regexp.MustCompile(`-?\d[\d.,' ]*`)
+	currencyRe = regexp.MustCompile(`[€$£]|\b[A-Z]{3}\b`)
+	numericDay = regexp.MustCompile(`^(\d{1,4})[./-](\d{1,2})[./-](\d{2,4})$`)
+	namedDate  = regexp.MustCompile(`^(?:(\d{1,2})\.?\s+(\pL+)\.?|(\pL+)\.?\s+(\d{1,2}),?)\s+(\d{4})$`)
+)
+
+// NormalizeNumber returns a number as printed, such as "1.190,00 €",
+// "EUR 1,190.00" or "1'190.00", with a dot for the decimal point and no
+// grouping, as in "1190.00", and the ISO 4217 code of the currency printed
+// with it, if any. The last separator followed by one or two digits is
+// the decimal point; other separators group thousands. ok is false if s
+// holds no number.
+func NormalizeNumber(s string) (number, currency string, ok bool) {
+	m := numberRe.FindString(s)
+	m = strings.TrimRight(m, ".,' ")
+	if m == "" {
+		return "", "", false
+	}
+	if c := currencyRe.FindString(s); c != "" {
+		if code, ok := currencies[c]; ok {
+			c = code
+		}
+		currency = c
+	}
+	sign := ""
+	if strings.HasPrefix(m, "-") {
+		sign, m = "-", m[1:]
+	}
+	decimals := ""
+	if i := strings.LastIndexAny(m, ".,"); i >= 0 && len(m)-i-1 <= 2 {
+		m, decimals = m[:i], m[i+1:]
+	}
+	digits := strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return r
+		}
+		return -1
+	}, m)
+	if digits == "" {
+		digits = "0"
+	}
+	if decimals != "" {
+		return sign + digits + "." + decimals, currency, true
+	}
+	return sign + digits, currency, true
+}
+
+// months maps the first letters of month names in the languages invoice
+// labels are recognized in to month numbers. Four letters are tried before
+// three, for the French "juin" and "juil".
+var months = map[string]int{
+	"jan": 1, "ene": 1, "gen": 1,
+	"feb": 2, "fév": 2, "fev": 2,
+	"mar": 3, "mär": 3, "maa": 3, "mrt": 3,
+	"apr": 4, "avr": 4, "abr": 4,
+	"may": 5, "mai": 5, "mag": 5, "mei": 5,
+	"jun": 6, "juin": 6, "giu": 6,
+	"jul": 7, "juil": 7, "lug": 7,
+	"aug": 8, "aoû": 8, "aou": 8, "ago": 8,
+	"sep": 9, "set": 9,
+	"oct": 10, "okt": 10, "ott": 10,
+	"nov": 11,
+	"dec": 12, "dez": 12, "déc": 12, "dic": 12,
+}
+
+// NormalizeDate returns a date as printed, such as "12.03.2024",
+// "3/12/24", "12. März 2024" or "March 12, 2024", in ISO 8601 form, as in
+// "2024-03-12". Numeric dates are read year first when they start with
+// four digits; otherwise a first number over 12 is the day and a second
+// over 12 the day too, and when both could be the month dayFirst decides.
+// Two-digit years are taken to be from 1970 to 2069. ok is false if s is
+// not a date.
+func NormalizeDate(s string, dayFirst bool) (date string, ok bool) {
+	s = strings.TrimSpace(s)
+	var year, month, day int
+	if m := numericDay.FindStringSubmatch(s); m != nil {
+		a, _ := strconv.Atoi(m[1])
+		b, _ := strconv.Atoi(m[2])
+		c, _ := strconv.Atoi(m[3])
+		switch {
+		case len(m[1]) == 4:
+			year, month, day = a, b, c
+		case len(m[1]) > 2:
+			return "", false
+		case a > 12 || dayFirst && b <= 12:
+			day, month, year = a, b, c
+		default:
+			month, day, year = a, b, c
+		}
+		if len(m[3]) == 2 && len(m[1]) != 4 {
+			year += 1900
+			if year < 1970 {
+				year += 100
+			}
+		}
+	} else if m := namedDate.FindStringSubmatch(s); m != nil {
+		name, d := m[2], m[1]
+		if name == "" {
+			name, d = m[3], m[4]
+		}
+		month = monthNumber(name)
+		day, _ = strconv.Atoi(d)
+		year, _ = strconv.Atoi(m[5])
+	}
+	if month < 1 || month > 12 || day < 1 || day > 31 || year < 1000 {
+		return "", false
+	}
+	return fmt.Sprintf("%04d-%02d-%02d", year, month, day), true
+}
+
+// monthNumber returns the number of a month by its name, 0 if unknown.
+func monthNumber(name string) int {
+	r := []rune(strings.ToLower(name))
+	for _, n := range []int{4, 3} {
+		if len(r) >= n {
+			if month, ok := months[string(r[:n])]; ok {
+				return month
+			}
+		}
+	}
+	return 0
+}
+
+// decimalComma reports whether an amount as printed uses a comma for the
+// decimal point, as in most of continental Europe, where dates put the day
+// first.
+func decimalComma(amount string) bool {
+	m := strings.TrimRight(numberRe.FindString(amount), ".,' ")
+	i := strings.LastIndexAny(m, ".,")
+	return i >= 0 && m[i] == ',' && len(m)-i-1 <= 2
+}
@@ -0,0 +1,173 @@
+package pdfripper
+
+import (
+	"fmt"
+	"image"
+	"strconv"
+)
+
+// OCREngine recognizes the text in a rendered page image.
+type OCREngine interface {
+	// Name identifies the engine and its settings in cache keys.
+	Name() string
+	// Recognize returns the text of one page image.
+	Recognize(img image.Image) (string, error)
+}
+
+// Defaults for the OCR fallback.
+const (
+	DefaultOCRThreshold = 0.5
+	DefaultOCRDPI       = 300
+)
+
+// score records the class and quality of a page's text and, when OCR is
+// configured, decides whether the page should be rendered and OCRed:
+// always for Scanned pages, whose text is at most a stamp or an old OCR
+// layer, and for Hybrid pages when OCRMerge is set; never for pages that
+// draw neither text nor images; and otherwise when the text scores below
+// the threshold. Pages are classified only when
+// the input could be parsed; unclassified pages use the threshold alone.
+func (e *Extractor) score(r *PageResult) {
+	c := e.classify(r)
+	r.Quality = QualityScore(r.Text)
+	if e.OCR == nil {
+		return
+	}
+	switch {
+	case c != nil && c.Class == Scanned:
+	case c != nil && c.Class == Hybrid && e.OCRMerge:
+	case c != nil && c.VisibleChars == 0 && c.InvisibleChars == 0 && c.ImageCoverage == 0:
+		return
+	case r.Quality >= e.ocrThreshold():
+		return
+	}
+	r.needsOCR = true
+}
+
+// recoverText runs OCR on a page that score picked and keeps whichever
+// text scores better, except that on a Scanned page OCR text that meets
+// the threshold wins, so that a page-number stamp cannot outscore the page
+// it is stamped on. With OCRMerge, a page whose text meets the threshold
+// keeps it and gains the OCR lines of the regions it has no text in. OCR
+// text whose confidence is below ReviewThreshold is also queued for review.
+func (e *Extractor) recoverText(r *PageResult) {
+	m := &usageMeter{}
+	defer func() { r.Usage.add(m.total()) }()
+	res, err := e.ocrPage(r.Page, m)
+	if err != nil {
+		// The extracted text, poor as it is, is still the result.
+		fmt.Printf("Page %d: text quality %.2f, OCR failed: %v\n", r.Page, r.Quality, err)
+		return
+	}
+	if r.ImageHash == (ImageHash{}) {
+		r.ImageHash = res.hash
+	}
+	if e.OCRMerge && r.Class != Scanned && r.Quality >= e.ocrThreshold() {
+		added, ok := e.mergeOCR(r, res.layout)
+		if !ok {
+			fmt.Printf("Page %d: text quality %.2f, cannot merge OCR lines, keeping text\n", r.Page, r.Quality)
+			return
+		}
+		r.OCRLines = added
+		fmt.Printf("Page %d: text quality %.2f, added %d OCR lines\n", r.Page, r.Quality, added)
+		return
+	}
+	quality := QualityScore(res.text)
+	if quality <= r.Quality && !(r.Class == Scanned && quality >= e.ocrThreshold()) {
+		fmt.Printf("Page %d: text quality %.2f, OCR quality %.2f, keeping text\n", r.Page, r.Quality, quality)
+		return
+	}
+	fmt.Printf("Page %d: text quality %.2f, OCR quality %.2f, using OCR\n", r.Page, r.Quality, quality)
+	r.Text, r.Quality, r.OCRUsed = res.text, quality, true
+	if e.OCRLayout != "" {
+		r.OCRLayout = res.layout
+	}
+	if res.layout != nil {
+		r.OCRConfidence = layoutConfidence(e.layoutFormat(), res.layout)
+	}
+	if e.ReviewThreshold > 0 && r.OCRConfidence < e.ReviewThreshold {
+		r.NeedsReview = true
+		if err := e.queueForReview(r, res, m); err != nil {
+			r.Err = fmt.Errorf("queueing page %d for review: %w", r.Page, err)
+		}
+	}
+}
+
+// ocrResult is the outcome of OCR on one page.
+type ocrResult struct {
+	text   string
+	layout []byte      // in e.layoutFormat(), when that is set
+	img    image.Image // the rendered page, unless the result came from the cache
+	hash   ImageHash   // of the rendered page, which the cache keeps too
+}
+
+// ocrPage renders a page and runs OCR on it, using the cache when set,
+// recording the usage of the commands run in m.
+func (e *Extractor) ocrPage(page int, m *usageMeter) (*ocrResult, error) {
+	format := e.layoutFormat()
+	item := "ocr/" + e.OCR.Name() + "/" + strconv.Itoa(e.ocrDPI()) + "/" + strconv.Itoa(page)
+	layoutItem := item + "/" + format
+	hashItem := item + "/hash"
+	if e.Cache != nil {
+		text, ok := e.Cache.Get(e.cacheKey(item))
+		var hash ImageHash
+		if s, ok := e.Cache.Get(e.cacheKey(hashItem)); ok {
+			hash, _ = ParseImageHash(s)
+		}
+		if ok && format == "" {
+			return &ocrResult{text: text, hash: hash}, nil
+		}
+		if ok {
+			if layout, ok := e.Cache.Get(e.cacheKey(layoutItem)); ok {
+				return &ocrResult{text: text, layout: []byte(layout), hash: hash}, nil
+			}
+		}
+	}
+
+	img, err := e.renderForOCR(page, m)
+	if err != nil {
+		return nil, err
+	}
+	res := &ocrResult{img: img, hash: HashImage(img)}
+	if format != "" {
+		// checkOCRLayout has made sure the engine supports this.
+		res.text, res.layout, err = metering(e.OCR, m).(LayoutRecognizer).RecognizeLayout(img, format)
+	} else {
+		res.text, err = metering(e.OCR, m).Recognize(img)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("OCR of page %d: %w", page, err)
+	}
+	e.cachePut(item, res.text)
+	e.cachePut(hashItem, res.hash.String())
+	if res.layout != nil {
+		e.cachePut(layoutItem, string(res.layout))
+	}
+	return res, nil
+}
+
+func (e *Extractor) renderForOCR(page int, m *usageMeter) (image.Image, error) {
+	renderer, ok := metering(e.Backend, m).(Renderer)
+	if !ok {
+		return nil, fmt.Errorf("backend %s cannot render pages", e.Backend.Name())
+	}
+	img, err := renderer.RenderPage(e.PDFFile, page, e.ocrDPI())
+	if err != nil {
+		return nil, fmt.Errorf("rendering page %d: %w", page, err)
+	}
+	return img, nil
+}
+
+func (e *Extractor) ocrDPI() int {
+	if e.OCRDPI > 0 {
+		return e.OCRDPI
+	}
+	return DefaultOCRDPI
+}
+
+func (e *Extractor) ocrThreshold() float64 {
+	if e.OCRThreshold > 0 {
+		return e.OCRThreshold
+	}
+	return DefaultOCRThreshold
+}
@@ -0,0 +1,210 @@
+package pdfripper
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"image"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// OCRLayoutFormats are the values accepted in Extractor.OCRLayout.
+var OCRLayoutFormats = []string{"hocr", "alto"}
+
+// LayoutRecognizer is implemented by OCR engines that can also report the
+// position and confidence of each word, as hOCR or ALTO XML.
+type LayoutRecognizer interface {
+	// RecognizeLayout returns the text of one page image together with
+	// its layout in format, which is one of OCRLayoutFormats.
+	RecognizeLayout(img image.Image, format string) (text string, layout []byte, err error)
+}
+
+// layoutExt returns the file extension page layouts are saved with.
+func layoutExt(format string) string {
+	if format == "alto" {
+		return ".alto.xml"
+	}
+	return "." + format
+}
+
+// layoutFormat returns the layout OCR has to produce this run: OCRLayout,
+// or hOCR when it is only needed for the confidences ReviewThreshold uses
+// or the line positions OCRMerge uses.
+func (e *Extractor) layoutFormat() string {
+	if e.OCRLayout == "" && (e.ReviewThreshold > 0 || e.OCRMerge) {
+		return "hocr"
+	}
+	return e.OCRLayout
+}
+
+// checkOCRLayout reports whether the layout this run needs can be produced.
+func (e *Extractor) checkOCRLayout() error {
+	if e.layoutFormat() == "" {
+		return nil
+	}
+	if e.OCRLayout != "" && !slices.Contains(OCRLayoutFormats, e.OCRLayout) {
+		return fmt.Errorf("unknown OCR layout format %q (available: %s)", e.OCRLayout, strings.Join(OCRLayoutFormats, ", "))
+	}
+	if e.OCR == nil {
+		return fmt.Errorf("OCR layout output, review and OCRMerge need an OCR engine")
+	}
+	if _, ok := e.OCR.(LayoutRecognizer); !ok {
+		if e.OCRLayout == "" {
+			return fmt.Errorf("OCR engine %s does not report word positions and confidences, which review and OCRMerge need", e.OCR.Name())
+		}
+		return fmt.Errorf("OCR engine %s cannot produce %s", e.OCR.Name(), e.OCRLayout)
+	}
+	return nil
+}
+
+// newLayoutDecoder returns a lenient decoder, since hOCR is XHTML that
+// engines do not always keep well-formed.
+func newLayoutDecoder(data []byte) *xml.Decoder {
+	d := xml.NewDecoder(bytes.NewReader(data))
+	d.Strict = false
+	d.AutoClose = xml.HTMLAutoClose
+	d.Entity = xml.HTMLEntity
+	return d
+}
+
+// layoutText returns the plain text of an hOCR or ALTO page: one line of
+// text per OCR line, with a blank line between paragraphs or blocks.
+func layoutText(format string, data []byte) (string, error) {
+	var b strings.Builder
+	var line []string
+	flush := func() {
+		if len(line) > 0 {
+			b.WriteString(strings.Join(line, " "))
+			b.WriteByte('\n')
+			line = line[:0]
+		}
+	}
+	paragraph := func() {
+		flush()
+		if b.Len() > 0 && !strings.HasSuffix(b.String(), "\n\n") {
+			b.WriteByte('\n')
+		}
+	}
+
+	d := newLayoutDecoder(data)
+	depth, word := 0, -1 // word is the depth of the open hOCR word, or -1
+	var cur strings.Builder
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", fmt.Errorf("parsing %s: %w", format, err)
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			depth++
+			if format == "alto" {
+				switch t.Name.Local {
+				case "TextBlock":
+					paragraph()
+				case "TextLine":
+					flush()
+				case "String":
+					line = append(line, xmlAttr(t, "CONTENT"))
+				case "HYP":
+					if n := len(line); n > 0 {
+						line[n-1] += xmlAttr(t, "CONTENT")
+					}
+				}
+				continue
+			}
+			classes := strings.Fields(xmlAttr(t, "class"))
+			switch {
+			case slices.Contains(classes, "ocrx_word"):
+				word = depth
+				cur.Reset()
+			case slices.Contains(classes, "ocr_par"):
+				paragraph()
+			case slices.ContainsFunc(classes, func(c string) bool {
+				return c == "ocr_line" || c == "ocr_textfloat" || c == "ocr_header" || c == "ocr_caption"
+			}):
+				flush()
+			}
+		case xml.EndElement:
+			if depth == word {
+				if w := strings.TrimSpace(cur.String()); w != "" {
+					line = append(line, w)
+				}
+				word = -1
+			}
+			depth--
+		case xml.CharData:
+			if word >= 0 {
+				cur.Write(t)
+			}
+		}
+	}
+	flush()
+	if b.Len() == 0 {
+		return "", nil
+	}
+	return strings.TrimRight(b.String(), "\n") + "\n", nil
+}
+
+// layoutConfidence returns the mean word confidence, from 0 to 1, of an
+// hOCR page (x_wconf, 0 to 100) or an ALTO page (WC, 0 to 1). A page with
+// no rated words has confidence 0.
+func layoutConfidence(format string, data []byte) float64 {
+	d := newLayoutDecoder(data)
+	sum, n := 0.0, 0
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			break
+		}
+		t, ok := tok.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		var conf float64
+		switch {
+		case format == "alto" && t.Name.Local == "String":
+			wc := xmlAttr(t, "WC")
+			if wc == "" {
+				continue
+			}
+			if conf, err = strconv.ParseFloat(wc, 64); err != nil {
+				continue
+			}
+		case format == "hocr" && slices.Contains(strings.Fields(xmlAttr(t, "class")), "ocrx_word"):
+			var found bool
+			for _, prop := range strings.Split(xmlAttr(t, "title"), ";") {
+				if v, ok := strings.CutPrefix(strings.TrimSpace(prop), "x_wconf "); ok {
+					conf, err = strconv.ParseFloat(v, 64)
+					found = err == nil
+				}
+			}
+			if !found {
+				continue
+			}
+			conf /= 100
+		default:
+			continue
+		}
+		sum += conf
+		n++
+	}
+	if n == 0 {
+		return 0
+	}
+	return sum / float64(n)
+}
+
+func xmlAttr(e xml.StartElement, name string) string {
+	for _, a := range e.Attr {
+		if a.Name.Local == name {
+			return a.Value
+		}
+	}
+	return ""
+}
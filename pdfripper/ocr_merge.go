@@ -0,0 +1,273 @@
+package pdfripper
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Thresholds of OCRMerge.
+const (
+	// mergeMinConfidence is the mean word confidence below which an OCR
+	// line is left out: OCR of photographs and line art yields words it
+	// has little confidence in.
+	mergeMinConfidence = 0.5
+	// mergeOverlap is the share of an OCR line's box that native text has
+	// to cover for the line to count as extracted already.
+	mergeOverlap = 0.3
+)
+
+// pageBox is a rectangle on the page as displayed, in fractions of its
+// width and height from the top left corner.
+type pageBox struct {
+	x0, y0, x1, y1 float64
+}
+
+func (b pageBox) area() float64 {
+	return (b.x1 - b.x0) * (b.y1 - b.y0)
+}
+
+// overlap returns the area b and o have in common.
+func (b pageBox) overlap(o pageBox) float64 {
+	w := math.Min(b.x1, o.x1) - math.Max(b.x0, o.x0)
+	h := math.Min(b.y1, o.y1) - math.Max(b.y0, o.y0)
+	if w <= 0 || h <= 0 {
+		return 0
+	}
+	return w * h
+}
+
+// displayedBox returns the box on page p as displayed of the device-space
+// rectangle from (x0, y0) to (x1, y1).
+func displayedBox(p pdfPage, x0, y0, x1, y1 float64) pageBox {
+	ax, ay := displayedX(p, x0, y0), displayedY(p, x0, y0)
+	bx, by := displayedX(p, x1, y1), displayedY(p, x1, y1)
+	return pageBox{math.Min(ax, bx), math.Min(ay, by), math.Max(ax, bx), math.Max(ay, by)}
+}
+
+// ocrLine is a line of an OCR layout.
+type ocrLine struct {
+	text       string
+	box        [4]float64 // In pixels of the page image, from the top left corner.
+	confidence float64    // Mean word confidence from 0 to 1, or -1 if the words are not rated.
+}
+
+// ocrLayoutLines returns the lines of an hOCR or ALTO page recognized in
+// an image of dpi, with their boxes in pixels.
+func ocrLayoutLines(format string, data []byte, dpi int) ([]ocrLine, error) {
+	var lines []ocrLine
+	var words []string
+	sum, rated := 0.0, 0
+	open := false
+	flush := func() {
+		if open && len(words) > 0 {
+			l := &lines[len(lines)-1]
+			l.text = strings.Join(words, " ")
+			if rated > 0 {
+				l.confidence = sum / float64(rated)
+			}
+		} else if open {
+			lines = lines[:len(lines)-1]
+		}
+		open, words, sum, rated = false, nil, 0, 0
+	}
+	start := func(box [4]float64) {
+		flush()
+		lines = append(lines, ocrLine{box: box, confidence: -1})
+		open = true
+	}
+	rate := func(conf float64) {
+		sum += conf
+		rated++
+	}
+
+	d := newLayoutDecoder(data)
+	depth, word := 0, -1 // word is the depth of the open hOCR word, or -1
+	var cur strings.Builder
+	unit, inUnit := "pixel", false // ALTO's MeasurementUnit
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("parsing %s: %w", format, err)
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			depth++
+			if format == "alto" {
+				switch t.Name.Local {
+				case "MeasurementUnit":
+					inUnit = true
+				case "TextLine":
+					scale := altoScale(unit, dpi)
+					attr := func(name string) float64 {
+						v, _ := strconv.ParseFloat(xmlAttr(t, name), 64)
+						return v * scale
+					}
+					x, y := attr("HPOS"), attr("VPOS")
+					start([4]float64{x, y, x + attr("WIDTH"), y + attr("HEIGHT")})
+				case "String":
+					if open {
+						words = append(words, xmlAttr(t, "CONTENT"))
+						if wc, err := strconv.ParseFloat(xmlAttr(t, "WC"), 64); err == nil {
+							rate(wc)
+						}
+					}
+				}
+				continue
+			}
+			classes := strings.Fields(xmlAttr(t, "class"))
+			switch {
+			case slices.Contains(classes, "ocrx_word"):
+				word = depth
+				cur.Reset()
+				if conf, ok := hocrProperty(xmlAttr(t, "title"), "x_wconf"); ok && open {
+					rate(conf[0] / 100)
+				}
+			case slices.ContainsFunc(classes, func(c string) bool {
+				return c == "ocr_line" || c == "ocr_textfloat" || c == "ocr_header" || c == "ocr_caption"
+			}):
+				if bbox, ok := hocrProperty(xmlAttr(t, "title"), "bbox"); ok && len(bbox) == 4 {
+					start([4]float64{bbox[0], bbox[1], bbox[2], bbox[3]})
+				}
+			}
+		case xml.EndElement:
+			if depth == word {
+				if w := strings.TrimSpace(cur.String()); w != "" && open {
+					words = append(words, w)
+				}
+				word = -1
+			}
+			if format == "alto" && t.Name.Local == "MeasurementUnit" {
+				inUnit = false
+			}
+			depth--
+		case xml.CharData:
+			if word >= 0 {
+				cur.Write(t)
+			}
+			if inUnit {
+				unit = strings.TrimSpace(string(t))
+			}
+		}
+	}
+	flush()
+	return lines, nil
+}
+
+// altoScale returns the pixels per ALTO measurement unit at dpi.
+func altoScale(unit string, dpi int) float64 {
+	switch unit {
+	case "mm10":
+		return float64(dpi) / 254
+	case "inch1200":
+		return float64(dpi) / 1200
+	}
+	return 1
+}
+
+// hocrProperty returns the numbers of a property in an hOCR title, such
+// as "bbox 10 20 30 40; x_wconf 95".
+func hocrProperty(title, name string) ([]float64, bool) {
+	for _, prop := range strings.Split(title, ";") {
+		fields := strings.Fields(prop)
+		if len(fields) < 2 || fields[0] != name {
+			continue
+		}
+		var values []float64
+		for _, f := range fields[1:] {
+			v, err := strconv.ParseFloat(f, 64)
+			if err != nil {
+				return nil, false
+			}
+			values = append(values, v)
+		}
+		return values, true
+	}
+	return nil, false
+}
+
+// mergeOCR adds to r.Text the lines of an OCR layout that lie where the
+// page has no native text, such as the text of a scanned insert or of a
+// stamp drawn as an image, leaving the native text as it is. Each run of
+// added lines goes after as many lines of the text as the page has native
+// lines above it. It returns the number of lines added, or false if the
+// page cannot be merged: it was not parsed or its layout is unknown.
+func (e *Extractor) mergeOCR(r *PageResult, layout []byte) (int, bool) {
+	if e.doc == nil || layout == nil || r.Page > len(e.doc.pages) {
+		return 0, false
+	}
+	dpi := e.ocrDPI()
+	lines, err := ocrLayoutLines(e.layoutFormat(), layout, dpi)
+	if err != nil {
+		return 0, false
+	}
+	p := e.doc.pages[r.Page-1]
+	w, h := displayedSize(p)
+	width, height := w*float64(dpi)/72, h*float64(dpi)/72
+	if width <= 0 || height <= 0 {
+		return 0, false
+	}
+	var native []pageBox
+	for _, l := range e.doc.placedLines(r.Page - 1) {
+		native = append(native, displayedBox(p, l.x0, l.y0, l.x1, l.y1))
+	}
+
+	// The lines to add, by how many native lines are above them.
+	runs := map[int][]string{}
+	added := 0
+	for _, l := range lines {
+		if strings.TrimSpace(l.text) == "" || (l.confidence >= 0 && l.confidence < mergeMinConfidence) {
+			continue
+		}
+		b := pageBox{l.box[0] / width, l.box[1] / height, l.box[2] / width, l.box[3] / height}
+		covered, above := 0.0, 0
+		for _, n := range native {
+			covered += b.overlap(n)
+			if (n.y0+n.y1)/2 < b.y0 {
+				above++
+			}
+		}
+		if covered >= mergeOverlap*b.area() {
+			continue
+		}
+		runs[above] = append(runs[above], l.text)
+		added++
+	}
+	if added == 0 {
+		return 0, true
+	}
+
+	var out []string
+	insert := func(k int) {
+		out = append(out, runs[k]...)
+		delete(runs, k)
+	}
+	insert(0)
+	seen := 0
+	for _, l := range strings.Split(strings.TrimRight(r.Text, "\n"), "\n") {
+		out = append(out, l)
+		if strings.TrimSpace(l) != "" {
+			seen++
+			insert(seen)
+		}
+	}
+	// Runs below more native lines than the text has.
+	rest := make([]int, 0, len(runs))
+	for k := range runs {
+		rest = append(rest, k)
+	}
+	sort.Ints(rest)
+	for _, k := range rest {
+		insert(k)
+	}
+	r.Text = strings.Join(out, "\n") + "\n"
+	return added, true
+}
@@ -0,0 +1,251 @@
+package pdfripper
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// remoteOCRTimeout bounds each request to a remote OCR engine when the
+// engine has no Client of its own.
+const remoteOCRTimeout = 2 * time.Minute
+
+var remoteOCRClient = &http.Client{Timeout: remoteOCRTimeout}
+
+// HTTPOCR sends pages to an OCR service implementing a minimal contract:
+// the page is POSTed to URL as an image/png body, with the language in
+// the "lang" query parameter when set, and the service answers 200 with a
+// JSON object {"text": "..."}. Any other status is an error, and the
+// response body is included in it.
+type HTTPOCR struct {
+	URL      string       // Endpoint to POST pages to.
+	Language string       // Passed to the service as the lang query parameter.
+	Token    string       // If set, sent as a bearer token.
+	Client   *http.Client // Client to use (default: one with a two-minute timeout).
+}
+
+func (h *HTTPOCR) Name() string { return remoteName("http-"+h.URL, h.Language) }
+
+func (h *HTTPOCR) Recognize(img image.Image) (string, error) {
+	body, err := encodePNG(img)
+	if err != nil {
+		return "", err
+	}
+	u := h.URL
+	if h.Language != "" {
+		u = addQuery(u, "lang", h.Language)
+	}
+	req, err := http.NewRequest(http.MethodPost, u, bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "image/png")
+	if h.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+h.Token)
+	}
+	var resp struct {
+		Text string `json:"text"`
+	}
+	if _, err := doJSON(h.Client, req, http.StatusOK, &resp); err != nil {
+		return "", err
+	}
+	return resp.Text, nil
+}
+
+// GoogleVision uses the DOCUMENT_TEXT_DETECTION feature of the Google
+// Cloud Vision API.
+type GoogleVision struct {
+	APIKey   string       // API key for the project.
+	Language string       // Language hint, e.g. "en" (default: detected).
+	Endpoint string       // Base URL (default: https://vision.googleapis.com).
+	Client   *http.Client // Client to use (default: one with a two-minute timeout).
+}
+
+func (g *GoogleVision) Name() string { return remoteName("google-vision", g.Language) }
+
+func (g *GoogleVision) Recognize(img image.Image) (string, error) {
+	data, err := encodePNG(img)
+	if err != nil {
+		return "", err
+	}
+	type feature struct {
+		Type string `json:"type"`
+	}
+	request := map[string]any{
+		"image":    map[string]string{"content": base64.StdEncoding.EncodeToString(data)},
+		"features": []feature{{Type: "DOCUMENT_TEXT_DETECTION"}},
+	}
+	if g.Language != "" {
+		request["imageContext"] = map[string][]string{"languageHints": {g.Language}}
+	}
+	body, err := json.Marshal(map[string]any{"requests": []any{request}})
+	if err != nil {
+		return "", err
+	}
+
+	endpoint := strings.TrimRight(g.Endpoint, "/")
+	if endpoint == "" {
+		endpoint = "https://vision.googleapis.com"
+	}
+	req, err := http.NewRequest(http.MethodPost, addQuery(endpoint+"/v1/images:annotate", "key", g.APIKey), bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	var resp struct {
+		Responses []struct {
+			FullTextAnnotation struct {
+				Text string `json:"text"`
+			} `json:"fullTextAnnotation"`
+			Error *struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		} `json:"responses"`
+	}
+	if _, err := doJSON(g.Client, req, http.StatusOK, &resp); err != nil {
+		return "", err
+	}
+	if len(resp.Responses) != 1 {
+		return "", fmt.Errorf("google vision returned %d responses for one image", len(resp.Responses))
+	}
+	if e := resp.Responses[0].Error; e != nil {
+		return "", fmt.Errorf("google vision: %s", e.Message)
+	}
+	return resp.Responses[0].FullTextAnnotation.Text, nil
+}
+
+// AzureRead uses the asynchronous Read operation of Azure AI Vision
+// (Computer Vision v3.2): the image is submitted, then the operation is
+// polled until it finishes.
+type AzureRead struct {
+	Endpoint     string        // Resource endpoint, e.g. https://<name>.cognitiveservices.azure.com.
+	Key          string        // Subscription key.
+	Language     string        // Language code, e.g. "en" (default: detected).
+	PollInterval time.Duration // Delay between status checks (default: one second).
+	Client       *http.Client  // Client to use (default: one with a two-minute timeout).
+}
+
+func (a *AzureRead) Name() string { return remoteName("azure-read", a.Language) }
+
+func (a *AzureRead) Recognize(img image.Image) (string, error) {
+	data, err := encodePNG(img)
+	if err != nil {
+		return "", err
+	}
+	u := strings.TrimRight(a.Endpoint, "/") + "/vision/v3.2/read/analyze"
+	if a.Language != "" {
+		u = addQuery(u, "language", a.Language)
+	}
+	req, err := http.NewRequest(http.MethodPost, u, bytes.NewReader(data))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("Ocp-Apim-Subscription-Key", a.Key)
+	header, err := doJSON(a.Client, req, http.StatusAccepted, nil)
+	if err != nil {
+		return "", err
+	}
+	operation := header.Get("Operation-Location")
+	if operation == "" {
+		return "", errors.New("azure read returned no Operation-Location")
+	}
+
+	interval := a.PollInterval
+	if interval <= 0 {
+		interval = time.Second
+	}
+	deadline := time.Now().Add(remoteOCRTimeout)
+	for {
+		time.Sleep(interval)
+		req, err := http.NewRequest(http.MethodGet, operation, nil)
+		if err != nil {
+			return "", err
+		}
+		req.Header.Set("Ocp-Apim-Subscription-Key", a.Key)
+		var result struct {
+			Status        string `json:"status"`
+			AnalyzeResult struct {
+				ReadResults []struct {
+					Lines []struct {
+						Text string `json:"text"`
+					} `json:"lines"`
+				} `json:"readResults"`
+			} `json:"analyzeResult"`
+		}
+		if _, err := doJSON(a.Client, req, http.StatusOK, &result); err != nil {
+			return "", err
+		}
+		switch result.Status {
+		case "succeeded":
+			var b strings.Builder
+			for _, page := range result.AnalyzeResult.ReadResults {
+				for _, line := range page.Lines {
+					b.WriteString(line.Text)
+					b.WriteByte('\n')
+				}
+			}
+			return b.String(), nil
+		case "failed":
+			return "", errors.New("azure read operation failed")
+		}
+		if time.Now().After(deadline) {
+			return "", fmt.Errorf("azure read operation still %s after %s", result.Status, remoteOCRTimeout)
+		}
+	}
+}
+
+// doJSON sends req and, if the response has status want, decodes its JSON
+// body into v (unless v is nil) and returns the response headers.
+func doJSON(client *http.Client, req *http.Request, want int, v any) (http.Header, error) {
+	if client == nil {
+		client = remoteOCRClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != want {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("%s returned status %d: %s", req.URL.Host, resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	if v != nil {
+		if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+			return nil, fmt.Errorf("decoding response from %s: %w", req.URL.Host, err)
+		}
+	}
+	return resp.Header, nil
+}
+
+func encodePNG(img image.Image) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func addQuery(rawURL, key, value string) string {
+	sep := "?"
+	if strings.Contains(rawURL, "?") {
+		sep = "&"
+	}
+	return rawURL + sep + url.QueryEscape(key) + "=" + url.QueryEscape(value)
+}
+
+func remoteName(name, lang string) string {
+	if lang == "" {
+		return name
+	}
+	return name + "-" + lang
+}
@@ -0,0 +1,24 @@
+package pdfripper
+
+import (
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// OfficeExtensions are the file extensions of the office documents an
+// OfficeConverter is given.
+var OfficeExtensions = []string{".doc", ".docx", ".odp", ".ods", ".odt", ".ppt", ".pptx", ".rtf", ".xls", ".xlsx"}
+
+// OfficeConverter turns office documents, such as Word, PowerPoint and
+// Excel files, into PDFs to extract.
+type OfficeConverter interface {
+	// ConvertToPDF converts file into a PDF in dir and returns its path.
+	ConvertToPDF(file, dir string) (string, error)
+}
+
+// IsOfficeFile reports whether name is an office document, by its
+// extension.
+func IsOfficeFile(name string) bool {
+	return slices.Contains(OfficeExtensions, strings.ToLower(filepath.Ext(name)))
+}
@@ -0,0 +1,54 @@
+//go:build !noexec && !js && !wasip1
+
+package pdfripper
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// LibreOffice converts office documents to PDF with LibreOffice running
+// headless. Each conversion gets a profile of its own, so conversions can
+// run side by side and do not touch the user's.
+type LibreOffice struct {
+	Command string  // The soffice command (default: soffice).
+	Sandbox Sandbox // Limits for each soffice process.
+	Runner  Runner  // Runs soffice (default: ExecRunner).
+}
+
+func (l *LibreOffice) ConvertToPDF(file, dir string) (string, error) {
+	command := l.Command
+	if command == "" {
+		command = "soffice"
+	}
+	src, err := filepath.Abs(file)
+	if err != nil {
+		return "", err
+	}
+	if dir, err = filepath.Abs(dir); err != nil {
+		return "", err
+	}
+	profile, err := os.MkdirTemp(l.Sandbox.TempDir, "pdfripper-soffice-")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(profile)
+
+	installation := (&url.URL{Scheme: "file", Path: filepath.ToSlash(profile)}).String()
+	_, err = runWith(l.Runner, l.Sandbox, nil, command, "--headless", "--norestore", "--nolockcheck",
+		"-env:UserInstallation="+installation, "--convert-to", "pdf", "--outdir", dir, src)
+	if err != nil {
+		return "", fmt.Errorf("converting %s to PDF: %w", file, err)
+	}
+	// soffice names the PDF after the document, and exits with status 0
+	// even when it cannot convert it.
+	base := filepath.Base(src)
+	pdf := filepath.Join(dir, strings.TrimSuffix(base, filepath.Ext(base))+".pdf")
+	if _, err := os.Stat(pdf); err != nil {
+		return "", fmt.Errorf("converting %s to PDF: soffice wrote no PDF", file)
+	}
+	return pdf, nil
+}
@@ -0,0 +1,127 @@
+package pdfripper
+
+import (
+	"context"
+	"sort"
+	"strings"
+)
+
+// Option sets up an Extractor made by New or used by Extract, ExtractText
+// and ExtractToDir. Options apply in order. A field without an option of
+// its own can be set with a func literal:
+//
+//	pages, err := pdfripper.Extract(ctx, "in.pdf",
+//		pdfripper.WithWorkers(4),
+//		func(e *pdfripper.Extractor) { e.Speech = true })
+type Option func(e *Extractor)
+
+// New returns an Extractor of pdfFile with opts applied. Fields no option
+// sets keep their zero value, which means their default. Nothing is
+// checked or created until a run, which reports bad settings as Validate
+// does.
+func New(pdfFile string, opts ...Option) *Extractor {
+	e := &Extractor{PDFFile: pdfFile}
+	for _, opt := range opts {
+		opt(e)
+	}
+	return e
+}
+
+// WithOutputDir sets OutputDir.
+func WithOutputDir(dir string) Option {
+	return func(e *Extractor) { e.OutputDir = dir }
+}
+
+// WithBackend sets Backend, such as one returned by LookupBackend.
+func WithBackend(b Backend) Option {
+	return func(e *Extractor) { e.Backend = b }
+}
+
+// WithWorkers sets ProcessCount and PostProcessCount to n.
+func WithWorkers(n int) Option {
+	return func(e *Extractor) { e.ProcessCount, e.PostProcessCount = n, n }
+}
+
+// WithOCR sets OCR, so that pages whose text scores below OCRThreshold
+// are OCRed with engine.
+func WithOCR(engine OCREngine) Option {
+	return func(e *Extractor) { e.OCR = engine }
+}
+
+// WithPostProcessors adds to PostProcessors.
+func WithPostProcessors(p ...PostProcessor) Option {
+	return func(e *Extractor) { e.PostProcessors = append(e.PostProcessors, p...) }
+}
+
+// WithReplacements adds to Replacements.
+func WithReplacements(r ...Replacement) Option {
+	return func(e *Extractor) { e.Replacements = append(e.Replacements, r...) }
+}
+
+// WithCache sets Cache.
+func WithCache(c Cache) Option {
+	return func(e *Extractor) { e.Cache = c }
+}
+
+// WithPageHook sets PageDone.
+func WithPageHook(h PageHook) Option {
+	return func(e *Extractor) { e.PageDone = h }
+}
+
+// WithStages adds to Stages.
+func WithStages(s ...Stage) Option {
+	return func(e *Extractor) { e.Stages = append(e.Stages, s...) }
+}
+
+// WithHooks adds to Hooks.
+func WithHooks(h ...Hook) Option {
+	return func(e *Extractor) { e.Hooks = append(e.Hooks, h...) }
+}
+
+// WithLimits sets MaxFileSizeBytes and MaxPages; 0 leaves either
+// unlimited.
+func WithLimits(maxFileSizeBytes int64, maxPages int) Option {
+	return func(e *Extractor) { e.MaxFileSizeBytes, e.MaxPages = maxFileSizeBytes, maxPages }
+}
+
+// Extract extracts the text of pdfFile in memory and returns its pages in
+// page order. Page files are not written, though options that save images
+// do so in OutputDir. If a page fails, the first error is returned along
+// with the pages that did not.
+func Extract(ctx context.Context, pdfFile string, opts ...Option) ([]*PageResult, error) {
+	var sink resultSink
+	err := New(pdfFile, opts...).ExtractToContext(ctx, &sink)
+	sort.Slice(sink.pages, func(i, j int) bool { return sink.pages[i].Page < sink.pages[j].Page })
+	return sink.pages, err
+}
+
+// ExtractText extracts the text of pdfFile in memory, as Extract does, and
+// returns the pages one after the other, each ended by a form feed, as
+// CombinedFile has them.
+func ExtractText(ctx context.Context, pdfFile string, opts ...Option) (string, error) {
+	pages, err := Extract(ctx, pdfFile, opts...)
+	var b strings.Builder
+	for _, r := range pages {
+		b.WriteString(r.Text)
+		b.WriteByte('\f')
+	}
+	return b.String(), err
+}
+
+// ExtractToDir extracts pdfFile into dir, one file per page, as
+// ExtractPages does, creating dir if need be.
+func ExtractToDir(ctx context.Context, pdfFile, dir string, opts ...Option) error {
+	return New(pdfFile, append(opts, WithOutputDir(dir))...).ExtractPagesContext(ctx)
+}
+
+// resultSink keeps the pages of Extract in memory.
+type resultSink struct {
+	pages []*PageResult
+}
+
+func (s *resultSink) WritePage(r *PageResult) error {
+	s.pages = append(s.pages, r)
+	return nil
+}
+
+func (s *resultSink) Close() error { return nil }
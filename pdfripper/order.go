@@ -0,0 +1,176 @@
+package pdfripper
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Orders pages can be extracted in, for Extractor.PageOrder.
+const (
+	OrderFirstLast = "first-last" // Page order, the default.
+	OrderLastFirst = "last-first" // From the last page to the first.
+	OrderOutline   = "outline"    // The pages the outline points to, in outline order, then the rest in page order.
+	OrderCustom    = "custom"     // Extractor.PriorityPages, then the rest in page order.
+)
+
+// PageOrders are the values accepted in Extractor.PageOrder.
+var PageOrders = []string{OrderFirstLast, OrderLastFirst, OrderOutline, OrderCustom}
+
+// pageBound is a page of a page spec, counted from the first page or, if
+// fromEnd is set, from the last, which is 1 from the end.
+type pageBound struct {
+	n       int
+	fromEnd bool
+}
+
+// pageSpan is an inclusive range of a page spec, which may run backwards.
+type pageSpan struct {
+	from, to pageBound
+}
+
+// parsePageSpec parses a comma-separated list of pages and ranges that may
+// count from the end, as qpdf's do: "z" is the last page and "rN" the Nth
+// from the end, so "1-10,r5-z" is the first ten pages and the last five.
+func parsePageSpec(s string) ([]pageSpan, error) {
+	bound := func(field, part string) (pageBound, error) {
+		var b pageBound
+		switch {
+		case part == "z":
+			return pageBound{n: 1, fromEnd: true}, nil
+		case strings.HasPrefix(part, "r"):
+			b.fromEnd = true
+			part = part[1:]
+		}
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 1 {
+			return b, fmt.Errorf("invalid page %q", field)
+		}
+		b.n = n
+		return b, nil
+	}
+	var spans []pageSpan
+	for _, field := range strings.Split(s, ",") {
+		field = strings.TrimSpace(field)
+		first, last, isRange := strings.Cut(field, "-")
+		from, err := bound(field, first)
+		if err != nil {
+			return nil, err
+		}
+		to := from
+		if isRange {
+			if to, err = bound(field, last); err != nil {
+				return nil, err
+			}
+		}
+		spans = append(spans, pageSpan{from, to})
+	}
+	return spans, nil
+}
+
+// ParsePageSpec returns the pages of a document of totalPages that s, a
+// page list as PriorityPages takes, names, in its order. Pages the
+// document does not have are left out.
+func ParsePageSpec(s string, totalPages int) ([]int, error) {
+	spans, err := parsePageSpec(s)
+	if err != nil {
+		return nil, err
+	}
+	return specPages(spans, totalPages), nil
+}
+
+// specPages returns the pages of the spans in a document of totalPages,
+// leaving out those it does not have.
+func specPages(spans []pageSpan, totalPages int) []int {
+	page := func(b pageBound) int {
+		if b.fromEnd {
+			return totalPages - b.n + 1
+		}
+		return b.n
+	}
+	var pages []int
+	for _, s := range spans {
+		from, to := page(s.from), page(s.to)
+		step := 1
+		if to < from {
+			step = -1
+		}
+		for p := from; p != to+step; p += step {
+			if p >= 1 && p <= totalPages {
+				pages = append(pages, p)
+			}
+		}
+	}
+	return pages
+}
+
+// checkPageOrder reports a PageOrder or PriorityPages that cannot work.
+func (e *Extractor) checkPageOrder() error {
+	switch e.PageOrder {
+	case "", OrderFirstLast, OrderLastFirst, OrderOutline:
+		if e.PriorityPages != "" {
+			return fmt.Errorf("PriorityPages needs PageOrder %s", OrderCustom)
+		}
+	case OrderCustom:
+		if e.PriorityPages == "" {
+			return fmt.Errorf("PageOrder %s needs PriorityPages", OrderCustom)
+		}
+		if _, err := parsePageSpec(e.PriorityPages); err != nil {
+			return fmt.Errorf("PriorityPages: %w", err)
+		}
+	default:
+		return fmt.Errorf("unknown PageOrder %q (available: %s)", e.PageOrder, strings.Join(PageOrders, ", "))
+	}
+	if e.reordered() && (e.CombinedFile != "" || len(e.Splitters) > 0 || e.SectionMarker != nil || e.ChunkSize > 0 || e.Segment != "" || e.Summarize != nil) {
+		return fmt.Errorf("CombinedFile, Splitters, SectionMarker, ChunkSize, Segment and Summarize need the pages in page order, not PageOrder %s", e.PageOrder)
+	}
+	return nil
+}
+
+// reordered reports whether pages are extracted in an order other than
+// page order.
+func (e *Extractor) reordered() bool {
+	return e.PageOrder != "" && e.PageOrder != OrderFirstLast
+}
+
+// extractionOrder returns the pages of a run of totalPages that pass
+// FilterOrientation, in the order PageOrder puts them in. Every page is
+// there once.
+func (e *Extractor) extractionOrder(totalPages int) []int {
+	var first []int
+	switch e.PageOrder {
+	case OrderLastFirst:
+		for p := totalPages; p >= 1; p-- {
+			first = append(first, p)
+		}
+	case OrderOutline:
+		if e.doc != nil {
+			for _, item := range e.doc.outline() {
+				if item.Page > 0 {
+					first = append(first, item.Page)
+				}
+			}
+		}
+		if len(first) == 0 {
+			fmt.Println("No outline to order the pages by; extracting them in page order")
+		}
+	case OrderCustom:
+		spans, _ := parsePageSpec(e.PriorityPages)
+		first = specPages(spans, totalPages)
+	}
+	order := make([]int, 0, totalPages)
+	seen := make([]bool, totalPages+1)
+	add := func(p int) {
+		if !seen[p] && e.included(p) {
+			seen[p] = true
+			order = append(order, p)
+		}
+	}
+	for _, p := range first {
+		add(p)
+	}
+	for p := 1; p <= totalPages; p++ {
+		add(p)
+	}
+	return order
+}
@@ -0,0 +1,140 @@
+package pdfripper
+
+// maxNameTreeDepth bounds the descent into a name tree, which could be
+// made cyclic.
+const maxNameTreeDepth = 32
+
+// OutlineItem is an entry of a document's outline, or bookmarks.
+type OutlineItem struct {
+	Title string `json:"title"`
+	Level int    `json:"level"` // 0 for top-level entries.
+	Page  int    `json:"page"`  // 1-indexed page the entry points to, or 0 if it points to none of the document's pages.
+}
+
+// Outline reads the outline of a PDF, in the order it is shown, using the
+// package's own parser. A document without an outline has no items.
+func Outline(pdfFile string) ([]OutlineItem, error) {
+	d, err := openPDFFile(pdfFile)
+	if err != nil {
+		return nil, err
+	}
+	return d.outline(), nil
+}
+
+func (d *pdfDoc) outline() []OutlineItem {
+	root := d.resolveDict(d.trailer["Root"])
+	outlines := d.resolveDict(root["Outlines"])
+	if outlines == nil {
+		return nil
+	}
+	pages := map[pdfRef]int{}
+	for i, p := range d.pages {
+		if p.ref != (pdfRef{}) {
+			pages[p.ref] = i + 1
+		}
+	}
+	var items []OutlineItem
+	// Outline items are always indirect objects, so seen guards against
+	// cycles in the First and Next links.
+	seen := map[pdfRef]bool{}
+	var walk func(node pdfObject, level int)
+	walk = func(node pdfObject, level int) {
+		for {
+			ref, ok := node.(pdfRef)
+			if !ok || seen[ref] {
+				return
+			}
+			seen[ref] = true
+			item := d.resolveDict(ref)
+			if item == nil {
+				return
+			}
+			title, _ := d.resolve(item["Title"]).(pdfString)
+			dest := item["Dest"]
+			if dest == nil {
+				if a := d.resolveDict(item["A"]); a != nil && d.resolveName(a["S"]) == "GoTo" {
+					dest = a["D"]
+				}
+			}
+			items = append(items, OutlineItem{Title: textString(title), Level: level, Page: d.destPage(root, dest, pages)})
+			walk(item["First"], level+1)
+			node = item["Next"]
+		}
+	}
+	walk(outlines["First"], 0)
+	return items
+}
+
+// destPage returns the 1-indexed page a destination points to, following
+// named destinations, or 0. pages maps page objects to their numbers.
+func (d *pdfDoc) destPage(root pdfDict, dest pdfObject, pages map[pdfRef]int) int {
+	// A name leads to an array or to a dictionary holding one in /D; more
+	// steps than that are a loop.
+	for step := 0; step < 4; step++ {
+		switch v := d.resolve(dest).(type) {
+		case pdfArray:
+			if len(v) == 0 {
+				return 0
+			}
+			if ref, ok := v[0].(pdfRef); ok {
+				return pages[ref]
+			}
+			// Some writers give the page index instead of the page.
+			if n, ok := pdfInt(v[0]); ok && n >= 0 && n < len(d.pages) {
+				return n + 1
+			}
+			return 0
+		case pdfDict:
+			dest = v["D"]
+		case pdfName:
+			dest = d.namedDest(root, string(v))
+		case pdfString:
+			dest = d.namedDest(root, string(v))
+		default:
+			return 0
+		}
+	}
+	return 0
+}
+
+// namedDest looks a named destination up in the catalog's /Dests
+// dictionary, as PDF 1.1 has them, or in its /Dests name tree.
+func (d *pdfDoc) namedDest(root pdfDict, name string) pdfObject {
+	if dests := d.resolveDict(root["Dests"]); dests != nil {
+		if dest, ok := dests[pdfName(name)]; ok {
+			return dest
+		}
+	}
+	if names := d.resolveDict(root["Names"]); names != nil {
+		return d.nameTreeLookup(names["Dests"], name, 0)
+	}
+	return nil
+}
+
+// nameTreeLookup returns the value for key in the name tree rooted at
+// node, or nil.
+func (d *pdfDoc) nameTreeLookup(node pdfObject, key string, depth int) pdfObject {
+	n := d.resolveDict(node)
+	if n == nil || depth > maxNameTreeDepth {
+		return nil
+	}
+	if limits := d.resolveArray(n["Limits"]); len(limits) == 2 {
+		lo, _ := d.resolve(limits[0]).(pdfString)
+		hi, _ := d.resolve(limits[1]).(pdfString)
+		if key < string(lo) || key > string(hi) {
+			return nil
+		}
+	}
+	names := d.resolveArray(n["Names"])
+	for i := 0; i+1 < len(names); i += 2 {
+		if k, _ := d.resolve(names[i]).(pdfString); string(k) == key {
+			return names[i+1]
+		}
+	}
+	for _, kid := range d.resolveArray(n["Kids"]) {
+		if v := d.nameTreeLookup(kid, key, depth+1); v != nil {
+			return v
+		}
+	}
+	return nil
+}
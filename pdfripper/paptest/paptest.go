@@ -0,0 +1,196 @@
+// Package paptest builds small synthetic PDFs in memory, so that code using
+// pdfripper can be tested without binary fixtures or poppler in CI:
+//
+//	func TestIndexer(t *testing.T) {
+//		path := paptest.TempPDF(t, "Hello, world!\nSecond line", "Page two")
+//		native, err := pdfripper.LookupBackend("native")
+//		if err != nil {
+//			t.Fatal(err)
+//		}
+//		pages, err := pdfripper.Extract(context.Background(), path, pdfripper.WithBackend(native))
+//		if err != nil {
+//			t.Fatal(err)
+//		}
+//		// pages[0].Text is "Hello, world!\nSecond line\n" and pages[1].Text "Page two\n".
+//	}
+//
+// The PDFs use the standard Helvetica font with WinAnsiEncoding, so only
+// Latin-1 and a few typographic characters (curly quotes, dashes, the euro
+// sign) can be drawn; others are written as "?".
+package paptest
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Letter is the size of a US Letter page in points, the default page size.
+var Letter = [2]float64{612, 792}
+
+// A4 is the size of an A4 page in points.
+var A4 = [2]float64{595, 842}
+
+// Layout of the text on a page.
+const (
+	FontSize = 12 // Points.
+	Leading  = 14 // Points from one baseline to the next.
+	Margin   = 72 // Points from the top and left edges to the first line.
+)
+
+// Page is one page of a synthetic document.
+type Page struct {
+	Lines  []string   // Lines of text, drawn top to bottom; empty lines leave a gap.
+	Size   [2]float64 // Width and height in points (default: Letter).
+	Rotate int        // The page's /Rotate, a multiple of 90.
+}
+
+// Document is a synthetic PDF document.
+type Document struct {
+	Pages []Page
+	Title string // If set, written to the document information dictionary.
+}
+
+// TextPages returns one page per string, split into lines at "\n".
+func TextPages(pages ...string) []Page {
+	ps := make([]Page, len(pages))
+	for i, text := range pages {
+		if text != "" {
+			ps[i].Lines = strings.Split(text, "\n")
+		}
+	}
+	return ps
+}
+
+// TextPDF returns a document with one Letter page per string, split into
+// lines at "\n". An empty string gives a blank page.
+func TextPDF(pages ...string) []byte {
+	return (&Document{Pages: TextPages(pages...)}).Bytes()
+}
+
+// TempPDF writes TextPDF(pages...) to a file in tb.TempDir and returns its
+// path.
+func TempPDF(tb testing.TB, pages ...string) string {
+	tb.Helper()
+	path := filepath.Join(tb.TempDir(), "paptest.pdf")
+	if err := os.WriteFile(path, TextPDF(pages...), 0644); err != nil {
+		tb.Fatal(err)
+	}
+	return path
+}
+
+// WriteFile writes the document to path.
+func (d *Document) WriteFile(path string) error {
+	return os.WriteFile(path, d.Bytes(), 0644)
+}
+
+// Bytes returns the document as a PDF file. A document without pages gets
+// a single blank one, since a PDF needs at least one page.
+func (d *Document) Bytes() []byte {
+	pages := d.Pages
+	if len(pages) == 0 {
+		pages = []Page{{}}
+	}
+
+	// Objects: 1 catalog, 2 page tree, 3 font, then a page and its content
+	// stream for each page, then the information dictionary.
+	var objs []string
+	kids := make([]string, len(pages))
+	for i := range pages {
+		kids[i] = fmt.Sprintf("%d 0 R", 4+2*i)
+	}
+	objs = append(objs,
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(pages)),
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>",
+	)
+	for i, p := range pages {
+		size := p.Size
+		if size[0] <= 0 || size[1] <= 0 {
+			size = Letter
+		}
+		page := fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %s %s] /Resources << /Font << /F1 3 0 R >> >> /Contents %d 0 R",
+			number(size[0]), number(size[1]), 5+2*i)
+		if p.Rotate != 0 {
+			page += fmt.Sprintf(" /Rotate %d", p.Rotate)
+		}
+		content := pageContent(p.Lines, size[1])
+		objs = append(objs, page+" >>", fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", len(content), content))
+	}
+	info := ""
+	if d.Title != "" {
+		objs = append(objs, fmt.Sprintf("<< /Title %s /Producer (paptest) >>", literal(d.Title)))
+		info = fmt.Sprintf(" /Info %d 0 R", len(objs))
+	}
+
+	var b bytes.Buffer
+	b.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+	offsets := make([]int, len(objs))
+	for i, obj := range objs {
+		offsets[i] = b.Len()
+		fmt.Fprintf(&b, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+	}
+	xref := b.Len()
+	fmt.Fprintf(&b, "xref\n0 %d\n0000000000 65535 f \n", len(objs)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&b, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&b, "trailer\n<< /Size %d /Root 1 0 R%s >>\nstartxref\n%d\n%%%%EOF\n", len(objs)+1, info, xref)
+	return b.Bytes()
+}
+
+// pageContent draws lines top to bottom from the top-left margin of a page
+// of the given height.
+func pageContent(lines []string, height float64) string {
+	if len(lines) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "BT /F1 %d Tf %d TL %d %s Td", FontSize, Leading, Margin, number(height-Margin))
+	for i, line := range lines {
+		if i > 0 {
+			b.WriteString(" T*")
+		}
+		if line != "" {
+			b.WriteString(" " + literal(line) + " Tj")
+		}
+	}
+	b.WriteString(" ET")
+	return b.String()
+}
+
+// winAnsi holds the characters WinAnsiEncoding puts in 0x80 to 0x9f.
+var winAnsi = map[rune]byte{
+	'€': 0x80, '‚': 0x82, '„': 0x84, '…': 0x85, '‘': 0x91, '’': 0x92,
+	'“': 0x93, '”': 0x94, '•': 0x95, '–': 0x96, '—': 0x97, '™': 0x99,
+}
+
+// literal encodes s as a PDF literal string in WinAnsiEncoding.
+func literal(s string) string {
+	var b strings.Builder
+	b.WriteByte('(')
+	for _, r := range s {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r >= 0x20 && r < 0x7f:
+			b.WriteRune(r)
+		case r >= 0xa0 && r <= 0xff:
+			fmt.Fprintf(&b, "\\%03o", r)
+		case winAnsi[r] != 0:
+			fmt.Fprintf(&b, "\\%03o", winAnsi[r])
+		default:
+			b.WriteByte('?')
+		}
+	}
+	b.WriteByte(')')
+	return b.String()
+}
+
+func number(v float64) string {
+	return strings.TrimSuffix(strings.TrimRight(fmt.Sprintf("%.3f", v), "0"), ".")
+}
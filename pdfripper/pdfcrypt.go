@@ -0,0 +1,323 @@
+package pdfripper
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/md5"
+	"crypto/rc4"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"sync/atomic"
+)
+
+// passwordPadding is the fixed string used to pad passwords (PDF 1.7, 7.6.3.3).
+var passwordPadding = []byte{
+	0x28, 0xBF, 0x4E, 0x5E, 0x4E, 0x75, 0x8A, 0x41, 0x64, 0x00, 0x4E, 0x56, 0xFF, 0xFA, 0x01, 0x08,
+	0x2E, 0x2E, 0x00, 0xB6, 0xD0, 0x68, 0x3E, 0x80, 0x2F, 0x0C, 0xA9, 0xFE, 0x64, 0x53, 0x69, 0x7A,
+}
+
+var documentPassword atomic.Pointer[string]
+
+// SetPassword makes documents encrypted with a user password open with
+// password, both in the native backend and in the poppler tools, which
+// are given it as -upw. With "", the default, only documents whose user
+// password is empty open, which covers the common case of files that are
+// only protected against editing or copying.
+func SetPassword(password string) {
+	documentPassword.Store(&password)
+}
+
+// userPassword returns the password SetPassword set as revision r of the
+// security handler takes it: in PDFDocEncoding, taken as Latin-1, before
+// revision 5, and as UTF-8 of up to 127 bytes from it on.
+func userPassword(r int) []byte {
+	p := documentPassword.Load()
+	if p == nil || *p == "" {
+		return nil
+	}
+	if r >= 5 {
+		return []byte(*p)[:min(len(*p), 127)]
+	}
+	var b []byte
+	for _, c := range *p {
+		if c > 0xFF {
+			c = '?'
+		}
+		b = append(b, byte(c))
+	}
+	return b
+}
+
+// pdfCrypt implements the standard security handler for documents that
+// open with the user password SetPassword set, or with an empty one.
+type pdfCrypt struct {
+	key         []byte
+	stmMethod   string // "RC4", "AESV2", "AESV3", or "Identity"
+	strMethod   string
+	encryptMeta bool
+}
+
+func newPDFCrypt(d *pdfDoc, enc pdfDict) (*pdfCrypt, error) {
+	if filter := d.resolveName(enc["Filter"]); filter != "Standard" {
+		return nil, fmt.Errorf("unsupported security handler %q", filter)
+	}
+	v, _ := pdfInt(d.resolve(enc["V"]))
+	r, _ := pdfInt(d.resolve(enc["R"]))
+	keyBits := 40
+	if n, ok := pdfInt(d.resolve(enc["Length"])); ok {
+		keyBits = n
+	}
+	o, _ := d.resolve(enc["O"]).(pdfString)
+	u, _ := d.resolve(enc["U"]).(pdfString)
+	p, _ := pdfInt(d.resolve(enc["P"]))
+	var id []byte
+	if ids := d.resolveArray(d.trailer["ID"]); len(ids) > 0 {
+		s, _ := d.resolve(ids[0]).(pdfString)
+		id = []byte(s)
+	}
+
+	c := &pdfCrypt{stmMethod: "RC4", strMethod: "RC4", encryptMeta: true}
+	if b, ok := d.resolve(enc["EncryptMetadata"]).(bool); ok {
+		c.encryptMeta = b
+	}
+	if v >= 4 {
+		cf := d.resolveDict(enc["CF"])
+		method := func(name pdfName) string {
+			if name == "" || name == "Identity" {
+				return "Identity"
+			}
+			switch d.resolveName(d.resolveDict(cf[name])["CFM"]) {
+			case "AESV2":
+				return "AESV2"
+			case "AESV3":
+				return "AESV3"
+			case "None":
+				return "Identity"
+			}
+			return "RC4"
+		}
+		c.stmMethod = method(d.resolveName(enc["StmF"]))
+		c.strMethod = method(d.resolveName(enc["StrF"]))
+	}
+
+	switch {
+	case r >= 5:
+		ue, _ := d.resolve(enc["UE"]).(pdfString)
+		key, err := aes256FileKey(userPassword(r), []byte(u), []byte(ue), r)
+		if err != nil {
+			return nil, err
+		}
+		c.key = key
+	case r >= 2:
+		keyLen := min(max(keyBits/8, 5), 16)
+		if r == 2 {
+			keyLen = 5
+		}
+		c.key = rc4FileKey(userPassword(r), []byte(o), uint32(int32(p)), id, r, keyLen, c.encryptMeta)
+		if !c.checkUserPassword([]byte(u), id, r) {
+			return nil, errPDFEncrypted
+		}
+	default:
+		return nil, fmt.Errorf("unsupported security handler revision %d", r)
+	}
+	return c, nil
+}
+
+// rc4FileKey computes the file encryption key for revisions 2 to 4
+// (algorithm 2).
+func rc4FileKey(password, o []byte, p uint32, id []byte, r, keyLen int, encryptMeta bool) []byte {
+	h := md5.New()
+	h.Write(padPassword(password))
+	h.Write(o[:min(len(o), 32)])
+	binary.Write(h, binary.LittleEndian, p)
+	h.Write(id)
+	if r >= 4 && !encryptMeta {
+		h.Write([]byte{0xFF, 0xFF, 0xFF, 0xFF})
+	}
+	sum := h.Sum(nil)
+	if r >= 3 {
+		for i := 0; i < 50; i++ {
+			s := md5.Sum(sum[:keyLen])
+			sum = s[:]
+		}
+	}
+	return sum[:keyLen]
+}
+
+func padPassword(password []byte) []byte {
+	padded := make([]byte, 32)
+	n := copy(padded, password)
+	copy(padded[n:], passwordPadding)
+	return padded
+}
+
+// checkUserPassword verifies the computed key against /U (algorithms 4 and 5).
+func (c *pdfCrypt) checkUserPassword(u, id []byte, r int) bool {
+	if r == 2 {
+		out := make([]byte, 32)
+		rc, _ := rc4.NewCipher(c.key)
+		rc.XORKeyStream(out, passwordPadding)
+		return len(u) >= 32 && bytes.Equal(out, u[:32])
+	}
+	sum := md5.Sum(append(append([]byte(nil), passwordPadding...), id...))
+	out := sum[:]
+	for i := 0; i < 20; i++ {
+		k := make([]byte, len(c.key))
+		for j := range k {
+			k[j] = c.key[j] ^ byte(i)
+		}
+		rc, _ := rc4.NewCipher(k)
+		rc.XORKeyStream(out, out)
+	}
+	return len(u) >= 16 && bytes.Equal(out, u[:16])
+}
+
+// aes256FileKey validates the user password and unwraps the file key for
+// revisions 5 and 6 (algorithm 2.A).
+func aes256FileKey(password, u, ue []byte, r int) ([]byte, error) {
+	if len(u) < 48 || len(ue) < 32 {
+		return nil, errors.New("malformed AES-256 encryption dictionary")
+	}
+	if !bytes.Equal(passwordHash(password, u[32:40], nil, r), u[:32]) {
+		return nil, errPDFEncrypted
+	}
+	block, err := aes.NewCipher(passwordHash(password, u[40:48], nil, r))
+	if err != nil {
+		return nil, err
+	}
+	key := make([]byte, 32)
+	cipher.NewCBCDecrypter(block, make([]byte, 16)).CryptBlocks(key, ue[:32])
+	return key, nil
+}
+
+// passwordHash is the revision 5 SHA-256 hash, or the iterated revision 6
+// hash of algorithm 2.B.
+func passwordHash(password, salt, udata []byte, r int) []byte {
+	sum := sha256.Sum256(bytes.Join([][]byte{password, salt, udata}, nil))
+	k := sum[:]
+	if r < 6 {
+		return k
+	}
+	for i := 0; ; i++ {
+		k1 := bytes.Repeat(bytes.Join([][]byte{password, k, udata}, nil), 64)
+		block, _ := aes.NewCipher(k[:16])
+		e := make([]byte, len(k1))
+		cipher.NewCBCEncrypter(block, k[16:32]).CryptBlocks(e, k1)
+
+		mod := 0
+		for _, b := range e[:16] {
+			mod += int(b)
+		}
+		var h hash.Hash
+		switch mod % 3 {
+		case 0:
+			h = sha256.New()
+		case 1:
+			h = sha512.New384()
+		default:
+			h = sha512.New()
+		}
+		h.Write(e)
+		k = h.Sum(nil)
+		if i >= 63 && int(e[len(e)-1]) <= i-31 {
+			break
+		}
+	}
+	return k[:32]
+}
+
+// objectKey derives the per-object key (algorithm 1). AES-256 uses the file
+// key directly.
+func (c *pdfCrypt) objectKey(ref pdfRef, method string) []byte {
+	if method == "AESV3" {
+		return c.key
+	}
+	h := md5.New()
+	h.Write(c.key)
+	h.Write([]byte{byte(ref.num), byte(ref.num >> 8), byte(ref.num >> 16), byte(ref.gen), byte(ref.gen >> 8)})
+	if method == "AESV2" {
+		h.Write([]byte("sAlT"))
+	}
+	return h.Sum(nil)[:min(len(c.key)+5, 16)]
+}
+
+func (c *pdfCrypt) decrypt(data []byte, ref pdfRef, method string) ([]byte, error) {
+	switch method {
+	case "Identity":
+		return data, nil
+	case "RC4":
+		out := make([]byte, len(data))
+		rc, err := rc4.NewCipher(c.objectKey(ref, method))
+		if err != nil {
+			return nil, err
+		}
+		rc.XORKeyStream(out, data)
+		return out, nil
+	}
+
+	// AESV2 and AESV3: a 16-byte IV followed by CBC data with PKCS#7 padding.
+	if len(data) < 16 {
+		return nil, errors.New("encrypted data shorter than its IV")
+	}
+	block, err := aes.NewCipher(c.objectKey(ref, method))
+	if err != nil {
+		return nil, err
+	}
+	body := data[16:]
+	body = body[:len(body)/aes.BlockSize*aes.BlockSize]
+	out := make([]byte, len(body))
+	cipher.NewCBCDecrypter(block, data[:16]).CryptBlocks(out, body)
+	if n := len(out); n > 0 {
+		if pad := int(out[n-1]); pad >= 1 && pad <= aes.BlockSize && pad <= n {
+			out = out[:n-pad]
+		}
+	}
+	return out, nil
+}
+
+// decryptStrings decrypts every string inside a freshly parsed object.
+func (c *pdfCrypt) decryptStrings(obj pdfObject, ref pdfRef) pdfObject {
+	switch v := obj.(type) {
+	case pdfString:
+		out, err := c.decrypt([]byte(v), ref, c.strMethod)
+		if err != nil {
+			return v
+		}
+		return pdfString(out)
+	case pdfArray:
+		for i := range v {
+			v[i] = c.decryptStrings(v[i], ref)
+		}
+	case pdfDict:
+		for k := range v {
+			v[k] = c.decryptStrings(v[k], ref)
+		}
+	case *pdfStream:
+		c.decryptStrings(v.dict, ref)
+	}
+	return obj
+}
+
+func (c *pdfCrypt) decryptStream(s *pdfStream) ([]byte, error) {
+	if !c.encryptMeta {
+		if t, _ := s.dict["Type"].(pdfName); t == "Metadata" {
+			return s.raw, nil
+		}
+	}
+	switch f := s.dict["Filter"].(type) {
+	case pdfName:
+		if f == "Crypt" {
+			return s.raw, nil
+		}
+	case pdfArray:
+		if len(f) > 0 && f[0] == pdfName("Crypt") {
+			return s.raw, nil
+		}
+	}
+	return c.decrypt(s.raw, s.ref, c.stmMethod)
+}
@@ -0,0 +1,222 @@
+package pdfripper
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+)
+
+// Simple font encodings used by the native backend: each maps a single-byte
+// character code to a glyph name, and glyph names map to Unicode.
+
+// asciiGlyphNames covers codes 0x20-0x7E, shared by WinAnsi and MacRoman.
+var asciiGlyphNames = strings.Fields(`space exclam quotedbl numbersign dollar percent ampersand quotesingle
+	parenleft parenright asterisk plus comma hyphen period slash zero one two three four five six seven
+	eight nine colon semicolon less equal greater question at A B C D E F G H I J K L M N O P Q R S T U V
+	W X Y Z bracketleft backslash bracketright asciicircum underscore grave a b c d e f g h i j k l m n o
+	p q r s t u v w x y z braceleft bar braceright asciitilde`)
+
+// latin1GlyphNames covers codes 0xA0-0xFF of WinAnsiEncoding, which equal
+// the ISO 8859-1 code points.
+var latin1GlyphNames = strings.Fields(`space exclamdown cent sterling currency yen brokenbar section
+	dieresis copyright ordfeminine guillemotleft logicalnot hyphen registered macron degree plusminus
+	twosuperior threesuperior acute mu paragraph periodcentered cedilla onesuperior ordmasculine
+	guillemotright onequarter onehalf threequarters questiondown Agrave Aacute Acircumflex Atilde
+	Adieresis Aring AE Ccedilla Egrave Eacute Ecircumflex Edieresis Igrave Iacute Icircumflex Idieresis
+	Eth Ntilde Ograve Oacute Ocircumflex Otilde Odieresis multiply Oslash Ugrave Uacute Ucircumflex
+	Udieresis Yacute Thorn germandbls agrave aacute acircumflex atilde adieresis aring ae ccedilla egrave
+	eacute ecircumflex edieresis igrave iacute icircumflex idieresis eth ntilde ograve oacute ocircumflex
+	otilde odieresis divide oslash ugrave uacute ucircumflex udieresis yacute thorn ydieresis`)
+
+// winAnsiHigh covers codes 0x80-0x9F of WinAnsiEncoding (Windows-1252).
+var winAnsiHigh = map[byte]struct {
+	name string
+	r    rune
+}{
+	0x80: {"Euro", 0x20AC}, 0x82: {"quotesinglbase", 0x201A}, 0x83: {"florin", 0x0192},
+	0x84: {"quotedblbase", 0x201E}, 0x85: {"ellipsis", 0x2026}, 0x86: {"dagger", 0x2020},
+	0x87: {"daggerdbl", 0x2021}, 0x88: {"circumflex", 0x02C6}, 0x89: {"perthousand", 0x2030},
+	0x8A: {"Scaron", 0x0160}, 0x8B: {"guilsinglleft", 0x2039}, 0x8C: {"OE", 0x0152},
+	0x8E: {"Zcaron", 0x017D}, 0x91: {"quoteleft", 0x2018}, 0x92: {"quoteright", 0x2019},
+	0x93: {"quotedblleft", 0x201C}, 0x94: {"quotedblright", 0x201D}, 0x95: {"bullet", 0x2022},
+	0x96: {"endash", 0x2013}, 0x97: {"emdash", 0x2014}, 0x98: {"tilde", 0x02DC},
+	0x99: {"trademark", 0x2122}, 0x9A: {"scaron", 0x0161}, 0x9B: {"guilsinglright", 0x203A},
+	0x9C: {"oe", 0x0153}, 0x9E: {"zcaron", 0x017E}, 0x9F: {"Ydieresis", 0x0178},
+}
+
+// standardHigh covers the non-ASCII codes of StandardEncoding.
+var standardHigh = map[byte]string{
+	0xA1: "exclamdown", 0xA2: "cent", 0xA3: "sterling", 0xA4: "fraction", 0xA5: "yen", 0xA6: "florin",
+	0xA7: "section", 0xA8: "currency", 0xA9: "quotesingle", 0xAA: "quotedblleft", 0xAB: "guillemotleft",
+	0xAC: "guilsinglleft", 0xAD: "guilsinglright", 0xAE: "fi", 0xAF: "fl", 0xB1: "endash", 0xB2: "dagger",
+	0xB3: "daggerdbl", 0xB4: "periodcentered", 0xB6: "paragraph", 0xB7: "bullet", 0xB8: "quotesinglbase",
+	0xB9: "quotedblbase", 0xBA: "quotedblright", 0xBB: "guillemotright", 0xBC: "ellipsis",
+	0xBD: "perthousand", 0xBF: "questiondown", 0xC1: "grave", 0xC2: "acute", 0xC3: "circumflex",
+	0xC4: "tilde", 0xC5: "macron", 0xC6: "breve", 0xC7: "dotaccent", 0xC8: "dieresis", 0xCA: "ring",
+	0xCB: "cedilla", 0xCD: "hungarumlaut", 0xCE: "ogonek", 0xCF: "caron", 0xD0: "emdash", 0xE1: "AE",
+	0xE3: "ordfeminine", 0xE8: "Lslash", 0xE9: "Oslash", 0xEA: "OE", 0xEB: "ordmasculine", 0xF1: "ae",
+	0xF5: "dotlessi", 0xF8: "lslash", 0xF9: "oslash", 0xFA: "oe", 0xFB: "germandbls",
+}
+
+// macRomanHigh covers codes 0x80-0xFF of MacRomanEncoding.
+var macRomanHigh = strings.Fields(`Adieresis Aring Ccedilla Eacute Ntilde Odieresis Udieresis aacute
+	agrave acircumflex adieresis atilde aring ccedilla eacute egrave ecircumflex edieresis iacute igrave
+	icircumflex idieresis ntilde oacute ograve ocircumflex odieresis otilde uacute ugrave ucircumflex
+	udieresis dagger degree cent sterling section bullet paragraph germandbls registered copyright
+	trademark acute dieresis notequal AE Oslash infinity plusminus lessequal greaterequal yen mu
+	partialdiff summation product pi integral ordfeminine ordmasculine Omega ae oslash questiondown
+	exclamdown logicalnot radical florin approxequal Delta guillemotleft guillemotright ellipsis space
+	Agrave Atilde Otilde OE oe endash emdash quotedblleft quotedblright quoteleft quoteright divide
+	lozenge ydieresis Ydieresis fraction currency guilsinglleft guilsinglright fi fl daggerdbl
+	periodcentered quotesinglbase quotedblbase perthousand Acircumflex Ecircumflex Aacute Edieresis
+	Egrave Iacute Icircumflex Idieresis Igrave Oacute Ocircumflex apple Ograve Uacute Ucircumflex Ugrave
+	dotlessi circumflex tilde macron breve dotaccent ring cedilla hungarumlaut ogonek caron`)
+
+// extraGlyphs lists glyph names that don't appear in WinAnsiEncoding.
+var extraGlyphs = map[string]rune{
+	"fraction": 0x2044, "fi": 0xFB01, "fl": 0xFB02, "ff": 0xFB00, "ffi": 0xFB03, "ffl": 0xFB04,
+	"breve": 0x02D8, "dotaccent": 0x02D9, "ring": 0x02DA, "hungarumlaut": 0x02DD, "ogonek": 0x02DB,
+	"caron": 0x02C7, "Lslash": 0x0141, "lslash": 0x0142, "dotlessi": 0x0131, "notequal": 0x2260,
+	"infinity": 0x221E, "lessequal": 0x2264, "greaterequal": 0x2265, "partialdiff": 0x2202,
+	"summation": 0x2211, "product": 0x220F, "pi": 0x03C0, "integral": 0x222B, "Omega": 0x2126,
+	"radical": 0x221A, "approxequal": 0x2248, "Delta": 0x2206, "lozenge": 0x25CA, "apple": 0xF8FF,
+	"minus": 0x2212, "nbspace": 0x00A0, "sfthyphen": 0x00AD, "bullet": 0x2022, "Euro": 0x20AC,
+	"quoteleft": 0x2018, "quoteright": 0x2019, "quotedblleft": 0x201C, "quotedblright": 0x201D,
+	"endash": 0x2013, "emdash": 0x2014, "ellipsis": 0x2026, "trademark": 0x2122,
+}
+
+var (
+	winAnsiEncoding   [256]string
+	standardEncoding  [256]string
+	macRomanEncoding  [256]string
+	glyphNameToRune   = map[string]rune{}
+	builtinEncodings  map[pdfName]*[256]string
+	standardFontWidth = map[string][]int{}
+)
+
+func init() {
+	for i, name := range asciiGlyphNames {
+		code := 0x20 + i
+		winAnsiEncoding[code] = name
+		standardEncoding[code] = name
+		macRomanEncoding[code] = name
+		glyphNameToRune[name] = rune(code)
+	}
+	standardEncoding['\''] = "quoteright"
+	standardEncoding['`'] = "quoteleft"
+	for code, g := range winAnsiHigh {
+		winAnsiEncoding[code] = g.name
+		glyphNameToRune[g.name] = g.r
+	}
+	for i, name := range latin1GlyphNames {
+		code := 0xA0 + i
+		winAnsiEncoding[code] = name
+		if _, ok := glyphNameToRune[name]; !ok {
+			glyphNameToRune[name] = rune(code)
+		}
+	}
+	for code, name := range standardHigh {
+		standardEncoding[code] = name
+	}
+	for i, name := range macRomanHigh {
+		macRomanEncoding[0x80+i] = name
+	}
+	for name, r := range extraGlyphs {
+		glyphNameToRune[name] = r
+	}
+	builtinEncodings = map[pdfName]*[256]string{
+		"WinAnsiEncoding":  &winAnsiEncoding,
+		"StandardEncoding": &standardEncoding,
+		"MacRomanEncoding": &macRomanEncoding,
+	}
+
+	// Widths of codes 0x20-0x7E in the standard 14 fonts, for files that
+	// omit /Widths. Bold and oblique variants are close enough for spacing
+	// decisions.
+	standardFontWidth["Helvetica"] = []int{
+		278, 278, 355, 556, 556, 889, 667, 191, 333, 333, 389, 584, 278, 333, 278, 278,
+		556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 278, 278, 584, 584, 584, 556,
+		1015, 667, 667, 722, 722, 667, 611, 778, 722, 278, 500, 667, 556, 833, 722, 778,
+		667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 278, 278, 278, 469, 556,
+		333, 556, 556, 500, 556, 556, 278, 556, 556, 222, 222, 500, 222, 833, 556, 556,
+		556, 556, 333, 500, 278, 556, 500, 722, 500, 500, 500, 334, 260, 334, 584,
+	}
+	standardFontWidth["Times"] = []int{
+		250, 333, 408, 500, 500, 833, 778, 180, 333, 333, 500, 564, 250, 333, 250, 278,
+		500, 500, 500, 500, 500, 500, 500, 500, 500, 500, 278, 278, 564, 564, 564, 444,
+		921, 722, 667, 667, 722, 611, 556, 722, 722, 333, 389, 722, 611, 889, 722, 722,
+		556, 722, 667, 556, 611, 722, 722, 944, 722, 722, 611, 333, 278, 333, 469, 500,
+		333, 444, 500, 444, 500, 444, 333, 500, 500, 278, 278, 500, 278, 778, 500, 500,
+		500, 500, 333, 389, 278, 500, 500, 722, 500, 500, 444, 480, 200, 480, 541,
+	}
+}
+
+// glyphRune maps a glyph name to Unicode, understanding the uniXXXX and
+// uXXXX[XX] conventions as well as suffixed (a.sc) and ligature (f_i) names.
+func glyphRune(name string) string {
+	if r, ok := glyphNameToRune[name]; ok {
+		return string(r)
+	}
+	if i := strings.IndexByte(name, '.'); i > 0 {
+		return glyphRune(name[:i])
+	}
+	if strings.Contains(name, "_") {
+		var b strings.Builder
+		for _, part := range strings.Split(name, "_") {
+			b.WriteString(glyphRune(part))
+		}
+		return b.String()
+	}
+	if hex, ok := strings.CutPrefix(name, "uni"); ok && len(hex) >= 4 && len(hex)%4 == 0 {
+		var b strings.Builder
+		for i := 0; i < len(hex); i += 4 {
+			v, err := strconv.ParseUint(hex[i:i+4], 16, 16)
+			if err != nil {
+				return ""
+			}
+			b.WriteRune(rune(v))
+		}
+		return b.String()
+	}
+	if hex, ok := strings.CutPrefix(name, "u"); ok && len(hex) >= 4 && len(hex) <= 6 {
+		if v, err := strconv.ParseUint(hex, 16, 32); err == nil {
+			return string(rune(v))
+		}
+	}
+	return ""
+}
+
+// pdfDocEncodingHigh maps the PDFDocEncoding codes 0x80-0xA0 that differ from
+// Latin-1. The remaining codes match Latin-1 apart from 0x18-0x1F.
+var pdfDocEncodingHigh = [33]rune{
+	'•', '†', '‡', '…', '—', '–', 'ƒ', '⁄', '‹', '›', '−', '‰', '„', '“', '”', '‘',
+	'’', '‚', '™', 'ﬁ', 'ﬂ', 'Ł', 'Œ', 'Š', 'Ÿ', 'Ž', 'ı', 'ł', 'œ', 'š', 'ž', '�',
+	'€',
+}
+
+var pdfDocEncodingLow = [8]rune{'˘', 'ˇ', 'ˆ', '˙', '˝', '˛', '˚', '˜'}
+
+// textString decodes a PDF text string, as used for metadata, bookmarks and
+// file names: UTF-16BE or UTF-8 when it starts with a byte order mark,
+// PDFDocEncoding otherwise.
+func textString(s pdfString) string {
+	b := []byte(s)
+	switch {
+	case bytes.HasPrefix(b, []byte{0xFE, 0xFF}):
+		return utf16BEString(b[2:])
+	case bytes.HasPrefix(b, []byte{0xEF, 0xBB, 0xBF}):
+		return string(b[3:])
+	}
+	var out strings.Builder
+	for _, c := range b {
+		switch {
+		case c >= 0x18 && c <= 0x1F:
+			out.WriteRune(pdfDocEncodingLow[c-0x18])
+		case c >= 0x80 && c <= 0xA0:
+			out.WriteRune(pdfDocEncodingHigh[c-0x80])
+		default:
+			out.WriteRune(rune(c))
+		}
+	}
+	return out.String()
+}
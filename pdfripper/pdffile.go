@@ -0,0 +1,661 @@
+package pdfripper
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"sync"
+)
+
+// xrefEntry locates an object either at a byte offset in the file or at an
+// index inside a compressed object stream.
+type xrefEntry struct {
+	offset     int
+	compressed bool
+	stream     int
+	index      int
+}
+
+// pdfDoc is a parsed PDF file. Objects are loaded lazily and cached; all
+// methods are safe for concurrent use.
+type pdfDoc struct {
+	data    []byte
+	xref    map[int]xrefEntry
+	trailer pdfDict
+	crypt   *pdfCrypt
+	pages   []pdfPage
+
+	// How the cross-reference data was read, for Inspect.
+	xrefSections int  // Sections in the chain from startxref.
+	xrefStreams  bool // Some section is an xref stream.
+	repaired     bool // The table was rebuilt by reconstructXref.
+
+	mu      sync.Mutex
+	objects map[int]pdfObject
+	objStms map[int]*objStm
+	fonts   map[pdfRef]*pdfFont
+}
+
+// pdfPage is a leaf of the page tree with its inheritable attributes
+// already resolved.
+type pdfPage struct {
+	ref       pdfRef // The page object, if the tree refers to it indirectly.
+	dict      pdfDict
+	resources pdfDict
+	mediaBox  [4]float64
+	rotate    int
+}
+
+// objStm is a decoded object stream.
+type objStm struct {
+	data    []byte
+	offsets []int // object offsets relative to the start of data
+	nums    []int
+}
+
+// errPDFEncrypted is returned for documents whose user password is neither
+// empty nor the one SetPassword set.
+var errPDFEncrypted = errors.New("document is encrypted with a user password")
+
+// openPDFFile reads and parses a PDF file. Parser panics on malformed input
+// are turned into errors.
+func openPDFFile(pdfFile string) (doc *pdfDoc, err error) {
+	data, err := os.ReadFile(pdfFile)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			doc, err = nil, fmt.Errorf("parsing %s: %v", pdfFile, r)
+		}
+	}()
+	doc, err = openPDF(data)
+	if err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", pdfFile, err)
+	}
+	return doc, nil
+}
+
+// openPDF parses the cross-reference data and page tree of a PDF held in
+// memory. Damaged cross-reference tables are rebuilt by scanning the file.
+func openPDF(data []byte) (*pdfDoc, error) {
+	d, err := readPDFXref(data)
+	if err != nil {
+		return nil, err
+	}
+	if enc := d.resolveDict(d.trailer["Encrypt"]); enc != nil {
+		c, err := newPDFCrypt(d, enc)
+		if err != nil {
+			return nil, err
+		}
+		d.crypt = c
+		// Anything cached so far was read before decryption was set up.
+		d.objects = map[int]pdfObject{}
+		d.objStms = map[int]*objStm{}
+	}
+
+	if err := d.loadPages(); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// readPDFXref reads the cross-reference data of a PDF held in memory,
+// rebuilding it if it is damaged, without setting up decryption.
+func readPDFXref(data []byte) (*pdfDoc, error) {
+	d := newPDFDoc(data)
+	if err := d.loadXref(); err != nil || d.resolveDict(d.trailer["Root"]) == nil {
+		if err := d.reconstructXref(); err != nil {
+			return nil, err
+		}
+	}
+	return d, nil
+}
+
+// newPDFDoc returns a document holding data, with nothing read yet.
+func newPDFDoc(data []byte) *pdfDoc {
+	return &pdfDoc{
+		data:    data,
+		xref:    map[int]xrefEntry{},
+		objects: map[int]pdfObject{},
+		objStms: map[int]*objStm{},
+		fonts:   map[pdfRef]*pdfFont{},
+	}
+}
+
+// loadPages collects the leaves of the page tree.
+func (d *pdfDoc) loadPages() error {
+	root := d.resolveDict(d.trailer["Root"])
+	if root == nil {
+		return errors.New("document catalog not found")
+	}
+	d.collectPages(root["Pages"], nil, [4]float64{0, 0, 612, 792}, 0, map[pdfRef]bool{})
+	return nil
+}
+
+// loadXref follows the chain of cross-reference sections from startxref.
+// Newer sections are read first, so their entries win.
+func (d *pdfDoc) loadXref() error {
+	i := bytes.LastIndex(d.data, []byte("startxref"))
+	if i < 0 {
+		return errors.New("startxref not found")
+	}
+	l := &pdfLexer{data: d.data, pos: i + len("startxref")}
+	obj, err := l.readObject()
+	if err != nil {
+		return err
+	}
+	offset, ok := obj.(int)
+	if !ok {
+		return errors.New("invalid startxref offset")
+	}
+
+	seen := map[int]bool{}
+	for offset > 0 && offset < len(d.data) && !seen[offset] {
+		seen[offset] = true
+		trailer, err := d.readXrefSection(offset)
+		if err != nil {
+			if d.trailer != nil {
+				// Keep what the newer sections provided.
+				break
+			}
+			return err
+		}
+		d.xrefSections++
+		if d.trailer == nil {
+			d.trailer = trailer
+		}
+		// Hybrid files keep compressed objects in a separate xref stream.
+		if stm, ok := trailer["XRefStm"].(int); ok && !seen[stm] {
+			seen[stm] = true
+			d.readXrefSection(stm)
+		}
+		offset, _ = trailer["Prev"].(int)
+	}
+	if d.trailer == nil {
+		return errors.New("no trailer found")
+	}
+	return nil
+}
+
+// readXrefSection reads a classic xref table or an xref stream at offset
+// and returns its trailer dictionary.
+func (d *pdfDoc) readXrefSection(offset int) (pdfDict, error) {
+	l := &pdfLexer{data: d.data, pos: offset}
+	l.skipSpace()
+	if !l.hasPrefix("xref") {
+		return d.readXrefStream(offset)
+	}
+	l.pos += len("xref")
+	for {
+		obj, err := l.readObject()
+		if err != nil {
+			return nil, err
+		}
+		if kw, ok := obj.(pdfKeyword); ok && kw == "trailer" {
+			break
+		}
+		start, ok1 := obj.(int)
+		countObj, err := l.readObject()
+		count, ok2 := countObj.(int)
+		if err != nil || !ok1 || !ok2 {
+			return nil, errors.New("malformed xref subsection header")
+		}
+		for i := 0; i < count; i++ {
+			offObj, err := l.readObject()
+			l.readObject() // generation
+			kind, _ := l.readObject()
+			if err != nil {
+				// A count past the end of the file.
+				return nil, errors.New("truncated xref subsection")
+			}
+			off, _ := offObj.(int)
+			num := start + i
+			if _, exists := d.xref[num]; exists {
+				continue
+			}
+			switch kind {
+			case pdfKeyword("n"):
+				d.xref[num] = xrefEntry{offset: off}
+			case pdfKeyword("f"):
+				// Freed entries still shadow older sections.
+				d.xref[num] = xrefEntry{offset: -1}
+			}
+		}
+	}
+	obj, err := l.readObject()
+	if err != nil {
+		return nil, err
+	}
+	trailer, ok := obj.(pdfDict)
+	if !ok {
+		return nil, errors.New("malformed trailer")
+	}
+	return trailer, nil
+}
+
+func (d *pdfDoc) readXrefStream(offset int) (pdfDict, error) {
+	obj, _, err := d.parseIndirectAt(offset)
+	if err != nil {
+		return nil, err
+	}
+	s, ok := obj.(*pdfStream)
+	if !ok || d.resolveName(s.dict["Type"]) != "XRef" {
+		return nil, errors.New("xref stream not found at startxref offset")
+	}
+	d.xrefStreams = true
+	data, err := d.decodeStream(s)
+	if err != nil {
+		return nil, fmt.Errorf("decoding xref stream: %w", err)
+	}
+
+	w, _ := s.dict["W"].(pdfArray)
+	if len(w) < 3 {
+		return nil, errors.New("xref stream has invalid /W")
+	}
+	var widths [3]int
+	for i := range widths {
+		widths[i], _ = pdfInt(w[i])
+	}
+	index, _ := s.dict["Index"].(pdfArray)
+	if len(index) == 0 {
+		size, _ := pdfInt(s.dict["Size"])
+		index = pdfArray{0, size}
+	}
+
+	field := func(b []byte) int {
+		v := 0
+		for _, c := range b {
+			v = v<<8 | int(c)
+		}
+		return v
+	}
+	rowLen := widths[0] + widths[1] + widths[2]
+	pos := 0
+	for i := 0; i+1 < len(index); i += 2 {
+		start, _ := pdfInt(index[i])
+		count, _ := pdfInt(index[i+1])
+		for j := 0; j < count && pos+rowLen <= len(data); j++ {
+			row := data[pos : pos+rowLen]
+			pos += rowLen
+			kind := 1
+			if widths[0] > 0 {
+				kind = field(row[:widths[0]])
+			}
+			f2 := field(row[widths[0] : widths[0]+widths[1]])
+			f3 := field(row[widths[0]+widths[1]:])
+			num := start + j
+			if _, exists := d.xref[num]; exists {
+				continue
+			}
+			switch kind {
+			case 0:
+				d.xref[num] = xrefEntry{offset: -1}
+			case 1:
+				d.xref[num] = xrefEntry{offset: f2}
+			case 2:
+				d.xref[num] = xrefEntry{compressed: true, stream: f2, index: f3}
+			}
+		}
+	}
+	return s.dict, nil
+}
+
+var objHeaderRe = regexp.MustCompile(`(?:^|[^0-9])(\d+)[ \t\r\n\f\x00]+(\d+)[ \t\r\n\f\x00]+obj\b`)
+
+// reconstructXref rebuilds the cross-reference table by scanning the whole
+// file for "n g obj" headers, the way readers repair damaged files. Later
+// definitions of an object win, matching incremental updates.
+func (d *pdfDoc) reconstructXref() error {
+	d.xref = map[int]xrefEntry{}
+	d.trailer = nil
+	d.repaired = true
+	for _, m := range objHeaderRe.FindAllSubmatchIndex(d.data, -1) {
+		num, err := strconv.Atoi(string(d.data[m[2]:m[3]]))
+		if err != nil {
+			continue
+		}
+		d.xref[num] = xrefEntry{offset: m[2]}
+	}
+
+	// Prefer the last classic trailer that names a catalog.
+	for rest := d.data; ; {
+		i := bytes.LastIndex(rest, []byte("trailer"))
+		if i < 0 {
+			break
+		}
+		l := &pdfLexer{data: d.data, pos: i + len("trailer")}
+		if obj, err := l.readObject(); err == nil {
+			if t, ok := obj.(pdfDict); ok && t["Root"] != nil {
+				d.trailer = t
+				break
+			}
+		}
+		rest = rest[:i]
+	}
+
+	// Objects inside object streams are invisible to the scan above, and
+	// files using xref streams have no classic trailer.
+	d.objects = map[int]pdfObject{}
+	var catalog pdfObject
+	for num, e := range d.xref {
+		obj, _, err := d.parseIndirectAt(e.offset)
+		if err != nil {
+			continue
+		}
+		switch v := obj.(type) {
+		case *pdfStream:
+			switch d.resolveName(v.dict["Type"]) {
+			case "ObjStm":
+				if stm, err := d.loadObjStm(num); err == nil {
+					for idx, n := range stm.nums {
+						if _, exists := d.xref[n]; !exists {
+							d.xref[n] = xrefEntry{compressed: true, stream: num, index: idx}
+						}
+					}
+				}
+			case "XRef":
+				if d.trailer == nil && v.dict["Root"] != nil {
+					d.trailer = v.dict
+				}
+			}
+		case pdfDict:
+			if d.resolveName(v["Type"]) == "Catalog" {
+				catalog = pdfRef{num: num}
+			}
+		}
+	}
+	if d.trailer == nil {
+		if catalog == nil {
+			return errors.New("not a PDF file or too damaged to repair: no catalog found")
+		}
+		d.trailer = pdfDict{"Root": catalog}
+	}
+	d.objects = map[int]pdfObject{}
+	return nil
+}
+
+// parseIndirectAt parses the "num gen obj ... endobj" object at offset.
+func (d *pdfDoc) parseIndirectAt(offset int) (pdfObject, pdfRef, error) {
+	if offset < 0 || offset >= len(d.data) {
+		return nil, pdfRef{}, errors.New("object offset out of range")
+	}
+	l := &pdfLexer{data: d.data, pos: offset}
+	numObj, _ := l.readObject()
+	genObj, _ := l.readObject()
+	kw, _ := l.readObject()
+	num, ok1 := numObj.(int)
+	gen, ok2 := genObj.(int)
+	if !ok1 || !ok2 || kw != pdfKeyword("obj") {
+		return nil, pdfRef{}, fmt.Errorf("no object header at offset %d", offset)
+	}
+	ref := pdfRef{num: num, gen: gen}
+
+	obj, err := l.readObject()
+	if err != nil {
+		return nil, ref, err
+	}
+	dict, ok := obj.(pdfDict)
+	if !ok {
+		return obj, ref, nil
+	}
+	l.skipSpace()
+	if !l.hasPrefix("stream") {
+		return dict, ref, nil
+	}
+
+	l.pos += len("stream")
+	if l.hasPrefix("\r\n") {
+		l.pos += 2
+	} else if l.hasPrefix("\n") || l.hasPrefix("\r") {
+		l.pos++
+	}
+	start := l.pos
+	var raw []byte
+	if length, ok := d.streamLength(dict["Length"], num); ok && length >= 0 && start+length <= len(d.data) {
+		end := &pdfLexer{data: d.data, pos: start + length}
+		end.skipSpace()
+		if end.hasPrefix("endstream") {
+			raw = d.data[start : start+length]
+		}
+	}
+	if raw == nil {
+		raw = d.scanStreamEnd(start)
+	}
+	return &pdfStream{dict: dict, raw: raw, ref: ref}, ref, nil
+}
+
+// streamLength resolves a stream's /Length, guarding against a Length that
+// refers back to the stream's own object.
+func (d *pdfDoc) streamLength(obj pdfObject, self int) (int, bool) {
+	if ref, ok := obj.(pdfRef); ok {
+		if ref.num == self {
+			return 0, false
+		}
+		obj = d.resolve(ref)
+	}
+	return pdfInt(obj)
+}
+
+// scanStreamEnd finds stream data by searching for endstream, for streams
+// whose /Length is missing or wrong.
+func (d *pdfDoc) scanStreamEnd(start int) []byte {
+	i := bytes.Index(d.data[start:], []byte("endstream"))
+	if i < 0 {
+		return d.data[start:]
+	}
+	raw := d.data[start : start+i]
+	raw = bytes.TrimSuffix(raw, []byte("\n"))
+	raw = bytes.TrimSuffix(raw, []byte("\r"))
+	return raw
+}
+
+// resolve follows indirect references until it reaches a direct object.
+// Missing objects resolve to nil (the PDF null object).
+func (d *pdfDoc) resolve(obj pdfObject) pdfObject {
+	for depth := 0; depth < 32; depth++ {
+		ref, ok := obj.(pdfRef)
+		if !ok {
+			return obj
+		}
+		obj = d.object(ref.num)
+	}
+	return nil
+}
+
+func (d *pdfDoc) resolveDict(obj pdfObject) pdfDict {
+	switch v := d.resolve(obj).(type) {
+	case pdfDict:
+		return v
+	case *pdfStream:
+		return v.dict
+	}
+	return nil
+}
+
+func (d *pdfDoc) resolveArray(obj pdfObject) pdfArray {
+	a, _ := d.resolve(obj).(pdfArray)
+	return a
+}
+
+func (d *pdfDoc) resolveName(obj pdfObject) pdfName {
+	n, _ := d.resolve(obj).(pdfName)
+	return n
+}
+
+func (d *pdfDoc) resolveStream(obj pdfObject) *pdfStream {
+	s, _ := d.resolve(obj).(*pdfStream)
+	return s
+}
+
+// object loads object num. The lock is not held while parsing, because
+// parsing may itself resolve other objects (such as a stream's /Length);
+// two goroutines racing on the same object just parse it twice.
+func (d *pdfDoc) object(num int) pdfObject {
+	d.mu.Lock()
+	obj, ok := d.objects[num]
+	d.mu.Unlock()
+	if ok {
+		return obj
+	}
+
+	obj = d.loadObject(num)
+
+	d.mu.Lock()
+	d.objects[num] = obj
+	d.mu.Unlock()
+	return obj
+}
+
+func (d *pdfDoc) loadObject(num int) pdfObject {
+	e, ok := d.xref[num]
+	if !ok || e.offset < 0 {
+		return nil
+	}
+	if e.compressed {
+		stm, err := d.loadObjStm(e.stream)
+		if err != nil || e.index >= len(stm.offsets) {
+			return nil
+		}
+		l := &pdfLexer{data: stm.data, pos: stm.offsets[e.index]}
+		obj, _ := l.readObject()
+		return obj
+	}
+	obj, ref, err := d.parseIndirectAt(e.offset)
+	if err != nil || ref.num != num {
+		return nil
+	}
+	if d.crypt != nil {
+		obj = d.crypt.decryptStrings(obj, ref)
+	}
+	return obj
+}
+
+func (d *pdfDoc) loadObjStm(num int) (*objStm, error) {
+	d.mu.Lock()
+	stm, ok := d.objStms[num]
+	d.mu.Unlock()
+	if ok {
+		return stm, nil
+	}
+
+	s := d.resolveStream(pdfRef{num: num})
+	if s == nil {
+		return nil, fmt.Errorf("object stream %d not found", num)
+	}
+	data, err := d.decodeStream(s)
+	if err != nil {
+		return nil, err
+	}
+	n, _ := pdfInt(d.resolve(s.dict["N"]))
+	first, _ := pdfInt(d.resolve(s.dict["First"]))
+	stm = &objStm{data: data}
+	l := &pdfLexer{data: data}
+	for i := 0; i < n; i++ {
+		numObj, _ := l.readObject()
+		offObj, _ := l.readObject()
+		objNum, ok1 := numObj.(int)
+		off, ok2 := offObj.(int)
+		if !ok1 || !ok2 || first+off > len(data) {
+			break
+		}
+		stm.nums = append(stm.nums, objNum)
+		stm.offsets = append(stm.offsets, first+off)
+	}
+
+	d.mu.Lock()
+	d.objStms[num] = stm
+	d.mu.Unlock()
+	return stm, nil
+}
+
+// collectPages flattens the page tree into d.pages, pushing inheritable
+// attributes down to the leaves. seen guards against cyclic trees, which
+// can only be formed through indirect references.
+func (d *pdfDoc) collectPages(node pdfObject, resources pdfDict, mediaBox [4]float64, rotate int, seen map[pdfRef]bool) {
+	ref, indirect := node.(pdfRef)
+	if indirect {
+		if seen[ref] {
+			return
+		}
+		seen[ref] = true
+	}
+	dict := d.resolveDict(node)
+	if dict == nil {
+		return
+	}
+
+	if r := d.resolveDict(dict["Resources"]); r != nil {
+		resources = r
+	}
+	if box, ok := d.rect(dict["MediaBox"]); ok {
+		mediaBox = box
+	}
+	if r, ok := pdfInt(d.resolve(dict["Rotate"])); ok {
+		rotate = r
+	}
+
+	kids := d.resolveArray(dict["Kids"])
+	if d.resolveName(dict["Type"]) == "Page" || (kids == nil && dict["Contents"] != nil) {
+		d.pages = append(d.pages, pdfPage{ref: ref, dict: dict, resources: resources, mediaBox: mediaBox, rotate: rotate})
+		return
+	}
+	for _, kid := range kids {
+		d.collectPages(kid, resources, mediaBox, rotate, seen)
+	}
+}
+
+// rect reads a rectangle array, normalizing it so that the first corner is
+// the lower left one.
+func (d *pdfDoc) rect(obj pdfObject) ([4]float64, bool) {
+	a := d.resolveArray(obj)
+	if len(a) != 4 {
+		return [4]float64{}, false
+	}
+	var r [4]float64
+	for i := range r {
+		v, ok := pdfFloat(d.resolve(a[i]))
+		if !ok {
+			return [4]float64{}, false
+		}
+		r[i] = v
+	}
+	if r[0] > r[2] {
+		r[0], r[2] = r[2], r[0]
+	}
+	if r[1] > r[3] {
+		r[1], r[3] = r[3], r[1]
+	}
+	return r, true
+}
+
+// pageContents returns the concatenated, decoded content streams of a page.
+func (d *pdfDoc) pageContents(p pdfPage) ([]byte, error) {
+	var streams []*pdfStream
+	switch c := d.resolve(p.dict["Contents"]).(type) {
+	case *pdfStream:
+		streams = append(streams, c)
+	case pdfArray:
+		for _, item := range c {
+			if s := d.resolveStream(item); s != nil {
+				streams = append(streams, s)
+			}
+		}
+	}
+	var buf bytes.Buffer
+	for _, s := range streams {
+		data, err := d.decodeStream(s)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(data)
+		// A page's content may be split between any two tokens, so a
+		// separator keeps the last token of one stream from running into
+		// the first token of the next.
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes(), nil
+}
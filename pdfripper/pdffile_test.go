@@ -0,0 +1,347 @@
+package pdfripper
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/md5"
+	"crypto/rc4"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/thnkr-one/pdfripper/pdfripper/paptest"
+)
+
+// The pages of the test document, as drawn and as the native backend
+// extracts them.
+var (
+	testPages = []string{"Hello, world!\nSecond line", "Page two", "Café – “quoted” (parens) \\backslash"}
+	testTexts = []string{"Hello, world!\nSecond line\n", "Page two\n", "Café – “quoted” (parens) \\backslash\n"}
+)
+
+// pdfTexts parses data and returns the text of each of its pages.
+func pdfTexts(t *testing.T, data []byte) ([]string, *pdfDoc) {
+	t.Helper()
+	d, err := openPDF(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	texts := make([]string, len(d.pages))
+	for i := range d.pages {
+		if texts[i], err = d.pageText(i, ""); err != nil {
+			t.Fatalf("page %d: %v", i+1, err)
+		}
+	}
+	return texts, d
+}
+
+func TestNativeExtract(t *testing.T) {
+	path := paptest.TempPDF(t, testPages...)
+	native, err := LookupBackend("native")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pages, err := Extract(context.Background(), path, WithBackend(native), WithOutputDir(t.TempDir()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pages) != len(testTexts) {
+		t.Fatalf("got %d pages, want %d", len(pages), len(testTexts))
+	}
+	for i, p := range pages {
+		if p.Page != i+1 || p.Text != testTexts[i] {
+			t.Errorf("page %d: got page %d %q, want %q", i+1, p.Page, p.Text, testTexts[i])
+		}
+	}
+}
+
+func TestPDFPageGeometry(t *testing.T) {
+	data := (&paptest.Document{Pages: []paptest.Page{
+		{Lines: []string{"Portrait"}},
+		{Lines: []string{"Landscape"}, Size: [2]float64{792, 612}},
+		{Lines: []string{"Rotated"}, Size: paptest.A4, Rotate: 90},
+	}}).Bytes()
+	texts, d := pdfTexts(t, data)
+	for i, want := range []struct {
+		text     string
+		mediaBox [4]float64
+		rotate   int
+	}{
+		{"Portrait\n", [4]float64{0, 0, 612, 792}, 0},
+		{"Landscape\n", [4]float64{0, 0, 792, 612}, 0},
+		{"Rotated\n", [4]float64{0, 0, 595, 842}, 90},
+	} {
+		p := d.pages[i]
+		if texts[i] != want.text || p.mediaBox != want.mediaBox || p.rotate != want.rotate {
+			t.Errorf("page %d: got %q, %v rotated %d; want %q, %v rotated %d", i+1, texts[i], p.mediaBox, p.rotate, want.text, want.mediaBox, want.rotate)
+		}
+	}
+}
+
+// streamLengthRe matches the /Length of a content stream paptest writes.
+var streamLengthRe = regexp.MustCompile(`<< /Length (\d+) >>`)
+
+// withStreamLengths returns data with each content stream's /Length
+// replaced by what length returns for it.
+func withStreamLengths(data []byte, length func(n int) string) []byte {
+	return streamLengthRe.ReplaceAllFunc(data, func(m []byte) []byte {
+		var n int
+		fmt.Sscanf(string(m), "<< /Length %d >>", &n)
+		return []byte("<< " + length(n) + " >>")
+	})
+}
+
+func TestPDFRepair(t *testing.T) {
+	good := paptest.TextPDF(testPages...)
+	xref := bytes.Index(good, []byte("\nxref\n")) + 1
+	startxref := bytes.Index(good, []byte("startxref"))
+	for _, tt := range []struct {
+		name     string
+		data     []byte
+		repaired bool
+	}{
+		{"intact", good, false},
+		// Cross-reference tables that cannot be read make the parser scan
+		// the file for objects.
+		{"truncated xref", good[:xref+len("xref\n0 5\n")+40], true},
+		{"truncated entries", append(append([]byte{}, good[:xref+len("xref\n0 10\n")+20]...), good[startxref:]...), true},
+		{"no xref", good[:xref], true},
+		{"xref count past the end", bytes.Replace(good, []byte("xref\n0 "), []byte("xref\n0 100000000000"), 1), true},
+		{"startxref past the end", bytes.Replace(good, good[startxref:], []byte("startxref\n999999\n%%EOF\n"), 1), true},
+		{"startxref into an object", bytes.Replace(good, good[startxref:], []byte("startxref\n20\n%%EOF\n"), 1), true},
+		{"garbage before the header", append([]byte("garbage\n"), good...), true},
+		// Stream lengths that are wrong make it look for endstream.
+		{"stream length too short", withStreamLengths(good, func(n int) string { return fmt.Sprintf("/Length %d", n-1) }), false},
+		{"stream length zero", withStreamLengths(good, func(n int) string { return fmt.Sprintf("/Length %0*d", len(strconv.Itoa(n)), 0) }), false},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			texts, d := pdfTexts(t, tt.data)
+			if d.repaired != tt.repaired {
+				t.Errorf("repaired = %v, want %v", d.repaired, tt.repaired)
+			}
+			if strings.Join(texts, "\f") != strings.Join(testTexts, "\f") {
+				t.Errorf("got pages %q, want %q", texts, testTexts)
+			}
+		})
+	}
+}
+
+func TestPDFStreamLengths(t *testing.T) {
+	good := paptest.TextPDF(testPages...)
+	// These move the objects after the streams, so the cross-reference
+	// table is rebuilt too, and the streams read again while it is.
+	for _, tt := range []struct {
+		name   string
+		length func(n int) string
+	}{
+		{"too long", func(n int) string { return fmt.Sprintf("/Length %d", n+500) }},
+		{"past the end", func(n int) string { return "/Length 99999999" }},
+		{"negative", func(int) string { return "/Length -1" }},
+		{"missing", func(int) string { return "" }},
+		{"not a number", func(int) string { return "/Length (ten)" }},
+		{"refers to itself", func(int) string { return "/Length 5 0 R" }},
+		{"refers to a missing object", func(int) string { return "/Length 99 0 R" }},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			texts, _ := pdfTexts(t, withStreamLengths(good, tt.length))
+			if strings.Join(texts, "\f") != strings.Join(testTexts, "\f") {
+				t.Errorf("got pages %q, want %q", texts, testTexts)
+			}
+		})
+	}
+}
+
+func TestPDFDamaged(t *testing.T) {
+	good := paptest.TextPDF(testPages...)
+	for _, tt := range []struct {
+		name string
+		data []byte
+		err  string
+	}{
+		{"empty", nil, "no catalog found"},
+		{"not a PDF", []byte("Just some text, not a PDF at all.\n"), "no catalog found"},
+		{"header only", good[:16], "no catalog found"},
+		{"catalog missing", bytes.Replace(good, []byte("/Root 1 0 R"), []byte("/Root 99 0 R"), 1), "document catalog not found"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := openPDF(tt.data); err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("got error %v, want one containing %q", err, tt.err)
+			}
+		})
+	}
+
+	// Cutting the file short anywhere may lose pages but must not panic.
+	for n := 0; n < len(good); n += 7 {
+		d, err := openPDF(good[:n])
+		if err != nil {
+			continue
+		}
+		for i := range d.pages {
+			d.pageText(i, "")
+		}
+	}
+}
+
+// objRe matches an object paptest writes, and its number.
+var objRe = regexp.MustCompile(`(?s)(\d+) 0 obj\n(.*?)\nendobj\n`)
+
+// encryptPDF returns a paptest document encrypted with the user password
+// by revision r of the standard security handler: 3, with 128-bit RC4, or
+// 6, with AES-256.
+func encryptPDF(t *testing.T, data []byte, password string, r int) []byte {
+	t.Helper()
+	id := []byte("0123456789abcdef")
+	var c *pdfCrypt
+	var enc string
+	switch r {
+	case 3:
+		o := bytes.Repeat([]byte("o"), 32)
+		c = &pdfCrypt{key: rc4FileKey([]byte(password), o, 0xFFFFFFFC, id, 3, 16, true)}
+		// Algorithm 5, which checkUserPassword undoes.
+		sum := md5.Sum(append(append([]byte(nil), passwordPadding...), id...))
+		u := sum[:]
+		for i := 0; i < 20; i++ {
+			k := make([]byte, len(c.key))
+			for j := range k {
+				k[j] = c.key[j] ^ byte(i)
+			}
+			rc, _ := rc4.NewCipher(k)
+			rc.XORKeyStream(u, u)
+		}
+		u = append(u, make([]byte, 16)...)
+		c.stmMethod = "RC4"
+		enc = fmt.Sprintf("<< /Filter /Standard /V 2 /R 3 /Length 128 /O <%x> /U <%x> /P -4 >>", o, u)
+	case 6:
+		c = &pdfCrypt{key: bytes.Repeat([]byte("k"), 32), stmMethod: "AESV3"}
+		vsalt, ksalt := []byte("validate"), []byte("keysalt!")
+		u := bytes.Join([][]byte{passwordHash([]byte(password), vsalt, nil, 6), vsalt, ksalt}, nil)
+		block, _ := aes.NewCipher(passwordHash([]byte(password), ksalt, nil, 6))
+		ue := make([]byte, 32)
+		cipher.NewCBCEncrypter(block, make([]byte, 16)).CryptBlocks(ue, c.key)
+		enc = fmt.Sprintf("<< /Filter /Standard /V 5 /R 6 /Length 256 /CF << /StdCF << /CFM /AESV3 /Length 32 >> >> /StmF /StdCF /StrF /StdCF "+
+			"/O <%x> /OE <%x> /U <%x> /UE <%x> /P -4 >>", bytes.Repeat([]byte("o"), 48), make([]byte, 32), u, ue)
+	}
+	encrypt := func(num int, content []byte) []byte {
+		if c.stmMethod == "RC4" {
+			out, _ := c.decrypt(content, pdfRef{num: num}, "RC4")
+			return out
+		}
+		block, _ := aes.NewCipher(c.key)
+		pad := aes.BlockSize - len(content)%aes.BlockSize
+		body := append(append([]byte(nil), content...), bytes.Repeat([]byte{byte(pad)}, pad)...)
+		out := append(bytes.Repeat([]byte("i"), 16), make([]byte, len(body))...)
+		cipher.NewCBCEncrypter(block, out[:16]).CryptBlocks(out[16:], body)
+		return out
+	}
+
+	var b bytes.Buffer
+	b.WriteString("%PDF-1.7\n")
+	var offsets []int
+	for _, m := range objRe.FindAllSubmatch(data, -1) {
+		num, _ := strconv.Atoi(string(m[1]))
+		obj := m[2]
+		if _, rest, ok := bytes.Cut(obj, []byte("\nstream\n")); ok {
+			content := encrypt(num, bytes.TrimSuffix(rest, []byte("\nendstream")))
+			obj = fmt.Appendf(nil, "<< /Length %d >>\nstream\n%s\nendstream", len(content), content)
+		}
+		offsets = append(offsets, b.Len())
+		fmt.Fprintf(&b, "%d 0 obj\n%s\nendobj\n", num, obj)
+	}
+	offsets = append(offsets, b.Len())
+	fmt.Fprintf(&b, "%d 0 obj\n%s\nendobj\n", len(offsets), enc)
+	xref := b.Len()
+	fmt.Fprintf(&b, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&b, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&b, "trailer\n<< /Size %d /Root 1 0 R /Encrypt %d 0 R /ID [<%x> <%x>] >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, len(offsets), id, id, xref)
+	return b.Bytes()
+}
+
+func TestPDFPassword(t *testing.T) {
+	defer SetPassword("")
+	for _, r := range []int{3, 6} {
+		data := encryptPDF(t, paptest.TextPDF(testPages...), "s3cret", r)
+		for _, tt := range []struct {
+			password string
+			ok       bool
+		}{
+			{"", false},
+			{"wrong", false},
+			{"s3cret", true},
+		} {
+			t.Run(fmt.Sprintf("revision %d, password %q", r, tt.password), func(t *testing.T) {
+				SetPassword(tt.password)
+				if !tt.ok {
+					if _, err := openPDF(data); !errors.Is(err, errPDFEncrypted) {
+						t.Errorf("got error %v, want errPDFEncrypted", err)
+					}
+					return
+				}
+				texts, d := pdfTexts(t, data)
+				if d.repaired {
+					t.Error("the document was repaired")
+				}
+				if strings.Join(texts, "\f") != strings.Join(testTexts, "\f") {
+					t.Errorf("got pages %q, want %q", texts, testTexts)
+				}
+			})
+		}
+	}
+}
+
+func TestNativeBackendErrors(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "test.pdf")
+	if err := os.WriteFile(path, paptest.TextPDF(testPages...), 0644); err != nil {
+		t.Fatal(err)
+	}
+	b := &nativeBackend{}
+	if n, err := b.PageCount(path); err != nil || n != 3 {
+		t.Fatalf("PageCount = %d, %v; want 3", n, err)
+	}
+	for _, page := range []int{0, 4} {
+		if _, err := b.ExtractPage(path, page); err == nil || !strings.Contains(err.Error(), "out of range") {
+			t.Errorf("page %d: got error %v, want it out of range", page, err)
+		}
+	}
+	if _, err := b.PageCount(filepath.Join(dir, "missing.pdf")); !os.IsNotExist(err) {
+		t.Errorf("missing file: got error %v, want it not to exist", err)
+	}
+
+	// The parsed document is kept only while the file is unchanged.
+	if err := os.WriteFile(path, paptest.TextPDF("Only page, now longer"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if text, err := b.ExtractPage(path, 1); err != nil || text != "Only page, now longer\n" {
+		t.Errorf("after rewriting the file, page 1 = %q, %v", text, err)
+	}
+}
+
+// FuzzExtract parses arbitrary bytes as a PDF and extracts the text of
+// its pages. Parsing may fail, but must not panic or hang; the backend
+// recovers from panics only as a last resort.
+func FuzzExtract(f *testing.F) {
+	good := paptest.TextPDF(testPages...)
+	f.Add(good)
+	f.Add((&paptest.Document{Title: "Fuzz", Pages: []paptest.Page{{Lines: []string{"Rotated"}, Rotate: 270}, {}}}).Bytes())
+	f.Add(good[:bytes.Index(good, []byte("\nxref\n"))+20])
+	f.Add(withStreamLengths(good, func(n int) string { return fmt.Sprintf("/Length %d", n+500) }))
+	f.Add(withStreamLengths(good, func(int) string { return "/Length 5 0 R" }))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		d, err := openPDF(data)
+		if err != nil {
+			return
+		}
+		for i := range d.pages {
+			d.pageText(i, "")
+		}
+	})
+}
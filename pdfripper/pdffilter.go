@@ -0,0 +1,353 @@
+package pdfripper
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// decodeStream returns the decoded contents of s, decrypting it first if the
+// document is encrypted and then applying its filters in order. Image-only
+// filters (DCTDecode, JPXDecode, ...) are reported as unsupported.
+func (d *pdfDoc) decodeStream(s *pdfStream) ([]byte, error) {
+	data := s.raw
+	if d.crypt != nil && d.resolveName(s.dict["Type"]) != "XRef" {
+		var err error
+		if data, err = d.crypt.decryptStream(s); err != nil {
+			return nil, err
+		}
+	}
+
+	filterObj := d.resolve(s.dict["Filter"])
+	if filterObj == nil {
+		filterObj = d.resolve(s.dict["F"])
+	}
+	parmsObj := d.resolve(s.dict["DecodeParms"])
+	if parmsObj == nil {
+		parmsObj = d.resolve(s.dict["DP"])
+	}
+
+	var filters []pdfName
+	var parms []pdfDict
+	switch f := filterObj.(type) {
+	case pdfName:
+		filters = []pdfName{f}
+		p, _ := parmsObj.(pdfDict)
+		parms = []pdfDict{p}
+	case pdfArray:
+		pa, _ := parmsObj.(pdfArray)
+		for i, item := range f {
+			name, _ := d.resolve(item).(pdfName)
+			filters = append(filters, name)
+			var p pdfDict
+			if i < len(pa) {
+				p, _ = d.resolve(pa[i]).(pdfDict)
+			}
+			parms = append(parms, p)
+		}
+	}
+
+	for i, f := range filters {
+		var err error
+		switch f {
+		case "FlateDecode", "Fl":
+			if data, err = flateDecode(data); err == nil {
+				data, err = d.unpredict(data, parms[i])
+			}
+		case "LZWDecode", "LZW":
+			early := 1
+			if v, ok := pdfInt(d.resolve(parms[i]["EarlyChange"])); ok {
+				early = v
+			}
+			if data, err = lzwDecode(data, early == 1); err == nil {
+				data, err = d.unpredict(data, parms[i])
+			}
+		case "ASCIIHexDecode", "AHx":
+			data = asciiHexDecode(data)
+		case "ASCII85Decode", "A85":
+			data, err = ascii85Decode(data)
+		case "RunLengthDecode", "RL":
+			data = runLengthDecode(data)
+		case "Crypt":
+			// Only the Identity crypt filter can appear here; the security
+			// handler has already decrypted the data.
+		default:
+			return nil, fmt.Errorf("unsupported stream filter %s", f)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", f, err)
+		}
+	}
+	return data, nil
+}
+
+// flateDecode inflates zlib data. Streams that are truncated or carry a bad
+// checksum are common in the wild, so whatever could be inflated is kept.
+func flateDecode(data []byte) ([]byte, error) {
+	zr, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		// Some producers omit the zlib header and write raw deflate data.
+		out, rerr := io.ReadAll(flate.NewReader(bytes.NewReader(data)))
+		if len(out) > 0 {
+			return out, nil
+		}
+		if rerr != nil {
+			return nil, err
+		}
+		return out, nil
+	}
+	out, err := io.ReadAll(zr)
+	if err != nil && len(out) == 0 {
+		return nil, err
+	}
+	return out, nil
+}
+
+// unpredict reverses the PNG and TIFF predictors described by parms.
+func (d *pdfDoc) unpredict(data []byte, parms pdfDict) ([]byte, error) {
+	if parms == nil {
+		return data, nil
+	}
+	param := func(key pdfName, def int) int {
+		if v, ok := pdfInt(d.resolve(parms[key])); ok {
+			return v
+		}
+		return def
+	}
+	predictor := param("Predictor", 1)
+	if predictor == 1 {
+		return data, nil
+	}
+	colors := param("Colors", 1)
+	bpc := param("BitsPerComponent", 8)
+	columns := param("Columns", 1)
+	bpp := max(colors*bpc/8, 1)
+	rowLen := (colors*bpc*columns + 7) / 8
+	if rowLen <= 0 {
+		return nil, errors.New("invalid predictor parameters")
+	}
+
+	if predictor == 2 {
+		if bpc != 8 {
+			return nil, fmt.Errorf("unsupported TIFF predictor with %d bits per component", bpc)
+		}
+		out := append([]byte(nil), data...)
+		for row := 0; row+rowLen <= len(out); row += rowLen {
+			for i := bpp; i < rowLen; i++ {
+				out[row+i] += out[row+i-bpp]
+			}
+		}
+		return out, nil
+	}
+
+	// PNG predictors: every row is prefixed with its own filter type byte.
+	var out []byte
+	prev := make([]byte, rowLen)
+	for len(data) > 0 {
+		filter := data[0]
+		n := min(rowLen, len(data)-1)
+		row := make([]byte, rowLen)
+		copy(row, data[1:1+n])
+		data = data[1+n:]
+		for i := 0; i < rowLen; i++ {
+			var left, upLeft byte
+			if i >= bpp {
+				left, upLeft = row[i-bpp], prev[i-bpp]
+			}
+			up := prev[i]
+			switch filter {
+			case 1:
+				row[i] += left
+			case 2:
+				row[i] += up
+			case 3:
+				row[i] += byte((int(left) + int(up)) / 2)
+			case 4:
+				row[i] += paeth(left, up, upLeft)
+			}
+		}
+		out = append(out, row[:n]...)
+		prev = row
+	}
+	return out, nil
+}
+
+func paeth(a, b, c byte) byte {
+	p := int(a) + int(b) - int(c)
+	pa, pb, pc := abs(p-int(a)), abs(p-int(b)), abs(p-int(c))
+	switch {
+	case pa <= pb && pa <= pc:
+		return a
+	case pb <= pc:
+		return b
+	}
+	return c
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+func asciiHexDecode(data []byte) []byte {
+	var out []byte
+	var hi byte
+	half := false
+	for _, c := range data {
+		if c == '>' {
+			break
+		}
+		v, ok := unhex(c)
+		if !ok {
+			continue
+		}
+		if half {
+			out = append(out, hi<<4|v)
+		} else {
+			hi = v
+		}
+		half = !half
+	}
+	if half {
+		out = append(out, hi<<4)
+	}
+	return out
+}
+
+func ascii85Decode(data []byte) ([]byte, error) {
+	data = bytes.TrimPrefix(bytes.TrimSpace(data), []byte("<~"))
+	var out []byte
+	var group [5]byte
+	n := 0
+	flush := func(count int) {
+		var v uint32
+		for i := 0; i < 5; i++ {
+			v = v*85 + uint32(group[i]-'!')
+		}
+		b := [4]byte{byte(v >> 24), byte(v >> 16), byte(v >> 8), byte(v)}
+		out = append(out, b[:count]...)
+	}
+	for i := 0; i < len(data); i++ {
+		c := data[i]
+		switch {
+		case c == '~':
+			i = len(data)
+			continue
+		case c == 'z' && n == 0:
+			out = append(out, 0, 0, 0, 0)
+			continue
+		case isPDFSpace(c):
+			continue
+		case c < '!' || c > 'u':
+			return out, fmt.Errorf("invalid character %q", c)
+		}
+		group[n] = c
+		n++
+		if n == 5 {
+			flush(4)
+			n = 0
+		}
+	}
+	if n > 0 {
+		for i := n; i < 5; i++ {
+			group[i] = 'u'
+		}
+		flush(n - 1)
+	}
+	return out, nil
+}
+
+// lzwDecode implements the LZW variant used by PDF: MSB-first codes of 9 to
+// 12 bits, with the code width growing one code early unless earlyChange is
+// false.
+func lzwDecode(data []byte, earlyChange bool) ([]byte, error) {
+	const clearCode, eodCode = 256, 257
+	early := 0
+	if earlyChange {
+		early = 1
+	}
+
+	var out []byte
+	var table [][]byte
+	reset := func() {
+		table = table[:0]
+		for i := 0; i < 256; i++ {
+			table = append(table, []byte{byte(i)})
+		}
+		table = append(table, nil, nil) // clear and EOD
+	}
+	reset()
+
+	var bitBuf uint32
+	bitCount := 0
+	width := 9
+	var prev []byte
+	for pos := 0; ; {
+		for bitCount < width && pos < len(data) {
+			bitBuf = bitBuf<<8 | uint32(data[pos])
+			bitCount += 8
+			pos++
+		}
+		if bitCount < width {
+			return out, nil
+		}
+		code := int(bitBuf>>(bitCount-width)) & (1<<width - 1)
+		bitCount -= width
+
+		switch {
+		case code == clearCode:
+			reset()
+			width, prev = 9, nil
+			continue
+		case code == eodCode:
+			return out, nil
+		}
+
+		var entry []byte
+		switch {
+		case code < len(table):
+			entry = table[code]
+			if prev != nil && len(table) < 4096 {
+				table = append(table, append(append([]byte(nil), prev...), entry[0]))
+			}
+		case code == len(table) && prev != nil:
+			entry = append(append([]byte(nil), prev...), prev[0])
+			table = append(table, entry)
+		default:
+			return out, fmt.Errorf("invalid code %d", code)
+		}
+		out = append(out, entry...)
+		prev = entry
+
+		if len(table)+early >= 1<<width && width < 12 {
+			width++
+		}
+	}
+}
+
+func runLengthDecode(data []byte) []byte {
+	var out []byte
+	for i := 0; i < len(data); {
+		n := int(data[i])
+		i++
+		switch {
+		case n == 128:
+			return out
+		case n < 128:
+			end := min(i+n+1, len(data))
+			out = append(out, data[i:end]...)
+			i = end
+		default:
+			if i < len(data) {
+				out = append(out, bytes.Repeat(data[i:i+1], 257-n)...)
+				i++
+			}
+		}
+	}
+	return out
+}
@@ -0,0 +1,363 @@
+package pdfripper
+
+import (
+	"bytes"
+	"errors"
+	"strconv"
+)
+
+// This file holds the object model and tokenizer of the native backend's
+// PDF parser. Only what text extraction needs is implemented.
+
+type (
+	pdfObject  any
+	pdfName    string // name object, without the leading slash
+	pdfString  string // literal or hex string, as raw bytes
+	pdfKeyword string // bare word: obj, stream, R, or a content stream operator
+	pdfArray   []pdfObject
+	pdfDict    map[pdfName]pdfObject
+)
+
+// pdfRef is an indirect object reference.
+type pdfRef struct {
+	num, gen int
+}
+
+// pdfStream is a stream object. raw holds the still-encoded bytes.
+type pdfStream struct {
+	dict pdfDict
+	raw  []byte
+	ref  pdfRef // the object that contains the stream, for decryption
+}
+
+var errPDFEOF = errors.New("unexpected end of PDF data")
+
+func isPDFSpace(c byte) bool {
+	return c == 0 || c == '\t' || c == '\n' || c == '\f' || c == '\r' || c == ' '
+}
+
+func isPDFDelim(c byte) bool {
+	switch c {
+	case '(', ')', '<', '>', '[', ']', '{', '}', '/', '%':
+		return true
+	}
+	return false
+}
+
+// pdfLexer reads objects from PDF syntax: file bodies, object streams,
+// content streams, and CMaps all share it.
+type pdfLexer struct {
+	data []byte
+	pos  int
+	// content disables indirect reference parsing, which never occurs in
+	// content streams and would only cost lookahead.
+	content bool
+}
+
+func (l *pdfLexer) skipSpace() {
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		switch {
+		case isPDFSpace(c):
+			l.pos++
+		case c == '%':
+			for l.pos < len(l.data) && l.data[l.pos] != '\n' && l.data[l.pos] != '\r' {
+				l.pos++
+			}
+		default:
+			return
+		}
+	}
+}
+
+// hasPrefix reports whether the unread input starts with s.
+func (l *pdfLexer) hasPrefix(s string) bool {
+	return bytes.HasPrefix(l.data[l.pos:], []byte(s))
+}
+
+// readToken returns the run of regular characters at the current position.
+func (l *pdfLexer) readToken() string {
+	start := l.pos
+	for l.pos < len(l.data) && !isPDFSpace(l.data[l.pos]) && !isPDFDelim(l.data[l.pos]) {
+		l.pos++
+	}
+	return string(l.data[start:l.pos])
+}
+
+// readObject reads the next object. Bare words come back as pdfKeyword,
+// including stray delimiters, so callers can detect operators and the end
+// of malformed structures.
+func (l *pdfLexer) readObject() (pdfObject, error) {
+	l.skipSpace()
+	if l.pos >= len(l.data) {
+		return nil, errPDFEOF
+	}
+	c := l.data[l.pos]
+	switch {
+	case c == '/':
+		return l.readName(), nil
+	case c == '(':
+		return l.readLiteralString(), nil
+	case c == '<':
+		if l.hasPrefix("<<") {
+			return l.readDict()
+		}
+		return l.readHexString(), nil
+	case c == '[':
+		return l.readArray()
+	case c == ')' || c == '>' || c == ']' || c == '{' || c == '}':
+		l.pos++
+		if c == '>' && l.pos < len(l.data) && l.data[l.pos] == '>' {
+			l.pos++
+			return pdfKeyword(">>"), nil
+		}
+		return pdfKeyword(string(c)), nil
+	case c == '+' || c == '-' || c == '.' || (c >= '0' && c <= '9'):
+		return l.readNumber(), nil
+	}
+	tok := l.readToken()
+	switch tok {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	case "null":
+		return nil, nil
+	}
+	return pdfKeyword(tok), nil
+}
+
+func (l *pdfLexer) readNumber() pdfObject {
+	tok := l.readToken()
+	n, err := strconv.Atoi(tok)
+	if err != nil {
+		f, err := strconv.ParseFloat(tok, 64)
+		if err != nil {
+			// Malformed numbers such as "--5" or "1.2.3" are treated as zero,
+			// as most readers do.
+			return 0
+		}
+		return f
+	}
+	if l.content || n < 0 {
+		return n
+	}
+
+	// An integer may be the start of an indirect reference "num gen R".
+	save := l.pos
+	l.skipSpace()
+	genTok := l.readToken()
+	if gen, err := strconv.Atoi(genTok); err == nil && genTok != "" {
+		l.skipSpace()
+		if l.pos < len(l.data) && l.data[l.pos] == 'R' &&
+			(l.pos+1 == len(l.data) || isPDFSpace(l.data[l.pos+1]) || isPDFDelim(l.data[l.pos+1])) {
+			l.pos++
+			return pdfRef{num: n, gen: gen}
+		}
+	}
+	l.pos = save
+	return n
+}
+
+func (l *pdfLexer) readName() pdfName {
+	l.pos++ // '/'
+	tok := l.readToken()
+	if !bytes.ContainsRune([]byte(tok), '#') {
+		return pdfName(tok)
+	}
+	var b []byte
+	for i := 0; i < len(tok); i++ {
+		if tok[i] == '#' && i+2 < len(tok) {
+			if v, err := strconv.ParseUint(tok[i+1:i+3], 16, 8); err == nil {
+				b = append(b, byte(v))
+				i += 2
+				continue
+			}
+		}
+		b = append(b, tok[i])
+	}
+	return pdfName(b)
+}
+
+func (l *pdfLexer) readLiteralString() pdfString {
+	l.pos++ // '('
+	var b []byte
+	depth := 1
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		l.pos++
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return pdfString(b)
+			}
+		case '\r':
+			// An unescaped end-of-line of any kind reads as a single newline.
+			if l.pos < len(l.data) && l.data[l.pos] == '\n' {
+				l.pos++
+			}
+			c = '\n'
+		case '\\':
+			if l.pos >= len(l.data) {
+				return pdfString(b)
+			}
+			c = l.data[l.pos]
+			l.pos++
+			switch c {
+			case 'n':
+				c = '\n'
+			case 'r':
+				c = '\r'
+			case 't':
+				c = '\t'
+			case 'b':
+				c = '\b'
+			case 'f':
+				c = '\f'
+			case '\r':
+				if l.pos < len(l.data) && l.data[l.pos] == '\n' {
+					l.pos++
+				}
+				continue
+			case '\n':
+				continue
+			default:
+				if c >= '0' && c <= '7' {
+					v := int(c - '0')
+					for i := 0; i < 2 && l.pos < len(l.data) && l.data[l.pos] >= '0' && l.data[l.pos] <= '7'; i++ {
+						v = v*8 + int(l.data[l.pos]-'0')
+						l.pos++
+					}
+					c = byte(v)
+				}
+			}
+		}
+		b = append(b, c)
+	}
+	return pdfString(b)
+}
+
+func (l *pdfLexer) readHexString() pdfString {
+	l.pos++ // '<'
+	var b []byte
+	var hi byte
+	half := false
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		l.pos++
+		if c == '>' {
+			break
+		}
+		v, ok := unhex(c)
+		if !ok {
+			continue
+		}
+		if half {
+			b = append(b, hi<<4|v)
+		} else {
+			hi = v
+		}
+		half = !half
+	}
+	if half {
+		b = append(b, hi<<4)
+	}
+	return pdfString(b)
+}
+
+func unhex(c byte) (byte, bool) {
+	switch {
+	case c >= '0' && c <= '9':
+		return c - '0', true
+	case c >= 'a' && c <= 'f':
+		return c - 'a' + 10, true
+	case c >= 'A' && c <= 'F':
+		return c - 'A' + 10, true
+	}
+	return 0, false
+}
+
+func (l *pdfLexer) readArray() (pdfArray, error) {
+	l.pos++ // '['
+	var arr pdfArray
+	for {
+		l.skipSpace()
+		if l.pos >= len(l.data) {
+			return arr, errPDFEOF
+		}
+		if l.data[l.pos] == ']' {
+			l.pos++
+			return arr, nil
+		}
+		obj, err := l.readObject()
+		if err != nil {
+			return arr, err
+		}
+		if kw, ok := obj.(pdfKeyword); ok && (kw == ">>" || kw == "endobj") {
+			// Unterminated array; stop before swallowing the enclosing object.
+			return arr, nil
+		}
+		arr = append(arr, obj)
+	}
+}
+
+func (l *pdfLexer) readDict() (pdfDict, error) {
+	l.pos += 2 // "<<"
+	d := pdfDict{}
+	for {
+		l.skipSpace()
+		if l.pos >= len(l.data) {
+			return d, errPDFEOF
+		}
+		if l.hasPrefix(">>") {
+			l.pos += 2
+			return d, nil
+		}
+		key, err := l.readObject()
+		if err != nil {
+			return d, err
+		}
+		name, ok := key.(pdfName)
+		if !ok {
+			if kw, ok := key.(pdfKeyword); ok && kw == "endobj" {
+				return d, nil
+			}
+			continue // skip junk between entries
+		}
+		l.skipSpace()
+		if l.hasPrefix(">>") {
+			d[name] = nil
+			continue
+		}
+		val, err := l.readObject()
+		if err != nil {
+			return d, err
+		}
+		d[name] = val
+	}
+}
+
+// pdfInt converts a numeric object to an int.
+func pdfInt(obj pdfObject) (int, bool) {
+	switch v := obj.(type) {
+	case int:
+		return v, true
+	case float64:
+		return int(v), true
+	}
+	return 0, false
+}
+
+// pdfFloat converts a numeric object to a float64.
+func pdfFloat(obj pdfObject) (float64, bool) {
+	switch v := obj.(type) {
+	case int:
+		return float64(v), true
+	case float64:
+		return v, true
+	}
+	return 0, false
+}
@@ -0,0 +1,885 @@
+package pdfripper
+
+import (
+	"bytes"
+	"math"
+	"strings"
+	"unicode/utf16"
+)
+
+// This file turns page content streams into text for the native backend.
+// Text is emitted in content stream order, which is reading order for
+// nearly all producers; line breaks and spaces are inferred from the
+// positions at which consecutive strings are drawn.
+
+// matrix is a PDF transformation matrix [a b c d e f].
+type matrix [6]float64
+
+var identityMatrix = matrix{1, 0, 0, 1, 0, 0}
+
+// mul returns m × n.
+func (m matrix) mul(n matrix) matrix {
+	return matrix{
+		m[0]*n[0] + m[1]*n[2],
+		m[0]*n[1] + m[1]*n[3],
+		m[2]*n[0] + m[3]*n[2],
+		m[2]*n[1] + m[3]*n[3],
+		m[4]*n[0] + m[5]*n[2] + n[4],
+		m[4]*n[1] + m[5]*n[3] + n[5],
+	}
+}
+
+func translate(tx, ty float64) matrix { return matrix{1, 0, 0, 1, tx, ty} }
+
+// codespaceRange is one entry of a CMap codespace: codes of n bytes
+// between lo and hi.
+type codespaceRange struct {
+	n      int
+	lo, hi uint32
+}
+
+// cidRange maps the codes lo..hi to consecutive CIDs starting at cid.
+type cidRange struct {
+	lo, hi, cid uint32
+}
+
+// cmap is a parsed CMap, either a ToUnicode map or a font encoding.
+type cmap struct {
+	codespace []codespaceRange
+	unicode   map[uint32]string
+	cids      []cidRange
+	vertical  bool // /WMode 1
+}
+
+// parseCMap reads the operators of a CMap program that matter for text
+// extraction. Unknown constructs are skipped.
+func parseCMap(data []byte) *cmap {
+	cm := &cmap{unicode: map[uint32]string{}}
+	l := &pdfLexer{data: data, content: true}
+	readUntil := func(end pdfKeyword, n int, fn func(args []pdfObject)) {
+		var args []pdfObject
+		for {
+			obj, err := l.readObject()
+			if err != nil || obj == end {
+				return
+			}
+			args = append(args, obj)
+			if len(args) == n {
+				fn(args)
+				args = args[:0]
+			}
+		}
+	}
+	for {
+		obj, err := l.readObject()
+		if err != nil {
+			return cm
+		}
+		if obj == pdfName("WMode") {
+			if obj, err = l.readObject(); err == nil {
+				v, _ := pdfInt(obj)
+				cm.vertical = v == 1
+			}
+			continue
+		}
+		kw, ok := obj.(pdfKeyword)
+		if !ok {
+			continue
+		}
+		switch kw {
+		case "begincodespacerange":
+			readUntil("endcodespacerange", 2, func(a []pdfObject) {
+				lo, _ := a[0].(pdfString)
+				hi, _ := a[1].(pdfString)
+				if len(lo) > 0 && len(lo) == len(hi) {
+					cm.codespace = append(cm.codespace, codespaceRange{len(lo), codeValue(lo), codeValue(hi)})
+				}
+			})
+		case "beginbfchar":
+			readUntil("endbfchar", 2, func(a []pdfObject) {
+				src, _ := a[0].(pdfString)
+				switch dst := a[1].(type) {
+				case pdfString:
+					cm.unicode[codeValue(src)] = utf16BEString([]byte(dst))
+				case pdfName:
+					cm.unicode[codeValue(src)] = glyphRune(string(dst))
+				}
+			})
+		case "beginbfrange":
+			readUntil("endbfrange", 3, func(a []pdfObject) {
+				lo, _ := a[0].(pdfString)
+				hi, _ := a[1].(pdfString)
+				from, to := codeValue(lo), codeValue(hi)
+				if to < from || to-from > 0xFFFF {
+					return
+				}
+				switch dst := a[2].(type) {
+				case pdfString:
+					base := []byte(dst)
+					for code := from; code <= to; code++ {
+						cm.unicode[code] = utf16BEString(addToLastBytes(base, code-from))
+					}
+				case pdfArray:
+					for i, item := range dst {
+						if s, ok := item.(pdfString); ok && from+uint32(i) <= to {
+							cm.unicode[from+uint32(i)] = utf16BEString([]byte(s))
+						}
+					}
+				}
+			})
+		case "begincidrange":
+			readUntil("endcidrange", 3, func(a []pdfObject) {
+				lo, _ := a[0].(pdfString)
+				hi, _ := a[1].(pdfString)
+				cid, _ := pdfInt(a[2])
+				cm.cids = append(cm.cids, cidRange{codeValue(lo), codeValue(hi), uint32(cid)})
+				if len(cm.codespace) == 0 && len(lo) > 0 {
+					cm.codespace = append(cm.codespace, codespaceRange{len(lo), 0, 1<<(8*len(lo)) - 1})
+				}
+			})
+		case "begincidchar":
+			readUntil("endcidchar", 2, func(a []pdfObject) {
+				code, _ := a[0].(pdfString)
+				cid, _ := pdfInt(a[1])
+				cm.cids = append(cm.cids, cidRange{codeValue(code), codeValue(code), uint32(cid)})
+			})
+		}
+	}
+}
+
+func codeValue(b pdfString) uint32 {
+	var v uint32
+	for i := 0; i < len(b); i++ {
+		v = v<<8 | uint32(b[i])
+	}
+	return v
+}
+
+// addToLastBytes adds n to a big-endian byte string, as bfrange requires
+// when a destination string is incremented for each code in the range.
+func addToLastBytes(b []byte, n uint32) []byte {
+	out := append([]byte(nil), b...)
+	carry := n
+	for i := len(out) - 1; i >= 0 && carry > 0; i-- {
+		sum := uint32(out[i]) + carry
+		out[i] = byte(sum)
+		carry = sum >> 8
+	}
+	return out
+}
+
+func utf16BEString(b []byte) string {
+	if len(b)%2 == 1 {
+		return string(rune(b[0]))
+	}
+	u := make([]uint16, len(b)/2)
+	for i := range u {
+		u[i] = uint16(b[2*i])<<8 | uint16(b[2*i+1])
+	}
+	return string(utf16.Decode(u))
+}
+
+// pdfFont is what the text extractor needs of a font: how to split strings
+// into character codes, what Unicode text each code stands for, and how far
+// each glyph advances.
+type pdfFont struct {
+	composite    bool
+	codespace    []codespaceRange // composite fonts only
+	cids         []cidRange       // nil means CID == code (Identity)
+	ucs2         bool             // codes are UTF-16BE (Uni*-UCS2/UTF16 CMaps)
+	toUnicode    map[uint32]string
+	encoding     [256]string // simple fonts only
+	widths       map[uint32]float64
+	defaultWidth float64
+	widthScale   float64 // glyph space to text space: 1/1000, or FontMatrix[0] for Type 3
+	vertical     bool    // composite fonts in writing mode 1, which advance down the page
+	advanceY     float64 // vertical displacement of every glyph (DW2), in glyph space
+	math         bool    // a math font, by its name; see isMathFont
+}
+
+type glyph struct {
+	code  uint32
+	text  string
+	width float64 // in text space units, before font size scaling
+	space bool    // single-byte code 32, which word spacing applies to
+}
+
+func (f *pdfFont) decode(s []byte) []glyph {
+	var glyphs []glyph
+	for len(s) > 0 {
+		n := 1
+		if f.composite {
+			n = f.codeLength(s)
+		}
+		var code uint32
+		for _, c := range s[:n] {
+			code = code<<8 | uint32(c)
+		}
+		s = s[n:]
+		g := glyph{code: code, text: f.text(code, n), space: n == 1 && code == 32}
+		g.width = f.width(code) * f.widthScale
+		glyphs = append(glyphs, g)
+	}
+	return glyphs
+}
+
+func (f *pdfFont) codeLength(s []byte) int {
+	if len(f.codespace) == 0 {
+		return min(2, len(s))
+	}
+	for n := 1; n <= 4 && n <= len(s); n++ {
+		var code uint32
+		for _, c := range s[:n] {
+			code = code<<8 | uint32(c)
+		}
+		for _, r := range f.codespace {
+			if r.n == n && code >= r.lo && code <= r.hi {
+				return n
+			}
+		}
+	}
+	return min(f.codespace[0].n, len(s))
+}
+
+func (f *pdfFont) text(code uint32, n int) string {
+	if t, ok := f.toUnicode[code]; ok {
+		return t
+	}
+	if f.composite {
+		if f.ucs2 {
+			b := make([]byte, n)
+			for i := n - 1; i >= 0; i-- {
+				b[i] = byte(code)
+				code >>= 8
+			}
+			return utf16BEString(b)
+		}
+		return ""
+	}
+	if name := f.encoding[code&0xFF]; name != "" {
+		if t := glyphRune(name); t != "" {
+			return t
+		}
+	}
+	if code >= 0x20 && code < 0x7F {
+		// Symbolic fonts without an encoding usually still use ASCII codes.
+		return string(rune(code))
+	}
+	return ""
+}
+
+func (f *pdfFont) width(code uint32) float64 {
+	if f.composite {
+		code = f.cid(code)
+	}
+	if w, ok := f.widths[code]; ok {
+		return w
+	}
+	return f.defaultWidth
+}
+
+func (f *pdfFont) cid(code uint32) uint32 {
+	if f.cids == nil {
+		return code
+	}
+	for _, r := range f.cids {
+		if code >= r.lo && code <= r.hi {
+			return r.cid + code - r.lo
+		}
+	}
+	return 0
+}
+
+// font loads the font object referenced from a resource dictionary,
+// caching fonts that are shared through indirect references.
+func (d *pdfDoc) font(obj pdfObject) *pdfFont {
+	ref, isRef := obj.(pdfRef)
+	if isRef {
+		d.mu.Lock()
+		f, ok := d.fonts[ref]
+		d.mu.Unlock()
+		if ok {
+			return f
+		}
+	}
+	f := d.loadFont(d.resolveDict(obj))
+	if isRef {
+		d.mu.Lock()
+		d.fonts[ref] = f
+		d.mu.Unlock()
+	}
+	return f
+}
+
+func (d *pdfDoc) loadFont(dict pdfDict) *pdfFont {
+	f := &pdfFont{widths: map[uint32]float64{}, widthScale: 0.001, defaultWidth: 500}
+	if dict == nil {
+		return f
+	}
+	if s := d.resolveStream(dict["ToUnicode"]); s != nil {
+		if data, err := d.decodeStream(s); err == nil {
+			f.toUnicode = parseCMap(data).unicode
+		}
+	}
+
+	f.math = isMathFont(string(d.resolveName(dict["BaseFont"])))
+
+	subtype := d.resolveName(dict["Subtype"])
+	if subtype == "Type0" {
+		d.loadCompositeFont(f, dict)
+		return f
+	}
+
+	if subtype == "Type3" {
+		if fm := d.resolveArray(dict["FontMatrix"]); len(fm) > 0 {
+			if v, ok := pdfFloat(d.resolve(fm[0])); ok {
+				f.widthScale = v
+			}
+		}
+	}
+
+	// Encoding: a named base encoding, optionally patched by /Differences.
+	base := &standardEncoding
+	if subtype == "TrueType" {
+		base = &winAnsiEncoding
+	}
+	baseFont := string(d.resolveName(dict["BaseFont"]))
+	if i := strings.IndexByte(baseFont, '+'); i == 6 {
+		baseFont = baseFont[i+1:] // subset tag
+	}
+	var differences pdfArray
+	switch enc := d.resolve(dict["Encoding"]).(type) {
+	case pdfName:
+		if e, ok := builtinEncodings[enc]; ok {
+			base = e
+		}
+	case pdfDict:
+		if e, ok := builtinEncodings[d.resolveName(enc["BaseEncoding"])]; ok {
+			base = e
+		}
+		differences = d.resolveArray(enc["Differences"])
+	}
+	f.encoding = *base
+	code := 0
+	for _, item := range differences {
+		switch v := d.resolve(item).(type) {
+		case int:
+			code = v
+		case pdfName:
+			if code >= 0 && code < 256 {
+				f.encoding[code] = string(v)
+			}
+			code++
+		}
+	}
+
+	// Widths, falling back to the metrics of the standard 14 fonts.
+	first, _ := pdfInt(d.resolve(dict["FirstChar"]))
+	for i, w := range d.resolveArray(dict["Widths"]) {
+		if v, ok := pdfFloat(d.resolve(w)); ok {
+			f.widths[uint32(first+i)] = v
+		}
+	}
+	if desc := d.resolveDict(dict["FontDescriptor"]); desc != nil {
+		if v, ok := pdfFloat(d.resolve(desc["MissingWidth"])); ok && v > 0 {
+			f.defaultWidth = v
+		}
+	}
+	if len(f.widths) == 0 {
+		switch {
+		case strings.HasPrefix(baseFont, "Courier"):
+			f.defaultWidth = 600
+		case strings.HasPrefix(baseFont, "Times"):
+			for i, w := range standardFontWidth["Times"] {
+				f.widths[uint32(0x20+i)] = float64(w)
+			}
+		case strings.HasPrefix(baseFont, "Helvetica"), strings.HasPrefix(baseFont, "Arial"):
+			for i, w := range standardFontWidth["Helvetica"] {
+				f.widths[uint32(0x20+i)] = float64(w)
+			}
+		}
+	}
+	return f
+}
+
+func (d *pdfDoc) loadCompositeFont(f *pdfFont, dict pdfDict) {
+	f.composite = true
+	f.defaultWidth = 1000
+
+	switch enc := d.resolve(dict["Encoding"]).(type) {
+	case pdfName:
+		name := string(enc)
+		if strings.Contains(name, "UCS2") || strings.Contains(name, "UTF16") {
+			f.ucs2 = true
+		}
+		f.vertical = strings.HasSuffix(name, "-V")
+		// Identity-H/V and the other predefined CMaps use two-byte codes for
+		// everything text extraction can make sense of.
+		f.codespace = []codespaceRange{{2, 0, 0xFFFF}}
+	case *pdfStream:
+		if data, err := d.decodeStream(enc); err == nil {
+			cm := parseCMap(data)
+			f.codespace = cm.codespace
+			f.cids = cm.cids
+			f.vertical = cm.vertical
+		}
+		if v, ok := pdfInt(d.resolve(enc.dict["WMode"])); ok {
+			f.vertical = v == 1
+		}
+	}
+
+	desc := d.resolveArray(dict["DescendantFonts"])
+	if len(desc) == 0 {
+		return
+	}
+	cidFont := d.resolveDict(desc[0])
+	if v, ok := pdfFloat(d.resolve(cidFont["DW"])); ok {
+		f.defaultWidth = v
+	}
+	// Per-glyph vertical metrics (W2) are rare enough in CJK fonts that
+	// DW2 is used for every glyph.
+	f.advanceY = -1000
+	if dw2 := d.resolveArray(cidFont["DW2"]); len(dw2) == 2 {
+		if v, ok := pdfFloat(d.resolve(dw2[1])); ok {
+			f.advanceY = v
+		}
+	}
+	w := d.resolveArray(cidFont["W"])
+	for i := 0; i < len(w); {
+		start, ok := pdfInt(d.resolve(w[i]))
+		if !ok || i+1 >= len(w) {
+			break
+		}
+		if list, ok := d.resolve(w[i+1]).(pdfArray); ok {
+			// c [w1 w2 ...]
+			for j, item := range list {
+				if v, ok := pdfFloat(d.resolve(item)); ok {
+					f.widths[uint32(start+j)] = v
+				}
+			}
+			i += 2
+			continue
+		}
+		// c_first c_last w
+		if i+2 >= len(w) {
+			break
+		}
+		last, _ := pdfInt(d.resolve(w[i+1]))
+		v, _ := pdfFloat(d.resolve(w[i+2]))
+		for c := start; c <= last && c-start <= 0xFFFF; c++ {
+			f.widths[uint32(c)] = v
+		}
+		i += 3
+	}
+}
+
+// textState is the part of the graphics state that affects text.
+type textState struct {
+	font      *pdfFont
+	size      float64
+	charSpace float64
+	wordSpace float64
+	scale     float64
+	leading   float64
+	rise      float64
+	render    int // text rendering mode (Tr)
+}
+
+type graphicsState struct {
+	ctm matrix
+	ts  textState
+}
+
+// textFragment is one string drawn on the page, in device space.
+type textFragment struct {
+	text       string
+	x0, y0     float64 // start of the baseline
+	x1, y1     float64 // end of the baseline
+	dirX, dirY float64 // unit vector along the baseline
+	size       float64 // font size in device space
+	invisible  bool    // drawn in rendering mode 3 or 7, as OCR text layers are
+	vertical   bool    // part of vertically typeset text; see markVertical
+	math       bool    // drawn in a math font
+}
+
+// contentInterpreter runs a content stream, collecting the text it draws.
+type contentInterpreter struct {
+	doc       *pdfDoc
+	fonts     map[pdfName]*pdfFont
+	gs        graphicsState
+	stack     []graphicsState
+	tm, tlm   matrix
+	fragments []textFragment
+	images    [][4]float64 // device-space bounding boxes of the images drawn
+	depth     int
+}
+
+// pageText lays out the text of page index, handling vertical text
+// according to mode, one of VerticalTextModes ("" means VerticalAuto).
+func (d *pdfDoc) pageText(index int, mode string) (string, error) {
+	frags, err := d.pageFragments(index)
+	if err != nil {
+		return "", err
+	}
+	return layoutFragments(frags, mode), nil
+}
+
+// pageFragments returns the text page index draws within its MediaBox.
+// Text starting outside the box is not shown by viewers, and pdftotext
+// drops it too; this matters for pages cut out of larger ones, such as the
+// halves SplitSpreads makes.
+func (d *pdfDoc) pageFragments(index int) ([]textFragment, error) {
+	ci, err := d.interpretPage(index)
+	if err != nil {
+		return nil, err
+	}
+	const slack = 1 // points
+	box := d.pages[index].mediaBox
+	frags := ci.fragments[:0]
+	for _, f := range ci.fragments {
+		if f.x0 >= box[0]-slack && f.x0 <= box[2]+slack && f.y0 >= box[1]-slack && f.y0 <= box[3]+slack {
+			frags = append(frags, f)
+		}
+	}
+	return frags, nil
+}
+
+// interpretPage runs the content of page index and returns the
+// interpreter, holding the text and images it drew.
+func (d *pdfDoc) interpretPage(index int) (*contentInterpreter, error) {
+	p := d.pages[index]
+	content, err := d.pageContents(p)
+	if err != nil {
+		return nil, err
+	}
+	ci := &contentInterpreter{doc: d}
+	ci.gs.ctm = identityMatrix
+	ci.gs.ts.scale = 1
+	ci.run(content, p.resources)
+	return ci, nil
+}
+
+func (ci *contentInterpreter) run(content []byte, resources pdfDict) {
+	d := ci.doc
+	fontDict := d.resolveDict(resources["Font"])
+	xobjects := d.resolveDict(resources["XObject"])
+	savedFonts := ci.fonts
+	ci.fonts = map[pdfName]*pdfFont{}
+	defer func() { ci.fonts = savedFonts }()
+
+	l := &pdfLexer{data: content, content: true}
+	var ops []pdfObject
+	for {
+		obj, err := l.readObject()
+		if err != nil {
+			return
+		}
+		op, ok := obj.(pdfKeyword)
+		if !ok {
+			ops = append(ops, obj)
+			continue
+		}
+		ci.exec(op, ops, l, fontDict, xobjects, resources)
+		ops = ops[:0]
+	}
+}
+
+func (ci *contentInterpreter) exec(op pdfKeyword, ops []pdfObject, l *pdfLexer, fontDict, xobjects, resources pdfDict) {
+	num := func(i int) float64 {
+		if i < len(ops) {
+			v, _ := pdfFloat(ops[i])
+			return v
+		}
+		return 0
+	}
+	ts := &ci.gs.ts
+
+	switch op {
+	case "q":
+		ci.stack = append(ci.stack, ci.gs)
+	case "Q":
+		if n := len(ci.stack); n > 0 {
+			ci.gs = ci.stack[n-1]
+			ci.stack = ci.stack[:n-1]
+		}
+	case "cm":
+		if len(ops) == 6 {
+			ci.gs.ctm = matrix{num(0), num(1), num(2), num(3), num(4), num(5)}.mul(ci.gs.ctm)
+		}
+	case "BT":
+		ci.tm, ci.tlm = identityMatrix, identityMatrix
+	case "Tf":
+		if len(ops) == 2 {
+			name, _ := ops[0].(pdfName)
+			ts.font = ci.font(name, fontDict)
+			ts.size = num(1)
+		}
+	case "Tc":
+		ts.charSpace = num(0)
+	case "Tw":
+		ts.wordSpace = num(0)
+	case "Tz":
+		ts.scale = num(0) / 100
+	case "TL":
+		ts.leading = num(0)
+	case "Ts":
+		ts.rise = num(0)
+	case "Tr":
+		ts.render = int(num(0))
+	case "Td":
+		ci.moveLine(num(0), num(1))
+	case "TD":
+		ts.leading = -num(1)
+		ci.moveLine(num(0), num(1))
+	case "Tm":
+		if len(ops) == 6 {
+			ci.tm = matrix{num(0), num(1), num(2), num(3), num(4), num(5)}
+			ci.tlm = ci.tm
+		}
+	case "T*":
+		ci.moveLine(0, -ts.leading)
+	case "Tj":
+		if len(ops) > 0 {
+			ci.show(ops[0])
+		}
+	case "'":
+		ci.moveLine(0, -ts.leading)
+		if len(ops) > 0 {
+			ci.show(ops[0])
+		}
+	case "\"":
+		if len(ops) == 3 {
+			ts.wordSpace, ts.charSpace = num(0), num(1)
+			ci.moveLine(0, -ts.leading)
+			ci.show(ops[2])
+		}
+	case "TJ":
+		if len(ops) == 0 {
+			return
+		}
+		arr, _ := ops[0].(pdfArray)
+		for _, item := range arr {
+			if adj, ok := pdfFloat(item); ok {
+				if ts.font != nil && ts.font.vertical {
+					ci.tm = translate(0, -adj/1000*ts.size).mul(ci.tm)
+				} else {
+					ci.tm = translate(-adj/1000*ts.size*ts.scale, 0).mul(ci.tm)
+				}
+				continue
+			}
+			ci.show(item)
+		}
+	case "Do":
+		if len(ops) > 0 {
+			name, _ := ops[0].(pdfName)
+			ci.doXObject(ci.doc.resolveStream(xobjects[name]), resources)
+		}
+	case "BI":
+		ci.addImage()
+		skipInlineImage(l)
+	}
+}
+
+func (ci *contentInterpreter) moveLine(tx, ty float64) {
+	ci.tlm = translate(tx, ty).mul(ci.tlm)
+	ci.tm = ci.tlm
+}
+
+func (ci *contentInterpreter) font(name pdfName, fontDict pdfDict) *pdfFont {
+	if f, ok := ci.fonts[name]; ok {
+		return f
+	}
+	f := ci.doc.font(fontDict[name])
+	ci.fonts[name] = f
+	return f
+}
+
+// show draws a string in the current font, advancing the text matrix by
+// each glyph's width.
+func (ci *contentInterpreter) show(obj pdfObject) {
+	s, ok := obj.(pdfString)
+	ts := &ci.gs.ts
+	if !ok || ts.font == nil {
+		return
+	}
+	trm := matrix{ts.size * ts.scale, 0, 0, ts.size, 0, ts.rise}.mul(ci.tm).mul(ci.gs.ctm)
+	x0, y0 := trm[4], trm[5]
+
+	var b strings.Builder
+	vertical := ts.font.vertical
+	for _, g := range ts.font.decode([]byte(s)) {
+		b.WriteString(g.text)
+		t := ts.charSpace
+		if g.space {
+			t += ts.wordSpace
+		}
+		if vertical {
+			ci.tm = translate(0, ts.font.advanceY*ts.font.widthScale*ts.size+t).mul(ci.tm)
+		} else {
+			ci.tm = translate((g.width*ts.size+t)*ts.scale, 0).mul(ci.tm)
+		}
+	}
+
+	end := matrix{ts.size * ts.scale, 0, 0, ts.size, 0, ts.rise}.mul(ci.tm).mul(ci.gs.ctm)
+	// Horizontal text runs along the text space x axis; vertical text runs
+	// down its y axis.
+	dx, dy, size := trm[0], trm[1], math.Hypot(trm[2], trm[3])
+	if vertical {
+		dx, dy, size = -trm[2], -trm[3], math.Hypot(trm[0], trm[1])
+	}
+	length := math.Hypot(dx, dy)
+	if length == 0 {
+		return
+	}
+	ci.fragments = append(ci.fragments, textFragment{
+		text: b.String(),
+		x0:   x0, y0: y0,
+		x1: end[4], y1: end[5],
+		dirX: dx / length, dirY: dy / length,
+		size:      size,
+		invisible: ts.render == 3 || ts.render == 7,
+		vertical:  vertical,
+		math:      ts.font.math,
+	})
+}
+
+// addImage records an image drawn into the unit square of the current
+// transformation matrix.
+func (ci *contentInterpreter) addImage() {
+	m := ci.gs.ctm
+	box := [4]float64{math.Inf(1), math.Inf(1), math.Inf(-1), math.Inf(-1)}
+	for _, c := range [][2]float64{{0, 0}, {1, 0}, {0, 1}, {1, 1}} {
+		x := c[0]*m[0] + c[1]*m[2] + m[4]
+		y := c[0]*m[1] + c[1]*m[3] + m[5]
+		box = [4]float64{math.Min(box[0], x), math.Min(box[1], y), math.Max(box[2], x), math.Max(box[3], y)}
+	}
+	ci.images = append(ci.images, box)
+}
+
+func (ci *contentInterpreter) doXObject(s *pdfStream, parentResources pdfDict) {
+	if s != nil && ci.doc.resolveName(s.dict["Subtype"]) == "Image" {
+		ci.addImage()
+		return
+	}
+	if s == nil || ci.doc.resolveName(s.dict["Subtype"]) != "Form" || ci.depth >= 12 {
+		return
+	}
+	data, err := ci.doc.decodeStream(s)
+	if err != nil {
+		return
+	}
+	resources := ci.doc.resolveDict(s.dict["Resources"])
+	if resources == nil {
+		resources = parentResources
+	}
+
+	saved, savedStack := ci.gs, len(ci.stack)
+	savedTM, savedTLM := ci.tm, ci.tlm
+	if m := ci.doc.resolveArray(s.dict["Matrix"]); len(m) == 6 {
+		var fm matrix
+		for i := range fm {
+			fm[i], _ = pdfFloat(ci.doc.resolve(m[i]))
+		}
+		ci.gs.ctm = fm.mul(ci.gs.ctm)
+	}
+	ci.depth++
+	ci.run(data, resources)
+	ci.depth--
+	ci.gs, ci.stack = saved, ci.stack[:savedStack]
+	ci.tm, ci.tlm = savedTM, savedTLM
+}
+
+// skipInlineImage moves l past the binary data of an inline image, which
+// runs from the ID operator to an EI operator surrounded by whitespace.
+func skipInlineImage(l *pdfLexer) {
+	for {
+		obj, err := l.readObject()
+		if err != nil {
+			return
+		}
+		if obj == pdfKeyword("ID") {
+			break
+		}
+	}
+	l.pos++ // the single whitespace character after ID
+	for l.pos < len(l.data) {
+		i := bytes.Index(l.data[l.pos:], []byte("EI"))
+		if i < 0 {
+			l.pos = len(l.data)
+			return
+		}
+		at := l.pos + i
+		l.pos = at + 2
+		if at > 0 && isPDFSpace(l.data[at-1]) && (l.pos == len(l.data) || isPDFSpace(l.data[l.pos])) {
+			return
+		}
+	}
+}
+
+// visibleLines splits the visible text of a page into lines, breaking
+// where layoutLines does.
+func visibleLines(frags []textFragment) [][]textFragment {
+	var lines [][]textFragment
+	var prev *textFragment
+	for i := range frags {
+		f := &frags[i]
+		if strings.TrimSpace(f.text) == "" || f.invisible {
+			continue
+		}
+		if prev == nil || math.Abs(-(f.x0-prev.x1)*f.dirY+(f.y0-prev.y1)*f.dirX) > 0.5*math.Max(math.Max(f.size, prev.size), 1) {
+			lines = append(lines, nil)
+		}
+		lines[len(lines)-1] = append(lines[len(lines)-1], *f)
+		prev = f
+	}
+	return lines
+}
+
+// textBounds returns the device-space box around frags, widening their
+// baselines to cover ascenders and descenders.
+func textBounds(frags []textFragment) (x0, y0, x1, y1 float64) {
+	x0, y0, x1, y1 = math.Inf(1), math.Inf(1), math.Inf(-1), math.Inf(-1)
+	for _, f := range frags {
+		x0 = math.Min(x0, math.Min(f.x0, f.x1))
+		x1 = math.Max(x1, math.Max(f.x0, f.x1))
+		y0 = math.Min(y0, math.Min(f.y0, f.y1)-0.3*f.size)
+		y1 = math.Max(y1, math.Max(f.y0, f.y1)+0.9*f.size)
+	}
+	return x0, y0, x1, y1
+}
+
+// layoutLines joins fragments into lines of text. A fragment starts a new
+// line when it sits noticeably above or below the end of the previous one
+// (measured across the baseline direction, so rotated text works), and is
+// preceded by a space when there is a visible gap along the baseline.
+func layoutLines(frags []textFragment) string {
+	var b strings.Builder
+	var prev *textFragment
+	for i := range frags {
+		f := &frags[i]
+		if f.text == "" {
+			continue
+		}
+		if prev != nil {
+			dx, dy := f.x0-prev.x1, f.y0-prev.y1
+			along := dx*f.dirX + dy*f.dirY
+			across := -dx*f.dirY + dy*f.dirX
+			size := math.Max(math.Max(f.size, prev.size), 1)
+			switch {
+			case math.Abs(across) > 0.5*size:
+				b.WriteByte('\n')
+			case math.Abs(along) > 0.15*size:
+				if !strings.HasSuffix(prev.text, " ") && !strings.HasPrefix(f.text, " ") {
+					b.WriteByte(' ')
+				}
+			}
+		}
+		b.WriteString(f.text)
+		prev = f
+	}
+	if b.Len() == 0 {
+		return ""
+	}
+	b.WriteByte('\n')
+	return b.String()
+}
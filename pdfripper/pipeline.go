@@ -0,0 +1,541 @@
+package pdfripper
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// PageResult carries a single page through the extraction pipeline.
+type PageResult struct {
+	Page       int    // 1-indexed page number.
+	Text       string // Extracted (and post-processed) page text.
+	OutputFile string // Path the page was saved to, set by the sink.
+	Err        error  // First error encountered while handling the page.
+
+	Quality       float64        // QualityScore of Text as extracted, or of the OCR text if that was used.
+	OCRUsed       bool           // Text came from OCR because the extracted text scored too low.
+	OCRLayout     []byte         // hOCR or ALTO XML of the OCR text, if OCRUsed and Extractor.OCRLayout is set.
+	OCRConfidence float64        // Mean word confidence of the OCR text, from 0 to 1, if OCRUsed and the engine reports it.
+	NeedsReview   bool           // OCRConfidence is below Extractor.ReviewThreshold; the page was copied to ReviewDir.
+	OCRLines      int            // OCR lines added to Text where the page has no text of its own, if Extractor.OCRMerge is set.
+	Duration      time.Duration  // Time spent extracting the page, including any OCR.
+	Usage         ResourceUsage  // What the commands run to extract and OCR the page used.
+	Tokens        int            // Tokens of Text, if Extractor.Tokenizer is set.
+	Agreement     *float64       // TextSimilarity of the text to a second backend's, if Extractor.Agreement sampled the page.
+	Watermarked   bool           // Watermark or stamp lines were removed from Text.
+	Geometry      *PageGeometry  // Page size and rotation, if the extractor loaded them.
+	Class         PageClass      // How the page was produced, if the extractor classified it.
+	Equations     []Equation     // Equations replaced in Text, if the extractor looks for them.
+	Figures       []Figure       // Figures and their captions, if the extractor looks for them.
+	Bates         string         // The page's Bates number, if the extractor looks for them and one was found.
+	Label         string         // The page's logical label, such as "iv", if the extractor labels pages and the page has one.
+	NumberedLines []NumberedLine // The lines of pleading paper by their margin numbers, if Extractor.LineNumbers is LineNumbersMap.
+	ImageHash     ImageHash      // Perceptual hash of the page's image, if it was rendered for OCR, equations or figures.
+	Fields        map[string]any // Fields a post-processor such as a Script added, for the manifest.
+	Dropped       bool           // A post-processor dropped the page, so the sink did not write it.
+
+	needsOCR bool // Set by score for the OCR stage.
+}
+
+// PostProcessor transforms a page after extraction. Post-processors run
+// concurrently across pages, so they must not share unsynchronized state.
+type PostProcessor func(r *PageResult) error
+
+// PageHook observes finished pages, for example to report progress. It is
+// called for failed and dropped pages too, with Err or Dropped set, and
+// only ever from a single goroutine.
+type PageHook func(r *PageResult)
+
+// Sink receives finished pages. WritePage is only ever called from a single
+// goroutine, so implementations need no locking of their own.
+type Sink interface {
+	WritePage(r *PageResult) error
+	Close() error
+}
+
+// dirSink saves each page to its own text file inside a directory, with
+// the page's OCR layout and numbered lines, if any, next to it.
+type dirSink struct {
+	dir          string
+	layoutFormat string
+	batesNames   bool            // Name files after the page's Bates number, when it has one not used yet.
+	labelNames   bool            // Name files after the page's label, when it has one not used yet.
+	used         map[string]bool // Names taken by earlier pages.
+	confine      []string        // If set, the directories its files must lie in (Extractor.ConfineTo).
+}
+
+func (s *dirSink) WritePage(r *PageResult) error {
+	base := s.name(r)
+	r.OutputFile = filepath.Join(s.dir, base+".txt")
+	if err := s.writeFile(r.OutputFile, []byte(r.Text)); err != nil {
+		return err
+	}
+	fmt.Printf("Saved page %d to %s\n", r.Page, r.OutputFile)
+	if r.OCRLayout != nil {
+		if err := s.writeFile(filepath.Join(s.dir, base+layoutExt(s.layoutFormat)), r.OCRLayout); err != nil {
+			return err
+		}
+	}
+	if r.NumberedLines != nil {
+		name := filepath.Join(s.dir, base+".lines.json")
+		if err := s.check(name); err != nil {
+			return err
+		}
+		if err := writeNumberedLines(name, r.NumberedLines); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// name returns the base name of r's files: its Bates number or label, if
+// they are used and it has one not taken by an earlier page, or else
+// page_N, with a suffix if one of those has taken that.
+func (s *dirSink) name(r *PageResult) string {
+	if !s.batesNames && !s.labelNames {
+		return fmt.Sprintf("page_%d", r.Page)
+	}
+	if s.used == nil {
+		s.used = map[string]bool{}
+	}
+	var candidates []string
+	if s.batesNames {
+		candidates = append(candidates, batesFileName(r))
+	}
+	if s.labelNames {
+		candidates = append(candidates, labelFileName(r.Label))
+	}
+	candidates = append(candidates, fmt.Sprintf("page_%d", r.Page))
+	for _, name := range candidates {
+		if name != "" && !s.used[name] {
+			s.used[name] = true
+			return name
+		}
+	}
+	for i := 2; ; i++ {
+		if name := fmt.Sprintf("page_%d_%d", r.Page, i); !s.used[name] {
+			s.used[name] = true
+			return name
+		}
+	}
+}
+
+// check returns an error if name lies outside the directories of confine.
+func (s *dirSink) check(name string) error {
+	if len(s.confine) == 0 {
+		return nil
+	}
+	return Confined(name, s.confine...)
+}
+
+// writeFile writes one of a page's files, once check allows it.
+func (s *dirSink) writeFile(name string, data []byte) error {
+	if err := s.check(name); err != nil {
+		return err
+	}
+	return os.WriteFile(name, data, 0644)
+}
+
+func (s *dirSink) Close() error { return nil }
+
+// combinedSink streams every page, in order, into one file. Each page is
+// terminated with a form feed, matching pdftotext's own multi-page output.
+// Only the write buffer is held in memory, never the document.
+type combinedSink struct {
+	f *os.File
+	w *bufio.Writer
+}
+
+func newCombinedSink(path string) (*combinedSink, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	return &combinedSink{f: f, w: bufio.NewWriter(f)}, nil
+}
+
+func (s *combinedSink) WritePage(r *PageResult) error {
+	if _, err := s.w.WriteString(r.Text); err != nil {
+		return err
+	}
+	return s.w.WriteByte('\f')
+}
+
+func (s *combinedSink) Close() error {
+	return closeBuffered(s.f, s.w)
+}
+
+// multiSink fans every page out to several sinks.
+type multiSink []Sink
+
+func (m multiSink) WritePage(r *PageResult) error {
+	for _, s := range m {
+		if err := s.WritePage(r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m multiSink) Close() error {
+	var firstErr error
+	for _, s := range m {
+		if err := s.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// pageRange is an inclusive range of 1-indexed pages.
+type pageRange struct {
+	first, last int
+}
+
+// firstError records the first of many concurrently reported errors.
+type firstError struct {
+	mu  sync.Mutex
+	err error
+}
+
+func (f *firstError) set(err error) {
+	f.mu.Lock()
+	if f.err == nil {
+		f.err = err
+	}
+	f.mu.Unlock()
+}
+
+// runStage starts n workers running work and calls done once all of them
+// have returned. It is used to close a stage's output channel.
+func runStage(n int, work func(), done func()) {
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			work()
+		}()
+	}
+	go func() {
+		wg.Wait()
+		done()
+	}()
+}
+
+// runPipeline pushes the pages of a document of totalPages through these
+// stages:
+//
+//	page fetch -> extract -> OCR (if configured) -> post-process -> sink
+//
+// Extraction, OCR and post-processing each have their own worker pool, so
+// CPU-heavy post-processing overlaps with IO-bound extraction instead of
+// serializing behind it, and slow OCR can be scaled out on its own. The sink runs on the calling goroutine. A failed
+// page does not stop the others; the first error is returned at the end.
+//
+// Pages are released in the order of e.extractionOrder, which leaves out
+// pages that fail FilterOrientation, and handed to extract workers in
+// ranges of up to e.BatchSize pages that are consecutive in that order and
+// in the document. When ordered is true they are delivered in that order
+// too, which is page order unless PageOrder says otherwise. The fetch
+// stage takes a token from a window of e.maxInFlight() slots (widened to
+// at least one batch) for every page it releases, and the sink returns the token once the page has
+// been written (or dropped). Every buffer between the stages, including the
+// reorder buffer used when ordered is true, is therefore bounded by the
+// window regardless of document length. Ordering cannot deadlock: the
+// next page to deliver took its token before any later page did, so it is
+// always already being worked on.
+//
+// Once ctx is done no further pages are released; those already in flight
+// drain through the pipeline and ctx.Err() is returned. The same goes for
+// free space falling below MinFreeSpace, with a DiskSpaceError.
+//
+// If Heartbeat or SlowPage is set, every page is tracked from the start of
+// its extraction until the sink is done with it, for the watchdog.
+//
+// If Pool is set, every range extracted and page OCRed waits for a slot
+// of it, which other runs compete for. With Autoscale, there are workers
+// for its maximum, and they wait for the scaler's slots first.
+func (e *Extractor) runPipeline(ctx context.Context, totalPages int, sink Sink, ordered bool) error {
+	var errs firstError
+	tracker, stopWatchdog := e.startWatchdog(totalPages)
+	defer stopWatchdog()
+	defer e.startAutoscale()()
+
+	extractWorkers := min(e.extractWorkers(), totalPages)
+	postWorkers := min(max(e.PostProcessCount, 1), totalPages)
+
+	batchSize := max(e.BatchSize, 1)
+	order := e.extractionOrder(totalPages)
+	window := make(chan struct{}, max(e.maxInFlight(), batchSize))
+	rangesChan := make(chan pageRange, extractWorkers)
+	extracted := make(chan *PageResult, postWorkers)
+	processed := make(chan *PageResult, postWorkers)
+
+	// Stage 1: enqueue page ranges (1-indexed), one window slot per page.
+	// canceled and lowSpace are read only after processed is closed, which
+	// happens after this goroutine returns.
+	var canceled, lowSpace error
+	go func() {
+		defer close(rangesChan)
+		// The range being gathered, of n pages from lo to hi, which the
+		// order may take either way.
+		lo, hi, n := 0, 0, 0
+		lastCheck := time.Now()
+		flush := func() {
+			if n > 0 {
+				rangesChan <- pageRange{lo, hi}
+				n = 0
+			}
+		}
+		for _, p := range order {
+			if n > 0 && p != hi+1 && p != lo-1 {
+				flush()
+			}
+			if len(e.spaceDirs) > 0 && time.Since(lastCheck) >= diskCheckInterval {
+				lastCheck = time.Now()
+				if err := e.lowSpace(); err != nil {
+					flush()
+					lowSpace = err
+					return
+				}
+			}
+			select {
+			case window <- struct{}{}:
+			case <-ctx.Done():
+				// Hand over the pages that already hold a token.
+				flush()
+				canceled = ctx.Err()
+				return
+			}
+			switch {
+			case n == 0:
+				lo, hi = p, p
+			case p == hi+1:
+				hi = p
+			default:
+				lo = p
+			}
+			n++
+			if n == batchSize {
+				flush()
+			}
+		}
+		flush()
+	}()
+
+	// Stage 2: extract text.
+	runStage(extractWorkers, func() {
+		for rg := range rangesChan {
+			for p := rg.first; p <= rg.last; p++ {
+				tracker.enter(p, StageExtract)
+			}
+			e.acquire()
+			results := e.extractRange(rg.first, rg.last)
+			e.release()
+			for _, r := range results {
+				r.Geometry, r.Label = e.pageGeometry(r.Page), e.pageLabel(r.Page)
+				if r.Err == nil {
+					start := time.Now()
+					e.score(r)
+					r.Duration += time.Since(start)
+				}
+				extracted <- r
+			}
+		}
+	}, func() { close(extracted) })
+
+	// Stage 3: OCR the pages that need it, in a pool of its own so that a
+	// remote engine can be given more concurrency than extraction has.
+	toPost := extracted
+	if e.OCR != nil {
+		recovered := make(chan *PageResult, postWorkers)
+		runStage(min(e.ocrWorkers(), totalPages), func() {
+			for r := range extracted {
+				if r.needsOCR {
+					tracker.enter(r.Page, StageOCR)
+					start := time.Now()
+					e.acquire()
+					e.recoverText(r)
+					e.release()
+					r.Duration += time.Since(start)
+				}
+				recovered <- r
+			}
+		}, func() { close(recovered) })
+		toPost = recovered
+	}
+
+	// Stage 4: post-process.
+	runStage(postWorkers, func() {
+		for r := range toPost {
+			if r.Err == nil {
+				tracker.enter(r.Page, StagePostProcess)
+				if e.agreement != nil {
+					e.acquire()
+					e.agreement.compare(e.PDFFile, r)
+					e.release()
+				}
+				e.postProcess(r)
+				e.runStages(ctx, tracker, r)
+				if e.Sanitize != nil && r.Err == nil && !r.Dropped {
+					e.Sanitize.sanitize(r)
+				}
+				if e.Tokenizer != nil && r.Err == nil && !r.Dropped {
+					r.Tokens = e.Tokenizer.CountTokens(r.Text)
+				}
+			}
+			tracker.enter(r.Page, StageSink)
+			processed <- r
+		}
+	}, func() { close(processed) })
+
+	// Stage 5: sink.
+	deliver := func(r *PageResult) {
+		defer func() { <-window }()
+		defer tracker.leave(r.Page)
+		if r.Err == nil && !r.Dropped {
+			if err := sink.WritePage(r); err != nil {
+				r.Err = fmt.Errorf("saving page %d: %w", r.Page, err)
+			}
+		}
+		if r.Err != nil {
+			errs.set(r.Err)
+		}
+		if e.PageDone != nil {
+			e.PageDone(r)
+		}
+		for _, h := range e.Hooks {
+			h.AfterPage(r)
+		}
+	}
+	pending := make(map[int]*PageResult)
+	next := 0 // index in order of the next page to deliver
+	for r := range processed {
+		if !ordered {
+			deliver(r)
+			continue
+		}
+		pending[r.Page] = r
+		for next < len(order) {
+			p, ok := pending[order[next]]
+			if !ok {
+				break
+			}
+			delete(pending, order[next])
+			deliver(p)
+			next++
+		}
+	}
+	if err := sink.Close(); err != nil {
+		errs.set(fmt.Errorf("closing output: %w", err))
+	}
+	if canceled != nil {
+		return canceled
+	}
+	if lowSpace != nil {
+		return lowSpace
+	}
+	return errs.err
+}
+
+// acquire takes a slot of the run's scaler and of Pool, where they are
+// set.
+func (e *Extractor) acquire() {
+	if e.scaler != nil {
+		e.scaler.acquire()
+	}
+	if e.Pool != nil {
+		e.Pool.Acquire()
+	}
+}
+
+// release gives back the slots acquire took.
+func (e *Extractor) release() {
+	if e.Pool != nil {
+		e.Pool.Release()
+	}
+	if e.scaler != nil {
+		e.scaler.release()
+	}
+}
+
+// maxInFlight returns the configured in-flight page window, defaulting to
+// enough slack to keep every worker of every pool busy.
+func (e *Extractor) maxInFlight() int {
+	if e.MaxInFlight > 0 {
+		return e.MaxInFlight
+	}
+	workers := e.extractWorkers() + max(e.PostProcessCount, 1)
+	if e.OCR != nil {
+		workers += e.ocrWorkers()
+	}
+	return 2 * workers
+}
+
+// extractWorkers returns the size of the extraction pool.
+func (e *Extractor) extractWorkers() int {
+	if e.Autoscale != nil {
+		_, hi := e.Autoscale.bounds()
+		return hi
+	}
+	return max(e.ProcessCount, 1)
+}
+
+// ocrWorkers returns the size of the OCR pool.
+func (e *Extractor) ocrWorkers() int {
+	if e.OCRWorkers > 0 && e.Autoscale == nil {
+		return e.OCRWorkers
+	}
+	return e.extractWorkers()
+}
+
+// postProcess removes watermarks and equations, saves figures, applies
+// the script options, rewrites the text for speech if asked to and applies
+// the Replacements, then runs the configured post-processors to r in order, stopping at the
+// first one that fails or drops the page.
+func (e *Extractor) postProcess(r *PageResult) {
+	if e.bates() {
+		// Before watermark removal, which could take the stamp for one.
+		e.findBates(r)
+	}
+	if e.LineNumbers != "" {
+		e.handleLineNumbers(r)
+	}
+	if e.RemoveWatermarks && e.watermarks != nil {
+		r.Text, r.Watermarked = removeWatermarks(r.Text, e.watermarks.Watermarks)
+	}
+	if e.equations() && !r.OCRUsed {
+		if err := e.markEquations(r); err != nil {
+			r.Err = fmt.Errorf("marking equations on page %d: %w", r.Page, err)
+			return
+		}
+	}
+	if e.Figures {
+		if err := e.saveFigures(r); err != nil {
+			r.Err = fmt.Errorf("saving figures on page %d: %w", r.Page, err)
+			return
+		}
+	}
+	r.Text = e.localize(r.Text)
+	if e.Speech {
+		r.Text = SpeechText(r.Text, e.running)
+	} else if e.StripHeaders {
+		r.Text = StripHeaders(r.Text, e.running)
+	}
+	r.Text = ApplyReplacements(r.Text, e.Replacements)
+	for _, pp := range e.PostProcessors {
+		if err := pp(r); err != nil {
+			r.Err = fmt.Errorf("post-processing page %d: %w", r.Page, err)
+			return
+		}
+		if r.Dropped {
+			return
+		}
+	}
+}
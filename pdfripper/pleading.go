@@ -0,0 +1,186 @@
+package pdfripper
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Values of Extractor.LineNumbers.
+const (
+	LineNumbersStrip = "strip" // Remove the line numbers of pleading paper from the text.
+	LineNumbersMap   = "map"   // Remove them and record the text of each numbered line, in PageResult.NumberedLines and page_N.lines.json.
+)
+
+// Thresholds used to recognize pleading paper.
+const (
+	pleadingMinLines = 10   // Numbers, from 1 up, the left margin needs for a page to be pleading paper.
+	pleadingMargin   = 0.25 // Share of the page width, from the left edge, the numbers must be in.
+)
+
+// NumberedLine is a line of pleading paper with the number printed in the
+// margin beside it.
+type NumberedLine struct {
+	Number int    `json:"number"`
+	Text   string `json:"text"` // Empty for numbered lines left blank.
+}
+
+// lineNumberRe matches a line starting with a bare line number, as
+// opposed to the "1." or "(1)" of a numbered paragraph.
+var lineNumberRe = regexp.MustCompile(`^\s*(\d{1,2})(?:\s+(.*?))?\s*$`)
+
+// StripLineNumbers removes the line numbers of pleading paper, the court
+// filing format with lines numbered 1, 2, 3 and so on down the left margin,
+// from a page's text. Numbers are recognized at the start of lines and on
+// lines of their own, which are dropped; backends that follow the order of
+// the page's content, as pdftotext and the native backend do, often give
+// the whole margin before the text. It returns the text with the numbers
+// removed and the numbered lines, which only have text when the numbers
+// came at the start of lines, or the text unchanged and nil if fewer than
+// ten numbers in sequence were found.
+func StripLineNumbers(text string) (string, []NumberedLine) {
+	lines := strings.Split(text, "\n")
+	var numbered []NumberedLine
+	var at []int // index in lines of each of numbered
+	for i, l := range lines {
+		m := lineNumberRe.FindStringSubmatch(l)
+		if m == nil {
+			continue
+		}
+		if n, _ := strconv.Atoi(m[1]); n == len(numbered)+1 {
+			numbered = append(numbered, NumberedLine{Number: n, Text: m[2]})
+			at = append(at, i)
+		}
+	}
+	if len(numbered) < pleadingMinLines {
+		return text, nil
+	}
+	drop := map[int]bool{}
+	for k, i := range at {
+		lines[i] = numbered[k].Text
+		drop[i] = numbered[k].Text == ""
+	}
+	out := lines[:0]
+	for i, l := range lines {
+		if !drop[i] {
+			out = append(out, l)
+		}
+	}
+	return strings.Join(out, "\n"), numbered
+}
+
+// pageLineNumbers reads the numbered lines of page index from the
+// positions of its text: a column of numbers from 1 up near the left edge,
+// and the text on the baseline of each. It returns nil if the page is not
+// pleading paper.
+func (d *pdfDoc) pageLineNumbers(index int) (lines []NumberedLine, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			lines, err = nil, fmt.Errorf("parsing page %d: %v", index+1, r)
+		}
+	}()
+	frags, err := d.pageFragments(index)
+	if err != nil {
+		return nil, err
+	}
+	p := d.pages[index]
+
+	// The margin numbers, top to bottom, right-aligned with the first.
+	type number struct {
+		frag  int
+		y     float64
+		right float64
+	}
+	var candidates []number
+	for i, f := range frags {
+		s := strings.TrimSpace(f.text)
+		if f.invisible || s == "" || len(s) > 2 || strings.Trim(s, "0123456789") != "" {
+			continue
+		}
+		left := math.Min(displayedX(p, f.x0, f.y0), displayedX(p, f.x1, f.y1))
+		if left < pleadingMargin {
+			right := math.Max(displayedX(p, f.x0, f.y0), displayedX(p, f.x1, f.y1))
+			candidates = append(candidates, number{frag: i, y: displayedY(p, f.x0, f.y0), right: right})
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].y < candidates[j].y })
+	var column []number
+	for _, c := range candidates {
+		n, _ := strconv.Atoi(strings.TrimSpace(frags[c.frag].text))
+		if n == len(column)+1 && (n == 1 || math.Abs(c.right-column[0].right) < 0.01) {
+			column = append(column, c)
+		}
+	}
+	if len(column) < pleadingMinLines {
+		return nil, nil
+	}
+
+	// Text belongs to the number whose baseline it is within half a line
+	// of, measured down the page.
+	spacing := (column[len(column)-1].y - column[0].y) / float64(len(column)-1)
+	inColumn := map[int]bool{}
+	for _, c := range column {
+		inColumn[c.frag] = true
+	}
+	groups := make([][]textFragment, len(column))
+	for i, f := range frags {
+		if inColumn[i] || f.invisible {
+			continue
+		}
+		y := displayedY(p, f.x0, f.y0)
+		k := int(math.Round((y - column[0].y) / spacing))
+		if k >= 0 && k < len(column) && math.Abs(y-column[k].y) < spacing/2 {
+			groups[k] = append(groups[k], f)
+		}
+	}
+	lines = make([]NumberedLine, len(column))
+	for k := range column {
+		lines[k] = NumberedLine{Number: k + 1, Text: strings.TrimSpace(layoutLines(groups[k]))}
+	}
+	return lines, nil
+}
+
+// checkLineNumbers reports whether LineNumbers has a known value.
+func (e *Extractor) checkLineNumbers() error {
+	switch e.LineNumbers {
+	case "", LineNumbersStrip, LineNumbersMap:
+		return nil
+	}
+	return fmt.Errorf("unknown line number handling %q (available: %s, %s)", e.LineNumbers, LineNumbersStrip, LineNumbersMap)
+}
+
+// handleLineNumbers strips the line numbers of a page on pleading paper
+// and, for LineNumbersMap, records its numbered lines, read from the
+// positions of the text when the input was parsed by openDoc and the text
+// is not from OCR, and from the text otherwise.
+func (e *Extractor) handleLineNumbers(r *PageResult) {
+	text, lines := StripLineNumbers(r.Text)
+	r.Text = text
+	if e.LineNumbers != LineNumbersMap {
+		return
+	}
+	if e.doc != nil && !r.OCRUsed {
+		positioned, err := e.doc.pageLineNumbers(r.Page - 1)
+		if err != nil {
+			fmt.Printf("Page %d: could not read line numbers: %v\n", r.Page, err)
+		} else if positioned != nil {
+			lines = positioned
+		}
+	}
+	r.NumberedLines = lines
+}
+
+// writeNumberedLines saves the numbered lines of a page as a JSON array
+// to path.
+func writeNumberedLines(path string, lines []NumberedLine) error {
+	data, err := json.MarshalIndent(lines, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
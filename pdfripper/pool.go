@@ -0,0 +1,136 @@
+package pdfripper
+
+import (
+	"context"
+	"sync"
+)
+
+// WorkPool bounds the backend and OCR calls made at once by the runs
+// that share it, such as those of the documents of a batch, where each
+// run's own workers would otherwise compete with every other run's.
+// Implementations must be safe for concurrent use.
+type WorkPool interface {
+	// Acquire blocks until the caller may make a call.
+	Acquire()
+	// Release gives back the slot an Acquire took.
+	Release()
+}
+
+// FairPool is a WorkPool of a fixed number of slots shared between
+// documents. A slot that comes free goes to the waiting documents of the
+// highest priority, in turn, so that a large document cannot keep every
+// slot while small ones wait behind it, and documents of a lower priority
+// get slots only while no other document wants them.
+type FairPool struct {
+	mu      sync.Mutex
+	free    int
+	waiting []*FairShare // Documents with callers waiting, in turn order.
+}
+
+// FairShare is one document's share of a FairPool, to set as its
+// Extractor's Pool.
+type FairShare struct {
+	p        *FairPool
+	priority int
+	waiters  []chan struct{}
+}
+
+// NewFairPool returns a pool of size slots, at least one.
+func NewFairPool(size int) *FairPool {
+	return &FairPool{free: max(size, 1)}
+}
+
+// Document returns the share of a document of priority 0.
+func (p *FairPool) Document() *FairShare {
+	return p.DocumentAt(0)
+}
+
+// DocumentAt returns the share of a document of the given priority;
+// higher priorities are served first.
+func (p *FairPool) DocumentAt(priority int) *FairShare {
+	return &FairShare{p: p, priority: priority}
+}
+
+func (d *FairShare) Acquire() {
+	d.AcquireContext(context.Background())
+}
+
+// AcquireContext is like Acquire but gives up, returning ctx.Err(), once
+// ctx is done.
+func (d *FairShare) AcquireContext(ctx context.Context) error {
+	p := d.p
+	p.mu.Lock()
+	if p.free > 0 && len(p.waiting) == 0 {
+		p.free--
+		p.mu.Unlock()
+		return nil
+	}
+	ch := make(chan struct{})
+	if len(d.waiters) == 0 {
+		p.waiting = append(p.waiting, d)
+	}
+	d.waiters = append(d.waiters, ch)
+	p.mu.Unlock()
+
+	select {
+	case <-ch:
+		return nil
+	case <-ctx.Done():
+	}
+	p.mu.Lock()
+	select {
+	case <-ch:
+		// Granted meanwhile: pass the slot on.
+		p.mu.Unlock()
+		d.Release()
+		return ctx.Err()
+	default:
+	}
+	for i, w := range d.waiters {
+		if w == ch {
+			d.waiters = append(d.waiters[:i], d.waiters[i+1:]...)
+			break
+		}
+	}
+	if len(d.waiters) == 0 {
+		p.remove(d)
+	}
+	p.mu.Unlock()
+	return ctx.Err()
+}
+
+func (d *FairShare) Release() {
+	p := d.p
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.waiting) == 0 {
+		p.free++
+		return
+	}
+	// Hand the slot to the next document in turn of the highest priority
+	// waiting, which goes to the back of the line if it has more callers
+	// waiting.
+	next := p.waiting[0]
+	for _, w := range p.waiting[1:] {
+		if w.priority > next.priority {
+			next = w
+		}
+	}
+	p.remove(next)
+	ch := next.waiters[0]
+	next.waiters = next.waiters[1:]
+	if len(next.waiters) > 0 {
+		p.waiting = append(p.waiting, next)
+	}
+	close(ch)
+}
+
+// remove takes d out of the line. p.mu must be held.
+func (p *FairPool) remove(d *FairShare) {
+	for i, w := range p.waiting {
+		if w == d {
+			p.waiting = append(p.waiting[:i], p.waiting[i+1:]...)
+			return
+		}
+	}
+}
@@ -0,0 +1,145 @@
+//go:build !noexec && !js && !wasip1
+
+package pdfripper
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/png"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// The poppler backend runs external commands, so it is left out of builds
+// with the noexec tag and of js/wasm and wasip1 builds.
+
+// DefaultBackend is the name of the backend used when none is selected.
+const DefaultBackend = "poppler"
+
+func init() {
+	RegisterBackend(popplerBackend{})
+}
+
+// popplerBackend shells out to the system-installed poppler-utils tools.
+type popplerBackend struct {
+	sandbox Sandbox
+	runner  Runner
+	tools   *PopplerTools // Set by Probe.
+}
+
+func (popplerBackend) Name() string { return "poppler" }
+
+func (b popplerBackend) WithSandbox(sb Sandbox) Backend {
+	b.sandbox = sb
+	return b
+}
+
+func (b popplerBackend) inWorkspace(dir string) any {
+	b.sandbox = b.sandbox.withTempDir(dir)
+	return b
+}
+
+func (b popplerBackend) withMeter(m *usageMeter) any {
+	b.sandbox.meter = m
+	return b
+}
+
+func (b popplerBackend) WithRunner(r Runner) Backend {
+	b.runner = r
+	return b
+}
+
+// run runs one of pdfinfo, pdftotext and pdftoppm, all of which take the
+// password SetPassword set as -upw.
+func (b popplerBackend) run(name string, args ...string) ([]byte, error) {
+	if p := documentPassword.Load(); p != nil && *p != "" {
+		args = append([]string{"-upw", *p}, args...)
+	}
+	return runWith(b.runner, b.sandbox, nil, name, args...)
+}
+
+// PageCount uses the pdfinfo command to determine the number of pages.
+func (b popplerBackend) PageCount(pdfFile string) (int, error) {
+	abs, err := filepath.Abs(pdfFile)
+	if err != nil {
+		return 0, err
+	}
+	out, err := b.run("pdfinfo", abs)
+	if err != nil {
+		return 0, fmt.Errorf("running pdfinfo: %w", err)
+	}
+
+	lines := strings.Split(string(out), "\n")
+	for _, line := range lines {
+		if strings.HasPrefix(line, "Pages:") {
+			parts := strings.Fields(line)
+			if len(parts) >= 2 {
+				pages, err := strconv.Atoi(parts[1])
+				if err != nil {
+					return 0, fmt.Errorf("parsing pages count: %w", err)
+				}
+				return pages, nil
+			}
+		}
+	}
+	return 0, errors.New("could not determine number of pages from pdfinfo output")
+}
+
+// ExtractPage uses pdftotext to extract one page to stdout.
+func (b popplerBackend) ExtractPage(pdfFile string, page int) (string, error) {
+	texts, err := b.ExtractRange(pdfFile, page, page)
+	if err != nil {
+		return "", err
+	}
+	return texts[0], nil
+}
+
+// ExtractRange uses a single pdftotext call to extract pages first..last and
+// splits the output on the form feed pdftotext writes after every page.
+func (b popplerBackend) ExtractRange(pdfFile string, first, last int) ([]string, error) {
+	// -f <page> sets the first page and -l <page> sets the last page.
+	abs, err := filepath.Abs(pdfFile)
+	if err != nil {
+		return nil, err
+	}
+	out, err := b.run("pdftotext", "-f", strconv.Itoa(first), "-l", strconv.Itoa(last), abs, "-")
+	if err != nil {
+		return nil, err
+	}
+	texts := strings.Split(string(out), "\f")
+	want := last - first + 1
+	// The final form feed leaves an empty trailing element.
+	if len(texts) != want+1 || texts[want] != "" {
+		return nil, fmt.Errorf("pdftotext returned %d page separators, expected %d", len(texts)-1, want)
+	}
+	return texts[:want], nil
+}
+
+// RenderPage uses pdftoppm to rasterize one page to a PNG on stdout, or
+// to a PPM if Probe found a pdftoppm without -png.
+func (b popplerBackend) RenderPage(pdfFile string, page, dpi int) (image.Image, error) {
+	abs, err := filepath.Abs(pdfFile)
+	if err != nil {
+		return nil, err
+	}
+	p := strconv.Itoa(page)
+	args := []string{"-r", strconv.Itoa(dpi), "-f", p, "-l", p}
+	pngOut := b.tools.Has("pdftoppm", "-png")
+	if pngOut {
+		args = append(args, "-png")
+	}
+	if b.tools.Has("pdftoppm", "-singlefile") {
+		args = append(args, "-singlefile")
+	}
+	out, err := b.run("pdftoppm", append(args, abs)...)
+	if err != nil {
+		return nil, fmt.Errorf("running pdftoppm: %w", err)
+	}
+	if !pngOut {
+		return decodePPM(out)
+	}
+	return png.Decode(bytes.NewReader(out))
+}
@@ -0,0 +1,171 @@
+//go:build !noexec && !js && !wasip1
+
+package pdfripper
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// PopplerTools are what a probe found of the installed poppler tools.
+type PopplerTools struct {
+	Version string                     // Of pdftotext, such as "22.02.0"; empty if it did not say.
+	Options map[string]map[string]bool // The options each tool's usage lists, by tool.
+}
+
+// Has reports whether tool takes option, such as "-singlefile". Tools that
+// were not probed, or whose usage could not be read, are taken to take
+// every option.
+func (t *PopplerTools) Has(tool, option string) bool {
+	if t == nil || t.Options[tool] == nil {
+		return true
+	}
+	return t.Options[tool][option]
+}
+
+// popplerOptions are the options the backend passes, and what it does
+// where a tool lacks one.
+var popplerOptions = []struct {
+	tool, option string
+	without      string // Empty if the backend cannot work without it.
+}{
+	{"pdftotext", "-f", ""},
+	{"pdftotext", "-l", ""},
+	{"pdftoppm", "-f", ""},
+	{"pdftoppm", "-l", ""},
+	{"pdftoppm", "-r", ""},
+	{"pdftoppm", "-png", "pages are rendered as PPM images"},
+	{"pdftoppm", "-singlefile", "each page is rendered to standard output without it"},
+}
+
+var (
+	popplerVersion = regexp.MustCompile(`version ([0-9][0-9.]*)`)
+	popplerOption  = regexp.MustCompile(`^\s+(-[A-Za-z0-9-]+)`)
+)
+
+// Probe runs each poppler tool the backend uses without arguments, so
+// that it prints its version and usage, and returns a copy of the backend
+// that passes only the options they list, with a warning for each it does
+// without. An error means a tool is missing or lacks an option the
+// backend needs, which would otherwise fail the run part way through.
+func (b popplerBackend) Probe() (Backend, []string, error) {
+	tools := &PopplerTools{Options: map[string]map[string]bool{}}
+	for _, tool := range []string{"pdfinfo", "pdftotext", "pdftoppm"} {
+		// A tool given no arguments exits with status 99 after its usage.
+		out, err := b.run(tool)
+		var cmdErr *CommandError
+		switch {
+		case errors.As(err, &cmdErr):
+			out = []byte(cmdErr.Stderr)
+		case err != nil:
+			return nil, nil, fmt.Errorf("poppler's %s cannot be run: %w", tool, err)
+		}
+		version, options := parsePopplerUsage(out)
+		if tool == "pdftotext" {
+			tools.Version = version
+		}
+		if len(options) > 0 {
+			tools.Options[tool] = options
+		}
+	}
+	var warnings []string
+	for _, o := range popplerOptions {
+		if tools.Has(o.tool, o.option) {
+			continue
+		}
+		if o.without == "" {
+			return nil, nil, fmt.Errorf("poppler %s's %s has no %s option, which the poppler backend needs", tools.Version, o.tool, o.option)
+		}
+		warnings = append(warnings, fmt.Sprintf("poppler %s's %s has no %s option, so %s", tools.Version, o.tool, o.option, o.without))
+	}
+	b.tools = tools
+	return b, warnings, nil
+}
+
+// parsePopplerUsage returns the version and options of a poppler tool's
+// usage message.
+func parsePopplerUsage(usage []byte) (string, map[string]bool) {
+	version := ""
+	if m := popplerVersion.FindSubmatch(usage); m != nil {
+		version = string(m[1])
+	}
+	options := map[string]bool{}
+	for _, line := range strings.Split(string(usage), "\n") {
+		if m := popplerOption.FindStringSubmatch(line); m != nil {
+			options[m[1]] = true
+		}
+	}
+	return version, options
+}
+
+// decodePPM decodes the binary PPM (P6) image pdftoppm writes without
+// -png.
+func decodePPM(data []byte) (image.Image, error) {
+	r := bufio.NewReader(bytes.NewReader(data))
+	var header [4]int // magic, width, height, maximum value
+	for i := range header {
+		field, err := ppmField(r)
+		if err != nil {
+			return nil, fmt.Errorf("reading PPM header: %w", err)
+		}
+		if i == 0 {
+			if field != "P6" {
+				return nil, fmt.Errorf("not a binary PPM image: %q", field)
+			}
+			continue
+		}
+		if header[i], err = strconv.Atoi(field); err != nil || header[i] <= 0 {
+			return nil, fmt.Errorf("bad PPM header field %q", field)
+		}
+	}
+	w, h, maxval := header[1], header[2], header[3]
+	if maxval > 255 {
+		return nil, fmt.Errorf("PPM images of %d levels are not supported", maxval+1)
+	}
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	row := make([]byte, 3*w)
+	for y := 0; y < h; y++ {
+		if _, err := io.ReadFull(r, row); err != nil {
+			return nil, fmt.Errorf("reading PPM pixels: %w", err)
+		}
+		for x := 0; x < w; x++ {
+			i := img.PixOffset(x, y)
+			for c := 0; c < 3; c++ {
+				img.Pix[i+c] = uint8(int(row[3*x+c]) * 255 / maxval)
+			}
+			img.Pix[i+3] = 0xff
+		}
+	}
+	return img, nil
+}
+
+// ppmField reads the next whitespace-separated field of a PPM header,
+// skipping comments, and the single whitespace byte after it.
+func ppmField(r *bufio.Reader) (string, error) {
+	var field []byte
+	for {
+		c, err := r.ReadByte()
+		if err != nil {
+			return "", err
+		}
+		switch {
+		case c == '#' && len(field) == 0:
+			if _, err := r.ReadString('\n'); err != nil {
+				return "", err
+			}
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			if len(field) > 0 {
+				return string(field), nil
+			}
+		default:
+			field = append(field, c)
+		}
+	}
+}
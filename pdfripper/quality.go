@@ -0,0 +1,99 @@
+package pdfripper
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// QualityScore rates how much extracted text looks like real text, from 0
+// (garbage or no text at all) to 1. It looks for the usual symptoms of a
+// broken glyph mapping: replacement, private-use and control characters,
+// and "words" that mix letters with symbols or with another script.
+func QualityScore(text string) float64 {
+	var chars, goodChars int
+	for _, r := range text {
+		if unicode.IsSpace(r) {
+			continue
+		}
+		chars++
+		switch {
+		case r == utf8.RuneError, unicode.Is(unicode.Co, r), unicode.IsControl(r):
+		case unicode.IsLetter(r), unicode.IsDigit(r), unicode.IsPunct(r), unicode.Is(unicode.Sc, r):
+			goodChars++
+		}
+	}
+	if chars == 0 {
+		return 0
+	}
+
+	words, goodWords := 0, 0
+	for _, w := range strings.Fields(text) {
+		words++
+		if wordlike(w) {
+			goodWords++
+		}
+	}
+	return (float64(goodChars)/float64(chars) + float64(goodWords)/float64(words)) / 2
+}
+
+// wordlike reports whether a token, stripped of surrounding punctuation, is
+// a number or a run of letters from a single script with at most the
+// joiners words normally contain.
+func wordlike(w string) bool {
+	w = strings.TrimFunc(w, func(r rune) bool { return unicode.IsPunct(r) || unicode.Is(unicode.Sc, r) })
+	if w == "" {
+		return true
+	}
+	var script *unicode.RangeTable
+	letters, digits, accented := 0, 0, 0
+	for _, r := range w {
+		switch {
+		case unicode.IsLetter(r) || unicode.Is(unicode.Mn, r):
+			letters++
+			if unicode.Is(unicode.Mn, r) {
+				continue
+			}
+			if r >= 0xC0 && r <= 0x24F {
+				accented++
+			}
+			s := scriptOf(r)
+			if script != nil && s != nil && s != script {
+				return false
+			}
+			if s != nil {
+				script = s
+			}
+		case unicode.IsDigit(r):
+			digits++
+		case strings.ContainsRune("'’-‐./,:&@%", r):
+		default:
+			return false
+		}
+	}
+	// Accented letters are a minority even in languages that use many;
+	// words made mostly of them come from a mapping shifted into Latin-1.
+	if accented*2 > letters {
+		return false
+	}
+	// Letters glued to digits ("a1b2") are typical of shifted mappings,
+	// but so are part numbers; only reject them in longer mixes.
+	return letters == 0 || digits == 0 || letters+digits < 8 || digits*4 >= letters+digits
+}
+
+var scripts = []*unicode.RangeTable{
+	unicode.Latin, unicode.Greek, unicode.Cyrillic, unicode.Arabic, unicode.Hebrew,
+	unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul, unicode.Thai, unicode.Devanagari,
+}
+
+func scriptOf(r rune) *unicode.RangeTable {
+	for _, s := range scripts {
+		if unicode.Is(s, r) {
+			if s == unicode.Hiragana || s == unicode.Katakana {
+				return unicode.Han // Japanese mixes all three within words
+			}
+			return s
+		}
+	}
+	return nil
+}
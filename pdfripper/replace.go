@@ -0,0 +1,80 @@
+package pdfripper
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// Replacement is a user-supplied rewriting rule, such as the fix for a
+// ligature a font maps wrongly or a letter an OCR engine keeps confusing.
+type Replacement struct {
+	Pattern     *regexp.Regexp
+	Replacement string // May refer to submatches as $1 or ${name}, as in Regexp.ReplaceAllString.
+}
+
+// ParseReplacements reads replacement rules, one per line: a regular
+// expression in RE2 syntax, a tab, and its replacement, in which \t, \n
+// and \\ stand for a tab, a line break and a backslash. A line without a
+// tab deletes the matches of its expression. Blank lines and lines
+// starting with # are skipped. For example:
+//
+//	# a ligature the font maps to the wrong character
+//	ﬁ	fi
+//	# OCR reading "m" as "rn" in a word it keeps getting wrong
+//	\bgovernrnent\b	government
+//	# a footer to drop
+//	(?m)^Confidential - do not distribute$
+func ParseReplacements(r io.Reader) ([]Replacement, error) {
+	var rules []Replacement
+	sc := bufio.NewScanner(r)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSuffix(sc.Text(), "\r")
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		expr, repl, _ := strings.Cut(line, "\t")
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+		rules = append(rules, Replacement{Pattern: re, Replacement: unescapeReplacement(repl)})
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+// LoadReplacements reads replacement rules from a file, as
+// ParseReplacements does.
+func LoadReplacements(path string) ([]Replacement, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	rules, err := ParseReplacements(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return rules, nil
+}
+
+var replacementEscapes = strings.NewReplacer(`\\`, `\`, `\t`, "\t", `\n`, "\n")
+
+func unescapeReplacement(s string) string {
+	return replacementEscapes.Replace(s)
+}
+
+// ApplyReplacements applies rules to text in order, each to the result of
+// the one before.
+func ApplyReplacements(text string, rules []Replacement) string {
+	for _, r := range rules {
+		text = r.Pattern.ReplaceAllString(text, r.Replacement)
+	}
+	return text
+}
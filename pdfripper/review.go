@@ -0,0 +1,44 @@
+package pdfripper
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// ReviewDir is the directory inside OutputDir that pages whose OCR
+// confidence is below ReviewThreshold are copied to.
+const ReviewDir = "needs_review"
+
+// queueForReview saves the page image, its OCR text and its layout side by
+// side in ReviewDir, as page_N.png, page_N.txt and page_N.hocr (or
+// .alto.xml), for someone to check. A page whose OCR came from the cache
+// is rendered again.
+func (e *Extractor) queueForReview(r *PageResult, res *ocrResult, m *usageMeter) error {
+	dir := filepath.Join(e.OutputDir, ReviewDir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	img := res.img
+	if img == nil {
+		var err error
+		if img, err = e.renderForOCR(r.Page, m); err != nil {
+			return err
+		}
+	}
+
+	base := filepath.Join(dir, fmt.Sprintf("page_%d", r.Page))
+	if err := savePNG(base+".png", img); err != nil {
+		return err
+	}
+	if err := os.WriteFile(base+".txt", []byte(res.text), 0644); err != nil {
+		return err
+	}
+	if res.layout != nil {
+		if err := os.WriteFile(base+layoutExt(e.layoutFormat()), res.layout, 0644); err != nil {
+			return err
+		}
+	}
+	fmt.Printf("Page %d: OCR confidence %.2f, queued for review in %s\n", r.Page, r.OCRConfidence, dir)
+	return nil
+}
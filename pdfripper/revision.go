@@ -0,0 +1,115 @@
+package pdfripper
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+)
+
+// Revision is a state of an incrementally updated document, as it was
+// when it was saved. Every save appends the objects it changes and a
+// cross-reference section, so the bytes of the file up to the end of that
+// section are the document as that save left it.
+type Revision struct {
+	Number       int    `json:"number"`                  // 1 for the original document, counting up with each save.
+	Size         int64  `json:"size"`                    // Bytes of the file up to the end of the revision.
+	Pages        int    `json:"pages"`                   // Page count of the revision.
+	Objects      int    `json:"objects"`                 // Entries of the revision's own cross-reference section: the objects it adds, changes or frees.
+	Modified     string `json:"modified,omitempty"`      // The Info dictionary's ModDate as the revision left it, in RFC 3339 if it can be read.
+	ChangedPages []int  `json:"changed_pages,omitempty"` // Pages whose page object or content streams the revision writes; nil for the first revision.
+}
+
+// revisionEndRe matches the end of a revision: startxref, the offset of
+// its cross-reference section and the end-of-file marker.
+var revisionEndRe = regexp.MustCompile(`startxref\s+(\d+)\s+%%EOF[ \t]*(\r\n|\r|\n)?`)
+
+// Revisions lists the revisions of a PDF, oldest first. A document that
+// was saved once has one. The first-page cross-reference section of a
+// linearized file does not count as a revision, and revisions that cannot
+// be parsed on their own are left out.
+func Revisions(pdfFile string) (revisions []Revision, err error) {
+	data, err := os.ReadFile(pdfFile)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			revisions, err = nil, fmt.Errorf("parsing %s: %v", pdfFile, r)
+		}
+	}()
+	for _, m := range revisionEndRe.FindAllSubmatchIndex(data, -1) {
+		offset, _ := strconv.Atoi(string(data[m[2]:m[3]]))
+		// Linearized files end their first-page section with startxref 0.
+		if offset == 0 || offset >= m[0] {
+			continue
+		}
+		d, err := openPDF(data[:m[1]])
+		if err != nil {
+			continue
+		}
+		section := newPDFDoc(d.data)
+		if _, err := section.readXrefSection(offset); err != nil {
+			continue
+		}
+		r := Revision{Number: len(revisions) + 1, Size: int64(m[1]), Pages: len(d.pages), Objects: len(section.xref)}
+		if info := d.resolveDict(d.trailer["Info"]); info != nil {
+			if date, ok := d.resolve(info["ModDate"]).(pdfString); ok {
+				r.Modified = infoDate("ModDate", textString(date))
+			}
+		}
+		if len(revisions) > 0 {
+			for i, p := range d.pages {
+				for _, num := range d.pageObjects(p) {
+					if _, ok := section.xref[num]; ok {
+						r.ChangedPages = append(r.ChangedPages, i+1)
+						break
+					}
+				}
+			}
+		}
+		revisions = append(revisions, r)
+	}
+	if len(revisions) == 0 {
+		return nil, fmt.Errorf("parsing %s: no revision found", pdfFile)
+	}
+	return revisions, nil
+}
+
+// pageObjects returns the numbers of a page's object and of its content
+// streams.
+func (d *pdfDoc) pageObjects(p pdfPage) []int {
+	var nums []int
+	if p.ref != (pdfRef{}) {
+		nums = append(nums, p.ref.num)
+	}
+	contents := p.dict["Contents"]
+	if ref, ok := contents.(pdfRef); ok {
+		nums = append(nums, ref.num)
+	}
+	if arr, ok := d.resolve(contents).(pdfArray); ok {
+		for _, c := range arr {
+			if ref, ok := c.(pdfRef); ok {
+				nums = append(nums, ref.num)
+			}
+		}
+	}
+	return nums
+}
+
+// WriteRevision writes revision n of inFile, as Revisions numbers them,
+// to outFile, from which it can be extracted like any other document.
+func WriteRevision(inFile, outFile string, n int) error {
+	revisions, err := Revisions(inFile)
+	if err != nil {
+		return err
+	}
+	if n < 1 || n > len(revisions) {
+		return fmt.Errorf("%s has no revision %d; it has %d", inFile, n, len(revisions))
+	}
+	data, err := os.ReadFile(inFile)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(outFile, data[:revisions[n-1].Size], 0644)
+}
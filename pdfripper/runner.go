@@ -0,0 +1,57 @@
+package pdfripper
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Runner runs the external commands pdfripper depends on: poppler's tools
+// for the poppler backend, tesseract, zbarimg and equation OCR commands.
+// Replacing the default lets tests supply canned output instead of
+// needing the commands installed.
+type Runner interface {
+	// Run runs name with args under the limits of sb, feeding it stdin if
+	// that is not nil, and returns its standard output. File arguments are
+	// absolute paths. When the command runs but fails, the error should
+	// have an ExitCode() int method, as *exec.ExitError does.
+	Run(sb Sandbox, stdin []byte, name string, args ...string) ([]byte, error)
+}
+
+// RunnerFunc adapts a function to the Runner interface.
+type RunnerFunc func(sb Sandbox, stdin []byte, name string, args ...string) ([]byte, error)
+
+func (f RunnerFunc) Run(sb Sandbox, stdin []byte, name string, args ...string) ([]byte, error) {
+	return f(sb, stdin, name, args...)
+}
+
+// exitCoder is implemented by the errors of commands that ran and failed.
+type exitCoder interface {
+	ExitCode() int
+}
+
+// CommandError is the error of a command that ran and failed, with what it
+// wrote to standard error. It unwraps to the error of os/exec, such as an
+// *exec.ExitError.
+type CommandError struct {
+	Name   string
+	Err    error
+	Stderr string // Its last stderrLimit bytes, trimmed.
+}
+
+// stderrLimit bounds the standard error a CommandError keeps.
+const stderrLimit = 64 << 10
+
+func (e *CommandError) Error() string {
+	if e.Stderr != "" {
+		return fmt.Sprintf("%v: %s", e.Err, lastLine(e.Stderr))
+	}
+	return e.Err.Error()
+}
+
+func (e *CommandError) Unwrap() error { return e.Err }
+
+// lastLine returns the final line of s, which for poppler is usually the
+// error that made it give up.
+func lastLine(s string) string {
+	return s[strings.LastIndex(s, "\n")+1:]
+}
@@ -0,0 +1,288 @@
+//go:build !noexec && !js && !wasip1
+
+package pdfripper
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/png"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/thnkr-one/pdfripper/pdfripper/paptest"
+)
+
+// fakeCall is a command a fakeRunner was asked to run.
+type fakeCall struct {
+	sb    Sandbox
+	stdin []byte
+	argv  []string
+}
+
+// fakeRunner answers commands with out, recording them.
+type fakeRunner struct {
+	out func(argv []string) ([]byte, error)
+
+	mu    sync.Mutex
+	calls []fakeCall
+}
+
+func (r *fakeRunner) Run(sb Sandbox, stdin []byte, name string, args ...string) ([]byte, error) {
+	argv := append([]string{name}, args...)
+	r.mu.Lock()
+	r.calls = append(r.calls, fakeCall{sb, stdin, argv})
+	r.mu.Unlock()
+	return r.out(argv)
+}
+
+// argvs returns the command lines run so far.
+func (r *fakeRunner) argvs() [][]string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var argvs [][]string
+	for _, c := range r.calls {
+		argvs = append(argvs, c.argv)
+	}
+	return argvs
+}
+
+// exitError is the error of a command that exited with code.
+type exitError int
+
+func (e exitError) Error() string { return fmt.Sprintf("exit status %d", int(e)) }
+func (e exitError) ExitCode() int { return int(e) }
+
+// fakePoppler answers pdfinfo and pdftotext for a document of pages.
+func fakePoppler(pages ...string) func(argv []string) ([]byte, error) {
+	return func(argv []string) ([]byte, error) {
+		switch argv[0] {
+		case "pdfinfo":
+			return []byte(fmt.Sprintf("Title: test\nPages:          %d\nEncrypted: no\n", len(pages))), nil
+		case "pdftotext":
+			// pdftotext -f first -l last file -
+			first, _ := strconv.Atoi(argv[2])
+			last, _ := strconv.Atoi(argv[4])
+			var b strings.Builder
+			for p := first; p <= last; p++ {
+				b.WriteString(pages[p-1] + "\f")
+			}
+			return []byte(b.String()), nil
+		}
+		return nil, errors.New("unexpected command " + argv[0])
+	}
+}
+
+func popplerWith(r Runner) Backend {
+	return popplerBackend{}.WithRunner(r)
+}
+
+func TestPopplerCommandLines(t *testing.T) {
+	abs, err := filepath.Abs("doc.pdf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := &fakeRunner{out: fakePoppler("one\n", "two\n", "three\n")}
+	b := popplerWith(r)
+	if n, err := b.PageCount("doc.pdf"); err != nil || n != 3 {
+		t.Fatalf("PageCount = %d, %v; want 3", n, err)
+	}
+	texts, err := b.(RangeExtractor).ExtractRange("doc.pdf", 2, 3)
+	if err != nil || !reflect.DeepEqual(texts, []string{"two\n", "three\n"}) {
+		t.Fatalf("ExtractRange = %q, %v", texts, err)
+	}
+	if text, err := b.ExtractPage("doc.pdf", 1); err != nil || text != "one\n" {
+		t.Fatalf("ExtractPage = %q, %v", text, err)
+	}
+	want := [][]string{
+		{"pdfinfo", abs},
+		{"pdftotext", "-f", "2", "-l", "3", abs, "-"},
+		{"pdftotext", "-f", "1", "-l", "1", abs, "-"},
+	}
+	if got := r.argvs(); !reflect.DeepEqual(got, want) {
+		t.Errorf("ran %q, want %q", got, want)
+	}
+
+	SetPassword("s3cret")
+	defer SetPassword("")
+	r = &fakeRunner{out: fakePoppler("one\n")}
+	if _, err := popplerWith(r).PageCount("doc.pdf"); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := r.argvs(), [][]string{{"pdfinfo", "-upw", "s3cret", abs}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("with a password, ran %q, want %q", got, want)
+	}
+}
+
+func TestPopplerErrors(t *testing.T) {
+	failed := &CommandError{Name: "pdfinfo", Err: exitError(1), Stderr: "Syntax Error: bad\nCouldn't open file"}
+	for _, tt := range []struct {
+		name string
+		out  func(argv []string) ([]byte, error)
+		call func(b Backend) error
+		err  string
+	}{
+		{"pdfinfo fails", func([]string) ([]byte, error) { return nil, failed },
+			func(b Backend) error { _, err := b.PageCount("doc.pdf"); return err }, "running pdfinfo: exit status 1: Couldn't open file"},
+		{"no page count", func([]string) ([]byte, error) { return []byte("Title: x\n"), nil },
+			func(b Backend) error { _, err := b.PageCount("doc.pdf"); return err }, "could not determine number of pages"},
+		{"bad page count", func([]string) ([]byte, error) { return []byte("Pages: many\n"), nil },
+			func(b Backend) error { _, err := b.PageCount("doc.pdf"); return err }, "parsing pages count"},
+		{"too few pages", func([]string) ([]byte, error) { return []byte("one\f"), nil },
+			func(b Backend) error { _, err := b.(RangeExtractor).ExtractRange("doc.pdf", 1, 2); return err }, "returned 1 page separators, expected 2"},
+		{"no trailing form feed", func([]string) ([]byte, error) { return []byte("one\ftwo"), nil },
+			func(b Backend) error { _, err := b.(RangeExtractor).ExtractRange("doc.pdf", 1, 2); return err }, "returned 1 page separators, expected 2"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.call(popplerWith(&fakeRunner{out: tt.out}))
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("got error %v, want one containing %q", err, tt.err)
+			}
+		})
+	}
+
+	// The exit code of a failed command is kept for callers to check.
+	_, err := popplerWith(&fakeRunner{out: func([]string) ([]byte, error) { return nil, failed }}).PageCount("doc.pdf")
+	var exit exitCoder
+	if !errors.As(err, &exit) || exit.ExitCode() != 1 {
+		t.Errorf("got error %v, want one with exit code 1", err)
+	}
+}
+
+// popplerUsage is the usage of a poppler tool taking options.
+func popplerUsage(tool string, options ...string) string {
+	usage := tool + " version 22.02.0\nUsage: " + tool + " [options] <PDF-file>\n"
+	for _, o := range options {
+		usage += "  " + o + " <int>          : an option\n"
+	}
+	return usage
+}
+
+func TestPopplerProbe(t *testing.T) {
+	old := map[string]string{
+		"pdfinfo":   popplerUsage("pdfinfo", "-f", "-l"),
+		"pdftotext": popplerUsage("pdftotext", "-f", "-l", "-layout"),
+		"pdftoppm":  popplerUsage("pdftoppm", "-f", "-l", "-r"),
+	}
+	r := &fakeRunner{out: func(argv []string) ([]byte, error) {
+		if len(argv) == 1 {
+			// Usage goes to standard error, with exit status 99.
+			return nil, &CommandError{Name: argv[0], Err: exitError(99), Stderr: old[argv[0]]}
+		}
+		// A 1x1 PPM, as pdftoppm writes without -png.
+		return []byte("P6\n1 1\n255\n\xff\x00\x00"), nil
+	}}
+	b, warnings, err := popplerWith(r).(Prober).Probe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(warnings) != 2 || !strings.Contains(warnings[0], "no -png option") || !strings.Contains(warnings[1], "no -singlefile option") {
+		t.Errorf("got warnings %q, want ones for -png and -singlefile", warnings)
+	}
+	img, err := b.(Renderer).RenderPage("doc.pdf", 4, 150)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if img.Bounds().Dx() != 1 {
+		t.Errorf("rendered a %v image, want 1x1", img.Bounds())
+	}
+	argvs := r.argvs()
+	if got, want := argvs[len(argvs)-1][:7], []string{"pdftoppm", "-r", "150", "-f", "4", "-l", "4"}; !reflect.DeepEqual(got, want) || len(argvs[len(argvs)-1]) != 8 {
+		t.Errorf("rendered with %q, want %q and the file", argvs[len(argvs)-1], want)
+	}
+
+	// A tool that is missing, or lacks an option it needs, fails the probe.
+	missing := &fakeRunner{out: func(argv []string) ([]byte, error) { return nil, exec.ErrNotFound }}
+	if _, _, err := popplerWith(missing).(Prober).Probe(); err == nil || !strings.Contains(err.Error(), "poppler's pdfinfo cannot be run") {
+		t.Errorf("missing tools: got error %v", err)
+	}
+	old["pdftotext"] = popplerUsage("pdftotext", "-l")
+	if _, _, err := popplerWith(r).(Prober).Probe(); err == nil || !strings.Contains(err.Error(), "pdftotext has no -f option") {
+		t.Errorf("missing option: got error %v", err)
+	}
+}
+
+func TestExtractWithFakeRunner(t *testing.T) {
+	r := &fakeRunner{out: fakePoppler("one\n", "two\n", "three\n")}
+	tempDir := t.TempDir()
+	sb := Sandbox{Timeout: time.Minute, CPUSeconds: 30}
+	b := popplerBackend{}.WithSandbox(sb).(popplerBackend).WithRunner(r)
+	// The file is checked to be a PDF; its pages come from the runner.
+	e := New(paptest.TempPDF(t, "unused"), WithBackend(b), WithWorkers(2), WithOutputDir(t.TempDir()))
+	e.TempDir = tempDir
+	var sink resultSink
+	if err := e.ExtractToContext(context.Background(), &sink); err != nil {
+		t.Fatal(err)
+	}
+	if len(sink.pages) != 3 {
+		t.Fatalf("got %d pages, want 3", len(sink.pages))
+	}
+	for _, c := range r.calls {
+		// The run's workspace, within TempDir, holds the commands' files.
+		if c.sb.Timeout != time.Minute || c.sb.CPUSeconds != 30 || filepath.Dir(c.sb.TempDir) != tempDir {
+			t.Errorf("%s ran with sandbox %+v, want the backend's in a workspace in %s", c.argv[0], c.sb, tempDir)
+		}
+	}
+}
+
+func TestTesseractCommandLine(t *testing.T) {
+	r := &fakeRunner{out: func([]string) ([]byte, error) { return []byte("Recognized text\n\f"), nil }}
+	ocr := &Tesseract{Language: "deu+eng", TessdataDir: "/opt/tessdata", Runner: r}
+	img := image.NewGray(image.Rect(0, 0, 4, 4))
+	text, err := ocr.Recognize(img)
+	if err != nil || text != "Recognized text\n" {
+		t.Fatalf("Recognize = %q, %v", text, err)
+	}
+	c := r.calls[0]
+	if want := []string{"tesseract", "stdin", "stdout", "-l", "deu+eng", "--tessdata-dir", "/opt/tessdata"}; !reflect.DeepEqual(c.argv, want) {
+		t.Errorf("ran %q, want %q", c.argv, want)
+	}
+	if _, err := png.Decode(bytes.NewReader(c.stdin)); err != nil {
+		t.Errorf("standard input is not a PNG: %v", err)
+	}
+
+	r.out = func([]string) ([]byte, error) {
+		return nil, &CommandError{Name: "tesseract", Err: exitError(1), Stderr: "Failed loading language 'deu'"}
+	}
+	if _, err := ocr.Recognize(img); err == nil || !strings.Contains(err.Error(), "Failed loading language") {
+		t.Errorf("got error %v, want tesseract's", err)
+	}
+}
+
+func TestZBarCommandLine(t *testing.T) {
+	const xml = `<barcodes><source href="page.png"><index num="0">` +
+		`<symbol type="QR-Code" quality="1"><polygon points="+10,20 +110,20 +110,120 +10,120"/><data><![CDATA[hello]]></data></symbol>` +
+		`</index></source></barcodes>`
+	r := &fakeRunner{out: func([]string) ([]byte, error) { return []byte(xml), nil }}
+	z := &ZBar{Runner: r, Sandbox: Sandbox{TempDir: t.TempDir()}}
+	img := image.NewGray(image.Rect(0, 0, 4, 4))
+	codes, err := z.DecodeBarcodes(img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []Barcode{{Symbology: "QR-Code", Value: "hello", X: 10, Y: 20, Width: 100, Height: 100}}; !reflect.DeepEqual(codes, want) {
+		t.Errorf("got %+v, want %+v", codes, want)
+	}
+	argv := r.calls[0].argv
+	if len(argv) != 4 || argv[1] != "--quiet" || argv[2] != "--xml" || filepath.Base(argv[3]) != "page.png" || filepath.Dir(filepath.Dir(argv[3])) != z.Sandbox.TempDir {
+		t.Errorf("ran %q, want zbarimg --quiet --xml and an image in the sandbox's TempDir", argv)
+	}
+
+	// Status 4 means there were no barcodes; others are errors.
+	r.out = func([]string) ([]byte, error) { return nil, &CommandError{Name: "zbarimg", Err: exitError(4)} }
+	if codes, err := z.DecodeBarcodes(img); err != nil || codes != nil {
+		t.Errorf("exit status 4: got %v, %v; want no barcodes", codes, err)
+	}
+	r.out = func([]string) ([]byte, error) { return nil, &CommandError{Name: "zbarimg", Err: exitError(2)} }
+	if _, err := z.DecodeBarcodes(img); err == nil {
+		t.Error("exit status 2: got no error")
+	}
+}
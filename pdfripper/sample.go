@@ -0,0 +1,41 @@
+package pdfripper
+
+import (
+	"fmt"
+	"math/rand"
+)
+
+// sampled reports whether SampleSize or SampleFraction is set.
+func (e *Extractor) sampled() bool {
+	return e.SampleSize > 0 || e.SampleFraction > 0
+}
+
+// chooseSample picks the pages of a run of totalPages to extract when
+// sampling, from those that pass FilterOrientation. The candidates are cut
+// into as many equal stretches as there are pages to sample and one page
+// is drawn from each, so that a sample covers the whole document rather
+// than clustering. SampleSeed makes the draw repeatable.
+func (e *Extractor) chooseSample(totalPages int) {
+	e.sample = nil
+	if !e.sampled() {
+		return
+	}
+	var candidates []int
+	for p := 1; p <= totalPages; p++ {
+		if e.included(p) {
+			candidates = append(candidates, p)
+		}
+	}
+	k := e.SampleSize
+	if e.SampleFraction > 0 {
+		k = max(int(e.SampleFraction*float64(len(candidates))+0.5), 1)
+	}
+	k = min(k, len(candidates))
+	rng := rand.New(rand.NewSource(e.SampleSeed))
+	e.sample = make([]bool, totalPages+1)
+	for i := 0; i < k; i++ {
+		from, to := i*len(candidates)/k, (i+1)*len(candidates)/k
+		e.sample[candidates[from+rng.Intn(to-from)]] = true
+	}
+	fmt.Printf("Sampled %d of %d pages\n", k, len(candidates))
+}
@@ -0,0 +1,23 @@
+package pdfripper
+
+import "time"
+
+// Sandbox limits the external commands a backend runs. Every command
+// already gets an empty environment and a private, empty working
+// directory; these limits are on top of that. Zero values mean no limit.
+// The CPU, memory and affinity limits are set before a command runs its
+// first instruction, by a copy of the running program that sets them on
+// itself and then execs the command; see startLimited.
+type Sandbox struct {
+	CPUSeconds  uint64        // CPU time per command (RLIMIT_CPU). Linux only.
+	MemoryBytes uint64        // Address space per command (RLIMIT_AS). Linux only.
+	Timeout     time.Duration // Wall-clock time per command.
+	TempDir     string        // Directory the commands' working directories and files are made in (default: os.TempDir).
+	Affinity    *CPUAffinity  // If set, each command is pinned to the next of its CPU sets. Linux only.
+
+	meter *usageMeter // Set by withMeter, for the page the commands are run for.
+}
+
+func (sb Sandbox) hasRlimits() bool {
+	return sb.CPUSeconds > 0 || sb.MemoryBytes > 0
+}
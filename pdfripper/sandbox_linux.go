@@ -0,0 +1,107 @@
+package pdfripper
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+// cpuMaskWords is the size of the CPU masks passed to the kernel, in
+// 64-bit words: enough for 4096 CPUs.
+const cpuMaskWords = 64
+
+// setRlimits applies the sandbox's resource limits to process pid, or to
+// this one if pid is 0.
+func setRlimits(pid int, sb Sandbox) error {
+	set := func(resource int, limit uint64) error {
+		rl := syscall.Rlimit{Cur: limit, Max: limit}
+		_, _, errno := syscall.RawSyscall6(syscall.SYS_PRLIMIT64, uintptr(pid), uintptr(resource), uintptr(unsafe.Pointer(&rl)), 0, 0, 0)
+		if errno != 0 {
+			return errno
+		}
+		return nil
+	}
+	if sb.CPUSeconds > 0 {
+		if err := set(syscall.RLIMIT_CPU, sb.CPUSeconds); err != nil {
+			return err
+		}
+	}
+	if sb.MemoryBytes > 0 {
+		if err := set(syscall.RLIMIT_AS, sb.MemoryBytes); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setAffinity pins process pid to cpus with sched_setaffinity, or the
+// calling thread if pid is 0.
+func setAffinity(pid int, cpus []int) error {
+	var mask [cpuMaskWords]uint64
+	for _, cpu := range cpus {
+		if cpu >= cpuMaskWords*64 {
+			return fmt.Errorf("CPU %d is out of range", cpu)
+		}
+		mask[cpu/64] |= 1 << (cpu % 64)
+	}
+	_, _, errno := syscall.RawSyscall(syscall.SYS_SCHED_SETAFFINITY, uintptr(pid), unsafe.Sizeof(mask), uintptr(unsafe.Pointer(&mask)))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// allowedCPUs returns the CPUs this process may run on.
+func allowedCPUs() ([]int, error) {
+	var mask [cpuMaskWords]uint64
+	_, _, errno := syscall.RawSyscall(syscall.SYS_SCHED_GETAFFINITY, 0, unsafe.Sizeof(mask), uintptr(unsafe.Pointer(&mask)))
+	if errno != 0 {
+		return nil, errno
+	}
+	var cpus []int
+	for cpu := 0; cpu < cpuMaskWords*64; cpu++ {
+		if mask[cpu/64]&(1<<(cpu%64)) != 0 {
+			cpus = append(cpus, cpu)
+		}
+	}
+	return cpus, nil
+}
+
+// numaNodes returns the CPUs of each NUMA node, in node order, from sysfs.
+func numaNodes() ([][]int, error) {
+	paths, err := filepath.Glob("/sys/devices/system/node/node[0-9]*/cpulist")
+	if err != nil {
+		return nil, err
+	}
+	if len(paths) == 0 {
+		return nil, errors.New("no NUMA nodes found in /sys/devices/system/node")
+	}
+	node := func(path string) int {
+		n, _ := strconv.Atoi(strings.TrimPrefix(filepath.Base(filepath.Dir(path)), "node"))
+		return n
+	}
+	slices.SortFunc(paths, func(a, b string) int { return node(a) - node(b) })
+	var nodes [][]int
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		// Nodes with memory but no CPUs have an empty list.
+		if strings.TrimSpace(string(data)) == "" {
+			continue
+		}
+		cpus, err := ParseCPUList(string(data))
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, cpus)
+	}
+	return nodes, nil
+}
@@ -0,0 +1,23 @@
+//go:build !linux
+
+package pdfripper
+
+import "errors"
+
+var errAffinity = errors.New("CPU affinity is only supported on Linux")
+
+func setRlimits(pid int, sb Sandbox) error {
+	return errors.New("CPU and memory limits are only supported on Linux")
+}
+
+func setAffinity(pid int, cpus []int) error {
+	return errAffinity
+}
+
+func allowedCPUs() ([]int, error) {
+	return nil, errAffinity
+}
+
+func numaNodes() ([][]int, error) {
+	return nil, errAffinity
+}
@@ -0,0 +1,202 @@
+package pdfripper
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// Entity types a Sanitizer redacts.
+const (
+	EntityEmail = "email"
+	EntityURL   = "url"
+	EntityIBAN  = "iban"  // Only those whose check digits are right.
+	EntityCard  = "card"  // Payment card numbers that pass the Luhn check.
+	EntitySSN   = "ssn"   // US Social Security numbers, as 123-45-6789.
+	EntityIP    = "ip"    // IPv4 addresses.
+	EntityDate  = "date"  // Dates in numeric forms and with month names.
+	EntityPhone = "phone" // Numbers of 8 to 15 digits written with a leading + or separators.
+)
+
+// Entities are the entity types a Sanitizer knows, in the order it
+// redacts them.
+var Entities = []string{EntityEmail, EntityURL, EntityIBAN, EntityCard, EntitySSN, EntityIP, EntityDate, EntityPhone}
+
+// entityPatterns match candidates of each entity type; entityChecks, where
+// set, reject those that are not.
+var (
+	entityPatterns = map[string]*regexp.Regexp{
+		EntityEmail: regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9-]+(?:\.[A-Za-z0-9-]+)*\.[A-Za-z]{2,}`),
+		EntityURL:   regexp.MustCompile(`\b(?:https?://|www\.)[^\s<>"]*[^\s<>".,;:!?)\]]`),
+		EntityIBAN:  invoiceIBAN,
+		EntityCard:  regexp.MustCompile(`\b\d(?:[ -]?\d){12,18}\b`),
+		EntitySSN:   regexp.MustCompile(`\b\d{3}-\d{2}-\d{4}\b`),
+		EntityIP:    regexp.MustCompile(`\b\d{1,3}(?:\.\d{1,3}){3}\b`),
+		EntityDate:  invoiceDateValue,
+		EntityPhone: regexp.MustCompile(`(?:\+\d{1,3}[ .-]?)?(?:\(\d{1,4}\)[ .-]?)?\d{2,5}(?:[ .-]\d{2,5}){1,4}\b`),
+	}
+	entityChecks = map[string]func(string) bool{
+		EntityIBAN: func(s string) bool { return validIBAN(strings.ReplaceAll(s, " ", "")) },
+		EntityCard: func(s string) bool { return luhn(strings.NewReplacer(" ", "", "-", "").Replace(s)) },
+		EntityIP:   func(s string) bool { return net.ParseIP(s) != nil },
+		EntityPhone: func(s string) bool {
+			digits := strings.Count(strings.Map(func(r rune) rune {
+				if r >= '0' && r <= '9' {
+					return 'd'
+				}
+				return -1
+			}, s), "d")
+			return digits >= 8 && digits <= 15 && (strings.HasPrefix(s, "+") || strings.ContainsAny(s, " .-()"))
+		},
+	}
+)
+
+// luhn reports whether digits pass the Luhn check of card numbers.
+func luhn(digits string) bool {
+	sum := 0
+	for i := range digits {
+		d := int(digits[len(digits)-1-i] - '0')
+		if i%2 == 1 {
+			if d *= 2; d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+	}
+	return sum%10 == 0
+}
+
+// Sanitizer prepares extracted text for sharing outside the organization
+// it came from, set as Extractor.Sanitize. The entities of Entities in
+// every page's text, and in the text of its fields and numbered lines,
+// are replaced with placeholders such as [EMAIL], and its Bates number,
+// wherever it appears, with a pseudonym, which names page files with
+// BatesFileNames. The manifest records neither the document's metadata
+// nor its watermarks, nor the pages' image hashes.
+//
+// Runs that save page images, layouts, metadata or a table of contents,
+// which cannot be sanitized, are refused.
+type Sanitizer struct {
+	Entities []string // Types redacted, of the package's Entities (default: all).
+	Key      []byte   // Key of the pseudonyms; the same key gives the same ones (default: drawn at random for each Sanitizer).
+
+	once sync.Once
+}
+
+// NewSanitizer returns a Sanitizer of the named entity types, all of them
+// if there are none, checking they are known.
+func NewSanitizer(entities ...string) (*Sanitizer, error) {
+	for _, t := range entities {
+		if !slices.Contains(Entities, t) {
+			return nil, fmt.Errorf("unknown entity type %q (available: %s)", t, strings.Join(Entities, ", "))
+		}
+	}
+	return &Sanitizer{Entities: entities}, nil
+}
+
+// Redact replaces the entities of s with placeholders.
+func (s *Sanitizer) Redact(text string) string {
+	for _, t := range Entities {
+		if len(s.Entities) > 0 && !slices.Contains(s.Entities, t) {
+			continue
+		}
+		placeholder := "[" + strings.ToUpper(t) + "]"
+		check := entityChecks[t]
+		text = entityPatterns[t].ReplaceAllStringFunc(text, func(m string) string {
+			if check != nil && !check(m) {
+				return m
+			}
+			return placeholder
+		})
+	}
+	return text
+}
+
+// Pseudonym returns an identifier standing for id, the same for the same
+// id and Key.
+func (s *Sanitizer) Pseudonym(id string) string {
+	s.once.Do(func() {
+		if len(s.Key) == 0 {
+			s.Key = make([]byte, 32)
+			rand.Read(s.Key)
+		}
+	})
+	mac := hmac.New(sha256.New, s.Key)
+	mac.Write([]byte(id))
+	return "id-" + hex.EncodeToString(mac.Sum(nil))[:12]
+}
+
+// sanitize applies s to what the sink writes of r.
+func (s *Sanitizer) sanitize(r *PageResult) {
+	if r.Bates != "" {
+		pseudonym := s.Pseudonym(r.Bates)
+		r.Text = strings.ReplaceAll(r.Text, r.Bates, pseudonym)
+		r.Bates = pseudonym
+	}
+	r.Text = s.Redact(r.Text)
+	for k, v := range r.Fields {
+		r.Fields[k] = s.redactValue(v)
+	}
+	for i := range r.NumberedLines {
+		r.NumberedLines[i].Text = s.Redact(r.NumberedLines[i].Text)
+	}
+	r.ImageHash = ImageHash{}
+}
+
+// redactValue redacts the strings of a field's value.
+func (s *Sanitizer) redactValue(v any) any {
+	switch v := v.(type) {
+	case string:
+		return s.Redact(v)
+	case []any:
+		for i, e := range v {
+			v[i] = s.redactValue(e)
+		}
+	case map[string]any:
+		for k, e := range v {
+			v[k] = s.redactValue(e)
+		}
+	}
+	return v
+}
+
+// checkSanitize reports settings that would save what Sanitize cannot
+// sanitize.
+func (e *Extractor) checkSanitize() error {
+	if e.Sanitize == nil {
+		return nil
+	}
+	var saved []string
+	for _, o := range []struct {
+		name string
+		set  bool
+	}{
+		{"Metadata", e.Metadata || len(e.MetadataMap) > 0},
+		{"Equations", e.equations()},
+		{"Figures", e.Figures},
+		{"OCRLayout", e.OCRLayout != ""},
+		{"ReviewThreshold", e.ReviewThreshold > 0},
+		{"Diagnostics", e.Diagnostics},
+		{"TOC", e.TOC},
+	} {
+		if o.set {
+			saved = append(saved, o.name)
+		}
+	}
+	if len(saved) > 0 {
+		return fmt.Errorf("Sanitize cannot be used with %s, which save what it cannot sanitize", strings.Join(saved, ", "))
+	}
+	for _, t := range e.Sanitize.Entities {
+		if !slices.Contains(Entities, t) {
+			return fmt.Errorf("unknown entity type %q (available: %s)", t, strings.Join(Entities, ", "))
+		}
+	}
+	return nil
+}
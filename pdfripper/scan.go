@@ -0,0 +1,233 @@
+package pdfripper
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+)
+
+// Kinds of Finding reported by Scan.
+const (
+	FindingJavaScript         = "javascript"          // Document or action JavaScript.
+	FindingLaunch             = "launch"              // An action that launches an application or file.
+	FindingEmbeddedExecutable = "embedded-executable" // An attached file that looks like a program or script.
+	FindingEmbeddedFile       = "embedded-file"       // Any other attached file; informational only.
+	FindingSuspiciousFilters  = "suspicious-filters"  // A filter chain typical of obfuscated content.
+)
+
+// Finding is one potentially dangerous feature of a PDF.
+type Finding struct {
+	Kind   string // One of the Finding* constants.
+	Object int    // Number of the object it was found in.
+	Detail string
+}
+
+func (f Finding) String() string {
+	return fmt.Sprintf("%s in object %d: %s", f.Kind, f.Object, f.Detail)
+}
+
+// ScanReport lists what Scan found, ordered by object number.
+type ScanReport struct {
+	Findings []Finding
+}
+
+// ActiveContent reports whether the document has any finding other than
+// plain embedded files.
+func (r *ScanReport) ActiveContent() bool {
+	for _, f := range r.Findings {
+		if f.Kind != FindingEmbeddedFile {
+			return true
+		}
+	}
+	return false
+}
+
+// ActiveContentError is returned by extraction when RejectActiveContent is
+// set and Scan finds active content.
+type ActiveContentError struct {
+	Report *ScanReport
+}
+
+func (e *ActiveContentError) Error() string {
+	var kinds []string
+	seen := map[string]bool{}
+	for _, f := range e.Report.Findings {
+		if f.Kind != FindingEmbeddedFile && !seen[f.Kind] {
+			seen[f.Kind] = true
+			kinds = append(kinds, f.Kind)
+		}
+	}
+	return "document contains active content: " + strings.Join(kinds, ", ")
+}
+
+// executableExtensions are attachment names treated as programs or scripts.
+var executableExtensions = map[string]bool{
+	".exe": true, ".dll": true, ".scr": true, ".com": true, ".bat": true, ".cmd": true,
+	".msi": true, ".ps1": true, ".vbs": true, ".vbe": true, ".js": true, ".jse": true,
+	".wsf": true, ".hta": true, ".jar": true, ".sh": true, ".app": true, ".elf": true,
+	".lnk": true, ".docm": true, ".xlsm": true, ".pptm": true,
+}
+
+// executableMagic are leading bytes of native executables and scripts.
+var executableMagic = [][]byte{
+	[]byte("MZ"),             // Windows PE
+	[]byte("\x7fELF"),        // ELF
+	{0xCF, 0xFA, 0xED, 0xFE}, // Mach-O 64-bit
+	{0xCE, 0xFA, 0xED, 0xFE}, // Mach-O 32-bit
+	{0xCA, 0xFE, 0xBA, 0xBE}, // Mach-O universal, Java class
+	[]byte("#!"),             // script with an interpreter line
+}
+
+// Scan looks through every object of a PDF for JavaScript, launch actions,
+// embedded files and suspicious filter chains without extracting any text.
+// It uses the built-in parser, so it works whichever backend extracts the
+// text.
+func Scan(pdfFile string) (report *ScanReport, err error) {
+	d, err := openPDFFile(pdfFile)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			report, err = nil, fmt.Errorf("scanning %s: %v", pdfFile, r)
+		}
+	}()
+
+	nums := make([]int, 0, len(d.xref))
+	for num := range d.xref {
+		nums = append(nums, num)
+	}
+	sort.Ints(nums)
+
+	report = &ScanReport{}
+	for _, num := range nums {
+		d.scanObject(report, num, d.object(num), 0)
+	}
+	return report, nil
+}
+
+// scanObject inspects obj, found in object num, and everything nested in
+// it. References are not followed; each object is scanned on its own.
+func (d *pdfDoc) scanObject(report *ScanReport, num int, obj pdfObject, depth int) {
+	if depth > 32 {
+		return
+	}
+	add := func(kind, detail string) {
+		report.Findings = append(report.Findings, Finding{Kind: kind, Object: num, Detail: detail})
+	}
+
+	switch v := obj.(type) {
+	case pdfArray:
+		for _, item := range v {
+			d.scanObject(report, num, item, depth+1)
+		}
+	case *pdfStream:
+		if reason := d.suspiciousFilters(v); reason != "" {
+			add(FindingSuspiciousFilters, reason)
+		}
+		d.scanObject(report, num, v.dict, depth+1)
+	case pdfDict:
+		switch d.resolveName(v["S"]) {
+		case "JavaScript":
+			add(FindingJavaScript, "JavaScript action")
+		case "Launch":
+			add(FindingLaunch, "launch action"+d.launchTarget(v))
+		}
+		if _, ok := v["JS"]; ok && d.resolveName(v["S"]) != "JavaScript" {
+			add(FindingJavaScript, "JS entry")
+		}
+		if _, ok := v["JavaScript"]; ok {
+			add(FindingJavaScript, "document-level JavaScript")
+		}
+		if ef := d.resolveDict(v["EF"]); ef != nil {
+			d.scanFileSpec(add, v, ef)
+		}
+		for _, item := range v {
+			d.scanObject(report, num, item, depth+1)
+		}
+	}
+}
+
+func (d *pdfDoc) launchTarget(action pdfDict) string {
+	target := d.resolve(action["F"])
+	if target == nil {
+		target = d.resolveDict(action["Win"])["F"]
+	}
+	switch t := d.resolve(target).(type) {
+	case pdfString:
+		return ": " + string(t)
+	case pdfDict:
+		if f, ok := d.resolve(t["F"]).(pdfString); ok {
+			return ": " + string(f)
+		}
+	}
+	return ""
+}
+
+// scanFileSpec reports an embedded file, as an executable if its name or
+// contents look like one.
+func (d *pdfDoc) scanFileSpec(add func(kind, detail string), spec, ef pdfDict) {
+	name := ""
+	for _, key := range []pdfName{"UF", "F", "DOS", "Unix", "Mac"} {
+		if s, ok := d.resolve(spec[key]).(pdfString); ok && len(s) > 0 {
+			name = textString(s)
+			break
+		}
+	}
+	kind := FindingEmbeddedFile
+	if executableExtensions[strings.ToLower(path.Ext(strings.ReplaceAll(name, "\\", "/")))] {
+		kind = FindingEmbeddedExecutable
+	}
+	if s := d.resolveStream(ef["F"]); s != nil && kind == FindingEmbeddedFile {
+		if data, err := d.decodeStream(s); err == nil {
+			for _, magic := range executableMagic {
+				if bytes.HasPrefix(data, magic) {
+					kind = FindingEmbeddedExecutable
+					break
+				}
+			}
+		}
+	}
+	if name == "" {
+		name = "unnamed attachment"
+	}
+	add(kind, name)
+}
+
+// suspiciousFilters describes what is unusual about a stream's filter
+// chain, or returns "" if nothing is. Legitimate producers use at most two
+// filters, an image codec or Flate optionally behind one ASCII encoding,
+// so long, repeated or doubly encoded chains point to obfuscation.
+func (d *pdfDoc) suspiciousFilters(s *pdfStream) string {
+	chain := d.resolveArray(s.dict["Filter"])
+	if len(chain) < 2 {
+		return ""
+	}
+	var names []string
+	seen := map[pdfName]bool{}
+	repeated, ascii := false, 0
+	for _, f := range chain {
+		name := d.resolveName(f)
+		names = append(names, string(name))
+		if seen[name] {
+			repeated = true
+		}
+		seen[name] = true
+		switch name {
+		case "ASCIIHexDecode", "AHx", "ASCII85Decode", "A85":
+			ascii++
+		}
+	}
+	chainDesc := strings.Join(names, " > ")
+	switch {
+	case len(chain) >= 3:
+		return fmt.Sprintf("%d filters: %s", len(chain), chainDesc)
+	case repeated:
+		return "repeated filter: " + chainDesc
+	case ascii >= 2:
+		return "double ASCII encoding: " + chainDesc
+	}
+	return ""
+}
@@ -0,0 +1,258 @@
+package pdfripper
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// Versions of the JSON the package and the pdfripper command write, which
+// each document or event carries in its schema_version field. Within a
+// version the schemas only grow:
+//
+//   - fields and event names may be added, so consumers must ignore
+//     fields and skip events they do not know;
+//   - fields are not removed or renamed, and keep their type and meaning;
+//   - fields tagged omitempty may be absent, and the others are always
+//     present;
+//   - columns of the CSV manifest are only added at the end.
+//
+// Any other change raises the version. The structs below are the
+// published form of each schema, and JSONSchema describes them.
+const (
+	ManifestSchemaVersion = 1 // manifest.json, Manifest.
+	PageSchemaVersion     = 1 // Pages as the server returns them, PagesResponse.
+	EventSchemaVersion    = 1 // Progress events, such as RunStartedEvent, one per line.
+)
+
+// Manifest is the document manifest.json holds. It is written as the run
+// goes, so the document fields come before the pages, except Agreement
+// and Tokens, which come after them.
+type Manifest struct {
+	SchemaVersion int               `json:"schema_version"`
+	Watermarked   bool              `json:"watermarked,omitempty"` // Present, like Watermarks, if watermarks were detected.
+	Watermarks    []Watermark       `json:"watermarks,omitempty"`
+	Metadata      map[string]string `json:"metadata,omitempty"` // Present if metadata was recorded.
+	Pages         []ManifestEntry   `json:"pages"`
+	Agreement     *AgreementReport  `json:"agreement,omitempty"` // Present if Extractor.Agreement compared any pages.
+	Tokens        int               `json:"tokens,omitempty"`    // The pages' tokens, if Extractor.Tokenizer is set.
+}
+
+// PageRecord is the JSON form of a PageResult.
+type PageRecord struct {
+	Page        int     `json:"page"`
+	Text        string  `json:"text"`
+	Width       float64 `json:"width,omitempty"` // Geometry, if it was loaded.
+	Height      float64 `json:"height,omitempty"`
+	Rotation    int     `json:"rotation,omitempty"`
+	Orientation string  `json:"orientation,omitempty"`
+	Class       string  `json:"class,omitempty"`
+	OCRUsed     bool    `json:"ocr_used,omitempty"`
+	Label       string  `json:"label,omitempty"` // The page's logical label, if pages were labelled.
+}
+
+// NewPageRecord returns the JSON form of a finished page.
+func NewPageRecord(r *PageResult) PageRecord {
+	p := PageRecord{Page: r.Page, Text: r.Text, Class: string(r.Class), OCRUsed: r.OCRUsed, Label: r.Label}
+	if g := r.Geometry; g != nil {
+		p.Width, p.Height, p.Rotation, p.Orientation = g.Width, g.Height, g.Rotation, g.Orientation()
+	}
+	return p
+}
+
+// PagesResponse is the body of a synchronous extraction by the server,
+// and the result of a finished job.
+type PagesResponse struct {
+	SchemaVersion int          `json:"schema_version"`
+	PageCount     int          `json:"page_count"`
+	Pages         []PageRecord `json:"pages"`
+}
+
+// Names of progress events.
+const (
+	EventRunStarted  = "run_started"
+	EventPageDone    = "page_done"
+	EventPageFailed  = "page_failed"
+	EventHeartbeat   = "heartbeat"
+	EventRunFinished = "run_finished"
+)
+
+// EventHeader holds the fields every progress event starts with; Event
+// names the struct it is, such as RunStartedEvent for EventRunStarted.
+type EventHeader struct {
+	Event         string    `json:"event"`
+	SchemaVersion int       `json:"schema_version"`
+	Time          time.Time `json:"time"`
+}
+
+// NewEventHeader returns the header of an event named name, timed now.
+func NewEventHeader(name string) EventHeader {
+	return EventHeader{Event: name, SchemaVersion: EventSchemaVersion, Time: time.Now().UTC()}
+}
+
+// RunStartedEvent reports the start of a run.
+type RunStartedEvent struct {
+	EventHeader
+	Input     string `json:"input"`
+	OutputDir string `json:"output_dir"` // A directory or remote URL.
+	Backend   string `json:"backend"`
+}
+
+// PageDoneEvent reports a saved page with its manifest entry.
+type PageDoneEvent struct {
+	EventHeader
+	ManifestEntry
+}
+
+// PageFailedEvent reports a page that could not be extracted.
+type PageFailedEvent struct {
+	EventHeader
+	Page  int    `json:"page"`
+	Error string `json:"error"`
+}
+
+// HeartbeatEvent reports the pages in flight.
+type HeartbeatEvent struct {
+	EventHeader
+	Done     int             `json:"done"`
+	Total    int             `json:"total"`
+	InFlight []HeartbeatPage `json:"in_flight"`
+	ETAMS    float64         `json:"eta_ms,omitempty"` // Estimated time left, absent until a page is done.
+}
+
+// HeartbeatPage is the JSON form of an InFlightPage.
+type HeartbeatPage struct {
+	Page      int     `json:"page"`
+	Stage     string  `json:"stage"`
+	ElapsedMS float64 `json:"elapsed_ms"`
+	Slow      bool    `json:"slow"`
+}
+
+// RunFinishedEvent reports the end of a run. A run answered from an
+// earlier one has Reused and OutputDir set and no RunStats.
+type RunFinishedEvent struct {
+	EventHeader
+	OK bool `json:"ok"`
+	*RunStats
+	Reused    bool   `json:"reused,omitempty"`
+	OutputDir string `json:"output_dir,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// RunStats are the totals of a run.
+type RunStats struct {
+	Pages      int     `json:"pages"` // Pages saved.
+	Failed     int     `json:"failed"`
+	OCRPages   int     `json:"ocr_pages"`
+	Chars      int     `json:"chars"`
+	Words      int     `json:"words"`
+	DurationMS float64 `json:"duration_ms"`
+}
+
+// Schemas are the names JSONSchema takes.
+var Schemas = []string{"manifest", "pages", "events"}
+
+// JSONSchema returns the JSON Schema of a published schema, one of
+// Schemas, derived from its structs. The schema of events matches any one
+// event.
+func JSONSchema(name string) ([]byte, error) {
+	var s map[string]any
+	switch name {
+	case "manifest":
+		s = schemaOf(reflect.TypeOf(Manifest{}))
+	case "pages":
+		s = schemaOf(reflect.TypeOf(PagesResponse{}))
+	case "events":
+		var events []any
+		for _, e := range []struct {
+			name string
+			v    any
+		}{
+			{EventRunStarted, RunStartedEvent{}},
+			{EventPageDone, PageDoneEvent{}},
+			{EventPageFailed, PageFailedEvent{}},
+			{EventHeartbeat, HeartbeatEvent{}},
+			{EventRunFinished, RunFinishedEvent{}},
+		} {
+			event := schemaOf(reflect.TypeOf(e.v))
+			event["properties"].(map[string]any)["event"] = map[string]any{"const": e.name}
+			events = append(events, event)
+		}
+		s = map[string]any{"oneOf": events}
+	default:
+		return nil, fmt.Errorf("unknown schema %q (available: %s)", name, strings.Join(Schemas, ", "))
+	}
+	s["$schema"] = "https://json-schema.org/draft/2020-12/schema"
+	s["title"] = "pdfripper " + name
+	return json.MarshalIndent(s, "", "  ")
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// schemaOf returns the JSON Schema of values of t as encoding/json writes
+// them.
+func schemaOf(t reflect.Type) map[string]any {
+	switch {
+	case t == timeType:
+		return map[string]any{"type": "string", "format": "date-time"}
+	case t.Kind() == reflect.Pointer:
+		return schemaOf(t.Elem())
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]any{"type": "array", "items": schemaOf(t.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": schemaOf(t.Elem())}
+	case reflect.Struct:
+		props := map[string]any{}
+		required := []string{}
+		structFields(t, props, &required, false)
+		return map[string]any{"type": "object", "properties": props, "required": required}
+	}
+	return map[string]any{}
+}
+
+// structFields adds the JSON fields of struct t to props, and those
+// always present to required. Fields of embedded structs are promoted, as
+// encoding/json does, and are optional if optional is set or they are
+// embedded by pointer.
+func structFields(t reflect.Type, props map[string]any, required *[]string, optional bool) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if f.Anonymous && name == "" {
+			ft := f.Type
+			if ft.Kind() == reflect.Pointer {
+				structFields(ft.Elem(), props, required, true)
+			} else {
+				structFields(ft, props, required, optional)
+			}
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		props[name] = schemaOf(f.Type)
+		if !optional && !strings.Contains(opts, "omitempty") {
+			*required = append(*required, name)
+		}
+	}
+}
@@ -0,0 +1,280 @@
+package pdfripper
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"regexp"
+	"sort"
+	"sync"
+)
+
+// Script is a per-page transform written in a small dialect of Starlark,
+// itself a dialect of Python. Its PostProcess calls the script's
+// transform function with each page, such as
+//
+//	# Drop blank pages, mark drafts and undo hyphenation.
+//	def transform(page):
+//	    if not page.text.strip():
+//	        return False
+//	    if "DRAFT" in page.text:
+//	        page.fields["draft"] = True
+//	    page.text = re.sub(r"(\w)-\n(\w)", "${1}${2}", page.text)
+//
+// A page has the attributes number, quality, ocr_used, classification
+// (the manifest's class), bates and label, and text and fields, which the script
+// may change. fields is a dict that ends up in the manifest; its keys must
+// be strings. transform keeps
+// the page by returning None or True, and drops it, so that it is not
+// written, by returning False.
+//
+// Scripts have def, lambda, if, for, comprehensions, the built-ins of
+// Starlark such as len, sorted and str, string, list and dict methods,
+// and an re module of Go's regular expressions. There is no while, and
+// functions may not call themselves, so a script always finishes; a call
+// of transform also may not run more than 10 million steps. Globals
+// cannot be changed once the script has loaded, so that pages can be
+// transformed concurrently. Unlike Starlark's, whose ints grow as large
+// as they need to, a script's ints are 64-bit: arithmetic that would go
+// past them fails with an "integer overflow" error.
+type Script struct {
+	name      string
+	transform *scriptFunc
+
+	mu      sync.Mutex
+	regexps map[string]*regexp.Regexp
+}
+
+// scriptMaxRegexps bounds the regular expressions a Script keeps compiled.
+const scriptMaxRegexps = 256
+
+// LoadScript reads and loads the script in path.
+func LoadScript(path string) (*Script, error) {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseScript(path, src)
+}
+
+// ParseScript loads the script src, running its top level; name is used
+// in error messages.
+func ParseScript(name string, src []byte) (*Script, error) {
+	stmts, err := parseScript(name, string(src))
+	if err != nil {
+		return nil, err
+	}
+	s := &Script{name: name}
+	globals := map[string]any{}
+	th := &scriptThread{script: s}
+	if _, _, err := th.exec(&scriptFrame{vars: globals, globals: globals}, stmts); err != nil {
+		return nil, err
+	}
+	for _, v := range globals {
+		freeze(v)
+	}
+	fn, ok := globals["transform"].(*scriptFunc)
+	if !ok {
+		return nil, fmt.Errorf("%s: no transform function", name)
+	}
+	params := fn.def.params
+	if len(params) == 0 || len(params) > 1 && params[1].dflt == nil {
+		return nil, fmt.Errorf("%s:%d: transform must take one argument, the page", name, fn.def.line)
+	}
+	s.transform = fn
+	return s, nil
+}
+
+// regexp returns pattern compiled, compiling it once only.
+func (s *Script) regexp(pattern string) (*regexp.Regexp, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if re, ok := s.regexps[pattern]; ok {
+		return re, nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	if s.regexps == nil || len(s.regexps) >= scriptMaxRegexps {
+		s.regexps = map[string]*regexp.Regexp{}
+	}
+	s.regexps[pattern] = re
+	return re, nil
+}
+
+// PostProcess runs the script's transform on r, setting its Text and
+// Fields to what the script leaves them and Dropped if it drops the page.
+func (s *Script) PostProcess(r *PageResult) error {
+	p := &scriptPage{r: r, text: r.Text, fields: newScriptDict()}
+	keys := make([]string, 0, len(r.Fields))
+	for k := range r.Fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		v, err := toScriptValue(r.Fields[k])
+		if err != nil {
+			return fmt.Errorf("field %s: %w", k, err)
+		}
+		p.fields.set(k, v)
+	}
+
+	th := &scriptThread{script: s}
+	v, err := th.callFunc(s.transform, []any{p}, nil)
+	if err != nil {
+		return err
+	}
+	switch v {
+	case nil, true:
+	case false:
+		r.Dropped = true
+	default:
+		return fmt.Errorf("%s: transform returned %s, not None, True or False", s.name, typeName(v))
+	}
+	fields, err := fromScriptValue(p.fields, 0)
+	if err != nil {
+		return fmt.Errorf("%s: page.fields: %w", s.name, err)
+	}
+	r.Text = p.text
+	r.Fields = nil
+	if m := fields.(map[string]any); len(m) > 0 {
+		r.Fields = m
+	}
+	return nil
+}
+
+// scriptPage is the page a script's transform is called with.
+type scriptPage struct {
+	r      *PageResult
+	text   string
+	fields *scriptDict
+}
+
+func (p *scriptPage) attr(name string) (any, error) {
+	switch name {
+	case "number":
+		return int64(p.r.Page), nil
+	case "text":
+		return p.text, nil
+	case "quality":
+		return p.r.Quality, nil
+	case "ocr_used":
+		return p.r.OCRUsed, nil
+	case "classification":
+		return string(p.r.Class), nil
+	case "bates":
+		return p.r.Bates, nil
+	case "label":
+		return p.r.Label, nil
+	case "fields":
+		return p.fields, nil
+	}
+	return nil, fmt.Errorf("page has no attribute %s", name)
+}
+
+func (p *scriptPage) setAttr(name string, v any) error {
+	switch name {
+	case "text":
+		s, ok := v.(string)
+		if !ok {
+			return fmt.Errorf("page.text must be a string, not %s", typeName(v))
+		}
+		p.text = s
+		return nil
+	case "fields":
+		d, ok := v.(*scriptDict)
+		if !ok {
+			return fmt.Errorf("page.fields must be a dict, not %s", typeName(v))
+		}
+		p.fields = d
+		return nil
+	}
+	if _, err := p.attr(name); err != nil {
+		return err
+	}
+	return fmt.Errorf("page.%s cannot be set", name)
+}
+
+// toScriptValue converts a value decoded from JSON, or set by a script
+// before, to a script value.
+func toScriptValue(v any) (any, error) {
+	switch v := v.(type) {
+	case nil, bool, string, int64, float64:
+		return v, nil
+	case int:
+		return int64(v), nil
+	case []any:
+		l := &scriptList{elems: make([]any, len(v))}
+		for i, e := range v {
+			var err error
+			if l.elems[i], err = toScriptValue(e); err != nil {
+				return nil, err
+			}
+		}
+		return l, nil
+	case map[string]any:
+		d := newScriptDict()
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			e, err := toScriptValue(v[k])
+			if err != nil {
+				return nil, err
+			}
+			d.set(k, e)
+		}
+		return d, nil
+	}
+	return nil, fmt.Errorf("unsupported value %T", v)
+}
+
+// fromScriptValue converts a script value to one JSON can encode.
+func fromScriptValue(v any, depth int) (any, error) {
+	if depth > 100 {
+		return nil, errors.New("value nested too deeply")
+	}
+	switch v := v.(type) {
+	case nil, bool, string, int64:
+		return v, nil
+	case float64:
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return nil, fmt.Errorf("%s is not a JSON number", formatScriptFloat(v))
+		}
+		return v, nil
+	case *scriptList:
+		return fromScriptElems(v.elems, depth)
+	case scriptTuple:
+		return fromScriptElems(v, depth)
+	case *scriptDict:
+		m := make(map[string]any, len(v.keys))
+		for i, k := range v.keys {
+			ks, ok := k.(string)
+			if !ok {
+				return nil, fmt.Errorf("key %s is not a string", scriptRepr(k))
+			}
+			e, err := fromScriptValue(v.values[i], depth+1)
+			if err != nil {
+				return nil, err
+			}
+			m[ks] = e
+		}
+		return m, nil
+	}
+	return nil, fmt.Errorf("%s cannot be saved", typeName(v))
+}
+
+func fromScriptElems(elems []any, depth int) ([]any, error) {
+	out := make([]any, len(elems))
+	for i, e := range elems {
+		var err error
+		if out[i], err = fromScriptValue(e, depth+1); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,1393 @@
+package pdfripper
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// scriptUniverse holds the built-in functions and modules of scripts. It
+// is filled in by init, since the built-ins call back into the evaluator.
+var scriptUniverse map[string]any
+
+func init() {
+	scriptUniverse = map[string]any{"re": scriptRe}
+	for name, fn := range map[string]func(th *scriptThread, b *scriptBuiltin, args []any, kwargs []scriptKwarg) (any, error){
+		"abs": builtinAbs, "all": builtinAll, "any": builtinAny, "bool": builtinBool, "dict": builtinDict,
+		"enumerate": builtinEnumerate, "fail": builtinFail, "float": builtinFloat, "getattr": builtinGetattr,
+		"hasattr": builtinHasattr, "int": builtinInt, "len": builtinLen, "list": builtinList, "max": builtinMinMax,
+		"min": builtinMinMax, "print": builtinPrint, "range": builtinRange, "repr": builtinRepr,
+		"reversed": builtinReversed, "sorted": builtinSorted, "str": builtinStr, "tuple": builtinTuple,
+		"type": builtinType, "zip": builtinZip,
+	} {
+		scriptUniverse[name] = &scriptBuiltin{name: name, fn: fn}
+	}
+}
+
+// unpackArgs sets the variables spec points to from args and kwargs.
+// spec alternates parameter names, those of optional ones ending in "?",
+// and pointers to *any, *string, *int64, *float64 or *bool, which take
+// any value by its truth.
+func unpackArgs(fn string, args []any, kwargs []scriptKwarg, spec ...any) error {
+	n := len(spec) / 2
+	if len(args) > n {
+		return fmt.Errorf("%s takes at most %d arguments, not %d", fn, n, len(args))
+	}
+	set := make([]bool, n)
+	name := func(i int) string { return strings.TrimSuffix(spec[2*i].(string), "?") }
+	assign := func(i int, v any) error {
+		set[i] = true
+		switch p := spec[2*i+1].(type) {
+		case *any:
+			*p = v
+		case *bool:
+			*p = truth(v)
+		case *string:
+			s, ok := v.(string)
+			if !ok {
+				return fmt.Errorf("%s: %s must be a string, not %s", fn, name(i), typeName(v))
+			}
+			*p = s
+		case *int64:
+			n, ok := v.(int64)
+			if !ok {
+				return fmt.Errorf("%s: %s must be an int, not %s", fn, name(i), typeName(v))
+			}
+			*p = n
+		case *float64:
+			f, ok := toFloat(v)
+			if !ok {
+				return fmt.Errorf("%s: %s must be a number, not %s", fn, name(i), typeName(v))
+			}
+			*p = f
+		default:
+			panic(fmt.Sprintf("unpackArgs: %T", p))
+		}
+		return nil
+	}
+	for i, a := range args {
+		if err := assign(i, a); err != nil {
+			return err
+		}
+	}
+	for _, kw := range kwargs {
+		i := 0
+		for i < n && name(i) != kw.name {
+			i++
+		}
+		switch {
+		case i == n:
+			return fmt.Errorf("%s has no parameter %s", fn, kw.name)
+		case set[i]:
+			return fmt.Errorf("%s got two values for %s", fn, kw.name)
+		}
+		if err := assign(i, kw.value); err != nil {
+			return err
+		}
+	}
+	for i := 0; i < n; i++ {
+		if !set[i] && !strings.HasSuffix(spec[2*i].(string), "?") {
+			return fmt.Errorf("%s is missing argument %s", fn, name(i))
+		}
+	}
+	return nil
+}
+
+func noKwargs(fn string, kwargs []scriptKwarg) error {
+	if len(kwargs) > 0 {
+		return fmt.Errorf("%s has no parameter %s", fn, kwargs[0].name)
+	}
+	return nil
+}
+
+// elements returns the elements of an iterable value, counting a step for
+// each so that a huge range cannot be listed.
+func (th *scriptThread) elements(v any) ([]any, error) {
+	it, err := iterate(v)
+	if err != nil {
+		return nil, err
+	}
+	var elems []any
+	for {
+		e, ok := it.next()
+		if !ok {
+			return elems, nil
+		}
+		if err := th.step(); err != nil {
+			return nil, err
+		}
+		elems = append(elems, e)
+	}
+}
+
+func builtinAbs(th *scriptThread, b *scriptBuiltin, args []any, kwargs []scriptKwarg) (any, error) {
+	var x any
+	if err := unpackArgs(b.name, args, kwargs, "x", &x); err != nil {
+		return nil, err
+	}
+	switch x := x.(type) {
+	case int64:
+		if x == math.MinInt64 {
+			return nil, errors.New("integer overflow")
+		}
+		return max(x, -x), nil
+	case float64:
+		return math.Abs(x), nil
+	}
+	return nil, fmt.Errorf("abs of %s", typeName(x))
+}
+
+func builtinAll(th *scriptThread, b *scriptBuiltin, args []any, kwargs []scriptKwarg) (any, error) {
+	return anyAll(th, b, args, kwargs, true)
+}
+
+func builtinAny(th *scriptThread, b *scriptBuiltin, args []any, kwargs []scriptKwarg) (any, error) {
+	return anyAll(th, b, args, kwargs, false)
+}
+
+func anyAll(th *scriptThread, b *scriptBuiltin, args []any, kwargs []scriptKwarg, all bool) (any, error) {
+	var x any
+	if err := unpackArgs(b.name, args, kwargs, "x", &x); err != nil {
+		return nil, err
+	}
+	elems, err := th.elements(x)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range elems {
+		if truth(e) != all {
+			return !all, nil
+		}
+	}
+	return all, nil
+}
+
+func builtinBool(th *scriptThread, b *scriptBuiltin, args []any, kwargs []scriptKwarg) (any, error) {
+	var x any = false
+	err := unpackArgs(b.name, args, kwargs, "x?", &x)
+	return truth(x), err
+}
+
+func builtinDict(th *scriptThread, b *scriptBuiltin, args []any, kwargs []scriptKwarg) (any, error) {
+	if len(args) > 1 {
+		return nil, fmt.Errorf("dict takes at most 1 positional argument, not %d", len(args))
+	}
+	d := newScriptDict()
+	if len(args) == 1 {
+		if err := dictUpdate(th, d, args[0]); err != nil {
+			return nil, err
+		}
+	}
+	for _, kw := range kwargs {
+		d.set(kw.name, kw.value)
+	}
+	return d, nil
+}
+
+// dictUpdate adds the entries of x, a dict or a list of pairs, to d.
+func dictUpdate(th *scriptThread, d *scriptDict, x any) error {
+	if other, ok := x.(*scriptDict); ok {
+		for i, k := range other.keys {
+			if err := d.set(k, other.values[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	pairs, err := th.elements(x)
+	if err != nil {
+		return err
+	}
+	for _, p := range pairs {
+		var kv []any
+		switch p := p.(type) {
+		case scriptTuple:
+			kv = p
+		case *scriptList:
+			kv = p.elems
+		}
+		if len(kv) != 2 {
+			return fmt.Errorf("dict entries must be pairs, not %s", scriptRepr(p))
+		}
+		if err := d.set(kv[0], kv[1]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func builtinEnumerate(th *scriptThread, b *scriptBuiltin, args []any, kwargs []scriptKwarg) (any, error) {
+	var x any
+	var start int64
+	if err := unpackArgs(b.name, args, kwargs, "x", &x, "start?", &start); err != nil {
+		return nil, err
+	}
+	elems, err := th.elements(x)
+	if err != nil {
+		return nil, err
+	}
+	l := &scriptList{}
+	for i, e := range elems {
+		l.elems = append(l.elems, scriptTuple{start + int64(i), e})
+	}
+	return l, nil
+}
+
+func builtinFail(th *scriptThread, b *scriptBuiltin, args []any, kwargs []scriptKwarg) (any, error) {
+	if err := noKwargs(b.name, kwargs); err != nil {
+		return nil, err
+	}
+	parts := make([]string, len(args))
+	for i, a := range args {
+		parts[i] = scriptStr(a)
+	}
+	return nil, errors.New("fail: " + strings.Join(parts, " "))
+}
+
+func builtinFloat(th *scriptThread, b *scriptBuiltin, args []any, kwargs []scriptKwarg) (any, error) {
+	var x any = 0.0
+	if err := unpackArgs(b.name, args, kwargs, "x?", &x); err != nil {
+		return nil, err
+	}
+	switch x := x.(type) {
+	case bool:
+		return float64(boolInt(x)), nil
+	case int64:
+		return float64(x), nil
+	case float64:
+		return x, nil
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(x), 64)
+		if err != nil {
+			return nil, fmt.Errorf("float: invalid number %q", x)
+		}
+		return f, nil
+	}
+	return nil, fmt.Errorf("float of %s", typeName(x))
+}
+
+func builtinGetattr(th *scriptThread, b *scriptBuiltin, args []any, kwargs []scriptKwarg) (any, error) {
+	var x, dflt any
+	var name string
+	if err := unpackArgs(b.name, args, kwargs, "x", &x, "name", &name, "default?", &dflt); err != nil {
+		return nil, err
+	}
+	v, err := scriptGetAttr(x, name)
+	if err != nil && len(args)+len(kwargs) == 3 {
+		return dflt, nil
+	}
+	return v, err
+}
+
+func builtinHasattr(th *scriptThread, b *scriptBuiltin, args []any, kwargs []scriptKwarg) (any, error) {
+	var x any
+	var name string
+	if err := unpackArgs(b.name, args, kwargs, "x", &x, "name", &name); err != nil {
+		return nil, err
+	}
+	_, err := scriptGetAttr(x, name)
+	return err == nil, nil
+}
+
+func builtinInt(th *scriptThread, b *scriptBuiltin, args []any, kwargs []scriptKwarg) (any, error) {
+	var x any = int64(0)
+	base := int64(10)
+	if err := unpackArgs(b.name, args, kwargs, "x?", &x, "base?", &base); err != nil {
+		return nil, err
+	}
+	switch x := x.(type) {
+	case bool:
+		return boolInt(x), nil
+	case int64:
+		return x, nil
+	case float64:
+		if math.IsNaN(x) || math.IsInf(x, 0) || math.Abs(x) >= 1<<63 {
+			return nil, fmt.Errorf("int: %s out of range", formatScriptFloat(x))
+		}
+		return int64(x), nil
+	case string:
+		s := strings.ReplaceAll(strings.TrimSpace(x), "_", "")
+		if base == 0 || base == 16 && strings.HasPrefix(strings.ToLower(strings.TrimLeft(s, "+-")), "0x") {
+			n, err := strconv.ParseInt(s, 0, 64)
+			if err == nil {
+				return n, nil
+			}
+		}
+		n, err := strconv.ParseInt(s, int(base), 64)
+		if err != nil {
+			return nil, fmt.Errorf("int: invalid number %q", x)
+		}
+		return n, nil
+	}
+	return nil, fmt.Errorf("int of %s", typeName(x))
+}
+
+func builtinLen(th *scriptThread, b *scriptBuiltin, args []any, kwargs []scriptKwarg) (any, error) {
+	var x any
+	if err := unpackArgs(b.name, args, kwargs, "x", &x); err != nil {
+		return nil, err
+	}
+	n, ok := scriptLen(x)
+	if !ok {
+		return nil, fmt.Errorf("%s has no length", typeName(x))
+	}
+	return int64(n), nil
+}
+
+func builtinList(th *scriptThread, b *scriptBuiltin, args []any, kwargs []scriptKwarg) (any, error) {
+	var x any = scriptTuple{}
+	if err := unpackArgs(b.name, args, kwargs, "x?", &x); err != nil {
+		return nil, err
+	}
+	elems, err := th.elements(x)
+	return &scriptList{elems: elems}, err
+}
+
+func builtinTuple(th *scriptThread, b *scriptBuiltin, args []any, kwargs []scriptKwarg) (any, error) {
+	var x any = scriptTuple{}
+	if err := unpackArgs(b.name, args, kwargs, "x?", &x); err != nil {
+		return nil, err
+	}
+	elems, err := th.elements(x)
+	return scriptTuple(elems), err
+}
+
+// builtinMinMax implements min and max, of their arguments or of the
+// elements of their one argument, compared by key if it is given.
+func builtinMinMax(th *scriptThread, b *scriptBuiltin, args []any, kwargs []scriptKwarg) (any, error) {
+	var key any
+	if err := unpackArgs(b.name, nil, kwargs, "key?", &key); err != nil {
+		return nil, err
+	}
+	elems := args
+	if len(args) == 1 {
+		var err error
+		if elems, err = th.elements(args[0]); err != nil {
+			return nil, err
+		}
+	}
+	if len(elems) == 0 {
+		return nil, fmt.Errorf("%s of nothing", b.name)
+	}
+	keys, err := th.sortKeys(elems, key)
+	if err != nil {
+		return nil, err
+	}
+	best := 0
+	for i := 1; i < len(elems); i++ {
+		c, err := scriptCmp(keys[i], keys[best])
+		if err != nil {
+			return nil, err
+		}
+		if b.name == "min" && c < 0 || b.name == "max" && c > 0 {
+			best = i
+		}
+	}
+	return elems[best], nil
+}
+
+// sortKeys returns the keys elems are compared by: themselves, or what
+// key returns for them.
+func (th *scriptThread) sortKeys(elems []any, key any) ([]any, error) {
+	if key == nil {
+		return elems, nil
+	}
+	keys := make([]any, len(elems))
+	for i, e := range elems {
+		k, err := th.call(key, []any{e}, nil)
+		if err != nil {
+			return nil, err
+		}
+		keys[i] = k
+	}
+	return keys, nil
+}
+
+func builtinPrint(th *scriptThread, b *scriptBuiltin, args []any, kwargs []scriptKwarg) (any, error) {
+	sep := " "
+	if err := unpackArgs(b.name, nil, kwargs, "sep?", &sep); err != nil {
+		return nil, err
+	}
+	parts := make([]string, len(args))
+	for i, a := range args {
+		parts[i] = scriptStr(a)
+	}
+	fmt.Fprintln(os.Stderr, strings.Join(parts, sep))
+	return nil, nil
+}
+
+func builtinRange(th *scriptThread, b *scriptBuiltin, args []any, kwargs []scriptKwarg) (any, error) {
+	if err := noKwargs(b.name, kwargs); err != nil {
+		return nil, err
+	}
+	if len(args) == 0 || len(args) > 3 {
+		return nil, fmt.Errorf("range takes 1 to 3 arguments, not %d", len(args))
+	}
+	ns := make([]int64, len(args))
+	for i, a := range args {
+		n, ok := a.(int64)
+		if !ok {
+			return nil, fmt.Errorf("range: arguments must be ints, not %s", typeName(a))
+		}
+		ns[i] = n
+	}
+	r := scriptRange{step: 1}
+	switch len(ns) {
+	case 1:
+		r.stop = ns[0]
+	case 2:
+		r.start, r.stop = ns[0], ns[1]
+	case 3:
+		r.start, r.stop, r.step = ns[0], ns[1], ns[2]
+	}
+	if r.step == 0 {
+		return nil, errors.New("range: step must not be zero")
+	}
+	return r, nil
+}
+
+func builtinRepr(th *scriptThread, b *scriptBuiltin, args []any, kwargs []scriptKwarg) (any, error) {
+	var x any
+	err := unpackArgs(b.name, args, kwargs, "x", &x)
+	return scriptRepr(x), err
+}
+
+func builtinStr(th *scriptThread, b *scriptBuiltin, args []any, kwargs []scriptKwarg) (any, error) {
+	var x any = ""
+	err := unpackArgs(b.name, args, kwargs, "x?", &x)
+	return scriptStr(x), err
+}
+
+func builtinReversed(th *scriptThread, b *scriptBuiltin, args []any, kwargs []scriptKwarg) (any, error) {
+	var x any
+	if err := unpackArgs(b.name, args, kwargs, "x", &x); err != nil {
+		return nil, err
+	}
+	elems, err := th.elements(x)
+	if err != nil {
+		return nil, err
+	}
+	l := &scriptList{elems: make([]any, len(elems))}
+	for i, e := range elems {
+		l.elems[len(elems)-1-i] = e
+	}
+	return l, nil
+}
+
+func builtinSorted(th *scriptThread, b *scriptBuiltin, args []any, kwargs []scriptKwarg) (any, error) {
+	var x, key any
+	var reverse bool
+	if err := unpackArgs(b.name, args, kwargs, "x", &x, "key?", &key, "reverse?", &reverse); err != nil {
+		return nil, err
+	}
+	elems, err := th.elements(x)
+	if err != nil {
+		return nil, err
+	}
+	keys, err := th.sortKeys(elems, key)
+	if err != nil {
+		return nil, err
+	}
+	order := make([]int, len(elems))
+	for i := range order {
+		order[i] = i
+	}
+	var cmpErr error
+	sort.SliceStable(order, func(i, j int) bool {
+		c, err := scriptCmp(keys[order[i]], keys[order[j]])
+		if err != nil && cmpErr == nil {
+			cmpErr = err
+		}
+		if reverse {
+			return c > 0
+		}
+		return c < 0
+	})
+	if cmpErr != nil {
+		return nil, cmpErr
+	}
+	l := &scriptList{elems: make([]any, len(elems))}
+	for i, j := range order {
+		l.elems[i] = elems[j]
+	}
+	return l, nil
+}
+
+func builtinType(th *scriptThread, b *scriptBuiltin, args []any, kwargs []scriptKwarg) (any, error) {
+	var x any
+	err := unpackArgs(b.name, args, kwargs, "x", &x)
+	return typeName(x), err
+}
+
+func builtinZip(th *scriptThread, b *scriptBuiltin, args []any, kwargs []scriptKwarg) (any, error) {
+	if err := noKwargs(b.name, kwargs); err != nil {
+		return nil, err
+	}
+	var lists [][]any
+	n := -1
+	for _, a := range args {
+		elems, err := th.elements(a)
+		if err != nil {
+			return nil, err
+		}
+		lists = append(lists, elems)
+		if n < 0 || len(elems) < n {
+			n = len(elems)
+		}
+	}
+	l := &scriptList{}
+	for i := 0; i < n; i++ {
+		t := make(scriptTuple, len(lists))
+		for j := range lists {
+			t[j] = lists[j][i]
+		}
+		l.elems = append(l.elems, t)
+	}
+	return l, nil
+}
+
+type scriptMethod = func(th *scriptThread, b *scriptBuiltin, args []any, kwargs []scriptKwarg) (any, error)
+
+// scriptMethods are the methods of strings, lists and dicts, by type name.
+var scriptMethods map[string]map[string]scriptMethod
+
+func init() {
+	scriptMethods = map[string]map[string]scriptMethod{
+		"string": {
+			"capitalize": strCase, "count": strCount, "endswith": strAffix, "find": strFind, "format": strFormat,
+			"index": strFind, "isalnum": strIs, "isalpha": strIs, "isdigit": strIs, "islower": strIs,
+			"isspace": strIs, "isupper": strIs, "join": strJoin, "lower": strCase, "lstrip": strStrip,
+			"partition": strPartition, "removeprefix": strRemove, "removesuffix": strRemove, "replace": strReplace,
+			"rfind": strFind, "rindex": strFind, "rpartition": strPartition, "rstrip": strStrip, "split": strSplit,
+			"splitlines": strSplitlines, "startswith": strAffix, "strip": strStrip, "title": strCase, "upper": strCase,
+		},
+		"list": {
+			"append": listAppend, "clear": listClear, "extend": listExtend, "index": listIndex,
+			"insert": listInsert, "pop": listPop, "remove": listRemove,
+		},
+		"dict": {
+			"clear": dictClear, "get": dictGet, "items": dictItems, "keys": dictKeys, "pop": dictPop,
+			"setdefault": dictSetdefault, "update": dictUpdateMethod, "values": dictValues,
+		},
+	}
+}
+
+// scriptGetAttr returns the attribute name of x: a method, a member of a
+// module or a field of a page.
+func scriptGetAttr(x any, name string) (any, error) {
+	switch x := x.(type) {
+	case *scriptPage:
+		return x.attr(name)
+	case *scriptModule:
+		if v, ok := x.members[name]; ok {
+			return v, nil
+		}
+	}
+	if m, ok := scriptMethods[typeName(x)][name]; ok {
+		return &scriptBuiltin{name: typeName(x) + "." + name, recv: x, fn: m}, nil
+	}
+	return nil, fmt.Errorf("%s has no attribute %s", typeName(x), name)
+}
+
+func scriptSetAttr(x any, name string, v any) error {
+	if p, ok := x.(*scriptPage); ok {
+		return p.setAttr(name, v)
+	}
+	return fmt.Errorf("cannot set attributes of %s", typeName(x))
+}
+
+// method returns the name of the method b is, without its type.
+func method(b *scriptBuiltin) string {
+	return b.name[strings.IndexByte(b.name, '.')+1:]
+}
+
+func strCase(th *scriptThread, b *scriptBuiltin, args []any, kwargs []scriptKwarg) (any, error) {
+	if err := unpackArgs(b.name, args, kwargs); err != nil {
+		return nil, err
+	}
+	s := b.recv.(string)
+	switch method(b) {
+	case "lower":
+		return strings.ToLower(s), nil
+	case "upper":
+		return strings.ToUpper(s), nil
+	case "capitalize":
+		r, size := utf8.DecodeRuneInString(s)
+		return string(unicode.ToUpper(r)) + strings.ToLower(s[size:]), nil
+	}
+	// title
+	var out strings.Builder
+	prev := false
+	for _, r := range s {
+		if unicode.IsLetter(r) {
+			if prev {
+				r = unicode.ToLower(r)
+			} else {
+				r = unicode.ToTitle(r)
+			}
+		}
+		prev = unicode.IsLetter(r)
+		out.WriteRune(r)
+	}
+	return out.String(), nil
+}
+
+func strIs(th *scriptThread, b *scriptBuiltin, args []any, kwargs []scriptKwarg) (any, error) {
+	if err := unpackArgs(b.name, args, kwargs); err != nil {
+		return nil, err
+	}
+	s := b.recv.(string)
+	if s == "" {
+		return false, nil
+	}
+	cased := false
+	for _, r := range s {
+		var ok bool
+		switch method(b) {
+		case "isalnum":
+			ok = unicode.IsLetter(r) || unicode.IsDigit(r)
+		case "isalpha":
+			ok = unicode.IsLetter(r)
+		case "isdigit":
+			ok = unicode.IsDigit(r)
+		case "isspace":
+			ok = unicode.IsSpace(r)
+		case "islower":
+			ok = !unicode.IsUpper(r)
+			cased = cased || unicode.IsLower(r)
+		case "isupper":
+			ok = !unicode.IsLower(r)
+			cased = cased || unicode.IsUpper(r)
+		}
+		if !ok {
+			return false, nil
+		}
+	}
+	switch method(b) {
+	case "islower", "isupper":
+		return cased, nil
+	}
+	return true, nil
+}
+
+func strCount(th *scriptThread, b *scriptBuiltin, args []any, kwargs []scriptKwarg) (any, error) {
+	var sub string
+	if err := unpackArgs(b.name, args, kwargs, "sub", &sub); err != nil {
+		return nil, err
+	}
+	s := b.recv.(string)
+	if sub == "" {
+		return int64(utf8.RuneCountInString(s) + 1), nil
+	}
+	return int64(strings.Count(s, sub)), nil
+}
+
+// strAffix implements startswith and endswith, whose argument may be a
+// tuple of strings to try.
+func strAffix(th *scriptThread, b *scriptBuiltin, args []any, kwargs []scriptKwarg) (any, error) {
+	var x any
+	if err := unpackArgs(b.name, args, kwargs, "affix", &x); err != nil {
+		return nil, err
+	}
+	affixes := []any{x}
+	if t, ok := x.(scriptTuple); ok {
+		affixes = t
+	}
+	s := b.recv.(string)
+	for _, a := range affixes {
+		affix, ok := a.(string)
+		if !ok {
+			return nil, fmt.Errorf("%s: affix must be a string, not %s", b.name, typeName(a))
+		}
+		if method(b) == "startswith" && strings.HasPrefix(s, affix) || method(b) == "endswith" && strings.HasSuffix(s, affix) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// strFind implements find, rfind, index and rindex, which give
+// positions in characters.
+func strFind(th *scriptThread, b *scriptBuiltin, args []any, kwargs []scriptKwarg) (any, error) {
+	var sub string
+	if err := unpackArgs(b.name, args, kwargs, "sub", &sub); err != nil {
+		return nil, err
+	}
+	s := b.recv.(string)
+	var i int
+	if strings.HasPrefix(method(b), "r") {
+		i = strings.LastIndex(s, sub)
+	} else {
+		i = strings.Index(s, sub)
+	}
+	if i < 0 {
+		if strings.HasSuffix(method(b), "index") {
+			return nil, fmt.Errorf("%s: substring %q not found", b.name, sub)
+		}
+		return int64(-1), nil
+	}
+	return int64(utf8.RuneCountInString(s[:i])), nil
+}
+
+func strJoin(th *scriptThread, b *scriptBuiltin, args []any, kwargs []scriptKwarg) (any, error) {
+	var x any
+	if err := unpackArgs(b.name, args, kwargs, "elems", &x); err != nil {
+		return nil, err
+	}
+	elems, err := th.elements(x)
+	if err != nil {
+		return nil, err
+	}
+	parts := make([]string, len(elems))
+	size := 0
+	for i, e := range elems {
+		s, ok := e.(string)
+		if !ok {
+			return nil, fmt.Errorf("%s: element %d is %s, not a string", b.name, i, typeName(e))
+		}
+		parts[i] = s
+		size += len(s) + len(b.recv.(string))
+	}
+	if size > scriptMaxString {
+		return nil, errors.New("string too long")
+	}
+	return strings.Join(parts, b.recv.(string)), nil
+}
+
+func strStrip(th *scriptThread, b *scriptBuiltin, args []any, kwargs []scriptKwarg) (any, error) {
+	var chars any
+	if err := unpackArgs(b.name, args, kwargs, "chars?", &chars); err != nil {
+		return nil, err
+	}
+	s := b.recv.(string)
+	trim := strings.TrimSpace
+	switch method(b) {
+	case "lstrip":
+		trim = func(s string) string { return strings.TrimLeftFunc(s, unicode.IsSpace) }
+	case "rstrip":
+		trim = func(s string) string { return strings.TrimRightFunc(s, unicode.IsSpace) }
+	}
+	if chars != nil {
+		cs, ok := chars.(string)
+		if !ok {
+			return nil, fmt.Errorf("%s: chars must be a string, not %s", b.name, typeName(chars))
+		}
+		switch method(b) {
+		case "lstrip":
+			return strings.TrimLeft(s, cs), nil
+		case "rstrip":
+			return strings.TrimRight(s, cs), nil
+		}
+		return strings.Trim(s, cs), nil
+	}
+	return trim(s), nil
+}
+
+func strPartition(th *scriptThread, b *scriptBuiltin, args []any, kwargs []scriptKwarg) (any, error) {
+	var sep string
+	if err := unpackArgs(b.name, args, kwargs, "sep", &sep); err != nil {
+		return nil, err
+	}
+	if sep == "" {
+		return nil, fmt.Errorf("%s: empty separator", b.name)
+	}
+	s := b.recv.(string)
+	if method(b) == "rpartition" {
+		i := strings.LastIndex(s, sep)
+		if i < 0 {
+			return scriptTuple{"", "", s}, nil
+		}
+		return scriptTuple{s[:i], sep, s[i+len(sep):]}, nil
+	}
+	before, after, found := strings.Cut(s, sep)
+	if !found {
+		return scriptTuple{s, "", ""}, nil
+	}
+	return scriptTuple{before, sep, after}, nil
+}
+
+func strRemove(th *scriptThread, b *scriptBuiltin, args []any, kwargs []scriptKwarg) (any, error) {
+	var affix string
+	if err := unpackArgs(b.name, args, kwargs, "affix", &affix); err != nil {
+		return nil, err
+	}
+	if method(b) == "removeprefix" {
+		return strings.TrimPrefix(b.recv.(string), affix), nil
+	}
+	return strings.TrimSuffix(b.recv.(string), affix), nil
+}
+
+func strReplace(th *scriptThread, b *scriptBuiltin, args []any, kwargs []scriptKwarg) (any, error) {
+	var old, new string
+	count := int64(-1)
+	if err := unpackArgs(b.name, args, kwargs, "old", &old, "new", &new, "count?", &count); err != nil {
+		return nil, err
+	}
+	s := b.recv.(string)
+	if n := strings.Count(s, old); len(s)+n*(len(new)-len(old)) > scriptMaxString {
+		return nil, errors.New("string too long")
+	}
+	return strings.Replace(s, old, new, int(count)), nil
+}
+
+func strSplit(th *scriptThread, b *scriptBuiltin, args []any, kwargs []scriptKwarg) (any, error) {
+	var sep any
+	maxsplit := int64(-1)
+	if err := unpackArgs(b.name, args, kwargs, "sep?", &sep, "maxsplit?", &maxsplit); err != nil {
+		return nil, err
+	}
+	s := b.recv.(string)
+	var parts []string
+	switch sep := sep.(type) {
+	case nil:
+		// Runs of white space separate, and none are left at the ends.
+		rest := strings.TrimLeftFunc(s, unicode.IsSpace)
+		for rest != "" {
+			if maxsplit >= 0 && int64(len(parts)) == maxsplit {
+				parts = append(parts, rest)
+				break
+			}
+			i := strings.IndexFunc(rest, unicode.IsSpace)
+			if i < 0 {
+				parts = append(parts, rest)
+				break
+			}
+			parts = append(parts, rest[:i])
+			rest = strings.TrimLeftFunc(rest[i:], unicode.IsSpace)
+		}
+	case string:
+		if sep == "" {
+			return nil, fmt.Errorf("%s: empty separator", b.name)
+		}
+		if maxsplit < 0 {
+			parts = strings.Split(s, sep)
+		} else {
+			parts = strings.SplitN(s, sep, int(maxsplit)+1)
+		}
+	default:
+		return nil, fmt.Errorf("%s: sep must be a string, not %s", b.name, typeName(sep))
+	}
+	return stringList(parts), nil
+}
+
+func stringList(parts []string) *scriptList {
+	l := &scriptList{elems: make([]any, len(parts))}
+	for i, p := range parts {
+		l.elems[i] = p
+	}
+	return l
+}
+
+func strSplitlines(th *scriptThread, b *scriptBuiltin, args []any, kwargs []scriptKwarg) (any, error) {
+	var keepends bool
+	if err := unpackArgs(b.name, args, kwargs, "keepends?", &keepends); err != nil {
+		return nil, err
+	}
+	s := b.recv.(string)
+	var lines []string
+	for s != "" {
+		i := strings.IndexAny(s, "\r\n")
+		if i < 0 {
+			lines = append(lines, s)
+			break
+		}
+		end := i + 1
+		if strings.HasPrefix(s[i:], "\r\n") {
+			end++
+		}
+		if keepends {
+			lines = append(lines, s[:end])
+		} else {
+			lines = append(lines, s[:i])
+		}
+		s = s[end:]
+	}
+	return stringList(lines), nil
+}
+
+// strFormat implements format, with {} fields numbered automatically or
+// by position, or naming keyword arguments, and {{ and }} for braces.
+// Format specifications after a colon are not supported.
+func strFormat(th *scriptThread, b *scriptBuiltin, args []any, kwargs []scriptKwarg) (any, error) {
+	s := b.recv.(string)
+	var out strings.Builder
+	auto := 0
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '{' && strings.HasPrefix(s[i:], "{{"), c == '}' && strings.HasPrefix(s[i:], "}}"):
+			out.WriteByte(c)
+			i++
+			continue
+		case c == '}':
+			return nil, fmt.Errorf("%s: single } in format string", b.name)
+		case c != '{':
+			out.WriteByte(c)
+			continue
+		}
+		end := strings.IndexByte(s[i:], '}')
+		if end < 0 {
+			return nil, fmt.Errorf("%s: unclosed { in format string", b.name)
+		}
+		field := s[i+1 : i+end]
+		i += end
+		conv := scriptStr
+		if name, c, ok := strings.Cut(field, "!"); ok {
+			field = name
+			switch c {
+			case "r":
+				conv = scriptRepr
+			case "s":
+			default:
+				return nil, fmt.Errorf("%s: unknown conversion !%s", b.name, c)
+			}
+		}
+		if strings.Contains(field, ":") {
+			return nil, fmt.Errorf("%s: format specifications such as %q are not supported; use %% formatting", b.name, field)
+		}
+		var v any
+		switch n, err := strconv.Atoi(field); {
+		case field == "":
+			if auto >= len(args) {
+				return nil, fmt.Errorf("%s: not enough arguments for the format string", b.name)
+			}
+			v = args[auto]
+			auto++
+		case err == nil:
+			if n < 0 || n >= len(args) {
+				return nil, fmt.Errorf("%s: no argument %d", b.name, n)
+			}
+			v = args[n]
+		default:
+			found := false
+			for _, kw := range kwargs {
+				if kw.name == field {
+					v, found = kw.value, true
+				}
+			}
+			if !found {
+				return nil, fmt.Errorf("%s: no argument %s", b.name, field)
+			}
+		}
+		out.WriteString(conv(v))
+	}
+	return out.String(), nil
+}
+
+// scriptPercent implements format % args, with the conversions %s, %r,
+// %d, %i, %f, %e, %g, %x, %o and %%, and the flags, widths and
+// precisions of Go's fmt.
+func scriptPercent(format string, x any) (any, error) {
+	args := []any{x}
+	if t, ok := x.(scriptTuple); ok {
+		args = t
+	}
+	var out strings.Builder
+	n := 0
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' {
+			out.WriteByte(format[i])
+			continue
+		}
+		j := i + 1
+		for j < len(format) && strings.IndexByte("#0- +.0123456789", format[j]) >= 0 {
+			j++
+		}
+		if j == len(format) {
+			return nil, errors.New("incomplete format")
+		}
+		verb, spec := format[j], format[i:j]
+		i = j
+		if verb == '%' {
+			out.WriteByte('%')
+			continue
+		}
+		if n >= len(args) {
+			return nil, errors.New("not enough arguments for format string")
+		}
+		v := args[n]
+		n++
+		switch verb {
+		case 's':
+			fmt.Fprintf(&out, spec+"s", scriptStr(v))
+		case 'r':
+			fmt.Fprintf(&out, spec+"s", scriptRepr(v))
+		case 'd', 'i', 'x', 'X', 'o':
+			var num int64
+			switch v := v.(type) {
+			case int64:
+				num = v
+			case float64:
+				num = int64(v)
+			default:
+				return nil, fmt.Errorf("%%%c needs a number, not %s", verb, typeName(v))
+			}
+			if verb == 'i' {
+				verb = 'd'
+			}
+			fmt.Fprintf(&out, spec+string(verb), num)
+		case 'f', 'F', 'e', 'E', 'g', 'G':
+			f, ok := toFloat(v)
+			if !ok {
+				return nil, fmt.Errorf("%%%c needs a number, not %s", verb, typeName(v))
+			}
+			fmt.Fprintf(&out, spec+string(verb), f)
+		default:
+			return nil, fmt.Errorf("unknown conversion %%%c", verb)
+		}
+	}
+	if n < len(args) {
+		return nil, errors.New("not all arguments converted during string formatting")
+	}
+	return out.String(), nil
+}
+
+func mutableList(b *scriptBuiltin) (*scriptList, error) {
+	l := b.recv.(*scriptList)
+	if l.frozen {
+		return nil, errScriptFrozen
+	}
+	return l, nil
+}
+
+func listAppend(th *scriptThread, b *scriptBuiltin, args []any, kwargs []scriptKwarg) (any, error) {
+	var x any
+	if err := unpackArgs(b.name, args, kwargs, "x", &x); err != nil {
+		return nil, err
+	}
+	l, err := mutableList(b)
+	if err != nil {
+		return nil, err
+	}
+	if len(l.elems) >= scriptMaxList {
+		return nil, errors.New("list too long")
+	}
+	l.elems = append(l.elems, x)
+	return nil, nil
+}
+
+func listClear(th *scriptThread, b *scriptBuiltin, args []any, kwargs []scriptKwarg) (any, error) {
+	if err := unpackArgs(b.name, args, kwargs); err != nil {
+		return nil, err
+	}
+	l, err := mutableList(b)
+	if err != nil {
+		return nil, err
+	}
+	l.elems = nil
+	return nil, nil
+}
+
+func listExtend(th *scriptThread, b *scriptBuiltin, args []any, kwargs []scriptKwarg) (any, error) {
+	var x any
+	if err := unpackArgs(b.name, args, kwargs, "x", &x); err != nil {
+		return nil, err
+	}
+	l, err := mutableList(b)
+	if err != nil {
+		return nil, err
+	}
+	elems, err := th.elements(x)
+	if err != nil {
+		return nil, err
+	}
+	if len(l.elems)+len(elems) > scriptMaxList {
+		return nil, errors.New("list too long")
+	}
+	l.elems = append(l.elems, elems...)
+	return nil, nil
+}
+
+func listIndex(th *scriptThread, b *scriptBuiltin, args []any, kwargs []scriptKwarg) (any, error) {
+	var x any
+	if err := unpackArgs(b.name, args, kwargs, "x", &x); err != nil {
+		return nil, err
+	}
+	for i, e := range b.recv.(*scriptList).elems {
+		if scriptEqual(e, x) {
+			return int64(i), nil
+		}
+	}
+	return nil, fmt.Errorf("%s: %s not in list", b.name, scriptRepr(x))
+}
+
+func listInsert(th *scriptThread, b *scriptBuiltin, args []any, kwargs []scriptKwarg) (any, error) {
+	var i int64
+	var x any
+	if err := unpackArgs(b.name, args, kwargs, "index", &i, "x", &x); err != nil {
+		return nil, err
+	}
+	l, err := mutableList(b)
+	if err != nil {
+		return nil, err
+	}
+	n := int64(len(l.elems))
+	if i < 0 {
+		i += n
+	}
+	i = min(max(i, 0), n)
+	l.elems = append(l.elems[:i], append([]any{x}, l.elems[i:]...)...)
+	return nil, nil
+}
+
+func listPop(th *scriptThread, b *scriptBuiltin, args []any, kwargs []scriptKwarg) (any, error) {
+	var at any = int64(-1)
+	if err := unpackArgs(b.name, args, kwargs, "index?", &at); err != nil {
+		return nil, err
+	}
+	l, err := mutableList(b)
+	if err != nil {
+		return nil, err
+	}
+	i, err := seqIndex(at, len(l.elems))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", b.name, err)
+	}
+	v := l.elems[i]
+	l.elems = append(l.elems[:i], l.elems[i+1:]...)
+	return v, nil
+}
+
+func listRemove(th *scriptThread, b *scriptBuiltin, args []any, kwargs []scriptKwarg) (any, error) {
+	var x any
+	if err := unpackArgs(b.name, args, kwargs, "x", &x); err != nil {
+		return nil, err
+	}
+	l, err := mutableList(b)
+	if err != nil {
+		return nil, err
+	}
+	for i, e := range l.elems {
+		if scriptEqual(e, x) {
+			l.elems = append(l.elems[:i], l.elems[i+1:]...)
+			return nil, nil
+		}
+	}
+	return nil, fmt.Errorf("%s: %s not in list", b.name, scriptRepr(x))
+}
+
+func dictClear(th *scriptThread, b *scriptBuiltin, args []any, kwargs []scriptKwarg) (any, error) {
+	if err := unpackArgs(b.name, args, kwargs); err != nil {
+		return nil, err
+	}
+	d := b.recv.(*scriptDict)
+	if d.frozen {
+		return nil, errScriptFrozen
+	}
+	*d = *newScriptDict()
+	return nil, nil
+}
+
+func dictGet(th *scriptThread, b *scriptBuiltin, args []any, kwargs []scriptKwarg) (any, error) {
+	var k, dflt any
+	if err := unpackArgs(b.name, args, kwargs, "key", &k, "default?", &dflt); err != nil {
+		return nil, err
+	}
+	v, found, err := b.recv.(*scriptDict).get(k)
+	if err != nil || !found {
+		return dflt, err
+	}
+	return v, nil
+}
+
+func dictItems(th *scriptThread, b *scriptBuiltin, args []any, kwargs []scriptKwarg) (any, error) {
+	if err := unpackArgs(b.name, args, kwargs); err != nil {
+		return nil, err
+	}
+	d := b.recv.(*scriptDict)
+	l := &scriptList{}
+	for i, k := range d.keys {
+		l.elems = append(l.elems, scriptTuple{k, d.values[i]})
+	}
+	return l, nil
+}
+
+func dictKeys(th *scriptThread, b *scriptBuiltin, args []any, kwargs []scriptKwarg) (any, error) {
+	if err := unpackArgs(b.name, args, kwargs); err != nil {
+		return nil, err
+	}
+	return &scriptList{elems: append([]any{}, b.recv.(*scriptDict).keys...)}, nil
+}
+
+func dictValues(th *scriptThread, b *scriptBuiltin, args []any, kwargs []scriptKwarg) (any, error) {
+	if err := unpackArgs(b.name, args, kwargs); err != nil {
+		return nil, err
+	}
+	return &scriptList{elems: append([]any{}, b.recv.(*scriptDict).values...)}, nil
+}
+
+func dictPop(th *scriptThread, b *scriptBuiltin, args []any, kwargs []scriptKwarg) (any, error) {
+	var k, dflt any
+	if err := unpackArgs(b.name, args, kwargs, "key", &k, "default?", &dflt); err != nil {
+		return nil, err
+	}
+	v, found, err := b.recv.(*scriptDict).delete(k)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		if len(args)+len(kwargs) < 2 {
+			return nil, fmt.Errorf("%s: key %s not in dict", b.name, scriptRepr(k))
+		}
+		return dflt, nil
+	}
+	return v, nil
+}
+
+func dictSetdefault(th *scriptThread, b *scriptBuiltin, args []any, kwargs []scriptKwarg) (any, error) {
+	var k, dflt any
+	if err := unpackArgs(b.name, args, kwargs, "key", &k, "default?", &dflt); err != nil {
+		return nil, err
+	}
+	d := b.recv.(*scriptDict)
+	v, found, err := d.get(k)
+	if err != nil || found {
+		return v, err
+	}
+	return dflt, d.set(k, dflt)
+}
+
+func dictUpdateMethod(th *scriptThread, b *scriptBuiltin, args []any, kwargs []scriptKwarg) (any, error) {
+	if len(args) > 1 {
+		return nil, fmt.Errorf("%s takes at most 1 positional argument, not %d", b.name, len(args))
+	}
+	d := b.recv.(*scriptDict)
+	if len(args) == 1 {
+		if err := dictUpdate(th, d, args[0]); err != nil {
+			return nil, err
+		}
+	}
+	for _, kw := range kwargs {
+		if err := d.set(kw.name, kw.value); err != nil {
+			return nil, err
+		}
+	}
+	return nil, nil
+}
+
+// scriptRe is the re module of scripts, with Go's regular expressions, in
+// RE2 syntax: search returns the match, and its groups, as a tuple, or
+// None; findall returns the matches, or their groups as re.findall in
+// Python does; sub replaces matches, with $1 or ${name} for groups, as
+// -replacements does; split splits at matches; escape quotes the special
+// characters of a string.
+var scriptRe = &scriptModule{name: "re", members: map[string]any{}}
+
+func init() {
+	for name, fn := range map[string]scriptMethod{"escape": reEscape, "findall": reFindall, "search": reSearch, "split": reSplit, "sub": reSub} {
+		scriptRe.members[name] = &scriptBuiltin{name: "re." + name, fn: fn}
+	}
+}
+
+func (th *scriptThread) regexp(fn, pattern string) (*regexp.Regexp, error) {
+	re, err := th.script.regexp(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", fn, err)
+	}
+	return re, nil
+}
+
+func reEscape(th *scriptThread, b *scriptBuiltin, args []any, kwargs []scriptKwarg) (any, error) {
+	var s string
+	err := unpackArgs(b.name, args, kwargs, "s", &s)
+	return regexp.QuoteMeta(s), err
+}
+
+// matchGroups returns the groups of a match m of s, None for those that
+// did not take part.
+func matchGroups(s string, m []int) scriptTuple {
+	t := make(scriptTuple, len(m)/2)
+	for i := range t {
+		if m[2*i] >= 0 {
+			t[i] = s[m[2*i]:m[2*i+1]]
+		}
+	}
+	return t
+}
+
+func reSearch(th *scriptThread, b *scriptBuiltin, args []any, kwargs []scriptKwarg) (any, error) {
+	var pattern, s string
+	if err := unpackArgs(b.name, args, kwargs, "pattern", &pattern, "s", &s); err != nil {
+		return nil, err
+	}
+	re, err := th.regexp(b.name, pattern)
+	if err != nil {
+		return nil, err
+	}
+	m := re.FindStringSubmatchIndex(s)
+	if m == nil {
+		return nil, nil
+	}
+	return matchGroups(s, m), nil
+}
+
+func reFindall(th *scriptThread, b *scriptBuiltin, args []any, kwargs []scriptKwarg) (any, error) {
+	var pattern, s string
+	if err := unpackArgs(b.name, args, kwargs, "pattern", &pattern, "s", &s); err != nil {
+		return nil, err
+	}
+	re, err := th.regexp(b.name, pattern)
+	if err != nil {
+		return nil, err
+	}
+	l := &scriptList{}
+	for _, m := range re.FindAllStringSubmatchIndex(s, -1) {
+		g := matchGroups(s, m)
+		switch len(g) {
+		case 1:
+			l.elems = append(l.elems, g[0])
+		case 2:
+			l.elems = append(l.elems, g[1])
+		default:
+			l.elems = append(l.elems, g[1:])
+		}
+	}
+	return l, nil
+}
+
+func reSub(th *scriptThread, b *scriptBuiltin, args []any, kwargs []scriptKwarg) (any, error) {
+	var pattern, repl, s string
+	var count int64
+	if err := unpackArgs(b.name, args, kwargs, "pattern", &pattern, "repl", &repl, "s", &s, "count?", &count); err != nil {
+		return nil, err
+	}
+	re, err := th.regexp(b.name, pattern)
+	if err != nil {
+		return nil, err
+	}
+	if count <= 0 {
+		return re.ReplaceAllString(s, repl), nil
+	}
+	var out []byte
+	last := 0
+	for _, m := range re.FindAllStringSubmatchIndex(s, int(count)) {
+		out = append(out, s[last:m[0]]...)
+		out = re.ExpandString(out, repl, s, m)
+		last = m[1]
+	}
+	return string(append(out, s[last:]...)), nil
+}
+
+func reSplit(th *scriptThread, b *scriptBuiltin, args []any, kwargs []scriptKwarg) (any, error) {
+	var pattern, s string
+	maxsplit := int64(-1)
+	if err := unpackArgs(b.name, args, kwargs, "pattern", &pattern, "s", &s, "maxsplit?", &maxsplit); err != nil {
+		return nil, err
+	}
+	re, err := th.regexp(b.name, pattern)
+	if err != nil {
+		return nil, err
+	}
+	n := -1
+	if maxsplit >= 0 {
+		n = int(maxsplit) + 1
+	}
+	return stringList(re.Split(s, n)), nil
+}
@@ -0,0 +1,608 @@
+package pdfripper
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+)
+
+// scriptMaxSteps bounds the statements and loop iterations one call of a
+// script runs, so that a script looping over far too much fails instead
+// of holding up the run.
+const scriptMaxSteps = 10_000_000
+
+// scriptThread runs one call of a script, on one goroutine.
+type scriptThread struct {
+	script *Script
+	steps  int
+	calls  []*scriptFuncDef // Functions being called, which may not call themselves.
+}
+
+// scriptFrame holds the variables of a function call, or of the top level
+// of the script, where vars are the globals.
+type scriptFrame struct {
+	fn      *scriptFuncDef // nil at the top level.
+	vars    map[string]any
+	outer   *scriptFrame // The call the function was defined in, for nested functions.
+	globals map[string]any
+	comps   []map[string]any // Variables of the comprehensions being evaluated, innermost last.
+}
+
+// scriptError is an error of a script as it runs, at the line of the
+// innermost statement or expression it happened in.
+type scriptError struct {
+	file string
+	line int
+	err  error
+}
+
+func (e *scriptError) Error() string { return fmt.Sprintf("%s:%d: %v", e.file, e.line, e.err) }
+func (e *scriptError) Unwrap() error { return e.err }
+
+// at locates err at n, unless it already is located.
+func (th *scriptThread) at(n scriptNode, err error) error {
+	var se *scriptError
+	if err == nil || errors.As(err, &se) {
+		return err
+	}
+	return &scriptError{file: th.script.name, line: n.pos(), err: err}
+}
+
+func (th *scriptThread) step() error {
+	th.steps++
+	if th.steps > scriptMaxSteps {
+		return fmt.Errorf("the script ran more than %d steps", scriptMaxSteps)
+	}
+	return nil
+}
+
+type scriptControl int
+
+const (
+	ctrlNext scriptControl = iota
+	ctrlBreak
+	ctrlContinue
+	ctrlReturn
+)
+
+func (th *scriptThread) exec(fr *scriptFrame, stmts []scriptStmt) (scriptControl, any, error) {
+	for _, s := range stmts {
+		if err := th.step(); err != nil {
+			return ctrlNext, nil, th.at(s, err)
+		}
+		ctl, v, err := th.execStmt(fr, s)
+		if err != nil {
+			return ctrlNext, nil, th.at(s, err)
+		}
+		if ctl != ctrlNext {
+			return ctl, v, nil
+		}
+	}
+	return ctrlNext, nil, nil
+}
+
+func (th *scriptThread) execStmt(fr *scriptFrame, s scriptStmt) (scriptControl, any, error) {
+	switch s := s.(type) {
+	case *exprStmt:
+		_, err := th.eval(fr, s.x)
+		return ctrlNext, nil, err
+	case *assignStmt:
+		return ctrlNext, nil, th.assign(fr, s)
+	case *ifStmt:
+		cond, err := th.eval(fr, s.cond)
+		if err != nil {
+			return ctrlNext, nil, err
+		}
+		if truth(cond) {
+			return th.exec(fr, s.body)
+		}
+		return th.exec(fr, s.els)
+	case *forStmt:
+		return th.forLoop(fr, s)
+	case *defStmt:
+		fn, err := th.makeFunc(fr, s.fn)
+		if err != nil {
+			return ctrlNext, nil, err
+		}
+		fr.vars[s.fn.name] = fn
+		return ctrlNext, nil, nil
+	case *returnStmt:
+		var v any
+		if s.x != nil {
+			var err error
+			if v, err = th.eval(fr, s.x); err != nil {
+				return ctrlNext, nil, err
+			}
+		}
+		return ctrlReturn, v, nil
+	case *branchStmt:
+		switch s.kind {
+		case "break":
+			return ctrlBreak, nil, nil
+		case "continue":
+			return ctrlContinue, nil, nil
+		}
+		return ctrlNext, nil, nil
+	}
+	panic(fmt.Sprintf("unknown statement %T", s))
+}
+
+func (th *scriptThread) forLoop(fr *scriptFrame, s *forStmt) (scriptControl, any, error) {
+	x, err := th.eval(fr, s.iter)
+	if err != nil {
+		return ctrlNext, nil, err
+	}
+	it, err := iterate(x)
+	if err != nil {
+		return ctrlNext, nil, th.at(s.iter, err)
+	}
+	for {
+		v, ok := it.next()
+		if !ok {
+			return ctrlNext, nil, nil
+		}
+		if err := th.step(); err != nil {
+			return ctrlNext, nil, err
+		}
+		if err := th.bind(fr, s.vars, v, false); err != nil {
+			return ctrlNext, nil, err
+		}
+		ctl, rv, err := th.exec(fr, s.body)
+		if err != nil {
+			return ctrlNext, nil, err
+		}
+		switch ctl {
+		case ctrlBreak:
+			return ctrlNext, nil, nil
+		case ctrlReturn:
+			return ctl, rv, nil
+		}
+	}
+}
+
+// bind assigns v to target, unpacking tuples and lists. With comp set,
+// names are bound in the innermost comprehension.
+func (th *scriptThread) bind(fr *scriptFrame, target scriptExpr, v any, comp bool) error {
+	switch t := target.(type) {
+	case *nameExpr:
+		if comp {
+			fr.comps[len(fr.comps)-1][t.name] = v
+		} else {
+			fr.vars[t.name] = v
+		}
+		return nil
+	case *tupleExpr:
+		return th.unpack(fr, t.elems, v, comp)
+	case *listExpr:
+		return th.unpack(fr, t.elems, v, comp)
+	case *indexExpr:
+		x, err := th.eval(fr, t.x)
+		if err != nil {
+			return err
+		}
+		k, err := th.eval(fr, t.index)
+		if err != nil {
+			return err
+		}
+		return th.at(t, scriptSetIndex(x, k, v))
+	case *dotExpr:
+		x, err := th.eval(fr, t.x)
+		if err != nil {
+			return err
+		}
+		return th.at(t, scriptSetAttr(x, t.name, v))
+	}
+	return th.at(target, errors.New("cannot assign to this expression"))
+}
+
+func (th *scriptThread) unpack(fr *scriptFrame, targets []scriptExpr, v any, comp bool) error {
+	var elems []any
+	switch v := v.(type) {
+	case scriptTuple:
+		elems = v
+	case *scriptList:
+		elems = v.elems
+	default:
+		return fmt.Errorf("cannot unpack %s into %d variables", typeName(v), len(targets))
+	}
+	if len(elems) != len(targets) {
+		return fmt.Errorf("cannot unpack %d values into %d variables", len(elems), len(targets))
+	}
+	for i, t := range targets {
+		if err := th.bind(fr, t, elems[i], comp); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (th *scriptThread) assign(fr *scriptFrame, s *assignStmt) error {
+	if s.op == "=" {
+		v, err := th.eval(fr, s.rhs)
+		if err != nil {
+			return err
+		}
+		return th.bind(fr, s.lhs, v, false)
+	}
+	op := s.op[:len(s.op)-1]
+	update := func(old any) (any, error) {
+		y, err := th.eval(fr, s.rhs)
+		if err != nil {
+			return nil, err
+		}
+		if l, ok := old.(*scriptList); ok && op == "+" {
+			// As in Python, += extends a list in place.
+			if l.frozen {
+				return nil, errScriptFrozen
+			}
+			other, ok := y.(*scriptList)
+			if !ok {
+				return nil, fmt.Errorf("cannot add %s to a list", typeName(y))
+			}
+			l.elems = append(l.elems, other.elems...)
+			return l, nil
+		}
+		return scriptBinary(op, old, y)
+	}
+	switch t := s.lhs.(type) {
+	case *nameExpr:
+		old, err := th.lookup(fr, t)
+		if err != nil {
+			return err
+		}
+		v, err := update(old)
+		if err != nil {
+			return err
+		}
+		fr.vars[t.name] = v
+		return nil
+	case *indexExpr:
+		x, err := th.eval(fr, t.x)
+		if err != nil {
+			return err
+		}
+		k, err := th.eval(fr, t.index)
+		if err != nil {
+			return err
+		}
+		old, err := scriptIndex(x, k)
+		if err != nil {
+			return err
+		}
+		v, err := update(old)
+		if err != nil {
+			return err
+		}
+		return scriptSetIndex(x, k, v)
+	case *dotExpr:
+		x, err := th.eval(fr, t.x)
+		if err != nil {
+			return err
+		}
+		old, err := scriptGetAttr(x, t.name)
+		if err != nil {
+			return err
+		}
+		v, err := update(old)
+		if err != nil {
+			return err
+		}
+		return scriptSetAttr(x, t.name, v)
+	}
+	return errors.New("cannot assign to this expression")
+}
+
+func (th *scriptThread) lookup(fr *scriptFrame, x *nameExpr) (any, error) {
+	for i := len(fr.comps) - 1; i >= 0; i-- {
+		if v, ok := fr.comps[i][x.name]; ok {
+			return v, nil
+		}
+	}
+	for f := fr; f != nil && f.fn != nil; f = f.outer {
+		if f.fn.locals[x.name] {
+			if v, ok := f.vars[x.name]; ok {
+				return v, nil
+			}
+			return nil, fmt.Errorf("local variable %s used before it is assigned", x.name)
+		}
+	}
+	if v, ok := fr.globals[x.name]; ok {
+		return v, nil
+	}
+	if v, ok := scriptUniverse[x.name]; ok {
+		return v, nil
+	}
+	return nil, fmt.Errorf("undefined: %s", x.name)
+}
+
+func (th *scriptThread) eval(fr *scriptFrame, x scriptExpr) (any, error) {
+	switch x := x.(type) {
+	case *literalExpr:
+		return x.value, nil
+	case *nameExpr:
+		v, err := th.lookup(fr, x)
+		return v, th.at(x, err)
+	case *listExpr:
+		elems, err := th.evalAll(fr, x.elems)
+		if err != nil {
+			return nil, err
+		}
+		return &scriptList{elems: elems}, nil
+	case *tupleExpr:
+		elems, err := th.evalAll(fr, x.elems)
+		if err != nil {
+			return nil, err
+		}
+		return scriptTuple(elems), nil
+	case *dictExpr:
+		d := newScriptDict()
+		for i := range x.keys {
+			k, err := th.eval(fr, x.keys[i])
+			if err != nil {
+				return nil, err
+			}
+			v, err := th.eval(fr, x.values[i])
+			if err != nil {
+				return nil, err
+			}
+			if err := d.set(k, v); err != nil {
+				return nil, th.at(x.keys[i], err)
+			}
+		}
+		return d, nil
+	case *compExpr:
+		return th.comprehension(fr, x)
+	case *unaryExpr:
+		v, err := th.eval(fr, x.x)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case x.op == "not":
+			return !truth(v), nil
+		case x.op == "-":
+			switch n := v.(type) {
+			case int64:
+				if n == -n && n != 0 {
+					return nil, th.at(x, errors.New("integer overflow"))
+				}
+				return -n, nil
+			case float64:
+				return -n, nil
+			}
+		default:
+			if _, ok := toFloat(v); ok {
+				return v, nil
+			}
+		}
+		return nil, th.at(x, fmt.Errorf("unsupported operand type for unary %s: %s", x.op, typeName(v)))
+	case *binaryExpr:
+		a, err := th.eval(fr, x.x)
+		if err != nil {
+			return nil, err
+		}
+		switch x.op {
+		case "and":
+			if !truth(a) {
+				return a, nil
+			}
+			return th.eval(fr, x.y)
+		case "or":
+			if truth(a) {
+				return a, nil
+			}
+			return th.eval(fr, x.y)
+		}
+		b, err := th.eval(fr, x.y)
+		if err != nil {
+			return nil, err
+		}
+		v, err := scriptBinary(x.op, a, b)
+		return v, th.at(x, err)
+	case *condExpr:
+		cond, err := th.eval(fr, x.cond)
+		if err != nil {
+			return nil, err
+		}
+		if truth(cond) {
+			return th.eval(fr, x.then)
+		}
+		return th.eval(fr, x.els)
+	case *callExpr:
+		fn, err := th.eval(fr, x.fn)
+		if err != nil {
+			return nil, err
+		}
+		var args []any
+		var kwargs []scriptKwarg
+		for _, a := range x.args {
+			v, err := th.eval(fr, a.x)
+			if err != nil {
+				return nil, err
+			}
+			if a.name == "" {
+				args = append(args, v)
+			} else {
+				kwargs = append(kwargs, scriptKwarg{a.name, v})
+			}
+		}
+		v, err := th.call(fn, args, kwargs)
+		return v, th.at(x, err)
+	case *indexExpr:
+		v, err := th.eval(fr, x.x)
+		if err != nil {
+			return nil, err
+		}
+		k, err := th.eval(fr, x.index)
+		if err != nil {
+			return nil, err
+		}
+		v, err = scriptIndex(v, k)
+		return v, th.at(x, err)
+	case *sliceExpr:
+		parts, err := th.evalAll(fr, []scriptExpr{x.x, x.lo, x.hi, x.step})
+		if err != nil {
+			return nil, err
+		}
+		v, err := scriptSlice(parts[0], parts[1], parts[2], parts[3])
+		return v, th.at(x, err)
+	case *dotExpr:
+		v, err := th.eval(fr, x.x)
+		if err != nil {
+			return nil, err
+		}
+		v, err = scriptGetAttr(v, x.name)
+		return v, th.at(x, err)
+	case *lambdaExpr:
+		return th.makeFunc(fr, x.fn)
+	}
+	panic(fmt.Sprintf("unknown expression %T", x))
+}
+
+// evalAll evaluates xs in order, leaving nil for nil expressions.
+func (th *scriptThread) evalAll(fr *scriptFrame, xs []scriptExpr) ([]any, error) {
+	vals := make([]any, len(xs))
+	for i, x := range xs {
+		if x == nil {
+			continue
+		}
+		v, err := th.eval(fr, x)
+		if err != nil {
+			return nil, err
+		}
+		vals[i] = v
+	}
+	return vals, nil
+}
+
+func (th *scriptThread) comprehension(fr *scriptFrame, c *compExpr) (any, error) {
+	fr.comps = append(fr.comps, map[string]any{})
+	defer func() { fr.comps = fr.comps[:len(fr.comps)-1] }()
+	list := &scriptList{}
+	dict := newScriptDict()
+	var loop func(i int) error
+	loop = func(i int) error {
+		if i == len(c.clauses) {
+			if c.key == nil {
+				v, err := th.eval(fr, c.elem)
+				list.elems = append(list.elems, v)
+				return err
+			}
+			k, err := th.eval(fr, c.key)
+			if err != nil {
+				return err
+			}
+			v, err := th.eval(fr, c.elem)
+			if err != nil {
+				return err
+			}
+			return th.at(c.key, dict.set(k, v))
+		}
+		cl := c.clauses[i]
+		if cl.iter == nil {
+			cond, err := th.eval(fr, cl.cond)
+			if err != nil || !truth(cond) {
+				return err
+			}
+			return loop(i + 1)
+		}
+		x, err := th.eval(fr, cl.iter)
+		if err != nil {
+			return err
+		}
+		it, err := iterate(x)
+		if err != nil {
+			return th.at(cl.iter, err)
+		}
+		for {
+			v, ok := it.next()
+			if !ok {
+				return nil
+			}
+			if err := th.step(); err != nil {
+				return th.at(c, err)
+			}
+			if err := th.bind(fr, cl.vars, v, true); err != nil {
+				return th.at(c, err)
+			}
+			if err := loop(i + 1); err != nil {
+				return err
+			}
+		}
+	}
+	if err := loop(0); err != nil {
+		return nil, err
+	}
+	if c.key != nil {
+		return dict, nil
+	}
+	return list, nil
+}
+
+// makeFunc returns the function def defines in fr, evaluating the
+// defaults of its parameters.
+func (th *scriptThread) makeFunc(fr *scriptFrame, def *scriptFuncDef) (*scriptFunc, error) {
+	fn := &scriptFunc{def: def, globals: fr.globals}
+	if fr.fn != nil {
+		fn.outer = fr
+	}
+	for _, p := range def.params {
+		var v any
+		if p.dflt != nil {
+			var err error
+			if v, err = th.eval(fr, p.dflt); err != nil {
+				return nil, err
+			}
+		}
+		fn.defaults = append(fn.defaults, v)
+	}
+	return fn, nil
+}
+
+func (th *scriptThread) call(fn any, args []any, kwargs []scriptKwarg) (any, error) {
+	switch fn := fn.(type) {
+	case *scriptBuiltin:
+		return fn.fn(th, fn, args, kwargs)
+	case *scriptFunc:
+		return th.callFunc(fn, args, kwargs)
+	}
+	return nil, fmt.Errorf("%s is not callable", typeName(fn))
+}
+
+func (th *scriptThread) callFunc(fn *scriptFunc, args []any, kwargs []scriptKwarg) (any, error) {
+	def := fn.def
+	if slices.Contains(th.calls, def) {
+		return nil, fmt.Errorf("%s calls itself, which scripts may not do", def.name)
+	}
+	if len(args) > len(def.params) {
+		return nil, fmt.Errorf("%s takes at most %d arguments, not %d", def.name, len(def.params), len(args))
+	}
+	vars := make(map[string]any, len(def.locals))
+	for i, a := range args {
+		vars[def.params[i].name] = a
+	}
+	for _, kw := range kwargs {
+		if !slices.ContainsFunc(def.params, func(p scriptParam) bool { return p.name == kw.name }) {
+			return nil, fmt.Errorf("%s has no parameter %s", def.name, kw.name)
+		}
+		if _, set := vars[kw.name]; set {
+			return nil, fmt.Errorf("%s got two values for %s", def.name, kw.name)
+		}
+		vars[kw.name] = kw.value
+	}
+	for i, p := range def.params {
+		if _, set := vars[p.name]; !set {
+			if p.dflt == nil {
+				return nil, fmt.Errorf("%s is missing argument %s", def.name, p.name)
+			}
+			vars[p.name] = fn.defaults[i]
+		}
+	}
+	th.calls = append(th.calls, def)
+	defer func() { th.calls = th.calls[:len(th.calls)-1] }()
+	ctl, v, err := th.exec(&scriptFrame{fn: def, vars: vars, outer: fn.outer, globals: fn.globals}, def.body)
+	if err != nil || ctl != ctrlReturn {
+		return nil, err
+	}
+	return v, nil
+}
@@ -0,0 +1,1171 @@
+package pdfripper
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// This file reads the Starlark of a Script into statements.
+
+type scriptTokenKind int
+
+const (
+	tokEOF scriptTokenKind = iota
+	tokNewline
+	tokIndent
+	tokDedent
+	tokName // Identifiers and keywords.
+	tokNumber
+	tokString
+	tokOp // Operators and punctuation.
+)
+
+type scriptToken struct {
+	kind  scriptTokenKind
+	text  string // The name, keyword, operator or number as written, or the value of a string.
+	value any    // The int64 or float64 of a number.
+	line  int
+}
+
+// scriptKeywords are the words that cannot name variables: those of the
+// subset, and the others Starlark and Python reserve.
+var scriptKeywords = map[string]bool{
+	"and": true, "break": true, "continue": true, "def": true, "elif": true, "else": true, "for": true,
+	"if": true, "in": true, "lambda": true, "not": true, "or": true, "pass": true, "return": true,
+	"None": true, "True": true, "False": true,
+
+	"as": true, "assert": true, "async": true, "await": true, "class": true, "del": true, "except": true,
+	"finally": true, "from": true, "global": true, "import": true, "is": true, "load": true,
+	"nonlocal": true, "raise": true, "try": true, "while": true, "with": true, "yield": true,
+}
+
+// scriptOps are the operators, longest first so that "//=" is not read
+// as "//" and "=".
+var scriptOps = []string{
+	"//=",
+	"==", "!=", "<=", ">=", "+=", "-=", "*=", "/=", "%=", "//",
+	"+", "-", "*", "/", "%", "<", ">", "=", "(", ")", "[", "]", "{", "}", ",", ":", ".", ";",
+}
+
+// scriptScanner splits a script into tokens, with INDENT and DEDENT
+// tokens around indented blocks and NEWLINE tokens ending lines, except
+// inside brackets, as in Python.
+type scriptScanner struct {
+	file    string
+	src     string
+	pos     int
+	line    int
+	depth   int   // Brackets open.
+	indents []int // Columns of the blocks the line is in.
+	toks    []scriptToken
+}
+
+func scanScript(file, src string) ([]scriptToken, error) {
+	s := &scriptScanner{file: file, src: src, line: 1, indents: []int{0}}
+	if err := s.scan(); err != nil {
+		return nil, err
+	}
+	return s.toks, nil
+}
+
+func (s *scriptScanner) errorf(format string, args ...any) error {
+	return fmt.Errorf("%s:%d: %s", s.file, s.line, fmt.Sprintf(format, args...))
+}
+
+func (s *scriptScanner) emit(kind scriptTokenKind, text string, value any) {
+	s.toks = append(s.toks, scriptToken{kind: kind, text: text, value: value, line: s.line})
+}
+
+func (s *scriptScanner) scan() error {
+	lineStart := true
+	for s.pos < len(s.src) {
+		if lineStart && s.depth == 0 {
+			lineStart = false
+			if err := s.indent(); err != nil {
+				return err
+			}
+			continue
+		}
+		c := s.src[s.pos]
+		switch {
+		case c == '\n':
+			if s.depth == 0 {
+				s.emit(tokNewline, "", nil)
+				lineStart = true
+			}
+			s.pos++
+			s.line++
+		case c == ' ' || c == '\t' || c == '\r' || c == '\f':
+			s.pos++
+		case c == '#':
+			for s.pos < len(s.src) && s.src[s.pos] != '\n' {
+				s.pos++
+			}
+		case c == '\\':
+			rest := s.src[s.pos+1:]
+			switch {
+			case strings.HasPrefix(rest, "\n"):
+				s.pos += 2
+			case strings.HasPrefix(rest, "\r\n"):
+				s.pos += 3
+			default:
+				return s.errorf("unexpected backslash")
+			}
+			s.line++
+		case c == '"' || c == '\'':
+			if err := s.string(false); err != nil {
+				return err
+			}
+		case isScriptNameChar(c) && !('0' <= c && c <= '9'):
+			start := s.pos
+			for s.pos < len(s.src) && isScriptNameChar(s.src[s.pos]) {
+				s.pos++
+			}
+			name := s.src[start:s.pos]
+			if (name == "r" || name == "R") && s.pos < len(s.src) && (s.src[s.pos] == '"' || s.src[s.pos] == '\'') {
+				if err := s.string(true); err != nil {
+					return err
+				}
+				continue
+			}
+			s.emit(tokName, name, nil)
+		case '0' <= c && c <= '9' || c == '.' && s.pos+1 < len(s.src) && '0' <= s.src[s.pos+1] && s.src[s.pos+1] <= '9':
+			if err := s.number(); err != nil {
+				return err
+			}
+		default:
+			if err := s.operator(); err != nil {
+				return err
+			}
+		}
+	}
+	if s.depth > 0 {
+		return s.errorf("unexpected end of file: a bracket is not closed")
+	}
+	if n := len(s.toks); n > 0 && s.toks[n-1].kind != tokNewline {
+		s.emit(tokNewline, "", nil)
+	}
+	for len(s.indents) > 1 {
+		s.indents = s.indents[:len(s.indents)-1]
+		s.emit(tokDedent, "", nil)
+	}
+	s.emit(tokEOF, "", nil)
+	return nil
+}
+
+// indent reads the indentation of the next line that is not blank or a
+// comment, emitting INDENT or DEDENT tokens if it changes.
+func (s *scriptScanner) indent() error {
+	for {
+		col, i := 0, s.pos
+		for i < len(s.src) && (s.src[i] == ' ' || s.src[i] == '\t') {
+			if s.src[i] == '\t' {
+				col += 8 - col%8
+			} else {
+				col++
+			}
+			i++
+		}
+		if i == len(s.src) || s.src[i] == '\n' || s.src[i] == '\r' || s.src[i] == '#' {
+			nl := strings.IndexByte(s.src[i:], '\n')
+			if nl < 0 {
+				s.pos = len(s.src)
+				return nil
+			}
+			s.pos = i + nl + 1
+			s.line++
+			continue
+		}
+		s.pos = i
+		if col > s.indents[len(s.indents)-1] {
+			s.indents = append(s.indents, col)
+			s.emit(tokIndent, "", nil)
+			return nil
+		}
+		for col < s.indents[len(s.indents)-1] {
+			s.indents = s.indents[:len(s.indents)-1]
+			s.emit(tokDedent, "", nil)
+		}
+		if col != s.indents[len(s.indents)-1] {
+			return s.errorf("unindent does not match any outer indentation")
+		}
+		return nil
+	}
+}
+
+func isScriptNameChar(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || c == '_'
+}
+
+// string reads a string literal, triple-quoted ones spanning lines. Raw
+// strings keep their backslashes.
+func (s *scriptScanner) string(raw bool) error {
+	q := s.src[s.pos]
+	quote := string(q)
+	if strings.HasPrefix(s.src[s.pos:], strings.Repeat(quote, 3)) {
+		quote = strings.Repeat(quote, 3)
+	}
+	startLine := s.line
+	s.pos += len(quote)
+	var b strings.Builder
+	for {
+		if s.pos >= len(s.src) {
+			s.line = startLine
+			return s.errorf("unterminated string")
+		}
+		c := s.src[s.pos]
+		switch {
+		case strings.HasPrefix(s.src[s.pos:], quote):
+			s.pos += len(quote)
+			s.toks = append(s.toks, scriptToken{kind: tokString, text: b.String(), line: startLine})
+			return nil
+		case c == '\n':
+			if len(quote) == 1 {
+				return s.errorf("unterminated string")
+			}
+			b.WriteByte(c)
+			s.pos++
+			s.line++
+		case c == '\\' && s.pos+1 < len(s.src):
+			if raw {
+				// The backslash stays, but keeps the character after it
+				// from ending the string.
+				b.WriteString(s.src[s.pos : s.pos+2])
+				if s.src[s.pos+1] == '\n' {
+					s.line++
+				}
+				s.pos += 2
+				continue
+			}
+			if err := s.escape(&b); err != nil {
+				return err
+			}
+		default:
+			b.WriteByte(c)
+			s.pos++
+		}
+	}
+}
+
+// escape reads the escape sequence at pos. Sequences Python does not
+// know, such as \d in a regular expression, are kept as they are.
+func (s *scriptScanner) escape(b *strings.Builder) error {
+	c := s.src[s.pos+1]
+	s.pos += 2
+	switch c {
+	case '\n':
+		s.line++ // The string goes on on the next line.
+	case 'n':
+		b.WriteByte('\n')
+	case 't':
+		b.WriteByte('\t')
+	case 'r':
+		b.WriteByte('\r')
+	case 'a':
+		b.WriteByte('\a')
+	case 'b':
+		b.WriteByte('\b')
+	case 'f':
+		b.WriteByte('\f')
+	case 'v':
+		b.WriteByte('\v')
+	case '\\', '\'', '"':
+		b.WriteByte(c)
+	case '0', '1', '2', '3', '4', '5', '6', '7':
+		n := int(c - '0')
+		for i := 0; i < 2 && s.pos < len(s.src) && '0' <= s.src[s.pos] && s.src[s.pos] <= '7'; i++ {
+			n = n*8 + int(s.src[s.pos]-'0')
+			s.pos++
+		}
+		b.WriteRune(rune(n))
+	case 'x', 'u', 'U':
+		digits := map[byte]int{'x': 2, 'u': 4, 'U': 8}[c]
+		if s.pos+digits > len(s.src) {
+			return s.errorf(`truncated \%c escape`, c)
+		}
+		n, err := strconv.ParseUint(s.src[s.pos:s.pos+digits], 16, 32)
+		if err != nil || !utf8.ValidRune(rune(n)) {
+			return s.errorf(`invalid \%c escape %q`, c, s.src[s.pos:s.pos+digits])
+		}
+		b.WriteRune(rune(n))
+		s.pos += digits
+	default:
+		b.WriteByte('\\')
+		b.WriteByte(c)
+	}
+	return nil
+}
+
+func (s *scriptScanner) number() error {
+	start := s.pos
+	float := false
+	digits := func() {
+		for s.pos < len(s.src) && ('0' <= s.src[s.pos] && s.src[s.pos] <= '9' || s.src[s.pos] == '_') {
+			s.pos++
+		}
+	}
+	if rest := strings.ToLower(s.src[s.pos:]); strings.HasPrefix(rest, "0x") || strings.HasPrefix(rest, "0o") || strings.HasPrefix(rest, "0b") {
+		s.pos += 2
+		for s.pos < len(s.src) && isScriptNameChar(s.src[s.pos]) {
+			s.pos++
+		}
+	} else {
+		digits()
+		if s.pos < len(s.src) && s.src[s.pos] == '.' {
+			float = true
+			s.pos++
+			digits()
+		}
+		if s.pos < len(s.src) && (s.src[s.pos] == 'e' || s.src[s.pos] == 'E') {
+			float = true
+			s.pos++
+			if s.pos < len(s.src) && (s.src[s.pos] == '+' || s.src[s.pos] == '-') {
+				s.pos++
+			}
+			digits()
+		}
+	}
+	for s.pos < len(s.src) && isScriptNameChar(s.src[s.pos]) {
+		s.pos++
+	}
+	text := s.src[start:s.pos]
+	if float {
+		f, err := strconv.ParseFloat(strings.ReplaceAll(text, "_", ""), 64)
+		if err != nil {
+			return s.errorf("invalid number %s", text)
+		}
+		s.emit(tokNumber, text, f)
+		return nil
+	}
+	if len(text) > 1 && '0' <= text[1] && text[1] <= '9' && text[0] == '0' {
+		return s.errorf("invalid number %s: use 0o for octal", text)
+	}
+	n, err := strconv.ParseInt(text, 0, 64)
+	if err != nil {
+		return s.errorf("invalid number %s", text)
+	}
+	s.emit(tokNumber, text, n)
+	return nil
+}
+
+func (s *scriptScanner) operator() error {
+	for _, op := range scriptOps {
+		if !strings.HasPrefix(s.src[s.pos:], op) {
+			continue
+		}
+		switch op {
+		case "(", "[", "{":
+			s.depth++
+		case ")", "]", "}":
+			if s.depth == 0 {
+				return s.errorf("unexpected %s", op)
+			}
+			s.depth--
+		}
+		s.emit(tokOp, op, nil)
+		s.pos += len(op)
+		return nil
+	}
+	r, _ := utf8.DecodeRuneInString(s.src[s.pos:])
+	return s.errorf("unexpected character %q", r)
+}
+
+// scriptNode is a statement or expression, which knows its line.
+type scriptNode interface {
+	pos() int
+}
+
+type (
+	scriptStmt = scriptNode
+	scriptExpr = scriptNode
+)
+
+// scriptPos is the line a node starts on.
+type scriptPos int
+
+func (p scriptPos) pos() int { return int(p) }
+
+type (
+	exprStmt struct {
+		scriptPos
+		x scriptExpr
+	}
+	assignStmt struct {
+		scriptPos
+		op       string // "=", or an augmented assignment such as "+=".
+		lhs, rhs scriptExpr
+	}
+	ifStmt struct {
+		scriptPos
+		cond      scriptExpr
+		body, els []scriptStmt
+	}
+	forStmt struct {
+		scriptPos
+		vars, iter scriptExpr
+		body       []scriptStmt
+	}
+	defStmt struct {
+		scriptPos
+		fn *scriptFuncDef
+	}
+	returnStmt struct {
+		scriptPos
+		x scriptExpr // nil returns None.
+	}
+	branchStmt struct {
+		scriptPos
+		kind string // break, continue or pass.
+	}
+)
+
+type (
+	nameExpr struct {
+		scriptPos
+		name string
+	}
+	literalExpr struct {
+		scriptPos
+		value any
+	}
+	listExpr struct {
+		scriptPos
+		elems []scriptExpr
+	}
+	tupleExpr struct {
+		scriptPos
+		elems []scriptExpr
+	}
+	dictExpr struct {
+		scriptPos
+		keys, values []scriptExpr
+	}
+	// compExpr is a list comprehension, or a dict one if key is set.
+	compExpr struct {
+		scriptPos
+		key, elem scriptExpr
+		clauses   []compClause
+	}
+	unaryExpr struct {
+		scriptPos
+		op string
+		x  scriptExpr
+	}
+	binaryExpr struct {
+		scriptPos
+		op   string
+		x, y scriptExpr
+	}
+	condExpr struct {
+		scriptPos
+		cond, then, els scriptExpr
+	}
+	callExpr struct {
+		scriptPos
+		fn   scriptExpr
+		args []callArg
+	}
+	indexExpr struct {
+		scriptPos
+		x, index scriptExpr
+	}
+	sliceExpr struct {
+		scriptPos
+		x, lo, hi, step scriptExpr // Those left out are nil.
+	}
+	dotExpr struct {
+		scriptPos
+		x    scriptExpr
+		name string
+	}
+	lambdaExpr struct {
+		scriptPos
+		fn *scriptFuncDef
+	}
+)
+
+// compClause is a "for vars in iter" clause of a comprehension, or an "if
+// cond" one.
+type compClause struct {
+	vars, iter, cond scriptExpr
+}
+
+type callArg struct {
+	name string // Set for keyword arguments.
+	x    scriptExpr
+}
+
+// scriptFuncDef is a function as written, with def or lambda.
+type scriptFuncDef struct {
+	name   string
+	line   int
+	params []scriptParam
+	body   []scriptStmt
+	locals map[string]bool // Names assigned in the body, which are the function's own.
+}
+
+type scriptParam struct {
+	name string
+	dflt scriptExpr // nil if the parameter has no default.
+}
+
+// resolve finds the local variables of fn: its parameters and the names
+// its body assigns to, anywhere in it, as in Python.
+func (fn *scriptFuncDef) resolve() {
+	fn.locals = map[string]bool{}
+	for _, p := range fn.params {
+		fn.locals[p.name] = true
+	}
+	var walk func(stmts []scriptStmt)
+	walk = func(stmts []scriptStmt) {
+		for _, s := range stmts {
+			switch s := s.(type) {
+			case *assignStmt:
+				bindNames(s.lhs, fn.locals)
+			case *forStmt:
+				bindNames(s.vars, fn.locals)
+				walk(s.body)
+			case *ifStmt:
+				walk(s.body)
+				walk(s.els)
+			case *defStmt:
+				fn.locals[s.fn.name] = true
+			}
+		}
+	}
+	walk(fn.body)
+}
+
+func bindNames(x scriptExpr, names map[string]bool) {
+	switch x := x.(type) {
+	case *nameExpr:
+		names[x.name] = true
+	case *tupleExpr:
+		for _, e := range x.elems {
+			bindNames(e, names)
+		}
+	case *listExpr:
+		for _, e := range x.elems {
+			bindNames(e, names)
+		}
+	}
+}
+
+// scriptParser parses tokens into statements. It reports errors by
+// panicking with a scriptSyntaxError, which parseScript recovers.
+type scriptParser struct {
+	file  string
+	toks  []scriptToken
+	pos   int
+	defs  int // Functions being parsed, so return is allowed.
+	loops int // Loops being parsed in the innermost function, so break and continue are.
+}
+
+type scriptSyntaxError struct {
+	err error
+}
+
+// parseScript parses the script src, read from file.
+func parseScript(file, src string) (stmts []scriptStmt, err error) {
+	toks, err := scanScript(file, src)
+	if err != nil {
+		return nil, err
+	}
+	p := &scriptParser{file: file, toks: toks}
+	defer func() {
+		if r := recover(); r != nil {
+			se, ok := r.(scriptSyntaxError)
+			if !ok {
+				panic(r)
+			}
+			stmts, err = nil, se.err
+		}
+	}()
+	for p.peek().kind != tokEOF {
+		stmts = append(stmts, p.statement()...)
+	}
+	return stmts, nil
+}
+
+func (p *scriptParser) fail(t scriptToken, format string, args ...any) {
+	panic(scriptSyntaxError{fmt.Errorf("%s:%d: %s", p.file, t.line, fmt.Sprintf(format, args...))})
+}
+
+func (p *scriptParser) peek() scriptToken { return p.toks[p.pos] }
+
+func (p *scriptParser) next() scriptToken {
+	t := p.toks[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+// is reports whether the next token is the operator or keyword word.
+func (p *scriptParser) is(word string) bool {
+	t := p.peek()
+	return (t.kind == tokOp || t.kind == tokName) && t.text == word
+}
+
+// accept consumes the next token if it is the operator or keyword word.
+func (p *scriptParser) accept(word string) bool {
+	if p.is(word) {
+		p.next()
+		return true
+	}
+	return false
+}
+
+func (p *scriptParser) expect(word string) scriptToken {
+	t := p.next()
+	if (t.kind != tokOp && t.kind != tokName) || t.text != word {
+		p.fail(t, "expected %s, found %s", word, describeToken(t))
+	}
+	return t
+}
+
+func describeToken(t scriptToken) string {
+	switch t.kind {
+	case tokEOF:
+		return "end of file"
+	case tokNewline:
+		return "end of line"
+	case tokIndent:
+		return "indentation"
+	case tokDedent:
+		return "unindent"
+	case tokString:
+		return "string " + strconv.Quote(t.text)
+	case tokNumber:
+		return "number " + t.text
+	}
+	return t.text
+}
+
+func (p *scriptParser) ident() string {
+	t := p.next()
+	if t.kind != tokName || scriptKeywords[t.text] {
+		p.fail(t, "expected a name, found %s", describeToken(t))
+	}
+	return t.text
+}
+
+func (p *scriptParser) statement() []scriptStmt {
+	t := p.peek()
+	switch {
+	case t.kind == tokIndent:
+		p.fail(t, "unexpected indentation")
+	case p.is("def"):
+		return []scriptStmt{p.def()}
+	case p.is("if"):
+		return []scriptStmt{p.ifStmt()}
+	case p.is("for"):
+		return []scriptStmt{p.forStmt()}
+	}
+	return p.simpleStatements()
+}
+
+// simpleStatements parses the statements of one line, separated by
+// semicolons.
+func (p *scriptParser) simpleStatements() []scriptStmt {
+	var stmts []scriptStmt
+	for {
+		stmts = append(stmts, p.simple())
+		if !p.accept(";") || p.peek().kind == tokNewline {
+			break
+		}
+	}
+	if t := p.next(); t.kind != tokNewline && t.kind != tokEOF {
+		p.fail(t, "unexpected %s", describeToken(t))
+	}
+	return stmts
+}
+
+func (p *scriptParser) simple() scriptStmt {
+	t := p.peek()
+	if t.kind == tokName {
+		switch t.text {
+		case "return":
+			p.next()
+			if p.defs == 0 {
+				p.fail(t, "return outside a function")
+			}
+			s := &returnStmt{scriptPos: scriptPos(t.line)}
+			if p.startsExpr() {
+				s.x = p.exprList()
+			}
+			return s
+		case "break", "continue":
+			p.next()
+			if p.loops == 0 {
+				p.fail(t, "%s outside a loop", t.text)
+			}
+			return &branchStmt{scriptPos: scriptPos(t.line), kind: t.text}
+		case "pass":
+			p.next()
+			return &branchStmt{scriptPos: scriptPos(t.line), kind: t.text}
+		case "while":
+			p.fail(t, "while loops are not supported; loop over a range or list with for")
+		case "is", "None", "True", "False", "not", "lambda":
+		default:
+			if scriptKeywords[t.text] {
+				p.fail(t, "%s is not supported in scripts", t.text)
+			}
+		}
+	}
+	x := p.exprList()
+	if op := p.peek(); op.kind == tokOp && (op.text == "=" || len(op.text) >= 2 && strings.HasSuffix(op.text, "=") && op.text != "==" && op.text != "!=" && op.text != "<=" && op.text != ">=") {
+		p.next()
+		p.checkTarget(op, x, op.text == "=")
+		return &assignStmt{scriptPos: scriptPos(op.line), op: op.text, lhs: x, rhs: p.exprList()}
+	}
+	return &exprStmt{scriptPos: scriptPos(t.line), x: x}
+}
+
+// checkTarget fails unless x can be assigned to: a name, an index, an
+// attribute or, unless augmented, a tuple or list of them.
+func (p *scriptParser) checkTarget(t scriptToken, x scriptExpr, unpack bool) {
+	switch x := x.(type) {
+	case *nameExpr, *indexExpr, *dotExpr:
+		return
+	case *tupleExpr:
+		if unpack {
+			for _, e := range x.elems {
+				p.checkTarget(t, e, true)
+			}
+			return
+		}
+	case *listExpr:
+		if unpack {
+			for _, e := range x.elems {
+				p.checkTarget(t, e, true)
+			}
+			return
+		}
+	}
+	p.fail(t, "cannot assign to this expression")
+}
+
+// block parses the body of a compound statement, from its colon: an
+// indented block, or simple statements on the same line.
+func (p *scriptParser) block() []scriptStmt {
+	p.expect(":")
+	if p.peek().kind != tokNewline {
+		return p.simpleStatements()
+	}
+	p.next()
+	if t := p.next(); t.kind != tokIndent {
+		p.fail(t, "expected an indented block, found %s", describeToken(t))
+	}
+	var stmts []scriptStmt
+	for p.peek().kind != tokDedent && p.peek().kind != tokEOF {
+		stmts = append(stmts, p.statement()...)
+	}
+	p.next()
+	return stmts
+}
+
+func (p *scriptParser) def() scriptStmt {
+	t := p.next()
+	name := p.ident()
+	p.expect("(")
+	params := p.params(")")
+	p.expect(")")
+	loops := p.loops
+	p.defs, p.loops = p.defs+1, 0
+	body := p.block()
+	p.defs, p.loops = p.defs-1, loops
+	fn := &scriptFuncDef{name: name, line: t.line, params: params, body: body}
+	fn.resolve()
+	return &defStmt{scriptPos: scriptPos(t.line), fn: fn}
+}
+
+// params parses parameters up to end, which is left.
+func (p *scriptParser) params(end string) []scriptParam {
+	var params []scriptParam
+	for !p.is(end) {
+		t := p.peek()
+		if p.is("*") || p.is("**") {
+			p.fail(t, "*args and **kwargs are not supported")
+		}
+		param := scriptParam{name: p.ident()}
+		for _, q := range params {
+			if q.name == param.name {
+				p.fail(t, "duplicate parameter %s", param.name)
+			}
+		}
+		if p.accept("=") {
+			param.dflt = p.test()
+		} else if len(params) > 0 && params[len(params)-1].dflt != nil {
+			p.fail(t, "parameter %s without a default follows one with a default", param.name)
+		}
+		params = append(params, param)
+		if !p.accept(",") {
+			break
+		}
+	}
+	return params
+}
+
+func (p *scriptParser) ifStmt() scriptStmt {
+	t := p.next() // if or elif
+	s := &ifStmt{scriptPos: scriptPos(t.line), cond: p.test()}
+	s.body = p.block()
+	switch {
+	case p.is("elif"):
+		s.els = []scriptStmt{p.ifStmt()}
+	case p.accept("else"):
+		s.els = p.block()
+	}
+	return s
+}
+
+func (p *scriptParser) forStmt() scriptStmt {
+	t := p.next()
+	s := &forStmt{scriptPos: scriptPos(t.line), vars: p.targets()}
+	p.expect("in")
+	s.iter = p.exprList()
+	p.loops++
+	s.body = p.block()
+	p.loops--
+	return s
+}
+
+// targets parses the variables of a for loop or comprehension.
+func (p *scriptParser) targets() scriptExpr {
+	t := p.peek()
+	var xs []scriptExpr
+	for {
+		xs = append(xs, p.primary())
+		if !p.accept(",") || p.is("in") {
+			break
+		}
+	}
+	var x scriptExpr = &tupleExpr{scriptPos: scriptPos(t.line), elems: xs}
+	if len(xs) == 1 {
+		x = xs[0]
+	}
+	p.checkTarget(t, x, true)
+	return x
+}
+
+// startsExpr reports whether the next token can start an expression.
+func (p *scriptParser) startsExpr() bool {
+	t := p.peek()
+	switch t.kind {
+	case tokName:
+		switch t.text {
+		case "not", "lambda", "None", "True", "False":
+			return true
+		}
+		return !scriptKeywords[t.text]
+	case tokNumber, tokString:
+		return true
+	case tokOp:
+		switch t.text {
+		case "(", "[", "{", "-", "+":
+			return true
+		}
+	}
+	return false
+}
+
+// exprList parses expressions separated by commas, as a tuple if there is
+// more than one or a trailing comma.
+func (p *scriptParser) exprList() scriptExpr {
+	t := p.peek()
+	x := p.test()
+	if !p.is(",") {
+		return x
+	}
+	xs := []scriptExpr{x}
+	for p.accept(",") && p.startsExpr() {
+		xs = append(xs, p.test())
+	}
+	return &tupleExpr{scriptPos: scriptPos(t.line), elems: xs}
+}
+
+func (p *scriptParser) test() scriptExpr {
+	if p.is("lambda") {
+		return p.lambda()
+	}
+	x := p.or()
+	if p.is("if") {
+		t := p.next()
+		cond := p.or()
+		p.expect("else")
+		return &condExpr{scriptPos: scriptPos(t.line), cond: cond, then: x, els: p.test()}
+	}
+	return x
+}
+
+func (p *scriptParser) lambda() scriptExpr {
+	t := p.next()
+	params := p.params(":")
+	p.expect(":")
+	body := p.test()
+	fn := &scriptFuncDef{name: "lambda", line: t.line, params: params, body: []scriptStmt{&returnStmt{scriptPos: scriptPos(t.line), x: body}}}
+	fn.resolve()
+	return &lambdaExpr{scriptPos: scriptPos(t.line), fn: fn}
+}
+
+func (p *scriptParser) or() scriptExpr {
+	x := p.and()
+	for p.is("or") {
+		t := p.next()
+		x = &binaryExpr{scriptPos: scriptPos(t.line), op: "or", x: x, y: p.and()}
+	}
+	return x
+}
+
+func (p *scriptParser) and() scriptExpr {
+	x := p.not()
+	for p.is("and") {
+		t := p.next()
+		x = &binaryExpr{scriptPos: scriptPos(t.line), op: "and", x: x, y: p.not()}
+	}
+	return x
+}
+
+func (p *scriptParser) not() scriptExpr {
+	if p.is("not") {
+		t := p.next()
+		return &unaryExpr{scriptPos: scriptPos(t.line), op: "not", x: p.not()}
+	}
+	return p.comparison()
+}
+
+// comparison parses a comparison, which as in Starlark cannot be chained.
+func (p *scriptParser) comparison() scriptExpr {
+	x := p.arith()
+	t := p.peek()
+	op := p.compareOp()
+	if op == "" {
+		return x
+	}
+	x = &binaryExpr{scriptPos: scriptPos(t.line), op: op, x: x, y: p.arith()}
+	if t := p.peek(); p.compareOp() != "" {
+		p.fail(t, "comparisons cannot be chained; join them with and")
+	}
+	return x
+}
+
+// compareOp consumes a comparison operator, if the next tokens are one.
+func (p *scriptParser) compareOp() string {
+	t := p.peek()
+	switch {
+	case t.kind == tokOp && (t.text == "==" || t.text == "!=" || t.text == "<" || t.text == "<=" || t.text == ">" || t.text == ">="):
+		p.next()
+		return t.text
+	case p.is("in"):
+		p.next()
+		return "in"
+	case p.is("not") && p.toks[p.pos+1].kind == tokName && p.toks[p.pos+1].text == "in":
+		p.pos += 2
+		return "not in"
+	case p.is("is"):
+		p.fail(t, "is is not supported; compare with == or !=")
+	}
+	return ""
+}
+
+func (p *scriptParser) arith() scriptExpr {
+	x := p.term()
+	for p.is("+") || p.is("-") {
+		t := p.next()
+		x = &binaryExpr{scriptPos: scriptPos(t.line), op: t.text, x: x, y: p.term()}
+	}
+	return x
+}
+
+func (p *scriptParser) term() scriptExpr {
+	x := p.unary()
+	for p.is("*") || p.is("/") || p.is("//") || p.is("%") {
+		t := p.next()
+		x = &binaryExpr{scriptPos: scriptPos(t.line), op: t.text, x: x, y: p.unary()}
+	}
+	return x
+}
+
+func (p *scriptParser) unary() scriptExpr {
+	if p.is("-") || p.is("+") {
+		t := p.next()
+		return &unaryExpr{scriptPos: scriptPos(t.line), op: t.text, x: p.unary()}
+	}
+	return p.primary()
+}
+
+// primary parses an operand followed by any attributes, calls, indexes
+// and slices.
+func (p *scriptParser) primary() scriptExpr {
+	x := p.operand()
+	for {
+		t := p.peek()
+		switch {
+		case p.accept("."):
+			x = &dotExpr{scriptPos: scriptPos(t.line), x: x, name: p.ident()}
+		case p.accept("("):
+			x = p.call(t, x)
+		case p.accept("["):
+			x = p.index(t, x)
+		default:
+			return x
+		}
+	}
+}
+
+func (p *scriptParser) call(t scriptToken, fn scriptExpr) scriptExpr {
+	c := &callExpr{scriptPos: scriptPos(t.line), fn: fn}
+	for !p.is(")") {
+		arg := p.peek()
+		if p.is("*") || p.is("**") {
+			p.fail(arg, "*args and **kwargs are not supported")
+		}
+		if arg.kind == tokName && !scriptKeywords[arg.text] && p.toks[p.pos+1].kind == tokOp && p.toks[p.pos+1].text == "=" {
+			p.pos += 2
+			for _, a := range c.args {
+				if a.name == arg.text {
+					p.fail(arg, "argument %s given twice", arg.text)
+				}
+			}
+			c.args = append(c.args, callArg{name: arg.text, x: p.test()})
+		} else {
+			if n := len(c.args); n > 0 && c.args[n-1].name != "" {
+				p.fail(arg, "positional argument after keyword argument")
+			}
+			c.args = append(c.args, callArg{x: p.test()})
+		}
+		if !p.accept(",") {
+			break
+		}
+	}
+	p.expect(")")
+	return c
+}
+
+func (p *scriptParser) index(t scriptToken, x scriptExpr) scriptExpr {
+	var parts [3]scriptExpr
+	colons := 0
+	for {
+		if !p.is(":") && !p.is("]") {
+			parts[colons] = p.test()
+		}
+		if colons < 2 && p.accept(":") {
+			colons++
+			continue
+		}
+		break
+	}
+	p.expect("]")
+	if colons == 0 {
+		if parts[0] == nil {
+			p.fail(t, "missing index")
+		}
+		return &indexExpr{scriptPos: scriptPos(t.line), x: x, index: parts[0]}
+	}
+	return &sliceExpr{scriptPos: scriptPos(t.line), x: x, lo: parts[0], hi: parts[1], step: parts[2]}
+}
+
+func (p *scriptParser) operand() scriptExpr {
+	t := p.next()
+	at := scriptPos(t.line)
+	switch t.kind {
+	case tokNumber:
+		return &literalExpr{scriptPos: at, value: t.value}
+	case tokString:
+		// Adjacent strings are joined, as in Python.
+		s := t.text
+		for p.peek().kind == tokString {
+			s += p.next().text
+		}
+		return &literalExpr{scriptPos: at, value: s}
+	case tokName:
+		switch t.text {
+		case "None":
+			return &literalExpr{scriptPos: at, value: nil}
+		case "True":
+			return &literalExpr{scriptPos: at, value: true}
+		case "False":
+			return &literalExpr{scriptPos: at, value: false}
+		}
+		if !scriptKeywords[t.text] {
+			return &nameExpr{scriptPos: at, name: t.text}
+		}
+	case tokOp:
+		switch t.text {
+		case "(":
+			if p.accept(")") {
+				return &tupleExpr{scriptPos: at}
+			}
+			x := p.exprList()
+			p.expect(")")
+			return x
+		case "[":
+			return p.list(t)
+		case "{":
+			return p.dict(t)
+		}
+	}
+	p.fail(t, "unexpected %s", describeToken(t))
+	return nil
+}
+
+func (p *scriptParser) list(t scriptToken) scriptExpr {
+	l := &listExpr{scriptPos: scriptPos(t.line)}
+	if p.accept("]") {
+		return l
+	}
+	x := p.test()
+	if p.is("for") {
+		c := &compExpr{scriptPos: scriptPos(t.line), elem: x, clauses: p.compClauses()}
+		p.expect("]")
+		return c
+	}
+	l.elems = append(l.elems, x)
+	for p.accept(",") && !p.is("]") {
+		l.elems = append(l.elems, p.test())
+	}
+	p.expect("]")
+	return l
+}
+
+func (p *scriptParser) dict(t scriptToken) scriptExpr {
+	d := &dictExpr{scriptPos: scriptPos(t.line)}
+	if p.accept("}") {
+		return d
+	}
+	k := p.test()
+	p.expect(":")
+	v := p.test()
+	if p.is("for") {
+		c := &compExpr{scriptPos: scriptPos(t.line), key: k, elem: v, clauses: p.compClauses()}
+		p.expect("}")
+		return c
+	}
+	d.keys, d.values = append(d.keys, k), append(d.values, v)
+	for p.accept(",") && !p.is("}") {
+		k := p.test()
+		p.expect(":")
+		d.keys, d.values = append(d.keys, k), append(d.values, p.test())
+	}
+	p.expect("}")
+	return d
+}
+
+func (p *scriptParser) compClauses() []compClause {
+	var clauses []compClause
+	for {
+		switch {
+		case p.accept("for"):
+			vars := p.targets()
+			p.expect("in")
+			clauses = append(clauses, compClause{vars: vars, iter: p.or()})
+		case p.accept("if"):
+			clauses = append(clauses, compClause{cond: p.or()})
+		default:
+			return clauses
+		}
+	}
+}
@@ -0,0 +1,204 @@
+package pdfripper
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// evalScriptExpr returns what the script expression expr evaluates to, as
+// saved in a page's fields.
+func evalScriptExpr(t *testing.T, expr string) (any, error) {
+	t.Helper()
+	s, err := ParseScript("test.star", []byte("def transform(page):\n    page.fields[\"v\"] = "+expr+"\n"))
+	if err != nil {
+		return nil, err
+	}
+	r := &PageResult{Page: 1}
+	if err := s.PostProcess(r); err != nil {
+		return nil, err
+	}
+	return r.Fields["v"], nil
+}
+
+func TestScriptExpressions(t *testing.T) {
+	list := func(elems ...any) []any { return elems }
+	for _, tt := range []struct {
+		expr string
+		want any
+	}{
+		// Floor division and modulo round towards negative infinity, as
+		// Python's do, not towards zero, as Go's do.
+		{"7 // 2", int64(3)},
+		{"-7 // 2", int64(-4)},
+		{"7 // -2", int64(-4)},
+		{"-7.0 // 2", -4.0},
+		{"7 / 2", 3.5},
+		{"8 / 2", 4.0},
+		{"-7 % 3", int64(2)},
+		{"7 % -3", int64(-2)},
+		{"7.5 % 2", 1.5},
+		{"-9223372036854775807 - 1", int64(-9223372036854775808)},
+		{`"%d-%s" % (3, "a")`, "3-a"},
+
+		// Slicing.
+		{`"hello"[1:3]`, "el"},
+		{`"hello"[::-1]`, "olleh"},
+		{`"hello"[-3:]`, "llo"},
+		{`"hello"[10:]`, ""},
+		{"[1, 2, 3, 4, 5][::2]", list(int64(1), int64(3), int64(5))},
+		{"[1, 2, 3, 4][3:0:-1]", list(int64(4), int64(3), int64(2))},
+		{"(1, 2, 3)[1:]", list(int64(2), int64(3))},
+		{"[1, 2, 3][-1]", int64(3)},
+
+		// Comprehensions.
+		{"[x * x for x in range(5) if x % 2 == 0]", list(int64(0), int64(4), int64(16))},
+		{`[x + y for x in "ab" for y in "cd"]`, list("ac", "ad", "bc", "bd")},
+		{`{k: v * 10 for k, v in [("a", 1), ("b", 2)]}`, map[string]any{"a": int64(10), "b": int64(20)}},
+		{"[(lambda n: n + 1)(x) for x in [1, 2]]", list(int64(2), int64(3))},
+
+		// Built-ins, methods and the re module.
+		{`sorted(["b", "C", "a"], key=lambda s: s.lower())`, list("a", "b", "C")},
+		{`" a b ".strip().split(" ")`, list("a", "b")},
+		{`"{} and {name}".format(1, name="two")`, "1 and two"},
+		{`re.sub(r"(\w)-\n(\w)", "${1}${2}", "hy-\nphen")`, "hyphen"},
+		{`re.findall(r"\d+", "a1b22")`, list("1", "22")},
+		{`dict(a=1).get("b", 2)`, int64(2)},
+		{"1 < 2 and not (3 in [1, 2])", true},
+	} {
+		got, err := evalScriptExpr(t, tt.expr)
+		if err != nil {
+			t.Errorf("%s: %v", tt.expr, err)
+		} else if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s = %#v, want %#v", tt.expr, got, tt.want)
+		}
+	}
+}
+
+func TestScriptExpressionErrors(t *testing.T) {
+	for _, tt := range []struct {
+		expr, err string
+	}{
+		{"1 // 0", "division by zero"},
+		{"1 % 0", "division by zero"},
+		{"1.0 / 0", "division by zero"},
+		// Ints are 64-bit rather than growing as Starlark's do.
+		{"9223372036854775807 + 1", "integer overflow"},
+		{"-9223372036854775807 - 2", "integer overflow"},
+		{"4294967296 * 4294967296", "integer overflow"},
+		{"-(-9223372036854775807 - 1)", "integer overflow"},
+		{"(-9223372036854775807 - 1) // -1", "integer overflow"},
+		{"[1, 2][2]", "out of range"},
+		{`"a" + 1`, "unsupported"},
+		{"undefined_name", "undefined: undefined_name"},
+		{"1 < 2 < 3", "comparisons cannot be chained"},
+		{"None is None", "is is not supported"},
+		{`{[1]: 2}`, "list cannot be a dict key"},
+		{`{1: 2}`, "key 1 is not a string"},
+		{`re.sub("(", "", "x")`, "missing closing )"},
+	} {
+		_, err := evalScriptExpr(t, tt.expr)
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%s: got error %v, want one containing %q", tt.expr, err, tt.err)
+		}
+	}
+}
+
+func TestScriptRejects(t *testing.T) {
+	for _, tt := range []struct {
+		name, src, err string
+	}{
+		{"while", "def transform(page):\n    while True:\n        pass\n", "while loops are not supported"},
+		{"import", "import os\ndef transform(page):\n    pass\n", "import is not supported"},
+		{"class", "class A:\n    pass\n", "class is not supported"},
+		{"global", "def transform(page):\n    global x\n", "global is not supported"},
+		{"varargs", "def transform(*pages):\n    pass\n", "*args and **kwargs are not supported"},
+		{"return outside a function", "return 1\n", "return outside a function"},
+		{"break outside a loop", "def transform(page):\n    break\n", "break outside a loop"},
+		{"no transform", "x = 1\n", "no transform function"},
+		{"two arguments", "def transform(page, other):\n    pass\n", "transform must take one argument"},
+		{"bad indentation", "def transform(page):\npass\n", "expected an indented block"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseScript("test.star", []byte(tt.src))
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("got error %v, want one containing %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestScriptRuntimeLimits(t *testing.T) {
+	for _, tt := range []struct {
+		name, src, err string
+	}{
+		{"recursion", "def f(n):\n    return f(n - 1)\ndef transform(page):\n    f(3)\n", "f calls itself"},
+		{"frozen global list", "seen = []\ndef transform(page):\n    seen.append(page.number)\n", "cannot change a global value"},
+		{"frozen global dict", "counts = {}\ndef transform(page):\n    counts[\"n\"] = 1\n", "cannot change a global value"},
+		{"steps", "def transform(page):\n    for i in range(100000):\n        for j in range(1000):\n            pass\n", "ran more than"},
+		{"read-only attribute", "def transform(page):\n    page.number = 2\n", "page.number cannot be set"},
+		{"text type", "def transform(page):\n    page.text = 1\n", "page.text must be a string"},
+		{"fail", "def transform(page):\n    fail(\"no good\")\n", "no good"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := ParseScript("test.star", []byte(tt.src))
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = s.PostProcess(&PageResult{Page: 1, Text: "text"})
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("got error %v, want one containing %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestScriptTransform(t *testing.T) {
+	for _, tt := range []struct {
+		name, body string
+		text       string
+		fields     map[string]any
+		dropped    bool
+		err        string
+	}{
+		{name: "falls off the end", body: "pass", text: "Some text"},
+		{name: "returns None", body: "return None", text: "Some text"},
+		{name: "returns True", body: "return True", text: "Some text"},
+		{name: "returns False", body: "return False", text: "Some text", dropped: true},
+		{name: "returns an int", body: "return 1", err: "transform returned int, not None, True or False"},
+		{name: "returns a string", body: `return "yes"`, err: "transform returned string"},
+		{name: "changes the text", body: `page.text = page.text.upper() + " " + str(page.number)`, text: "SOME TEXT 4"},
+		{name: "sets fields", body: `page.fields["words"] = len(page.text.split())` + "\n    " + `page.fields["tags"] = ["a", ("b", 1.5)]`,
+			text: "Some text", fields: map[string]any{"kept": "yes", "words": int64(2), "tags": []any{"a", []any{"b", 1.5}}}},
+		{name: "replaces fields", body: "page.fields = {}", text: "Some text"},
+		{name: "reads page attributes", body: `page.fields["kept"] = [page.label, page.bates, page.classification, page.ocr_used]`,
+			text: "Some text", fields: map[string]any{"kept": []any{"iv", "ABC0004", "letter", true}}},
+		{name: "saves a function", body: "page.fields[\"f\"] = len", err: "builtin_function_or_method cannot be saved"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := ParseScript("test.star", []byte("def transform(page):\n    "+tt.body+"\n"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			r := &PageResult{Page: 4, Text: "Some text", Label: "iv", Bates: "ABC0004", Class: "letter", OCRUsed: true,
+				Fields: map[string]any{"kept": "yes"}}
+			err = s.PostProcess(r)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Errorf("got error %v, want one containing %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			fields := tt.fields
+			if fields == nil && tt.body != "page.fields = {}" {
+				fields = map[string]any{"kept": "yes"}
+			}
+			if r.Text != tt.text || r.Dropped != tt.dropped || !reflect.DeepEqual(r.Fields, fields) {
+				t.Errorf("got text %q, dropped %v and fields %#v; want %q, %v and %#v", r.Text, r.Dropped, r.Fields, tt.text, tt.dropped, fields)
+			}
+		})
+	}
+}
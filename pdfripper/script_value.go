@@ -0,0 +1,939 @@
+package pdfripper
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// The values of scripts are nil for None, bool, int64, float64, string and
+// the types below.
+
+type scriptList struct {
+	elems  []any
+	frozen bool
+}
+
+type scriptTuple []any
+
+// scriptDict is a dict, which keeps its keys in the order they were added.
+type scriptDict struct {
+	keys, values []any
+	index        map[any]int // hashKey of each key to its position.
+	frozen       bool
+}
+
+// scriptRange is the sequence range returns, whose elements are computed
+// as they are needed.
+type scriptRange struct {
+	start, stop, step int64
+}
+
+type scriptFunc struct {
+	def      *scriptFuncDef
+	defaults []any // Values of the parameters' defaults, by position.
+	globals  map[string]any
+	outer    *scriptFrame // The call the function was defined in, if it is nested.
+	frozen   bool
+}
+
+// scriptBuiltin is a function written in Go, or a method bound to recv.
+type scriptBuiltin struct {
+	name string
+	recv any
+	fn   func(th *scriptThread, b *scriptBuiltin, args []any, kwargs []scriptKwarg) (any, error)
+}
+
+type scriptKwarg struct {
+	name  string
+	value any
+}
+
+type scriptModule struct {
+	name    string
+	members map[string]any
+}
+
+// Limits on what one operation may build, so that a mistake such as
+// "x" * 10**12 fails instead of exhausting memory.
+const (
+	scriptMaxString = 1 << 28 // Bytes.
+	scriptMaxList   = 1 << 24 // Elements.
+)
+
+var errScriptFrozen = errors.New("cannot change a global value once the script has loaded")
+
+func typeName(v any) string {
+	switch v.(type) {
+	case nil:
+		return "NoneType"
+	case bool:
+		return "bool"
+	case int64:
+		return "int"
+	case float64:
+		return "float"
+	case string:
+		return "string"
+	case *scriptList:
+		return "list"
+	case scriptTuple:
+		return "tuple"
+	case *scriptDict:
+		return "dict"
+	case scriptRange:
+		return "range"
+	case *scriptFunc:
+		return "function"
+	case *scriptBuiltin:
+		return "builtin_function_or_method"
+	case *scriptModule:
+		return "module"
+	case *scriptPage:
+		return "page"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+func truth(v any) bool {
+	switch v := v.(type) {
+	case nil:
+		return false
+	case bool:
+		return v
+	case int64:
+		return v != 0
+	case float64:
+		return v != 0
+	case string:
+		return v != ""
+	case *scriptList:
+		return len(v.elems) > 0
+	case scriptTuple:
+		return len(v) > 0
+	case *scriptDict:
+		return len(v.keys) > 0
+	case scriptRange:
+		return v.len() > 0
+	}
+	return true
+}
+
+// scriptStr returns v as str does: strings as they are, and everything
+// else as repr does.
+func scriptStr(v any) string {
+	if s, ok := v.(string); ok {
+		return s
+	}
+	return scriptRepr(v)
+}
+
+func scriptRepr(v any) string {
+	var b strings.Builder
+	writeRepr(&b, v, 0)
+	return b.String()
+}
+
+// writeRepr writes the repr of v, giving up on values nested so deep that
+// they may contain themselves.
+func writeRepr(b *strings.Builder, v any, depth int) {
+	if depth > 64 {
+		b.WriteString("...")
+		return
+	}
+	seq := func(open, close string, elems []any) {
+		b.WriteString(open)
+		for i, e := range elems {
+			if i > 0 {
+				b.WriteString(", ")
+			}
+			writeRepr(b, e, depth+1)
+		}
+		if open == "(" && len(elems) == 1 {
+			b.WriteByte(',')
+		}
+		b.WriteString(close)
+	}
+	switch v := v.(type) {
+	case nil:
+		b.WriteString("None")
+	case bool:
+		if v {
+			b.WriteString("True")
+		} else {
+			b.WriteString("False")
+		}
+	case int64:
+		b.WriteString(strconv.FormatInt(v, 10))
+	case float64:
+		b.WriteString(formatScriptFloat(v))
+	case string:
+		b.WriteString(strconv.Quote(v))
+	case *scriptList:
+		seq("[", "]", v.elems)
+	case scriptTuple:
+		seq("(", ")", v)
+	case *scriptDict:
+		b.WriteByte('{')
+		for i, k := range v.keys {
+			if i > 0 {
+				b.WriteString(", ")
+			}
+			writeRepr(b, k, depth+1)
+			b.WriteString(": ")
+			writeRepr(b, v.values[i], depth+1)
+		}
+		b.WriteByte('}')
+	case scriptRange:
+		fmt.Fprintf(b, "range(%d, %d", v.start, v.stop)
+		if v.step != 1 {
+			fmt.Fprintf(b, ", %d", v.step)
+		}
+		b.WriteByte(')')
+	case *scriptFunc:
+		fmt.Fprintf(b, "<function %s>", v.def.name)
+	case *scriptBuiltin:
+		fmt.Fprintf(b, "<built-in function %s>", v.name)
+	case *scriptModule:
+		fmt.Fprintf(b, "<module %s>", v.name)
+	case *scriptPage:
+		fmt.Fprintf(b, "<page %d>", v.r.Page)
+	default:
+		fmt.Fprintf(b, "%v", v)
+	}
+}
+
+// formatScriptFloat formats f as Python does, always with a point or an
+// exponent.
+func formatScriptFloat(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "inf"
+	case math.IsInf(f, -1):
+		return "-inf"
+	case math.IsNaN(f):
+		return "nan"
+	}
+	s := strconv.FormatFloat(f, 'g', -1, 64)
+	if !strings.ContainsAny(s, ".e") {
+		s += ".0"
+	}
+	return s
+}
+
+// scriptEqual reports whether a == b, comparing lists, tuples and dicts by
+// their elements.
+func scriptEqual(a, b any) bool {
+	return equalDepth(a, b, 0)
+}
+
+func equalDepth(a, b any, depth int) bool {
+	if depth > 64 {
+		return false
+	}
+	switch a := a.(type) {
+	case int64:
+		switch b := b.(type) {
+		case int64:
+			return a == b
+		case float64:
+			return float64(a) == b
+		}
+		return false
+	case float64:
+		switch b := b.(type) {
+		case int64:
+			return a == float64(b)
+		case float64:
+			return a == b
+		}
+		return false
+	case *scriptList:
+		bl, ok := b.(*scriptList)
+		return ok && equalElems(a.elems, bl.elems, depth)
+	case scriptTuple:
+		bt, ok := b.(scriptTuple)
+		return ok && equalElems(a, bt, depth)
+	case *scriptDict:
+		bd, ok := b.(*scriptDict)
+		if !ok || len(a.keys) != len(bd.keys) {
+			return false
+		}
+		for i, k := range a.keys {
+			v, found, _ := bd.get(k)
+			if !found || !equalDepth(a.values[i], v, depth+1) {
+				return false
+			}
+		}
+		return true
+	case scriptRange:
+		br, ok := b.(scriptRange)
+		return ok && a.len() == br.len() && (a.len() == 0 || a.start == br.start && (a.len() == 1 || a.step == br.step))
+	}
+	if _, ok := b.(scriptTuple); ok {
+		return false
+	}
+	return a == b
+}
+
+func equalElems(a, b []any, depth int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !equalDepth(a[i], b[i], depth+1) {
+			return false
+		}
+	}
+	return true
+}
+
+// scriptCmp orders a and b, which must be numbers, strings, bools or
+// lists or tuples of them.
+func scriptCmp(a, b any) (int, error) {
+	switch a := a.(type) {
+	case int64:
+		switch b := b.(type) {
+		case int64:
+			return cmpOrdered(a, b), nil
+		case float64:
+			return cmpOrdered(float64(a), b), nil
+		}
+	case float64:
+		if f, ok := toFloat(b); ok {
+			return cmpOrdered(a, f), nil
+		}
+	case string:
+		if s, ok := b.(string); ok {
+			return strings.Compare(a, s), nil
+		}
+	case bool:
+		if v, ok := b.(bool); ok {
+			return cmpOrdered(boolInt(a), boolInt(v)), nil
+		}
+	case *scriptList:
+		if l, ok := b.(*scriptList); ok {
+			return cmpElems(a.elems, l.elems)
+		}
+	case scriptTuple:
+		if t, ok := b.(scriptTuple); ok {
+			return cmpElems(a, t)
+		}
+	}
+	return 0, fmt.Errorf("cannot compare %s with %s", typeName(a), typeName(b))
+}
+
+func cmpOrdered[T int64 | float64](a, b T) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func boolInt(b bool) int64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func cmpElems(a, b []any) (int, error) {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if scriptEqual(a[i], b[i]) {
+			continue
+		}
+		return scriptCmp(a[i], b[i])
+	}
+	return cmpOrdered(int64(len(a)), int64(len(b))), nil
+}
+
+func toFloat(v any) (float64, bool) {
+	switch v := v.(type) {
+	case int64:
+		return float64(v), true
+	case float64:
+		return v, true
+	}
+	return 0, false
+}
+
+// scriptBinary applies a binary operator other than and and or.
+func scriptBinary(op string, a, b any) (any, error) {
+	switch op {
+	case "==":
+		return scriptEqual(a, b), nil
+	case "!=":
+		return !scriptEqual(a, b), nil
+	case "<", "<=", ">", ">=":
+		c, err := scriptCmp(a, b)
+		if err != nil {
+			return nil, err
+		}
+		switch op {
+		case "<":
+			return c < 0, nil
+		case "<=":
+			return c <= 0, nil
+		case ">":
+			return c > 0, nil
+		}
+		return c >= 0, nil
+	case "in", "not in":
+		in, err := scriptContains(b, a)
+		if err != nil {
+			return nil, err
+		}
+		return in == (op == "in"), nil
+	case "+":
+		switch a := a.(type) {
+		case string:
+			if s, ok := b.(string); ok {
+				if len(a)+len(s) > scriptMaxString {
+					return nil, errors.New("string too long")
+				}
+				return a + s, nil
+			}
+		case *scriptList:
+			if l, ok := b.(*scriptList); ok {
+				return &scriptList{elems: append(append([]any{}, a.elems...), l.elems...)}, nil
+			}
+		case scriptTuple:
+			if t, ok := b.(scriptTuple); ok {
+				return append(append(scriptTuple{}, a...), t...), nil
+			}
+		}
+	case "*":
+		if n, ok := b.(int64); ok {
+			if v, ok, err := scriptRepeat(a, n); ok {
+				return v, err
+			}
+		}
+		if n, ok := a.(int64); ok {
+			if v, ok, err := scriptRepeat(b, n); ok {
+				return v, err
+			}
+		}
+	case "%":
+		if format, ok := a.(string); ok {
+			return scriptPercent(format, b)
+		}
+	}
+	return scriptArith(op, a, b)
+}
+
+// scriptRepeat repeats a string, list or tuple n times, reporting
+// whether x is one.
+func scriptRepeat(x any, n int64) (any, bool, error) {
+	n = max(n, 0)
+	var size int64
+	switch x := x.(type) {
+	case string:
+		size = int64(len(x))
+	case *scriptList:
+		size = int64(len(x.elems))
+	case scriptTuple:
+		size = int64(len(x))
+	default:
+		return nil, false, nil
+	}
+	if size > 0 && n > scriptMaxString/size {
+		return nil, true, errors.New("result too large")
+	}
+	switch x := x.(type) {
+	case string:
+		return strings.Repeat(x, int(n)), true, nil
+	case *scriptList:
+		if size*n > scriptMaxList {
+			return nil, true, errors.New("result too large")
+		}
+		l := &scriptList{}
+		for i := int64(0); i < n; i++ {
+			l.elems = append(l.elems, x.elems...)
+		}
+		return l, true, nil
+	}
+	t := x.(scriptTuple)
+	if size*n > scriptMaxList {
+		return nil, true, errors.New("result too large")
+	}
+	var out scriptTuple
+	for i := int64(0); i < n; i++ {
+		out = append(out, t...)
+	}
+	return out, true, nil
+}
+
+// scriptArith applies an arithmetic operator to two numbers. Operations on
+// two ints give an int, and fail rather than overflow, except for /,
+// which gives a float; as in Python, // and % round towards negative
+// infinity.
+func scriptArith(op string, a, b any) (any, error) {
+	x, xInt := a.(int64)
+	y, yInt := b.(int64)
+	if xInt && yInt {
+		switch op {
+		case "+":
+			if y > 0 && x > math.MaxInt64-y || y < 0 && x < math.MinInt64-y {
+				return nil, errors.New("integer overflow")
+			}
+			return x + y, nil
+		case "-":
+			if y < 0 && x > math.MaxInt64+y || y > 0 && x < math.MinInt64+y {
+				return nil, errors.New("integer overflow")
+			}
+			return x - y, nil
+		case "*":
+			r := x * y
+			if x != 0 && (r/x != y || x == -1 && y == math.MinInt64) {
+				return nil, errors.New("integer overflow")
+			}
+			return r, nil
+		case "//", "%":
+			if y == 0 {
+				return nil, errors.New("division by zero")
+			}
+			if x == math.MinInt64 && y == -1 {
+				return nil, errors.New("integer overflow")
+			}
+			q, m := x/y, x%y
+			if m != 0 && (m < 0) != (y < 0) {
+				q, m = q-1, m+y
+			}
+			if op == "//" {
+				return q, nil
+			}
+			return m, nil
+		}
+	}
+	f, ok1 := toFloat(a)
+	g, ok2 := toFloat(b)
+	if !ok1 || !ok2 {
+		return nil, fmt.Errorf("unsupported operand types for %s: %s and %s", op, typeName(a), typeName(b))
+	}
+	switch op {
+	case "+":
+		return f + g, nil
+	case "-":
+		return f - g, nil
+	case "*":
+		return f * g, nil
+	}
+	if g == 0 {
+		return nil, errors.New("division by zero")
+	}
+	switch op {
+	case "/":
+		return f / g, nil
+	case "//":
+		return math.Floor(f / g), nil
+	}
+	m := math.Mod(f, g)
+	if m != 0 && (m < 0) != (g < 0) {
+		m += g
+	}
+	return m, nil
+}
+
+// scriptContains reports whether x is in container.
+func scriptContains(container, x any) (bool, error) {
+	switch c := container.(type) {
+	case string:
+		s, ok := x.(string)
+		if !ok {
+			return false, fmt.Errorf("in string needs a string on the left, not %s", typeName(x))
+		}
+		return strings.Contains(c, s), nil
+	case *scriptList:
+		return containsElem(c.elems, x), nil
+	case scriptTuple:
+		return containsElem(c, x), nil
+	case *scriptDict:
+		_, found, err := c.get(x)
+		return found, err
+	case scriptRange:
+		n, ok := x.(int64)
+		if !ok {
+			return false, nil
+		}
+		if c.step > 0 && (n < c.start || n >= c.stop) || c.step < 0 && (n > c.start || n <= c.stop) {
+			return false, nil
+		}
+		return (n-c.start)%c.step == 0, nil
+	}
+	return false, fmt.Errorf("in %s is not supported", typeName(container))
+}
+
+func containsElem(elems []any, x any) bool {
+	for _, e := range elems {
+		if scriptEqual(e, x) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r scriptRange) len() int64 {
+	switch {
+	case r.step > 0 && r.start < r.stop:
+		return (r.stop - r.start + r.step - 1) / r.step
+	case r.step < 0 && r.start > r.stop:
+		return (r.start - r.stop - r.step - 1) / -r.step
+	}
+	return 0
+}
+
+func (r scriptRange) at(i int64) int64 {
+	return r.start + i*r.step
+}
+
+// scriptLen returns the length of a string, in characters, or of a
+// collection.
+func scriptLen(v any) (int, bool) {
+	switch v := v.(type) {
+	case string:
+		return utf8.RuneCountInString(v), true
+	case *scriptList:
+		return len(v.elems), true
+	case scriptTuple:
+		return len(v), true
+	case *scriptDict:
+		return len(v.keys), true
+	case scriptRange:
+		return int(v.len()), true
+	}
+	return 0, false
+}
+
+// seqIndex returns the position index k gives in a sequence of n
+// elements, counting from the end if it is negative.
+func seqIndex(k any, n int) (int, error) {
+	i, ok := k.(int64)
+	if !ok {
+		return 0, fmt.Errorf("indices must be ints, not %s", typeName(k))
+	}
+	j := i
+	if j < 0 {
+		j += int64(n)
+	}
+	if j < 0 || j >= int64(n) {
+		return 0, fmt.Errorf("index %d out of range for length %d", i, n)
+	}
+	return int(j), nil
+}
+
+func scriptIndex(x, k any) (any, error) {
+	switch x := x.(type) {
+	case *scriptList:
+		i, err := seqIndex(k, len(x.elems))
+		if err != nil {
+			return nil, err
+		}
+		return x.elems[i], nil
+	case scriptTuple:
+		i, err := seqIndex(k, len(x))
+		if err != nil {
+			return nil, err
+		}
+		return x[i], nil
+	case string:
+		runes := []rune(x)
+		i, err := seqIndex(k, len(runes))
+		if err != nil {
+			return nil, err
+		}
+		return string(runes[i]), nil
+	case scriptRange:
+		i, err := seqIndex(k, int(x.len()))
+		if err != nil {
+			return nil, err
+		}
+		return x.at(int64(i)), nil
+	case *scriptDict:
+		v, found, err := x.get(k)
+		if err != nil {
+			return nil, err
+		}
+		if !found {
+			return nil, fmt.Errorf("key %s not in dict", scriptRepr(k))
+		}
+		return v, nil
+	}
+	return nil, fmt.Errorf("%s cannot be indexed", typeName(x))
+}
+
+func scriptSetIndex(x, k, v any) error {
+	switch x := x.(type) {
+	case *scriptList:
+		if x.frozen {
+			return errScriptFrozen
+		}
+		i, err := seqIndex(k, len(x.elems))
+		if err != nil {
+			return err
+		}
+		x.elems[i] = v
+		return nil
+	case *scriptDict:
+		return x.set(k, v)
+	}
+	return fmt.Errorf("%s does not support assigning to elements", typeName(x))
+}
+
+// scriptSlice returns x[lo:hi:step], with nil for the bounds left out, as
+// Python does.
+func scriptSlice(x, lo, hi, step any) (any, error) {
+	var n int
+	var runes []rune
+	switch v := x.(type) {
+	case *scriptList:
+		n = len(v.elems)
+	case scriptTuple:
+		n = len(v)
+	case string:
+		runes = []rune(v)
+		n = len(runes)
+	default:
+		return nil, fmt.Errorf("%s cannot be sliced", typeName(x))
+	}
+	st := int64(1)
+	if step != nil {
+		s, ok := step.(int64)
+		if !ok || s == 0 {
+			return nil, fmt.Errorf("slice step must be a non-zero int, not %s", scriptRepr(step))
+		}
+		st = s
+	}
+	bound := func(v any, dflt int64) (int64, error) {
+		if v == nil {
+			return dflt, nil
+		}
+		i, ok := v.(int64)
+		if !ok {
+			return 0, fmt.Errorf("slice indices must be ints, not %s", typeName(v))
+		}
+		if i < 0 {
+			i += int64(n)
+		}
+		if st > 0 {
+			return min(max(i, 0), int64(n)), nil
+		}
+		return min(max(i, -1), int64(n)-1), nil
+	}
+	var start, end int64
+	var err error
+	if st > 0 {
+		start, err = bound(lo, 0)
+		if err == nil {
+			end, err = bound(hi, int64(n))
+		}
+	} else {
+		start, err = bound(lo, int64(n)-1)
+		if err == nil {
+			end, err = bound(hi, -1)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	var picked []int
+	for i := start; st > 0 && i < end || st < 0 && i > end; i += st {
+		picked = append(picked, int(i))
+	}
+	switch v := x.(type) {
+	case *scriptList:
+		l := &scriptList{}
+		for _, i := range picked {
+			l.elems = append(l.elems, v.elems[i])
+		}
+		return l, nil
+	case scriptTuple:
+		t := scriptTuple{}
+		for _, i := range picked {
+			t = append(t, v[i])
+		}
+		return t, nil
+	}
+	out := make([]rune, 0, len(picked))
+	for _, i := range picked {
+		out = append(out, runes[i])
+	}
+	return string(out), nil
+}
+
+func newScriptDict() *scriptDict {
+	return &scriptDict{index: map[any]int{}}
+}
+
+// hashKey returns the Go map key of a dict key, failing for lists and
+// dicts, whose contents may change. Numbers equal as ints and floats have
+// the same key.
+func hashKey(k any) (any, error) {
+	switch k := k.(type) {
+	case nil, bool, int64, string:
+		return k, nil
+	case float64:
+		if k == math.Trunc(k) && math.Abs(k) < 1<<63 {
+			return int64(k), nil
+		}
+		return k, nil
+	case scriptTuple:
+		parts := make([]string, len(k))
+		for i, e := range k {
+			h, err := hashKey(e)
+			if err != nil {
+				return nil, err
+			}
+			parts[i] = fmt.Sprintf("%T:%#v", h, h)
+		}
+		return scriptTupleKey(strings.Join(parts, ",")), nil
+	}
+	return nil, fmt.Errorf("%s cannot be a dict key", typeName(k))
+}
+
+type scriptTupleKey string
+
+func (d *scriptDict) get(k any) (any, bool, error) {
+	h, err := hashKey(k)
+	if err != nil {
+		return nil, false, err
+	}
+	i, ok := d.index[h]
+	if !ok {
+		return nil, false, nil
+	}
+	return d.values[i], true, nil
+}
+
+func (d *scriptDict) set(k, v any) error {
+	if d.frozen {
+		return errScriptFrozen
+	}
+	h, err := hashKey(k)
+	if err != nil {
+		return err
+	}
+	if i, ok := d.index[h]; ok {
+		d.values[i] = v
+		return nil
+	}
+	d.index[h] = len(d.keys)
+	d.keys = append(d.keys, k)
+	d.values = append(d.values, v)
+	return nil
+}
+
+func (d *scriptDict) delete(k any) (any, bool, error) {
+	if d.frozen {
+		return nil, false, errScriptFrozen
+	}
+	h, err := hashKey(k)
+	if err != nil {
+		return nil, false, err
+	}
+	i, ok := d.index[h]
+	if !ok {
+		return nil, false, nil
+	}
+	v := d.values[i]
+	d.keys = append(d.keys[:i], d.keys[i+1:]...)
+	d.values = append(d.values[:i], d.values[i+1:]...)
+	delete(d.index, h)
+	for k, j := range d.index {
+		if j > i {
+			d.index[k] = j - 1
+		}
+	}
+	return v, true, nil
+}
+
+// freeze makes v, and everything it holds, read-only.
+func freeze(v any) {
+	switch v := v.(type) {
+	case *scriptList:
+		if !v.frozen {
+			v.frozen = true
+			for _, e := range v.elems {
+				freeze(e)
+			}
+		}
+	case scriptTuple:
+		for _, e := range v {
+			freeze(e)
+		}
+	case *scriptDict:
+		if !v.frozen {
+			v.frozen = true
+			for _, e := range v.values {
+				freeze(e)
+			}
+		}
+	case *scriptFunc:
+		if !v.frozen {
+			v.frozen = true
+			for _, e := range v.defaults {
+				freeze(e)
+			}
+		}
+	}
+}
+
+// scriptIterator steps through the elements of a value for loops and
+// comprehensions.
+type scriptIterator interface {
+	next() (any, bool)
+}
+
+type sliceIterator struct {
+	elems []any
+	i     int
+}
+
+func (it *sliceIterator) next() (any, bool) {
+	if it.i == len(it.elems) {
+		return nil, false
+	}
+	it.i++
+	return it.elems[it.i-1], true
+}
+
+type rangeIterator struct {
+	r scriptRange
+	i int64
+}
+
+func (it *rangeIterator) next() (any, bool) {
+	if it.i == it.r.len() {
+		return nil, false
+	}
+	it.i++
+	return it.r.at(it.i - 1), true
+}
+
+// iterate returns an iterator over the elements of a list, tuple or
+// range, the keys of a dict or the characters of a string. Lists and
+// dicts are copied first, so that a loop may change them.
+func iterate(v any) (scriptIterator, error) {
+	switch v := v.(type) {
+	case *scriptList:
+		return &sliceIterator{elems: append([]any{}, v.elems...)}, nil
+	case scriptTuple:
+		return &sliceIterator{elems: v}, nil
+	case *scriptDict:
+		return &sliceIterator{elems: append([]any{}, v.keys...)}, nil
+	case scriptRange:
+		return &rangeIterator{r: v}, nil
+	case string:
+		var chars []any
+		for _, r := range v {
+			chars = append(chars, string(r))
+		}
+		return &sliceIterator{elems: chars}, nil
+	}
+	return nil, fmt.Errorf("%s is not iterable", typeName(v))
+}
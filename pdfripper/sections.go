@@ -0,0 +1,167 @@
+package pdfripper
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// SectionsDir is the directory in OutputDir that SectionMarker splits the
+// text into.
+const SectionsDir = "sections"
+
+// sectionNameLen bounds the part of a section file's name taken from its
+// title, in runes.
+const sectionNameLen = 60
+
+// ParseSectionMarker parses a section marker as -split-by takes it,
+// regex:PATTERN, matched against each line of the text.
+func ParseSectionMarker(spec string) (*regexp.Regexp, error) {
+	pattern, ok := strings.CutPrefix(spec, "regex:")
+	if !ok {
+		return nil, fmt.Errorf("section marker %q is not regex:PATTERN", spec)
+	}
+	if pattern == "" {
+		return nil, errors.New("section marker has an empty pattern")
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("section marker: %w", err)
+	}
+	return re, nil
+}
+
+// sectionSink writes the text, in page order, to a file per section in
+// dir, each starting at a line that marker matches, with the line's
+// leading and trailing space trimmed first. Files are numbered in order
+// and named after their first lines, as in 001_ARTICLE_1_Definitions.txt;
+// text before the first section, if any, goes to 000_preamble.txt. Page
+// breaks within a section are form feeds, as in CombinedFile.
+type sectionSink struct {
+	dir     string
+	marker  *regexp.Regexp
+	confine []string // If set, the directories its files must lie in (Extractor.ConfineTo).
+
+	n       int
+	cur     *combinedSink
+	path    string
+	title   string
+	first   int
+	last    int
+	pending strings.Builder // Text before the first section that is only space so far.
+	madeDir bool
+}
+
+func (s *sectionSink) WritePage(r *PageResult) error {
+	lines := strings.SplitAfter(r.Text, "\n")
+	for _, line := range lines {
+		if title := strings.TrimSpace(line); title != "" && s.marker.MatchString(title) {
+			if err := s.closeSection(); err != nil {
+				return err
+			}
+			s.n++
+			if err := s.open(sectionFileName(s.n, title), title, r.Page); err != nil {
+				return err
+			}
+		}
+		if err := s.write(line, r.Page); err != nil {
+			return err
+		}
+	}
+	return s.write("\f", r.Page)
+}
+
+// write adds text of page to the current section, opening the preamble
+// for text before the first that is not all space.
+func (s *sectionSink) write(text string, page int) error {
+	if s.cur == nil {
+		if strings.TrimSpace(strings.ReplaceAll(s.pending.String()+text, "\f", "")) == "" {
+			s.pending.WriteString(text)
+			return nil
+		}
+		if err := s.open("000_preamble.txt", "preamble", page); err != nil {
+			return err
+		}
+		text = s.pending.String() + text
+		s.pending.Reset()
+	}
+	s.last = page
+	_, err := s.cur.w.WriteString(text)
+	return err
+}
+
+// open starts the section file name in dir.
+func (s *sectionSink) open(name, title string, page int) error {
+	if !s.madeDir {
+		if err := os.MkdirAll(s.dir, 0755); err != nil {
+			return err
+		}
+		s.madeDir = true
+	}
+	path := filepath.Join(s.dir, name)
+	if len(s.confine) > 0 {
+		if err := Confined(path, s.confine...); err != nil {
+			return err
+		}
+	}
+	cur, err := newCombinedSink(path)
+	if err != nil {
+		return err
+	}
+	s.cur, s.path, s.title, s.first, s.last = cur, path, title, page, page
+	return nil
+}
+
+func (s *sectionSink) closeSection() error {
+	s.pending.Reset()
+	if s.cur == nil {
+		return nil
+	}
+	err := s.cur.Close()
+	s.cur = nil
+	if err != nil {
+		return err
+	}
+	pages := "page " + strconv.Itoa(s.first)
+	if s.last != s.first {
+		pages = fmt.Sprintf("pages %d-%d", s.first, s.last)
+	}
+	fmt.Printf("Saved section %q (%s) to %s\n", s.title, pages, s.path)
+	return nil
+}
+
+func (s *sectionSink) Close() error {
+	return s.closeSection()
+}
+
+// sectionFileName returns the name of the nth section's file, titled
+// title: the number and the title's letters and digits, the rest of it
+// replaced with underscores, or the number alone if it has none.
+func sectionFileName(n int, title string) string {
+	var b strings.Builder
+	gap := false
+	for _, r := range title {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			gap = true
+			continue
+		}
+		if gap && b.Len() > 0 {
+			b.WriteByte('_')
+		}
+		gap = false
+		b.WriteRune(r)
+	}
+	name := []rune(b.String())
+	if len(name) > sectionNameLen {
+		name = []rune(strings.TrimRight(string(name[:sectionNameLen]), "_"))
+	}
+	if len(name) == 0 {
+		return fmt.Sprintf("%03d.txt", n)
+	}
+	return fmt.Sprintf("%03d_%s.txt", n, string(name))
+}
@@ -0,0 +1,272 @@
+package pdfripper
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"strings"
+	"unicode"
+)
+
+// SegmentsFile is the file in OutputDir that Segment writes the segments
+// of the text to.
+const SegmentsFile = "segments.jsonl"
+
+// Values of Extractor.Segment.
+const (
+	SegmentSentences  = "sentences"
+	SegmentParagraphs = "paragraphs"
+)
+
+// Segmentations lists the segmentations Extractor.Segment takes.
+var Segmentations = []string{SegmentSentences, SegmentParagraphs}
+
+// Segment is one line of SegmentsFile: a sentence or paragraph of the
+// text, which may run over a page break, and where it lies in the text of
+// its pages as the page files hold it, in Unicode code points.
+type Segment struct {
+	Segment int    `json:"segment"`  // From 1, in document order.
+	Page    int    `json:"page"`     // The page it starts on.
+	Start   int    `json:"start"`    // Offset of its first character in Page's text.
+	EndPage int    `json:"end_page"` // The page it ends on, Page unless it runs over a page break.
+	End     int    `json:"end"`      // Offset just past its last character in EndPage's text.
+	Text    string `json:"text"`     // With each run of whitespace, line breaks too, made a single space.
+}
+
+// sentenceAbbreviations end with a period without ending a sentence, in
+// lower case.
+var sentenceAbbreviations = map[string]bool{
+	"mr": true, "mrs": true, "ms": true, "dr": true, "prof": true, "sr": true, "jr": true, "st": true,
+	"vs": true, "etc": true, "e.g": true, "i.e": true, "cf": true, "al": true, "approx": true,
+	"no": true, "nos": true, "fig": true, "figs": true, "eq": true, "vol": true, "p": true, "pp": true,
+	"ch": true, "sec": true, "art": true, "para": true, "inc": true, "ltd": true, "co": true, "corp": true,
+	"jan": true, "feb": true, "mar": true, "apr": true, "jun": true, "jul": true, "aug": true,
+	"sep": true, "sept": true, "oct": true, "nov": true, "dec": true,
+}
+
+// segmentSpan is where a page's text starts in a segmentSink's buffer:
+// buf[start] is the character at offset of the page's text.
+type segmentSpan struct {
+	start, page, offset int
+}
+
+// segmentSink writes the sentences or paragraphs of the pages, in page
+// order, to a JSONL file. Pages are joined by a form feed, so that
+// paragraphs and sentences run on over page breaks unless a blank line at
+// the start of a page ends them. Only the text of the segment that may
+// still go on is held between pages.
+type segmentSink struct {
+	f     *os.File
+	w     *bufio.Writer
+	split func([]rune) [][2]int
+	n     int
+	buf   []rune
+	spans []segmentSpan
+}
+
+func newSegmentSink(path, segmentation string) (*segmentSink, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	split := sentenceSpans
+	if segmentation == SegmentParagraphs {
+		split = paragraphSpans
+	}
+	return &segmentSink{f: f, w: bufio.NewWriter(f), split: split}, nil
+}
+
+func (s *segmentSink) WritePage(r *PageResult) error {
+	if len(s.spans) > 0 {
+		s.buf = append(s.buf, '\f')
+	}
+	s.spans = append(s.spans, segmentSpan{start: len(s.buf), page: r.Page})
+	s.buf = append(s.buf, []rune(r.Text)...)
+	// The last segment may go on in the next page.
+	segs := s.split(s.buf)
+	if len(segs) < 2 {
+		return nil
+	}
+	for _, seg := range segs[:len(segs)-1] {
+		if err := s.emit(seg); err != nil {
+			return err
+		}
+	}
+	s.drop(segs[len(segs)-1][0])
+	return nil
+}
+
+// emit writes the segment of buf[seg[0]:seg[1]].
+func (s *segmentSink) emit(seg [2]int) error {
+	s.n++
+	page, start := s.locate(seg[0])
+	endPage, end := s.locate(seg[1] - 1)
+	data, err := json.Marshal(Segment{
+		Segment: s.n,
+		Page:    page,
+		Start:   start,
+		EndPage: endPage,
+		End:     end + 1,
+		Text:    strings.Join(strings.Fields(string(s.buf[seg[0]:seg[1]])), " "),
+	})
+	if err != nil {
+		return err
+	}
+	_, err = s.w.Write(append(data, '\n'))
+	return err
+}
+
+// locate returns the page and offset of buf[i]; the form feed after a
+// page is at the offset just past its end.
+func (s *segmentSink) locate(i int) (page, offset int) {
+	sp := s.spans[0]
+	for _, next := range s.spans[1:] {
+		if next.start > i {
+			break
+		}
+		sp = next
+	}
+	return sp.page, sp.offset + i - sp.start
+}
+
+// drop removes buf[:n], which has been written.
+func (s *segmentSink) drop(n int) {
+	s.buf = append(s.buf[:0], s.buf[n:]...)
+	var kept []segmentSpan
+	for i, sp := range s.spans {
+		if i+1 < len(s.spans) && s.spans[i+1].start <= n {
+			continue // The page ends before buf does now.
+		}
+		if sp.start < n {
+			sp.offset += n - sp.start
+			sp.start = n
+		}
+		sp.start -= n
+		kept = append(kept, sp)
+	}
+	s.spans = kept
+}
+
+func (s *segmentSink) Close() error {
+	var err error
+	for _, seg := range s.split(s.buf) {
+		if err = s.emit(seg); err != nil {
+			break
+		}
+	}
+	if cerr := closeBuffered(s.f, s.w); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// paragraphSpans returns where the paragraphs of text are: the runs of
+// lines between blank lines, without their leading and trailing space. A
+// form feed, which joins pages, is space but not a line break, so that
+// blank lines at the end of a page do not end a paragraph.
+func paragraphSpans(text []rune) [][2]int {
+	var spans [][2]int
+	start, end := -1, -1 // Of the current paragraph's first and last non-space.
+	breaks := 0          // Line breaks since end.
+	for i, r := range text {
+		switch {
+		case r == '\f':
+			breaks = 0
+		case r == '\n':
+			breaks++
+		case unicode.IsSpace(r):
+		default:
+			if start >= 0 && breaks >= 2 {
+				spans = append(spans, [2]int{start, end + 1})
+				start = -1
+			}
+			if start < 0 {
+				start = i
+			}
+			end, breaks = i, 0
+		}
+	}
+	if start >= 0 {
+		spans = append(spans, [2]int{start, end + 1})
+	}
+	return spans
+}
+
+// sentenceSpans returns where the sentences of text are, without their
+// leading and trailing space. A sentence ends at a full stop, question or
+// exclamation mark, and the quotes and brackets closing after it, that is
+// followed by space and then by anything but a lower-case letter, unless
+// the stop ends an abbreviation such as "Dr." or "e.g." or an initial; at
+// the Chinese and Japanese stops, which need no space after them; and at
+// the end of a paragraph. A stop at the end of text is left undecided, as
+// more may follow; the end of text ends the last sentence.
+func sentenceSpans(text []rune) [][2]int {
+	var spans [][2]int
+	start := -1
+	add := func(end int) {
+		for end > start && unicode.IsSpace(text[end-1]) {
+			end--
+		}
+		if start >= 0 && end > start {
+			spans = append(spans, [2]int{start, end})
+		}
+		start = -1
+	}
+	for _, p := range paragraphSpans(text) {
+		start = -1
+		for i := p[0]; i < p[1]; i++ {
+			r := text[i]
+			if start < 0 {
+				if unicode.IsSpace(r) {
+					continue
+				}
+				start = i
+			}
+			if !strings.ContainsRune(".!?…。！？", r) {
+				continue
+			}
+			j := i + 1
+			for j < p[1] && strings.ContainsRune(".!?…。！？\"')]}»”’", text[j]) {
+				j++
+			}
+			if strings.ContainsRune("。！？", r) {
+				add(j)
+				i = j - 1
+				continue
+			}
+			if j == p[1] || !unicode.IsSpace(text[j]) {
+				// "3.5", a URL, or the paragraph's end, which ends it anyway.
+				i = j - 1
+				continue
+			}
+			k := j
+			for k < p[1] && unicode.IsSpace(text[k]) {
+				k++
+			}
+			if k == p[1] || unicode.IsLower(text[k]) || r == '.' && abbreviation(text[start:i]) {
+				i = j - 1
+				continue
+			}
+			add(j)
+			i = j - 1
+		}
+		if start >= 0 {
+			add(p[1])
+		}
+	}
+	return spans
+}
+
+// abbreviation reports whether the word at the end of text, before a
+// period, is an abbreviation or an initial.
+func abbreviation(text []rune) bool {
+	i := len(text)
+	for i > 0 && !unicode.IsSpace(text[i-1]) && !strings.ContainsRune("(\"'“‘", text[i-1]) {
+		i--
+	}
+	word := []rune(strings.ToLower(string(text[i:])))
+	if len(word) == 1 && unicode.IsLetter(word[0]) {
+		return true
+	}
+	return sentenceAbbreviations[string(word)]
+}
@@ -0,0 +1,51 @@
+package pdfripper
+
+import "strings"
+
+// similarityMaxCells bounds the table TextSimilarity builds to align two
+// texts word by word; larger pairs are compared by word counts instead.
+const similarityMaxCells = 25_000_000
+
+// TextSimilarity returns how alike two texts are, from 0 for no words in
+// common to 1 for the same words in the same order: twice the length of
+// their longest common subsequence of words over the number of words in
+// both, so whitespace and line breaks do not count. Two texts of tens of
+// thousands of words each are compared by how many of each word they
+// share instead, without regard to order. Two empty texts are alike.
+func TextSimilarity(a, b string) float64 {
+	wa, wb := strings.Fields(a), strings.Fields(b)
+	total := len(wa) + len(wb)
+	if total == 0 {
+		return 1
+	}
+	if len(wa)*len(wb) > similarityMaxCells {
+		counts := map[string]int{}
+		for _, w := range wa {
+			counts[w]++
+		}
+		shared := 0
+		for _, w := range wb {
+			if counts[w] > 0 {
+				counts[w]--
+				shared++
+			}
+		}
+		return 2 * float64(shared) / float64(total)
+	}
+	// Two rows of the table of common subsequence lengths.
+	prev, cur := make([]int, len(wb)+1), make([]int, len(wb)+1)
+	for i := range wa {
+		for j := range wb {
+			switch {
+			case wa[i] == wb[j]:
+				cur[j+1] = prev[j] + 1
+			case prev[j+1] >= cur[j]:
+				cur[j+1] = prev[j+1]
+			default:
+				cur[j+1] = cur[j]
+			}
+		}
+		prev, cur = cur, prev
+	}
+	return 2 * float64(prev[len(wb)]) / float64(total)
+}
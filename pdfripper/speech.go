@@ -0,0 +1,274 @@
+package pdfripper
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// pageNumberRe matches a line holding nothing but a page number, such as
+// "12", "- 12 -", "Page 3", "iv" or "3 of 10".
+var pageNumberRe = regexp.MustCompile(`(?i)^[\s\-–—(\[]*(?:page\s+)?(\d+|[ivxlc]+)(?:\s*(?:of|/)\s*\d+)?[\s\-–—)\]]*$`)
+
+// romanRe matches the roman numerals up to 89 that front matter is
+// numbered with, so that words like "civil" are not taken for numbers.
+var romanRe = regexp.MustCompile(`(?i)^l?x{0,3}(?:ix|iv|v?i{0,3})$`)
+
+func isPageNumber(line string) bool {
+	m := pageNumberRe.FindStringSubmatch(line)
+	return m != nil && (m[1][0] >= '0' && m[1][0] <= '9' || romanRe.MatchString(m[1]))
+}
+
+// tableGapRe separates the cells of a table row laid out with runs of
+// spaces or tabs.
+var tableGapRe = regexp.MustCompile(`\t+| {2,}`)
+
+// leaderRe matches dot leaders, as in a table of contents.
+var leaderRe = regexp.MustCompile(`(?:\s*[.·•_]){4,}\s*`)
+
+// speechReplacer normalizes punctuation and strips characters that speech
+// engines read out or stumble over.
+var speechReplacer = strings.NewReplacer(
+	"\u201c", `"`, "\u201d", `"`, "\u201e", `"`, "\u00ab", `"`, "\u00bb", `"`,
+	"\u2018", "'", "\u2019", "'", "\u201a", "'",
+	"\u2013", " - ", "\u2014", " - ", "\u2015", " - ", "\u2212", "-",
+	"\u2026", "...",
+	"\ufb00", "ff", "\ufb01", "fi", "\ufb02", "fl", "\ufb03", "ffi", "\ufb04", "ffl", "\ufb05", "st", "\ufb06", "st",
+	"\u00a0", " ", "\u2009", " ", "\u202f", " ",
+	"\u00ad", "", "\u200b", "", "\u200c", "", "\u200d", "", "\ufeff", "",
+	"\u2022", "", "\u25aa", "", "\u25e6", "", "\u25cf", "", "\u25a0", "", "\uf0b7", "",
+)
+
+// speechLines is how many lines at the top and bottom of a page are
+// checked for page numbers and running headers and footers.
+const speechLines = 2
+
+// SpeechText rewrites a page's text for screen readers and text-to-speech:
+// page numbers at the top and bottom of the page are dropped (as are the
+// lines in running, normalized with runningKey), words hyphenated across
+// lines are rejoined, lines are reflowed into paragraphs, runs of cells
+// separated by wide gaps are read out as tables, and punctuation is
+// normalized. The result has one paragraph per line.
+func SpeechText(text string, running map[string]bool) string {
+	lines := strings.Split(text, "\n")
+	lines = dropMargins(lines, running)
+
+	var paras []string
+	var para []string
+	endPara := func() {
+		if len(para) > 0 {
+			paras = append(paras, joinLines(para))
+			para = para[:0]
+		}
+	}
+	for i := 0; i < len(lines); i++ {
+		if rows := tableRows(lines[i:]); len(rows) >= 2 {
+			endPara()
+			paras = append(paras, speakTable(rows))
+			i += len(rows) - 1
+			continue
+		}
+		line := strings.TrimSpace(lines[i])
+		if line == "" {
+			endPara()
+			continue
+		}
+		para = append(para, line)
+		if len(para) == 1 && isHeading(line, lines[i+1:]) {
+			endPara()
+		}
+	}
+	endPara()
+
+	var b strings.Builder
+	for _, p := range paras {
+		p = leaderRe.ReplaceAllString(speechReplacer.Replace(p), " ")
+		p = strings.Join(strings.Fields(p), " ")
+		if p == "" {
+			continue
+		}
+		b.WriteString(p)
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+// StripHeaders removes the page numbers at the top and bottom of a page's
+// text, and the lines in running, normalized with runningKey, there, as
+// SpeechText does, and leaves the rest of the text as it is.
+func StripHeaders(text string, running map[string]bool) string {
+	lines := strings.Split(text, "\n")
+	kept := dropMargins(lines, running)
+	if len(kept) == len(lines) {
+		return text
+	}
+	return strings.Join(kept, "\n")
+}
+
+// dropMargins removes page numbers and running lines from the first and
+// last few non-empty lines.
+func dropMargins(lines []string, running map[string]bool) []string {
+	var nonEmpty []int
+	for i, l := range lines {
+		if strings.TrimSpace(l) != "" {
+			nonEmpty = append(nonEmpty, i)
+		}
+	}
+	drop := map[int]bool{}
+	for k, i := range nonEmpty {
+		if k >= speechLines && k < len(nonEmpty)-speechLines {
+			continue
+		}
+		if isPageNumber(lines[i]) || running[runningKey(lines[i])] {
+			drop[i] = true
+		}
+	}
+	if len(drop) == 0 {
+		return lines
+	}
+	kept := make([]string, 0, len(lines)-len(drop))
+	for i, l := range lines {
+		if !drop[i] {
+			kept = append(kept, l)
+		}
+	}
+	return kept
+}
+
+// joinLines reflows the lines of a paragraph into one, rejoining words
+// hyphenated at a line break. A single short line without closing
+// punctuation is taken for a heading and given a full stop, so that it is
+// read with a pause.
+func joinLines(lines []string) string {
+	var b strings.Builder
+	for i, l := range lines {
+		if i > 0 {
+			prev := b.String()
+			next, _ := utf8.DecodeRuneInString(l)
+			if strings.HasSuffix(prev, "-") && len(prev) > 1 && unicode.IsLetter(lastRune(prev[:len(prev)-1])) && unicode.IsLower(next) {
+				b.Reset()
+				b.WriteString(prev[:len(prev)-1])
+			} else {
+				b.WriteByte(' ')
+			}
+		}
+		b.WriteString(l)
+	}
+	s := b.String()
+	if len(lines) == 1 && utf8.RuneCountInString(s) < 80 && !strings.ContainsRune(".!?:;,\"')", lastRune(s)) {
+		s += "."
+	}
+	return s
+}
+
+// isHeading reports whether line, starting a paragraph, stands on its own
+// as a heading: it is short, has no closing punctuation, and the next line
+// starts with a capital letter.
+func isHeading(line string, rest []string) bool {
+	if len(rest) == 0 || utf8.RuneCountInString(line) >= 60 || strings.ContainsRune(".!?:;,-", lastRune(line)) {
+		return false
+	}
+	next, _ := utf8.DecodeRuneInString(strings.TrimSpace(rest[0]))
+	return unicode.IsUpper(next)
+}
+
+func lastRune(s string) rune {
+	r, _ := utf8.DecodeLastRuneInString(s)
+	return r
+}
+
+// tableRows returns the cells of the table rows at the start of lines: at
+// least two consecutive lines that each split into the same number (two
+// or more) of cells at wide gaps.
+func tableRows(lines []string) [][]string {
+	var rows [][]string
+	for _, l := range lines {
+		cells := tableGapRe.Split(strings.TrimSpace(l), -1)
+		if len(cells) < 2 || len(rows) > 0 && len(cells) != len(rows[0]) {
+			break
+		}
+		rows = append(rows, cells)
+	}
+	return rows
+}
+
+// speakTable linearizes a table whose first row holds the column headers,
+// announcing each row and naming every cell by its column.
+func speakTable(rows [][]string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Table with %d columns and %d rows.", len(rows[0]), len(rows)-1)
+	for i, row := range rows[1:] {
+		fmt.Fprintf(&b, " Row %d:", i+1)
+		for j, cell := range row {
+			sep := ";"
+			if j == len(row)-1 {
+				sep = "."
+			}
+			fmt.Fprintf(&b, " %s: %s%s", rows[0][j], cell, sep)
+		}
+	}
+	b.WriteString(" End of table.")
+	return b.String()
+}
+
+// runningKey normalizes a line for comparison across pages, ignoring case,
+// spacing and digits so that "Chapter 2 - page 14" matches on every page.
+func runningKey(line string) string {
+	f := strings.Fields(strings.Map(func(r rune) rune {
+		if unicode.IsDigit(r) {
+			return -1
+		}
+		return unicode.ToLower(r)
+	}, line))
+	return strings.Join(f, " ")
+}
+
+// runningLines finds running headers and footers: lines among the first
+// and last few of a page that recur on at least half of the pages (and at
+// least three), after normalize has been applied to the page's text so
+// that they compare equal to the extracted lines. Pages that cannot be
+// parsed are skipped.
+func (d *pdfDoc) runningLines(normalize func(string) string) map[string]bool {
+	counts := map[string]int{}
+	for i := range d.pages {
+		text, err := d.safePageText(i)
+		if err != nil {
+			continue
+		}
+		var lines []string
+		for _, l := range strings.Split(normalize(text), "\n") {
+			if strings.TrimSpace(l) != "" {
+				lines = append(lines, l)
+			}
+		}
+		seen := map[string]bool{}
+		for k, l := range lines {
+			if k >= speechLines && k < len(lines)-speechLines {
+				continue
+			}
+			if key := runningKey(l); key != "" && !seen[key] {
+				seen[key] = true
+				counts[key]++
+			}
+		}
+	}
+	running := map[string]bool{}
+	for key, n := range counts {
+		if n >= max(3, (len(d.pages)+1)/2) {
+			running[key] = true
+		}
+	}
+	return running
+}
+
+// safePageText is pageText with malformed content reported as an error.
+func (d *pdfDoc) safePageText(index int) (text string, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("parsing page %d: %v", index+1, r)
+		}
+	}()
+	return d.pageText(index, VerticalAuto)
+}
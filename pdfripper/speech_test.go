@@ -0,0 +1,49 @@
+package pdfripper
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/thnkr-one/pdfripper/pdfripper/paptest"
+)
+
+func TestStripHeaders(t *testing.T) {
+	running := map[string]bool{runningKey("ACME Corp  Annual Report 2024"): true}
+	for _, tt := range []struct {
+		name, text, want string
+	}{
+		{"running lines and page numbers",
+			"ACME Corp  Annual Report 2024\n\nFirst   column  kept as is\nhyphen-\nated\n\n- 12 -\n",
+			"\nFirst   column  kept as is\nhyphen-\nated\n\n"},
+		{"page number at the top", "Page 3\nBody\nMore", "Body\nMore"},
+		// Only the first and last few lines are margins.
+		{"in the body", "One\nTwo\n7\nACME Corp Annual Report 2019\nThree\nFour", "One\nTwo\n7\nACME Corp Annual Report 2019\nThree\nFour"},
+		{"nothing to strip", "Just text\n", "Just text\n"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := StripHeaders(tt.text, running); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExtractStripHeaders(t *testing.T) {
+	fruit := []string{"apples", "pears", "plums", "figs"}
+	var pages []string
+	for i, f := range fruit {
+		pages = append(pages, fmt.Sprintf("Quarterly Report\nAll about %s\nPage %d of 4", f, i+1))
+	}
+	path := paptest.TempPDF(t, pages...)
+	native, _ := LookupBackend("native")
+	results, err := Extract(context.Background(), path, WithBackend(native), WithOutputDir(t.TempDir()), func(e *Extractor) { e.StripHeaders = true })
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, r := range results {
+		if want := "All about " + fruit[i] + "\n"; r.Text != want {
+			t.Errorf("page %d: got %q, want %q", i+1, r.Text, want)
+		}
+	}
+}
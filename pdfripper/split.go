@@ -0,0 +1,113 @@
+package pdfripper
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Boundary is a Splitter's verdict on a page.
+type Boundary int
+
+const (
+	NoBoundary     Boundary = iota // The page continues the current document.
+	StartsDocument                 // The page is the first page of a new document.
+	SeparatorPage                  // The page separates documents and belongs to neither.
+)
+
+// Splitter finds the boundaries between logical documents in one PDF, such
+// as a stack of letters scanned in one go. It sees pages in order, after
+// post-processing.
+type Splitter func(r *PageResult) Boundary
+
+// SplitOnBlankPages treats pages without any text as separator sheets. A
+// scanned page has no text until it has been OCRed, so scans need OCR set.
+func SplitOnBlankPages(r *PageResult) Boundary {
+	if strings.TrimSpace(r.Text) == "" {
+		return SeparatorPage
+	}
+	return NoBoundary
+}
+
+var pageOfRe = regexp.MustCompile(`(?i)\bpage\s+(\d+)\s*(?:of|/)\s*\d+\b|(?m)^\s*(\d+)\s+of\s+\d+\s*$`)
+
+// SplitOnPageNumberReset starts a new document at every page numbered
+// "Page 1 of N" (or "1 of N" on a line of its own).
+func SplitOnPageNumberReset(r *PageResult) Boundary {
+	for _, m := range pageOfRe.FindAllStringSubmatch(r.Text, -1) {
+		if m[1] == "1" || m[2] == "1" {
+			return StartsDocument
+		}
+	}
+	return NoBoundary
+}
+
+// Splitters maps the names accepted by -split to the built-in splitters.
+var Splitters = map[string]Splitter{
+	"blank":        SplitOnBlankPages,
+	"page-numbers": SplitOnPageNumberReset,
+}
+
+// splitSink writes each logical document found by the splitters to its own
+// doc_NNN.txt in dir, pages separated by form feeds as in CombinedFile.
+// Pages must arrive in order.
+type splitSink struct {
+	dir       string
+	splitters []Splitter
+	docs      int
+	cur       *combinedSink
+	curPath   string
+	first     int
+	last      int
+}
+
+func (s *splitSink) WritePage(r *PageResult) error {
+	boundary := NoBoundary
+	for _, split := range s.splitters {
+		if b := split(r); b > boundary {
+			boundary = b
+		}
+	}
+	if boundary != NoBoundary {
+		if err := s.closeDocument(); err != nil {
+			return err
+		}
+		if boundary == SeparatorPage {
+			return nil
+		}
+	}
+	if s.cur == nil {
+		s.docs++
+		s.curPath = filepath.Join(s.dir, fmt.Sprintf("doc_%03d.txt", s.docs))
+		cur, err := newCombinedSink(s.curPath)
+		if err != nil {
+			return err
+		}
+		s.cur, s.first = cur, r.Page
+	}
+	s.last = r.Page
+	return s.cur.WritePage(r)
+}
+
+func (s *splitSink) closeDocument() error {
+	if s.cur == nil {
+		return nil
+	}
+	err := s.cur.Close()
+	s.cur = nil
+	if err != nil {
+		return err
+	}
+	pages := "page " + strconv.Itoa(s.first)
+	if s.last != s.first {
+		pages = fmt.Sprintf("pages %d-%d", s.first, s.last)
+	}
+	fmt.Printf("Saved document %d (%s) to %s\n", s.docs, pages, s.curPath)
+	return nil
+}
+
+func (s *splitSink) Close() error {
+	return s.closeDocument()
+}
@@ -0,0 +1,330 @@
+package pdfripper
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Thresholds used by DetectSpreads.
+const (
+	spreadMinAspect  = 1.2   // Width over height, as displayed, a page needs to hold two pages side by side.
+	spreadMaxAspect  = 1.7   // Above this a page is more likely a slide or a wide table.
+	spreadMinChars   = 20    // Non-space characters each half needs for the page to be split on its text.
+	spreadMinGutter  = 0.02  // Width of the gap between the halves, as a fraction of the page width.
+	spreadScanDPI    = 36    // Resolution pages without text are rendered at to look for the gutter.
+	spreadLightInk   = 0.002 // Share of a pixel column's pixels that may be dark in a blank gutter.
+	spreadShadowInk  = 0.6   // Share from which a column is the shadow of a book's binding.
+	spreadMinHalfInk = 0.005 // Share of dark pixels each half of a scanned spread needs.
+)
+
+// spreadBins is how many columns pages are divided into when looking for
+// the gutter in their text.
+const spreadBins = 200
+
+// Spread is a physical page holding two logical pages side by side, as
+// scans of open books and 2-up printouts do.
+type Spread struct {
+	Page  int     // 1-indexed.
+	Split float64 // Where the pages meet, as a fraction of the displayed width from the left edge.
+}
+
+// DetectSpreads finds the pages holding two pages side by side:
+// landscape pages whose text, or, for pages without text and if renderer
+// is not nil, whose rendered image has a gutter near the middle with
+// content on either side. The gutter of a scan may be blank or the dark
+// shadow of the binding. Pages whose content cannot be parsed are
+// skipped.
+func DetectSpreads(pdfFile string, renderer Renderer) ([]Spread, error) {
+	d, err := openPDFFile(pdfFile)
+	if err != nil {
+		return nil, err
+	}
+	var spreads []Spread
+	for i, p := range d.pages {
+		w, h := displayedSize(p)
+		if h <= 0 || w/h < spreadMinAspect || w/h > spreadMaxAspect {
+			continue
+		}
+		frags, err := d.pageFragments(i)
+		if err != nil {
+			continue
+		}
+		split, ok, hasText := textGutter(p, frags)
+		if !hasText && renderer != nil {
+			img, err := renderer.RenderPage(pdfFile, i+1, spreadScanDPI)
+			if err != nil {
+				return nil, fmt.Errorf("rendering page %d: %w", i+1, err)
+			}
+			split, ok = imageGutter(img)
+		}
+		if ok {
+			spreads = append(spreads, Spread{Page: i + 1, Split: split})
+		}
+	}
+	return spreads, nil
+}
+
+// displayedSize returns the size of a page as a viewer shows it, turned
+// by its /Rotate.
+func displayedSize(p pdfPage) (w, h float64) {
+	w, h = p.mediaBox[2]-p.mediaBox[0], p.mediaBox[3]-p.mediaBox[1]
+	if p.rotate%180 != 0 {
+		w, h = h, w
+	}
+	return w, h
+}
+
+// displayedX returns where a point of page p falls across the page as
+// displayed, as a fraction of its width from the left edge.
+func displayedX(p pdfPage, x, y float64) float64 {
+	box := p.mediaBox
+	switch ((p.rotate % 360) + 360) % 360 {
+	case 90:
+		return (y - box[1]) / (box[3] - box[1])
+	case 180:
+		return (box[2] - x) / (box[2] - box[0])
+	case 270:
+		return (box[3] - y) / (box[3] - box[1])
+	}
+	return (x - box[0]) / (box[2] - box[0])
+}
+
+// textGutter looks for a gap in the visible text of a page near its
+// middle, with enough text on either side. hasText reports whether the
+// page had text to look at.
+func textGutter(p pdfPage, frags []textFragment) (split float64, ok, hasText bool) {
+	type span struct {
+		a, b  float64
+		chars int
+	}
+	var spans []span
+	var used [spreadBins]bool
+	for _, f := range frags {
+		n := 0
+		for _, r := range f.text {
+			if !unicode.IsSpace(r) {
+				n++
+			}
+		}
+		if n == 0 || f.invisible {
+			continue
+		}
+		a, b := displayedX(p, f.x0, f.y0), displayedX(p, f.x1, f.y1)
+		if a > b {
+			a, b = b, a
+		}
+		for i := int(math.Max(a*spreadBins, 0)); i < spreadBins && float64(i) < b*spreadBins; i++ {
+			used[i] = true
+		}
+		spans = append(spans, span{a, b, n})
+	}
+	if len(spans) == 0 {
+		return 0, false, false
+	}
+	if split, ok = widestGap(func(i int) bool { return !used[i] }, spreadBins); !ok {
+		return 0, false, true
+	}
+	left, right := 0, 0
+	for _, s := range spans {
+		if s.b <= split {
+			left += s.chars
+		} else {
+			right += s.chars
+		}
+	}
+	return split, left >= spreadMinChars && right >= spreadMinChars, true
+}
+
+// imageGutter looks for a blank or shadowed band of pixel columns near
+// the middle of a rendered page, with ink on either side.
+func imageGutter(img image.Image) (split float64, ok bool) {
+	b := img.Bounds()
+	if b.Dx() < 2 || b.Dy() == 0 {
+		return 0, false
+	}
+	ink := make([]float64, b.Dx())
+	for x := b.Min.X; x < b.Max.X; x++ {
+		dark := 0
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			if color.GrayModel.Convert(img.At(x, y)).(color.Gray).Y < 128 {
+				dark++
+			}
+		}
+		ink[x-b.Min.X] = float64(dark) / float64(b.Dy())
+	}
+	gutter := func(i int) bool { return ink[i] <= spreadLightInk || ink[i] >= spreadShadowInk }
+	if split, ok = widestGap(gutter, len(ink)); !ok {
+		return 0, false
+	}
+	// The halves are judged without the gutter and the page edges, which
+	// are dark in many scans.
+	for _, half := range [][2]float64{{0.05, split - spreadMinGutter}, {split + spreadMinGutter, 0.95}} {
+		from, to := int(half[0]*float64(len(ink))), int(half[1]*float64(len(ink)))
+		sum := 0.0
+		for i := from; i < to; i++ {
+			if ink[i] < spreadShadowInk {
+				sum += ink[i]
+			}
+		}
+		if to <= from || sum/float64(to-from) < spreadMinHalfInk {
+			return 0, false
+		}
+	}
+	return split, true
+}
+
+// widestGap finds the widest run of the n columns for which gap is true
+// that lies within the middle fifth of the page and is at least
+// spreadMinGutter wide, and returns its centre as a fraction of the width.
+func widestGap(gap func(i int) bool, n int) (float64, bool) {
+	from, to := int(0.4*float64(n)), int(math.Ceil(0.6*float64(n)))
+	best, bestStart := 0, 0
+	for i := from; i < to; {
+		if !gap(i) {
+			i++
+			continue
+		}
+		start := i
+		for i < to && gap(i) {
+			i++
+		}
+		// A gap reaching the edge of the middle fifth may go on outside it.
+		end := i
+		for end < n && gap(end) {
+			end++
+		}
+		for start > 0 && gap(start-1) {
+			start--
+		}
+		if end-start > best {
+			best, bestStart = end-start, start
+		}
+	}
+	if float64(best) < spreadMinGutter*float64(n) {
+		return 0, false
+	}
+	return (float64(bestStart) + float64(best)/2) / float64(n), true
+}
+
+// SplitSpreads writes inFile to outFile with each of the spreads cut into
+// its two pages, left first, and the other pages kept as they are. With
+// booklet set, the input is taken to be the sheets of a booklet, folded and
+// stapled in the middle: every page is cut, at the spread's split if it is
+// one and in the middle otherwise, and the pages are put in reading order.
+// The first sheet holds the last page and the first, its back the second
+// and the second to last, and so on.
+func SplitSpreads(inFile, outFile string, spreads []Spread, booklet bool) error {
+	d, err := openPDFFile(inFile)
+	if err != nil {
+		return err
+	}
+	splits := map[int]float64{}
+	for _, s := range spreads {
+		if s.Page < 1 || s.Page > len(d.pages) {
+			return fmt.Errorf("page %d is out of range for a %d-page document", s.Page, len(d.pages))
+		}
+		if s.Split <= 0 || s.Split >= 1 {
+			return fmt.Errorf("page %d: split %g is not between 0 and 1", s.Page, s.Split)
+		}
+		splits[s.Page] = s.Split
+	}
+	if booklet {
+		for i := range d.pages {
+			if _, ok := splits[i+1]; !ok {
+				splits[i+1] = 0.5
+			}
+		}
+	}
+	if len(splits) == 0 {
+		return errors.New("no pages to split")
+	}
+
+	var pages []pdfPage
+	for i, p := range d.pages {
+		split, ok := splits[i+1]
+		if !ok {
+			pages = append(pages, p)
+			continue
+		}
+		left, right := splitBoxes(p, split)
+		pages = append(pages, withBox(p, left), withBox(p, right))
+	}
+	if booklet {
+		pages = bookletOrder(pages)
+	}
+	rotate := make([]int, len(pages))
+	for i, p := range pages {
+		rotate[i] = p.rotate
+	}
+
+	w := &pdfWriter{}
+	catalog, tree := w.reserve(), w.reserve()
+	c := &pdfCopier{d: d, w: w, nums: map[int]int{}}
+	return w.writeFile(outFile, catalog, tree, c.copyPages(pdfRef{num: tree}, pages, rotate))
+}
+
+// splitBoxes cuts the MediaBox of p at split, a fraction of its displayed
+// width, into the boxes of its displayed left and right halves.
+func splitBoxes(p pdfPage, split float64) (left, right [4]float64) {
+	b := p.mediaBox
+	left, right = b, b
+	switch ((p.rotate % 360) + 360) % 360 {
+	case 90:
+		y := b[1] + split*(b[3]-b[1])
+		left[3], right[1] = y, y
+	case 180:
+		x := b[2] - split*(b[2]-b[0])
+		left[0], right[2] = x, x
+	case 270:
+		y := b[3] - split*(b[3]-b[1])
+		left[1], right[3] = y, y
+	default:
+		x := b[0] + split*(b[2]-b[0])
+		left[2], right[0] = x, x
+	}
+	return left, right
+}
+
+// withBox returns p cut down to box; the page's own boxes are dropped so
+// that copyPages writes box as its MediaBox.
+func withBox(p pdfPage, box [4]float64) pdfPage {
+	dict := pdfDict{}
+	for k, v := range p.dict {
+		if !strings.HasSuffix(string(k), "Box") {
+			dict[k] = v
+		}
+	}
+	p.dict, p.mediaBox = dict, box
+	return p
+}
+
+// bookletOrder puts the halves of booklet sheets, in scanning order, into
+// reading order. With n pages, even side k holds pages n-k and k+1, odd
+// side k pages k+1 and n-k, counting sides from 0.
+func bookletOrder(halves []pdfPage) []pdfPage {
+	n := len(halves)
+	number := make([]int, n)
+	for k := 0; k < n/2; k++ {
+		if k%2 == 0 {
+			number[2*k], number[2*k+1] = n-k, k+1
+		} else {
+			number[2*k], number[2*k+1] = k+1, n-k
+		}
+	}
+	order := make([]int, n)
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(i, j int) bool { return number[order[i]] < number[order[j]] })
+	out := make([]pdfPage, n)
+	for i, j := range order {
+		out[i] = halves[j]
+	}
+	return out
+}
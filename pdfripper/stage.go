@@ -0,0 +1,132 @@
+package pdfripper
+
+import (
+	"context"
+	"fmt"
+)
+
+// Stage is a custom step of the pipeline, such as sending each page to a
+// classifier, registered in Extractor.Stages. Stages run on every page
+// that has not failed or been dropped, after the PostProcessors and in
+// order, concurrently across pages like them, so they must be safe for
+// concurrent use. A page is reported in heartbeats as in the stage named
+// Name while Process runs.
+type Stage interface {
+	Name() string
+	// Process transforms r, or drops it by setting r.Dropped. An error
+	// fails the page. ctx is that of the run.
+	Process(ctx context.Context, r *PageResult) error
+}
+
+// StageFunc returns a Stage named name that runs fn.
+func StageFunc(name string, fn func(ctx context.Context, r *PageResult) error) Stage {
+	return &funcStage{name: name, fn: fn}
+}
+
+type funcStage struct {
+	name string
+	fn   func(ctx context.Context, r *PageResult) error
+}
+
+func (s *funcStage) Name() string { return s.name }
+
+func (s *funcStage) Process(ctx context.Context, r *PageResult) error { return s.fn(ctx, r) }
+
+// Document describes the document of a run, for Hooks.
+type Document struct {
+	File      string // Extractor.PDFFile.
+	OutputDir string // Extractor.OutputDir; nothing is written there by ExtractTo and Extract.
+	Pages     int    // The document's page count.
+	Backend   string // The name of the backend.
+}
+
+// Hook observes a run from start to end, registered in Extractor.Hooks.
+// Its methods are called from a single goroutine, in the order hooks are
+// registered.
+type Hook interface {
+	// BeforeDocument is called once the input has been checked, before
+	// any page is extracted. An error stops the run before it starts.
+	BeforeDocument(ctx context.Context, doc Document) error
+	// AfterPage is called with every page once it is saved, dropped or
+	// has failed, as PageDone is.
+	AfterPage(r *PageResult)
+	// AfterDocument is called when the run ends, with the error it ends
+	// with, if any, for every hook whose BeforeDocument was called. The
+	// first error it returns is that of the run if the run otherwise
+	// succeeded.
+	AfterDocument(doc Document, err error) error
+}
+
+// HookFuncs is a Hook whose methods call the funcs that are set, for
+// hooks that only need some of them.
+type HookFuncs struct {
+	Before func(ctx context.Context, doc Document) error
+	Page   func(r *PageResult)
+	After  func(doc Document, err error) error
+}
+
+func (h HookFuncs) BeforeDocument(ctx context.Context, doc Document) error {
+	if h.Before == nil {
+		return nil
+	}
+	return h.Before(ctx, doc)
+}
+
+func (h HookFuncs) AfterPage(r *PageResult) {
+	if h.Page != nil {
+		h.Page(r)
+	}
+}
+
+func (h HookFuncs) AfterDocument(doc Document, err error) error {
+	if h.After == nil {
+		return nil
+	}
+	return h.After(doc, err)
+}
+
+// runHooked runs the pipeline between the BeforeDocument and
+// AfterDocument calls of the Hooks.
+func (e *Extractor) runHooked(ctx context.Context, totalPages int, sink Sink, ordered bool) error {
+	doc := Document{File: e.PDFFile, OutputDir: e.OutputDir, Pages: totalPages, Backend: e.Backend.Name()}
+	started := 0
+	var err error
+	for _, h := range e.Hooks {
+		started++
+		if err = h.BeforeDocument(ctx, doc); err != nil {
+			err = fmt.Errorf("before document: %w", err)
+			sink.Close()
+			break
+		}
+	}
+	if err == nil {
+		err = e.runPipeline(ctx, totalPages, sink, ordered)
+	}
+	if err == nil {
+		e.reportAgreement()
+	}
+	var hookErr error
+	for _, h := range e.Hooks[:started] {
+		if herr := h.AfterDocument(doc, err); herr != nil && hookErr == nil {
+			hookErr = fmt.Errorf("after document: %w", herr)
+		}
+	}
+	if err == nil {
+		err = hookErr
+	}
+	return err
+}
+
+// runStages runs the Stages on r, stopping at the first that fails or
+// drops the page.
+func (e *Extractor) runStages(ctx context.Context, tracker *pageTracker, r *PageResult) {
+	for _, s := range e.Stages {
+		if r.Err != nil || r.Dropped {
+			return
+		}
+		tracker.enter(r.Page, s.Name())
+		if err := s.Process(ctx, r); err != nil {
+			r.Err = fmt.Errorf("stage %s on page %d: %w", s.Name(), r.Page, err)
+		}
+	}
+}
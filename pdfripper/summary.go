@@ -0,0 +1,233 @@
+package pdfripper
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"unicode"
+)
+
+// SummaryFile is the file in OutputDir that Summarize writes the
+// document's summary to.
+const SummaryFile = "summary.md"
+
+// DefaultSummaryChars is the most text a Summarizer sends at once when
+// MaxChars is not set, about 25,000 tokens of English.
+const DefaultSummaryChars = 100000
+
+// DefaultSummaryPrompt is the instructions a Summarizer gives when Prompt
+// is not set.
+const DefaultSummaryPrompt = "Write an abstract of the document you are given, in Markdown: a paragraph summarizing it, " +
+	"then its key points as a bulleted list. Use only what the document says."
+
+// Summarizer writes an abstract of every document to SummaryFile, set as
+// Extractor.Summarize, with a language model. The text is sent in page
+// order; a document longer than MaxChars is summarized in parts, as it is
+// extracted, and the abstract written from the parts' summaries, so that
+// it is never held in memory whole.
+type Summarizer struct {
+	Model    LanguageModel
+	Prompt   string // Instructions, sent as the system message (default: DefaultSummaryPrompt).
+	MaxChars int    // Text sent at once at most (default: DefaultSummaryChars).
+}
+
+// LanguageModel answers a prompt: the system message's instructions and
+// the user's message.
+type LanguageModel interface {
+	Complete(ctx context.Context, system, user string) (string, error)
+}
+
+// ChatCompletions is a LanguageModel served by an OpenAI-compatible chat
+// completions endpoint, such as OpenAI's own, Ollama's or vLLM's
+// /v1/chat/completions: the prompt is POSTed as
+//
+//	{"model": "...", "messages": [{"role": "system", "content": "..."}, {"role": "user", "content": "..."}]}
+//
+// and the answer is the first choice's message. Network errors, 429 and
+// 5xx responses are retried, backing off from a second.
+type ChatCompletions struct {
+	URL     string       // Endpoint to POST prompts to.
+	Model   string       // Sent as "model", if set.
+	Token   string       // If set, sent as a bearer token.
+	Retries int          // Times a request is retried before the summary fails.
+	Client  *http.Client // Client to use (default: one with a two-minute timeout).
+}
+
+// chatMessage is a message of a chat completion.
+type chatMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+func (c *ChatCompletions) Complete(ctx context.Context, system, user string) (string, error) {
+	body, err := json.Marshal(struct {
+		Model    string        `json:"model,omitempty"`
+		Messages []chatMessage `json:"messages"`
+	}{c.Model, []chatMessage{{"system", system}, {"user", user}}})
+	if err != nil {
+		return "", err
+	}
+	header := http.Header{}
+	if c.Token != "" {
+		header.Set("Authorization", "Bearer "+c.Token)
+	}
+	var resp struct {
+		Choices []struct {
+			Message chatMessage `json:"message"`
+		} `json:"choices"`
+	}
+	if err := requestJSON(ctx, c.Client, c.Retries, http.MethodPost, c.URL, header, body, &resp); err != nil {
+		return "", err
+	}
+	if len(resp.Choices) == 0 || strings.TrimSpace(resp.Choices[0].Message.Content) == "" {
+		return "", fmt.Errorf("%s answered with no message", hostOf(c.URL))
+	}
+	return strings.TrimSpace(resp.Choices[0].Message.Content), nil
+}
+
+// summarySink gathers the text of the pages, in page order, summarizing
+// each part of it as it reaches maxChars, and writes the summary of the
+// whole when it is closed.
+type summarySink struct {
+	ctx      context.Context
+	s        *Summarizer
+	path     string
+	confine  []string // If set, the directories the summary must lie in (Extractor.ConfineTo).
+	maxChars int
+	buf      []rune
+	parts    []string // Summaries of the parts sent so far.
+}
+
+func newSummarySink(ctx context.Context, s *Summarizer, path string, confine []string) *summarySink {
+	maxChars := s.MaxChars
+	if maxChars <= 0 {
+		maxChars = DefaultSummaryChars
+	}
+	return &summarySink{ctx: ctx, s: s, path: path, confine: confine, maxChars: maxChars}
+}
+
+func (s *summarySink) WritePage(r *PageResult) error {
+	text := []rune(strings.TrimSpace(r.Text))
+	if len(text) == 0 {
+		return nil
+	}
+	if len(s.buf) > 0 {
+		s.buf = append(s.buf, '\n', '\n')
+	}
+	s.buf = append(s.buf, text...)
+	for len(s.buf) > s.maxChars {
+		end := summaryCut(s.buf, s.maxChars)
+		if err := s.summarizePart(string(s.buf[:end])); err != nil {
+			return err
+		}
+		s.buf = append(s.buf[:0], s.buf[end:]...)
+	}
+	return nil
+}
+
+// summaryCut returns where to end a part of at most n characters of text:
+// at a paragraph break or, failing that, a space in its second half, if
+// there is one.
+func summaryCut(text []rune, n int) int {
+	for _, brk := range []func(i int) bool{
+		func(i int) bool { return text[i] == '\n' && text[i-1] == '\n' },
+		func(i int) bool { return unicode.IsSpace(text[i]) },
+	} {
+		for i := n; i > n/2; i-- {
+			if brk(i) {
+				return i
+			}
+		}
+	}
+	return n
+}
+
+// summarizePart summarizes the next part of the document.
+func (s *summarySink) summarizePart(text string) error {
+	summary, err := s.complete(fmt.Sprintf("Part %d of the document:\n\n%s", len(s.parts)+1, text))
+	if err != nil {
+		return fmt.Errorf("summarizing part %d: %w", len(s.parts)+1, err)
+	}
+	s.parts = append(s.parts, summary)
+	return nil
+}
+
+func (s *summarySink) complete(user string) (string, error) {
+	prompt := s.s.Prompt
+	if prompt == "" {
+		prompt = DefaultSummaryPrompt
+	}
+	return s.s.Model.Complete(s.ctx, prompt, user)
+}
+
+// Close summarizes the document: its text, if it all fits in one part,
+// or else the summaries of its parts, combined in groups that fit until
+// one is left.
+func (s *summarySink) Close() error {
+	var summary string
+	switch {
+	case len(s.parts) == 0 && strings.TrimSpace(string(s.buf)) == "":
+		return nil // No text to summarize.
+	case len(s.parts) == 0:
+		var err error
+		if summary, err = s.complete(string(s.buf)); err != nil {
+			return fmt.Errorf("summarizing: %w", err)
+		}
+	default:
+		if strings.TrimSpace(string(s.buf)) != "" {
+			if err := s.summarizePart(string(s.buf)); err != nil {
+				return err
+			}
+		}
+		s.buf = nil
+		parts := s.parts
+		for {
+			groups := groupSummaries(parts, s.maxChars)
+			combined := make([]string, len(groups))
+			for i, g := range groups {
+				var err error
+				if combined[i], err = s.complete("Summaries of consecutive parts of one document, to be made into one abstract of it:\n\n" + g); err != nil {
+					return fmt.Errorf("combining summaries: %w", err)
+				}
+			}
+			if parts = combined; len(parts) == 1 {
+				break
+			}
+		}
+		summary = parts[0]
+	}
+	if len(s.confine) > 0 {
+		if err := Confined(s.path, s.confine...); err != nil {
+			return err
+		}
+	}
+	if err := os.WriteFile(s.path, []byte(summary+"\n"), 0644); err != nil {
+		return err
+	}
+	fmt.Printf("Saved the summary to %s\n", s.path)
+	return nil
+}
+
+// groupSummaries joins consecutive summaries, each headed by its part's
+// number, into groups of at most maxChars characters but of two summaries
+// at least, so that there are fewer groups than summaries.
+func groupSummaries(parts []string, maxChars int) []string {
+	var groups []string
+	var b strings.Builder
+	size, n := 0, 0 // Of the current group.
+	for i, p := range parts {
+		p = fmt.Sprintf("## Part %d\n\n%s\n\n", i+1, p)
+		if n >= 2 && size+len([]rune(p)) > maxChars {
+			groups = append(groups, b.String())
+			b.Reset()
+			size, n = 0, 0
+		}
+		b.WriteString(p)
+		size += len([]rune(p))
+		n++
+	}
+	return append(groups, b.String())
+}
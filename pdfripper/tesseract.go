@@ -0,0 +1,77 @@
+//go:build !noexec && !js && !wasip1
+
+package pdfripper
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"strings"
+)
+
+// Tesseract runs the tesseract command-line OCR engine.
+type Tesseract struct {
+	Language    string  // Tesseract language codes, e.g. "eng" or "deu+eng" (default: tesseract's own).
+	TessdataDir string  // Directory of trained data, for installs tesseract can't find without TESSDATA_PREFIX.
+	Sandbox     Sandbox // Limits for each tesseract process.
+	Runner      Runner  // Runs tesseract (default: ExecRunner).
+}
+
+func (t *Tesseract) Name() string {
+	if t.Language == "" {
+		return "tesseract"
+	}
+	return "tesseract-" + t.Language
+}
+
+func (t *Tesseract) inWorkspace(dir string) any {
+	c := *t
+	c.Sandbox = c.Sandbox.withTempDir(dir)
+	return &c
+}
+
+func (t *Tesseract) withMeter(m *usageMeter) any {
+	c := *t
+	c.Sandbox.meter = m
+	return &c
+}
+
+// Recognize sends img to tesseract as a PNG on standard input.
+func (t *Tesseract) Recognize(img image.Image) (string, error) {
+	out, err := t.run(img)
+	if err != nil {
+		return "", err
+	}
+	// tesseract ends each page with a form feed.
+	return strings.TrimRight(string(out), "\f"), nil
+}
+
+// RecognizeLayout has tesseract write hOCR or ALTO, using its config file
+// of the same name, and derives the text from that.
+func (t *Tesseract) RecognizeLayout(img image.Image, format string) (string, []byte, error) {
+	layout, err := t.run(img, format)
+	if err != nil {
+		return "", nil, err
+	}
+	text, err := layoutText(format, layout)
+	if err != nil {
+		return "", nil, err
+	}
+	return text, layout, nil
+}
+
+// run runs tesseract on img with the given config files.
+func (t *Tesseract) run(img image.Image, configs ...string) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	args := []string{"stdin", "stdout"}
+	if t.Language != "" {
+		args = append(args, "-l", t.Language)
+	}
+	if t.TessdataDir != "" {
+		args = append(args, "--tessdata-dir", t.TessdataDir)
+	}
+	return runWith(t.Runner, t.Sandbox, buf.Bytes(), "tesseract", append(args, configs...)...)
+}
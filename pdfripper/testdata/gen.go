@@ -0,0 +1,65 @@
+//go:build ignore
+
+// Gen writes the synthetic fixture PDFs into a directory, for trying the
+// command-line tool or other integrations that need files on disk:
+//
+//	go run ./pdfripper/testdata/gen.go -out pdfripper/testdata
+//
+// The fixtures are generated rather than checked in; see package paptest.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/thnkr-one/pdfripper/pdfripper/paptest"
+)
+
+var fixtures = map[string]*paptest.Document{
+	// Three pages of plain text.
+	"simple.pdf": {Title: "Simple", Pages: paptest.TextPages(
+		"Hello, world!\nSecond line",
+		"Page two",
+		"Café – “quoted” (parens) \\backslash",
+	)},
+	// A single page with nothing on it.
+	"blank.pdf": {Pages: []paptest.Page{{}}},
+	// Every orientation, for the page geometry options.
+	"orientation.pdf": {Pages: []paptest.Page{
+		{Lines: []string{"Portrait letter"}},
+		{Lines: []string{"Landscape letter"}, Size: [2]float64{792, 612}},
+		{Lines: []string{"Portrait A4 rotated to landscape"}, Size: paptest.A4, Rotate: 90},
+		{Lines: []string{"Square"}, Size: [2]float64{500, 500}},
+	}},
+	// Page numbers and a running header, for splitting and speech output.
+	"numbered.pdf": {Pages: paptest.TextPages(
+		"Annual Report\n\nIntroduction\n\n1",
+		"Annual Report\n\nResults in detail\n\n2",
+		"Annual Report\n\nOutlook\n\n3",
+	)},
+}
+
+func main() {
+	out := flag.String("out", ".", "Directory to write the fixtures to")
+	flag.Parse()
+
+	if err := os.MkdirAll(*out, 0755); err != nil {
+		log.Fatal(err)
+	}
+	var names []string
+	for name := range fixtures {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := fixtures[name].WriteFile(filepath.Join(*out, name)); err != nil {
+			log.Fatal(err)
+		}
+	}
+	fmt.Printf("Wrote %s to %s\n", strings.Join(names, ", "), *out)
+}
@@ -0,0 +1,193 @@
+package pdfripper
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// TOCFile is the file in OutputDir that TOC writes the table of contents
+// to.
+const TOCFile = "toc.json"
+
+// Sources of a TableOfContents.
+const (
+	TOCOutline  = "outline"  // The document's bookmarks.
+	TOCHeadings = "headings" // Headings found by Headings.
+)
+
+// Thresholds of Headings.
+const (
+	headingScale    = 1.15 // A heading's font is at least this much larger than the body text's.
+	headingMaxWords = 15
+	headingLevels   = 3 // Smaller fonts than the third largest are at its level.
+	headingMaxPages = 2 // More repeats of a line are taken for a running header.
+)
+
+// TableOfContents is what TOCFile holds.
+type TableOfContents struct {
+	Source  string        `json:"source"` // TOCOutline or TOCHeadings.
+	Entries []OutlineItem `json:"entries"`
+}
+
+// Headings finds the headings of a PDF by their font sizes, using the
+// package's own parser, for documents without an outline: lines of a few
+// words set larger than the body text, the largest at level 0. Lines that
+// recur on several pages, like running headers, are left out, and a
+// heading set over consecutive lines is one entry.
+func Headings(pdfFile string) ([]OutlineItem, error) {
+	d, err := openPDFFile(pdfFile)
+	if err != nil {
+		return nil, err
+	}
+	return d.headings(), nil
+}
+
+// sizedLine is a line of a page with the size of its largest font,
+// rounded to half a point.
+type sizedLine struct {
+	page int // 1-indexed.
+	text string
+	size float64
+}
+
+func (d *pdfDoc) headings() []OutlineItem {
+	var lines []sizedLine
+	chars := map[float64]int{} // By size.
+	pages := map[string]map[int]bool{}
+	for i := range d.pages {
+		for _, l := range d.sizedLines(i) {
+			lines = append(lines, l)
+			chars[l.size] += len([]rune(l.text))
+			if pages[l.text] == nil {
+				pages[l.text] = map[int]bool{}
+			}
+			pages[l.text][l.page] = true
+		}
+	}
+	body, most := 0.0, 0
+	for size, n := range chars {
+		if n > most || n == most && size < body {
+			body, most = size, n
+		}
+	}
+	// Consecutive heading lines of a size on a page are one heading.
+	var heads []sizedLine
+	last := -1
+	for i, l := range lines {
+		words := len(strings.Fields(l.text))
+		if l.size < body*headingScale || words > headingMaxWords || len(pages[l.text]) > headingMaxPages || !strings.ContainsFunc(l.text, unicode.IsLetter) {
+			continue
+		}
+		if h := len(heads) - 1; last == i-1 && h >= 0 && heads[h].page == l.page && heads[h].size == l.size {
+			heads[h].text += " " + l.text
+		} else {
+			heads = append(heads, l)
+		}
+		last = i
+	}
+	var sizes []float64
+	for _, h := range heads {
+		if !slices.Contains(sizes, h.size) {
+			sizes = append(sizes, h.size)
+		}
+	}
+	sort.Sort(sort.Reverse(sort.Float64Slice(sizes)))
+	items := make([]OutlineItem, len(heads))
+	for i, h := range heads {
+		level := sort.Search(len(sizes), func(k int) bool { return sizes[k] <= h.size })
+		items[i] = OutlineItem{Title: h.text, Level: min(level, headingLevels-1), Page: h.page}
+	}
+	return items
+}
+
+// sizedLines returns the visible lines of page index, or nil if the page
+// cannot be parsed.
+func (d *pdfDoc) sizedLines(index int) (lines []sizedLine) {
+	defer func() {
+		if r := recover(); r != nil {
+			lines = nil
+		}
+	}()
+	frags, err := d.pageFragments(index)
+	if err != nil {
+		return nil
+	}
+	for _, line := range visibleLines(frags) {
+		text := strings.Join(strings.Fields(layoutLines(line)), " ")
+		if text == "" {
+			continue
+		}
+		size := 0.0
+		for _, f := range line {
+			if strings.TrimSpace(f.text) != "" {
+				size = math.Max(size, f.size)
+			}
+		}
+		lines = append(lines, sizedLine{page: index + 1, text: text, size: math.Round(size*2) / 2})
+	}
+	return lines
+}
+
+// loadTOC sets the run's table of contents, if TOC is set: the outline,
+// or the headings if there is none.
+func (e *Extractor) loadTOC() {
+	e.toc = nil
+	if !e.TOC || e.doc == nil {
+		return
+	}
+	e.toc = &TableOfContents{Source: TOCOutline, Entries: e.doc.outline()}
+	if len(e.toc.Entries) == 0 {
+		e.toc = &TableOfContents{Source: TOCHeadings, Entries: e.doc.headings()}
+	}
+	if e.toc.Entries == nil {
+		e.toc.Entries = []OutlineItem{}
+	}
+}
+
+// writeTOC writes the run's table of contents to TOCFile in OutputDir.
+func (e *Extractor) writeTOC() error {
+	if e.toc == nil {
+		return nil
+	}
+	name := filepath.Join(e.OutputDir, TOCFile)
+	if len(e.ConfineTo) > 0 {
+		if err := Confined(name, e.ConfineTo...); err != nil {
+			return err
+		}
+	}
+	data, err := json.MarshalIndent(e.toc, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(name, append(data, '\n'), 0644); err != nil {
+		return err
+	}
+	fmt.Printf("Saved the table of contents, %d entries from the %s, to %s\n", len(e.toc.Entries), e.toc.Source, name)
+	return nil
+}
+
+// tocText returns the run's table of contents as it starts CombinedFile:
+// a page of its own, with an entry per line indented by its level and
+// followed by its page's label, or number.
+func (e *Extractor) tocText() string {
+	var b strings.Builder
+	b.WriteString("Contents\n\n")
+	for _, item := range e.toc.Entries {
+		page := ""
+		if item.Page > 0 {
+			if page = e.pageLabel(item.Page); page == "" {
+				page = strconv.Itoa(item.Page)
+			}
+		}
+		fmt.Fprintf(&b, "%s%s  %s\n", strings.Repeat("  ", item.Level), item.Title, page)
+	}
+	return b.String()
+}
@@ -0,0 +1,170 @@
+package pdfripper
+
+import (
+	"bufio"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Tokenizer counts the tokens a language model would read text as, to
+// budget for sending the output to one (see Extractor.Tokenizer).
+type Tokenizer interface {
+	CountTokens(text string) int
+}
+
+// TokenizerHeuristic is the tokenizer ParseTokenizer takes for
+// HeuristicTokenizer.
+const TokenizerHeuristic = "heuristic"
+
+// pretokens splits text into the pieces cl100k_base encodes separately:
+// contractions, words with the character before them, runs of up to three
+// digits, punctuation and runs of space. Go's regexp lacks the lookahead
+// with which cl100k_base leaves the last space of a run to the word after
+// it; pretokenize does that instead.
+var pretokens = regexp.MustCompile(`(?i:'s|'t|'re|'ve|'m|'ll|'d)|[^\r\n\p{L}\p{N}]?\p{L}+|\p{N}{1,3}| ?[^\s\p{Z}\p{L}\p{N}]+[\r\n]*|[\s\p{Z}]*[\r\n]+|[\s\p{Z}]+`)
+
+// pretokenize calls fn with each piece of text, as cl100k_base splits it.
+func pretokenize(text string, fn func(piece string)) {
+	for len(text) > 0 {
+		loc := pretokens.FindStringIndex(text)
+		if loc == nil {
+			fn(text)
+			return
+		}
+		if loc[0] > 0 {
+			fn(text[:loc[0]])
+		}
+		end := loc[1]
+		if piece := text[loc[0]:end]; end < len(text) && utf8.RuneCountInString(piece) > 1 && strings.TrimFunc(piece, unicode.IsSpace) == "" {
+			last, size := utf8.DecodeLastRuneInString(piece)
+			next, _ := utf8.DecodeRuneInString(text[end:])
+			if last != '\r' && last != '\n' && !unicode.IsSpace(next) {
+				end -= size
+			}
+		}
+		fn(text[loc[0]:end])
+		text = text[end:]
+	}
+}
+
+// HeuristicTokenizer estimates tokens without a vocabulary: text is split
+// as cl100k_base splits it, and each piece counts one token for every four
+// bytes or part of them, but runs of space count one. It is a rough
+// estimate, closest for English prose.
+type HeuristicTokenizer struct{}
+
+func (HeuristicTokenizer) CountTokens(text string) int {
+	n := 0
+	pretokenize(text, func(piece string) {
+		if strings.TrimFunc(piece, unicode.IsSpace) == "" {
+			n++
+		} else {
+			n += (len(piece) + 3) / 4
+		}
+	})
+	return n
+}
+
+// BPETokenizer counts tokens exactly as a tiktoken byte-pair encoding
+// does, with the pieces split as by cl100k_base, given the encoding's
+// ranks (see LoadBPE). Special tokens are not recognized.
+type BPETokenizer struct {
+	ranks map[string]int // Rank of each token, by its bytes.
+}
+
+// LoadBPE reads a byte-pair encoding in tiktoken's format, such as
+// cl100k_base.tiktoken: each line is a token's bytes in base64 and its
+// rank, separated by a space.
+func LoadBPE(path string) (*BPETokenizer, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	t := &BPETokenizer{ranks: map[string]int{}}
+	sc := bufio.NewScanner(f)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" {
+			continue
+		}
+		token, rank, ok := strings.Cut(line, " ")
+		b, err := base64.StdEncoding.DecodeString(token)
+		if !ok || err != nil {
+			return nil, fmt.Errorf("%s:%d: not a base64 token and a rank", path, n)
+		}
+		r, err := strconv.Atoi(rank)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: rank %q is not a number", path, n, rank)
+		}
+		t.ranks[string(b)] = r
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	if len(t.ranks) == 0 {
+		return nil, fmt.Errorf("%s has no tokens", path)
+	}
+	return t, nil
+}
+
+func (t *BPETokenizer) CountTokens(text string) int {
+	n := 0
+	pretokenize(text, func(piece string) { n += t.pieceTokens(piece) })
+	return n
+}
+
+// pieceTokens returns the tokens of a piece: starting from its bytes, the
+// adjacent pair whose join ranks lowest is merged until no join is a
+// token.
+func (t *BPETokenizer) pieceTokens(piece string) int {
+	if _, ok := t.ranks[piece]; ok {
+		return 1
+	}
+	parts := make([]string, len(piece))
+	for i := range parts {
+		parts[i] = piece[i : i+1]
+	}
+	for len(parts) > 1 {
+		best, at := -1, -1
+		for i := 0; i+1 < len(parts); i++ {
+			if r, ok := t.ranks[parts[i]+parts[i+1]]; ok && (best < 0 || r < best) {
+				best, at = r, i
+			}
+		}
+		if at < 0 {
+			break
+		}
+		parts[at] += parts[at+1]
+		parts = append(parts[:at+1], parts[at+2:]...)
+	}
+	return len(parts)
+}
+
+// ParseTokenizer returns the tokenizer -tokenizer names: heuristic, for
+// HeuristicTokenizer, or bpe:PATH, for the BPETokenizer of the tiktoken
+// file at PATH.
+func ParseTokenizer(spec string) (Tokenizer, error) {
+	if spec == TokenizerHeuristic {
+		return HeuristicTokenizer{}, nil
+	}
+	path, ok := strings.CutPrefix(spec, "bpe:")
+	if !ok {
+		return nil, fmt.Errorf("tokenizer %q is not %s or bpe:PATH", spec, TokenizerHeuristic)
+	}
+	if path == "" {
+		return nil, errors.New("tokenizer bpe: has no path")
+	}
+	t, err := LoadBPE(path)
+	if err != nil {
+		return nil, fmt.Errorf("loading tokenizer: %w", err)
+	}
+	return t, nil
+}
@@ -0,0 +1,86 @@
+package pdfripper
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// PageTransform says how TransformPDF rearranges a document, such as a
+// scan with pages upside down or out of order.
+type PageTransform struct {
+	Order     []int       // Input pages, 1-indexed, in their new order; pages may be left out or repeated. Empty keeps every page in place.
+	Rotate    map[int]int // Degrees to turn input pages clockwise by, a multiple of 90, on top of their own rotation.
+	RotateAll int         // Degrees to turn every page clockwise by, a multiple of 90, on top of Rotate.
+}
+
+// ParsePageList parses a comma-separated list of page numbers and ranges,
+// such as "3,1,2,4-10". A range may run backwards, as "10-1" does.
+func ParsePageList(s string) ([]int, error) {
+	var pages []int
+	for _, field := range strings.Split(s, ",") {
+		field = strings.TrimSpace(field)
+		first, last, isRange := strings.Cut(field, "-")
+		from, err := strconv.Atoi(first)
+		if err != nil || from < 1 {
+			return nil, fmt.Errorf("invalid page %q", field)
+		}
+		to := from
+		if isRange {
+			if to, err = strconv.Atoi(last); err != nil || to < 1 {
+				return nil, fmt.Errorf("invalid page range %q", field)
+			}
+		}
+		step := 1
+		if to < from {
+			step = -1
+		}
+		for p := from; p != to+step; p += step {
+			pages = append(pages, p)
+		}
+	}
+	return pages, nil
+}
+
+// TransformPDF writes the pages of inFile to outFile reordered and rotated
+// as t says. As with MergePDFs, only the pages and what they use are
+// kept.
+func TransformPDF(inFile, outFile string, t PageTransform) error {
+	d, err := openPDFFile(inFile)
+	if err != nil {
+		return err
+	}
+	order := t.Order
+	if len(order) == 0 {
+		order = make([]int, len(d.pages))
+		for i := range order {
+			order[i] = i + 1
+		}
+	}
+	if t.RotateAll%90 != 0 {
+		return fmt.Errorf("cannot rotate pages by %d degrees, which is not a multiple of 90", t.RotateAll)
+	}
+	for page, degrees := range t.Rotate {
+		if page < 1 || page > len(d.pages) {
+			return fmt.Errorf("cannot rotate page %d of a %d-page document", page, len(d.pages))
+		}
+		if degrees%90 != 0 {
+			return fmt.Errorf("cannot rotate page %d by %d degrees, which is not a multiple of 90", page, degrees)
+		}
+	}
+
+	pages := make([]pdfPage, len(order))
+	rotate := make([]int, len(order))
+	for i, n := range order {
+		if n < 1 || n > len(d.pages) {
+			return fmt.Errorf("page %d is out of range for a %d-page document", n, len(d.pages))
+		}
+		pages[i] = d.pages[n-1]
+		rotate[i] = ((pages[i].rotate+t.Rotate[n]+t.RotateAll)%360 + 360) % 360
+	}
+
+	w := &pdfWriter{}
+	catalog, tree := w.reserve(), w.reserve()
+	c := &pdfCopier{d: d, w: w, nums: map[int]int{}}
+	return w.writeFile(outFile, catalog, tree, c.copyPages(pdfRef{num: tree}, pages, rotate))
+}
@@ -0,0 +1,66 @@
+package pdfripper
+
+import (
+	"os"
+	"sync"
+	"time"
+)
+
+// ResourceUsage is what the external commands run for a page used, as
+// ExecRunner measures them; pages of backends that run none, such as
+// native, and of other Runners have none.
+type ResourceUsage struct {
+	CPU      time.Duration // User and system CPU time, summed over the commands.
+	MaxRSS   int64         // Peak resident set size of the largest of them, in bytes; Linux and macOS only.
+	Commands int           // Commands run.
+}
+
+func (u *ResourceUsage) add(o ResourceUsage) {
+	u.CPU += o.CPU
+	u.MaxRSS = max(u.MaxRSS, o.MaxRSS)
+	u.Commands += o.Commands
+}
+
+// usageMeter adds up the usage of the commands run for a page. It is
+// shared by the copies of the Sandbox it is set in; its methods do
+// nothing on a nil meter.
+type usageMeter struct {
+	mu   sync.Mutex
+	used ResourceUsage
+}
+
+// record adds the usage of a finished command.
+func (m *usageMeter) record(ps *os.ProcessState) {
+	if m == nil || ps == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.used.add(ResourceUsage{CPU: ps.UserTime() + ps.SystemTime(), MaxRSS: maxRSS(ps), Commands: 1})
+}
+
+// total returns the usage recorded so far.
+func (m *usageMeter) total() ResourceUsage {
+	if m == nil {
+		return ResourceUsage{}
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.used
+}
+
+// metered is implemented by the backends and engines whose commands can
+// be metered.
+type metered interface {
+	// withMeter returns a copy that records the usage of its commands in m.
+	withMeter(m *usageMeter) any
+}
+
+// metering returns v, or a copy of it recording the usage of its
+// commands in m if it is metered.
+func metering[T any](v T, m *usageMeter) T {
+	if mv, ok := any(v).(metered); ok && m != nil {
+		return mv.withMeter(m).(T)
+	}
+	return v
+}
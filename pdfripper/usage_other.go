@@ -0,0 +1,11 @@
+//go:build !linux && !darwin
+
+package pdfripper
+
+import "os"
+
+// maxRSS cannot tell the peak resident set size of a command on this
+// platform.
+func maxRSS(ps *os.ProcessState) int64 {
+	return 0
+}
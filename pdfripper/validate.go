@@ -0,0 +1,162 @@
+package pdfripper
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Validate checks the configuration for settings that cannot work, without
+// reading the input, and returns an error listing every problem found, or
+// nil. Extraction calls it first, so that a bad setting fails the run
+// before any page is extracted rather than part way through.
+func (e *Extractor) Validate() error {
+	var errs []error
+	bad := func(format string, args ...any) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+	if e.PDFFile == "" {
+		bad("no input PDF file is set")
+	}
+	backend := e.Backend
+	if backend == nil {
+		// Runs use the default backend.
+		var err error
+		if backend, err = LookupBackend(DefaultBackend); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	for _, n := range []struct {
+		name  string
+		value int64
+	}{
+		{"ProcessCount", int64(e.ProcessCount)},
+		{"PostProcessCount", int64(e.PostProcessCount)},
+		{"MaxInFlight", int64(e.MaxInFlight)},
+		{"BatchSize", int64(e.BatchSize)},
+		{"PageRetries", int64(e.PageRetries)},
+		{"ChunkSize", int64(e.ChunkSize)},
+		{"ChunkOverlap", int64(e.ChunkOverlap)},
+		{"MaxFileSizeBytes", e.MaxFileSizeBytes},
+		{"MaxPages", int64(e.MaxPages)},
+		{"SampleSize", int64(e.SampleSize)},
+		{"OCRDPI", int64(e.OCRDPI)},
+		{"OCRWorkers", int64(e.OCRWorkers)},
+		{"BarcodeDPI", int64(e.BarcodeDPI)},
+		{"EquationDPI", int64(e.EquationDPI)},
+		{"FigureDPI", int64(e.FigureDPI)},
+	} {
+		if n.value < 0 {
+			bad("%s %d is negative", n.name, n.value)
+		}
+	}
+	for _, d := range []struct {
+		name  string
+		value time.Duration
+	}{
+		{"HeartbeatInterval", e.HeartbeatInterval},
+		{"SlowPage", e.SlowPage},
+	} {
+		if d.value < 0 {
+			bad("%s %s is negative", d.name, d.value)
+		}
+	}
+	if a := e.Autoscale; a != nil {
+		if a.Min < 0 || a.Max < 0 || a.Interval < 0 {
+			bad("Autoscale's Min, Max and Interval cannot be negative")
+		}
+		if a.Max > 0 && a.Min > a.Max {
+			bad("Autoscale's Min %d is over its Max %d", a.Min, a.Max)
+		}
+	}
+	if a := e.Agreement; a != nil {
+		if a.Backend == nil {
+			bad("Agreement has no Backend")
+		}
+		if a.Pages < 0 {
+			bad("Agreement's Pages %d is negative", a.Pages)
+		}
+		if a.Threshold < 0 || a.Threshold > 1 {
+			bad("Agreement's Threshold %g is outside 0 to 1", a.Threshold)
+		}
+	}
+	if e.Segment != "" && !slices.Contains(Segmentations, e.Segment) {
+		bad("unknown Segment %q (available: %s)", e.Segment, strings.Join(Segmentations, ", "))
+	}
+	if s := e.Summarize; s != nil {
+		if s.Model == nil {
+			bad("Summarize has no Model")
+		}
+		if s.MaxChars < 0 {
+			bad("Summarize's MaxChars %d is negative", s.MaxChars)
+		}
+	}
+	if v := e.Vectors; v != nil {
+		if e.ChunkSize <= 0 {
+			bad("Vectors needs ChunkSize")
+		}
+		if v.Embedder == nil || v.Store == nil {
+			bad("Vectors needs an Embedder and a Store")
+		}
+		if v.BatchSize < 0 {
+			bad("Vectors' BatchSize %d is negative", v.BatchSize)
+		}
+	}
+	if e.ChunkSize > 0 && e.ChunkOverlap >= e.ChunkSize {
+		bad("ChunkOverlap %d is not less than ChunkSize %d", e.ChunkOverlap, e.ChunkSize)
+	}
+	if e.OCRThreshold < 0 || e.OCRThreshold > 1 {
+		bad("OCRThreshold %g is outside 0 to 1", e.OCRThreshold)
+	}
+	if e.SampleFraction < 0 || e.SampleFraction > 1 {
+		bad("SampleFraction %g is outside 0 to 1", e.SampleFraction)
+	}
+	if e.SampleSize > 0 && e.SampleFraction > 0 {
+		bad("SampleSize and SampleFraction cannot both be set")
+	}
+	if e.ReviewThreshold < 0 || e.ReviewThreshold > 1 {
+		bad("ReviewThreshold %g is outside 0 to 1", e.ReviewThreshold)
+	}
+	if e.OCR != nil && backend != nil {
+		if _, ok := backend.(Renderer); !ok {
+			bad("OCR needs a backend that can render pages; %s cannot", backend.Name())
+		}
+	}
+	if err := e.checkOCRLayout(); err != nil {
+		errs = append(errs, err)
+	}
+	if err := e.checkLineNumbers(); err != nil {
+		errs = append(errs, err)
+	}
+	if err := e.checkPageOrder(); err != nil {
+		errs = append(errs, err)
+	}
+	if err := e.checkSanitize(); err != nil {
+		errs = append(errs, err)
+	}
+	if err := e.checkConfined(); err != nil {
+		errs = append(errs, err)
+	}
+	switch e.FilterOrientation {
+	case "", Portrait, Landscape, Square:
+	default:
+		bad("unknown orientation %q (available: %s, %s, %s)", e.FilterOrientation, Portrait, Landscape, Square)
+	}
+	for _, format := range e.ManifestFormats {
+		if !slices.Contains(ManifestFormats, format) {
+			bad("unknown manifest format %q (available: %s)", format, strings.Join(ManifestFormats, ", "))
+		}
+	}
+	if e.BatesFileNames && e.SkipPageFiles {
+		bad("BatesFileNames names page files, but SkipPageFiles is set")
+	}
+	if e.TOCInCombined && (!e.TOC || e.CombinedFile == "") {
+		bad("TOCInCombined needs TOC and CombinedFile")
+	}
+	if e.LabelFileNames && e.SkipPageFiles {
+		bad("LabelFileNames names page files, but SkipPageFiles is set")
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,430 @@
+package pdfripper
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultVectorBatch is the number of chunks a VectorSink embeds and
+// upserts at a time when BatchSize is not set.
+const DefaultVectorBatch = 64
+
+// vectorTimeout bounds each request of the embedders and stores that have
+// no Client of their own.
+const vectorTimeout = 2 * time.Minute
+
+var vectorClient = &http.Client{Timeout: vectorTimeout}
+
+// VectorSink turns the run into the ingestion of a retrieval index, set
+// as Extractor.Vectors with ChunkSize: every chunk is embedded with
+// Embedder and upserted into Store, with the document it is of, its pages
+// and the document's metadata, if that is recorded. Before its first
+// chunks go in, Store drops those a previous run left of the document, so
+// that running again replaces them.
+type VectorSink struct {
+	Embedder  Embedder
+	Store     VectorStore
+	Document  string // Recorded with every chunk as "document", and its ID is made from it (default: PDFFile's base name); with Sanitize, its pseudonym is.
+	BatchSize int    // Chunks embedded and upserted at a time (default: DefaultVectorBatch).
+}
+
+// Embedder computes the embedding vectors of texts, one per text, in
+// order.
+type Embedder interface {
+	Embed(ctx context.Context, texts []string) ([][]float32, error)
+}
+
+// VectorStore is a vector database that a VectorSink fills.
+type VectorStore interface {
+	// DeleteDocument drops the chunks of a document, if there are any.
+	DeleteDocument(ctx context.Context, document string) error
+	// Upsert adds the chunks, replacing those with the same IDs.
+	Upsert(ctx context.Context, chunks []VectorChunk) error
+}
+
+// VectorChunk is a chunk as a VectorStore holds it.
+type VectorChunk struct {
+	Chunk
+	ID       string            // A UUID made from Document and the chunk's number, the same in every run.
+	Document string            // VectorSink.Document.
+	Metadata map[string]string // The document's metadata, if the run recorded it.
+	Vector   []float32
+}
+
+// Payload returns what is stored with the chunk's vector: its chunk
+// number, document, pages and text, its tokens if they were counted, and
+// the document's metadata if it was recorded.
+func (c *VectorChunk) Payload() map[string]any {
+	p := map[string]any{
+		"document":   c.Document,
+		"chunk":      c.Chunk.Chunk,
+		"first_page": c.FirstPage,
+		"last_page":  c.LastPage,
+		"text":       c.Text,
+	}
+	if c.Tokens > 0 {
+		p["tokens"] = c.Tokens
+	}
+	if len(c.Metadata) > 0 {
+		p["metadata"] = c.Metadata
+	}
+	return p
+}
+
+// vectorID returns the ID of chunk n of document, as a UUID in the form of
+// version 5, which Qdrant and Weaviate both take.
+func vectorID(document string, n int) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s\x00%d", document, n)))
+	sum[6] = sum[6]&0x0f | 0x50
+	sum[8] = sum[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", sum[0:4], sum[4:6], sum[6:8], sum[8:10], sum[10:16])
+}
+
+// vectorIngest sends the chunks of a run to its VectorSink in batches.
+type vectorIngest struct {
+	ctx      context.Context
+	sink     *VectorSink
+	document string
+	metadata map[string]string
+	pending  []VectorChunk
+	cleared  bool // The document's old chunks have been dropped.
+	sent     int
+}
+
+// startVectors returns the ingestion of the run's chunks, or nil if
+// Vectors is not set.
+func (e *Extractor) startVectors(ctx context.Context) *vectorIngest {
+	if e.Vectors == nil {
+		return nil
+	}
+	document := e.Vectors.Document
+	if document == "" {
+		document = filepath.Base(e.PDFFile)
+	}
+	if e.Sanitize != nil {
+		document = e.Sanitize.Pseudonym(document)
+	}
+	return &vectorIngest{ctx: ctx, sink: e.Vectors, document: document, metadata: e.metadata}
+}
+
+// add queues a chunk, sending the batch once it is full.
+func (v *vectorIngest) add(c Chunk) error {
+	v.pending = append(v.pending, VectorChunk{Chunk: c, ID: vectorID(v.document, c.Chunk), Document: v.document, Metadata: v.metadata})
+	size := v.sink.BatchSize
+	if size <= 0 {
+		size = DefaultVectorBatch
+	}
+	if len(v.pending) < size {
+		return nil
+	}
+	return v.flush()
+}
+
+// flush embeds and upserts the queued chunks, first dropping the
+// document's old ones if it has not yet.
+func (v *vectorIngest) flush() error {
+	if !v.cleared {
+		if err := v.sink.Store.DeleteDocument(v.ctx, v.document); err != nil {
+			return fmt.Errorf("deleting the old chunks of %s: %w", v.document, err)
+		}
+		v.cleared = true
+	}
+	if len(v.pending) == 0 {
+		return nil
+	}
+	texts := make([]string, len(v.pending))
+	for i, c := range v.pending {
+		texts[i] = c.Text
+	}
+	vectors, err := v.sink.Embedder.Embed(v.ctx, texts)
+	if err != nil {
+		return fmt.Errorf("embedding chunks: %w", err)
+	}
+	if len(vectors) != len(texts) {
+		return fmt.Errorf("embedding %d chunks returned %d vectors", len(texts), len(vectors))
+	}
+	for i := range v.pending {
+		v.pending[i].Vector = vectors[i]
+	}
+	if err := v.sink.Store.Upsert(v.ctx, v.pending); err != nil {
+		return fmt.Errorf("upserting chunks: %w", err)
+	}
+	v.sent += len(v.pending)
+	v.pending = v.pending[:0]
+	return nil
+}
+
+// close sends the last batch.
+func (v *vectorIngest) close() error {
+	if err := v.flush(); err != nil {
+		return err
+	}
+	fmt.Printf("Upserted %d chunks of %s into the vector store\n", v.sent, v.document)
+	return nil
+}
+
+// HTTPEmbedder computes embeddings with an OpenAI-compatible embeddings
+// endpoint, such as OpenAI's own, Ollama's, vLLM's or Hugging Face's Text
+// Embeddings Inference /v1/embeddings: the texts are POSTed as
+//
+//	{"model": "...", "input": ["...", ...]}
+//
+// and the endpoint answers with {"data": [{"index": 0, "embedding": [...]}, ...]}.
+// Network errors, 429 and 5xx responses are retried, backing off from a
+// second.
+type HTTPEmbedder struct {
+	URL     string       // Endpoint to POST texts to.
+	Model   string       // Sent as "model", if set.
+	Token   string       // If set, sent as a bearer token.
+	Retries int          // Times a request is retried before the chunks fail.
+	Client  *http.Client // Client to use (default: one with a two-minute timeout).
+}
+
+func (h *HTTPEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	body, err := json.Marshal(struct {
+		Model string   `json:"model,omitempty"`
+		Input []string `json:"input"`
+	}{h.Model, texts})
+	if err != nil {
+		return nil, err
+	}
+	header := http.Header{}
+	if h.Token != "" {
+		header.Set("Authorization", "Bearer "+h.Token)
+	}
+	var resp struct {
+		Data []struct {
+			Index     int       `json:"index"`
+			Embedding []float32 `json:"embedding"`
+		} `json:"data"`
+	}
+	if err := requestJSON(ctx, h.Client, h.Retries, http.MethodPost, h.URL, header, body, &resp); err != nil {
+		return nil, err
+	}
+	vectors := make([][]float32, len(texts))
+	for _, d := range resp.Data {
+		if d.Index < 0 || d.Index >= len(texts) || len(d.Embedding) == 0 {
+			return nil, fmt.Errorf("%s answered with an embedding of index %d for %d texts", hostOf(h.URL), d.Index, len(texts))
+		}
+		vectors[d.Index] = d.Embedding
+	}
+	for i, v := range vectors {
+		if v == nil {
+			return nil, fmt.Errorf("%s answered with no embedding for text %d", hostOf(h.URL), i)
+		}
+	}
+	return vectors, nil
+}
+
+// QdrantStore upserts chunks into a Qdrant collection over its REST API,
+// as points whose payload is the chunk's Payload. The collection is
+// created, for cosine distance, if it does not exist.
+type QdrantStore struct {
+	URL        string       // Base URL, such as http://localhost:6333.
+	Collection string       // Created if it does not exist.
+	APIKey     string       // If set, sent as the api-key header.
+	Retries    int          // Times a request is retried before the chunks fail.
+	Client     *http.Client // Client to use (default: one with a two-minute timeout).
+
+	mu     sync.Mutex
+	exists bool // The collection is known to exist.
+}
+
+func (q *QdrantStore) request(ctx context.Context, method, path string, body any) error {
+	var data []byte
+	if body != nil {
+		var err error
+		if data, err = json.Marshal(body); err != nil {
+			return err
+		}
+	}
+	header := http.Header{}
+	if q.APIKey != "" {
+		header.Set("api-key", q.APIKey)
+	}
+	return requestJSON(ctx, q.Client, q.Retries, method, strings.TrimRight(q.URL, "/")+"/collections/"+url.PathEscape(q.Collection)+path, header, data, nil)
+}
+
+func (q *QdrantStore) DeleteDocument(ctx context.Context, document string) error {
+	err := q.request(ctx, http.MethodPost, "/points/delete?wait=true", map[string]any{
+		"filter": map[string]any{"must": []any{map[string]any{"key": "document", "match": map[string]any{"value": document}}}},
+	})
+	if notFound(err) {
+		return nil // No collection, so no chunks.
+	}
+	return err
+}
+
+func (q *QdrantStore) Upsert(ctx context.Context, chunks []VectorChunk) error {
+	if len(chunks) == 0 {
+		return nil
+	}
+	q.mu.Lock()
+	if !q.exists {
+		err := q.request(ctx, http.MethodPut, "", map[string]any{"vectors": map[string]any{"size": len(chunks[0].Vector), "distance": "Cosine"}})
+		var status *statusError
+		if err != nil && !(errors.As(err, &status) && status.status == http.StatusConflict) {
+			if err := q.request(ctx, http.MethodGet, "", nil); err != nil {
+				q.mu.Unlock()
+				return fmt.Errorf("creating collection %s: %w", q.Collection, err)
+			}
+		}
+		q.exists = true
+	}
+	q.mu.Unlock()
+	points := make([]map[string]any, len(chunks))
+	for i := range chunks {
+		points[i] = map[string]any{"id": chunks[i].ID, "vector": chunks[i].Vector, "payload": chunks[i].Payload()}
+	}
+	return q.request(ctx, http.MethodPut, "/points?wait=true", map[string]any{"points": points})
+}
+
+// WeaviateStore upserts chunks into a Weaviate class over its REST API,
+// as objects whose properties are the chunk's Payload; Weaviate's
+// auto-schema creates the class if it does not exist.
+type WeaviateStore struct {
+	URL     string       // Base URL, such as http://localhost:8080.
+	Class   string       // Starting with an upper-case letter, as Weaviate requires.
+	APIKey  string       // If set, sent as a bearer token.
+	Retries int          // Times a request is retried before the chunks fail.
+	Client  *http.Client // Client to use (default: one with a two-minute timeout).
+}
+
+func (w *WeaviateStore) request(ctx context.Context, method, path string, body, out any) error {
+	var data []byte
+	if body != nil {
+		var err error
+		if data, err = json.Marshal(body); err != nil {
+			return err
+		}
+	}
+	header := http.Header{}
+	if w.APIKey != "" {
+		header.Set("Authorization", "Bearer "+w.APIKey)
+	}
+	return requestJSON(ctx, w.Client, w.Retries, method, strings.TrimRight(w.URL, "/")+path, header, data, out)
+}
+
+func (w *WeaviateStore) DeleteDocument(ctx context.Context, document string) error {
+	if err := w.request(ctx, http.MethodGet, "/v1/schema/"+url.PathEscape(w.Class), nil, nil); notFound(err) {
+		return nil // No class, so no chunks.
+	} else if err != nil {
+		return err
+	}
+	return w.request(ctx, http.MethodDelete, "/v1/batch/objects", map[string]any{
+		"match": map[string]any{"class": w.Class, "where": map[string]any{"path": []string{"document"}, "operator": "Equal", "valueText": document}},
+	}, nil)
+}
+
+func (w *WeaviateStore) Upsert(ctx context.Context, chunks []VectorChunk) error {
+	objects := make([]map[string]any, len(chunks))
+	for i := range chunks {
+		objects[i] = map[string]any{"class": w.Class, "id": chunks[i].ID, "vector": chunks[i].Vector, "properties": chunks[i].Payload()}
+	}
+	var results []struct {
+		Result struct {
+			Errors *struct {
+				Error []struct {
+					Message string `json:"message"`
+				} `json:"error"`
+			} `json:"errors"`
+		} `json:"result"`
+	}
+	if err := w.request(ctx, http.MethodPost, "/v1/batch/objects", map[string]any{"objects": objects}, &results); err != nil {
+		return err
+	}
+	for i, r := range results {
+		if e := r.Result.Errors; e != nil && len(e.Error) > 0 {
+			return fmt.Errorf("chunk %d: %s", chunks[min(i, len(chunks)-1)].Chunk.Chunk, e.Error[0].Message)
+		}
+	}
+	return nil
+}
+
+// statusError is the error of a response with a status other than
+// 2xx.
+type statusError struct {
+	status int
+	err    error
+}
+
+func (e *statusError) Error() string { return e.err.Error() }
+
+func notFound(err error) bool {
+	var status *statusError
+	return errors.As(err, &status) && status.status == http.StatusNotFound
+}
+
+// requestJSON makes a JSON request with client, or one with a two-minute
+// timeout if it is nil, retrying network errors, 429 and 5xx responses up
+// to retries times, after a second and twice as long each time after
+// that, and decodes the response into out, if it is not nil.
+func requestJSON(ctx context.Context, client *http.Client, retries int, method, target string, header http.Header, body []byte, out any) error {
+	if client == nil {
+		client = vectorClient
+	}
+	delay := time.Second
+	for attempt := 0; ; attempt++ {
+		err := attemptJSON(ctx, client, method, target, header, body, out)
+		var status *statusError
+		if err == nil || errors.As(err, &status) && status.status != http.StatusTooManyRequests && status.status < 500 || attempt >= retries || ctx.Err() != nil {
+			return err
+		}
+		if err := sleepContext(ctx, delay); err != nil {
+			return err
+		}
+		delay *= 2
+	}
+}
+
+func attemptJSON(ctx context.Context, client *http.Client, method, target string, header http.Header, body []byte, out any) error {
+	var r io.Reader
+	if body != nil {
+		r = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, target, r)
+	if err != nil {
+		return &statusError{err: err}
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return &statusError{status: resp.StatusCode, err: fmt.Errorf("%s returned status %d: %s", req.URL.Host, resp.StatusCode, strings.TrimSpace(string(msg)))}
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return &statusError{err: fmt.Errorf("decoding response from %s: %w", req.URL.Host, err)}
+	}
+	return nil
+}
+
+// hostOf returns the host of a URL, for errors.
+func hostOf(raw string) string {
+	if u, err := url.Parse(raw); err == nil && u.Host != "" {
+		return u.Host
+	}
+	return raw
+}
@@ -0,0 +1,117 @@
+package pdfripper
+
+import (
+	"cmp"
+	"math"
+	"slices"
+	"strings"
+	"unicode/utf8"
+)
+
+// Vertical text modes, accepted by VerticalTexter.WithVerticalText.
+const (
+	VerticalAuto  = "auto"  // Text in vertical fonts, and characters stacked into columns, is read as columns.
+	VerticalForce = "force" // All text on the page is read as columns.
+	VerticalOff   = "off"   // Text is joined in the order it is drawn.
+)
+
+// VerticalTextModes lists the vertical text modes.
+var VerticalTextModes = []string{VerticalAuto, VerticalForce, VerticalOff}
+
+// stackedRun is how many characters have to be stacked one below the other
+// for VerticalAuto to take them for a column of vertical text.
+const stackedRun = 3
+
+// layoutFragments lays out the text of a page. Runs of vertical fragments
+// (see markVertical) are read as columns, from right to left, and the rest
+// is joined into lines by layoutLines.
+func layoutFragments(frags []textFragment, mode string) string {
+	frags = slices.DeleteFunc(slices.Clone(frags), func(f textFragment) bool { return f.text == "" })
+	if mode == VerticalOff {
+		return layoutLines(frags)
+	}
+	markVertical(frags, mode)
+
+	var b strings.Builder
+	for start := 0; start < len(frags); {
+		end := start + 1
+		for end < len(frags) && frags[end].vertical == frags[start].vertical {
+			end++
+		}
+		if frags[start].vertical {
+			b.WriteString(layoutColumns(frags[start:end]))
+		} else {
+			b.WriteString(layoutLines(frags[start:end]))
+		}
+		start = end
+	}
+	return b.String()
+}
+
+// markVertical marks the fragments that make up vertical text under mode.
+// Fragments in vertical fonts are marked already; VerticalAuto also marks
+// upright characters drawn one below the other, as producers without
+// vertical fonts typeset tategaki, and VerticalForce marks everything.
+func markVertical(frags []textFragment, mode string) {
+	if mode == VerticalForce {
+		for i := range frags {
+			frags[i].vertical = true
+		}
+		return
+	}
+	run := 1 // characters stacked so far, ending at frags[i]
+	for i := 1; i < len(frags); i++ {
+		if !stacked(&frags[i-1], &frags[i]) {
+			run = 1
+			continue
+		}
+		run++
+		if run >= stackedRun {
+			for j := i - run + 1; j <= i; j++ {
+				frags[j].vertical = true
+			}
+		}
+	}
+}
+
+// stacked reports whether f is a single upright character drawn right
+// below the single character prev.
+func stacked(prev, f *textFragment) bool {
+	single := func(f *textFragment) bool {
+		return f.dirX > 0.99 && utf8.RuneCountInString(strings.TrimSpace(f.text)) == 1
+	}
+	if !single(prev) || !single(f) {
+		return false
+	}
+	size := math.Max(math.Max(f.size, prev.size), 1)
+	drop := prev.y0 - f.y0
+	return math.Abs(f.x0-prev.x0) < 0.3*size && drop > 0.5*size && drop < 2*size
+}
+
+// layoutColumns lays out vertical text as one line per column, reading the
+// columns from right to left and each column from top to bottom.
+func layoutColumns(frags []textFragment) string {
+	sorted := slices.Clone(frags)
+	slices.SortStableFunc(sorted, func(a, b textFragment) int { return cmp.Compare(b.x0, a.x0) })
+	var columns [][]textFragment
+	for _, f := range sorted {
+		if n := len(columns); n > 0 {
+			first := columns[n-1][0]
+			if first.x0-f.x0 < 0.5*math.Max(math.Max(first.size, f.size), 1) {
+				columns[n-1] = append(columns[n-1], f)
+				continue
+			}
+		}
+		columns = append(columns, []textFragment{f})
+	}
+
+	var b strings.Builder
+	for _, col := range columns {
+		slices.SortStableFunc(col, func(a, b textFragment) int { return cmp.Compare(b.y0, a.y0) })
+		for _, f := range col {
+			b.WriteString(strings.TrimSpace(f.text))
+		}
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
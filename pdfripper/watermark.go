@@ -0,0 +1,231 @@
+package pdfripper
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Watermark is text that DetectWatermarks judged to be a watermark or a
+// stamp rather than part of the page content.
+type Watermark struct {
+	Text  string  `json:"text"`  // As drawn, with runs of spaces collapsed.
+	Angle float64 `json:"angle"` // Degrees counterclockwise from horizontal.
+	Pages []int   `json:"pages"`
+	Stamp bool    `json:"stamp"` // A stamp word such as RECEIVED or PAID, rather than text repeated across pages.
+}
+
+// WatermarkReport lists the watermarks and stamps found in a document.
+type WatermarkReport struct {
+	Watermarks []Watermark
+}
+
+// Watermarked reports whether anything was found.
+func (r *WatermarkReport) Watermarked() bool { return len(r.Watermarks) > 0 }
+
+// stampWords start the text of common rubber stamps and draft markings.
+var stampWords = []string{
+	"APPROVED", "CANCELED", "CANCELLED", "CONFIDENTIAL", "COPY", "DO NOT COPY",
+	"DRAFT", "DUPLICATE", "FILE COPY", "FINAL", "INTERNAL USE ONLY",
+	"NOT FOR DISTRIBUTION", "ORIGINAL", "PAID", "PRELIMINARY", "RECEIVED",
+	"REJECTED", "SAMPLE", "SECRET", "SPECIMEN", "TOP SECRET", "URGENT", "VOID",
+}
+
+// DetectWatermarks looks for text drawn at an angle, or at least 2.5 times
+// the page's usual font size. Such text is reported as a watermark when
+// the same text appears on at least half of the pages (and at least two),
+// and as a stamp when it begins with a stamp word like DRAFT or PAID.
+// Pages whose content cannot be parsed are skipped.
+func DetectWatermarks(pdfFile string) (*WatermarkReport, error) {
+	d, err := openPDFFile(pdfFile)
+	if err != nil {
+		return nil, err
+	}
+
+	found := map[string]*Watermark{}
+	var keys []string
+	for i := range d.pages {
+		for _, run := range d.markCandidates(i) {
+			key := watermarkKey(run.text)
+			w, ok := found[key]
+			if !ok {
+				w = &Watermark{Text: run.text, Angle: run.angle()}
+				found[key] = w
+				keys = append(keys, key)
+			}
+			if n := len(w.Pages); n == 0 || w.Pages[n-1] != i+1 {
+				w.Pages = append(w.Pages, i+1)
+			}
+		}
+	}
+
+	report := &WatermarkReport{}
+	repeated := max(2, (len(d.pages)+1)/2)
+	for _, key := range keys {
+		w := found[key]
+		switch {
+		case len(w.Pages) >= repeated:
+		case isStampText(key):
+			w.Stamp = true
+		default:
+			continue
+		}
+		report.Watermarks = append(report.Watermarks, *w)
+	}
+	sort.SliceStable(report.Watermarks, func(i, j int) bool {
+		return len(report.Watermarks[i].Pages) > len(report.Watermarks[j].Pages)
+	})
+	return report, nil
+}
+
+// markCandidates returns the runs of text on page index that are rotated
+// or oversized. Malformed content yields none.
+func (d *pdfDoc) markCandidates(index int) (candidates []textRun) {
+	defer func() {
+		if recover() != nil {
+			candidates = nil
+		}
+	}()
+	frags, err := d.pageFragments(index)
+	if err != nil {
+		return nil
+	}
+	runs := textRuns(frags)
+	body, ok := bodySize(runs)
+	if !ok {
+		return nil
+	}
+
+	for _, run := range runs {
+		if !hasLetters(run.text, 3) {
+			continue
+		}
+		if run.rotated() || run.size >= 2.5*body {
+			candidates = append(candidates, run)
+		}
+	}
+	return candidates
+}
+
+// bodySize returns the font size used for the most characters in runs,
+// so that text drawn one glyph per fragment does not count for more.
+func bodySize(runs []textRun) (float64, bool) {
+	chars := map[float64]int{}
+	best := 0.0
+	for _, r := range runs {
+		size := math.Round(r.size*10) / 10
+		chars[size] += utf8.RuneCountInString(r.text)
+		if chars[size] > chars[best] || chars[size] == chars[best] && size < best {
+			best = size
+		}
+	}
+	return best, chars[best] > 0
+}
+
+// textRun is a sequence of fragments drawn along the same baseline.
+type textRun struct {
+	text       string
+	dirX, dirY float64
+	size       float64
+}
+
+func (r textRun) angle() float64 {
+	return math.Round(math.Atan2(r.dirY, r.dirX)*180/math.Pi*10) / 10
+}
+
+// rotated reports whether the run is neither horizontal nor vertical.
+func (r textRun) rotated() bool {
+	a := math.Mod(math.Abs(r.angle()), 90)
+	return a > 2 && a < 88
+}
+
+// textRuns joins consecutive fragments that continue the same baseline,
+// in the same direction and size, so that text drawn one glyph at a time
+// is seen as a whole.
+func textRuns(frags []textFragment) []textRun {
+	var runs []textRun
+	var prev *textFragment
+	for i := range frags {
+		f := &frags[i]
+		if f.text == "" {
+			continue
+		}
+		if prev != nil && f.dirX*prev.dirX+f.dirY*prev.dirY > 0.99 && math.Abs(f.size-prev.size) <= 0.1*f.size {
+			dx, dy := f.x0-prev.x1, f.y0-prev.y1
+			along := dx*f.dirX + dy*f.dirY
+			across := -dx*f.dirY + dy*f.dirX
+			if math.Abs(across) <= 0.5*f.size && along > -0.5*f.size && along <= f.size {
+				r := &runs[len(runs)-1]
+				if along > 0.15*f.size {
+					r.text += " "
+				}
+				r.text += f.text
+				prev = f
+				continue
+			}
+		}
+		runs = append(runs, textRun{text: f.text, dirX: f.dirX, dirY: f.dirY, size: f.size})
+		prev = f
+	}
+	for i := range runs {
+		runs[i].text = strings.Join(strings.Fields(runs[i].text), " ")
+	}
+	return runs
+}
+
+// watermarkKey normalizes text for comparison: upper case, spaces dropped,
+// so that letter-spaced renderings like "D R A F T" match "DRAFT".
+func watermarkKey(text string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) {
+			return -1
+		}
+		return unicode.ToUpper(r)
+	}, text)
+}
+
+func isStampText(key string) bool {
+	for _, w := range stampWords {
+		if strings.HasPrefix(key, watermarkKey(w)) {
+			return true
+		}
+	}
+	return false
+}
+
+func hasLetters(s string, n int) bool {
+	for _, r := range s {
+		if unicode.IsLetter(r) {
+			if n--; n == 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// removeWatermarks drops the lines of text that consist of nothing but a
+// watermark's text, and reports whether any were dropped.
+func removeWatermarks(text string, marks []Watermark) (string, bool) {
+	if len(marks) == 0 {
+		return text, false
+	}
+	keys := make(map[string]bool, len(marks))
+	for _, w := range marks {
+		keys[watermarkKey(w.Text)] = true
+	}
+	lines := strings.SplitAfter(text, "\n")
+	kept := lines[:0]
+	for _, line := range lines {
+		if keys[watermarkKey(line)] {
+			continue
+		}
+		kept = append(kept, line)
+	}
+	if len(kept) == len(lines) {
+		return text, false
+	}
+	return strings.Join(kept, ""), true
+}
@@ -0,0 +1,79 @@
+package pdfripper
+
+import (
+	"fmt"
+	"os"
+)
+
+// workspaced is implemented by the backends and engines that write
+// temporary files, so that an Extractor can move them into the workspace
+// of its run.
+type workspaced interface {
+	// inWorkspace returns a copy that makes its temporary files in dir,
+	// unless its Sandbox names a directory already.
+	inWorkspace(dir string) any
+}
+
+// enterWorkspace makes the temporary workspace of a run, in TempDir, and
+// points the backends and engines at it, Agreement's second backend
+// included, so that the images and working directories of the commands
+// they run all land there. It also fills in the defaults of zero fields
+// for the run. The returned function, to be deferred, puts the fields back
+// and removes the workspace unless KeepTemp is set.
+func (e *Extractor) enterWorkspace() (func(), error) {
+	// Before defaults can point the run outside the directories it may
+	// write in.
+	if err := e.checkConfined(); err != nil {
+		return nil, err
+	}
+	backend, ocr, equationOCR, decoder, agreement := e.Backend, e.OCR, e.EquationOCR, e.BarcodeDecoder, e.Agreement
+	processCount, postProcessCount, outputDir := e.ProcessCount, e.PostProcessCount, e.OutputDir
+	restore := func() {
+		e.Backend, e.OCR, e.EquationOCR, e.BarcodeDecoder, e.Agreement = backend, ocr, equationOCR, decoder, agreement
+		e.ProcessCount, e.PostProcessCount, e.OutputDir = processCount, postProcessCount, outputDir
+	}
+	if err := e.setDefaults(); err != nil {
+		return nil, err
+	}
+	dir, err := os.MkdirTemp(e.TempDir, "pdfripper-run-")
+	if err != nil {
+		restore()
+		return nil, fmt.Errorf("creating temporary workspace: %w", err)
+	}
+	if w, ok := e.Backend.(workspaced); ok {
+		e.Backend = w.inWorkspace(dir).(Backend)
+	}
+	if w, ok := e.OCR.(workspaced); ok {
+		e.OCR = w.inWorkspace(dir).(OCREngine)
+	}
+	if w, ok := e.EquationOCR.(workspaced); ok {
+		e.EquationOCR = w.inWorkspace(dir).(EquationOCR)
+	}
+	if w, ok := e.BarcodeDecoder.(workspaced); ok {
+		e.BarcodeDecoder = w.inWorkspace(dir).(BarcodeDecoder)
+	}
+	if a := e.Agreement; a != nil {
+		if w, ok := a.Backend.(workspaced); ok {
+			// A copy, so that the caller's Agreement is left as it was.
+			moved := *a
+			moved.Backend = w.inWorkspace(dir).(Backend)
+			e.Agreement = &moved
+		}
+	}
+	return func() {
+		restore()
+		if e.KeepTemp {
+			fmt.Printf("Kept temporary files in %s\n", dir)
+			return
+		}
+		os.RemoveAll(dir)
+	}, nil
+}
+
+// withTempDir returns sb with TempDir set to dir if it was empty.
+func (sb Sandbox) withTempDir(dir string) Sandbox {
+	if sb.TempDir == "" {
+		sb.TempDir = dir
+	}
+	return sb
+}
@@ -0,0 +1,45 @@
+package pdfripper
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+// workspaceBackend records the workspace it was moved into.
+type workspaceBackend struct {
+	rangeBackend
+	dir string
+}
+
+func (b *workspaceBackend) inWorkspace(dir string) any {
+	moved := *b
+	moved.dir = dir
+	return &moved
+}
+
+func TestEnterWorkspaceMovesAgreement(t *testing.T) {
+	first, second := &workspaceBackend{}, &workspaceBackend{}
+	agreement := &Agreement{Backend: second, Pages: 3}
+	e := &Extractor{Backend: first, Agreement: agreement, TempDir: t.TempDir()}
+	leave, err := e.enterWorkspace()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := e.Backend.(*workspaceBackend).dir
+	if filepath.Dir(dir) != e.TempDir {
+		t.Fatalf("backend moved to %q, want a directory in %q", dir, e.TempDir)
+	}
+	if e.Agreement == agreement {
+		t.Fatal("the caller's Agreement was modified")
+	}
+	if got := e.Agreement.Backend.(*workspaceBackend).dir; got != dir || e.Agreement.Pages != 3 {
+		t.Errorf("agreement backend moved to %q with %d pages, want %q with 3", got, e.Agreement.Pages, dir)
+	}
+	if second.dir != "" {
+		t.Errorf("the caller's agreement backend was moved to %q", second.dir)
+	}
+	leave()
+	if e.Backend != first || e.Agreement != agreement {
+		t.Error("leaving the workspace did not restore the backends")
+	}
+}
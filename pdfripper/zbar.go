@@ -0,0 +1,104 @@
+//go:build !noexec && !js && !wasip1
+
+package pdfripper
+
+import (
+	"encoding/xml"
+	"errors"
+	"image"
+	"image/png"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// ZBar decodes barcodes with the zbarimg command from ZBar, which reads
+// EAN/UPC, Code 128, Code 39, Code 93, Interleaved 2 of 5, Codabar,
+// DataBar, QR codes and more.
+type ZBar struct {
+	Sandbox Sandbox // Limits for each zbarimg process.
+	Runner  Runner  // Runs zbarimg (default: ExecRunner).
+}
+
+// zbarResult mirrors the parts of zbarimg's --xml output used here.
+type zbarResult struct {
+	Symbols []struct {
+		Type    string `xml:"type,attr"`
+		Data    string `xml:"data"`
+		Polygon struct {
+			Points string `xml:"points,attr"`
+		} `xml:"polygon"`
+	} `xml:"source>index>symbol"`
+}
+
+func (z *ZBar) inWorkspace(dir string) any {
+	c := *z
+	c.Sandbox = c.Sandbox.withTempDir(dir)
+	return &c
+}
+
+func (z *ZBar) DecodeBarcodes(img image.Image) ([]Barcode, error) {
+	dir, err := os.MkdirTemp(z.Sandbox.TempDir, "pdfripper-zbar-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "page.png")
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	err = png.Encode(f, img)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := runWith(z.Runner, z.Sandbox, nil, "zbarimg", "--quiet", "--xml", path)
+	if err != nil {
+		// zbarimg exits with status 4 when the image has no barcodes.
+		var exit exitCoder
+		if errors.As(err, &exit) && exit.ExitCode() == 4 {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var result zbarResult
+	if err := xml.Unmarshal(out, &result); err != nil {
+		return nil, err
+	}
+
+	codes := make([]Barcode, 0, len(result.Symbols))
+	for _, s := range result.Symbols {
+		b := Barcode{Symbology: s.Type, Value: s.Data}
+		b.X, b.Y, b.Width, b.Height = polygonBounds(s.Polygon.Points)
+		codes = append(codes, b)
+	}
+	return codes, nil
+}
+
+// polygonBounds parses zbar's "+x,y +x,y ..." polygon and returns its
+// bounding box. Older zbar versions omit the polygon, giving a zero box.
+func polygonBounds(points string) (x, y, w, h float64) {
+	minX, minY, maxX, maxY := math.Inf(1), math.Inf(1), math.Inf(-1), math.Inf(-1)
+	for _, p := range strings.Fields(points) {
+		xs, ys, ok := strings.Cut(strings.TrimPrefix(p, "+"), ",")
+		if !ok {
+			continue
+		}
+		px, err1 := strconv.ParseFloat(xs, 64)
+		py, err2 := strconv.ParseFloat(strings.TrimPrefix(ys, "+"), 64)
+		if err1 != nil || err2 != nil {
+			continue
+		}
+		minX, minY, maxX, maxY = min(minX, px), min(minY, py), max(maxX, px), max(maxY, py)
+	}
+	if math.IsInf(minX, 1) {
+		return 0, 0, 0, 0
+	}
+	return minX, minY, maxX - minX, maxY - minY
+}